@@ -0,0 +1,224 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package alarms provides a Service for named alarms, which are
+// delivered when their times are reached, as measured by a clock.Clock.
+// All of a Service's alarms are held in a single queue, rather than
+// each having its own timer.
+package alarms
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Service.
+type Config[P any] struct {
+	// Clock is used to determine when alarms are due.
+	Clock clock.Clock
+
+	// OnAlarm, if non-nil, is called with each alarm when it is due.
+	// OnAlarm is called from the Service's goroutine, without any
+	// locks held, and so may call the Service's methods. If OnAlarm
+	// is nil, alarms are instead sent on the Service's channel.
+	OnAlarm func(Alarm[P])
+}
+
+// Validate checks that the config is valid.
+func (config Config[P]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	return nil
+}
+
+// Alarm is a named alarm, with a payload of type P.
+type Alarm[P any] struct {
+	Name    string
+	Time    time.Time
+	Payload P
+}
+
+// Service delivers named alarms at their times. Each name identifies at
+// most one alarm: setting an alarm replaces any alarm with the same
+// name, and an alarm is removed from the Service when it is delivered
+// or cancelled.
+//
+// Service's methods are safe for concurrent use.
+type Service[P any] struct {
+	config Config[P]
+
+	mu     sync.Mutex
+	alarms *timequeue.Queue[string, Alarm[P]]
+
+	out    chan Alarm[P]
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New constructs and starts a new Service with the given configuration,
+// with no alarms. The Service will continue to deliver alarms until it
+// is killed.
+func New[P any](config Config[P]) (*Service[P], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating alarms config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Service[P]{
+		config: config,
+		alarms: timequeue.New[string, Alarm[P]](config.Clock),
+		out:    make(chan Alarm[P]),
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Kill stops the Service from delivering alarms. Kill does not wait
+// for the Service to stop; use Wait for that.
+func (s *Service[P]) Kill() {
+	s.cancel()
+}
+
+// Wait waits for the Service to stop.
+func (s *Service[P]) Wait() error {
+	<-s.done
+	return nil
+}
+
+// Chan returns the channel on which alarms are sent when they are due,
+// if the Service has no OnAlarm callback. The channel is never closed.
+func (s *Service[P]) Chan() <-chan Alarm[P] {
+	return s.out
+}
+
+// SetAlarm sets the alarm with the specified name to be delivered, with
+// the payload, at the specified time, replacing any existing alarm with
+// the name. An alarm whose time has been reached is delivered as soon
+// as possible.
+func (s *Service[P]) SetAlarm(name string, at time.Time, payload P) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alarm := Alarm[P]{Name: name, Time: at, Payload: payload}
+	if !s.alarms.Update(name, alarm, at) {
+		s.alarms.Add(name, alarm, at)
+	}
+	s.notify()
+}
+
+// CancelAlarm cancels the alarm with the specified name, and reports
+// whether it existed; an alarm that has been delivered no longer exists.
+func (s *Service[P]) CancelAlarm(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.alarms.Remove(name)
+	if ok {
+		s.notify()
+	}
+	return ok
+}
+
+// RenameAlarm renames the alarm with the name old to new, keeping its
+// time and payload. RenameAlarm returns an error satisfying
+// errors.IsNotFound if no alarm named old exists, or one satisfying
+// errors.IsAlreadyExists if an alarm named new exists.
+func (s *Service[P]) RenameAlarm(old, new string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alarm, _, ok := s.alarms.Get(old)
+	if !ok {
+		return errors.NotFoundf("alarm %q", old)
+	}
+	if old == new {
+		return nil
+	}
+	if _, _, ok := s.alarms.Get(new); ok {
+		return errors.AlreadyExistsf("alarm %q", new)
+	}
+	s.alarms.Remove(old)
+	alarm.Name = new
+	s.alarms.Add(new, alarm, alarm.Time)
+	return nil
+}
+
+// Alarm returns the pending alarm with the specified name, and a
+// boolean indicating whether or not it exists.
+func (s *Service[P]) Alarm(name string) (Alarm[P], bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alarm, _, ok := s.alarms.Get(name)
+	return alarm, ok
+}
+
+// Rearm causes the Service to recompute the time until its next alarm is
+// due. The Service waits for its next alarm with its clock's After, which
+// waits for a duration, so if the clock's time is stepped, such as when
+// the system's wall clock is corrected, alarms are delivered early or
+// late unless the Service is rearmed; see clock.ChangeWatcher.
+func (s *Service[P]) Rearm() {
+	s.notify()
+}
+
+// Len returns the number of pending alarms.
+func (s *Service[P]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alarms.Len()
+}
+
+// notify wakes the loop so it will re-evaluate the next alarm.
+func (s *Service[P]) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service[P]) loop() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		next := s.alarms.Next()
+		s.mu.Unlock()
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wake:
+		case <-next:
+			s.mu.Lock()
+			due := s.alarms.Ready(s.config.Clock.Now())
+			s.mu.Unlock()
+			for _, alarm := range due {
+				if !s.deliver(alarm) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver delivers the alarm, reporting false if the Service was
+// killed while waiting for the alarm to be received.
+func (s *Service[P]) deliver(alarm Alarm[P]) bool {
+	if s.config.OnAlarm != nil {
+		s.config.OnAlarm(alarm)
+		return true
+	}
+	select {
+	case <-s.ctx.Done():
+		return false
+	case s.out <- alarm:
+		return true
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package alarms_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/alarms"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type alarmsSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&alarmsSuite{})
+
+func (s *alarmsSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *alarmsSuite) newService(c *gc.C, onAlarm func(alarms.Alarm[int])) *alarms.Service[int] {
+	service, err := alarms.New(alarms.Config[int]{Clock: s.clock, OnAlarm: onAlarm})
+	c.Assert(err, jc.ErrorIsNil)
+	return service
+}
+
+func (s *alarmsSuite) TestValidate(c *gc.C) {
+	_, err := alarms.New(alarms.Config[int]{})
+	c.Assert(err, gc.ErrorMatches, "validating alarms config: nil Clock not valid")
+}
+
+func (s *alarmsSuite) TestChan(c *gc.C) {
+	service := s.newService(c, nil)
+	defer stop(c, service)
+
+	t0 := s.clock.Now()
+	service.SetAlarm("a", t0.Add(2*time.Second), 1)
+	service.SetAlarm("b", t0.Add(time.Second), 2)
+	c.Assert(service.Len(), gc.Equals, 2)
+
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, service.Chan()), gc.Equals, alarms.Alarm[int]{"b", t0.Add(time.Second), 2})
+	assertNotReceived(c, service.Chan())
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, service.Chan()), gc.Equals, alarms.Alarm[int]{"a", t0.Add(2 * time.Second), 1})
+	c.Assert(service.Len(), gc.Equals, 0)
+}
+
+func (s *alarmsSuite) TestOnAlarm(c *gc.C) {
+	delivered := make(chan alarms.Alarm[int], 10)
+	service := s.newService(c, func(alarm alarms.Alarm[int]) {
+		delivered <- alarm
+	})
+	defer stop(c, service)
+
+	t0 := s.clock.Now()
+	service.SetAlarm("a", t0.Add(time.Second), 1)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, delivered), gc.Equals, alarms.Alarm[int]{"a", t0.Add(time.Second), 1})
+
+	// An alarm whose time has passed is delivered immediately.
+	service.SetAlarm("b", t0, 2)
+	c.Assert(receive(c, delivered), gc.Equals, alarms.Alarm[int]{"b", t0, 2})
+	assertNotReceived(c, service.Chan())
+}
+
+func (s *alarmsSuite) TestSetAlarmReplaces(c *gc.C) {
+	service := s.newService(c, nil)
+	defer stop(c, service)
+
+	t0 := s.clock.Now()
+	service.SetAlarm("a", t0.Add(time.Second), 1)
+	service.SetAlarm("a", t0.Add(2*time.Second), 2)
+	c.Assert(service.Len(), gc.Equals, 1)
+	alarm, ok := service.Alarm("a")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(alarm, gc.Equals, alarms.Alarm[int]{"a", t0.Add(2 * time.Second), 2})
+
+	s.clock.Advance(time.Second)
+	assertNotReceived(c, service.Chan())
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, service.Chan()), gc.Equals, alarm)
+}
+
+func (s *alarmsSuite) TestCancelAlarm(c *gc.C) {
+	service := s.newService(c, nil)
+	defer stop(c, service)
+
+	t0 := s.clock.Now()
+	service.SetAlarm("a", t0.Add(time.Second), 1)
+	service.SetAlarm("b", t0.Add(time.Second), 2)
+	c.Assert(service.CancelAlarm("a"), jc.IsTrue)
+	c.Assert(service.CancelAlarm("a"), jc.IsFalse)
+	c.Assert(service.CancelAlarm("c"), jc.IsFalse)
+	_, ok := service.Alarm("a")
+	c.Assert(ok, jc.IsFalse)
+
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, service.Chan()).Name, gc.Equals, "b")
+	assertNotReceived(c, service.Chan())
+	c.Assert(service.CancelAlarm("b"), jc.IsFalse)
+}
+
+func (s *alarmsSuite) TestRenameAlarm(c *gc.C) {
+	service := s.newService(c, nil)
+	defer stop(c, service)
+
+	t0 := s.clock.Now()
+	service.SetAlarm("a", t0.Add(time.Second), 1)
+	service.SetAlarm("b", t0.Add(2*time.Second), 2)
+
+	err := service.RenameAlarm("a", "b")
+	c.Assert(err, gc.ErrorMatches, `alarm "b" already exists`)
+	c.Assert(errors.IsAlreadyExists(err), jc.IsTrue)
+	err = service.RenameAlarm("c", "d")
+	c.Assert(err, gc.ErrorMatches, `alarm "c" not found`)
+	c.Assert(errors.IsNotFound(err), jc.IsTrue)
+
+	c.Assert(service.RenameAlarm("a", "a"), jc.ErrorIsNil)
+	c.Assert(service.RenameAlarm("a", "c"), jc.ErrorIsNil)
+	c.Assert(service.Len(), gc.Equals, 2)
+	_, ok := service.Alarm("a")
+	c.Assert(ok, jc.IsFalse)
+
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, service.Chan()), gc.Equals, alarms.Alarm[int]{"c", t0.Add(time.Second), 1})
+}
+
+func (s *alarmsSuite) TestKill(c *gc.C) {
+	service := s.newService(c, nil)
+	service.SetAlarm("a", s.clock.Now(), 1)
+	// The alarm is due, but is never received; killing the
+	// service abandons its delivery.
+	stop(c, service)
+	assertNotReceived(c, service.Chan())
+}
+
+// stop kills the service, and waits for it to stop.
+func (s *alarmsSuite) TestRearm(c *gc.C) {
+	clock := &steppedClock{Clock: s.clock}
+	service, err := alarms.New(alarms.Config[int]{Clock: clock})
+	c.Assert(err, jc.ErrorIsNil)
+	defer stop(c, service)
+
+	// The clock is stepped forward past the alarm's time, but
+	// the Service's timer is still waiting for an hour.
+	t0 := clock.Now()
+	service.SetAlarm("a", t0.Add(time.Hour), 1)
+	clock.step(time.Hour)
+	service.Rearm()
+	c.Assert(receive(c, service.Chan()), gc.Equals, alarms.Alarm[int]{"a", t0.Add(time.Hour), 1})
+}
+
+func stop(c *gc.C, service *alarms.Service[int]) {
+	service.Kill()
+	c.Check(service.Wait(), jc.ErrorIsNil)
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotReceived[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected value: %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+// steppedClock is a clock whose time may be stepped,
+// without affecting the durations waited for by After.
+type steppedClock struct {
+	*coretesting.Clock
+
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+func (c *steppedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Clock.Now().Add(c.offset)
+}
+
+func (c *steppedClock) step(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += d
+}
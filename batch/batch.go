@@ -0,0 +1,187 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package batch provides a Batcher, which accumulates items and passes
+// them to a function in batches, bounded in size and in the time that
+// items wait to be passed on.
+package batch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Batcher.
+type Config[T any] struct {
+	// Clock is used to measure the interval.
+	Clock clock.Clock
+
+	// MaxSize is the maximum number of items in a batch. A batch is
+	// flushed as soon as it reaches this size.
+	MaxSize int
+
+	// Interval is the maximum time for which an item waits in a batch:
+	// a batch is flushed once Interval has elapsed since its first
+	// item was added.
+	Interval time.Duration
+
+	// Flush is the function to which batches are passed. The batch
+	// is owned by the function once passed to it.
+	Flush func(batch []T)
+}
+
+// Validate checks that the config is valid.
+func (config Config[T]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.MaxSize <= 0 {
+		return errors.NotValidf("non-positive MaxSize")
+	}
+	if config.Interval <= 0 {
+		return errors.NotValidf("non-positive Interval")
+	}
+	if config.Flush == nil {
+		return errors.NotValidf("nil Flush")
+	}
+	return nil
+}
+
+// Batcher accumulates items, and passes them to a function in batches,
+// when either a batch reaches the maximum size, or the interval has
+// elapsed since the first item of the batch was added. Batches are
+// passed to the function in the order in which their items were added.
+//
+// The function is called in the Batcher's own goroutine, and never
+// concurrently with itself; a slow function delays subsequent batches,
+// but does not block Add. Batcher's methods are safe for concurrent use.
+type Batcher[T any] struct {
+	config Config[T]
+
+	mu sync.Mutex
+	// full holds the batches that have reached the maximum size, and
+	// are waiting to be flushed. items holds the current batch, whose
+	// first item was added at first.
+	full    [][]T
+	items   []T
+	first   time.Time
+	stopped bool
+
+	wake  chan struct{}
+	flush chan chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewBatcher returns a new Batcher with the given configuration.
+// The Batcher runs until it is stopped.
+func NewBatcher[T any](config Config[T]) (*Batcher[T], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating batcher config")
+	}
+	b := &Batcher[T]{
+		config: config,
+		wake:   make(chan struct{}, 1),
+		flush:  make(chan chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go b.loop()
+	return b, nil
+}
+
+// Add adds an item to the current batch. Add does not block. Once the
+// Batcher has been stopped, items are discarded.
+func (b *Batcher[T]) Add(item T) {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return
+	}
+	if len(b.items) == 0 {
+		b.first = b.config.Clock.Now()
+	}
+	b.items = append(b.items, item)
+	if len(b.items) >= b.config.MaxSize {
+		b.full = append(b.full, b.items)
+		b.items = nil
+	}
+	b.mu.Unlock()
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Flush flushes all items added so far, without waiting for the
+// interval to elapse, and waits for the function to return. If the
+// Batcher has been stopped, Flush does nothing.
+func (b *Batcher[T]) Flush() {
+	reply := make(chan struct{})
+	select {
+	case b.flush <- reply:
+		<-reply
+	case <-b.done:
+	}
+}
+
+// Stop stops the Batcher, flushing all items added so far, and waits
+// for the function to return. Items added once the Batcher has been
+// stopped are discarded.
+func (b *Batcher[T]) Stop() {
+	b.mu.Lock()
+	if !b.stopped {
+		b.stopped = true
+		close(b.stop)
+	}
+	b.mu.Unlock()
+	<-b.done
+}
+
+func (b *Batcher[T]) loop() {
+	defer close(b.done)
+	for {
+		var interval <-chan time.Time
+		b.mu.Lock()
+		if len(b.items) > 0 {
+			interval = clock.Alarm(b.config.Clock, b.first.Add(b.config.Interval))
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-b.stop:
+			b.call(true)
+			return
+		case <-b.wake:
+			b.call(false)
+		case reply := <-b.flush:
+			b.call(true)
+			close(reply)
+		case <-interval:
+			b.call(false)
+		}
+	}
+}
+
+// call passes the full batches to the function, followed by the current
+// batch if force is true or the interval has elapsed since its first
+// item was added.
+func (b *Batcher[T]) call(force bool) {
+	b.mu.Lock()
+	batches := b.full
+	b.full = nil
+	if len(b.items) > 0 {
+		due := b.first.Add(b.config.Interval)
+		if force || !b.config.Clock.Now().Before(due) {
+			batches = append(batches, b.items)
+			b.items = nil
+		}
+	}
+	b.mu.Unlock()
+	for _, batch := range batches {
+		b.config.Flush(batch)
+	}
+}
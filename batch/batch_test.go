@@ -0,0 +1,154 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package batch_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/batch"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type batchSuite struct {
+	coretesting.BaseSuite
+	clock   *coretesting.Clock
+	flushed chan []int
+}
+
+var _ = gc.Suite(&batchSuite{})
+
+func (s *batchSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.flushed = make(chan []int, 10)
+}
+
+func (s *batchSuite) newBatcher(c *gc.C) *batch.Batcher[int] {
+	b, err := batch.NewBatcher(batch.Config[int]{
+		Clock:    s.clock,
+		MaxSize:  3,
+		Interval: time.Second,
+		Flush: func(batch []int) {
+			s.flushed <- batch
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return b
+}
+
+func (s *batchSuite) TestValidate(c *gc.C) {
+	_, err := batch.NewBatcher(batch.Config[int]{
+		Clock:    s.clock,
+		Interval: time.Second,
+		Flush:    func([]int) {},
+	})
+	c.Assert(err, gc.ErrorMatches, "validating batcher config: non-positive MaxSize not valid")
+}
+
+func (s *batchSuite) TestFlushBySize(c *gc.C) {
+	b := s.newBatcher(c)
+	defer b.Stop()
+
+	for i := 0; i < 7; i++ {
+		b.Add(i)
+	}
+	c.Assert(receive(c, s.flushed), jc.DeepEquals, []int{0, 1, 2})
+	c.Assert(receive(c, s.flushed), jc.DeepEquals, []int{3, 4, 5})
+	assertNotFlushed(c, s.flushed)
+}
+
+func (s *batchSuite) TestFlushByInterval(c *gc.C) {
+	b := s.newBatcher(c)
+	defer b.Stop()
+
+	b.Add(0)
+	s.clock.Advance(500 * time.Millisecond)
+	b.Add(1)
+	assertNotFlushed(c, s.flushed)
+
+	// The interval runs from the first item in the batch.
+	s.clock.Advance(500 * time.Millisecond)
+	c.Assert(receive(c, s.flushed), jc.DeepEquals, []int{0, 1})
+
+	// The next batch's interval starts with its first item.
+	s.clock.Advance(time.Minute)
+	b.Add(2)
+	s.clock.Advance(999 * time.Millisecond)
+	assertNotFlushed(c, s.flushed)
+	s.clock.Advance(time.Millisecond)
+	c.Assert(receive(c, s.flushed), jc.DeepEquals, []int{2})
+}
+
+func (s *batchSuite) TestSizeFlushRearmsInterval(c *gc.C) {
+	b := s.newBatcher(c)
+	defer b.Stop()
+
+	b.Add(0)
+	b.Add(1)
+	s.clock.Advance(500 * time.Millisecond)
+	b.Add(2)
+	b.Add(3)
+	c.Assert(receive(c, s.flushed), jc.DeepEquals, []int{0, 1, 2})
+
+	// Item 3 started a new batch, so the first batch's
+	// interval elapsing does not flush it.
+	s.clock.Advance(500 * time.Millisecond)
+	assertNotFlushed(c, s.flushed)
+	s.clock.Advance(500 * time.Millisecond)
+	c.Assert(receive(c, s.flushed), jc.DeepEquals, []int{3})
+}
+
+func (s *batchSuite) TestFlush(c *gc.C) {
+	b := s.newBatcher(c)
+	defer b.Stop()
+
+	// Flushing an empty batcher does nothing.
+	b.Flush()
+	c.Assert(s.flushed, gc.HasLen, 0)
+
+	for i := 0; i < 4; i++ {
+		b.Add(i)
+	}
+	b.Flush()
+	c.Assert(s.flushed, gc.HasLen, 2)
+	c.Assert(<-s.flushed, jc.DeepEquals, []int{0, 1, 2})
+	c.Assert(<-s.flushed, jc.DeepEquals, []int{3})
+	s.clock.Advance(time.Minute)
+	assertNotFlushed(c, s.flushed)
+}
+
+func (s *batchSuite) TestStopFlushes(c *gc.C) {
+	b := s.newBatcher(c)
+	b.Add(0)
+	b.Add(1)
+	b.Stop()
+	c.Assert(s.flushed, gc.HasLen, 1)
+	c.Assert(<-s.flushed, jc.DeepEquals, []int{0, 1})
+
+	b.Stop()
+	b.Add(2)
+	b.Flush()
+	s.clock.Advance(time.Minute)
+	assertNotFlushed(c, s.flushed)
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotFlushed[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected flush of %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package breaker provides a circuit breaker, which stops calls to a
+// failing dependency for a while, measuring time with a clock.Clock.
+package breaker
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// ErrOpen is returned by Breaker.Allow and Breaker.Do when calls are
+// not permitted, because the breaker is open, or because it is half-open
+// and the permitted trial calls are already in progress.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a Breaker.
+type State int
+
+const (
+	// Closed is the state in which calls are permitted.
+	Closed State = iota
+
+	// Open is the state in which calls are not permitted.
+	Open
+
+	// HalfOpen is the state in which a limited number of trial
+	// calls are permitted, to determine whether the breaker
+	// should close again.
+	HalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Config holds the configuration for a Breaker.
+type Config struct {
+	// Clock is used to measure the failure window and open timeout.
+	Clock clock.Clock
+
+	// FailureThreshold is the number of failures within Window
+	// that trips the breaker, opening it.
+	FailureThreshold int
+
+	// Window is the rolling window of time over which failures
+	// are counted while the breaker is closed.
+	Window time.Duration
+
+	// OpenTimeout is how long the breaker stays open before
+	// becoming half-open.
+	OpenTimeout time.Duration
+
+	// HalfOpenCalls is the number of trial calls permitted while the
+	// breaker is half-open; if they all succeed, the breaker closes.
+	// If HalfOpenCalls is zero, one trial call is permitted.
+	HalfOpenCalls int
+
+	// OnStateChange, if non-nil, is called when the breaker changes
+	// state. It is called without any locks held, and so may call the
+	// Breaker's methods; changes caused by concurrent calls may be
+	// notified concurrently.
+	OnStateChange func(from, to State)
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.FailureThreshold <= 0 {
+		return errors.NotValidf("non-positive FailureThreshold")
+	}
+	if config.Window <= 0 {
+		return errors.NotValidf("non-positive Window")
+	}
+	if config.OpenTimeout <= 0 {
+		return errors.NotValidf("non-positive OpenTimeout")
+	}
+	if config.HalfOpenCalls < 0 {
+		return errors.NotValidf("negative HalfOpenCalls")
+	}
+	return nil
+}
+
+// Breaker is a circuit breaker. While closed, it permits calls, and
+// counts their failures over a rolling window; when the failures reach
+// a threshold, it opens. While open, it rejects calls with ErrOpen. When
+// the open timeout has elapsed, the breaker becomes half-open, and
+// permits a limited number of trial calls: if they succeed it closes,
+// and if any fails it opens again.
+//
+// The transition from open to half-open happens when the breaker is
+// next used or inspected after the timeout has elapsed.
+//
+// Breaker's methods are safe for concurrent use.
+type Breaker struct {
+	config Config
+
+	mu    sync.Mutex
+	state State
+	// generation is incremented on each state change, so that the
+	// results of calls permitted in an earlier state are ignored.
+	generation uint64
+	// failures holds the times of failures within the window,
+	// while closed.
+	failures []time.Time
+	openedAt time.Time
+	// trials and successes count the trial calls started,
+	// and succeeded, while half-open.
+	trials    int
+	successes int
+}
+
+// change records a state change, for notifying OnStateChange.
+type change struct {
+	from, to State
+}
+
+// New returns a new, closed Breaker with the given configuration.
+func New(config Config) (*Breaker, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating circuit breaker config")
+	}
+	return &Breaker{config: config}, nil
+}
+
+// Do calls f if the breaker permits it, recording its success or
+// failure, and returns its error; otherwise it returns ErrOpen.
+func (b *Breaker) Do(f func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = f()
+	done(err == nil)
+	return err
+}
+
+// Allow returns ErrOpen if the breaker does not permit a call. Otherwise
+// it returns a function that must be called with the result of the call.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	changes := b.update(b.config.Clock.Now())
+	switch b.state {
+	case Open:
+		err = ErrOpen
+	case HalfOpen:
+		if b.trials >= b.halfOpenCalls() {
+			err = ErrOpen
+		} else {
+			b.trials++
+		}
+	}
+	generation := b.generation
+	b.mu.Unlock()
+	b.notify(changes)
+	if err != nil {
+		return nil, err
+	}
+	return func(success bool) { b.done(generation, success) }, nil
+}
+
+// State returns the breaker's current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	changes := b.update(b.config.Clock.Now())
+	state := b.state
+	b.mu.Unlock()
+	b.notify(changes)
+	return state
+}
+
+// RetryAfter returns how long remains until the open breaker becomes
+// half-open, or zero if it is not open. This may be used, for example,
+// to schedule an operation for when the breaker will permit it.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	now := b.config.Clock.Now()
+	changes := b.update(now)
+	var d time.Duration
+	if b.state == Open {
+		d = b.openedAt.Add(b.config.OpenTimeout).Sub(now)
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+	return d
+}
+
+// Reset closes the breaker, discarding any recorded failures.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	changes := b.setState(Closed, b.config.Clock.Now())
+	b.failures = nil
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+// done records the result of a call permitted in the given generation.
+func (b *Breaker) done(generation uint64, success bool) {
+	b.mu.Lock()
+	now := b.config.Clock.Now()
+	changes := b.update(now)
+	if generation == b.generation {
+		switch {
+		case b.state == Closed && !success:
+			b.pruneFailures(now)
+			b.failures = append(b.failures, now)
+			if len(b.failures) >= b.config.FailureThreshold {
+				changes = append(changes, b.setState(Open, now)...)
+			}
+		case b.state == HalfOpen && !success:
+			changes = append(changes, b.setState(Open, now)...)
+		case b.state == HalfOpen:
+			b.successes++
+			if b.successes >= b.halfOpenCalls() {
+				changes = append(changes, b.setState(Closed, now)...)
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+// update makes the transition from open to half-open if the open
+// timeout has elapsed. update must be called with b.mu held.
+func (b *Breaker) update(now time.Time) []change {
+	if b.state == Open && !now.Before(b.openedAt.Add(b.config.OpenTimeout)) {
+		return b.setState(HalfOpen, now)
+	}
+	return nil
+}
+
+// setState changes the breaker's state, returning the change to
+// notify, if any. setState must be called with b.mu held.
+func (b *Breaker) setState(state State, now time.Time) []change {
+	if state == b.state {
+		return nil
+	}
+	from := b.state
+	b.state = state
+	b.generation++
+	b.failures = nil
+	b.trials = 0
+	b.successes = 0
+	if state == Open {
+		b.openedAt = now
+	}
+	return []change{{from, state}}
+}
+
+// pruneFailures discards failures that have left the window.
+func (b *Breaker) pruneFailures(now time.Time) {
+	cutoff := now.Add(-b.config.Window)
+	n := 0
+	for n < len(b.failures) && !b.failures[n].After(cutoff) {
+		n++
+	}
+	b.failures = b.failures[n:]
+}
+
+func (b *Breaker) halfOpenCalls() int {
+	if b.config.HalfOpenCalls == 0 {
+		return 1
+	}
+	return b.config.HalfOpenCalls
+}
+
+// notify calls OnStateChange with each change.
+func (b *Breaker) notify(changes []change) {
+	if b.config.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.config.OnStateChange(c.from, c.to)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package breaker_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/breaker"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type breakerSuite struct {
+	coretesting.BaseSuite
+	clock   *coretesting.Clock
+	changes []string
+}
+
+var _ = gc.Suite(&breakerSuite{})
+
+func (s *breakerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.changes = nil
+}
+
+func (s *breakerSuite) newBreaker(c *gc.C, halfOpenCalls int) *breaker.Breaker {
+	b, err := breaker.New(breaker.Config{
+		Clock:            s.clock,
+		FailureThreshold: 3,
+		Window:           time.Minute,
+		OpenTimeout:      10 * time.Second,
+		HalfOpenCalls:    halfOpenCalls,
+		OnStateChange: func(from, to breaker.State) {
+			s.changes = append(s.changes, from.String()+"->"+to.String())
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return b
+}
+
+var errFailed = errors.New("failed")
+
+func fail() error    { return errFailed }
+func succeed() error { return nil }
+
+func (s *breakerSuite) TestValidate(c *gc.C) {
+	valid := breaker.Config{
+		Clock:            s.clock,
+		FailureThreshold: 1,
+		Window:           time.Second,
+		OpenTimeout:      time.Second,
+	}
+	for _, test := range []struct {
+		mutate func(*breaker.Config)
+		err    string
+	}{
+		{func(config *breaker.Config) { config.Clock = nil }, "nil Clock"},
+		{func(config *breaker.Config) { config.FailureThreshold = 0 }, "non-positive FailureThreshold"},
+		{func(config *breaker.Config) { config.Window = 0 }, "non-positive Window"},
+		{func(config *breaker.Config) { config.OpenTimeout = 0 }, "non-positive OpenTimeout"},
+		{func(config *breaker.Config) { config.HalfOpenCalls = -1 }, "negative HalfOpenCalls"},
+	} {
+		config := valid
+		test.mutate(&config)
+		_, err := breaker.New(config)
+		c.Check(err, gc.ErrorMatches, "validating circuit breaker config: "+test.err+" not valid")
+	}
+}
+
+func (s *breakerSuite) TestTrip(c *gc.C) {
+	b := s.newBreaker(c, 0)
+	c.Assert(b.Do(fail), gc.Equals, errFailed)
+	c.Assert(b.Do(succeed), jc.ErrorIsNil)
+	c.Assert(b.Do(fail), gc.Equals, errFailed)
+	c.Assert(b.State(), gc.Equals, breaker.Closed)
+	c.Assert(b.Do(fail), gc.Equals, errFailed)
+	c.Assert(b.State(), gc.Equals, breaker.Open)
+	c.Assert(b.Do(succeed), gc.Equals, breaker.ErrOpen)
+	c.Assert(s.changes, jc.DeepEquals, []string{"closed->open"})
+}
+
+func (s *breakerSuite) TestRollingWindow(c *gc.C) {
+	b := s.newBreaker(c, 0)
+	b.Do(fail)
+	s.clock.Advance(30 * time.Second)
+	b.Do(fail)
+	s.clock.Advance(30 * time.Second)
+	// The first failure has left the window.
+	b.Do(fail)
+	c.Assert(b.State(), gc.Equals, breaker.Closed)
+	s.clock.Advance(time.Second)
+	b.Do(fail)
+	c.Assert(b.State(), gc.Equals, breaker.Open)
+}
+
+func (s *breakerSuite) trip(c *gc.C, b *breaker.Breaker) {
+	for i := 0; i < 3; i++ {
+		b.Do(fail)
+	}
+	c.Assert(b.State(), gc.Equals, breaker.Open)
+}
+
+func (s *breakerSuite) TestHalfOpen(c *gc.C) {
+	b := s.newBreaker(c, 0)
+	s.trip(c, b)
+	c.Assert(b.RetryAfter(), gc.Equals, 10*time.Second)
+	s.clock.Advance(9 * time.Second)
+	c.Assert(b.RetryAfter(), gc.Equals, time.Second)
+	c.Assert(b.Do(succeed), gc.Equals, breaker.ErrOpen)
+
+	s.clock.Advance(time.Second)
+	c.Assert(b.State(), gc.Equals, breaker.HalfOpen)
+	c.Assert(b.RetryAfter(), gc.Equals, time.Duration(0))
+	done, err := b.Allow()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = b.Allow()
+	c.Assert(err, gc.Equals, breaker.ErrOpen)
+	done(true)
+	c.Assert(b.State(), gc.Equals, breaker.Closed)
+	c.Assert(s.changes, jc.DeepEquals, []string{"closed->open", "open->half-open", "half-open->closed"})
+
+	// Failures before opening are forgotten.
+	b.Do(fail)
+	b.Do(fail)
+	c.Assert(b.State(), gc.Equals, breaker.Closed)
+}
+
+func (s *breakerSuite) TestHalfOpenFailure(c *gc.C) {
+	b := s.newBreaker(c, 2)
+	s.trip(c, b)
+	s.clock.Advance(10 * time.Second)
+	c.Assert(b.Do(succeed), jc.ErrorIsNil)
+	c.Assert(b.State(), gc.Equals, breaker.HalfOpen)
+	c.Assert(b.Do(fail), gc.Equals, errFailed)
+	c.Assert(b.State(), gc.Equals, breaker.Open)
+	c.Assert(b.RetryAfter(), gc.Equals, 10*time.Second)
+}
+
+func (s *breakerSuite) TestStaleResultIgnored(c *gc.C) {
+	b := s.newBreaker(c, 0)
+	done, err := b.Allow()
+	c.Assert(err, jc.ErrorIsNil)
+	s.trip(c, b)
+	s.clock.Advance(10 * time.Second)
+	c.Assert(b.State(), gc.Equals, breaker.HalfOpen)
+	// The call was permitted while closed, so its
+	// success does not close the half-open breaker.
+	done(true)
+	c.Assert(b.State(), gc.Equals, breaker.HalfOpen)
+}
+
+func (s *breakerSuite) TestReset(c *gc.C) {
+	b := s.newBreaker(c, 0)
+	s.trip(c, b)
+	b.Reset()
+	c.Assert(b.State(), gc.Equals, breaker.Closed)
+	c.Assert(b.Do(succeed), jc.ErrorIsNil)
+	c.Assert(s.changes, jc.DeepEquals, []string{"closed->open", "open->closed"})
+}
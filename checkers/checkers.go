@@ -0,0 +1,190 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package checkers provides gocheck checkers for assertions about times,
+// durations and schedules. Each checker may also be used outside of
+// gocheck, such as with testify, by way of Check.
+package checkers
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/juju/errors"
+	gc "gopkg.in/check.v1"
+)
+
+// TimeWithin returns a checker that checks that the obtained time is
+// within d of the expected time, either side of it.
+//
+//	c.Assert(t, checkers.TimeWithin(time.Second), expected)
+func TimeWithin(d time.Duration) gc.Checker {
+	return &timeWithinChecker{
+		CheckerInfo: &gc.CheckerInfo{
+			Name:   fmt.Sprintf("TimeWithin(%v)", d),
+			Params: []string{"obtained", "expected"},
+		},
+		d: d,
+	}
+}
+
+type timeWithinChecker struct {
+	*gc.CheckerInfo
+	d time.Duration
+}
+
+// Check is part of the gc.Checker interface.
+func (checker *timeWithinChecker) Check(params []interface{}, names []string) (bool, string) {
+	obtained, ok := params[0].(time.Time)
+	if !ok {
+		return false, "obtained value is not a time.Time"
+	}
+	expected, ok := params[1].(time.Time)
+	if !ok {
+		return false, "expected value is not a time.Time"
+	}
+	diff := obtained.Sub(expected)
+	if diff < -checker.d || diff > checker.d {
+		return false, fmt.Sprintf("obtained time is %v from expected time", diff)
+	}
+	return true, ""
+}
+
+// DurationBetween returns a checker that checks that the obtained
+// duration is at least min, and at most max.
+//
+//	c.Assert(d, checkers.DurationBetween(time.Second, 2*time.Second))
+func DurationBetween(min, max time.Duration) gc.Checker {
+	return &durationBetweenChecker{
+		CheckerInfo: &gc.CheckerInfo{
+			Name:   fmt.Sprintf("DurationBetween(%v, %v)", min, max),
+			Params: []string{"obtained"},
+		},
+		min: min,
+		max: max,
+	}
+}
+
+type durationBetweenChecker struct {
+	*gc.CheckerInfo
+	min, max time.Duration
+}
+
+// Check is part of the gc.Checker interface.
+func (checker *durationBetweenChecker) Check(params []interface{}, names []string) (bool, string) {
+	obtained, ok := params[0].(time.Duration)
+	if !ok {
+		return false, "obtained value is not a time.Duration"
+	}
+	return obtained >= checker.min && obtained <= checker.max, ""
+}
+
+// ScheduleContainsKey checks that the obtained value contains an item
+// with the expected key. The obtained value must have a method
+//
+//	Get(key K) (V, time.Time, bool)
+//
+// such as schedule.Schedule, schedule.ShardedSchedule and
+// timequeue.Queue have, and the key must be assignable to K.
+//
+//	c.Assert(s, checkers.ScheduleContainsKey, "k0")
+var ScheduleContainsKey gc.Checker = &scheduleContainsKeyChecker{
+	&gc.CheckerInfo{Name: "ScheduleContainsKey", Params: []string{"obtained", "key"}},
+}
+
+type scheduleContainsKeyChecker struct {
+	*gc.CheckerInfo
+}
+
+// Check is part of the gc.Checker interface.
+func (checker *scheduleContainsKeyChecker) Check(params []interface{}, names []string) (bool, string) {
+	get := reflect.ValueOf(params[0]).MethodByName("Get")
+	if !get.IsValid() {
+		return false, "obtained value has no Get method"
+	}
+	t := get.Type()
+	if t.NumIn() != 1 || t.NumOut() != 3 ||
+		t.Out(1) != reflect.TypeOf(time.Time{}) ||
+		t.Out(2).Kind() != reflect.Bool {
+		return false, "obtained value's Get method has the wrong signature"
+	}
+	key := reflect.ValueOf(params[1])
+	if !key.IsValid() || !key.Type().AssignableTo(t.In(0)) {
+		return false, fmt.Sprintf("key is not assignable to %v", t.In(0))
+	}
+	return get.Call([]reflect.Value{key})[2].Bool(), ""
+}
+
+// NextTimer is the interface, implemented by schedule.Schedule,
+// schedule.ShardedSchedule and timequeue.Queue, against which
+// NextFiresWithin checks.
+type NextTimer interface {
+	// NextTime returns the time of the next item,
+	// and whether or not there are any items.
+	NextTime() (time.Time, bool)
+}
+
+// NextFiresWithin returns a checker that checks that the obtained
+// NextTimer's next item is due no later than d after the specified
+// time, usually its clock's current time.
+//
+//	c.Assert(s, checkers.NextFiresWithin(time.Second), clock.Now())
+func NextFiresWithin(d time.Duration) gc.Checker {
+	return &nextFiresWithinChecker{
+		CheckerInfo: &gc.CheckerInfo{
+			Name:   fmt.Sprintf("NextFiresWithin(%v)", d),
+			Params: []string{"obtained", "now"},
+		},
+		d: d,
+	}
+}
+
+type nextFiresWithinChecker struct {
+	*gc.CheckerInfo
+	d time.Duration
+}
+
+// Check is part of the gc.Checker interface.
+func (checker *nextFiresWithinChecker) Check(params []interface{}, names []string) (bool, string) {
+	obtained, ok := params[0].(NextTimer)
+	if !ok {
+		return false, "obtained value does not implement NextTimer"
+	}
+	now, ok := params[1].(time.Time)
+	if !ok {
+		return false, "now is not a time.Time"
+	}
+	next, ok := obtained.NextTime()
+	if !ok {
+		return false, "obtained value is empty"
+	}
+	if next.After(now.Add(checker.d)) {
+		return false, fmt.Sprintf("next item is due in %v", next.Sub(now))
+	}
+	return true, ""
+}
+
+// Check runs the checker against the obtained value and parameters,
+// outside of gocheck, returning an error describing the failure if the
+// check fails. Check may be used with other test frameworks:
+//
+//	require.NoError(t, checkers.Check(checkers.TimeWithin(time.Second), t0, t1))
+func Check(checker gc.Checker, obtained interface{}, args ...interface{}) error {
+	info := checker.Info()
+	params := append([]interface{}{obtained}, args...)
+	if len(params) != len(info.Params) {
+		return errors.Errorf(
+			"%s checker takes %d parameters, got %d",
+			info.Name, len(info.Params), len(params),
+		)
+	}
+	names := append([]string(nil), info.Params...)
+	if ok, message := checker.Check(params, names); !ok {
+		if message == "" {
+			return errors.Errorf("%s check failed: obtained %v", info.Name, obtained)
+		}
+		return errors.Errorf("%s check failed: %s", info.Name, message)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package checkers_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/checkers"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/timequeue"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type checkersSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&checkersSuite{})
+
+type operation struct {
+	key   string
+	delay time.Duration
+}
+
+func (op operation) Key() string {
+	return op.key
+}
+
+func (op operation) Delay() time.Duration {
+	return op.delay
+}
+
+func (*checkersSuite) TestTimeWithin(c *gc.C) {
+	t0 := time.Unix(1000, 0)
+	c.Assert(t0.Add(time.Second), checkers.TimeWithin(time.Second), t0)
+	c.Assert(t0.Add(-time.Second), checkers.TimeWithin(time.Second), t0)
+	c.Assert(t0.Add(2*time.Second), gc.Not(checkers.TimeWithin(time.Second)), t0)
+
+	err := checkers.Check(checkers.TimeWithin(time.Second), t0.Add(-2*time.Second), t0)
+	c.Assert(err, gc.ErrorMatches, `TimeWithin\(1s\) check failed: obtained time is -2s from expected time`)
+	err = checkers.Check(checkers.TimeWithin(time.Second), "now", t0)
+	c.Assert(err, gc.ErrorMatches, `TimeWithin\(1s\) check failed: obtained value is not a time.Time`)
+}
+
+func (*checkersSuite) TestDurationBetween(c *gc.C) {
+	checker := checkers.DurationBetween(time.Second, 2*time.Second)
+	c.Assert(time.Second, checker)
+	c.Assert(1500*time.Millisecond, checker)
+	c.Assert(2*time.Second, checker)
+	c.Assert(999*time.Millisecond, gc.Not(checker))
+
+	err := checkers.Check(checker, 3*time.Second)
+	c.Assert(err, gc.ErrorMatches, `DurationBetween\(1s, 2s\) check failed: obtained 3s`)
+}
+
+func (*checkersSuite) TestScheduleContainsKey(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
+	s.Add(operation{"k0", time.Second})
+	c.Assert(s, checkers.ScheduleContainsKey, "k0")
+	c.Assert(s, gc.Not(checkers.ScheduleContainsKey), "k1")
+
+	sharded, err := schedule.NewSharded(schedule.ShardedConfig[string, operation]{
+		Config: schedule.Config[string, operation]{Clock: clock},
+		Shards: 4,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	sharded.Add(operation{"k0", time.Second})
+	c.Assert(sharded, checkers.ScheduleContainsKey, "k0")
+	c.Assert(sharded, gc.Not(checkers.ScheduleContainsKey), "k1")
+
+	q := timequeue.New[int, string](clock)
+	q.Add(1, "v1", clock.Now())
+	c.Assert(q, checkers.ScheduleContainsKey, 1)
+
+	err = checkers.Check(checkers.ScheduleContainsKey, q, "1")
+	c.Assert(err, gc.ErrorMatches, "ScheduleContainsKey check failed: key is not assignable to int")
+	err = checkers.Check(checkers.ScheduleContainsKey, clock, 1)
+	c.Assert(err, gc.ErrorMatches, "ScheduleContainsKey check failed: obtained value has no Get method")
+	err = checkers.Check(checkers.ScheduleContainsKey, q)
+	c.Assert(err, gc.ErrorMatches, "ScheduleContainsKey checker takes 2 parameters, got 1")
+}
+
+func (*checkersSuite) TestNextFiresWithin(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
+	err := checkers.Check(checkers.NextFiresWithin(time.Second), s, clock.Now())
+	c.Assert(err, gc.ErrorMatches, `NextFiresWithin\(1s\) check failed: obtained value is empty`)
+
+	s.Add(operation{"k0", 2 * time.Second})
+	c.Assert(s, checkers.NextFiresWithin(2*time.Second), clock.Now())
+	c.Assert(s, gc.Not(checkers.NextFiresWithin(time.Second)), clock.Now())
+	clock.Advance(time.Second)
+	c.Assert(s, checkers.NextFiresWithin(time.Second), clock.Now())
+
+	err = checkers.Check(checkers.NextFiresWithin(0), s, clock.Now())
+	c.Assert(err, gc.ErrorMatches, `NextFiresWithin\(0s\) check failed: next item is due in 1s`)
+}
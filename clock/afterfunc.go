@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// AfterFuncClock is a Clock that can call functions after a duration.
+type AfterFuncClock interface {
+	Clock
+
+	// AfterFunc waits for the duration to elapse, and then calls f
+	// in its own goroutine. The returned Timer's Chan method returns
+	// nil. Stopping the Timer returns true if the call to f was
+	// cancelled, and false if f has already been called, or its call
+	// is under way; Stop does not wait for f to return.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// AfterFunc waits for the duration to elapse, as measured by c, and then
+// calls f in its own goroutine, as AfterFuncClock.AfterFunc does. If c
+// does not implement AfterFuncClock, then f is called from a goroutine
+// that waits on a Timer created with NewTimer.
+func AfterFunc(c Clock, d time.Duration, f func()) Timer {
+	if ac, ok := c.(AfterFuncClock); ok {
+		return ac.AfterFunc(d, f)
+	}
+	t := &funcTimer{clock: c, f: f}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc is part of the AfterFuncClock interface.
+func (wallClock) AfterFunc(d time.Duration, f func()) Timer {
+	return wallTimer{time.AfterFunc(d, f)}
+}
+
+// funcTimer implements AfterFunc with a goroutine waiting on a Timer.
+type funcTimer struct {
+	clock Clock
+	f     func()
+
+	mu sync.Mutex
+	// stop is closed to cancel the pending call to f. It is
+	// nil if no call is pending.
+	stop chan struct{}
+}
+
+// Chan is part of the Timer interface.
+func (t *funcTimer) Chan() <-chan time.Time {
+	return nil
+}
+
+// Reset is part of the Timer interface.
+func (t *funcTimer) Reset(d time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := t.stopLocked()
+	stop := make(chan struct{})
+	t.stop = stop
+	timer := NewTimer(t.clock, d)
+	go func() {
+		select {
+		case <-timer.Chan():
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		t.mu.Lock()
+		if t.stop != stop {
+			// Stopped or reset after the timer sent,
+			// but before the call to f was committed.
+			t.mu.Unlock()
+			return
+		}
+		t.stop = nil
+		t.mu.Unlock()
+		t.f()
+	}()
+	return active
+}
+
+// Stop is part of the Timer interface.
+func (t *funcTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stopLocked()
+}
+
+func (t *funcTimer) stopLocked() bool {
+	if t.stop == nil {
+		return false
+	}
+	close(t.stop)
+	t.stop = nil
+	return true
+}
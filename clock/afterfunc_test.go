@@ -0,0 +1,77 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type afterFuncSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&afterFuncSuite{})
+
+func (s *afterFuncSuite) TestWallClock(c *gc.C) {
+	called := make(chan struct{})
+	t := clock.AfterFunc(clock.WallClock, time.Millisecond, func() {
+		close(called)
+	})
+	c.Assert(t.Chan(), gc.IsNil)
+	select {
+	case <-called:
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("function not called")
+	}
+	c.Assert(t.Stop(), jc.IsFalse)
+
+	t = clock.AfterFunc(clock.WallClock, time.Hour, func() {
+		c.Errorf("stopped function called")
+	})
+	c.Assert(t.Stop(), jc.IsTrue)
+	c.Assert(t.Stop(), jc.IsFalse)
+}
+
+func (s *afterFuncSuite) TestFallback(c *gc.C) {
+	clk := clocktesting.NewClock(time.Time{})
+	h := clocktesting.NewHarness(clk)
+	called := make(chan struct{}, 2)
+	t := clock.AfterFunc(afterOnlyClock{clk}, time.Second, func() {
+		called <- struct{}{}
+	})
+	c.Assert(t.Chan(), gc.IsNil)
+	h.Settle(c)
+	clocktesting.ExpectTimer(c, clk, time.Second)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(called, gc.HasLen, 1)
+	c.Assert(t.Stop(), jc.IsFalse)
+
+	// Resetting the timer calls the function again.
+	c.Assert(t.Reset(time.Second), jc.IsFalse)
+	h.Settle(c)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(called, gc.HasLen, 2)
+
+	// Stopping a pending timer cancels the call.
+	t.Reset(time.Second)
+	h.Settle(c)
+	c.Assert(t.Stop(), jc.IsTrue)
+	h.Settle(c)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(called, gc.HasLen, 2)
+	h.AssertNoLeaks(c)
+}
+
+func (s *afterFuncSuite) TestAfterFuncClock(c *gc.C) {
+	clk := clocktesting.NewClock(time.Time{})
+	t := clock.AfterFunc(clk, time.Second, func() {})
+	c.Assert(t, gc.FitsTypeOf, &clocktesting.FuncTimer{})
+	c.Assert(t.Stop(), jc.IsTrue)
+}
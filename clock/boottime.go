@@ -0,0 +1,190 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// DefaultBootClockMaxWait is the MaxWait used by a BootClock
+// if none is specified.
+const DefaultBootClockMaxWait = time.Second
+
+// BootClockConfig holds the configuration for a BootClock.
+type BootClockConfig struct {
+	// MaxWait is the maximum time for which the clock's timers wait,
+	// as measured by the runtime's timers, before checking the boot
+	// time again. A timer whose time passes while the system is
+	// suspended sends at most MaxWait after the system resumes. If
+	// MaxWait is zero, DefaultBootClockMaxWait is used.
+	MaxWait time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config BootClockConfig) Validate() error {
+	if config.MaxWait < 0 {
+		return errors.NotValidf("negative MaxWait")
+	}
+	return nil
+}
+
+// BootClock is a Clock that measures time elapsed with the system's boot
+// time, which, unlike the monotonic time used by the runtime's timers,
+// continues to advance while the system is suspended. Durations and
+// timers measured by a BootClock therefore include the time spent
+// suspended: a timer for an hour sends an hour after it was started,
+// even if the system slept for half of it, rather than half an hour
+// after the system resumes.
+//
+// On Linux, the boot time is read from CLOCK_BOOTTIME. Elsewhere, or if
+// CLOCK_BOOTTIME is unavailable, the wall clock time is used instead;
+// it also advances while the system is suspended, but may be stepped,
+// such as by NTP, so elapsed times may jump or go backwards. See
+// BootTimeSupported.
+//
+// Now returns the time at which the clock was created, plus the boot
+// time elapsed since; the times returned carry no monotonic reading, so
+// they should only be compared with others from the same clock.
+//
+// BootClock's methods are safe for concurrent use.
+type BootClock struct {
+	maxWait  time.Duration
+	baseWall time.Time
+	baseBoot time.Duration
+}
+
+// NewBootClock returns a new BootClock with the given configuration.
+func NewBootClock(config BootClockConfig) (*BootClock, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating boot clock config")
+	}
+	if config.MaxWait == 0 {
+		config.MaxWait = DefaultBootClockMaxWait
+	}
+	return &BootClock{
+		maxWait:  config.MaxWait,
+		baseWall: time.Now().Round(0),
+		baseBoot: bootTime(),
+	}, nil
+}
+
+// BootTimeSupported reports whether BootClocks measure elapsed time
+// with the system's boot time, rather than falling back to the wall
+// clock time.
+func BootTimeSupported() bool {
+	return bootTimeSupported()
+}
+
+// Now is part of the Clock interface.
+func (c *BootClock) Now() time.Time {
+	return c.baseWall.Add(bootTime() - c.baseBoot)
+}
+
+// After is part of the Clock interface.
+func (c *BootClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).Chan()
+}
+
+// NewTimer is part of the TimerClock interface.
+func (c *BootClock) NewTimer(d time.Duration) Timer {
+	t := &bootTimer{
+		clock:    c,
+		ch:       make(chan time.Time, 1),
+		active:   true,
+		deadline: bootTime() + d,
+	}
+	// The lock is held until the runtime timer is
+	// recorded, so that check may not run before.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timer = time.AfterFunc(c.wait(d), t.check)
+	return t
+}
+
+// wait returns the duration for which a timer should wait, with
+// the specified duration remaining: the remaining duration, or
+// the clock's MaxWait, whichever is less.
+func (c *BootClock) wait(remaining time.Duration) time.Duration {
+	if remaining > c.maxWait {
+		return c.maxWait
+	}
+	return remaining
+}
+
+// bootTimer implements Timer for a BootClock, waiting with a runtime
+// timer for at most the clock's MaxWait at a time, and then checking
+// whether its time has passed.
+type bootTimer struct {
+	clock *BootClock
+	ch    chan time.Time
+	timer *time.Timer
+
+	mu       sync.Mutex
+	active   bool
+	deadline time.Duration
+}
+
+// Chan is part of the Timer interface.
+func (t *bootTimer) Chan() <-chan time.Time {
+	return t.ch
+}
+
+// Reset is part of the Timer interface.
+func (t *bootTimer) Reset(d time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := t.stop()
+	t.active = true
+	t.deadline = bootTime() + d
+	t.timer.Reset(t.clock.wait(d))
+	return active
+}
+
+// Stop is part of the Timer interface.
+func (t *bootTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stop()
+}
+
+// stop stops the timer, discarding any unreceived send, and reports
+// whether it had been active. stop must be called with t.mu held.
+func (t *bootTimer) stop() bool {
+	active := t.active
+	t.active = false
+	t.timer.Stop()
+	select {
+	case <-t.ch:
+	default:
+	}
+	return active
+}
+
+// check sends on the timer's channel if its time has
+// passed, and otherwise waits again.
+func (t *bootTimer) check() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.active {
+		return
+	}
+	if remaining := t.deadline - bootTime(); remaining > 0 {
+		t.timer.Reset(t.clock.wait(remaining))
+		return
+	}
+	t.active = false
+	select {
+	case t.ch <- t.clock.Now():
+	default:
+	}
+}
+
+// wallTime returns the wall clock time as a duration since the epoch,
+// for measuring elapsed time where the boot time is unavailable.
+func wallTime() time.Duration {
+	return time.Duration(time.Now().UnixNano())
+}
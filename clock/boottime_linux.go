@@ -0,0 +1,50 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// clockBoottime is the Linux clock ID of CLOCK_BOOTTIME.
+const clockBoottime = 7
+
+var (
+	bootTimeOnce sync.Once
+	bootTimeOK   bool
+)
+
+// bootTimeSupported reports whether CLOCK_BOOTTIME is available;
+// it was added in Linux 2.6.39.
+func bootTimeSupported() bool {
+	bootTimeOnce.Do(func() {
+		_, bootTimeOK = clockGettime(clockBoottime)
+	})
+	return bootTimeOK
+}
+
+// bootTime returns the time since the system booted, including
+// time spent suspended, or the wall clock time if CLOCK_BOOTTIME
+// is unavailable.
+func bootTime() time.Duration {
+	if !bootTimeSupported() {
+		return wallTime()
+	}
+	t, _ := clockGettime(clockBoottime)
+	return t
+}
+
+// clockGettime reads the specified clock, and reports whether
+// or not it could be read.
+func clockGettime(id int) (time.Duration, bool) {
+	var ts syscall.Timespec
+	_, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, uintptr(id), uintptr(unsafe.Pointer(&ts)), 0)
+	if errno != 0 {
+		return 0, false
+	}
+	return time.Duration(ts.Nano()), true
+}
@@ -0,0 +1,20 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build !linux
+
+package clock
+
+import "time"
+
+// bootTimeSupported reports that the boot time is unavailable;
+// BootClocks fall back to the wall clock time.
+func bootTimeSupported() bool {
+	return false
+}
+
+// bootTime returns the wall clock time, in place
+// of the unavailable boot time.
+func bootTime() time.Duration {
+	return wallTime()
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type bootClockSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&bootClockSuite{})
+
+func (s *bootClockSuite) TestValidate(c *gc.C) {
+	_, err := clock.NewBootClock(clock.BootClockConfig{MaxWait: -1})
+	c.Assert(err, gc.ErrorMatches, "validating boot clock config: negative MaxWait not valid")
+}
+
+func (s *bootClockSuite) TestSupported(c *gc.C) {
+	c.Assert(clock.BootTimeSupported(), gc.Equals, runtime.GOOS == "linux")
+}
+
+func (s *bootClockSuite) TestNow(c *gc.C) {
+	bc, err := clock.NewBootClock(clock.BootClockConfig{})
+	c.Assert(err, jc.ErrorIsNil)
+	wall := time.Now()
+	t0 := bc.Now()
+	c.Assert(t0.Sub(wall) < time.Second && wall.Sub(t0) < time.Second, jc.IsTrue)
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(bc.Now().Sub(t0) >= 10*time.Millisecond, jc.IsTrue)
+}
+
+func (s *bootClockSuite) TestTimer(c *gc.C) {
+	// A short MaxWait ensures that the timer waits, and
+	// checks the boot time, several times before sending.
+	bc, err := clock.NewBootClock(clock.BootClockConfig{MaxWait: time.Millisecond})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := bc.Now()
+	t := bc.NewTimer(20 * time.Millisecond)
+	select {
+	case t1 := <-t.Chan():
+		c.Assert(t1.Sub(t0) >= 20*time.Millisecond, jc.IsTrue)
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timer did not send")
+	}
+	c.Assert(t.Stop(), jc.IsFalse)
+
+	c.Assert(t.Reset(time.Hour), jc.IsFalse)
+	c.Assert(t.Reset(time.Millisecond), jc.IsTrue)
+	select {
+	case <-t.Chan():
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("reset timer did not send")
+	}
+
+	t.Reset(10 * time.Millisecond)
+	c.Assert(t.Stop(), jc.IsTrue)
+	select {
+	case <-t.Chan():
+		c.Fatalf("stopped timer sent")
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+func (s *bootClockSuite) TestAfter(c *gc.C) {
+	bc, err := clock.NewBootClock(clock.BootClockConfig{})
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case <-bc.After(time.Millisecond):
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("After did not send")
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// DefaultLocalTimePath is the LocalTimePath used by a ChangeWatcher
+// if none is specified.
+const DefaultLocalTimePath = "/etc/localtime"
+
+// ChangeKind identifies the kind of a change observed by a
+// ChangeWatcher.
+type ChangeKind int
+
+const (
+	// ChangeWallClock is the kind of change made when the
+	// wall clock is stepped, such as by an administrator or NTP.
+	ChangeWallClock ChangeKind = iota
+
+	// ChangeTimeZone is the kind of change made when the local
+	// time zone changes, or its definition is updated.
+	ChangeTimeZone
+)
+
+// String returns a string representation of the kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeWallClock:
+		return "wall-clock"
+	case ChangeTimeZone:
+		return "time-zone"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change describes a change to the system's time observed by a
+// ChangeWatcher.
+type Change struct {
+	// Kind is the kind of change.
+	Kind ChangeKind
+
+	// Time is the wall clock time at which the change was observed.
+	Time time.Time
+
+	// Step is, for ChangeWallClock changes, the amount by which the
+	// wall clock was stepped, positive if forwards: the difference
+	// between the wall clock time and the reference clock time that
+	// elapsed since the previous check. If several steps were made
+	// between checks, Step is their sum.
+	Step time.Duration
+
+	// Location is, for ChangeTimeZone changes, the new local time
+	// zone, or nil if it could not be loaded. The runtime's time.Local
+	// is determined once, when first used, and is not affected by the
+	// change; times that should be in the new local time zone must be
+	// converted to Location explicitly.
+	Location *time.Location
+}
+
+// ChangeWatcherConfig holds the configuration for a ChangeWatcher.
+type ChangeWatcherConfig struct {
+	// Clock is the reference clock: it is used to measure the time
+	// elapsed between checks, and to wait between them, and so should
+	// measure time with the runtime's monotonic clock, as WallClock
+	// does, rather than with the wall clock time.
+	Clock Clock
+
+	// Wall, if non-nil, is the source of the wall clock time whose
+	// steps are observed. If Wall is nil, the system's wall clock is
+	// observed, and where the platform provides notifications of the
+	// wall clock being set, they are used to observe steps promptly,
+	// rather than at the next check.
+	Wall Source
+
+	// PollInterval is the time between checks.
+	PollInterval time.Duration
+
+	// MinStep is the smallest step of the wall clock, relative to the
+	// reference clock, that is observed at a periodic check; smaller
+	// differences are attributed to the gradual adjustment of the wall
+	// clock, or to the imprecision of the clocks. Steps notified by the
+	// platform are observed regardless of size.
+	MinStep time.Duration
+
+	// LocalTimePath is the path of the file that defines the local
+	// time zone, when the TZ environment variable is not set. If
+	// LocalTimePath is empty, DefaultLocalTimePath is used.
+	LocalTimePath string
+}
+
+// Validate checks that the config is valid.
+func (config ChangeWatcherConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.PollInterval <= 0 {
+		return errors.NotValidf("non-positive PollInterval")
+	}
+	if config.MinStep <= 0 {
+		return errors.NotValidf("non-positive MinStep")
+	}
+	return nil
+}
+
+// ChangeWatcher observes changes to the system's time that invalidate
+// absolute times computed earlier, and notifies its subscribers: steps
+// of the wall clock, such as when an administrator corrects the host's
+// clock, and changes to the local time zone. Timers wait for durations
+// measured with the runtime's monotonic clock, so a timer set for an
+// absolute wall clock time, such as by Alarm, fires at the wrong time
+// once the wall clock is stepped; subscribers should then re-arm their
+// timers, such as with alarms.Service.Rearm.
+//
+// Steps are observed by comparing the wall clock time that elapses
+// between periodic checks with that elapsed on the reference clock,
+// and on Linux, promptly when the wall clock is set, with a timer that
+// is cancelled by the kernel when it is. Time zone changes are observed
+// at the periodic checks, by comparing the TZ environment variable and
+// the file at LocalTimePath with their previous states.
+//
+// ChangeWatcher's methods are safe for concurrent use.
+type ChangeWatcher struct {
+	config ChangeWatcherConfig
+
+	// checkMu serialises checks, and guards the state
+	// observed at the previous check.
+	checkMu   sync.Mutex
+	wall      time.Time
+	reference time.Time
+	zone      zoneState
+
+	mu          sync.Mutex
+	subscribers []subscriber
+	nextID      int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewChangeWatcher constructs a new ChangeWatcher with the given
+// configuration, and starts watching for changes. The watcher will
+// continue to watch for changes until it is killed.
+func NewChangeWatcher(config ChangeWatcherConfig) (*ChangeWatcher, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating change watcher config")
+	}
+	if config.LocalTimePath == "" {
+		config.LocalTimePath = DefaultLocalTimePath
+	}
+	var watchSet func(context.Context) <-chan struct{}
+	if config.Wall == nil {
+		config.Wall = SourceFunc(func() (time.Time, error) {
+			return time.Now().Round(0), nil
+		})
+		watchSet = watchClockSet
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &ChangeWatcher{
+		config:    config,
+		reference: config.Clock.Now(),
+		zone:      readZoneState(config.LocalTimePath),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	// An unavailable wall clock is treated as having the zero time,
+	// so that a step is observed once it is available.
+	w.wall, _ = config.Wall.Now()
+	var notified <-chan struct{}
+	if watchSet != nil {
+		notified = watchSet(ctx)
+	}
+	go w.loop(NewTimer(config.Clock, config.PollInterval), notified)
+	return w, nil
+}
+
+// Kill stops the watcher from watching for changes. Kill does not
+// wait for the watcher to stop; use Wait for that.
+func (w *ChangeWatcher) Kill() {
+	w.cancel()
+}
+
+// Wait waits for the watcher to stop.
+func (w *ChangeWatcher) Wait() error {
+	<-w.done
+	return nil
+}
+
+// Subscribe registers f to be called with each change observed by the
+// watcher, and returns a function that cancels the subscription. f is
+// called from the watcher's goroutine, or from Check, without any
+// locks held, and so may call the watcher's methods.
+func (w *ChangeWatcher) Subscribe(f func(Change)) (unsubscribe func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.nextID
+	w.nextID++
+	w.subscribers = append(w.subscribers, subscriber{id, f})
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for i, s := range w.subscribers {
+			if s.id == id {
+				w.subscribers = append(w.subscribers[:i:i], w.subscribers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// subscriber records a function subscribed to a ChangeWatcher.
+type subscriber struct {
+	id int
+	f  func(Change)
+}
+
+// Check checks for changes immediately, notifying the subscribers of
+// any that are observed.
+func (w *ChangeWatcher) Check() {
+	w.check(false)
+}
+
+// check checks for changes, notifying the subscribers of a wall clock
+// step regardless of its size if notified is true.
+func (w *ChangeWatcher) check(notified bool) {
+	w.checkMu.Lock()
+	var changes []Change
+	wall, err := w.config.Wall.Now()
+	reference := w.config.Clock.Now()
+	if err == nil {
+		step := wall.Sub(w.wall) - reference.Sub(w.reference)
+		w.wall, w.reference = wall, reference
+		if abs(step) >= w.config.MinStep || (notified && step != 0) {
+			changes = append(changes, Change{Kind: ChangeWallClock, Time: wall, Step: step})
+		}
+	}
+	zone := readZoneState(w.config.LocalTimePath)
+	zoneChanged := zone != w.zone
+	w.zone = zone
+	w.checkMu.Unlock()
+
+	w.mu.Lock()
+	subscribers := w.subscribers
+	w.mu.Unlock()
+
+	if zoneChanged {
+		if err != nil {
+			wall = time.Now().Round(0)
+		}
+		changes = append(changes, Change{
+			Kind:     ChangeTimeZone,
+			Time:     wall,
+			Location: loadLocalLocation(w.config.LocalTimePath),
+		})
+	}
+	for _, change := range changes {
+		for _, s := range subscribers {
+			s.f(change)
+		}
+	}
+}
+
+func (w *ChangeWatcher) loop(timer Timer, notified <-chan struct{}) {
+	defer close(w.done)
+	defer timer.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-notified:
+			w.check(true)
+		case <-timer.Chan():
+			w.Check()
+			timer.Reset(w.config.PollInterval)
+		}
+	}
+}
+
+// zoneState records the state of the configuration
+// that determines the local time zone.
+type zoneState struct {
+	tz      string
+	tzSet   bool
+	exists  bool
+	target  string
+	size    int64
+	modTime int64
+}
+
+// readZoneState returns the current state of the TZ environment
+// variable, and of the file at the specified path.
+func readZoneState(path string) zoneState {
+	var state zoneState
+	state.tz, state.tzSet = os.LookupEnv("TZ")
+	if info, err := os.Stat(path); err == nil {
+		state.exists = true
+		state.size = info.Size()
+		state.modTime = info.ModTime().UnixNano()
+	}
+	state.target, _ = os.Readlink(path)
+	return state
+}
+
+// loadLocalLocation loads the local time zone, as named by the TZ
+// environment variable, or if it is not set, as defined by the file
+// at the specified path. loadLocalLocation returns nil if the time
+// zone cannot be loaded.
+func loadLocalLocation(path string) *time.Location {
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		if tz == "" {
+			return time.UTC
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil
+		}
+		return loc
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	loc, err := time.LoadLocationFromTZData("Local", data)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
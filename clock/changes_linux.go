@@ -0,0 +1,83 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// clockRealtime is the Linux clock ID of CLOCK_REALTIME.
+	clockRealtime = 0
+
+	// tfdTimerAbstime and tfdTimerCancelOnSet are the timerfd_settime
+	// flags TFD_TIMER_ABSTIME and TFD_TIMER_CANCEL_ON_SET.
+	tfdTimerAbstime     = 1
+	tfdTimerCancelOnSet = 2
+)
+
+// itimerspec is the Linux struct itimerspec.
+type itimerspec struct {
+	interval syscall.Timespec
+	value    syscall.Timespec
+}
+
+// watchClockSet returns a channel that receives a value whenever the
+// wall clock is set, until the context is done, using a timerfd that
+// the kernel cancels when CLOCK_REALTIME is set; this is supported
+// since Linux 3.0. If it is unsupported, the channel is nil.
+func watchClockSet(ctx context.Context) <-chan struct{} {
+	fd, _, errno := syscall.Syscall(syscall.SYS_TIMERFD_CREATE, clockRealtime, syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		return nil
+	}
+	// The timer is set for the latest time representable on all
+	// platforms, so that it is only ever cancelled, not expired.
+	spec := itimerspec{value: syscall.Timespec{Sec: math.MaxInt32}}
+	arm := func() bool {
+		_, _, errno := syscall.Syscall6(
+			syscall.SYS_TIMERFD_SETTIME, fd, tfdTimerAbstime|tfdTimerCancelOnSet,
+			uintptr(unsafe.Pointer(&spec)), 0, 0, 0,
+		)
+		return errno == 0
+	}
+	if !arm() {
+		syscall.Close(int(fd))
+		return nil
+	}
+	// The file is non-blocking, so reads wait with the runtime's
+	// poller, and are interrupted by closing the file.
+	f := os.NewFile(fd, "timerfd")
+	stop := context.AfterFunc(ctx, func() { f.Close() })
+	set := make(chan struct{}, 1)
+	go func() {
+		defer func() {
+			if stop() {
+				f.Close()
+			}
+		}()
+		var buf [8]byte
+		for {
+			_, err := f.Read(buf[:])
+			if !errors.Is(err, syscall.ECANCELED) {
+				// The context is done, or the timerfd failed;
+				// changes are still observed by polling.
+				return
+			}
+			select {
+			case set <- struct{}{}:
+			default:
+			}
+			if !arm() {
+				return
+			}
+		}
+	}()
+	return set
+}
@@ -0,0 +1,15 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build !linux
+
+package clock
+
+import "context"
+
+// watchClockSet returns nil; the platform does not notify
+// the setting of the wall clock, so steps are observed only
+// by polling.
+func watchClockSet(ctx context.Context) <-chan struct{} {
+	return nil
+}
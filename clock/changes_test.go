@@ -0,0 +1,170 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type changeWatcherSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&changeWatcherSuite{})
+
+func (s *changeWatcherSuite) TestValidate(c *gc.C) {
+	valid := clock.ChangeWatcherConfig{
+		Clock:        clock.WallClock,
+		PollInterval: time.Second,
+		MinStep:      time.Second,
+	}
+	for _, test := range []struct {
+		modify func(*clock.ChangeWatcherConfig)
+		err    string
+	}{{
+		func(config *clock.ChangeWatcherConfig) { config.Clock = nil },
+		"nil Clock not valid",
+	}, {
+		func(config *clock.ChangeWatcherConfig) { config.PollInterval = 0 },
+		"non-positive PollInterval not valid",
+	}, {
+		func(config *clock.ChangeWatcherConfig) { config.MinStep = 0 },
+		"non-positive MinStep not valid",
+	}} {
+		config := valid
+		test.modify(&config)
+		_, err := clock.NewChangeWatcher(config)
+		c.Assert(err, gc.ErrorMatches, "validating change watcher config: "+test.err)
+	}
+}
+
+func (s *changeWatcherSuite) TestWallClockStep(c *gc.C) {
+	reference := clocktesting.NewClock(time.Time{})
+	var mu sync.Mutex
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	wall := t0
+	w, err := clock.NewChangeWatcher(clock.ChangeWatcherConfig{
+		Clock: reference,
+		Wall: clock.SourceFunc(func() (time.Time, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return wall, nil
+		}),
+		PollInterval:  time.Second,
+		MinStep:       time.Second,
+		LocalTimePath: filepath.Join(c.MkDir(), "localtime"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer w.Wait()
+	defer w.Kill()
+	changes := make(chan clock.Change, 10)
+	unsubscribe := w.Subscribe(func(change clock.Change) {
+		changes <- change
+	})
+	advance := func(d, extra time.Duration) {
+		mu.Lock()
+		wall = wall.Add(d + extra)
+		mu.Unlock()
+		reference.Advance(d)
+	}
+
+	// The wall clock drifting from the reference clock by
+	// less than MinStep is not reported.
+	advance(time.Second, 500*time.Millisecond)
+	assertNoChange(c, changes)
+
+	// The host's clock is corrected, five minutes back.
+	advance(time.Second, -5*time.Minute)
+	select {
+	case change := <-changes:
+		c.Assert(change, jc.DeepEquals, clock.Change{
+			Kind: clock.ChangeWallClock,
+			Time: t0.Add(2*time.Second + 500*time.Millisecond - 5*time.Minute),
+			Step: -5 * time.Minute,
+		})
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("change not reported")
+	}
+
+	unsubscribe()
+	advance(time.Second, time.Hour)
+	w.Check()
+	assertNoChange(c, changes)
+}
+
+func (s *changeWatcherSuite) TestTimeZone(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "localtime")
+	w, err := clock.NewChangeWatcher(clock.ChangeWatcherConfig{
+		Clock:         clocktesting.NewClock(time.Time{}),
+		Wall:          clock.SourceFunc(func() (time.Time, error) { return time.Time{}, nil }),
+		PollInterval:  time.Hour,
+		MinStep:       time.Second,
+		LocalTimePath: path,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer w.Wait()
+	defer w.Kill()
+	var changes []clock.Change
+	w.Subscribe(func(change clock.Change) {
+		changes = append(changes, change)
+	})
+
+	w.Check()
+	c.Assert(changes, gc.HasLen, 0)
+	err = os.WriteFile(path, []byte("not tzdata"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	w.Check()
+	c.Assert(changes, gc.HasLen, 1)
+	c.Assert(changes[0].Kind, gc.Equals, clock.ChangeTimeZone)
+	if _, ok := os.LookupEnv("TZ"); !ok {
+		// The local time zone is defined by the file, which
+		// is invalid.
+		c.Assert(changes[0].Location, gc.IsNil)
+	}
+	w.Check()
+	c.Assert(changes, gc.HasLen, 1)
+}
+
+func (s *changeWatcherSuite) TestSystemWallClock(c *gc.C) {
+	w, err := clock.NewChangeWatcher(clock.ChangeWatcherConfig{
+		Clock:        clock.WallClock,
+		PollInterval: time.Hour,
+		MinStep:      time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	var changes []clock.Change
+	w.Subscribe(func(change clock.Change) {
+		changes = append(changes, change)
+	})
+	w.Check()
+	c.Assert(changes, gc.HasLen, 0)
+	w.Kill()
+	done := make(chan struct{})
+	go func() {
+		w.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("watcher did not stop")
+	}
+}
+
+func assertNoChange(c *gc.C, changes <-chan clock.Change) {
+	select {
+	case change := <-changes:
+		c.Fatalf("unexpected change %+v", change)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
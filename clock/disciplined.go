@@ -0,0 +1,163 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// DefaultMaxSlewRate is the MaxSlewRate used by a DisciplinedClock if
+// none is specified: 500 parts per million, as for the NTP daemon.
+const DefaultMaxSlewRate = 500e-6
+
+// DisciplinedClockConfig holds the configuration for a DisciplinedClock.
+type DisciplinedClockConfig struct {
+	// Clock is the underlying clock, whose time is corrected.
+	Clock Clock
+
+	// MaxSlewRate is the maximum rate at which corrections are
+	// applied, as a fraction of elapsed time; e.g. with a rate of
+	// 0.001, a correction of one second is applied over 1000
+	// seconds. MaxSlewRate must be less than 1, so that corrected
+	// time never goes backwards; if it is zero, DefaultMaxSlewRate
+	// is used.
+	MaxSlewRate float64
+
+	// StepThreshold, if positive, is the magnitude of offset above
+	// which the correction is applied immediately, rather than
+	// gradually, as it would otherwise take too long to apply.
+	StepThreshold time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config DisciplinedClockConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.MaxSlewRate < 0 || config.MaxSlewRate >= 1 {
+		return errors.NotValidf("MaxSlewRate %v", config.MaxSlewRate)
+	}
+	if config.StepThreshold < 0 {
+		return errors.NotValidf("negative StepThreshold")
+	}
+	return nil
+}
+
+// DisciplinedClock is a Clock that corrects the time of an underlying
+// clock according to offset measurements, such as those made against
+// an NTP server, slewing its time gradually towards the measured time
+// rather than stepping it. Stepping the time seen by a Schedule either
+// makes all pending operations ready at once, or stalls them; slewing
+// keeps the time monotonic and its rate close to the true rate.
+//
+// After waits for durations as measured by the underlying clock, since
+// the corrected rate differs from it by at most the maximum slew rate.
+//
+// DisciplinedClock's methods are safe for concurrent use.
+type DisciplinedClock struct {
+	config DisciplinedClockConfig
+	rate   float64
+
+	mu sync.Mutex
+	// base is the underlying time of the last adjustment; applied
+	// is the correction applied at that time, and pending the
+	// correction then yet to be applied.
+	base    time.Time
+	applied time.Duration
+	pending time.Duration
+}
+
+// NewDisciplinedClock returns a new DisciplinedClock with the given
+// configuration, with no correction applied.
+func NewDisciplinedClock(config DisciplinedClockConfig) (*DisciplinedClock, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating disciplined clock config")
+	}
+	rate := config.MaxSlewRate
+	if rate == 0 {
+		rate = DefaultMaxSlewRate
+	}
+	return &DisciplinedClock{
+		config: config,
+		rate:   rate,
+		base:   config.Clock.Now(),
+	}, nil
+}
+
+// Now is part of the Clock interface. Now returns the underlying
+// clock's time, plus the correction applied so far.
+func (c *DisciplinedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.config.Clock.Now()
+	applied, _ := c.correction(now)
+	return now.Add(applied)
+}
+
+// After is part of the Clock interface.
+func (c *DisciplinedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	go func() {
+		<-c.config.Clock.After(d)
+		ch <- c.Now()
+	}()
+	return ch
+}
+
+// Adjust records a measurement of the clock's offset from the true
+// time: a positive offset means that the clock is behind. Subsequent
+// calls to Now are corrected gradually by the offset, replacing any
+// correction that is still pending, since the measurement accounts
+// for the correction applied so far. If the offset exceeds the step
+// threshold, it is applied immediately.
+func (c *DisciplinedClock) Adjust(offset time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.config.Clock.Now()
+	c.applied, _ = c.correction(now)
+	c.base = now
+	if c.config.StepThreshold > 0 && abs(offset) > c.config.StepThreshold {
+		c.applied += offset
+		c.pending = 0
+		return
+	}
+	c.pending = offset
+}
+
+// Correction returns the correction applied so far, which is added to
+// the underlying clock's time, and the correction still pending.
+func (c *DisciplinedClock) Correction() (applied, pending time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.correction(c.config.Clock.Now())
+}
+
+// correction returns the correction applied, and still pending, at
+// the specified underlying time: as much of the pending correction as
+// the time elapsed since the last adjustment allows is applied.
+// correction must be called with c.mu held.
+func (c *DisciplinedClock) correction(now time.Time) (applied, pending time.Duration) {
+	elapsed := now.Sub(c.base)
+	if elapsed <= 0 || c.pending == 0 {
+		return c.applied, c.pending
+	}
+	slew := time.Duration(float64(elapsed) * c.rate)
+	if abs(c.pending) <= slew {
+		return c.applied + c.pending, 0
+	}
+	if c.pending < 0 {
+		slew = -slew
+	}
+	return c.applied + slew, c.pending - slew
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
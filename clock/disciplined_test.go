@@ -0,0 +1,127 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type disciplinedSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+	t0    time.Time
+}
+
+var _ = gc.Suite(&disciplinedSuite{})
+
+func (s *disciplinedSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.t0 = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.clock = coretesting.NewClock(s.t0)
+}
+
+func (s *disciplinedSuite) newClock(c *gc.C, stepThreshold time.Duration) *clock.DisciplinedClock {
+	dc, err := clock.NewDisciplinedClock(clock.DisciplinedClockConfig{
+		Clock:         s.clock,
+		MaxSlewRate:   0.001,
+		StepThreshold: stepThreshold,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return dc
+}
+
+func (s *disciplinedSuite) TestValidate(c *gc.C) {
+	_, err := clock.NewDisciplinedClock(clock.DisciplinedClockConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating disciplined clock config: nil Clock not valid")
+	_, err = clock.NewDisciplinedClock(clock.DisciplinedClockConfig{Clock: s.clock, MaxSlewRate: 1})
+	c.Assert(err, gc.ErrorMatches, "validating disciplined clock config: MaxSlewRate 1 not valid")
+}
+
+func (s *disciplinedSuite) TestSlew(c *gc.C) {
+	dc := s.newClock(c, 0)
+	c.Assert(dc.Now(), gc.Equals, s.t0)
+
+	// A one second correction is applied over 1000 seconds.
+	dc.Adjust(time.Second)
+	s.clock.Advance(100 * time.Second)
+	c.Assert(dc.Now(), gc.Equals, s.t0.Add(100*time.Second+100*time.Millisecond))
+	applied, pending := dc.Correction()
+	c.Assert(applied, gc.Equals, 100*time.Millisecond)
+	c.Assert(pending, gc.Equals, 900*time.Millisecond)
+
+	s.clock.Advance(900 * time.Second)
+	c.Assert(dc.Now(), gc.Equals, s.t0.Add(1001*time.Second))
+	s.clock.Advance(time.Hour)
+	applied, pending = dc.Correction()
+	c.Assert(applied, gc.Equals, time.Second)
+	c.Assert(pending, gc.Equals, time.Duration(0))
+}
+
+func (s *disciplinedSuite) TestSlewBackwards(c *gc.C) {
+	dc := s.newClock(c, 0)
+	dc.Adjust(-time.Second)
+
+	// Corrected time slows, but never goes backwards.
+	last := dc.Now()
+	for i := 0; i < 20; i++ {
+		s.clock.Advance(100 * time.Second)
+		now := dc.Now()
+		c.Assert(now.After(last), jc.IsTrue)
+		last = now
+	}
+	c.Assert(last, gc.Equals, s.t0.Add(2000*time.Second-time.Second))
+}
+
+func (s *disciplinedSuite) TestAdjustReplacesPending(c *gc.C) {
+	dc := s.newClock(c, 0)
+	dc.Adjust(time.Second)
+	s.clock.Advance(500 * time.Second)
+
+	// Half of the correction has been applied; a new measurement
+	// of the remaining offset replaces the pending correction.
+	dc.Adjust(100 * time.Millisecond)
+	applied, pending := dc.Correction()
+	c.Assert(applied, gc.Equals, 500*time.Millisecond)
+	c.Assert(pending, gc.Equals, 100*time.Millisecond)
+	s.clock.Advance(100 * time.Second)
+	c.Assert(dc.Now(), gc.Equals, s.t0.Add(600*time.Second+600*time.Millisecond))
+}
+
+func (s *disciplinedSuite) TestStepThreshold(c *gc.C) {
+	dc := s.newClock(c, time.Minute)
+	dc.Adjust(time.Hour)
+	c.Assert(dc.Now(), gc.Equals, s.t0.Add(time.Hour))
+	applied, pending := dc.Correction()
+	c.Assert(applied, gc.Equals, time.Hour)
+	c.Assert(pending, gc.Equals, time.Duration(0))
+
+	dc.Adjust(time.Minute)
+	c.Assert(dc.Now(), gc.Equals, s.t0.Add(time.Hour))
+}
+
+func (s *disciplinedSuite) TestAfter(c *gc.C) {
+	dc := s.newClock(c, time.Minute)
+	dc.Adjust(time.Hour)
+	ch := dc.After(time.Second)
+
+	// The underlying clock's waiter is registered by another
+	// goroutine, so keep advancing until it fires.
+	timeout := time.After(coretesting.LongWait)
+	for {
+		s.clock.Advance(time.Second)
+		select {
+		case t := <-ch:
+			c.Assert(t, gc.Equals, s.clock.Now().Add(time.Hour))
+			return
+		case <-time.After(time.Millisecond):
+		case <-timeout:
+			c.Fatalf("timed out waiting for After")
+		}
+	}
+}
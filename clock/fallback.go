@@ -0,0 +1,257 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Source is a source of time, such as an NTP server, that may become
+// unavailable.
+type Source interface {
+	// Now returns the source's current time, or an
+	// error if the source is unavailable.
+	Now() (time.Time, error)
+}
+
+// SourceFunc is a function that implements Source.
+type SourceFunc func() (time.Time, error)
+
+// Now is part of the Source interface.
+func (f SourceFunc) Now() (time.Time, error) {
+	return f()
+}
+
+// Holdover is the index reported by FallbackClock when none of its
+// sources is healthy, and it is keeping time with the local clock.
+const Holdover = -1
+
+// FallbackClockConfig holds the configuration for a FallbackClock.
+type FallbackClockConfig struct {
+	// Clock is the local clock, which keeps time between checks
+	// of the sources.
+	Clock Clock
+
+	// Sources holds the time sources, in order of preference.
+	Sources []Source
+
+	// CheckInterval is the time between checks of the sources.
+	CheckInterval time.Duration
+
+	// MaxDivergence, if positive, is the maximum amount by which a
+	// source's offset from the local clock may change between
+	// consecutive checks. A source whose offset changes by more is
+	// considered unhealthy until its offset is stable again.
+	MaxDivergence time.Duration
+
+	// OnSwitch, if non-nil, is called whenever the clock switches
+	// from one source to another, with the indices of the sources,
+	// either of which may be Holdover. The clock starts in holdover,
+	// so OnSwitch is called by NewFallbackClock if any source is
+	// healthy.
+	OnSwitch func(from, to int)
+}
+
+// Validate checks that the config is valid.
+func (config FallbackClockConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if len(config.Sources) == 0 {
+		return errors.NotValidf("empty Sources")
+	}
+	for i, source := range config.Sources {
+		if source == nil {
+			return errors.NotValidf("nil source %d", i)
+		}
+	}
+	if config.CheckInterval <= 0 {
+		return errors.NotValidf("non-positive CheckInterval")
+	}
+	if config.MaxDivergence < 0 {
+		return errors.NotValidf("negative MaxDivergence")
+	}
+	return nil
+}
+
+// SourceStatus describes the health of a source, as of the last check.
+type SourceStatus struct {
+	// Healthy reports whether the source was available,
+	// and its offset had not diverged.
+	Healthy bool
+
+	// Offset is the source's offset from the local clock, as of the
+	// last check at which it was available.
+	Offset time.Duration
+
+	// Err describes why the source is unhealthy.
+	Err error
+}
+
+// FallbackClock is a Clock that keeps the time of the most preferred of
+// several sources that is healthy, falling back to less preferred ones
+// when it is unavailable or its time diverges. The sources are checked
+// periodically, measuring their offsets from the local clock; between
+// checks, FallbackClock adds the active source's offset to the local
+// clock's time. If no source is healthy, FallbackClock keeps the offset
+// of the last active source, with the local clock keeping time.
+//
+// The time may step when the clock switches between sources whose
+// offsets differ; use a DisciplinedClock to smooth the transition.
+//
+// FallbackClock's methods are safe for concurrent use.
+type FallbackClock struct {
+	config FallbackClockConfig
+
+	mu       sync.Mutex
+	statuses []SourceStatus
+	// read records whether each source has ever been read.
+	read   []bool
+	active int
+	offset time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewFallbackClock constructs a new FallbackClock with the given
+// configuration, checks its sources, and starts checking them
+// periodically. The clock will continue to check its sources until it
+// is killed.
+func NewFallbackClock(config FallbackClockConfig) (*FallbackClock, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating fallback clock config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &FallbackClock{
+		config:   config,
+		statuses: make([]SourceStatus, len(config.Sources)),
+		read:     make([]bool, len(config.Sources)),
+		active:   Holdover,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	c.Check()
+	go c.loop(NewTimer(config.Clock, config.CheckInterval))
+	return c, nil
+}
+
+// Kill stops the clock from checking its sources. The clock continues
+// to keep time using the offset of the last active source. Kill does
+// not wait for the checks to stop; use Wait for that.
+func (c *FallbackClock) Kill() {
+	c.cancel()
+}
+
+// Wait waits for the clock to stop checking its sources.
+func (c *FallbackClock) Wait() error {
+	<-c.done
+	return nil
+}
+
+// Now is part of the Clock interface.
+func (c *FallbackClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config.Clock.Now().Add(c.offset)
+}
+
+// After is part of the Clock interface.
+func (c *FallbackClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	go func() {
+		<-c.config.Clock.After(d)
+		ch <- c.Now()
+	}()
+	return ch
+}
+
+// Active returns the index of the active source, or Holdover.
+func (c *FallbackClock) Active() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// Status returns the status of each source, as of the last check.
+func (c *FallbackClock) Status() []SourceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SourceStatus(nil), c.statuses...)
+}
+
+// Check checks the sources immediately, switching to the most preferred
+// healthy source. Sources are read without any locks held.
+func (c *FallbackClock) Check() {
+	type reading struct {
+		offset time.Duration
+		err    error
+	}
+	readings := make([]reading, len(c.config.Sources))
+	for i, source := range c.config.Sources {
+		t, err := source.Now()
+		readings[i] = reading{t.Sub(c.config.Clock.Now()), err}
+	}
+
+	c.mu.Lock()
+	active := Holdover
+	for i, r := range readings {
+		status := &c.statuses[i]
+		switch {
+		case r.err != nil:
+			status.Healthy = false
+			status.Err = r.err
+		case c.read[i] && c.diverged(status, r.offset):
+			status.Healthy = false
+			status.Err = errors.Errorf("offset changed by %v", abs(r.offset-status.Offset))
+			status.Offset = r.offset
+		default:
+			status.Healthy = true
+			status.Err = nil
+			status.Offset = r.offset
+		}
+		if r.err == nil {
+			c.read[i] = true
+		}
+		if status.Healthy && active == Holdover {
+			active = i
+		}
+	}
+	from := c.active
+	c.active = active
+	if active != Holdover {
+		c.offset = c.statuses[active].Offset
+	}
+	c.mu.Unlock()
+
+	if from != active && c.config.OnSwitch != nil {
+		c.config.OnSwitch(from, active)
+	}
+}
+
+// diverged reports whether the source's offset has changed by more than
+// the maximum divergence since the last check at which it was available.
+func (c *FallbackClock) diverged(status *SourceStatus, offset time.Duration) bool {
+	return c.config.MaxDivergence > 0 && abs(offset-status.Offset) > c.config.MaxDivergence
+}
+
+func (c *FallbackClock) loop(timer Timer) {
+	defer close(c.done)
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-timer.Chan():
+			c.Check()
+			timer.Reset(c.config.CheckInterval)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type fallbackSuite struct {
+	coretesting.BaseSuite
+	clock    *coretesting.Clock
+	t0       time.Time
+	sources  []*fakeSource
+	switches chan [2]int
+}
+
+var _ = gc.Suite(&fallbackSuite{})
+
+func (s *fallbackSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.t0 = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.clock = coretesting.NewClock(s.t0)
+	s.sources = []*fakeSource{
+		{clock: s.clock, offset: time.Second},
+		{clock: s.clock, offset: 2 * time.Second},
+	}
+	s.switches = make(chan [2]int, 10)
+}
+
+func (s *fallbackSuite) newClock(c *gc.C) *clock.FallbackClock {
+	fc, err := clock.NewFallbackClock(clock.FallbackClockConfig{
+		Clock:         s.clock,
+		Sources:       []clock.Source{s.sources[0], s.sources[1]},
+		CheckInterval: time.Minute,
+		MaxDivergence: 100 * time.Millisecond,
+		OnSwitch: func(from, to int) {
+			s.switches <- [2]int{from, to}
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return fc
+}
+
+func (s *fallbackSuite) TestValidate(c *gc.C) {
+	_, err := clock.NewFallbackClock(clock.FallbackClockConfig{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating fallback clock config: empty Sources not valid")
+}
+
+func (s *fallbackSuite) TestPrimary(c *gc.C) {
+	fc := s.newClock(c)
+	defer stopFallback(c, fc)
+	c.Assert(<-s.switches, gc.Equals, [2]int{clock.Holdover, 0})
+	c.Assert(fc.Active(), gc.Equals, 0)
+	c.Assert(fc.Now(), gc.Equals, s.t0.Add(time.Second))
+
+	// Between checks, the local clock keeps time.
+	s.clock.Advance(30 * time.Second)
+	c.Assert(fc.Now(), gc.Equals, s.t0.Add(31*time.Second))
+}
+
+func (s *fallbackSuite) TestFallback(c *gc.C) {
+	fc := s.newClock(c)
+	defer stopFallback(c, fc)
+	<-s.switches
+
+	s.sources[0].setErr(errors.New("unreachable"))
+	fc.Check()
+	c.Assert(<-s.switches, gc.Equals, [2]int{0, 1})
+	c.Assert(fc.Now(), gc.Equals, s.t0.Add(2*time.Second))
+	status := fc.Status()
+	c.Assert(status[0].Healthy, jc.IsFalse)
+	c.Assert(status[0].Err, gc.ErrorMatches, "unreachable")
+	c.Assert(status[1].Healthy, jc.IsTrue)
+
+	// The primary is preferred once it is available again.
+	s.sources[0].setErr(nil)
+	fc.Check()
+	c.Assert(<-s.switches, gc.Equals, [2]int{1, 0})
+	c.Assert(fc.Now(), gc.Equals, s.t0.Add(time.Second))
+}
+
+func (s *fallbackSuite) TestHoldover(c *gc.C) {
+	fc := s.newClock(c)
+	defer stopFallback(c, fc)
+	<-s.switches
+
+	s.sources[0].setErr(errors.New("unreachable"))
+	s.sources[1].setErr(errors.New("unreachable"))
+	fc.Check()
+	c.Assert(<-s.switches, gc.Equals, [2]int{0, clock.Holdover})
+	c.Assert(fc.Active(), gc.Equals, clock.Holdover)
+
+	// The last active source's offset is kept.
+	s.clock.Advance(time.Second)
+	c.Assert(fc.Now(), gc.Equals, s.t0.Add(2*time.Second))
+}
+
+func (s *fallbackSuite) TestDivergence(c *gc.C) {
+	fc := s.newClock(c)
+	defer stopFallback(c, fc)
+	<-s.switches
+
+	s.sources[0].setOffset(time.Hour)
+	fc.Check()
+	c.Assert(<-s.switches, gc.Equals, [2]int{0, 1})
+	c.Assert(fc.Status()[0].Err, gc.ErrorMatches, "offset changed by 59m59s")
+
+	// Once the primary's offset is stable again, it is healthy.
+	fc.Check()
+	c.Assert(<-s.switches, gc.Equals, [2]int{1, 0})
+	c.Assert(fc.Now(), gc.Equals, s.t0.Add(time.Hour))
+}
+
+func (s *fallbackSuite) TestPeriodicCheck(c *gc.C) {
+	fc := s.newClock(c)
+	defer stopFallback(c, fc)
+	<-s.switches
+
+	s.sources[0].setErr(errors.New("unreachable"))
+	s.clock.Advance(time.Minute)
+	select {
+	case sw := <-s.switches:
+		c.Assert(sw, gc.Equals, [2]int{0, 1})
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for switch")
+	}
+}
+
+// stopFallback kills the clock, and waits for it to stop.
+func stopFallback(c *gc.C, fc *clock.FallbackClock) {
+	fc.Kill()
+	c.Check(fc.Wait(), jc.ErrorIsNil)
+}
+
+// fakeSource is a Source whose time has a fixed offset
+// from a test clock, and which may be made unavailable.
+type fakeSource struct {
+	clock *coretesting.Clock
+
+	mu     sync.Mutex
+	offset time.Duration
+	err    error
+}
+
+func (f *fakeSource) Now() (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return time.Time{}, f.err
+	}
+	return f.clock.Now().Add(f.offset), nil
+}
+
+func (f *fakeSource) setOffset(offset time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offset = offset
+}
+
+func (f *fakeSource) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
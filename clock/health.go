@@ -0,0 +1,227 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Health describes whether the system's time is reliable, as determined
+// by a HealthMonitor.
+type Health struct {
+	// Healthy reports whether the time is reliable.
+	Healthy bool
+
+	// Reason describes why the time is unreliable, if it is.
+	Reason string
+
+	// Since is the time, as measured by the monitor's Clock, at
+	// which the health last changed.
+	Since time.Time
+}
+
+// HealthMonitorConfig holds the configuration for a HealthMonitor. At
+// least one of Changes and Fallback must be specified.
+type HealthMonitorConfig struct {
+	// Clock is used to time the monitor's checks, and the time
+	// for which the time is unreliable after a step.
+	Clock Clock
+
+	// Changes, if non-nil, is the ChangeWatcher whose wall clock
+	// steps make the time unreliable.
+	Changes *ChangeWatcher
+
+	// Fallback, if non-nil, is the FallbackClock whose loss of all
+	// healthy sources, and so of synchronisation, makes the time
+	// unreliable until a source is healthy again.
+	Fallback *FallbackClock
+
+	// MaxStep is the magnitude of wall clock step, as reported by
+	// Changes, from which the time is considered unreliable. If
+	// MaxStep is zero, every step reported by Changes is.
+	MaxStep time.Duration
+
+	// Settle is the time for which the time is considered unreliable
+	// after a step, so that it may be corrected, or stepped again,
+	// before it is relied on. If Settle is zero, CheckInterval is used.
+	Settle time.Duration
+
+	// CheckInterval is the interval between checks of Fallback,
+	// and of whether Settle has passed since the last step.
+	CheckInterval time.Duration
+
+	// OnChange, if non-nil, is called with the new health whenever
+	// it changes. OnChange is called without any locks held, but
+	// must not call Check.
+	OnChange func(Health)
+}
+
+// Validate checks that the config is valid.
+func (config HealthMonitorConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Changes == nil && config.Fallback == nil {
+		return errors.NotValidf("missing Changes and Fallback")
+	}
+	if config.MaxStep < 0 {
+		return errors.NotValidf("negative MaxStep")
+	}
+	if config.Settle < 0 {
+		return errors.NotValidf("negative Settle")
+	}
+	if config.CheckInterval <= 0 {
+		return errors.NotValidf("non-positive CheckInterval")
+	}
+	return nil
+}
+
+// HealthMonitor determines whether the system's time is reliable, from
+// the wall clock steps observed by a ChangeWatcher, and the health of a
+// FallbackClock's sources, so that consumers such as schedules may pause,
+// or stop relying on the wall clock, while it is not. See schedule's
+// Config.ClockHealth.
+//
+// HealthMonitor's methods are safe for concurrent use.
+type HealthMonitor struct {
+	config      HealthMonitorConfig
+	unsubscribe func()
+
+	// checkMu serialises checks, so that changes
+	// are reported to OnChange in order.
+	checkMu sync.Mutex
+
+	mu     sync.Mutex
+	health Health
+	// stepped is the time of the last step of at least MaxStep,
+	// and step is its size, or zero if there has been none.
+	stepped time.Time
+	step    time.Duration
+	// changed is closed when the health next changes.
+	changed chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewHealthMonitor constructs a new HealthMonitor with the given
+// configuration, checks the health of the time, and starts checking it
+// periodically. The monitor will continue to check until it is killed.
+func NewHealthMonitor(config HealthMonitorConfig) (*HealthMonitor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating health monitor config")
+	}
+	if config.Settle == 0 {
+		config.Settle = config.CheckInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &HealthMonitor{
+		config:  config,
+		health:  Health{Healthy: true, Since: config.Clock.Now()},
+		changed: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	if config.Changes != nil {
+		m.unsubscribe = config.Changes.Subscribe(m.observe)
+	}
+	m.Check()
+	go m.loop(NewTimer(config.Clock, config.CheckInterval))
+	return m, nil
+}
+
+// Kill stops the monitor from checking the time, leaving its health
+// as of the last check. Kill does not wait for the checks to stop; use
+// Wait for that.
+func (m *HealthMonitor) Kill() {
+	m.cancel()
+}
+
+// Wait waits for the monitor to stop checking the time.
+func (m *HealthMonitor) Wait() error {
+	<-m.done
+	return nil
+}
+
+// Health returns the health of the time, as of the last check.
+func (m *HealthMonitor) Health() Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.health
+}
+
+// Changed returns a channel that is closed when the health next
+// changes.
+func (m *HealthMonitor) Changed() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.changed
+}
+
+// Check checks the health of the time immediately, reporting any
+// change to OnChange.
+func (m *HealthMonitor) Check() {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+	holdover := m.config.Fallback != nil && m.config.Fallback.Active() == Holdover
+	now := m.config.Clock.Now()
+
+	m.mu.Lock()
+	var reason string
+	switch {
+	case m.step != 0 && now.Sub(m.stepped) < m.config.Settle:
+		reason = fmt.Sprintf("wall clock stepped by %v", m.step)
+	case holdover:
+		reason = "no healthy time source"
+	}
+	if reason == m.health.Reason {
+		m.mu.Unlock()
+		return
+	}
+	m.health = Health{Healthy: reason == "", Reason: reason, Since: now}
+	close(m.changed)
+	m.changed = make(chan struct{})
+	health := m.health
+	m.mu.Unlock()
+
+	if m.config.OnChange != nil {
+		m.config.OnChange(health)
+	}
+}
+
+// observe records a change observed by the ChangeWatcher.
+func (m *HealthMonitor) observe(change Change) {
+	if change.Kind != ChangeWallClock || change.Step == 0 || abs(change.Step) < m.config.MaxStep {
+		return
+	}
+	m.mu.Lock()
+	m.stepped = m.config.Clock.Now()
+	m.step = change.Step
+	m.mu.Unlock()
+	m.Check()
+}
+
+func (m *HealthMonitor) loop(timer Timer) {
+	defer close(m.done)
+	defer timer.Stop()
+	if m.unsubscribe != nil {
+		defer m.unsubscribe()
+	}
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-timer.Chan():
+			m.Check()
+			timer.Reset(m.config.CheckInterval)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type healthMonitorSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&healthMonitorSuite{})
+
+func (s *healthMonitorSuite) TestValidate(c *gc.C) {
+	fc, err := clock.NewFallbackClock(clock.FallbackClockConfig{
+		Clock:         clock.WallClock,
+		Sources:       []clock.Source{clock.SourceFunc(func() (time.Time, error) { return time.Now(), nil })},
+		CheckInterval: time.Hour,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer stopFallback(c, fc)
+	valid := clock.HealthMonitorConfig{
+		Clock:         clock.WallClock,
+		Fallback:      fc,
+		CheckInterval: time.Second,
+	}
+	for _, test := range []struct {
+		modify func(*clock.HealthMonitorConfig)
+		err    string
+	}{{
+		func(config *clock.HealthMonitorConfig) { config.Clock = nil },
+		"nil Clock not valid",
+	}, {
+		func(config *clock.HealthMonitorConfig) { config.Fallback = nil },
+		"missing Changes and Fallback not valid",
+	}, {
+		func(config *clock.HealthMonitorConfig) { config.MaxStep = -1 },
+		"negative MaxStep not valid",
+	}, {
+		func(config *clock.HealthMonitorConfig) { config.Settle = -1 },
+		"negative Settle not valid",
+	}, {
+		func(config *clock.HealthMonitorConfig) { config.CheckInterval = 0 },
+		"non-positive CheckInterval not valid",
+	}} {
+		config := valid
+		test.modify(&config)
+		_, err := clock.NewHealthMonitor(config)
+		c.Assert(err, gc.ErrorMatches, "validating health monitor config: "+test.err)
+	}
+}
+
+func (s *healthMonitorSuite) TestWallClockStep(c *gc.C) {
+	reference := clocktesting.NewClock(time.Time{})
+	var mu sync.Mutex
+	wall := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	w, err := clock.NewChangeWatcher(clock.ChangeWatcherConfig{
+		Clock: reference,
+		Wall: clock.SourceFunc(func() (time.Time, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return wall, nil
+		}),
+		PollInterval:  time.Hour,
+		MinStep:       time.Second,
+		LocalTimePath: filepath.Join(c.MkDir(), "localtime"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer w.Wait()
+	defer w.Kill()
+	step := func(d time.Duration) {
+		mu.Lock()
+		wall = wall.Add(d)
+		mu.Unlock()
+		w.Check()
+	}
+
+	changes := make(chan clock.Health, 10)
+	m, err := clock.NewHealthMonitor(clock.HealthMonitorConfig{
+		Clock:         reference,
+		Changes:       w,
+		MaxStep:       time.Minute,
+		Settle:        10 * time.Second,
+		CheckInterval: time.Hour,
+		OnChange: func(health clock.Health) {
+			changes <- health
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer m.Wait()
+	defer m.Kill()
+	c.Assert(m.Health(), jc.DeepEquals, clock.Health{Healthy: true, Since: reference.Now()})
+	changed := m.Changed()
+
+	// Steps smaller than MaxStep are ignored.
+	step(30 * time.Second)
+	assertNoHealthChange(c, changes)
+
+	step(5 * time.Minute)
+	health := receiveHealth(c, changes)
+	c.Assert(health, jc.DeepEquals, clock.Health{
+		Reason: "wall clock stepped by 5m0s",
+		Since:  reference.Now(),
+	})
+	c.Assert(m.Health(), jc.DeepEquals, health)
+	select {
+	case <-changed:
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("Changed not closed")
+	}
+
+	// The time is reliable once Settle has passed since the step.
+	reference.Advance(5 * time.Second)
+	m.Check()
+	assertNoHealthChange(c, changes)
+	reference.Advance(5 * time.Second)
+	m.Check()
+	c.Assert(receiveHealth(c, changes), jc.DeepEquals, clock.Health{
+		Healthy: true,
+		Since:   reference.Now(),
+	})
+}
+
+func (s *healthMonitorSuite) TestFallbackHoldover(c *gc.C) {
+	testClock := coretesting.NewClock(time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC))
+	source := &fakeSource{clock: testClock}
+	fc, err := clock.NewFallbackClock(clock.FallbackClockConfig{
+		Clock:         testClock,
+		Sources:       []clock.Source{source},
+		CheckInterval: time.Hour,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer stopFallback(c, fc)
+
+	changes := make(chan clock.Health, 10)
+	m, err := clock.NewHealthMonitor(clock.HealthMonitorConfig{
+		Clock:         testClock,
+		Fallback:      fc,
+		CheckInterval: time.Hour,
+		OnChange: func(health clock.Health) {
+			changes <- health
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer m.Wait()
+	defer m.Kill()
+	c.Assert(m.Health().Healthy, jc.IsTrue)
+
+	source.setErr(errors.New("unreachable"))
+	fc.Check()
+	m.Check()
+	c.Assert(receiveHealth(c, changes).Reason, gc.Equals, "no healthy time source")
+
+	source.setErr(nil)
+	fc.Check()
+	m.Check()
+	c.Assert(receiveHealth(c, changes).Healthy, jc.IsTrue)
+}
+
+func receiveHealth(c *gc.C, changes <-chan clock.Health) clock.Health {
+	select {
+	case health := <-changes:
+		return health
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("health change not reported")
+	}
+	panic("unreachable")
+}
+
+func assertNoHealthChange(c *gc.C, changes <-chan clock.Health) {
+	select {
+	case health := <-changes:
+		c.Fatalf("unexpected health change %+v", health)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
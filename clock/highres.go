@@ -0,0 +1,182 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// HighResolutionClockConfig holds the configuration for a
+// HighResolutionClock.
+type HighResolutionClockConfig struct {
+	// Spin, if positive, is the final portion of each timer's wait
+	// that is spent polling the time, yielding the processor between
+	// polls, rather than sleeping. Spinning costs processor time, but
+	// allows timers to send within microseconds of their time, even
+	// where the system's timers are coarse.
+	Spin time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config HighResolutionClockConfig) Validate() error {
+	if config.Spin < 0 {
+		return errors.NotValidf("negative Spin")
+	}
+	return nil
+}
+
+// HighResolutionClock is a wall Clock whose timers request the finest
+// timing that the platform offers. The precision achievable, that is how
+// soon after its time a timer sends, depends on the platform:
+//
+//   - On Linux, the runtime's timers sleep with nanosecond timeouts,
+//     and typically send within tens of microseconds, subject to
+//     scheduling latency under load. The same is mostly true of the
+//     BSDs and macOS, though macOS may coalesce timers by up to a
+//     millisecond or so to save power.
+//   - On Windows, the system's timer period is about 15.6ms by default,
+//     and timers may send that much later than requested. While any of
+//     a HighResolutionClock's timers is waiting, the clock requests a
+//     period of 1ms with timeBeginPeriod, so that timers send within
+//     about a millisecond; the period is restored when no timers are
+//     waiting. Finer precision requires a Spin of a millisecond or two.
+//
+// On any platform, a Spin somewhat greater than the platform's
+// precision gives sub-millisecond precision, at the cost of the
+// processor time spent spinning.
+//
+// HighResolutionClock's methods are safe for concurrent use.
+type HighResolutionClock struct {
+	spin time.Duration
+}
+
+// NewHighResolutionClock returns a new HighResolutionClock with the
+// given configuration.
+func NewHighResolutionClock(config HighResolutionClockConfig) (*HighResolutionClock, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating high resolution clock config")
+	}
+	return &HighResolutionClock{spin: config.Spin}, nil
+}
+
+// Now is part of the Clock interface.
+func (c *HighResolutionClock) Now() time.Time {
+	return time.Now()
+}
+
+// After is part of the Clock interface.
+func (c *HighResolutionClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).Chan()
+}
+
+// NewTimer is part of the TimerClock interface.
+func (c *HighResolutionClock) NewTimer(d time.Duration) Timer {
+	t := &highResolutionTimer{
+		clock: c,
+		ch:    make(chan time.Time, 1),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start(d)
+	return t
+}
+
+// highResolutionTimer implements Timer for a HighResolutionClock,
+// sleeping with a runtime timer until the clock's Spin before its time,
+// and then polling the time until it has passed.
+type highResolutionTimer struct {
+	clock *HighResolutionClock
+	ch    chan time.Time
+
+	mu       sync.Mutex
+	active   bool
+	deadline time.Time
+	timer    *time.Timer
+
+	// generation is incremented each time the timer is started, so
+	// that a wait for an earlier start may recognise itself as stale.
+	generation uint64
+}
+
+// Chan is part of the Timer interface.
+func (t *highResolutionTimer) Chan() <-chan time.Time {
+	return t.ch
+}
+
+// Reset is part of the Timer interface.
+func (t *highResolutionTimer) Reset(d time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := t.stop()
+	t.start(d)
+	return active
+}
+
+// Stop is part of the Timer interface.
+func (t *highResolutionTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stop()
+}
+
+// start starts the timer, to send after the duration has
+// elapsed. start must be called with t.mu held, and the
+// timer stopped.
+func (t *highResolutionTimer) start(d time.Duration) {
+	acquireTimerPeriod()
+	t.active = true
+	t.deadline = time.Now().Add(d)
+	t.generation++
+	generation := t.generation
+	sleep := d - t.clock.spin
+	if sleep < 0 {
+		sleep = 0
+	}
+	t.timer = time.AfterFunc(sleep, func() { t.wait(generation) })
+}
+
+// stop stops the timer, discarding any unreceived send, and reports
+// whether it had been active. stop must be called with t.mu held.
+func (t *highResolutionTimer) stop() bool {
+	active := t.active
+	if active {
+		t.active = false
+		t.timer.Stop()
+		releaseTimerPeriod()
+	}
+	select {
+	case <-t.ch:
+	default:
+	}
+	return active
+}
+
+// wait polls the time until the timer's time has passed, and then
+// sends on the timer's channel, unless the timer has since been
+// stopped or restarted.
+func (t *highResolutionTimer) wait(generation uint64) {
+	for {
+		t.mu.Lock()
+		if !t.active || t.generation != generation {
+			t.mu.Unlock()
+			return
+		}
+		if now := time.Now(); !now.Before(t.deadline) {
+			t.active = false
+			releaseTimerPeriod()
+			select {
+			case t.ch <- now:
+			default:
+			}
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+		runtime.Gosched()
+	}
+}
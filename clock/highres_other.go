@@ -0,0 +1,13 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build !windows
+
+package clock
+
+// acquireTimerPeriod does nothing; the system's timers
+// need no configuration for fine resolution.
+func acquireTimerPeriod() {}
+
+// releaseTimerPeriod does nothing.
+func releaseTimerPeriod() {}
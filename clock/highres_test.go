@@ -0,0 +1,67 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type highResolutionClockSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&highResolutionClockSuite{})
+
+func (s *highResolutionClockSuite) TestValidate(c *gc.C) {
+	_, err := clock.NewHighResolutionClock(clock.HighResolutionClockConfig{Spin: -1})
+	c.Assert(err, gc.ErrorMatches, "validating high resolution clock config: negative Spin not valid")
+}
+
+func (s *highResolutionClockSuite) TestTimer(c *gc.C) {
+	for _, spin := range []time.Duration{0, 5 * time.Millisecond, time.Hour} {
+		c.Logf("spin %v", spin)
+		hc, err := clock.NewHighResolutionClock(clock.HighResolutionClockConfig{Spin: spin})
+		c.Assert(err, jc.ErrorIsNil)
+		t0 := hc.Now()
+		t := hc.NewTimer(10 * time.Millisecond)
+		select {
+		case t1 := <-t.Chan():
+			c.Assert(t1.Sub(t0) >= 10*time.Millisecond, jc.IsTrue)
+		case <-time.After(coretesting.LongWait):
+			c.Fatalf("timer did not send")
+		}
+		c.Assert(t.Stop(), jc.IsFalse)
+
+		c.Assert(t.Reset(time.Hour), jc.IsFalse)
+		c.Assert(t.Reset(time.Millisecond), jc.IsTrue)
+		select {
+		case <-t.Chan():
+		case <-time.After(coretesting.LongWait):
+			c.Fatalf("reset timer did not send")
+		}
+
+		t.Reset(10 * time.Millisecond)
+		c.Assert(t.Stop(), jc.IsTrue)
+		select {
+		case <-t.Chan():
+			c.Fatalf("stopped timer sent")
+		case <-time.After(coretesting.ShortWait):
+		}
+	}
+}
+
+func (s *highResolutionClockSuite) TestAfter(c *gc.C) {
+	hc, err := clock.NewHighResolutionClock(clock.HighResolutionClockConfig{Spin: time.Millisecond})
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case <-hc.After(time.Millisecond):
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("After did not send")
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"sync"
+	"syscall"
+)
+
+// timerPeriodMillis is the system timer period, in milliseconds,
+// requested while HighResolutionClock timers are waiting.
+const timerPeriodMillis = 1
+
+var (
+	winmm               = syscall.NewLazyDLL("winmm.dll")
+	procTimeBeginPeriod = winmm.NewProc("timeBeginPeriod")
+	procTimeEndPeriod   = winmm.NewProc("timeEndPeriod")
+
+	timerPeriodMu   sync.Mutex
+	timerPeriodRefs int
+)
+
+// acquireTimerPeriod requests the finer system timer period, if it
+// has not already been requested for another waiting timer.
+func acquireTimerPeriod() {
+	timerPeriodMu.Lock()
+	defer timerPeriodMu.Unlock()
+	if timerPeriodRefs == 0 && procTimeBeginPeriod.Find() == nil {
+		procTimeBeginPeriod.Call(timerPeriodMillis)
+	}
+	timerPeriodRefs++
+}
+
+// releaseTimerPeriod restores the default system timer
+// period, once no timers are waiting.
+func releaseTimerPeriod() {
+	timerPeriodMu.Lock()
+	defer timerPeriodMu.Unlock()
+	timerPeriodRefs--
+	if timerPeriodRefs == 0 && procTimeEndPeriod.Find() == nil {
+		procTimeEndPeriod.Call(timerPeriodMillis)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package replay provides a Recorder, which wraps a clock.Clock and logs
+// its traffic, and a Clock, which replays a log, so that timing bugs
+// observed in production may be reproduced locally, for example by
+// driving a Schedule with the recorded sequence of times.
+//
+// A log is a sequence of lines, each holding a JSON object: a header,
+// {"version":1}, followed by one Event per line, in order of sequence.
+// The format is stable: fields may be added to later versions, but the
+// meaning of existing fields will not change.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// FormatVersion is the version of the log format written by Recorder.
+const FormatVersion = 1
+
+// EventKind identifies the kind of an Event.
+type EventKind string
+
+const (
+	// EventNow records a call to Now, and the time returned.
+	EventNow EventKind = "now"
+
+	// EventAfter records a call to After, and its duration.
+	EventAfter EventKind = "after"
+
+	// EventFire records the time sent on a channel returned by After.
+	EventFire EventKind = "fire"
+)
+
+// Event is an interaction with a recorded clock.
+type Event struct {
+	// Seq is the event's position in the log, counting from 1.
+	Seq uint64
+
+	// Kind is the kind of the event.
+	Kind EventKind
+
+	// Timer identifies the call to After to which an EventAfter
+	// or EventFire event relates, counting from 1.
+	Timer uint64
+
+	// Time is the time returned by Now, or sent by a timer, in UTC.
+	Time time.Time
+
+	// Duration is the duration passed to After.
+	Duration time.Duration
+}
+
+// header is the first line of a log.
+type header struct {
+	Version int `json:"version"`
+}
+
+// event is the serialised form of an Event. Times are formatted as
+// RFC 3339 with nanoseconds, in UTC, and durations as nanoseconds.
+type event struct {
+	Seq      uint64    `json:"seq"`
+	Kind     EventKind `json:"kind"`
+	Timer    uint64    `json:"timer,omitempty"`
+	Time     string    `json:"time,omitempty"`
+	Duration int64     `json:"duration,omitempty"`
+}
+
+// MarshalJSON is part of the json.Marshaler interface.
+func (e Event) MarshalJSON() ([]byte, error) {
+	out := event{
+		Seq:      e.Seq,
+		Kind:     e.Kind,
+		Timer:    e.Timer,
+		Duration: int64(e.Duration),
+	}
+	if !e.Time.IsZero() {
+		out.Time = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON is part of the json.Unmarshaler interface.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var in event
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*e = Event{
+		Seq:      in.Seq,
+		Kind:     in.Kind,
+		Timer:    in.Timer,
+		Duration: time.Duration(in.Duration),
+	}
+	if in.Time != "" {
+		t, err := time.Parse(time.RFC3339Nano, in.Time)
+		if err != nil {
+			return errors.Annotatef(err, "parsing time of event %d", in.Seq)
+		}
+		e.Time = t.UTC()
+	}
+	return nil
+}
+
+// ReadEvents reads a log written by a Recorder, returning its events.
+// ReadEvents returns an error if the log's version is not supported,
+// or if any of its events are malformed or out of sequence.
+func ReadEvents(r io.Reader) ([]Event, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Annotate(err, "reading header")
+		}
+		return nil, errors.New("missing header")
+	}
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		return nil, errors.Annotate(err, "parsing header")
+	}
+	if h.Version != FormatVersion {
+		return nil, errors.NotSupportedf("log version %d", h.Version)
+	}
+	var events []Event
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, errors.Annotatef(err, "parsing event %d", len(events)+1)
+		}
+		if e.Seq != uint64(len(events)+1) {
+			return nil, errors.Errorf("event %d out of sequence, expected %d", e.Seq, len(events)+1)
+		}
+		switch e.Kind {
+		case EventNow, EventAfter, EventFire:
+		default:
+			return nil, errors.NotValidf("event %d kind %q", e.Seq, e.Kind)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Annotate(err, "reading events")
+	}
+	return events, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package replay
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// RecorderConfig holds the configuration for a Recorder.
+type RecorderConfig struct {
+	// Clock is the clock whose traffic is recorded.
+	Clock clock.Clock
+
+	// Writer is the writer, such as a file, to which the log is
+	// written. Each event is written with a single call to Write.
+	Writer io.Writer
+}
+
+// Validate checks that the config is valid.
+func (config RecorderConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Writer == nil {
+		return errors.NotValidf("nil Writer")
+	}
+	return nil
+}
+
+// Recorder is a clock.Clock that wraps another, logging each call to
+// Now and After, and each time sent on a channel returned by After, so
+// that they may be replayed with a Clock. See ReadEvents for the format.
+//
+// Recorder's methods are safe for concurrent use, and events are logged
+// in the order in which they occur; but the log can be replayed
+// faithfully only if the schedule, or other code, using the clock does
+// so from a single goroutine, since the interleaving of goroutines is
+// not recorded.
+type Recorder struct {
+	config RecorderConfig
+
+	mu     sync.Mutex
+	enc    *json.Encoder
+	seq    uint64
+	timers uint64
+	err    error
+}
+
+// NewRecorder returns a new Recorder with the given configuration,
+// having written the log's header.
+func NewRecorder(config RecorderConfig) (*Recorder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating recorder config")
+	}
+	r := &Recorder{
+		config: config,
+		enc:    json.NewEncoder(config.Writer),
+	}
+	if err := r.enc.Encode(header{Version: FormatVersion}); err != nil {
+		return nil, errors.Annotate(err, "writing header")
+	}
+	return r, nil
+}
+
+// Err returns the first error encountered writing the log, if any.
+// Once an error has occurred, no further events are logged, but the
+// Recorder continues to pass calls through to its Clock.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Now is part of the clock.Clock interface.
+func (r *Recorder) Now() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.config.Clock.Now()
+	r.record(Event{Kind: EventNow, Time: t})
+	return t
+}
+
+// After is part of the clock.Clock interface. A goroutine waits for the
+// underlying channel to send, so that the time sent may be logged.
+func (r *Recorder) After(d time.Duration) <-chan time.Time {
+	r.mu.Lock()
+	r.timers++
+	timer := r.timers
+	in := r.config.Clock.After(d)
+	r.record(Event{Kind: EventAfter, Timer: timer, Duration: d})
+	r.mu.Unlock()
+
+	out := make(chan time.Time, 1)
+	go func() {
+		t := <-in
+		r.mu.Lock()
+		r.record(Event{Kind: EventFire, Timer: timer, Time: t})
+		r.mu.Unlock()
+		out <- t
+	}()
+	return out
+}
+
+// record logs the event, assigning it the next sequence number.
+// record must be called with r.mu held.
+func (r *Recorder) record(e Event) {
+	if r.err != nil {
+		return
+	}
+	r.seq++
+	e.Seq = r.seq
+	if err := r.enc.Encode(e); err != nil {
+		r.err = errors.Annotatef(err, "writing event %d", e.Seq)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package replay_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/axw/juju-time/clock/replay"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type recorderSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&recorderSuite{})
+
+func (*recorderSuite) TestValidate(c *gc.C) {
+	_, err := replay.NewRecorder(replay.RecorderConfig{Writer: &bytes.Buffer{}})
+	c.Assert(err, gc.ErrorMatches, "validating recorder config: nil Clock not valid")
+	_, err = replay.NewRecorder(replay.RecorderConfig{Clock: clocktesting.NewClock(time.Time{})})
+	c.Assert(err, gc.ErrorMatches, "validating recorder config: nil Writer not valid")
+}
+
+func (*recorderSuite) TestRecord(c *gc.C) {
+	clock := clocktesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	var buf bytes.Buffer
+	r, err := replay.NewRecorder(replay.RecorderConfig{Clock: clock, Writer: &buf})
+	c.Assert(err, jc.ErrorIsNil)
+
+	r.Now()
+	ch := r.After(1500 * time.Millisecond)
+	clocktesting.ExpectTimer(c, clock, 1500*time.Millisecond)
+	clock.Advance(1500 * time.Millisecond)
+	select {
+	case <-ch:
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timer did not fire")
+	}
+	r.Now()
+	c.Assert(r.Err(), jc.ErrorIsNil)
+
+	// The serialisation is stable, so that logs recorded by
+	// one version may be replayed by another.
+	c.Assert(buf.String(), gc.Equals, `{"version":1}
+{"seq":1,"kind":"now","time":"2015-01-01T00:00:00Z"}
+{"seq":2,"kind":"after","timer":1,"duration":1500000000}
+{"seq":3,"kind":"fire","timer":1,"time":"2015-01-01T00:00:01.5Z"}
+{"seq":4,"kind":"now","time":"2015-01-01T00:00:01.5Z"}
+`)
+}
+
+func (*recorderSuite) TestWriteError(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	w := &failingWriter{}
+	r, err := replay.NewRecorder(replay.RecorderConfig{Clock: clock, Writer: w})
+	c.Assert(err, jc.ErrorIsNil)
+	w.err = errors.New("disk full")
+	c.Assert(r.Now(), gc.Equals, clock.Now())
+	c.Assert(r.Err(), gc.ErrorMatches, "writing event 1: disk full")
+
+	_, err = replay.NewRecorder(replay.RecorderConfig{Clock: clock, Writer: w})
+	c.Assert(err, gc.ErrorMatches, "writing header: disk full")
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package replay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Clock is a clock.Clock that replays a log written by a Recorder,
+// returning the recorded times from Now, and sending on the channels
+// returned by After as the recorded timers fired, in the recorded order.
+//
+// Each call to Now or After consumes the next event in the log, and any
+// timer events that follow it are then delivered, so that the code using
+// the Clock observes them before making its next call, as it did when
+// the log was recorded. A call that does not match the next event, such
+// as a call to After with a different duration, means that the code has
+// diverged from the recording: Err then reports the divergence, Now
+// returns the last replayed time, and no further timers fire.
+//
+// Clock's methods are safe for concurrent use, but the log is replayed
+// faithfully only when the clock is used from a single goroutine.
+type Clock struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	now    time.Time
+	timers map[uint64]chan time.Time
+	err    error
+}
+
+// New returns a new Clock that replays the given events, as returned
+// by ReadEvents.
+func New(events []Event) *Clock {
+	c := &Clock{
+		events: events,
+		timers: make(map[uint64]chan time.Time),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deliver()
+	return c
+}
+
+// Err returns the error describing how the code using the clock
+// diverged from the recording, or ran beyond its end, if it has.
+func (c *Clock) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Remaining returns the number of events not yet replayed.
+func (c *Clock) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.events) - c.next
+}
+
+// Now is part of the clock.Clock interface.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.expect(EventNow); ok {
+		c.now = e.Time
+		c.deliver()
+	}
+	return c.now
+}
+
+// After is part of the clock.Clock interface.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	e, ok := c.expect(EventAfter)
+	if !ok {
+		return ch
+	}
+	if e.Duration != d {
+		c.err = errors.Errorf("event %d: After(%v) called, After(%v) recorded", e.Seq, d, e.Duration)
+		return ch
+	}
+	c.timers[e.Timer] = ch
+	c.deliver()
+	return ch
+}
+
+// expect consumes the next event, if it is of the specified kind, and
+// records the divergence otherwise. expect must be called with c.mu held.
+func (c *Clock) expect(kind EventKind) (Event, bool) {
+	if c.err != nil {
+		return Event{}, false
+	}
+	if c.next == len(c.events) {
+		c.err = errors.Errorf("%s called after the last of %d events", kind, len(c.events))
+		return Event{}, false
+	}
+	e := c.events[c.next]
+	if e.Kind != kind {
+		c.err = errors.Errorf("event %d: %s called, %s recorded", e.Seq, kind, e.Kind)
+		return Event{}, false
+	}
+	c.next++
+	return e, true
+}
+
+// deliver sends the times of the timer events that follow the last
+// consumed event. deliver must be called with c.mu held.
+func (c *Clock) deliver() {
+	for c.err == nil && c.next < len(c.events) && c.events[c.next].Kind == EventFire {
+		e := c.events[c.next]
+		ch, ok := c.timers[e.Timer]
+		if !ok {
+			c.err = errors.Errorf("event %d: timer %d fired, but was not started", e.Seq, e.Timer)
+			return
+		}
+		delete(c.timers, e.Timer)
+		ch <- e.Time
+		c.now = e.Time
+		c.next++
+	}
+}
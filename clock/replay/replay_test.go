@@ -0,0 +1,126 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package replay_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/clock/replay"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type replaySuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&replaySuite{})
+
+func (*replaySuite) TestReplaySchedule(c *gc.C) {
+	testClock := clocktesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	var buf bytes.Buffer
+	r, err := replay.NewRecorder(replay.RecorderConfig{Clock: testClock, Writer: &buf})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Record a schedule's traffic as the clock advances.
+	run := func(clk clock.Clock, advance func(time.Duration)) []operation {
+		s := schedule.NewSchedule[string, operation](clk)
+		s.Add(operation{"k0", time.Second})
+		s.Add(operation{"k1", 2 * time.Second})
+		var ready []operation
+		for len(ready) < 2 {
+			next := s.Next()
+			advance(time.Second)
+			select {
+			case <-next:
+			case <-time.After(coretesting.LongWait):
+				c.Fatalf("schedule did not wake")
+			}
+			ready = append(ready, s.Ready(clk.Now())...)
+		}
+		return ready
+	}
+	recorded := run(r, func(d time.Duration) {
+		clocktesting.ExpectTimer(c, testClock, d)
+		testClock.Advance(d)
+	})
+	c.Assert(r.Err(), jc.ErrorIsNil)
+
+	// Replaying the log reproduces the schedule's behaviour,
+	// without the clock being advanced.
+	events, err := replay.ReadEvents(&buf)
+	c.Assert(err, jc.ErrorIsNil)
+	replayed := replay.New(events)
+	c.Assert(run(replayed, func(time.Duration) {}), jc.DeepEquals, recorded)
+	c.Assert(replayed.Err(), jc.ErrorIsNil)
+	c.Assert(replayed.Remaining(), gc.Equals, 0)
+}
+
+func (*replaySuite) TestDivergence(c *gc.C) {
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []replay.Event{
+		{Seq: 1, Kind: replay.EventNow, Time: t0},
+		{Seq: 2, Kind: replay.EventAfter, Timer: 1, Duration: time.Second},
+		{Seq: 3, Kind: replay.EventFire, Timer: 1, Time: t0.Add(time.Second)},
+	}
+
+	replayed := replay.New(events)
+	c.Assert(replayed.Now(), gc.Equals, t0)
+	replayed.After(2 * time.Second)
+	c.Assert(replayed.Err(), gc.ErrorMatches, `event 2: After\(2s\) called, After\(1s\) recorded`)
+	c.Assert(replayed.Now(), gc.Equals, t0)
+
+	replayed = replay.New(events)
+	replayed.After(time.Second)
+	c.Assert(replayed.Err(), gc.ErrorMatches, "event 1: after called, now recorded")
+
+	replayed = replay.New(events[:1])
+	replayed.Now()
+	replayed.Now()
+	c.Assert(replayed.Err(), gc.ErrorMatches, "now called after the last of 1 events")
+}
+
+func (*replaySuite) TestReadEventsErrors(c *gc.C) {
+	for _, test := range []struct {
+		log string
+		err string
+	}{{
+		log: "",
+		err: "missing header",
+	}, {
+		log: `{"version":2}`,
+		err: "log version 2 not supported",
+	}, {
+		log: "{\"version\":1}\n{\"seq\":2,\"kind\":\"now\"}",
+		err: "event 2 out of sequence, expected 1",
+	}, {
+		log: "{\"version\":1}\n{\"seq\":1,\"kind\":\"sleep\"}",
+		err: `event 1 kind "sleep" not valid`,
+	}, {
+		log: "{\"version\":1}\n{\"seq\":1,\"kind\":\"now\",\"time\":\"yesterday\"}",
+		err: "parsing event 1: parsing time of event 1: .*",
+	}} {
+		_, err := replay.ReadEvents(strings.NewReader(test.log))
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+type operation struct {
+	key   string
+	delay time.Duration
+}
+
+func (o operation) Key() string {
+	return o.key
+}
+
+func (o operation) Delay() time.Duration {
+	return o.delay
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"time"
+)
+
+// SleepUntilSignalled waits for the duration to elapse, as measured by c,
+// or for a value to be received on wake, whichever happens first. It
+// returns true if the full duration elapsed, or false if it was woken
+// early. A closed wake channel wakes the sleeper immediately, and a nil
+// wake channel never does.
+//
+// Workers that sleep between cycles may use SleepUntilSignalled so that
+// they can be woken when new work arrives; wake should be buffered, so
+// that a signal sent while the worker is not sleeping is not lost.
+func SleepUntilSignalled(c Clock, d time.Duration, wake <-chan struct{}) bool {
+	select {
+	case <-wake:
+		return false
+	default:
+	}
+	if d <= 0 {
+		return true
+	}
+	t := NewTimer(c, d)
+	defer t.Stop()
+	select {
+	case <-t.Chan():
+		return true
+	case <-wake:
+		return false
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type sleepSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&sleepSuite{})
+
+func (s *sleepSuite) sleep(clk clock.Clock, d time.Duration, wake <-chan struct{}) <-chan bool {
+	done := make(chan bool, 1)
+	go func() {
+		done <- clock.SleepUntilSignalled(clk, d, wake)
+	}()
+	return done
+}
+
+func (s *sleepSuite) TestSleepsFully(c *gc.C) {
+	clk := clocktesting.NewClock(time.Time{})
+	h := clocktesting.NewHarness(clk)
+	done := s.sleep(clk, time.Second, make(chan struct{}))
+	h.Settle(c)
+	clocktesting.ExpectTimer(c, clk, time.Second)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(<-done, jc.IsTrue)
+	h.AssertNoLeaks(c)
+}
+
+func (s *sleepSuite) TestWoken(c *gc.C) {
+	clk := clocktesting.NewClock(time.Time{})
+	h := clocktesting.NewHarness(clk)
+	wake := make(chan struct{}, 1)
+	done := s.sleep(clk, time.Second, wake)
+	h.Settle(c)
+	wake <- struct{}{}
+	select {
+	case slept := <-done:
+		c.Assert(slept, jc.IsFalse)
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("sleep not woken")
+	}
+	// The timer is stopped when the sleeper is woken.
+	clocktesting.ExpectNoTimers(c, clk)
+	h.AssertNoLeaks(c)
+}
+
+func (s *sleepSuite) TestPendingSignal(c *gc.C) {
+	clk := clocktesting.NewClock(time.Time{})
+	wake := make(chan struct{}, 1)
+	wake <- struct{}{}
+	c.Assert(clock.SleepUntilSignalled(clk, time.Second, wake), jc.IsFalse)
+	c.Assert(clock.SleepUntilSignalled(clk, 0, wake), jc.IsTrue)
+
+	closed := make(chan struct{})
+	close(closed)
+	c.Assert(clock.SleepUntilSignalled(clk, time.Second, closed), jc.IsFalse)
+	c.Assert(clock.SleepUntilSignalled(clk, 0, closed), jc.IsFalse)
+	clocktesting.ExpectNoTimers(c, clk)
+}
+
+func (s *sleepSuite) TestNonPositiveDuration(c *gc.C) {
+	clk := clocktesting.NewClock(time.Time{})
+	c.Assert(clock.SleepUntilSignalled(clk, 0, nil), jc.IsTrue)
+	c.Assert(clock.SleepUntilSignalled(clk, -time.Second, nil), jc.IsTrue)
+	clocktesting.ExpectNoTimers(c, clk)
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// AfterFunc is part of the clock.AfterFuncClock interface. The returned
+// Timer is a *FuncTimer, which records whether its function was called
+// or cancelled.
+//
+// As with time.AfterFunc, the function is called in its own goroutine.
+// The call is queued by Advance, with the clock's lock held, so once
+// Advance has returned, stopping the timer returns false, even if the
+// function has not yet started; a Harness settles the goroutine along
+// with those it wakes.
+func (c *Clock) AfterFunc(d time.Duration, f func()) clock.Timer {
+	t := &FuncTimer{clock: c, f: f}
+	c.mu.Lock()
+	c.funcTimers = append(c.funcTimers, t)
+	c.mu.Unlock()
+	t.Reset(d)
+	return t
+}
+
+// FuncTimers returns the timers created by AfterFunc, in the order
+// that they were created.
+func (c *Clock) FuncTimers() []*FuncTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*FuncTimer(nil), c.funcTimers...)
+}
+
+// FuncTimer is a clock.Timer, created by Clock.AfterFunc, that calls
+// a function when its time is reached.
+type FuncTimer struct {
+	clock *Clock
+	f     func()
+
+	// The following fields are protected by clock.mu.
+	alarm *alarm
+	// fired reports whether the function has been queued since
+	// the timer was last reset.
+	fired bool
+	stats FuncTimerStats
+}
+
+// FuncTimerStats records what happened to a FuncTimer's function,
+// so that tests may assert whether stopping the timer raced with the
+// function being called.
+type FuncTimerStats struct {
+	// Fired is the number of times the function was queued
+	// to be called.
+	Fired int
+
+	// Returned is the number of calls to the function that
+	// have returned.
+	Returned int
+
+	// Cancelled is the number of calls to Stop that prevented
+	// a pending call to the function, and so returned true.
+	Cancelled int
+
+	// StoppedLate is the number of calls to Stop that were made
+	// after the function had been queued, and so returned false.
+	StoppedLate int
+}
+
+// Stats returns the timer's statistics.
+func (t *FuncTimer) Stats() FuncTimerStats {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.stats
+}
+
+// Pending reports whether a call to the timer's function is pending.
+func (t *FuncTimer) Pending() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.alarm != nil
+}
+
+// Chan is part of the clock.Timer interface. It returns nil, as
+// a FuncTimer calls its function rather than sending.
+func (t *FuncTimer) Chan() <-chan time.Time {
+	return nil
+}
+
+// Reset is part of the clock.Timer interface.
+func (t *FuncTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := t.alarm != nil && c.remove(t.alarm)
+	t.fired = false
+	t.alarm = &alarm{time: c.now.Add(d), fn: t}
+	c.add(t.alarm)
+	return active
+}
+
+// Stop is part of the clock.Timer interface.
+func (t *FuncTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := t.alarm != nil && c.remove(t.alarm)
+	t.alarm = nil
+	switch {
+	case active:
+		t.stats.Cancelled++
+	case t.fired:
+		t.stats.StoppedLate++
+	}
+	return active
+}
+
+// fire queues the call to the timer's function. fire must be called
+// with clock.mu held.
+func (t *FuncTimer) fire() {
+	t.alarm = nil
+	t.fired = true
+	t.stats.Fired++
+	go func() {
+		t.f()
+		t.clock.mu.Lock()
+		t.stats.Returned++
+		t.clock.mu.Unlock()
+	}()
+}
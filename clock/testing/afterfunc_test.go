@@ -0,0 +1,87 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type afterFuncSuite struct{}
+
+var _ = gc.Suite(&afterFuncSuite{})
+
+func (*afterFuncSuite) TestCancelled(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	t := clock.AfterFunc(time.Second, func() {
+		c.Errorf("cancelled function called")
+	}).(*clocktesting.FuncTimer)
+	c.Assert(t.Chan(), gc.IsNil)
+	c.Assert(t.Pending(), jc.IsTrue)
+	clocktesting.ExpectTimer(c, clock, time.Second)
+
+	c.Assert(t.Stop(), jc.IsTrue)
+	c.Assert(t.Stop(), jc.IsFalse)
+	c.Assert(t.Pending(), jc.IsFalse)
+	clocktesting.ExpectNoTimers(c, clock)
+	clock.Advance(time.Second)
+	c.Assert(t.Stats(), jc.DeepEquals, clocktesting.FuncTimerStats{Cancelled: 1})
+}
+
+func (*afterFuncSuite) TestStoppedLate(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	h := clocktesting.NewHarness(clock)
+	release := make(chan struct{})
+	t := clock.AfterFunc(time.Second, func() {
+		<-release
+	}).(*clocktesting.FuncTimer)
+
+	// Once Advance has queued the call, Stop cannot cancel it,
+	// even though the function has not returned.
+	clock.Advance(time.Second)
+	c.Assert(t.Stop(), jc.IsFalse)
+	c.Assert(t.Stats(), jc.DeepEquals, clocktesting.FuncTimerStats{
+		Fired:       1,
+		StoppedLate: 1,
+	})
+
+	close(release)
+	h.Settle(c)
+	c.Assert(t.Stats(), jc.DeepEquals, clocktesting.FuncTimerStats{
+		Fired:       1,
+		Returned:    1,
+		StoppedLate: 1,
+	})
+	h.AssertNoLeaks(c)
+}
+
+func (*afterFuncSuite) TestReset(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	h := clocktesting.NewHarness(clock)
+	var calls counter
+	t := clock.AfterFunc(time.Second, calls.inc)
+	c.Assert(t.Reset(2*time.Second), jc.IsTrue)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(calls.get(), gc.Equals, 0)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(calls.get(), gc.Equals, 1)
+
+	// Resetting a fired timer schedules another call, and
+	// a later Stop cancels it, rather than stopping late.
+	c.Assert(t.Reset(time.Second), jc.IsFalse)
+	c.Assert(t.Stop(), jc.IsTrue)
+	c.Assert(t.Reset(0), jc.IsFalse)
+	h.Settle(c)
+	c.Assert(calls.get(), gc.Equals, 2)
+	c.Assert(clock.FuncTimers(), jc.DeepEquals, []*clocktesting.FuncTimer{t.(*clocktesting.FuncTimer)})
+	c.Assert(t.(*clocktesting.FuncTimer).Stats(), jc.DeepEquals, clocktesting.FuncTimerStats{
+		Fired:     2,
+		Returned:  2,
+		Cancelled: 1,
+	})
+	h.AssertNoLeaks(c)
+}
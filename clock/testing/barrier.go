@@ -0,0 +1,130 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"sync"
+	"time"
+)
+
+// Barrier holds a Clock at a point in virtual time until it is
+// released, so that several goroutines driven by the clock may be
+// coordinated in lock-step: each registers a barrier for the time at
+// which it must act, waits for the barrier to be reached, acts, and
+// then releases it, and the clock advances past that time only once
+// all have done so.
+type Barrier struct {
+	clock    *Clock
+	time     time.Time
+	reached  chan struct{}
+	released bool
+}
+
+// RegisterAt registers a barrier at the specified time: the clock will
+// not advance past the time until the barrier is released. If the time
+// has already been reached, the clock will not advance at all until
+// the barrier is released.
+//
+// A call to Advance that would advance the clock past an unreleased
+// barrier advances it only to the barrier's time, firing the alarms
+// whose times are reached, and then waits, without holding the clock's
+// lock, for the barrier to be released before continuing, so that the
+// goroutines it wakes may use the clock meanwhile. RandomClock's Now
+// advances the clock only up to the barrier's time, without waiting.
+// A barrier that is never released blocks Advance forever.
+func (c *Clock) RegisterAt(t time.Time) *Barrier {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := &Barrier{clock: c, time: t, reached: make(chan struct{})}
+	if c.released == nil {
+		c.released = sync.NewCond(&c.mu)
+	}
+	c.barriers = append(c.barriers, b)
+	c.reachBarriers()
+	return b
+}
+
+// Barriers returns the number of unreleased barriers.
+func (c *Clock) Barriers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.barriers)
+}
+
+// Time returns the time at which the barrier holds the clock.
+func (b *Barrier) Time() time.Time {
+	return b.time
+}
+
+// Reached returns a channel that is closed when the clock reaches the
+// barrier's time.
+func (b *Barrier) Reached() <-chan struct{} {
+	return b.reached
+}
+
+// Release releases the barrier, allowing the clock to advance past its
+// time once any other barriers at or before that time are released.
+// Release may be called more than once.
+func (b *Barrier) Release() {
+	c := b.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b.released {
+		return
+	}
+	b.released = true
+	for i, pending := range c.barriers {
+		if pending == b {
+			c.barriers = append(c.barriers[:i], c.barriers[i+1:]...)
+			break
+		}
+	}
+	c.released.Broadcast()
+}
+
+// advanceUntilBarrier is like Advance, except that it advances the
+// clock only up to the time of the earliest unreleased barrier, rather
+// than waiting for the barrier to be released.
+func (c *Clock) advanceUntilBarrier(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setNow(c.barrierLimit(c.now.Add(d)))
+}
+
+// barrierLimit returns the time to which the clock may be advanced,
+// toward the specified end: the earliest time of the unreleased
+// barriers before the end, or the clock's time, if it is later, or
+// the end, if there are none. Barriers do not hold back a clock that
+// is set back, or not moved. barrierLimit must be called with c.mu
+// held.
+func (c *Clock) barrierLimit(end time.Time) time.Time {
+	if !end.After(c.now) {
+		return end
+	}
+	limit := end
+	for _, b := range c.barriers {
+		if b.time.Before(limit) {
+			limit = b.time
+		}
+	}
+	if limit.Before(c.now) {
+		limit = c.now
+	}
+	return limit
+}
+
+// reachBarriers closes the Reached channels of the barriers whose
+// times have been reached. reachBarriers must be called with c.mu held.
+func (c *Clock) reachBarriers() {
+	for _, b := range c.barriers {
+		if b.time.After(c.now) {
+			continue
+		}
+		select {
+		case <-b.reached:
+		default:
+			close(b.reached)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"sync"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type barrierSuite struct{}
+
+var _ = gc.Suite(&barrierSuite{})
+
+// advance advances the clock in a goroutine, and returns a
+// channel that is closed once Advance returns.
+func advance(clock *clocktesting.Clock, d time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		clock.Advance(d)
+	}()
+	return done
+}
+
+func waitClosed(c *gc.C, ch <-chan struct{}, what string) {
+	select {
+	case <-ch:
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func assertNotClosed(c *gc.C, ch <-chan struct{}, what string) {
+	select {
+	case <-ch:
+		c.Fatalf("unexpected %s", what)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+func (*barrierSuite) TestAdvanceHeldAtBarrier(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	b := clock.RegisterAt(t0.Add(time.Minute))
+	c.Assert(b.Time(), gc.Equals, t0.Add(time.Minute))
+	c.Assert(clock.Barriers(), gc.Equals, 1)
+	before := clock.After(30 * time.Second)
+	after := clock.After(90 * time.Second)
+	assertNotClosed(c, b.Reached(), "barrier reached")
+
+	// The clock advances to the barrier, firing the
+	// alarms before it, and waits there until the
+	// barrier is released.
+	done := advance(clock, 2*time.Minute)
+	waitClosed(c, b.Reached(), "barrier to be reached")
+	c.Assert(clock.Now(), gc.Equals, t0.Add(time.Minute))
+	c.Assert(<-before, gc.Equals, t0.Add(time.Minute))
+	assertNotClosed(c, done, "advance")
+	c.Assert(after, gc.HasLen, 0)
+
+	b.Release()
+	waitClosed(c, done, "advance")
+	c.Assert(clock.Now(), gc.Equals, t0.Add(2*time.Minute))
+	c.Assert(<-after, gc.Equals, t0.Add(2*time.Minute))
+	c.Assert(clock.Barriers(), gc.Equals, 0)
+
+	// Releasing again has no effect.
+	b.Release()
+	c.Assert(clock.Barriers(), gc.Equals, 0)
+}
+
+func (*barrierSuite) TestAdvanceToBarrier(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	b := clock.RegisterAt(t0.Add(time.Minute))
+	defer b.Release()
+
+	// The clock may advance up to, but not past, the barrier.
+	clock.Advance(time.Minute)
+	c.Assert(clock.Now(), gc.Equals, t0.Add(time.Minute))
+	waitClosed(c, b.Reached(), "barrier to be reached")
+
+	// Nor is setting the clock back held.
+	clock.Advance(-time.Minute)
+	c.Assert(clock.Now(), gc.Equals, t0)
+}
+
+func (*barrierSuite) TestRegisterReached(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	b := clock.RegisterAt(t0.Add(-time.Minute))
+	waitClosed(c, b.Reached(), "barrier to be reached")
+
+	// A barrier whose time has been reached
+	// holds the clock at its current time.
+	done := advance(clock, time.Minute)
+	assertNotClosed(c, done, "advance")
+	c.Assert(clock.Now(), gc.Equals, t0)
+	b.Release()
+	waitClosed(c, done, "advance")
+	c.Assert(clock.Now(), gc.Equals, t0.Add(time.Minute))
+}
+
+func (*barrierSuite) TestLockStep(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	const steps = 3
+	actors := []string{"a", "b", "c"}
+
+	// Each actor acts at each minute, and registers its
+	// barrier for the next minute before releasing the
+	// current one, so that the clock does not pass the
+	// next minute before it has acted.
+	var mu sync.Mutex
+	acted := make(map[string][]time.Time)
+	var wg sync.WaitGroup
+	for _, name := range actors {
+		b := clock.RegisterAt(t0.Add(time.Minute))
+		wg.Add(1)
+		go func(name string, b *clocktesting.Barrier) {
+			defer wg.Done()
+			for i := 1; i <= steps; i++ {
+				<-b.Reached()
+				mu.Lock()
+				acted[name] = append(acted[name], clock.Now())
+				mu.Unlock()
+				next := b
+				if i < steps {
+					next = clock.RegisterAt(t0.Add(time.Duration(i+1) * time.Minute))
+				}
+				b.Release()
+				b = next
+			}
+		}(name, b)
+	}
+
+	clock.Advance(time.Hour)
+	wg.Wait()
+	c.Assert(clock.Now(), gc.Equals, t0.Add(time.Hour))
+	expect := []time.Time{t0.Add(time.Minute), t0.Add(2 * time.Minute), t0.Add(3 * time.Minute)}
+	for _, name := range actors {
+		c.Check(acted[name], jc.DeepEquals, expect, gc.Commentf("actor %s", name))
+	}
+}
+
+func (*barrierSuite) TestRandomClock(c *gc.C) {
+	clock := clocktesting.NewRandomClock(t0, 42, time.Minute)
+	b := clock.RegisterAt(t0.Add(time.Second))
+
+	// Observing the clock does not advance it past the
+	// barrier, nor wait for it to be released.
+	for i := 0; i < 100; i++ {
+		c.Assert(clock.Now().After(t0.Add(time.Second)), jc.IsFalse)
+	}
+	waitClosed(c, b.Reached(), "barrier to be reached")
+	b.Release()
+	c.Assert(clock.Now().After(t0.Add(time.Second)), jc.IsTrue)
+}
@@ -0,0 +1,203 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package testing provides a test clock, and a harness for testing code
+// that waits on it, which settles the goroutines woken by advancing the
+// clock before the test proceeds, and detects leaked goroutines. The
+// Expect functions assert on the clock's pending timers. To exercise
+// chains of timers, each armed by the previous firing, advance the clock
+// in steps with AdvanceAndYield or Harness.AdvanceInSteps. RandomClock
+// also advances when observed, for fuzz and property tests. Barriers
+// hold the clock at a time until released, so that several goroutines
+// driven by it may be coordinated in lock-step.
+package testing
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// Clock is a clock.TimerClock whose time is advanced manually.
+//
+// Clock's methods are safe for concurrent use.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	alarms []*alarm
+	// changes is incremented each time an alarm is added or
+	// removed, so that a Harness can tell when goroutines are
+	// still starting or stopping waits.
+	changes uint64
+	// funcTimers holds the timers created by AfterFunc.
+	funcTimers []*FuncTimer
+	// barriers holds the unreleased barriers, and released,
+	// if non-nil, is broadcast when one is released.
+	barriers []*Barrier
+	released *sync.Cond
+}
+
+type alarm struct {
+	time time.Time
+	ch   chan time.Time
+	// fn, if non-nil, is the FuncTimer whose function is
+	// called when the alarm's time is reached, instead of
+	// sending on ch.
+	fn *FuncTimer
+}
+
+// NewClock returns a new Clock set to the specified time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now is part of the clock.Clock interface.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After is part of the clock.Clock interface.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(&alarm{time: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// NewTimer is part of the clock.TimerClock interface.
+func (c *Clock) NewTimer(d time.Duration) clock.Timer {
+	t := &timer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance advances the clock by the specified duration, sending
+// the time on the channels of alarms whose time is reached, in
+// order of their times. If an unreleased barrier's time is before
+// the end of the advance, Advance advances the clock to the
+// barrier's time and then waits until it is released; see
+// RegisterAt.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for {
+		limit := c.barrierLimit(end)
+		c.setNow(limit)
+		if limit.Equal(end) {
+			return
+		}
+		c.released.Wait()
+	}
+}
+
+// setNow sets the clock's time, firing the alarms whose time is
+// reached, and signalling the barriers whose time is reached.
+// setNow must be called with c.mu held.
+func (c *Clock) setNow(now time.Time) {
+	c.now = now
+	c.reachBarriers()
+	n := 0
+	for ; n < len(c.alarms) && !c.alarms[n].time.After(c.now); n++ {
+		c.fire(c.alarms[n])
+	}
+	if n > 0 {
+		c.alarms = append(c.alarms[:0], c.alarms[n:]...)
+		c.changes++
+	}
+}
+
+// Alarms returns the number of pending alarms: calls to After, and
+// active timers, whose time has not been reached.
+func (c *Clock) Alarms() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.alarms)
+}
+
+func (c *Clock) changeCount() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changes
+}
+
+// add adds the alarm, or sends on its channel immediately if its time
+// has been reached. add must be called with c.mu held.
+func (c *Clock) add(a *alarm) {
+	c.changes++
+	if !a.time.After(c.now) {
+		c.fire(a)
+		return
+	}
+	i := sort.Search(len(c.alarms), func(i int) bool {
+		return a.time.Before(c.alarms[i].time)
+	})
+	c.alarms = append(c.alarms, nil)
+	copy(c.alarms[i+1:], c.alarms[i:])
+	c.alarms[i] = a
+}
+
+// fire sends the current time on the alarm's channel, or queues the
+// call to its FuncTimer's function. fire must be called with c.mu held.
+func (c *Clock) fire(a *alarm) {
+	if a.fn == nil {
+		a.ch <- c.now
+		return
+	}
+	a.fn.fire()
+}
+
+// remove removes the alarm, reporting whether it was pending.
+// remove must be called with c.mu held.
+func (c *Clock) remove(a *alarm) bool {
+	for i, pending := range c.alarms {
+		if pending == a {
+			c.alarms = append(c.alarms[:i], c.alarms[i+1:]...)
+			c.changes++
+			return true
+		}
+	}
+	return false
+}
+
+// timer is a clock.Timer driven by a Clock.
+type timer struct {
+	clock *Clock
+	ch    chan time.Time
+	alarm *alarm
+}
+
+// Chan is part of the clock.Timer interface.
+func (t *timer) Chan() <-chan time.Time {
+	return t.ch
+}
+
+// Reset is part of the clock.Timer interface.
+func (t *timer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := t.alarm != nil && c.remove(t.alarm)
+	select {
+	case <-t.ch:
+	default:
+	}
+	t.alarm = &alarm{time: c.now.Add(d), ch: t.ch}
+	c.add(t.alarm)
+	return active
+}
+
+// Stop is part of the clock.Timer interface.
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := t.alarm != nil && c.remove(t.alarm)
+	t.alarm = nil
+	return active
+}
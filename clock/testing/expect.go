@@ -0,0 +1,68 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"time"
+)
+
+// T is the interface through which the expectation helpers report
+// failures. Both *gocheck.C and *testing.T implement T.
+type T interface {
+	Fatalf(format string, args ...interface{})
+}
+
+// helper marks the calling function as a test helper, if t supports
+// it, so that failures are reported at the caller's line.
+func helper(t T) {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+}
+
+// ExpectTimer fails the test unless the clock's earliest pending alarm,
+// from a call to After or an active timer, is due d after the clock's
+// current time.
+func ExpectTimer(t T, clock *Clock, d time.Duration) {
+	helper(t)
+	clock.mu.Lock()
+	now := clock.now
+	var next time.Time
+	found := len(clock.alarms) > 0
+	if found {
+		next = clock.alarms[0].time
+	}
+	clock.mu.Unlock()
+	if !found {
+		t.Fatalf("expected timer in %v, found no timers", d)
+		return
+	}
+	if got := next.Sub(now); got != d {
+		t.Fatalf("expected timer in %v, found timer in %v", d, got)
+	}
+}
+
+// ExpectNoTimers fails the test if the clock has any pending alarms.
+func ExpectNoTimers(t T, clock *Clock) {
+	helper(t)
+	if n := clock.Alarms(); n > 0 {
+		t.Fatalf("expected no timers, found %d", n)
+	}
+}
+
+// ExpectSignalled fails the test unless a value may be received from
+// ch immediately, such as from a timer whose time has been reached. The
+// value is received and discarded.
+func ExpectSignalled(t T, ch <-chan time.Time) {
+	helper(t)
+	if ch == nil {
+		t.Fatalf("expected signal, found nil channel")
+		return
+	}
+	select {
+	case <-ch:
+	default:
+		t.Fatalf("expected signal, found none")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"fmt"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type expectSuite struct{}
+
+var _ = gc.Suite(&expectSuite{})
+
+// recorder is a clocktesting.T that records failures.
+type recorder struct {
+	failures []string
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (*expectSuite) TestExpectTimer(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	var r recorder
+	clocktesting.ExpectTimer(&r, clock, time.Second)
+	c.Assert(r.failures, jc.DeepEquals, []string{"expected timer in 1s, found no timers"})
+
+	clock.After(2 * time.Second)
+	timer := clock.NewTimer(time.Second)
+	r.failures = nil
+	clocktesting.ExpectTimer(&r, clock, time.Second)
+	clocktesting.ExpectTimer(&r, clock, 2*time.Second)
+	c.Assert(r.failures, jc.DeepEquals, []string{"expected timer in 2s, found timer in 1s"})
+
+	timer.Stop()
+	clock.Advance(time.Second)
+	clocktesting.ExpectTimer(c, clock, time.Second)
+}
+
+func (*expectSuite) TestExpectNoTimers(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	clocktesting.ExpectNoTimers(c, clock)
+
+	clock.After(time.Second)
+	clock.After(time.Minute)
+	var r recorder
+	clocktesting.ExpectNoTimers(&r, clock)
+	c.Assert(r.failures, jc.DeepEquals, []string{"expected no timers, found 2"})
+
+	clock.Advance(time.Minute)
+	clocktesting.ExpectNoTimers(c, clock)
+}
+
+func (*expectSuite) TestExpectSignalled(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	ch := clock.After(time.Second)
+	var r recorder
+	clocktesting.ExpectSignalled(&r, ch)
+	clocktesting.ExpectSignalled(&r, nil)
+	c.Assert(r.failures, jc.DeepEquals, []string{
+		"expected signal, found none",
+		"expected signal, found nil channel",
+	})
+
+	clock.Advance(time.Second)
+	clocktesting.ExpectSignalled(c, ch)
+}
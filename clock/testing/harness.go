@@ -0,0 +1,209 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"bytes"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	gc "gopkg.in/check.v1"
+)
+
+const (
+	// pollInterval is the interval at which a Harness
+	// inspects the goroutines while settling.
+	pollInterval = time.Millisecond
+
+	// settledPolls is the number of consecutive polls for which the
+	// goroutines must be blocked, and the clock's alarms unchanged,
+	// for the goroutines to be considered settled.
+	settledPolls = 3
+
+	// DefaultTimeout is the default time for which a Harness waits
+	// for goroutines to settle, or to exit.
+	DefaultTimeout = 10 * time.Second
+)
+
+// Harness drives a Clock, and checks the goroutines started by the code
+// under test: after advancing the clock, it waits for the goroutines
+// woken to run until they block again, so that tests may make exact
+// assertions about their effects without sleeping; and it reports the
+// goroutines that are still running when the code under test should
+// have stopped them.
+//
+// A Harness considers all goroutines other than those running when it
+// was constructed, and other than the calling goroutine, to belong to
+// the code under test. Goroutines are considered blocked when they are
+// waiting on a channel, a lock or a sleep; a goroutine blocked on a
+// system call, or spinning, prevents the goroutines from settling.
+type Harness struct {
+	Clock *Clock
+
+	// Timeout is the time for which the harness waits for
+	// goroutines to settle, or to exit. It is initially
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	baseline map[string]bool
+}
+
+// NewHarness returns a new Harness driving the given clock. NewHarness
+// should be called before the code under test starts its goroutines.
+func NewHarness(clock *Clock) *Harness {
+	baseline := make(map[string]bool)
+	for _, g := range goroutines() {
+		baseline[g.id] = true
+	}
+	return &Harness{
+		Clock:    clock,
+		Timeout:  DefaultTimeout,
+		baseline: baseline,
+	}
+}
+
+// AdvanceAndSettle advances the clock by the specified duration, and
+// then waits for the goroutines to settle, as Settle does.
+func (h *Harness) AdvanceAndSettle(c *gc.C, d time.Duration) {
+	h.Clock.Advance(d)
+	h.Settle(c)
+}
+
+// Settle waits until the goroutines under test are all blocked, and have
+// neither added nor removed any of the clock's alarms, for several
+// consecutive polls. Settle fails the test if the goroutines do not
+// settle within the harness's timeout.
+func (h *Harness) Settle(c *gc.C) {
+	deadline := time.Now().Add(h.Timeout)
+	changes := h.Clock.changeCount()
+	settled := 0
+	for settled < settledPolls {
+		time.Sleep(pollInterval)
+		busy := h.busy()
+		next := h.Clock.changeCount()
+		if len(busy) == 0 && next == changes {
+			settled++
+			continue
+		}
+		settled = 0
+		changes = next
+		if time.Now().After(deadline) {
+			c.Fatalf("goroutines did not settle within %v:\n\n%s", h.Timeout, strings.Join(busy, "\n\n"))
+		}
+	}
+}
+
+// Leaked returns the stacks of the goroutines under test that
+// are still running, whether or not they are blocked.
+func (h *Harness) Leaked() []string {
+	var leaked []string
+	for _, g := range h.goroutines() {
+		leaked = append(leaked, g.stack)
+	}
+	return leaked
+}
+
+// AssertNoLeaks waits for the goroutines under test to exit, and fails
+// the test if any are still running after the harness's timeout.
+func (h *Harness) AssertNoLeaks(c *gc.C) {
+	deadline := time.Now().Add(h.Timeout)
+	for {
+		leaked := h.Leaked()
+		if len(leaked) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			c.Fatalf("%d goroutine(s) leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// busy returns the stacks of the goroutines under test
+// that are not blocked.
+func (h *Harness) busy() []string {
+	var busy []string
+	for _, g := range h.goroutines() {
+		if !g.blocked() {
+			busy = append(busy, g.stack)
+		}
+	}
+	return busy
+}
+
+// goroutines returns the goroutines under test: those not running when
+// the harness was constructed, other than the calling goroutine.
+func (h *Harness) goroutines() []goroutine {
+	all := goroutines()
+	var result []goroutine
+	for _, g := range all[1:] {
+		if !h.baseline[g.id] {
+			result = append(result, g)
+		}
+	}
+	return result
+}
+
+// goroutine describes a goroutine, as reported by runtime.Stack.
+type goroutine struct {
+	id    string
+	state string
+	stack string
+}
+
+// blockedStates holds the prefixes of the states in which
+// a goroutine is blocked waiting for another goroutine.
+var blockedStates = []string{
+	"chan receive",
+	"chan send",
+	"select",
+	"sleep",
+	"semacquire",
+	"sync.Cond.Wait",
+	"sync.Mutex.Lock",
+	"sync.RWMutex.Lock",
+	"sync.RWMutex.RLock",
+	"sync.WaitGroup.Wait",
+}
+
+// blocked reports whether the goroutine is blocked
+// waiting for another goroutine.
+func (g goroutine) blocked() bool {
+	for _, state := range blockedStates {
+		if strings.HasPrefix(g.state, state) {
+			return true
+		}
+	}
+	return false
+}
+
+var headerRE = regexp.MustCompile(`^goroutine (\d+) \[([^\],]*)`)
+
+// goroutines returns all goroutines, starting with the calling one.
+func goroutines() []goroutine {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	var result []goroutine
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		m := headerRE.FindSubmatch(stack)
+		if m == nil {
+			continue
+		}
+		result = append(result, goroutine{
+			id:    string(m[1]),
+			state: string(m[2]),
+			stack: string(stack),
+		})
+	}
+	return result
+}
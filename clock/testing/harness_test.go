@@ -0,0 +1,117 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"sync"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type harnessSuite struct{}
+
+var _ = gc.Suite(&harnessSuite{})
+
+var t0 = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type counter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *counter) inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+}
+
+func (c *counter) get() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+func (*harnessSuite) TestAdvanceAndSettle(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	h := clocktesting.NewHarness(clock)
+	stop := make(chan struct{})
+	var ticks counter
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-clock.After(time.Second):
+				ticks.inc()
+			}
+		}
+	}()
+	h.Settle(c)
+	c.Assert(clock.Alarms(), gc.Equals, 1)
+	for i := 1; i <= 5; i++ {
+		h.AdvanceAndSettle(c, time.Second)
+		c.Assert(ticks.get(), gc.Equals, i)
+	}
+	h.AdvanceAndSettle(c, 500*time.Millisecond)
+	c.Assert(ticks.get(), gc.Equals, 5)
+	close(stop)
+	h.AssertNoLeaks(c)
+}
+
+func (*harnessSuite) TestSettleChain(c *gc.C) {
+	// Each goroutine wakes the next, so settling
+	// must wait for the whole chain to run.
+	clock := clocktesting.NewClock(t0)
+	h := clocktesting.NewHarness(clock)
+	var done counter
+	prev := clock.After(time.Second)
+	for i := 0; i < 10; i++ {
+		in, out := prev, make(chan time.Time, 1)
+		go func() {
+			out <- <-in
+			done.inc()
+		}()
+		prev = out
+	}
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(done.get(), gc.Equals, 10)
+	h.AssertNoLeaks(c)
+}
+
+func (*harnessSuite) TestTimer(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	timer := clock.NewTimer(time.Second)
+	c.Assert(clock.Alarms(), gc.Equals, 1)
+	c.Assert(timer.Reset(2*time.Second), jc.IsTrue)
+	clock.Advance(time.Second)
+	select {
+	case <-timer.Chan():
+		c.Fatalf("timer fired early")
+	default:
+	}
+	clock.Advance(time.Second)
+	c.Assert(<-timer.Chan(), gc.Equals, t0.Add(2*time.Second))
+	c.Assert(timer.Stop(), jc.IsFalse)
+	c.Assert(timer.Reset(time.Second), jc.IsFalse)
+	c.Assert(timer.Stop(), jc.IsTrue)
+	c.Assert(clock.Alarms(), gc.Equals, 0)
+}
+
+func (*harnessSuite) TestLeaked(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	h := clocktesting.NewHarness(clock)
+	release := make(chan struct{})
+	go func() {
+		<-release
+	}()
+	h.Settle(c)
+	leaked := h.Leaked()
+	c.Assert(leaked, gc.HasLen, 1)
+	c.Assert(leaked[0], gc.Matches, `(?s)goroutine \d+ \[chan receive\]:.*harness_test.go.*`)
+	close(release)
+	h.AssertNoLeaks(c)
+}
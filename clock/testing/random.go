@@ -0,0 +1,64 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RandomClock is a Clock whose time also advances, by a pseudo-random
+// amount, each time it is observed with Now, as the wall clock's time
+// would between calls. It is intended for fuzz and property tests of
+// code that might assume that the time does not change between two calls
+// to Now, or while it holds a lock. The increments are determined by the
+// seed, so that a failing test may be reproduced by running it with the
+// same seed, provided that the code under test calls Now in the same
+// order.
+//
+// Advancing the clock when it is observed fires the alarms whose times
+// are reached, as Advance does, but does not advance the clock past an
+// unreleased barrier; see RegisterAt. The clock may also be advanced
+// manually.
+//
+// RandomClock's methods are safe for concurrent use.
+type RandomClock struct {
+	*Clock
+	seed    int64
+	maxStep time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRandomClock returns a new RandomClock set to the specified time,
+// which advances by a pseudo-random duration in (0, maxStep], determined
+// by the seed, each time Now is called. If maxStep is not positive, the
+// clock advances only when advanced manually.
+func NewRandomClock(now time.Time, seed int64, maxStep time.Duration) *RandomClock {
+	return &RandomClock{
+		Clock:   NewClock(now),
+		seed:    seed,
+		maxStep: maxStep,
+		rand:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Seed returns the seed with which the clock was created, so that a
+// failing test may report it.
+func (c *RandomClock) Seed() int64 {
+	return c.seed
+}
+
+// Now is part of the clock.Clock interface. Now advances the clock by a
+// pseudo-random duration before returning its time.
+func (c *RandomClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxStep > 0 {
+		c.Clock.advanceUntilBarrier(time.Duration(c.rand.Int63n(int64(c.maxStep))) + 1)
+	}
+	return c.Clock.Now()
+}
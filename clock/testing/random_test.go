@@ -0,0 +1,70 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type randomSuite struct{}
+
+var _ = gc.Suite(&randomSuite{})
+
+var _ clock.TimerClock = (*clocktesting.RandomClock)(nil)
+
+func (*randomSuite) TestNowAdvances(c *gc.C) {
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clocktesting.NewRandomClock(t0, 42, time.Millisecond)
+	c.Assert(clk.Seed(), gc.Equals, int64(42))
+	prev := t0
+	for i := 0; i < 100; i++ {
+		now := clk.Now()
+		c.Assert(now.After(prev), jc.IsTrue)
+		c.Assert(now.Sub(prev) <= time.Millisecond, jc.IsTrue)
+		prev = now
+	}
+}
+
+func (*randomSuite) TestSeedReproducible(c *gc.C) {
+	times := func(seed int64) []time.Time {
+		clk := clocktesting.NewRandomClock(time.Time{}, seed, time.Second)
+		var times []time.Time
+		for i := 0; i < 10; i++ {
+			times = append(times, clk.Now())
+		}
+		return times
+	}
+	c.Assert(times(1), jc.DeepEquals, times(1))
+	c.Assert(times(1), gc.Not(jc.DeepEquals), times(2))
+}
+
+func (*randomSuite) TestObservingFiresAlarms(c *gc.C) {
+	clk := clocktesting.NewRandomClock(time.Time{}, 1, time.Second)
+	ch := clk.After(time.Second)
+	for clk.Now().Before(time.Time{}.Add(time.Second)) {
+		select {
+		case <-ch:
+			c.Fatalf("alarm fired early")
+		default:
+		}
+	}
+	select {
+	case <-ch:
+	default:
+		c.Fatalf("alarm not fired")
+	}
+	c.Assert(clk.Alarms(), gc.Equals, 0)
+}
+
+func (*randomSuite) TestZeroMaxStep(c *gc.C) {
+	clk := clocktesting.NewRandomClock(time.Time{}, 1, 0)
+	c.Assert(clk.Now(), gc.Equals, time.Time{})
+	clk.Advance(time.Second)
+	c.Assert(clk.Now(), gc.Equals, time.Time{}.Add(time.Second))
+}
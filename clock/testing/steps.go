@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"runtime"
+	"time"
+
+	gc "gopkg.in/check.v1"
+)
+
+const (
+	// maxYields is the maximum number of times that AdvanceAndYield
+	// yields the processor after each step, waiting for the clock's
+	// alarms to stop changing.
+	maxYields = 100
+
+	// quietYields is the number of consecutive yields after which,
+	// if the clock's alarms have not changed, AdvanceAndYield takes
+	// its next step.
+	quietYields = 5
+)
+
+// AdvanceAndYield advances the clock by the specified duration, in
+// steps: each step advances the clock to the time of the next alarm, or
+// by the specified step, if it is positive and the next alarm is later.
+// After each step, AdvanceAndYield yields the processor, so that the
+// goroutines woken by the step may run, and arm further alarms, before
+// the next step. Unlike Advance, then, an alarm armed in response to
+// another firing is itself fired if its time is reached, at its own
+// time, as it would be by the wall clock.
+//
+// Yielding is a best effort: AdvanceAndYield takes its next step once
+// the clock's alarms have stopped changing for several yields, which
+// does not guarantee that the woken goroutines have run. Use
+// Harness.AdvanceInSteps to wait for them to settle.
+func (c *Clock) AdvanceAndYield(d, step time.Duration) {
+	c.advanceInSteps(d, step, c.yield)
+}
+
+// AdvanceInSteps is like Clock.AdvanceAndYield, but after each step
+// waits for the goroutines to settle, as Settle does.
+func (h *Harness) AdvanceInSteps(c *gc.C, d, step time.Duration) {
+	h.Clock.advanceInSteps(d, step, func() { h.Settle(c) })
+}
+
+// advanceInSteps advances the clock by the specified duration, in
+// steps, calling wait after each step; see AdvanceAndYield.
+func (c *Clock) advanceInSteps(d, step time.Duration, wait func()) {
+	end := c.Now().Add(d)
+	for {
+		c.Advance(c.nextStep(end, step))
+		wait()
+		if !c.Now().Before(end) {
+			return
+		}
+	}
+}
+
+// nextStep returns the duration by which to advance the clock next,
+// toward the end time, in steps of at most step, if it is positive,
+// and stopping at the next alarm.
+func (c *Clock) nextStep(end time.Time, step time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next := end
+	if step > 0 && c.now.Add(step).Before(next) {
+		next = c.now.Add(step)
+	}
+	if len(c.alarms) > 0 && c.alarms[0].time.Before(next) {
+		next = c.alarms[0].time
+	}
+	return next.Sub(c.now)
+}
+
+// yield yields the processor until the clock's alarms have not changed
+// for quietYields consecutive yields, or maxYields yields have been made.
+func (c *Clock) yield() {
+	changes := c.changeCount()
+	quiet := 0
+	for i := 0; i < maxYields && quiet < quietYields; i++ {
+		runtime.Gosched()
+		if next := c.changeCount(); next != changes {
+			changes = next
+			quiet = 0
+			continue
+		}
+		quiet++
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"sync"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type stepsSuite struct{}
+
+var _ = gc.Suite(&stepsSuite{})
+
+// ticker records the times at which a chain of timers fired, each
+// timer being armed, for the specified interval, by the previous
+// one firing, until stop is closed.
+type ticker struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (t *ticker) run(clock *clocktesting.Clock, interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	timer := clock.NewTimer(interval)
+	for {
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case now := <-timer.Chan():
+			t.mu.Lock()
+			t.times = append(t.times, now)
+			t.mu.Unlock()
+			timer.Reset(interval)
+		}
+	}
+}
+
+func (t *ticker) get() []time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]time.Time(nil), t.times...)
+}
+
+func (*stepsSuite) TestAdvanceSkipsChainedTimers(c *gc.C) {
+	// A single Advance fires only the timer armed before
+	// it; those armed in response are left pending.
+	clock := clocktesting.NewClock(t0)
+	h := clocktesting.NewHarness(clock)
+	var t ticker
+	stop, done := make(chan struct{}), make(chan struct{})
+	go t.run(clock, time.Second, stop, done)
+	h.Settle(c)
+	h.AdvanceAndSettle(c, 5*time.Second)
+	c.Assert(t.get(), gc.DeepEquals, []time.Time{t0.Add(5 * time.Second)})
+	close(stop)
+	<-done
+}
+
+func (*stepsSuite) TestAdvanceInSteps(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	h := clocktesting.NewHarness(clock)
+	var t ticker
+	stop, done := make(chan struct{}), make(chan struct{})
+	go t.run(clock, time.Second, stop, done)
+	h.Settle(c)
+
+	// Each timer fires at its own time, including
+	// those armed by earlier timers firing.
+	h.AdvanceInSteps(c, 5500*time.Millisecond, 0)
+	c.Assert(t.get(), gc.DeepEquals, []time.Time{
+		t0.Add(1 * time.Second),
+		t0.Add(2 * time.Second),
+		t0.Add(3 * time.Second),
+		t0.Add(4 * time.Second),
+		t0.Add(5 * time.Second),
+	})
+	c.Assert(clock.Now(), gc.Equals, t0.Add(5500*time.Millisecond))
+	close(stop)
+	h.AssertNoLeaks(c)
+}
+
+func (*stepsSuite) TestAdvanceAndYield(c *gc.C) {
+	clock := clocktesting.NewClock(t0)
+	var t ticker
+	stop, done := make(chan struct{}), make(chan struct{})
+	go t.run(clock, time.Second, stop, done)
+	for clock.Alarms() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The clock stops at each timer's time, so that the goroutine
+	// may re-arm its timer before the clock passes its time.
+	clock.AdvanceAndYield(3*time.Second, 400*time.Millisecond)
+	c.Assert(clock.Now(), gc.Equals, t0.Add(3*time.Second))
+	times := t.get()
+	c.Assert(times, gc.Not(gc.HasLen), 0)
+	c.Assert(times[0], gc.Equals, t0.Add(time.Second))
+	for i := 1; i < len(times); i++ {
+		c.Assert(times[i].After(times[i-1]), gc.Equals, true)
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Timer is a timer that may be stopped, and reset to send at a new time.
+type Timer interface {
+	// Chan returns the channel on which the timer sends. The channel
+	// may change when the timer is reset, so Chan should be called
+	// again after each call to Reset.
+	Chan() <-chan time.Time
+
+	// Reset changes the timer to send after the duration has elapsed,
+	// discarding any unreceived send. It returns true if the timer had
+	// been active.
+	Reset(time.Duration) bool
+
+	// Stop prevents the timer from sending. It returns true if the
+	// timer had been active.
+	Stop() bool
+}
+
+// TimerClock is a Clock that can create Timers. Creating and resetting
+// Timers is cheaper than calling After repeatedly, as a Timer's resources
+// may be reused.
+type TimerClock interface {
+	Clock
+
+	// NewTimer returns a Timer that will send the current time
+	// after the duration has elapsed.
+	NewTimer(time.Duration) Timer
+}
+
+// NewTimer returns a Timer that will send the current time after the
+// duration has elapsed, as measured by c. If c does not implement
+// TimerClock, the Timer is implemented with c.After, and resetting
+// it allocates as After does.
+func NewTimer(c Clock, d time.Duration) Timer {
+	if tc, ok := c.(TimerClock); ok {
+		return tc.NewTimer(d)
+	}
+	t := &afterTimer{clock: c}
+	t.Reset(d)
+	return t
+}
+
+// afterTimer implements Timer with Clock.After.
+type afterTimer struct {
+	clock    Clock
+	c        <-chan time.Time
+	deadline time.Time
+}
+
+// Chan is part of the Timer interface.
+func (t *afterTimer) Chan() <-chan time.Time {
+	return t.c
+}
+
+// Reset is part of the Timer interface.
+func (t *afterTimer) Reset(d time.Duration) bool {
+	active := t.Stop()
+	t.deadline = t.clock.Now().Add(d)
+	t.c = t.clock.After(d)
+	return active
+}
+
+// Stop is part of the Timer interface.
+func (t *afterTimer) Stop() bool {
+	active := t.c != nil && t.clock.Now().Before(t.deadline)
+	t.c = nil
+	return active
+}
+
+// NewTimer is part of the TimerClock interface.
+func (wallClock) NewTimer(d time.Duration) Timer {
+	return wallTimer{time.NewTimer(d)}
+}
+
+// wallTimer implements Timer with time.Timer.
+type wallTimer struct {
+	*time.Timer
+}
+
+// Chan is part of the Timer interface.
+func (t wallTimer) Chan() <-chan time.Time {
+	return t.C
+}
+
+// Reset is part of the Timer interface.
+func (t wallTimer) Reset(d time.Duration) bool {
+	active := t.Stop()
+	t.Timer.Reset(d)
+	return active
+}
+
+// Stop is part of the Timer interface.
+func (t wallTimer) Stop() bool {
+	if t.Timer.Stop() {
+		return true
+	}
+	// Discard any unreceived send, so it is not
+	// observed after the timer is reset.
+	select {
+	case <-t.C:
+	default:
+	}
+	return false
+}
+
+// WallTimers is a TimerPool for WallClock.
+var WallTimers = NewTimerPool(WallClock)
+
+// TimerPool is a pool of reusable Timers for a Clock, for code that would
+// otherwise create a timer for each wait. TimerPool's methods are safe for
+// concurrent use.
+type TimerPool struct {
+	clock  Clock
+	timers sync.Pool
+}
+
+// NewTimerPool returns a new TimerPool for the given Clock. Timers are
+// reused only if the Clock implements TimerClock.
+func NewTimerPool(c Clock) *TimerPool {
+	return &TimerPool{clock: c}
+}
+
+// Timers returns a TimerPool for the given Clock: WallTimers if c is
+// WallClock, and otherwise a new TimerPool.
+func Timers(c Clock) *TimerPool {
+	if c == Clock(WallClock) {
+		return WallTimers
+	}
+	return NewTimerPool(c)
+}
+
+// Get returns a Timer that will send after the duration has elapsed,
+// reusing a pooled Timer if one is available. The Timer should be
+// returned to the pool with Put when it is no longer needed.
+func (p *TimerPool) Get(d time.Duration) Timer {
+	if t, ok := p.timers.Get().(Timer); ok {
+		t.Reset(d)
+		return t
+	}
+	return NewTimer(p.clock, d)
+}
+
+// Put stops the Timer and returns it to the pool. The Timer must
+// have been obtained from the pool with Get, and must not be used
+// after it is returned.
+func (p *TimerPool) Put(t Timer) {
+	t.Stop()
+	if _, ok := p.clock.(TimerClock); ok {
+		p.timers.Put(t)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	coretesting "github.com/juju/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type timerSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&timerSuite{})
+
+// afterOnlyClock hides any NewTimer method of the wrapped clock.
+type afterOnlyClock struct {
+	clock.Clock
+}
+
+func (s *timerSuite) TestWallTimer(c *gc.C) {
+	t := clock.NewTimer(clock.WallClock, time.Millisecond)
+	select {
+	case <-t.Chan():
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timer did not send")
+	}
+	c.Assert(t.Stop(), gc.Equals, false)
+
+	c.Assert(t.Reset(time.Hour), gc.Equals, false)
+	c.Assert(t.Stop(), gc.Equals, true)
+	select {
+	case <-t.Chan():
+		c.Fatalf("stopped timer sent")
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+func (s *timerSuite) TestWallTimerResetDiscardsSend(c *gc.C) {
+	t := clock.NewTimer(clock.WallClock, time.Millisecond)
+	time.Sleep(coretesting.ShortWait)
+	t.Reset(time.Hour)
+	select {
+	case <-t.Chan():
+		c.Fatalf("reset timer sent stale time")
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+func (s *timerSuite) TestAfterTimer(c *gc.C) {
+	testClock := coretesting.NewClock(time.Time{})
+	t := clock.NewTimer(afterOnlyClock{testClock}, time.Second)
+	ch := t.Chan()
+	testClock.Advance(time.Second)
+	select {
+	case <-ch:
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timer did not send")
+	}
+
+	c.Assert(t.Reset(time.Second), gc.Equals, false)
+	c.Assert(t.Chan(), gc.Not(gc.Equals), ch)
+	c.Assert(t.Stop(), gc.Equals, true)
+	c.Assert(t.Chan(), gc.IsNil)
+}
+
+func (s *timerSuite) TestTimerPool(c *gc.C) {
+	p := clock.NewTimerPool(clock.WallClock)
+	t := p.Get(time.Hour)
+	p.Put(t)
+	t = p.Get(time.Millisecond)
+	select {
+	case <-t.Chan():
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timer did not send")
+	}
+	p.Put(t)
+}
+
+func (s *timerSuite) TestTimers(c *gc.C) {
+	c.Assert(clock.Timers(clock.WallClock), gc.Equals, clock.WallTimers)
+	testClock := coretesting.NewClock(time.Time{})
+	c.Assert(clock.Timers(testClock), gc.Not(gc.Equals), clock.WallTimers)
+}
@@ -0,0 +1,555 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package cron parses cron expressions, and computes the times
+// at which they occur.
+//
+// Expressions have five space-separated fields: minute, hour, day of
+// month, month, and day of week. An optional sixth field of seconds may
+// be given first. Each field is either "*", or a comma-separated list of
+// values, ranges ("a-b"), or steps ("*/n", "a/n" or "a-b/n"). Months and
+// days of the week may be given by their three-letter English names,
+// case-insensitively; Sunday is day 0 or 7. As in Vixie cron, if both the
+// day of month and day of week are restricted, an expression occurs on
+// days matching either.
+//
+// The macros @yearly (or @annually), @monthly, @weekly, @daily (or
+// @midnight) and @hourly are also accepted. An expression may be
+// prefixed with "CRON_TZ=<zone> " or "TZ=<zone> " to interpret it in
+// the named time zone.
+//
+// ParseWithOptions accepts the non-standard forms used by Quartz, such
+// as "L" for the last day of the month and "FRI#3" for the third Friday,
+// each enabled by an option; see Options. Quartz's optional year field
+// is not supported.
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Expression is a parsed cron expression. Expression implements
+// schedule.Recurrence, and so may be used with schedule.RecurrenceDelay.
+type Expression struct {
+	expr string
+	loc  *time.Location
+
+	second, minute, hour, dom, month, dow bits
+
+	// domStar and dowStar record whether the day of month and
+	// day of week fields were unrestricted.
+	domStar, dowStar bool
+
+	// domRules and dowRules hold the rules for days given by the
+	// non-standard forms of the day of month and day of week fields.
+	domRules, dowRules []dayRule
+}
+
+// Options is a set of options enabling the non-standard forms of cron
+// expression accepted by ParseWithOptions.
+type Options uint
+
+const (
+	// AllowQuestion accepts "?", meaning no specific value, in the
+	// day of month and day of week fields; it is equivalent to "*".
+	AllowQuestion Options = 1 << iota
+
+	// AllowLast accepts "L" in the day of month field, for the last
+	// day of the month, or "L-n" for n days before it; and "nL" in
+	// the day of week field, for the last day n of the month, such
+	// as "FRIL" for the last Friday, or "L" alone for Saturday.
+	AllowLast
+
+	// AllowWeekday accepts "nW" in the day of month field, for the
+	// weekday (Monday to Friday) nearest day n within the same
+	// month; and "LW", with AllowLast, for the last weekday of the
+	// month.
+	AllowWeekday
+
+	// AllowNth accepts "n#k" in the day of week field, for the k'th
+	// day n of the month, such as "FRI#3" for the third Friday.
+	AllowNth
+
+	// QuartzDayOfWeek numbers the days of the week from 1 (Sunday)
+	// to 7 (Saturday), as Quartz does, rather than from 0 (Sunday).
+	QuartzDayOfWeek
+
+	// Quartz enables all of the options, accepting the forms
+	// of expression used by Quartz.
+	Quartz = AllowQuestion | AllowLast | AllowWeekday | AllowNth | QuartzDayOfWeek
+)
+
+// dayRule reports whether a day matches a non-standard
+// form of the day of month or day of week field.
+type dayRule func(t time.Time) bool
+
+// bits is a set of field values.
+type bits uint64
+
+func (b bits) has(v int) bool {
+	return b&(1<<uint(v)) != 0
+}
+
+// field describes a field of a cron expression.
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = field{name: "second", min: 0, max: 59}
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Day of week 7 is an alias for Sunday.
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// quartzDowField is the day of week field numbered as by Quartz.
+var quartzDowField = field{name: "day of week", min: 1, max: 7, names: map[string]int{
+	"sun": 1, "mon": 2, "tue": 3, "wed": 4, "thu": 5, "fri": 6, "sat": 7,
+}}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression, interpreting it in UTC unless it
+// has a time zone prefix.
+func Parse(expr string) (*Expression, error) {
+	return ParseInLocation(expr, time.UTC)
+}
+
+// ParseInLocation parses a cron expression, interpreting it in the
+// specified location unless it has a time zone prefix.
+func ParseInLocation(expr string, loc *time.Location) (*Expression, error) {
+	return ParseWithOptions(expr, loc, 0)
+}
+
+// ParseWithOptions parses a cron expression, accepting the non-standard
+// forms enabled by the options, and interpreting it in the specified
+// location unless it has a time zone prefix.
+func ParseWithOptions(expr string, loc *time.Location, opts Options) (*Expression, error) {
+	e, err := parse(expr, loc, opts)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing cron expression %q", expr)
+	}
+	return e, nil
+}
+
+func parse(expr string, loc *time.Location, opts Options) (*Expression, error) {
+	spec := strings.TrimSpace(expr)
+	for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+		if !strings.HasPrefix(spec, prefix) {
+			continue
+		}
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, errors.New("missing fields after time zone")
+		}
+		var err error
+		if loc, err = time.LoadLocation(spec[len(prefix):i]); err != nil {
+			return nil, errors.Trace(err)
+		}
+		spec = strings.TrimSpace(spec[i:])
+		break
+	}
+	if strings.HasPrefix(spec, "@") {
+		macro, ok := macros[spec]
+		if !ok {
+			return nil, errors.Errorf("unknown macro %q", spec)
+		}
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, errors.Errorf("expected 5 or 6 fields, got %d", len(fields))
+	}
+	if opts&AllowQuestion != 0 {
+		for _, i := range []int{3, 5} {
+			if fields[i] == "?" {
+				fields[i] = "*"
+			}
+		}
+	}
+	e := &Expression{
+		expr:    expr,
+		loc:     loc,
+		domStar: fields[3] == "*",
+		dowStar: fields[5] == "*",
+	}
+	dow := &dowField
+	if opts&QuartzDayOfWeek != 0 {
+		dow = &quartzDowField
+	}
+	var err error
+	if fields[3], e.domRules, err = domRules(fields[3], opts); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if fields[5], e.dowRules, err = dowRules(fields[5], dow, opts); err != nil {
+		return nil, errors.Trace(err)
+	}
+	for i, f := range []struct {
+		field *field
+		bits  *bits
+	}{
+		{&secondField, &e.second},
+		{&minuteField, &e.minute},
+		{&hourField, &e.hour},
+		{&domField, &e.dom},
+		{&monthField, &e.month},
+		{dow, &e.dow},
+	} {
+		if fields[i] == "" {
+			// The field has only non-standard forms.
+			continue
+		}
+		b, err := f.field.parse(fields[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		*f.bits = b
+	}
+	if dow == &quartzDowField {
+		e.dow >>= 1
+	} else if e.dow.has(7) {
+		e.dow |= 1
+	}
+	return e, nil
+}
+
+// domRules extracts the non-standard forms enabled by the options from
+// the day of month field, returning the remainder of the field and the
+// rules for the extracted forms.
+func domRules(s string, opts Options) (string, []dayRule, error) {
+	if opts&(AllowLast|AllowWeekday) == 0 {
+		return s, nil, nil
+	}
+	var rest []string
+	var rules []dayRule
+	for _, part := range strings.Split(s, ",") {
+		switch {
+		case part == "LW" && opts&AllowLast != 0 && opts&AllowWeekday != 0:
+			rules = append(rules, func(t time.Time) bool {
+				return t.Day() == lastWeekday(t)
+			})
+		case strings.HasPrefix(part, "L") && opts&AllowLast != 0:
+			offset := 0
+			if part != "L" {
+				n, err := strconv.Atoi(strings.TrimPrefix(part, "L-"))
+				if err != nil || !strings.HasPrefix(part, "L-") || n < 0 || n > 30 {
+					return "", nil, errors.Errorf("invalid day of month %q", part)
+				}
+				offset = n
+			}
+			rules = append(rules, func(t time.Time) bool {
+				return t.Day() == daysIn(t)-offset
+			})
+		case strings.HasSuffix(part, "W") && opts&AllowWeekday != 0:
+			n, err := domField.value(strings.TrimSuffix(part, "W"))
+			if err != nil {
+				return "", nil, errors.Errorf("invalid day of month %q", part)
+			}
+			rules = append(rules, func(t time.Time) bool {
+				return t.Day() == nearestWeekday(t, n)
+			})
+		default:
+			rest = append(rest, part)
+		}
+	}
+	return strings.Join(rest, ","), rules, nil
+}
+
+// dowRules extracts the non-standard forms enabled by the options from
+// the day of week field, returning the remainder of the field and the
+// rules for the extracted forms.
+func dowRules(s string, f *field, opts Options) (string, []dayRule, error) {
+	if opts&(AllowLast|AllowNth) == 0 {
+		return s, nil, nil
+	}
+	// weekday parses a day of week value as a time.Weekday.
+	weekday := func(part, s string) (time.Weekday, error) {
+		v, err := f.value(s)
+		if err != nil {
+			return 0, errors.Errorf("invalid day of week %q", part)
+		}
+		return time.Weekday((v - f.min) % 7), nil
+	}
+	var rest []string
+	var rules []dayRule
+	for _, part := range strings.Split(s, ",") {
+		switch i := strings.IndexByte(part, '#'); {
+		case i >= 0 && opts&AllowNth != 0:
+			day, err := weekday(part, part[:i])
+			if err != nil {
+				return "", nil, err
+			}
+			nth, err := strconv.Atoi(part[i+1:])
+			if err != nil || nth < 1 || nth > 5 {
+				return "", nil, errors.Errorf("invalid day of week %q", part)
+			}
+			rules = append(rules, func(t time.Time) bool {
+				return t.Weekday() == day && (t.Day()-1)/7+1 == nth
+			})
+		case part == "L" && opts&AllowLast != 0:
+			// As in Quartz, "L" alone is the last day of the week.
+			rest = append(rest, "sat")
+		case strings.HasSuffix(strings.ToUpper(part), "L") && opts&AllowLast != 0:
+			day, err := weekday(part, part[:len(part)-1])
+			if err != nil {
+				return "", nil, err
+			}
+			rules = append(rules, func(t time.Time) bool {
+				return t.Weekday() == day && t.Day()+7 > daysIn(t)
+			})
+		default:
+			rest = append(rest, part)
+		}
+	}
+	return strings.Join(rest, ","), rules, nil
+}
+
+// daysIn returns the number of days in the month of t.
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 12, 0, 0, 0, t.Location()).Day()
+}
+
+// nearestWeekday returns the day of the month of t that is the weekday
+// nearest the specified day, within the same month; or zero if the month
+// has no such day.
+func nearestWeekday(t time.Time, day int) int {
+	last := daysIn(t)
+	if day > last {
+		return 0
+	}
+	switch time.Date(t.Year(), t.Month(), day, 12, 0, 0, 0, t.Location()).Weekday() {
+	case time.Saturday:
+		if day == 1 {
+			return day + 2
+		}
+		return day - 1
+	case time.Sunday:
+		if day == last {
+			return day - 2
+		}
+		return day + 1
+	}
+	return day
+}
+
+// lastWeekday returns the day of the month of t that is
+// the last weekday of the month.
+func lastWeekday(t time.Time) int {
+	last := daysIn(t)
+	switch time.Date(t.Year(), t.Month(), last, 12, 0, 0, 0, t.Location()).Weekday() {
+	case time.Saturday:
+		return last - 1
+	case time.Sunday:
+		return last - 2
+	}
+	return last
+}
+
+// parse parses a field's comma-separated list of values,
+// ranges and steps.
+func (f *field) parse(s string) (bits, error) {
+	var b bits
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+		rangeExpr := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf("invalid %s step %q", f.name, part[i+1:])
+			}
+			step = n
+			rangeExpr = part[:i]
+		}
+		if rangeExpr != "*" {
+			var err error
+			if i := strings.IndexByte(rangeExpr, '-'); i >= 0 {
+				if lo, err = f.value(rangeExpr[:i]); err != nil {
+					return 0, err
+				}
+				if hi, err = f.value(rangeExpr[i+1:]); err != nil {
+					return 0, err
+				}
+				if hi < lo {
+					return 0, errors.Errorf("invalid %s range %q", f.name, rangeExpr)
+				}
+			} else {
+				if lo, err = f.value(rangeExpr); err != nil {
+					return 0, err
+				}
+				if step == 1 {
+					// A single value, rather than "a/n",
+					// which steps from a to the maximum.
+					hi = lo
+				}
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			b |= 1 << uint(v)
+		}
+	}
+	return b, nil
+}
+
+// value parses a single value of the field, by number or name.
+func (f *field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, errors.Errorf("invalid %s %q", f.name, s)
+	}
+	return v, nil
+}
+
+// String returns the expression as it was parsed.
+func (e *Expression) String() string {
+	return e.expr
+}
+
+// Location returns the location in which the expression is interpreted.
+func (e *Expression) Location() *time.Location {
+	return e.loc
+}
+
+// Next returns the first time strictly after the specified time at which
+// the expression occurs. If the expression never occurs, for example
+// "0 0 30 2 *", Next returns the zero time.
+//
+// Times that do not exist in the expression's location, because clocks have
+// gone forward, are skipped. If the hour field is restricted, times that
+// occur twice, because clocks have gone back, occur only at the first
+// instance; otherwise, they occur at both.
+func (e *Expression) Next(after time.Time) time.Time {
+	loc := e.loc
+	t := after.In(loc).Truncate(time.Second).Add(time.Second)
+	// Any satisfiable expression occurs within a few years;
+	// 29 February may be preceded by up to seven non-leap years.
+	yearLimit := t.Year() + 8
+
+WRAP:
+	for t.Year() <= yearLimit {
+		// Once a field is advanced, the lower fields are reset to
+		// their minimum values.
+		added := false
+		for !e.month.has(int(t.Month())) {
+			if !added {
+				added = true
+				t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+			}
+			t = t.AddDate(0, 1, 0)
+			if t.Month() == time.January {
+				continue WRAP
+			}
+		}
+		for !e.dayMatches(t) {
+			if !added {
+				added = true
+				t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+			}
+			t = t.AddDate(0, 0, 1)
+			if t.Day() == 1 {
+				continue WRAP
+			}
+		}
+		for !e.hour.has(t.Hour()) {
+			if !added {
+				added = true
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+			}
+			t = t.Add(time.Hour)
+			if t.Hour() == 0 {
+				continue WRAP
+			}
+		}
+		for !e.minute.has(t.Minute()) {
+			if !added {
+				added = true
+				t = t.Truncate(time.Minute)
+			}
+			t = t.Add(time.Minute)
+			if t.Minute() == 0 {
+				continue WRAP
+			}
+		}
+		for !e.second.has(t.Second()) {
+			if !added {
+				added = true
+				t = t.Truncate(time.Second)
+			}
+			t = t.Add(time.Second)
+			if t.Second() == 0 {
+				continue WRAP
+			}
+		}
+		if e.hour != 1<<24-1 && repeated(t) {
+			t = t.Add(time.Second)
+			continue WRAP
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the expression's
+// day of month and day of week fields.
+func (e *Expression) dayMatches(t time.Time) bool {
+	dom := e.dom.has(t.Day()) || matchesAny(e.domRules, t)
+	dow := e.dow.has(int(t.Weekday())) || matchesAny(e.dowRules, t)
+	if e.domStar || e.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// matchesAny reports whether the day of t matches any of the rules.
+func matchesAny(rules []dayRule, t time.Time) bool {
+	for _, rule := range rules {
+		if rule(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// repeated reports whether the wall-clock time of t also occurred
+// earlier, because clocks went back.
+func repeated(t time.Time) bool {
+	// DST transitions shift clocks by at most a couple of hours,
+	// so if there was a transition just prior to t, we'll see it
+	// by comparing with the offset three hours earlier.
+	_, offset := t.Zone()
+	_, prevOffset := t.Add(-3 * time.Hour).Zone()
+	if prevOffset <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(prevOffset-offset) * time.Second)
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute() && earlier.Second() == t.Second()
+}
@@ -0,0 +1,194 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package cron_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/cron"
+	gc "gopkg.in/check.v1"
+)
+
+type cronSuite struct{}
+
+var _ = gc.Suite(&cronSuite{})
+
+func (*cronSuite) TestParseErrors(c *gc.C) {
+	for _, test := range []struct {
+		expr string
+		err  string
+	}{
+		{"* * * *", `parsing cron expression "\* \* \* \*": expected 5 or 6 fields, got 4`},
+		{"* * * * * * *", `.*expected 5 or 6 fields, got 7`},
+		{"60 * * * *", `.*invalid minute "60"`},
+		{"* 24 * * *", `.*invalid hour "24"`},
+		{"* * 0 * *", `.*invalid day of month "0"`},
+		{"* * * 13 *", `.*invalid month "13"`},
+		{"* * * foo *", `.*invalid month "foo"`},
+		{"* * * * 8", `.*invalid day of week "8"`},
+		{"5-1 * * * *", `.*invalid minute range "5-1"`},
+		{"*/0 * * * *", `.*invalid minute step "0"`},
+		{"@fortnightly", `.*unknown macro "@fortnightly"`},
+		{"CRON_TZ=Nowhere/Special * * * * *", `.*unknown time zone Nowhere/Special`},
+		{"CRON_TZ=UTC", `.*missing fields after time zone`},
+	} {
+		c.Logf("%q", test.expr)
+		_, err := cron.Parse(test.expr)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*cronSuite) TestNext(c *gc.C) {
+	from := time.Date(2015, 7, 15, 10, 30, 0, 0, time.UTC) // Wednesday
+	for _, test := range []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2015, 7, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2015, 7, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2015, 7, 15, 13, 0, 0, 0, time.UTC)},
+		{"5,35 10 * * *", time.Date(2015, 7, 15, 10, 35, 0, 0, time.UTC)},
+		{"0 0 * * *", time.Date(2015, 7, 16, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2015, 7, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2015, 7, 15, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2015, 7, 19, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2015, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * MON-FRI", time.Date(2015, 7, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * sat,sun", time.Date(2015, 7, 18, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2015, 7, 19, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1 FEB *", time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2015, 7, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 9 *", time.Time{}},
+		{"0 0 29 2 *", time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		// Day of month and day of week are OR'd when both are restricted.
+		{"0 0 20 * FRI", time.Date(2015, 7, 17, 0, 0, 0, 0, time.UTC)},
+		// Seconds.
+		{"30 * * * * *", time.Date(2015, 7, 15, 10, 30, 30, 0, time.UTC)},
+		{"*/10 30 10 * * *", time.Date(2015, 7, 15, 10, 30, 10, 0, time.UTC)},
+	} {
+		c.Logf("%q", test.expr)
+		e, err := cron.Parse(test.expr)
+		c.Assert(err, gc.IsNil)
+		next := e.Next(from)
+		c.Check(next.Equal(test.expected), gc.Equals, true, gc.Commentf("%v", next))
+	}
+}
+
+func (*cronSuite) TestNextStrictlyAfter(c *gc.C) {
+	e, err := cron.Parse("0 * * * *")
+	c.Assert(err, gc.IsNil)
+	t := time.Date(2015, 7, 15, 10, 0, 0, 0, time.UTC)
+	c.Assert(e.Next(t), gc.DeepEquals, t.Add(time.Hour))
+	c.Assert(e.Next(t.Add(-time.Nanosecond)), gc.DeepEquals, t)
+}
+
+func (*cronSuite) TestLocation(c *gc.C) {
+	loc, err := time.LoadLocation("Australia/Perth")
+	c.Assert(err, gc.IsNil)
+	from := time.Date(2015, 7, 15, 0, 0, 0, 0, time.UTC)
+	expected := time.Date(2015, 7, 15, 9, 0, 0, 0, loc)
+
+	e, err := cron.ParseInLocation("0 9 * * *", loc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(e.Location(), gc.Equals, loc)
+	c.Assert(e.Next(from).Equal(expected), gc.Equals, true)
+
+	e, err = cron.Parse("CRON_TZ=Australia/Perth 0 9 * * *")
+	c.Assert(err, gc.IsNil)
+	c.Assert(e.Location().String(), gc.Equals, "Australia/Perth")
+	c.Assert(e.Next(from).Equal(expected), gc.Equals, true)
+	c.Assert(e.String(), gc.Equals, "CRON_TZ=Australia/Perth 0 9 * * *")
+}
+
+func (*cronSuite) TestDaylightSaving(c *gc.C) {
+	loc, err := time.LoadLocation("Europe/London")
+	c.Assert(err, gc.IsNil)
+
+	// Clocks went forward at 01:00 on 29 March 2015,
+	// so 01:30 did not occur that day.
+	e, err := cron.ParseInLocation("30 1 * * *", loc)
+	c.Assert(err, gc.IsNil)
+	next := e.Next(time.Date(2015, 3, 29, 0, 0, 0, 0, loc))
+	c.Assert(next, gc.DeepEquals, time.Date(2015, 3, 30, 1, 30, 0, 0, loc))
+
+	// Clocks went back at 02:00 on 25 October 2015, so 01:30
+	// occurred twice; it occurs only at the first instance.
+	first := time.Date(2015, 10, 25, 0, 30, 0, 0, time.UTC)
+	next = e.Next(time.Date(2015, 10, 25, 0, 0, 0, 0, loc))
+	c.Assert(next.Equal(first), gc.Equals, true)
+	next = e.Next(next)
+	c.Assert(next, gc.DeepEquals, time.Date(2015, 10, 26, 1, 30, 0, 0, loc))
+
+	// With an unrestricted hour, the repeated times occur twice.
+	e, err = cron.ParseInLocation("30 * * * *", loc)
+	c.Assert(err, gc.IsNil)
+	next = e.Next(first)
+	c.Assert(next.Equal(first.Add(time.Hour)), gc.Equals, true)
+}
+
+func (*cronSuite) TestOptions(c *gc.C) {
+	from := time.Date(2015, 7, 15, 10, 30, 0, 0, time.UTC) // Wednesday
+	for _, test := range []struct {
+		expr     string
+		opts     cron.Options
+		expected time.Time
+	}{
+		{"0 0 12 ? * *", cron.AllowQuestion, time.Date(2015, 7, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 0 12 * * ?", cron.AllowQuestion, time.Date(2015, 7, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 0 L * *", cron.AllowLast, time.Date(2015, 7, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 L 2 *", cron.AllowLast, time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 L-3 * *", cron.AllowLast, time.Date(2015, 7, 28, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,L * *", cron.AllowLast, time.Date(2015, 7, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * FRIL", cron.AllowLast, time.Date(2015, 7, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 3L", cron.AllowLast, time.Date(2015, 7, 29, 0, 0, 0, 0, time.UTC)},
+		// 1 August 2015 is a Saturday; 31 October 2015 is a Saturday.
+		{"0 0 1W * *", cron.AllowWeekday, time.Date(2015, 8, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 18W * *", cron.AllowWeekday, time.Date(2015, 7, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 19W * *", cron.AllowWeekday, time.Date(2015, 7, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 LW 10 *", cron.AllowLast | cron.AllowWeekday, time.Date(2015, 10, 30, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * FRI#3", cron.AllowNth, time.Date(2015, 7, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1#1", cron.AllowNth, time.Date(2015, 8, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1#5", cron.AllowNth, time.Date(2015, 8, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 2", cron.QuartzDayOfWeek, time.Date(2015, 7, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", cron.QuartzDayOfWeek, time.Date(2015, 7, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 2-6", cron.QuartzDayOfWeek, time.Date(2015, 7, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * SUN", cron.QuartzDayOfWeek, time.Date(2015, 7, 19, 0, 0, 0, 0, time.UTC)},
+		// A Quartz expression: 10:15 on the last Friday of every month.
+		{"0 15 10 ? * 6L", cron.Quartz, time.Date(2015, 7, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 15 10 ? * L", cron.Quartz, time.Date(2015, 7, 18, 10, 15, 0, 0, time.UTC)},
+		{"0 0 12 ? JAN,FEB MON#2", cron.Quartz, time.Date(2016, 1, 11, 12, 0, 0, 0, time.UTC)},
+	} {
+		c.Logf("%q", test.expr)
+		e, err := cron.ParseWithOptions(test.expr, time.UTC, test.opts)
+		c.Assert(err, gc.IsNil)
+		next := e.Next(from)
+		c.Check(next.Equal(test.expected), gc.Equals, true, gc.Commentf("%v", next))
+	}
+}
+
+func (*cronSuite) TestOptionsErrors(c *gc.C) {
+	for _, test := range []struct {
+		expr string
+		opts cron.Options
+		err  string
+	}{
+		{"0 0 ? * *", 0, `.*invalid day of month "\?"`},
+		{"? 0 * * *", cron.Quartz, `.*invalid minute "\?"`},
+		{"0 0 L * *", cron.AllowWeekday, `.*invalid day of month "L"`},
+		{"0 0 L-31 * *", cron.AllowLast, `.*invalid day of month "L-31"`},
+		{"0 0 LX * *", cron.AllowLast, `.*invalid day of month "LX"`},
+		{"0 0 32W * *", cron.AllowWeekday, `.*invalid day of month "32W"`},
+		{"0 0 * * FRI#3", cron.AllowLast, `.*invalid day of week "FRI#3"`},
+		{"0 0 * * FRI#6", cron.AllowNth, `.*invalid day of week "FRI#6"`},
+		{"0 0 * * FOO#1", cron.AllowNth, `.*invalid day of week "FOO#1"`},
+		{"0 0 * * 8L", cron.AllowLast, `.*invalid day of week "8L"`},
+		{"0 0 * * 0", cron.QuartzDayOfWeek, `.*invalid day of week "0"`},
+	} {
+		c.Logf("%q", test.expr)
+		_, err := cron.ParseWithOptions(test.expr, time.UTC, test.opts)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package deadline provides a Budget type, representing a total
+// allowance of time that may be divided among sequential steps, and a
+// TimeBudget, which divides a Budget among the stages of a pipeline and
+// accounts for the time each used.
+package deadline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// Budget is an allowance of time that runs out at a deadline, as
+// measured by a Clock. A Budget is immutable, and so is safe for
+// concurrent use; it may be passed down through layers of code, each
+// of which may take a smaller budget for a step with Sub.
+type Budget struct {
+	clock    clock.Clock
+	deadline time.Time
+}
+
+// NewBudget returns a Budget of the given total duration, starting now
+// as measured by the given Clock.
+func NewBudget(clock clock.Clock, total time.Duration) *Budget {
+	return &Budget{clock: clock, deadline: clock.Now().Add(total)}
+}
+
+// Deadline returns the time at which the budget runs out.
+func (b *Budget) Deadline() time.Time {
+	return b.deadline
+}
+
+// Remaining returns the time remaining in the budget, or zero if
+// it has run out.
+func (b *Budget) Remaining() time.Duration {
+	if d := b.deadline.Sub(b.clock.Now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Exhausted reports whether the budget has run out.
+func (b *Budget) Exhausted() bool {
+	return b.Remaining() == 0
+}
+
+// Sub returns a budget for a step, of the given duration or the time
+// remaining in b, whichever is less.
+func (b *Budget) Sub(d time.Duration) *Budget {
+	return b.subAt(b.clock.Now(), d)
+}
+
+// subAt is like Sub, for a step starting at the specified time.
+func (b *Budget) subAt(now time.Time, d time.Duration) *Budget {
+	sub := &Budget{clock: b.clock, deadline: now.Add(d)}
+	if sub.deadline.After(b.deadline) {
+		sub.deadline = b.deadline
+	}
+	return sub
+}
+
+// Context returns a copy of the parent context that is done when the
+// budget runs out, as measured by the budget's Clock, or when the parent
+// is done, or when the returned cancel function is called, whichever
+// happens first. If the budget runs out first, the context's Err method
+// returns context.DeadlineExceeded.
+//
+// The cancel function should be called when the context is no longer
+// needed, to release its resources.
+func (b *Budget) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx := &budgetContext{
+		parent:   parent,
+		deadline: b.deadline,
+		done:     make(chan struct{}),
+	}
+	cancel := func() { ctx.finish(context.Canceled) }
+	remaining := b.Remaining()
+	if remaining == 0 {
+		ctx.finish(context.DeadlineExceeded)
+		return ctx, cancel
+	}
+	timer := clock.NewTimer(b.clock, remaining)
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.Chan():
+			ctx.finish(context.DeadlineExceeded)
+		case <-parent.Done():
+			ctx.finish(parent.Err())
+		case <-ctx.done:
+		}
+	}()
+	return ctx, cancel
+}
+
+// budgetContext is a context that is done when a budget runs out.
+//
+// budgetContext does not embed its parent, so that contexts derived from
+// it observe its Err rather than that of an ancestor.
+type budgetContext struct {
+	parent   context.Context
+	deadline time.Time
+	done     chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// finish records the context's error and closes its done channel,
+// if it is not already done.
+func (c *budgetContext) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
+
+// Deadline is part of the context.Context interface.
+func (c *budgetContext) Deadline() (time.Time, bool) {
+	if parent, ok := c.parent.Deadline(); ok && parent.Before(c.deadline) {
+		return parent, true
+	}
+	return c.deadline, true
+}
+
+// Done is part of the context.Context interface.
+func (c *budgetContext) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err is part of the context.Context interface.
+func (c *budgetContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Value is part of the context.Context interface.
+func (c *budgetContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package deadline_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/deadline"
+	coretesting "github.com/juju/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type budgetSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&budgetSuite{})
+
+func (s *budgetSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *budgetSuite) TestRemaining(c *gc.C) {
+	b := deadline.NewBudget(s.clock, time.Minute)
+	c.Assert(b.Deadline(), gc.Equals, s.clock.Now().Add(time.Minute))
+	c.Assert(b.Remaining(), gc.Equals, time.Minute)
+	s.clock.Advance(45 * time.Second)
+	c.Assert(b.Remaining(), gc.Equals, 15*time.Second)
+	c.Assert(b.Exhausted(), gc.Equals, false)
+	s.clock.Advance(time.Minute)
+	c.Assert(b.Remaining(), gc.Equals, time.Duration(0))
+	c.Assert(b.Exhausted(), gc.Equals, true)
+}
+
+func (s *budgetSuite) TestSub(c *gc.C) {
+	b := deadline.NewBudget(s.clock, time.Minute)
+	step := b.Sub(10 * time.Second)
+	c.Assert(step.Remaining(), gc.Equals, 10*time.Second)
+
+	s.clock.Advance(55 * time.Second)
+	step = b.Sub(10 * time.Second)
+	c.Assert(step.Remaining(), gc.Equals, 5*time.Second)
+	c.Assert(step.Deadline(), gc.Equals, b.Deadline())
+}
+
+func (s *budgetSuite) TestContextDeadlineExceeded(c *gc.C) {
+	b := deadline.NewBudget(s.clock, time.Minute)
+	ctx, cancel := b.Context(context.Background())
+	defer cancel()
+	t, ok := ctx.Deadline()
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(t, gc.Equals, b.Deadline())
+	c.Assert(ctx.Err(), gc.IsNil)
+
+	s.clock.Advance(time.Minute)
+	select {
+	case <-ctx.Done():
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("context not done")
+	}
+	c.Assert(ctx.Err(), gc.Equals, context.DeadlineExceeded)
+}
+
+func (s *budgetSuite) TestContextExhausted(c *gc.C) {
+	b := deadline.NewBudget(s.clock, 0)
+	ctx, cancel := b.Context(context.Background())
+	defer cancel()
+	c.Assert(ctx.Err(), gc.Equals, context.DeadlineExceeded)
+}
+
+func (s *budgetSuite) TestContextCancelled(c *gc.C) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	b := deadline.NewBudget(s.clock, time.Minute)
+	ctx, cancel := b.Context(parent)
+	defer cancel()
+	cancelParent()
+	<-ctx.Done()
+	c.Assert(ctx.Err(), gc.Equals, context.Canceled)
+
+	ctx, cancel = b.Context(context.Background())
+	cancel()
+	<-ctx.Done()
+	c.Assert(ctx.Err(), gc.Equals, context.Canceled)
+}
+
+func (s *budgetSuite) TestContextParentDeadline(c *gc.C) {
+	parentDeadline := time.Now().Add(-time.Hour)
+	parent, cancelParent := context.WithDeadline(context.Background(), parentDeadline)
+	defer cancelParent()
+	b := deadline.NewBudget(coretesting.NewClock(time.Now()), time.Minute)
+	ctx, cancel := b.Context(parent)
+	defer cancel()
+	t, _ := ctx.Deadline()
+	c.Assert(t.Equal(parentDeadline), gc.Equals, true)
+}
+
+func (s *budgetSuite) TestContextDerived(c *gc.C) {
+	b := deadline.NewBudget(s.clock, time.Minute)
+	ctx, cancel := b.Context(context.Background())
+	defer cancel()
+	derived, cancelDerived := context.WithCancel(ctx)
+	defer cancelDerived()
+
+	s.clock.Advance(time.Minute)
+	select {
+	case <-derived.Done():
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("derived context not done")
+	}
+	c.Assert(derived.Err(), gc.Equals, context.DeadlineExceeded)
+}
@@ -0,0 +1,188 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// GroupConfig holds the configuration for a Group.
+type GroupConfig struct {
+	// Clock is used to measure the group's and tasks' timeouts.
+	Clock clock.Clock
+
+	// Timeout, if positive, is the overall time allowed for the
+	// group's tasks, from when the group is created.
+	Timeout time.Duration
+
+	// CancelOnError, if true, causes the group's context to be
+	// cancelled when any task fails.
+	CancelOnError bool
+}
+
+// Validate checks that the config is valid.
+func (config GroupConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Timeout < 0 {
+		return errors.NotValidf("negative Timeout")
+	}
+	return nil
+}
+
+// Group runs tasks concurrently, each with its own timeout within the
+// group's overall timeout, and collects their errors. It is similar to
+// errgroup.Group, with timeouts measured by a Clock.
+type Group struct {
+	config GroupConfig
+	budget *Budget
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	errors []*TaskError
+}
+
+// NewGroup returns a new Group with the given configuration. The tasks'
+// contexts are derived from ctx.
+func NewGroup(ctx context.Context, config GroupConfig) (*Group, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating group config")
+	}
+	g := &Group{config: config}
+	if config.Timeout > 0 {
+		g.budget = NewBudget(config.Clock, config.Timeout)
+		g.ctx, g.cancel = g.budget.Context(ctx)
+	} else {
+		g.ctx, g.cancel = context.WithCancel(ctx)
+	}
+	return g, nil
+}
+
+// Context returns the group's context, which is done when the group's
+// timeout elapses, when a task fails if CancelOnError is set, or when
+// Wait returns.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs f in a new goroutine, with a context derived from the group's
+// context that is done after the specified timeout. If timeout is not
+// positive, the task has only the group's timeout. The name identifies
+// the task in any resulting error.
+func (g *Group) Go(name string, timeout time.Duration, f func(ctx context.Context) error) {
+	ctx, cancel := g.ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		budget := NewBudget(g.config.Clock, timeout)
+		if g.budget != nil {
+			budget = g.budget.Sub(timeout)
+		}
+		ctx, cancel = budget.Context(g.ctx)
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer cancel()
+		err := f(ctx)
+		if err == nil {
+			return
+		}
+		taskErr := &TaskError{
+			Name:    name,
+			Err:     err,
+			Timeout: ctx.Err() == context.DeadlineExceeded,
+		}
+		g.mu.Lock()
+		g.errors = append(g.errors, taskErr)
+		g.mu.Unlock()
+		if g.config.CancelOnError {
+			g.cancel()
+		}
+	}()
+}
+
+// Wait waits for all of the group's tasks to return, and returns a
+// *GroupError holding their errors, or nil if none failed. Wait does not
+// interrupt tasks that ignore their contexts' timeouts.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.errors) == 0 {
+		return nil
+	}
+	return &GroupError{Errors: append([]*TaskError(nil), g.errors...)}
+}
+
+// TaskError is the error returned by a task of a Group.
+type TaskError struct {
+	// Name is the name of the task.
+	Name string
+
+	// Err is the error returned by the task.
+	Err error
+
+	// Timeout records whether the task's context had exceeded its
+	// deadline when the task returned the error.
+	Timeout bool
+}
+
+// Error is part of the error interface.
+func (e *TaskError) Error() string {
+	if e.Timeout {
+		return fmt.Sprintf("task %q timed out: %v", e.Name, e.Err)
+	}
+	return fmt.Sprintf("task %q: %v", e.Name, e.Err)
+}
+
+// Unwrap returns the error returned by the task.
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// GroupError is the error returned by Group.Wait, holding
+// the errors of the failed tasks in the order they failed.
+type GroupError struct {
+	Errors []*TaskError
+}
+
+// Error is part of the error interface.
+func (e *GroupError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Timeouts returns the errors of the tasks that timed out.
+func (e *GroupError) Timeouts() []*TaskError {
+	return e.filter(true)
+}
+
+// Failures returns the errors of the tasks that failed
+// without timing out.
+func (e *GroupError) Failures() []*TaskError {
+	return e.filter(false)
+}
+
+func (e *GroupError) filter(timeout bool) []*TaskError {
+	var result []*TaskError
+	for _, err := range e.Errors {
+		if err.Timeout == timeout {
+			result = append(result, err)
+		}
+	}
+	return result
+}
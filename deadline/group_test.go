@@ -0,0 +1,116 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package deadline_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/deadline"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type groupSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&groupSuite{})
+
+func (s *groupSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *groupSuite) newGroup(c *gc.C, config deadline.GroupConfig) *deadline.Group {
+	config.Clock = s.clock
+	g, err := deadline.NewGroup(context.Background(), config)
+	c.Assert(err, jc.ErrorIsNil)
+	return g
+}
+
+func (s *groupSuite) TestValidate(c *gc.C) {
+	_, err := deadline.NewGroup(context.Background(), deadline.GroupConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating group config: nil Clock not valid")
+	_, err = deadline.NewGroup(context.Background(), deadline.GroupConfig{Clock: s.clock, Timeout: -1})
+	c.Assert(err, gc.ErrorMatches, "validating group config: negative Timeout not valid")
+}
+
+func (s *groupSuite) TestSuccess(c *gc.C) {
+	g := s.newGroup(c, deadline.GroupConfig{})
+	for _, name := range []string{"a", "b"} {
+		g.Go(name, time.Second, func(ctx context.Context) error {
+			return nil
+		})
+	}
+	c.Assert(g.Wait(), jc.ErrorIsNil)
+	c.Assert(g.Context().Err(), gc.Equals, context.Canceled)
+}
+
+// waitDone returns a task that waits for its context to be done,
+// signalling started before it does so.
+func waitDone(started chan<- struct{}) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return errors.Annotate(ctx.Err(), "waiting")
+	}
+}
+
+func (s *groupSuite) TestTimeoutAndFailure(c *gc.C) {
+	g := s.newGroup(c, deadline.GroupConfig{})
+	started := make(chan struct{}, 2)
+	g.Go("slow", time.Second, waitDone(started))
+	g.Go("broken", time.Second, func(ctx context.Context) error {
+		started <- struct{}{}
+		return errors.New("boom")
+	})
+	<-started
+	<-started
+	s.clock.Advance(time.Second)
+
+	err := g.Wait()
+	groupErr, ok := err.(*deadline.GroupError)
+	c.Assert(ok, jc.IsTrue, gc.Commentf("%v", err))
+	c.Assert(groupErr.Errors, gc.HasLen, 2)
+	c.Assert(groupErr.Failures(), gc.HasLen, 1)
+	c.Assert(groupErr.Failures()[0], gc.ErrorMatches, `task "broken": boom`)
+	c.Assert(groupErr.Timeouts(), gc.HasLen, 1)
+	c.Assert(groupErr.Timeouts()[0], gc.ErrorMatches, `task "slow" timed out: waiting: context deadline exceeded`)
+	c.Assert(errors.Cause(groupErr.Timeouts()[0].Err), gc.Equals, context.DeadlineExceeded)
+}
+
+func (s *groupSuite) TestGroupTimeout(c *gc.C) {
+	g := s.newGroup(c, deadline.GroupConfig{Timeout: time.Minute})
+	started := make(chan struct{}, 2)
+	g.Go("long", time.Hour, waitDone(started))
+	g.Go("unbounded", 0, waitDone(started))
+	<-started
+	<-started
+	s.clock.Advance(time.Minute)
+
+	err := g.Wait()
+	c.Assert(err, gc.FitsTypeOf, &deadline.GroupError{})
+	c.Assert(err.(*deadline.GroupError).Timeouts(), gc.HasLen, 2)
+	c.Assert(g.Context().Err(), gc.Equals, context.DeadlineExceeded)
+}
+
+func (s *groupSuite) TestCancelOnError(c *gc.C) {
+	g := s.newGroup(c, deadline.GroupConfig{CancelOnError: true})
+	started := make(chan struct{}, 1)
+	g.Go("waiting", time.Hour, waitDone(started))
+	<-started
+	g.Go("broken", 0, func(ctx context.Context) error {
+		return errors.New("boom")
+	})
+
+	err := g.Wait()
+	c.Assert(err, gc.FitsTypeOf, &deadline.GroupError{})
+	groupErr := err.(*deadline.GroupError)
+	c.Assert(groupErr.Failures(), gc.HasLen, 2)
+	c.Assert(groupErr, gc.ErrorMatches, `task "broken": boom; task "waiting": waiting: context canceled`)
+}
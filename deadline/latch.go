@@ -0,0 +1,112 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package deadline
+
+import (
+	"context"
+	"sync"
+)
+
+// LatchResult describes why a Latch's Wait method returned.
+type LatchResult int
+
+const (
+	// Released means that Done was called the latch's count of times.
+	Released LatchResult = iota
+
+	// Expired means that the latch's budget ran out before
+	// it was released.
+	Expired
+)
+
+// String is part of the fmt.Stringer interface.
+func (r LatchResult) String() string {
+	switch r {
+	case Released:
+		return "released"
+	case Expired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// Latch is a countdown latch with a deadline: it is released once Done
+// has been called a given number of times, and waiting for it gives up
+// once a Budget runs out. It is used to wait for several parties to
+// report in, for at most a fixed time.
+//
+// Latch's methods are safe for concurrent use.
+type Latch struct {
+	budget *Budget
+
+	mu       sync.Mutex
+	count    int
+	released chan struct{}
+}
+
+// NewLatch returns a new Latch that is released after Done is called
+// count times, and that expires when the budget runs out. If count is
+// not positive, the latch is released immediately; if budget is nil,
+// the latch never expires.
+func NewLatch(count int, budget *Budget) *Latch {
+	l := &Latch{
+		budget:   budget,
+		count:    count,
+		released: make(chan struct{}),
+	}
+	if count <= 0 {
+		l.count = 0
+		close(l.released)
+	}
+	return l
+}
+
+// Done counts down the latch, releasing it when the count reaches
+// zero. Calls to Done once the latch is released have no effect.
+func (l *Latch) Done() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count == 0 {
+		return
+	}
+	l.count--
+	if l.count == 0 {
+		close(l.released)
+	}
+}
+
+// Count returns the number of calls to Done still
+// required to release the latch.
+func (l *Latch) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// Wait waits until the latch is released, or its budget runs out, and
+// reports which happened. A latch that is released is reported as such,
+// even if its budget has since run out. If ctx is done first, Wait
+// returns ctx.Err().
+func (l *Latch) Wait(ctx context.Context) (LatchResult, error) {
+	select {
+	case <-l.released:
+		return Released, nil
+	default:
+	}
+	expired := ctx
+	if l.budget != nil {
+		var cancel context.CancelFunc
+		expired, cancel = l.budget.Context(ctx)
+		defer cancel()
+	}
+	select {
+	case <-l.released:
+		return Released, nil
+	case <-expired.Done():
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return Expired, nil
+	}
+}
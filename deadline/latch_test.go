@@ -0,0 +1,105 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package deadline_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/deadline"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type latchSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&latchSuite{})
+
+func (s *latchSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+type latchWait struct {
+	result deadline.LatchResult
+	err    error
+}
+
+func waitLatch(ctx context.Context, l *deadline.Latch) <-chan latchWait {
+	ch := make(chan latchWait, 1)
+	go func() {
+		result, err := l.Wait(ctx)
+		ch <- latchWait{result, err}
+	}()
+	return ch
+}
+
+func (s *latchSuite) TestReleased(c *gc.C) {
+	l := deadline.NewLatch(3, deadline.NewBudget(s.clock, 30*time.Second))
+	waited := waitLatch(context.Background(), l)
+	l.Done()
+	l.Done()
+	c.Assert(l.Count(), gc.Equals, 1)
+	select {
+	case <-waited:
+		c.Fatalf("latch released early")
+	case <-time.After(coretesting.ShortWait):
+	}
+	l.Done()
+	l.Done()
+	c.Assert(l.Count(), gc.Equals, 0)
+	select {
+	case w := <-waited:
+		c.Assert(w.err, jc.ErrorIsNil)
+		c.Assert(w.result, gc.Equals, deadline.Released)
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for latch")
+	}
+
+	// A released latch stays released, even once
+	// its budget has run out.
+	s.clock.Advance(time.Minute)
+	result, err := l.Wait(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, gc.Equals, deadline.Released)
+}
+
+func (s *latchSuite) TestExpired(c *gc.C) {
+	l := deadline.NewLatch(2, deadline.NewBudget(s.clock, 30*time.Second))
+	l.Done()
+	waited := waitLatch(context.Background(), l)
+	for {
+		select {
+		case w := <-waited:
+			c.Assert(w.err, jc.ErrorIsNil)
+			c.Assert(w.result, gc.Equals, deadline.Expired)
+			c.Assert(w.result.String(), gc.Equals, "expired")
+			c.Assert(l.Count(), gc.Equals, 1)
+			return
+		case <-time.After(coretesting.ShortWait):
+			s.clock.Advance(30 * time.Second)
+		}
+	}
+}
+
+func (s *latchSuite) TestZeroCount(c *gc.C) {
+	l := deadline.NewLatch(0, nil)
+	result, err := l.Wait(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, gc.Equals, deadline.Released)
+	l.Done()
+	c.Assert(l.Count(), gc.Equals, 0)
+}
+
+func (s *latchSuite) TestContextDone(c *gc.C) {
+	l := deadline.NewLatch(1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := l.Wait(ctx)
+	c.Assert(err, gc.Equals, context.Canceled)
+}
@@ -0,0 +1,191 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package deadline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/duration"
+	"github.com/juju/errors"
+)
+
+// TimeBudget is a Budget that is divided among the stages of a pipeline,
+// and accounts for the time taken by each. Each stage is carved from the
+// budget with Slice or Fixed, before it starts, and marked done when it
+// finishes; Usage then reports where the time went.
+//
+// TimeBudget's methods are safe for concurrent use.
+type TimeBudget struct {
+	*Budget
+	total time.Duration
+	start time.Time
+
+	mu     sync.Mutex
+	stages []*Stage
+}
+
+// NewTimeBudget returns a TimeBudget of the given total duration,
+// starting now as measured by the given Clock.
+func NewTimeBudget(clock clock.Clock, total time.Duration) *TimeBudget {
+	budget := NewBudget(clock, total)
+	return &TimeBudget{
+		Budget: budget,
+		total:  total,
+		start:  budget.deadline.Add(-total),
+	}
+}
+
+// Slice returns a stage whose budget is the given fraction of the total
+// budget, or the time remaining, whichever is less. Slice will panic if
+// the fraction is not in the range (0, 1].
+func (b *TimeBudget) Slice(fraction float64) *Stage {
+	if fraction <= 0 || fraction > 1 {
+		panic(errors.NotValidf("fraction %v", fraction))
+	}
+	return b.stage(duration.Scale(b.total, fraction))
+}
+
+// Fixed returns a stage whose budget is the given duration, or the time
+// remaining, whichever is less. Fixed will panic if the duration is
+// negative.
+func (b *TimeBudget) Fixed(d time.Duration) *Stage {
+	if d < 0 {
+		panic(errors.NotValidf("negative duration %v", d))
+	}
+	return b.stage(d)
+}
+
+func (b *TimeBudget) stage(d time.Duration) *Stage {
+	// The stage's deadline and allotment are measured from the
+	// same time, so that it is allotted all of d if it remains.
+	now := b.clock.Now()
+	sub := b.subAt(now, d)
+	s := &Stage{
+		Budget:   sub,
+		start:    now,
+		allotted: sub.deadline.Sub(now),
+	}
+	if s.allotted < 0 {
+		s.allotted = 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s.index = len(b.stages)
+	b.stages = append(b.stages, s)
+	return s
+}
+
+// Elapsed returns the time elapsed since the budget started.
+func (b *TimeBudget) Elapsed() time.Duration {
+	return b.clock.Now().Sub(b.start)
+}
+
+// Usage returns the accounting of the stages carved from the budget,
+// in the order that they were carved. Stages that are not yet done are
+// accounted up to the current time.
+func (b *TimeBudget) Usage() []StageUsage {
+	b.mu.Lock()
+	stages := append([]*Stage(nil), b.stages...)
+	b.mu.Unlock()
+	usage := make([]StageUsage, len(stages))
+	for i, s := range stages {
+		usage[i] = s.Usage()
+	}
+	return usage
+}
+
+// Unaccounted returns the time elapsed since the budget started that
+// was not used by any stage, such as the time between stages.
+// Overlapping stages are each accounted in full, so Unaccounted may
+// be negative if stages ran concurrently.
+func (b *TimeBudget) Unaccounted() time.Duration {
+	// The elapsed time and the stages' usage are measured
+	// at the same time, so that no time is unaccounted for
+	// the stages that are not yet done.
+	now := b.clock.Now()
+	d := now.Sub(b.start)
+	b.mu.Lock()
+	stages := append([]*Stage(nil), b.stages...)
+	b.mu.Unlock()
+	for _, s := range stages {
+		d -= s.usage(now).Used
+	}
+	return d
+}
+
+// Stage is the budget for a stage of a pipeline, carved from a
+// TimeBudget. Its embedded Budget provides the stage's deadline,
+// and a context bounded by it.
+type Stage struct {
+	*Budget
+	index    int
+	start    time.Time
+	allotted time.Duration
+
+	mu   sync.Mutex
+	end  time.Time
+	done bool
+}
+
+// Done marks the stage as finished, and returns the time it used.
+// Calls to Done after the first have no effect, and return the same
+// duration.
+func (s *Stage) Done() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.done {
+		s.end = s.clock.Now()
+		s.done = true
+	}
+	return s.end.Sub(s.start)
+}
+
+// Usage returns the stage's accounting. If the stage is not yet done,
+// it is accounted up to the current time.
+func (s *Stage) Usage() StageUsage {
+	return s.usage(s.clock.Now())
+}
+
+// usage returns the stage's accounting, as of the specified
+// time if the stage is not yet done.
+func (s *Stage) usage(now time.Time) StageUsage {
+	s.mu.Lock()
+	end, done := s.end, s.done
+	s.mu.Unlock()
+	if !done {
+		end = now
+	}
+	used := end.Sub(s.start)
+	return StageUsage{
+		Index:    s.index,
+		Allotted: s.allotted,
+		Used:     used,
+		Done:     done,
+		Overrun:  used > s.allotted,
+	}
+}
+
+// StageUsage describes the time allotted to, and used by, a stage.
+type StageUsage struct {
+	// Index is the position of the stage, in the order that
+	// stages were carved from the budget.
+	Index int
+
+	// Allotted is the time allotted to the stage when it
+	// was carved from the budget.
+	Allotted time.Duration
+
+	// Used is the time used by the stage, from when it was
+	// carved until it was done, or until now if it is not.
+	Used time.Duration
+
+	// Done reports whether the stage has been marked done.
+	Done bool
+
+	// Overrun reports whether the stage used more time than
+	// it was allotted.
+	Overrun bool
+}
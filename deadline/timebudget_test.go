@@ -0,0 +1,107 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package deadline_test
+
+import (
+	"context"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/deadline"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type timeBudgetSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&timeBudgetSuite{})
+
+func (s *timeBudgetSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *timeBudgetSuite) TestStages(c *gc.C) {
+	b := deadline.NewTimeBudget(s.clock, 10*time.Second)
+	c.Assert(b.Remaining(), gc.Equals, 10*time.Second)
+
+	first := b.Slice(0.3)
+	c.Assert(first.Deadline(), gc.Equals, s.clock.Now().Add(3*time.Second))
+	s.clock.Advance(2 * time.Second)
+	c.Assert(first.Done(), gc.Equals, 2*time.Second)
+	c.Assert(first.Done(), gc.Equals, 2*time.Second)
+
+	s.clock.Advance(time.Second)
+	second := b.Fixed(5 * time.Second)
+	c.Assert(second.Remaining(), gc.Equals, 5*time.Second)
+	s.clock.Advance(6 * time.Second)
+	c.Assert(second.Exhausted(), jc.IsTrue)
+
+	// Stages are capped by the time remaining.
+	third := b.Slice(0.5)
+	c.Assert(third.Remaining(), gc.Equals, time.Second)
+	c.Assert(third.Deadline(), gc.Equals, b.Deadline())
+
+	c.Assert(b.Usage(), jc.DeepEquals, []deadline.StageUsage{{
+		Index:    0,
+		Allotted: 3 * time.Second,
+		Used:     2 * time.Second,
+		Done:     true,
+	}, {
+		Index:    1,
+		Allotted: 5 * time.Second,
+		Used:     6 * time.Second,
+		Overrun:  true,
+	}, {
+		Index:    2,
+		Allotted: time.Second,
+	}})
+	c.Assert(b.Elapsed(), gc.Equals, 9*time.Second)
+	c.Assert(b.Unaccounted(), gc.Equals, time.Second)
+}
+
+func (s *timeBudgetSuite) TestExhausted(c *gc.C) {
+	b := deadline.NewTimeBudget(s.clock, time.Second)
+	s.clock.Advance(2 * time.Second)
+	stage := b.Fixed(time.Second)
+	c.Assert(stage.Exhausted(), jc.IsTrue)
+	c.Assert(stage.Usage().Allotted, gc.Equals, time.Duration(0))
+
+	ctx, cancel := stage.Context(context.Background())
+	defer cancel()
+	c.Assert(ctx.Err(), gc.Equals, context.DeadlineExceeded)
+}
+
+func (s *timeBudgetSuite) TestInvalid(c *gc.C) {
+	b := deadline.NewTimeBudget(s.clock, time.Second)
+	c.Assert(func() { b.Slice(0) }, gc.PanicMatches, "fraction 0 not valid")
+	c.Assert(func() { b.Slice(1.5) }, gc.PanicMatches, "fraction 1.5 not valid")
+	c.Assert(func() { b.Fixed(-time.Second) }, gc.PanicMatches, "negative duration -1s not valid")
+	c.Assert(b.Usage(), gc.HasLen, 0)
+}
+
+func (s *timeBudgetSuite) TestMovingClock(c *gc.C) {
+	for seed := int64(0); seed < 10; seed++ {
+		clock := clocktesting.NewRandomClock(time.Time{}, seed, time.Millisecond)
+		b := deadline.NewTimeBudget(clock, 10*time.Second)
+
+		// Stages are allotted their full durations, and the time
+		// between sequential stages is never negative, however
+		// the time moves between observations.
+		first := b.Fixed(time.Second)
+		first.Done()
+		second := b.Slice(0.1)
+		for _, usage := range b.Usage() {
+			c.Assert(usage.Allotted, gc.Equals, time.Second, gc.Commentf("seed %d", clock.Seed()))
+			c.Assert(usage.Overrun, jc.IsFalse)
+		}
+		c.Assert(b.Unaccounted() >= 0, jc.IsTrue, gc.Commentf("seed %d", clock.Seed()))
+		second.Done()
+		c.Assert(b.Unaccounted() >= 0, jc.IsTrue, gc.Commentf("seed %d", clock.Seed()))
+	}
+}
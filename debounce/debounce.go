@@ -0,0 +1,158 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package debounce provides a Debouncer, which coalesces bursts of
+// triggers into a single call of a function, once the triggers have
+// stopped for a quiet period, and WaitQuiet, which waits for a stream
+// of events to stop for a quiet period.
+package debounce
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Debouncer.
+type Config struct {
+	// Clock is used to measure the quiet period.
+	Clock clock.Clock
+
+	// Quiet is the period without triggers that must elapse
+	// before Func is called.
+	Quiet time.Duration
+
+	// Func is the function to call.
+	Func func()
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Quiet <= 0 {
+		return errors.NotValidf("non-positive Quiet")
+	}
+	if config.Func == nil {
+		return errors.NotValidf("nil Func")
+	}
+	return nil
+}
+
+// Debouncer calls a function once a quiet period has elapsed since it
+// was last triggered. Each call to Trigger restarts the quiet period,
+// so a storm of triggers results in a single call, after the storm has
+// passed.
+//
+// The function is called in the Debouncer's own goroutine, and never
+// concurrently with itself. Debouncer's methods are safe for concurrent
+// use.
+type Debouncer struct {
+	config Config
+
+	mu sync.Mutex
+	// pending records whether the Debouncer has been triggered
+	// since it last called Func, and last records the time of the
+	// most recent trigger.
+	pending bool
+	last    time.Time
+
+	wake     chan struct{}
+	flush    chan chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewDebouncer returns a new Debouncer with the given configuration.
+// The Debouncer runs until it is stopped.
+func NewDebouncer(config Config) (*Debouncer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating debouncer config")
+	}
+	d := &Debouncer{
+		config: config,
+		wake:   make(chan struct{}, 1),
+		flush:  make(chan chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go d.loop()
+	return d, nil
+}
+
+// Trigger triggers the Debouncer, restarting the quiet period.
+// Trigger does not block.
+func (d *Debouncer) Trigger() {
+	d.mu.Lock()
+	d.pending = true
+	d.last = d.config.Clock.Now()
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Flush calls the function immediately if the Debouncer has been
+// triggered since it last did so, and waits for the call to complete.
+// If the Debouncer has been stopped, Flush does nothing.
+func (d *Debouncer) Flush() {
+	reply := make(chan struct{})
+	select {
+	case d.flush <- reply:
+		<-reply
+	case <-d.done:
+	}
+}
+
+// Stop stops the Debouncer, discarding any pending call, and waits for
+// any call in progress to complete. Once stopped, triggers are ignored.
+func (d *Debouncer) Stop() {
+	d.stopOnce.Do(func() { close(d.stop) })
+	<-d.done
+}
+
+func (d *Debouncer) loop() {
+	defer close(d.done)
+	for {
+		var quiet <-chan time.Time
+		d.mu.Lock()
+		if d.pending {
+			quiet = clock.Alarm(d.config.Clock, d.last.Add(d.config.Quiet))
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-d.stop:
+			return
+		case <-d.wake:
+		case reply := <-d.flush:
+			d.call(true)
+			close(reply)
+		case <-quiet:
+			d.call(false)
+		}
+	}
+}
+
+// call calls the function if the Debouncer is pending and, unless
+// force is true, the quiet period has elapsed.
+func (d *Debouncer) call(force bool) {
+	d.mu.Lock()
+	ready := d.pending
+	if ready && !force && d.config.Clock.Now().Before(d.last.Add(d.config.Quiet)) {
+		// Triggered again since the alarm was set.
+		ready = false
+	}
+	if ready {
+		d.pending = false
+	}
+	d.mu.Unlock()
+	if ready {
+		d.config.Func()
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package debounce_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/debounce"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type debounceSuite struct {
+	coretesting.BaseSuite
+	clock  *coretesting.Clock
+	called chan time.Time
+}
+
+var _ = gc.Suite(&debounceSuite{})
+
+func (s *debounceSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.called = make(chan time.Time, 10)
+}
+
+func (s *debounceSuite) newDebouncer(c *gc.C) *debounce.Debouncer {
+	d, err := debounce.NewDebouncer(debounce.Config{
+		Clock: s.clock,
+		Quiet: time.Second,
+		Func: func() {
+			s.called <- s.clock.Now()
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return d
+}
+
+func (s *debounceSuite) TestValidate(c *gc.C) {
+	_, err := debounce.NewDebouncer(debounce.Config{Clock: s.clock, Quiet: time.Second})
+	c.Assert(err, gc.ErrorMatches, "validating debouncer config: nil Func not valid")
+}
+
+func (s *debounceSuite) TestTriggerRestartsQuietPeriod(c *gc.C) {
+	d := s.newDebouncer(c)
+	defer d.Stop()
+
+	t0 := s.clock.Now()
+	for i := 0; i < 5; i++ {
+		d.Trigger()
+		s.clock.Advance(500 * time.Millisecond)
+		assertNotCalled(c, s.called)
+	}
+	// The quiet period runs from the final trigger.
+	s.clock.Advance(500 * time.Millisecond)
+	c.Assert(receive(c, s.called), gc.Equals, t0.Add(3*time.Second))
+	s.clock.Advance(time.Minute)
+	assertNotCalled(c, s.called)
+}
+
+func (s *debounceSuite) TestFlush(c *gc.C) {
+	d := s.newDebouncer(c)
+	defer d.Stop()
+
+	// Flushing without a trigger does nothing.
+	d.Flush()
+	assertNotCalled(c, s.called)
+
+	d.Trigger()
+	d.Flush()
+	c.Assert(s.called, gc.HasLen, 1)
+	<-s.called
+	s.clock.Advance(time.Minute)
+	assertNotCalled(c, s.called)
+}
+
+func (s *debounceSuite) TestStopDiscardsPending(c *gc.C) {
+	d := s.newDebouncer(c)
+	d.Trigger()
+	d.Stop()
+	d.Stop()
+	d.Trigger()
+	d.Flush()
+	s.clock.Advance(time.Minute)
+	assertNotCalled(c, s.called)
+}
+
+func (s *debounceSuite) TestConcurrentStop(c *gc.C) {
+	d := s.newDebouncer(c)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotCalled[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected call at %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
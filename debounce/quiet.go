@@ -0,0 +1,43 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package debounce
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// WaitQuiet receives events from the channel until none has arrived for
+// the quiet period, as measured by the clock, and then returns nil. The
+// quiet period starts when WaitQuiet is called, and restarts with each
+// event; the events themselves are discarded. If the channel is closed,
+// WaitQuiet waits out the remainder of the quiet period. If the context
+// is done first, WaitQuiet returns the context's error.
+func WaitQuiet[T any](ctx context.Context, clk clock.Clock, quiet time.Duration, events <-chan T) error {
+	last := clk.Now()
+	timer := clock.NewTimer(clk, quiet)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			// Rather than resetting the timer for each event, let
+			// it fire and then wait out the rest of the period.
+			last = clk.Now()
+		case now := <-timer.Chan():
+			remaining := last.Add(quiet).Sub(now)
+			if remaining <= 0 {
+				return nil
+			}
+			timer.Reset(remaining)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package debounce_test
+
+import (
+	"context"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/debounce"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type quietSuite struct {
+	coretesting.BaseSuite
+	clock   *clocktesting.Clock
+	harness *clocktesting.Harness
+}
+
+var _ = gc.Suite(&quietSuite{})
+
+func (s *quietSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = clocktesting.NewClock(time.Time{})
+	s.harness = clocktesting.NewHarness(s.clock)
+}
+
+// waitQuiet calls WaitQuiet in a goroutine, with a quiet period
+// of one second, and waits for it to start waiting.
+func (s *quietSuite) waitQuiet(c *gc.C, ctx context.Context, events <-chan int) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- debounce.WaitQuiet(ctx, s.clock, time.Second, events)
+	}()
+	s.harness.Settle(c)
+	return result
+}
+
+func (s *quietSuite) TestNoEvents(c *gc.C) {
+	result := s.waitQuiet(c, context.Background(), make(chan int))
+	s.harness.AdvanceAndSettle(c, 999*time.Millisecond)
+	assertNotCalled(c, result)
+	s.clock.Advance(time.Millisecond)
+	c.Assert(receive(c, result), jc.ErrorIsNil)
+}
+
+func (s *quietSuite) TestEventsRestartQuietPeriod(c *gc.C) {
+	events := make(chan int)
+	result := s.waitQuiet(c, context.Background(), events)
+	for i := 0; i < 5; i++ {
+		s.harness.AdvanceAndSettle(c, 500*time.Millisecond)
+		events <- i
+		s.harness.Settle(c)
+	}
+	// The quiet period runs from the final event.
+	s.harness.AdvanceAndSettle(c, 999*time.Millisecond)
+	assertNotCalled(c, result)
+	s.clock.Advance(time.Millisecond)
+	c.Assert(receive(c, result), jc.ErrorIsNil)
+	s.harness.AssertNoLeaks(c)
+}
+
+func (s *quietSuite) TestClosed(c *gc.C) {
+	events := make(chan int)
+	result := s.waitQuiet(c, context.Background(), events)
+	s.harness.AdvanceAndSettle(c, 500*time.Millisecond)
+	events <- 0
+	close(events)
+	s.harness.Settle(c)
+	s.harness.AdvanceAndSettle(c, 999*time.Millisecond)
+	assertNotCalled(c, result)
+	s.clock.Advance(time.Millisecond)
+	c.Assert(receive(c, result), jc.ErrorIsNil)
+}
+
+func (s *quietSuite) TestContextDone(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan int)
+	result := s.waitQuiet(c, ctx, events)
+	s.harness.AdvanceAndSettle(c, 500*time.Millisecond)
+	events <- 0
+	cancel()
+	c.Assert(receive(c, result), gc.Equals, context.Canceled)
+	s.harness.AssertNoLeaks(c)
+}
@@ -0,0 +1,291 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package debughttp provides net/http handlers that render the state of
+// Runners and Schedulers, for attaching to a debug server alongside
+// net/http/pprof and expvar.
+//
+// The handlers render plain text by default, or JSON if the request has
+// the query parameter "format=json". The number of operations or events
+// rendered in each section is limited by the query parameter "limit",
+// which defaults to DefaultLimit.
+package debughttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/scheduler"
+)
+
+// DefaultLimit is the number of items rendered in each section of
+// a page, if the request does not specify a limit.
+const DefaultLimit = 100
+
+// RunnerHandler returns an http.Handler that renders a snapshot of the
+// runner's state: its pending, blocked, queued, executing and parked
+// operations, its schedule's recent decisions, if it has an audit log,
+// and its recorded latencies. Operations are identified by their keys,
+// formatted with fmt.Sprint.
+func RunnerHandler[K comparable, O schedule.RunnableOperation[K]](runner *schedule.Runner[K, O]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limit, ok := parseLimit(w, req)
+		if !ok {
+			return
+		}
+		render(w, req, newRunnerPage(runner.Snapshot(), limit))
+	})
+}
+
+// SchedulerHandler returns an http.Handler that renders the state of
+// the scheduler's jobs, ordered by name.
+func SchedulerHandler(s *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limit, ok := parseLimit(w, req)
+		if !ok {
+			return
+		}
+		render(w, req, newSchedulerPage(s.ListJobs(), limit))
+	})
+}
+
+// page is a page rendered by a handler.
+type page interface {
+	writeText(w io.Writer)
+}
+
+func parseLimit(w http.ResponseWriter, req *http.Request) (int, bool) {
+	value := req.URL.Query().Get("limit")
+	if value == "" {
+		return DefaultLimit, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		http.Error(w, fmt.Sprintf("invalid limit %q", value), http.StatusBadRequest)
+		return 0, false
+	}
+	return limit, true
+}
+
+func render(w http.ResponseWriter, req *http.Request, p page) {
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		p.writeText(w)
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(p)
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+	}
+}
+
+// section is a list of items, truncated to the limit; Total
+// records the number of items before truncation.
+type section[T any] struct {
+	Total int `json:"total"`
+	Items []T `json:"items"`
+}
+
+func newSection[T any](items []T, limit int) section[T] {
+	s := section[T]{Total: len(items), Items: items}
+	if len(items) > limit {
+		s.Items = items[:limit]
+	}
+	if s.Items == nil {
+		s.Items = []T{}
+	}
+	return s
+}
+
+// writeTable writes the section as a table with the given title and
+// column headings, separated by tabs, and formatting each item with
+// row.
+func writeTable[T any](w io.Writer, title, headings string, s section[T], row func(T) string) {
+	fmt.Fprintf(w, "%s (%d):\n", title, s.Total)
+	if s.Total == 0 {
+		fmt.Fprintln(w)
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, headings)
+	for _, item := range s.Items {
+		fmt.Fprintln(tw, row(item))
+	}
+	tw.Flush()
+	if n := s.Total - len(s.Items); n > 0 {
+		fmt.Fprintf(w, "... %d more\n", n)
+	}
+	fmt.Fprintln(w)
+}
+
+// formatTime formats a time for display, or "-" if it is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+type runnerPage struct {
+	Time      time.Time              `json:"time"`
+	Pending   section[pendingItem]   `json:"pending"`
+	Blocked   section[string]        `json:"blocked"`
+	Queued    section[string]        `json:"queued"`
+	Executing section[executingItem] `json:"executing"`
+	Parked    section[string]        `json:"parked"`
+	Recent    section[auditItem]     `json:"recent"`
+	Latencies section[latencyItem]   `json:"latencies"`
+}
+
+type pendingItem struct {
+	Key  string        `json:"key"`
+	Time time.Time     `json:"time"`
+	In   time.Duration `json:"in"`
+}
+
+type executingItem struct {
+	Key     string        `json:"key"`
+	Started time.Time     `json:"started"`
+	For     time.Duration `json:"for"`
+}
+
+type auditItem struct {
+	Time      time.Time     `json:"time"`
+	Kind      string        `json:"kind"`
+	Key       string        `json:"key"`
+	Scheduled time.Time     `json:"scheduled"`
+	Delay     time.Duration `json:"delay"`
+}
+
+type latencyItem struct {
+	Class string        `json:"class"`
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	Max   time.Duration `json:"max"`
+	Last  time.Duration `json:"last"`
+	Rate  float64       `json:"rate"`
+}
+
+func newRunnerPage[K comparable, O schedule.Operation[K]](snapshot schedule.RunnerSnapshot[K, O], limit int) *runnerPage {
+	keys := func(ops []O) []string {
+		keys := make([]string, len(ops))
+		for i, op := range ops {
+			keys[i] = fmt.Sprint(op.Key())
+		}
+		return keys
+	}
+	now := snapshot.Time
+	pending := make([]pendingItem, len(snapshot.Pending))
+	for i, p := range snapshot.Pending {
+		pending[i] = pendingItem{fmt.Sprint(p.Op.Key()), p.Time, p.Time.Sub(now)}
+	}
+	executing := make([]executingItem, len(snapshot.Executing))
+	for i, e := range snapshot.Executing {
+		executing[i] = executingItem{fmt.Sprint(e.Op.Key()), e.Started, now.Sub(e.Started)}
+	}
+	// The most recent events are the most interesting,
+	// so they are rendered first.
+	recent := make([]auditItem, len(snapshot.AuditLog))
+	for i, e := range snapshot.AuditLog {
+		recent[len(recent)-1-i] = auditItem{e.Time, e.Kind.String(), fmt.Sprint(e.Key), e.Scheduled, e.Delay}
+	}
+	latencies := make([]latencyItem, 0, len(snapshot.Latencies))
+	for class, l := range snapshot.Latencies {
+		latencies = append(latencies, latencyItem{class, l.Count, l.Mean, l.Max, l.Last, l.Rate})
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i].Class < latencies[j].Class
+	})
+	return &runnerPage{
+		Time:      now,
+		Pending:   newSection(pending, limit),
+		Blocked:   newSection(keys(snapshot.Blocked), limit),
+		Queued:    newSection(keys(snapshot.Queued), limit),
+		Executing: newSection(executing, limit),
+		Parked:    newSection(keys(snapshot.Parked), limit),
+		Recent:    newSection(recent, limit),
+		Latencies: newSection(latencies, limit),
+	}
+}
+
+func (p *runnerPage) writeText(w io.Writer) {
+	fmt.Fprintf(w, "time: %s\n\n", formatTime(p.Time))
+	writeTable(w, "pending", "KEY\tTIME\tIN", p.Pending, func(item pendingItem) string {
+		return fmt.Sprintf("%s\t%s\t%v", item.Key, formatTime(item.Time), item.In)
+	})
+	writeTable(w, "blocked", "KEY", p.Blocked, func(key string) string { return key })
+	writeTable(w, "queued", "KEY", p.Queued, func(key string) string { return key })
+	writeTable(w, "executing", "KEY\tSTARTED\tFOR", p.Executing, func(item executingItem) string {
+		return fmt.Sprintf("%s\t%s\t%v", item.Key, formatTime(item.Started), item.For)
+	})
+	writeTable(w, "parked", "KEY", p.Parked, func(key string) string { return key })
+	writeTable(w, "recent", "TIME\tKIND\tKEY\tSCHEDULED\tDELAY", p.Recent, func(item auditItem) string {
+		return fmt.Sprintf("%s\t%s\t%s\t%s\t%v", formatTime(item.Time), item.Kind, item.Key, formatTime(item.Scheduled), item.Delay)
+	})
+	writeTable(w, "latencies", "CLASS\tCOUNT\tMEAN\tMAX\tLAST\tRATE", p.Latencies, func(item latencyItem) string {
+		return fmt.Sprintf("%s\t%d\t%v\t%v\t%v\t%.3g/s", item.Class, item.Count, item.Mean, item.Max, item.Last, item.Rate)
+	})
+}
+
+type schedulerPage struct {
+	Jobs section[jobItem] `json:"jobs"`
+}
+
+type jobItem struct {
+	Name         string        `json:"name"`
+	Next         time.Time     `json:"next"`
+	Paused       bool          `json:"paused"`
+	Running      bool          `json:"running"`
+	Runs         int           `json:"runs"`
+	Failures     int           `json:"failures"`
+	LastRun      time.Time     `json:"last-run"`
+	LastDuration time.Duration `json:"last-duration"`
+	LastError    string        `json:"last-error,omitempty"`
+}
+
+func newSchedulerPage(jobs []scheduler.JobInfo, limit int) *schedulerPage {
+	items := make([]jobItem, len(jobs))
+	for i, j := range jobs {
+		items[i] = jobItem{
+			Name:         j.Name,
+			Next:         j.Next,
+			Paused:       j.Paused,
+			Running:      j.Running,
+			Runs:         j.Runs,
+			Failures:     j.Failures,
+			LastRun:      j.LastRun,
+			LastDuration: j.LastDuration,
+		}
+		if j.LastError != nil {
+			items[i].LastError = j.LastError.Error()
+		}
+	}
+	return &schedulerPage{Jobs: newSection(items, limit)}
+}
+
+func (p *schedulerPage) writeText(w io.Writer) {
+	writeTable(w, "jobs", "NAME\tSTATE\tNEXT\tRUNS\tFAILURES\tLAST RUN\tLAST DURATION\tLAST ERROR", p.Jobs, func(j jobItem) string {
+		state := "idle"
+		switch {
+		case j.Running:
+			state = "running"
+		case j.Paused:
+			state = "paused"
+		}
+		lastError := j.LastError
+		if lastError == "" {
+			lastError = "-"
+		}
+		return fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%s\t%v\t%s", j.Name, state, formatTime(j.Next), j.Runs, j.Failures, formatTime(j.LastRun), j.LastDuration, lastError)
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package debughttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/axw/juju-time/debughttp"
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/scheduler"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type debugSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&debugSuite{})
+
+func (s *debugSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+type operation struct {
+	key   string
+	delay time.Duration
+	do    func(ctx context.Context) error
+}
+
+func (o operation) Key() string                  { return o.key }
+func (o operation) Delay() time.Duration         { return o.delay }
+func (o operation) Do(ctx context.Context) error { return o.do(ctx) }
+
+// newRunner returns a Runner with an operation that is pending, and
+// one that is executing until the returned channel is closed.
+func (s *debugSuite) newRunner(c *gc.C) (*schedule.Runner[string, operation], chan struct{}) {
+	sched, err := schedule.New(schedule.Config[string, operation]{Clock: s.clock, AuditSize: 10})
+	c.Assert(err, jc.ErrorIsNil)
+	r, err := schedule.NewRunner(schedule.RunnerConfig[string, operation]{Schedule: sched})
+	c.Assert(err, jc.ErrorIsNil)
+	release := make(chan struct{})
+	r.Add(operation{key: "later", delay: time.Minute})
+	r.Add(operation{key: "now", do: func(ctx context.Context) error {
+		<-release
+		return nil
+	}})
+	timeout := time.After(coretesting.LongWait)
+	for r.Active() != 1 {
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for operation to execute")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return r, release
+}
+
+func get(c *gc.C, h http.Handler, url string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *debugSuite) TestRunnerText(c *gc.C) {
+	r, release := s.newRunner(c)
+	defer r.Kill()
+	defer close(release)
+
+	rec := get(c, debughttp.RunnerHandler(r), "/debug/runner")
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), gc.Equals, "text/plain; charset=utf-8")
+	c.Assert(rec.Body.String(), gc.Matches, `(?s)time: 2015-01-01T00:00:00Z
+
+pending \(1\):
+KEY    TIME                  IN
+later  2015-01-01T00:01:00Z  1m0s
+
+blocked \(0\):
+
+queued \(0\):
+
+executing \(1\):
+KEY  STARTED               FOR
+now  2015-01-01T00:00:00Z  0s
+
+parked \(0\):
+
+recent \(3\):
+TIME +KIND +KEY +SCHEDULED +DELAY
+.* +ready +now .*
+.* +add +now .*
+.* +add +later +2015-01-01T00:01:00Z +1m0s
+
+latencies \(0\):
+
+`)
+}
+
+func (s *debugSuite) TestRunnerJSON(c *gc.C) {
+	r, release := s.newRunner(c)
+	defer r.Kill()
+	defer close(release)
+
+	rec := get(c, debughttp.RunnerHandler(r), "/debug/runner?format=json&limit=1")
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), gc.Equals, "application/json")
+	var page struct {
+		Pending struct {
+			Total int
+			Items []struct {
+				Key  string
+				Time time.Time
+			}
+		}
+		Recent struct {
+			Total int
+			Items []struct{ Kind, Key string }
+		}
+	}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &page), jc.ErrorIsNil)
+	c.Assert(page.Pending.Total, gc.Equals, 1)
+	c.Assert(page.Pending.Items, gc.HasLen, 1)
+	c.Assert(page.Pending.Items[0].Key, gc.Equals, "later")
+	c.Assert(page.Pending.Items[0].Time.Equal(s.clock.Now().Add(time.Minute)), jc.IsTrue)
+	// Only the most recent event is rendered.
+	c.Assert(page.Recent.Total, gc.Equals, 3)
+	c.Assert(page.Recent.Items, gc.HasLen, 1)
+	c.Assert(page.Recent.Items[0].Kind, gc.Equals, "ready")
+	c.Assert(page.Recent.Items[0].Key, gc.Equals, "now")
+}
+
+func (s *debugSuite) TestLimit(c *gc.C) {
+	sched := schedule.NewSchedule[string, operation](s.clock)
+	r, err := schedule.NewRunner(schedule.RunnerConfig[string, operation]{Schedule: sched})
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Kill()
+	for _, key := range []string{"k0", "k1", "k2"} {
+		r.Add(operation{key: key, delay: time.Minute})
+	}
+	rec := get(c, debughttp.RunnerHandler(r), "/?limit=2")
+	c.Assert(rec.Body.String(), gc.Matches, `(?s).*pending \(3\):\nKEY.*\nk.*\nk.*\n\.\.\. 1 more\n.*`)
+}
+
+func (s *debugSuite) TestBadRequest(c *gc.C) {
+	sched := schedule.NewSchedule[string, operation](s.clock)
+	r, err := schedule.NewRunner(schedule.RunnerConfig[string, operation]{Schedule: sched})
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Kill()
+
+	h := debughttp.RunnerHandler(r)
+	rec := get(c, h, "/?format=xml")
+	c.Assert(rec.Code, gc.Equals, http.StatusBadRequest)
+	c.Assert(rec.Body.String(), gc.Equals, "unknown format \"xml\"\n")
+	rec = get(c, h, "/?limit=-1")
+	c.Assert(rec.Code, gc.Equals, http.StatusBadRequest)
+	c.Assert(rec.Body.String(), gc.Equals, "invalid limit \"-1\"\n")
+}
+
+func (s *debugSuite) TestScheduler(c *gc.C) {
+	sch, err := scheduler.New(scheduler.Config{Clock: s.clock})
+	c.Assert(err, jc.ErrorIsNil)
+	f := func(ctx context.Context) error { return nil }
+	c.Assert(sch.AddJob("backup", scheduler.Every(time.Hour), f), jc.ErrorIsNil)
+	c.Assert(sch.AddJob("audit", scheduler.Every(time.Hour), f), jc.ErrorIsNil)
+	c.Assert(sch.PauseJob("audit"), jc.ErrorIsNil)
+
+	rec := get(c, debughttp.SchedulerHandler(sch), "/")
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Body.String(), gc.Equals, `jobs (2):
+NAME    STATE   NEXT  RUNS  FAILURES  LAST RUN  LAST DURATION  LAST ERROR
+audit   paused  -     0     0         -         0s             -
+backup  idle    -     0     0         -         0s             -
+
+`)
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package duration
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// humanUnits maps the units accepted by Parse to their durations.
+var humanUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"μs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  day,
+	"w":  week,
+}
+
+// Parse parses a duration, as time.ParseDuration does, but also accepts
+// days ("d") and weeks ("w"), which are taken to be 24 hours and 7 days;
+// for example, "1d", "2w", "1w2d12h" or "1.5d".
+func Parse(s string) (time.Duration, error) {
+	d, err := parse(s)
+	if err != nil {
+		return 0, errors.Annotatef(err, "parsing duration %q", s)
+	}
+	return d, nil
+}
+
+func parse(s string) (time.Duration, error) {
+	rest := s
+	negative := strings.HasPrefix(rest, "-")
+	if negative || strings.HasPrefix(rest, "+") {
+		rest = rest[1:]
+	}
+	if rest == "0" {
+		return 0, nil
+	}
+	if rest == "" {
+		return 0, errors.New("empty duration")
+	}
+	var total time.Duration
+	for rest != "" {
+		n := strings.IndexFunc(rest, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		})
+		if n < 0 {
+			return 0, errors.Errorf("missing unit after %q", rest)
+		}
+		if n == 0 {
+			return 0, errors.Errorf("expected number at %q", rest)
+		}
+		number := rest[:n]
+		rest = rest[n:]
+		m := strings.IndexFunc(rest, func(r rune) bool {
+			return (r >= '0' && r <= '9') || r == '.'
+		})
+		if m < 0 {
+			m = len(rest)
+		}
+		unit, ok := humanUnits[rest[:m]]
+		if !ok {
+			return 0, errors.Errorf("unknown unit %q", rest[:m])
+		}
+		rest = rest[m:]
+		whole, frac, _ := strings.Cut(number, ".")
+		if whole == "" && frac != "" {
+			whole = "0"
+		}
+		d, err := componentDuration(whole, frac, unit)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if total > math.MaxInt64-d {
+			return 0, errors.New("duration out of range")
+		}
+		total += d
+	}
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
+
+// Format formats a duration compactly, using weeks, days, hours, minutes
+// and seconds, omitting zero components; for example, "2w", "1d12h",
+// "1h30m" or "1m30.5s". Durations of less than a second are formatted
+// as by time.Duration.String, such as "500ms". The result is accepted
+// by Parse.
+func Format(d time.Duration) string {
+	if d > -time.Second && d < time.Second {
+		return d.String()
+	}
+	var b strings.Builder
+	// Work with the magnitude as a uint64, so that the most
+	// negative duration may be formatted.
+	u := uint64(d)
+	if d < 0 {
+		b.WriteByte('-')
+		u = -u
+	}
+	for _, unit := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"w", week},
+		{"d", day},
+		{"h", time.Hour},
+		{"m", time.Minute},
+	} {
+		if n := u / uint64(unit.duration); n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.name)
+			u %= uint64(unit.duration)
+		}
+	}
+	if u > 0 {
+		writeSeconds(&b, u)
+		b.WriteByte('s')
+	}
+	return b.String()
+}
+
+// writeSeconds writes a duration of u nanoseconds as a number of
+// seconds, with a fraction if required.
+func writeSeconds(b *strings.Builder, u uint64) {
+	seconds, nanos := u/uint64(time.Second), u%uint64(time.Second)
+	fmt.Fprintf(b, "%d", seconds)
+	if nanos > 0 {
+		b.WriteString("." + strings.TrimRight(fmt.Sprintf("%09d", nanos), "0"))
+	}
+}
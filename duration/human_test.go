@@ -0,0 +1,93 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package duration_test
+
+import (
+	"math"
+	"time"
+
+	"github.com/axw/juju-time/duration"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type humanSuite struct{}
+
+var _ = gc.Suite(&humanSuite{})
+
+func (*humanSuite) TestParse(c *gc.C) {
+	for _, test := range []struct {
+		s      string
+		expect time.Duration
+	}{
+		{"0", 0},
+		{"0s", 0},
+		{"90s", 90 * time.Second},
+		{"1h30m", 90 * time.Minute},
+		{"1d", 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"1w2d12h", 9*24*time.Hour + 12*time.Hour},
+		{"1.5d", 36 * time.Hour},
+		{".5s", 500 * time.Millisecond},
+		{"1m30.5s", 90*time.Second + 500*time.Millisecond},
+		{"250ms", 250 * time.Millisecond},
+		{"3us", 3 * time.Microsecond},
+		{"3µs", 3 * time.Microsecond},
+		{"7ns", 7},
+		{"-1d", -24 * time.Hour},
+		{"+1h", time.Hour},
+	} {
+		c.Logf("%s", test.s)
+		d, err := duration.Parse(test.s)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(d, gc.Equals, test.expect)
+	}
+}
+
+func (*humanSuite) TestParseErrors(c *gc.C) {
+	for _, test := range []struct {
+		s   string
+		err string
+	}{
+		{"", `parsing duration "": empty duration`},
+		{"-", `.*empty duration`},
+		{"5", `.*missing unit after "5"`},
+		{"1d5", `.*missing unit after "5"`},
+		{"d", `.*expected number at "d"`},
+		{"1y", `.*unknown unit "y"`},
+		{"1 d", `.*unknown unit " d"`},
+		{"1.2.3s", `.*invalid number`},
+		{"20000w", `.*duration out of range`},
+		{"15000w15000w", `.*duration out of range`},
+	} {
+		c.Logf("%s", test.s)
+		_, err := duration.Parse(test.s)
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*humanSuite) TestFormat(c *gc.C) {
+	for _, test := range []struct {
+		d      time.Duration
+		expect string
+	}{
+		{0, "0s"},
+		{500 * time.Millisecond, "500ms"},
+		{-time.Microsecond, "-1µs"},
+		{90 * time.Second, "1m30s"},
+		{90 * time.Minute, "1h30m"},
+		{24 * time.Hour, "1d"},
+		{14 * 24 * time.Hour, "2w"},
+		{9*24*time.Hour + 12*time.Hour + 1500*time.Millisecond, "1w2d12h1.5s"},
+		{-36 * time.Hour, "-1d12h"},
+		{math.MinInt64, "-15250w1d23h47m16.854775808s"},
+	} {
+		c.Check(duration.Format(test.d), gc.Equals, test.expect)
+		if test.d != math.MinInt64 {
+			d, err := duration.Parse(test.expect)
+			c.Check(err, jc.ErrorIsNil)
+			c.Check(d, gc.Equals, test.d)
+		}
+	}
+}
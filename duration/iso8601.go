@@ -0,0 +1,210 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package duration parses and formats durations in forms not supported
+// by the time package: ISO 8601 durations ("P1DT12H"), for interoperating
+// with external APIs, and durations with days and weeks ("1d", "2w"),
+// for operator-facing configuration.
+package duration
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// CalendarPolicy determines how ISO 8601 years and months, whose lengths
+// vary, are converted to a time.Duration.
+type CalendarPolicy int
+
+const (
+	// RejectCalendar rejects durations with years or months.
+	RejectCalendar CalendarPolicy = iota
+
+	// ApproximateCalendar treats a year as 365 days, and a month
+	// as 30 days.
+	ApproximateCalendar
+)
+
+const (
+	day   = 24 * time.Hour
+	week  = 7 * day
+	month = 30 * day
+	year  = 365 * day
+)
+
+// isoUnit is a component of an ISO 8601 duration.
+type isoUnit struct {
+	designator byte
+	time       bool
+	duration   time.Duration
+	calendar   bool
+}
+
+// isoUnits holds the components of an ISO 8601 duration, in the order
+// in which they must appear.
+var isoUnits = []isoUnit{
+	{designator: 'Y', duration: year, calendar: true},
+	{designator: 'M', duration: month, calendar: true},
+	{designator: 'W', duration: week},
+	{designator: 'D', duration: day},
+	{designator: 'H', time: true, duration: time.Hour},
+	{designator: 'M', time: true, duration: time.Minute},
+	{designator: 'S', time: true, duration: time.Second},
+}
+
+// ParseISO8601Duration parses an ISO 8601 duration, such as "P1DT12H"
+// or "PT1.5S". Days are taken to be 24 hours, and weeks 7 days; years
+// and months are converted as determined by the policy. Only the last
+// component may have a fraction, separated by '.' or ','. Weeks may be
+// combined with other components, as ISO 8601-2 allows. A leading '-'
+// negates the duration.
+func ParseISO8601Duration(s string, policy CalendarPolicy) (time.Duration, error) {
+	d, err := parseISO8601(s, policy)
+	if err != nil {
+		return 0, errors.Annotatef(err, "parsing ISO 8601 duration %q", s)
+	}
+	return d, nil
+}
+
+func parseISO8601(s string, policy CalendarPolicy) (time.Duration, error) {
+	rest := s
+	negative := strings.HasPrefix(rest, "-")
+	if negative || strings.HasPrefix(rest, "+") {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 || rest[0] != 'P' {
+		return 0, errors.New(`missing "P" designator`)
+	}
+	rest = rest[1:]
+	if rest == "" {
+		return 0, errors.New("no components")
+	}
+	var total time.Duration
+	var inTime bool
+	next := 0 // index of the next permitted unit
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime {
+				return 0, errors.New(`duplicate "T" designator`)
+			}
+			inTime = true
+			rest = rest[1:]
+			if rest == "" {
+				return 0, errors.New(`no components after "T"`)
+			}
+			for next < len(isoUnits) && !isoUnits[next].time {
+				next++
+			}
+			continue
+		}
+		n := strings.IndexFunc(rest, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.' && r != ','
+		})
+		if n <= 0 {
+			return 0, errors.Errorf("expected number at %q", rest)
+		}
+		number := strings.Replace(rest[:n], ",", ".", 1)
+		designator := rest[n]
+		rest = rest[n+1:]
+
+		i := next
+		for i < len(isoUnits) && (isoUnits[i].designator != designator || isoUnits[i].time != inTime) {
+			i++
+		}
+		if i == len(isoUnits) {
+			return 0, errors.Errorf("unexpected designator %q", designator)
+		}
+		unit := isoUnits[i]
+		next = i + 1
+		if unit.calendar && policy != ApproximateCalendar {
+			return 0, errors.New("years and months not supported")
+		}
+		whole, frac, fractional := strings.Cut(number, ".")
+		if fractional && rest != "" {
+			return 0, errors.New("fraction in component other than the last")
+		}
+		d, err := componentDuration(whole, frac, unit.duration)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if total > math.MaxInt64-d {
+			return 0, errors.New("duration out of range")
+		}
+		total += d
+	}
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
+
+// componentDuration returns the duration of a component with the given
+// whole and fractional parts, in the given unit.
+func componentDuration(whole, frac string, unit time.Duration) (time.Duration, error) {
+	if whole == "" || strings.ContainsAny(frac, ".,") {
+		return 0, errors.New("invalid number")
+	}
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || n > int64(math.MaxInt64/unit) {
+		return 0, errors.New("duration out of range")
+	}
+	d := time.Duration(n) * unit
+	if frac != "" {
+		f, err := strconv.ParseFloat("0."+frac, 64)
+		if err != nil {
+			return 0, errors.New("invalid number")
+		}
+		fd := time.Duration(math.Round(f * float64(unit)))
+		if d > math.MaxInt64-fd {
+			return 0, errors.New("duration out of range")
+		}
+		d += fd
+	}
+	return d, nil
+}
+
+// FormatISO8601 formats a duration as an ISO 8601 duration, using days,
+// hours, minutes and seconds, with a fraction of a second if required;
+// for example, "P1DT12H" or "PT1.5S". Days are taken to be 24 hours.
+// Negative durations have a leading '-', and the zero duration is
+// formatted as "PT0S".
+func FormatISO8601(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+	var b strings.Builder
+	// Work with the magnitude as a uint64, so that the most
+	// negative duration may be formatted.
+	u := uint64(d)
+	if d < 0 {
+		b.WriteByte('-')
+		u = -u
+	}
+	b.WriteByte('P')
+	if days := u / uint64(day); days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+		u %= uint64(day)
+	}
+	if u == 0 {
+		return b.String()
+	}
+	b.WriteByte('T')
+	if hours := u / uint64(time.Hour); hours > 0 {
+		fmt.Fprintf(&b, "%dH", hours)
+		u %= uint64(time.Hour)
+	}
+	if minutes := u / uint64(time.Minute); minutes > 0 {
+		fmt.Fprintf(&b, "%dM", minutes)
+		u %= uint64(time.Minute)
+	}
+	if u > 0 {
+		writeSeconds(&b, u)
+		b.WriteByte('S')
+	}
+	return b.String()
+}
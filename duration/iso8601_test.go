@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package duration_test
+
+import (
+	"math"
+	"time"
+
+	"github.com/axw/juju-time/duration"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type iso8601Suite struct{}
+
+var _ = gc.Suite(&iso8601Suite{})
+
+func (*iso8601Suite) TestParse(c *gc.C) {
+	for _, test := range []struct {
+		s      string
+		policy duration.CalendarPolicy
+		expect time.Duration
+	}{
+		{s: "PT0S", expect: 0},
+		{s: "PT1.5S", expect: 1500 * time.Millisecond},
+		{s: "PT0,25S", expect: 250 * time.Millisecond},
+		{s: "PT1H30M", expect: 90 * time.Minute},
+		{s: "PT90M", expect: 90 * time.Minute},
+		{s: "PT1.5H", expect: 90 * time.Minute},
+		{s: "P1D", expect: 24 * time.Hour},
+		{s: "P1DT12H", expect: 36 * time.Hour},
+		{s: "P2W", expect: 14 * 24 * time.Hour},
+		{s: "P1W2D", expect: 9 * 24 * time.Hour},
+		{s: "-PT5M", expect: -5 * time.Minute},
+		{s: "+PT5M", expect: 5 * time.Minute},
+		{s: "P1Y", policy: duration.ApproximateCalendar, expect: 365 * 24 * time.Hour},
+		{s: "P1Y2M3DT4H5M6S", policy: duration.ApproximateCalendar,
+			expect: (365+60+3)*24*time.Hour + 4*time.Hour + 5*time.Minute + 6*time.Second},
+	} {
+		c.Logf("%s", test.s)
+		d, err := duration.ParseISO8601Duration(test.s, test.policy)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(d, gc.Equals, test.expect)
+	}
+}
+
+func (*iso8601Suite) TestParseErrors(c *gc.C) {
+	for _, test := range []struct {
+		s   string
+		err string
+	}{
+		{"", `parsing ISO 8601 duration "": missing "P" designator`},
+		{"1D", `.*missing "P" designator`},
+		{"P", `.*no components`},
+		{"PT", `.*no components after "T"`},
+		{"P1DT", `.*no components after "T"`},
+		{"PT1HT1M", `.*duplicate "T" designator`},
+		{"PD", `.*expected number at "D"`},
+		{"P1", `.*expected number at "1"`},
+		{"P1H", `.*unexpected designator 'H'`},
+		{"PT1D", `.*unexpected designator 'D'`},
+		{"P1D1W", `.*unexpected designator 'W'`},
+		{"PT1S1M", `.*unexpected designator 'M'`},
+		{"P1M", `.*years and months not supported`},
+		{"P1Y", `.*years and months not supported`},
+		{"PT1.5M30S", `.*fraction in component other than the last`},
+		{"PT1.2.3S", `.*invalid number`},
+		{"PT.5S", `.*invalid number`},
+		{"PT9223372037S", `.*duration out of range`},
+		{"P106751DT23H48M", `.*duration out of range`},
+	} {
+		c.Logf("%s", test.s)
+		_, err := duration.ParseISO8601Duration(test.s, duration.RejectCalendar)
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*iso8601Suite) TestFormat(c *gc.C) {
+	for _, test := range []struct {
+		d      time.Duration
+		expect string
+	}{
+		{0, "PT0S"},
+		{1500 * time.Millisecond, "PT1.5S"},
+		{time.Nanosecond, "PT0.000000001S"},
+		{90 * time.Minute, "PT1H30M"},
+		{24 * time.Hour, "P1D"},
+		{36*time.Hour + time.Second, "P1DT12H1S"},
+		{-5 * time.Minute, "-PT5M"},
+		{math.MinInt64, "-P106751DT23H47M16.854775808S"},
+	} {
+		c.Check(duration.FormatISO8601(test.d), gc.Equals, test.expect)
+		if test.d != math.MinInt64 {
+			d, err := duration.ParseISO8601Duration(test.expect, duration.RejectCalendar)
+			c.Check(err, jc.ErrorIsNil)
+			c.Check(d, gc.Equals, test.d)
+		}
+	}
+}
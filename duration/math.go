@@ -0,0 +1,136 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package duration
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// maxDuration and minDuration are the limits
+	// at which the arithmetic functions saturate.
+	maxDuration = time.Duration(math.MaxInt64)
+	minDuration = time.Duration(math.MinInt64)
+)
+
+// Add returns a+b, saturating at the minimum and maximum durations
+// rather than overflowing.
+func Add(a, b time.Duration) time.Duration {
+	switch {
+	case b > 0 && a > maxDuration-b:
+		return maxDuration
+	case b < 0 && a < minDuration-b:
+		return minDuration
+	}
+	return a + b
+}
+
+// Sub returns a-b, saturating at the minimum and maximum durations
+// rather than overflowing.
+func Sub(a, b time.Duration) time.Duration {
+	switch {
+	case b < 0 && a > maxDuration+b:
+		return maxDuration
+	case b > 0 && a < minDuration+b:
+		return minDuration
+	}
+	return a - b
+}
+
+// Mul returns d*n, saturating at the minimum and maximum durations
+// rather than overflowing.
+func Mul(d time.Duration, n int64) time.Duration {
+	if d == 0 || n == 0 {
+		return 0
+	}
+	p := d * time.Duration(n)
+	// The division cannot detect -minDuration, which overflows to itself.
+	if p/time.Duration(n) != d || (n == -1 && d == minDuration) {
+		if (d < 0) == (n < 0) {
+			return maxDuration
+		}
+		return minDuration
+	}
+	return p
+}
+
+// Scale returns d multiplied by f, saturating at the minimum and
+// maximum durations rather than overflowing; the conversion of an
+// out of range float64 to a Duration is otherwise undefined. Scale
+// returns zero if f is NaN.
+func Scale(d time.Duration, f float64) time.Duration {
+	if f == 1 {
+		return d
+	}
+	p := float64(d) * f
+	switch {
+	case p != p:
+		return 0
+	// float64(maxDuration) rounds up to 2^63, which is
+	// itself out of range, and so is excluded.
+	case p >= float64(maxDuration):
+		return maxDuration
+	case p <= float64(minDuration):
+		return minDuration
+	}
+	return time.Duration(p)
+}
+
+// Percent returns the given percentage of d, saturating as Scale
+// does; e.g. Percent(time.Minute, 25) is 15 seconds.
+func Percent(d time.Duration, percent float64) time.Duration {
+	return Scale(d, percent/100)
+}
+
+// Clamp returns d limited to the range [min, max]. If min is greater
+// than max, max is returned.
+func Clamp(d, min, max time.Duration) time.Duration {
+	if d < min {
+		d = min
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// roundUnits holds, in descending order, the units from which
+// RoundHuman chooses a duration's precision; each duration of at
+// least a unit is rounded to a multiple of the unit following it.
+var roundUnits = []time.Duration{
+	week,
+	day,
+	time.Hour,
+	time.Minute,
+	time.Second,
+	time.Millisecond,
+	time.Microsecond,
+	time.Nanosecond,
+}
+
+// RoundHuman rounds d to a precision suited to presenting it to a
+// person, as Format does: durations of at least a week are rounded to
+// a whole number of days, of at least a day to hours, of at least an
+// hour to minutes, of at least a minute to seconds, and so on down to
+// microseconds, which are rounded to nanoseconds. Halfway values are
+// rounded away from zero, and the result saturates as time.Duration's
+// Round method does; e.g. RoundHuman(90*time.Minute + 40*time.Second)
+// is 1h31m.
+func RoundHuman(d time.Duration) time.Duration {
+	abs := d
+	if abs < 0 {
+		abs = -abs
+		if abs < 0 {
+			// -minDuration overflows.
+			abs = maxDuration
+		}
+	}
+	for i, unit := range roundUnits[:len(roundUnits)-1] {
+		if abs >= unit {
+			return d.Round(roundUnits[i+1])
+		}
+	}
+	return d
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package duration_test
+
+import (
+	"math"
+	"time"
+
+	"github.com/axw/juju-time/duration"
+	gc "gopkg.in/check.v1"
+)
+
+type mathSuite struct{}
+
+var _ = gc.Suite(&mathSuite{})
+
+const (
+	maxDuration = time.Duration(math.MaxInt64)
+	minDuration = time.Duration(math.MinInt64)
+)
+
+func (*mathSuite) TestAddSub(c *gc.C) {
+	for _, test := range []struct {
+		a, b     time.Duration
+		add, sub time.Duration
+	}{
+		{time.Second, time.Minute, 61 * time.Second, -59 * time.Second},
+		{maxDuration, 1, maxDuration, maxDuration - 1},
+		{maxDuration - time.Hour, 2 * time.Hour, maxDuration, maxDuration - 3*time.Hour},
+		{minDuration, -1, minDuration, minDuration + 1},
+		{minDuration, 1, minDuration + 1, minDuration},
+		{-time.Second, maxDuration, maxDuration - time.Second, minDuration},
+		{time.Second, minDuration, minDuration + time.Second, maxDuration},
+	} {
+		c.Check(duration.Add(test.a, test.b), gc.Equals, test.add, gc.Commentf("%d + %d", test.a, test.b))
+		c.Check(duration.Sub(test.a, test.b), gc.Equals, test.sub, gc.Commentf("%d - %d", test.a, test.b))
+	}
+}
+
+func (*mathSuite) TestMul(c *gc.C) {
+	for _, test := range []struct {
+		d      time.Duration
+		n      int64
+		expect time.Duration
+	}{
+		{time.Second, 0, 0},
+		{0, math.MaxInt64, 0},
+		{time.Second, 90, 90 * time.Second},
+		{-time.Second, 90, -90 * time.Second},
+		{time.Hour, math.MaxInt64, maxDuration},
+		{time.Hour, -math.MaxInt64, minDuration},
+		{-time.Hour, -math.MaxInt64, maxDuration},
+		{maxDuration, 2, maxDuration},
+		{minDuration, -1, maxDuration},
+		{-1, math.MinInt64, maxDuration},
+		{maxDuration, -1, -maxDuration},
+	} {
+		c.Check(duration.Mul(test.d, test.n), gc.Equals, test.expect, gc.Commentf("%d * %d", test.d, test.n))
+	}
+}
+
+func (*mathSuite) TestScale(c *gc.C) {
+	for _, test := range []struct {
+		d      time.Duration
+		f      float64
+		expect time.Duration
+	}{
+		{time.Second, 0, 0},
+		{time.Second, 1.5, 1500 * time.Millisecond},
+		{time.Second, -2, -2 * time.Second},
+		{maxDuration, 1, maxDuration},
+		{maxDuration, 1.000001, maxDuration},
+		{maxDuration / 2, 2, maxDuration},
+		{time.Hour, 1e300, maxDuration},
+		{time.Hour, math.Inf(1), maxDuration},
+		{time.Hour, math.Inf(-1), minDuration},
+		{-time.Hour, 1e300, minDuration},
+		{time.Hour, math.NaN(), 0},
+	} {
+		c.Check(duration.Scale(test.d, test.f), gc.Equals, test.expect, gc.Commentf("%d * %v", test.d, test.f))
+	}
+}
+
+func (*mathSuite) TestPercent(c *gc.C) {
+	c.Check(duration.Percent(time.Minute, 25), gc.Equals, 15*time.Second)
+	c.Check(duration.Percent(time.Minute, 150), gc.Equals, 90*time.Second)
+	c.Check(duration.Percent(time.Minute, 0), gc.Equals, time.Duration(0))
+	c.Check(duration.Percent(maxDuration, 200), gc.Equals, maxDuration)
+}
+
+func (*mathSuite) TestClamp(c *gc.C) {
+	c.Check(duration.Clamp(time.Second, time.Minute, time.Hour), gc.Equals, time.Minute)
+	c.Check(duration.Clamp(time.Minute, time.Second, time.Hour), gc.Equals, time.Minute)
+	c.Check(duration.Clamp(time.Hour, time.Second, time.Minute), gc.Equals, time.Minute)
+	c.Check(duration.Clamp(time.Second, time.Hour, time.Minute), gc.Equals, time.Minute)
+}
+
+func (*mathSuite) TestRoundHuman(c *gc.C) {
+	for _, test := range []struct {
+		d      time.Duration
+		expect time.Duration
+	}{
+		{0, 0},
+		{7, 7},
+		{1234567, 1235 * time.Microsecond},
+		{1500*time.Millisecond + 400*time.Microsecond, 1500 * time.Millisecond},
+		{90*time.Second + 499*time.Millisecond, 90 * time.Second},
+		{90*time.Minute + 40*time.Second, 91 * time.Minute},
+		{-(90*time.Minute + 40*time.Second), -91 * time.Minute},
+		{25*time.Hour + 30*time.Minute, 26 * time.Hour},
+		{8*24*time.Hour + 11*time.Hour, 8 * 24 * time.Hour},
+		{maxDuration, maxDuration},
+		{minDuration, minDuration},
+	} {
+		c.Check(duration.RoundHuman(test.d), gc.Equals, test.expect, gc.Commentf("%v", test.d))
+	}
+}
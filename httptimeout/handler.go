@@ -0,0 +1,166 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package httptimeout
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/deadline"
+	"github.com/juju/errors"
+)
+
+// HandlerConfig holds the configuration for a Handler.
+type HandlerConfig struct {
+	// Clock is used to measure the timeout.
+	Clock clock.Clock
+
+	// Timeout is the time allowed for handling each request.
+	Timeout time.Duration
+
+	// Message is the body of the response sent when a request
+	// times out. If Message is empty, a default is used.
+	Message string
+}
+
+// Validate checks that the config is valid.
+func (config HandlerConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Timeout <= 0 {
+		return errors.NotValidf("non-positive Timeout")
+	}
+	return nil
+}
+
+// Handler is an http.Handler middleware that applies a timeout to the
+// handling of each request, as http.TimeoutHandler does, but measured
+// with a Clock. The wrapped handler's response is buffered, and sent
+// only if the handler returns within the timeout; otherwise, a 503
+// Service Unavailable response is sent. The request's context is done
+// when the timeout elapses, and writes made after it has elapsed
+// return http.ErrHandlerTimeout.
+type Handler struct {
+	config  HandlerConfig
+	handler http.Handler
+}
+
+// NewHandler returns a new Handler that wraps the given handler.
+func NewHandler(handler http.Handler, config HandlerConfig) (*Handler, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating handler config")
+	}
+	if config.Message == "" {
+		config.Message = "<html><head><title>Timeout</title></head><body><h1>Timeout</h1></body></html>"
+	}
+	return &Handler{config: config, handler: handler}, nil
+}
+
+// ServeHTTP is part of the http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := deadline.NewBudget(h.config.Clock, h.config.Timeout).Context(r.Context())
+	defer cancel()
+	tw := &timeoutWriter{ctx: ctx, header: make(http.Header)}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				panicked <- v
+			}
+		}()
+		h.handler.ServeHTTP(tw, r.WithContext(ctx))
+		close(done)
+	}()
+	select {
+	case v := <-panicked:
+		panic(v)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		if tw.timedOut {
+			// The handler wrote after the timeout elapsed.
+			h.timeout(w, r)
+			return
+		}
+		dst := w.Header()
+		for k, v := range tw.header {
+			dst[k] = v
+		}
+		if tw.code == 0 {
+			tw.code = http.StatusOK
+		}
+		w.WriteHeader(tw.code)
+		w.Write(tw.body.Bytes())
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		h.timeout(w, r)
+	}
+}
+
+// timeout sends the response for a request that timed out.
+func (h *Handler) timeout(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Err() != nil {
+		// The client has gone away.
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(h.config.Message))
+}
+
+// timeoutWriter buffers the response written by a handler, until the
+// handler's context is done.
+type timeoutWriter struct {
+	ctx context.Context
+
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+// Header is part of the http.ResponseWriter interface.
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// Write is part of the http.ResponseWriter interface.
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// WriteHeader is part of the http.ResponseWriter interface.
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired() || w.code != 0 {
+		return
+	}
+	w.code = code
+}
+
+// expired reports whether the handler's context is done, recording
+// that it has timed out if so. expired must be called with w.mu held.
+func (w *timeoutWriter) expired() bool {
+	if w.ctx.Err() != nil {
+		w.timedOut = true
+	}
+	return w.timedOut
+}
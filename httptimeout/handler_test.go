@@ -0,0 +1,89 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package httptimeout_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/axw/juju-time/httptimeout"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type handlerSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&handlerSuite{})
+
+func (s *handlerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *handlerSuite) newHandler(c *gc.C, h http.HandlerFunc) *httptimeout.Handler {
+	handler, err := httptimeout.NewHandler(h, httptimeout.HandlerConfig{
+		Clock:   s.clock,
+		Timeout: time.Second,
+		Message: "too slow",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return handler
+}
+
+func (s *handlerSuite) TestValidate(c *gc.C) {
+	_, err := httptimeout.NewHandler(http.NotFoundHandler(), httptimeout.HandlerConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating handler config: nil Clock not valid")
+}
+
+func (s *handlerSuite) TestSuccess(c *gc.C) {
+	h := s.newHandler(c, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	c.Assert(rec.Code, gc.Equals, http.StatusCreated)
+	c.Assert(rec.Header().Get("X-Test"), gc.Equals, "yes")
+	c.Assert(rec.Body.String(), gc.Equals, "created")
+}
+
+func (s *handlerSuite) TestTimeout(c *gc.C) {
+	writeErr := make(chan error, 1)
+	h := s.newHandler(c, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		<-r.Context().Done()
+		_, err := w.Write([]byte("late"))
+		writeErr <- err
+	})
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	}()
+	advanceUntil(c, s.clock, done, 100*time.Millisecond)
+	c.Assert(rec.Code, gc.Equals, http.StatusServiceUnavailable)
+	c.Assert(rec.Body.String(), gc.Equals, "too slow")
+	select {
+	case err := <-writeErr:
+		c.Assert(err, gc.Equals, http.ErrHandlerTimeout)
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for handler")
+	}
+}
+
+func (s *handlerSuite) TestPanic(c *gc.C) {
+	h := s.newHandler(c, func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	c.Assert(func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}, gc.PanicMatches, "oops")
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package httptimeout provides an http.RoundTripper and an http.Handler
+// middleware that apply timeouts, and retries with backoff, measured
+// with a clock.Clock, so that the timing of HTTP clients and servers
+// may be tested deterministically. The timeouts of net/http itself are
+// measured with the wall clock, and so cannot be driven by a test clock.
+package httptimeout
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/deadline"
+	"github.com/axw/juju-time/retry"
+	"github.com/juju/errors"
+)
+
+// TransportConfig holds the configuration for a Transport.
+type TransportConfig struct {
+	// Clock is used to measure timeouts, and the delays
+	// between attempts.
+	Clock clock.Clock
+
+	// Base is the RoundTripper used to make each attempt. If Base
+	// is nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// Timeout is the time allowed for each attempt, including
+	// reading the response body, as for http.Client's Timeout.
+	Timeout time.Duration
+
+	// Retry, if non-nil, is the strategy for retrying failed
+	// attempts. If Retry is nil, each request is attempted once.
+	Retry *retry.Strategy
+
+	// Retryable, if non-nil, reports whether an attempt that
+	// returned the response or error should be retried. If
+	// Retryable is nil, DefaultRetryable is used.
+	Retryable func(req *http.Request, resp *http.Response, err error) bool
+}
+
+// Validate checks that the config is valid.
+func (config TransportConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Timeout <= 0 {
+		return errors.NotValidf("non-positive Timeout")
+	}
+	if config.Retry != nil {
+		if err := config.Retry.Validate(); err != nil {
+			return errors.Annotate(err, "validating Retry")
+		}
+	}
+	return nil
+}
+
+// DefaultRetryable reports whether an attempt should be retried: that
+// is, whether the request is idempotent, and the attempt failed with an
+// error, or with a 502, 503 or 504 response.
+func DefaultRetryable(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Transport is an http.RoundTripper that applies a timeout to each
+// attempt of a request, and retries failed attempts according to a
+// strategy. Requests with bodies are retried only if their GetBody
+// fields are set, as they are by http.NewRequest for common body types.
+//
+// When a retryable response is received on the final attempt, it is
+// returned rather than an error, so that the caller may inspect it.
+type Transport struct {
+	config TransportConfig
+}
+
+// NewTransport returns a new Transport with the given configuration.
+func NewTransport(config TransportConfig) (*Transport, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating transport config")
+	}
+	if config.Base == nil {
+		config.Base = http.DefaultTransport
+	}
+	if config.Retryable == nil {
+		config.Retryable = DefaultRetryable
+	}
+	return &Transport{config: config}, nil
+}
+
+// errRetryableResponse is returned to Retry by an attempt
+// that received a retryable response.
+var errRetryableResponse = errors.New("retryable response")
+
+// RoundTrip is part of the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.config.Retry == nil || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.attempt(req)
+	}
+	var resp *http.Response
+	attempt := 0
+	err := retry.Retry(req.Context(), t.config.Clock, *t.config.Retry, func() error {
+		if resp != nil {
+			// Discard the previous attempt's response.
+			resp.Body.Close()
+			resp = nil
+		}
+		attemptReq := req
+		if attempt++; attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return retry.Permanent(errors.Annotate(err, "getting request body"))
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		var err error
+		resp, err = t.attempt(attemptReq)
+		if !t.config.Retryable(req, resp, err) {
+			if err != nil {
+				return retry.Permanent(err)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return errRetryableResponse
+	})
+	if resp != nil && (err == nil || errors.Cause(err) == errRetryableResponse) {
+		return resp, nil
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil, err
+}
+
+// attempt makes a single attempt of the request, with the timeout.
+func (t *Transport) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := deadline.NewBudget(t.config.Clock, t.config.Timeout).Context(req.Context())
+	resp, err := t.config.Base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded && req.Context().Err() == nil {
+			return nil, errors.Annotatef(err, "request timed out after %v", t.config.Timeout)
+		}
+		return nil, err
+	}
+	// The body is read with the attempt's context, which
+	// must not be cancelled until the body is closed.
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody is a response body that cancels the
+// request's context when it is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close is part of the io.Closer interface.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
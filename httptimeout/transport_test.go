@@ -0,0 +1,171 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package httptimeout_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/axw/juju-time/httptimeout"
+	"github.com/axw/juju-time/retry"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type transportSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&transportSuite{})
+
+func (s *transportSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+// roundTripperFunc is a function that implements http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func response(code int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+type result struct {
+	resp *http.Response
+	err  error
+}
+
+func (s *transportSuite) newTransport(c *gc.C, base http.RoundTripper, strategy *retry.Strategy) *httptimeout.Transport {
+	t, err := httptimeout.NewTransport(httptimeout.TransportConfig{
+		Clock:   s.clock,
+		Base:    base,
+		Timeout: time.Second,
+		Retry:   strategy,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return t
+}
+
+// roundTrip makes the request in a goroutine, advancing the
+// clock until it completes.
+func (s *transportSuite) roundTrip(c *gc.C, t http.RoundTripper, req *http.Request) (*http.Response, error) {
+	done := make(chan result, 1)
+	go func() {
+		resp, err := t.RoundTrip(req)
+		done <- result{resp, err}
+	}()
+	r := advanceUntil(c, s.clock, done, 100*time.Millisecond)
+	return r.resp, r.err
+}
+
+func (s *transportSuite) TestValidate(c *gc.C) {
+	_, err := httptimeout.NewTransport(httptimeout.TransportConfig{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating transport config: non-positive Timeout not valid")
+	_, err = httptimeout.NewTransport(httptimeout.TransportConfig{
+		Clock:   s.clock,
+		Timeout: time.Second,
+		Retry:   &retry.Strategy{Delay: -1},
+	})
+	c.Assert(err, gc.ErrorMatches, "validating transport config: validating Retry: negative Delay not valid")
+}
+
+func (s *transportSuite) TestTimeout(c *gc.C) {
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+	t := s.newTransport(c, base, nil)
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	start := s.clock.Now()
+	_, err = s.roundTrip(c, t, req)
+	c.Assert(err, gc.ErrorMatches, "request timed out after 1s: context deadline exceeded")
+	c.Assert(s.clock.Now().Sub(start) >= time.Second, jc.IsTrue)
+}
+
+func (s *transportSuite) TestRetry(c *gc.C) {
+	var bodies []string
+	var attempts int
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		c.Check(err, jc.ErrorIsNil)
+		bodies = append(bodies, string(body))
+		attempts++
+		switch attempts {
+		case 1:
+			return nil, errors.New("connection refused")
+		case 2:
+			return response(http.StatusServiceUnavailable, "busy"), nil
+		}
+		return response(http.StatusOK, "ok"), nil
+	})
+	t := s.newTransport(c, base, &retry.Strategy{Delay: time.Second, MaxAttempts: 5})
+	req, err := http.NewRequest("PUT", "http://example.com", strings.NewReader("payload"))
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := s.roundTrip(c, t, req)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	c.Assert(resp.Body.Close(), jc.ErrorIsNil)
+	c.Assert(bodies, jc.DeepEquals, []string{"payload", "payload", "payload"})
+}
+
+func (s *transportSuite) TestRetryExhaustedReturnsResponse(c *gc.C) {
+	var attempts int
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return response(http.StatusBadGateway, "bad gateway"), nil
+	})
+	t := s.newTransport(c, base, &retry.Strategy{Delay: time.Second, MaxAttempts: 3})
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := s.roundTrip(c, t, req)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusBadGateway)
+	body, err := io.ReadAll(resp.Body)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(body), gc.Equals, "bad gateway")
+	c.Assert(attempts, gc.Equals, 3)
+}
+
+func (s *transportSuite) TestNotRetryable(c *gc.C) {
+	var attempts int
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, errors.New("connection refused")
+	})
+	t := s.newTransport(c, base, &retry.Strategy{Delay: time.Second, MaxAttempts: 3})
+	req, err := http.NewRequest("POST", "http://example.com", strings.NewReader("payload"))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.roundTrip(c, t, req)
+	c.Assert(err, gc.ErrorMatches, "connection refused")
+	c.Assert(attempts, gc.Equals, 1)
+}
+
+// advanceUntil repeatedly advances the clock by d until a value is
+// received on ch.
+func advanceUntil[T any](c *gc.C, clock *coretesting.Clock, ch <-chan T, d time.Duration) T {
+	timeout := time.After(coretesting.LongWait)
+	for {
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(coretesting.ShortWait):
+			clock.Advance(d)
+		case <-timeout:
+			c.Fatalf("timed out waiting for value")
+		}
+	}
+}
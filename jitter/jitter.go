@@ -0,0 +1,107 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package jitter provides functions for randomising delays, so that
+// clients which fail together do not all retry together.
+//
+// Each function takes a Source of random numbers, so that tests may
+// supply a deterministic one, such as those provided by the testing
+// subpackage; if the source is nil, the math/rand package's shared
+// source is used.
+package jitter
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/axw/juju-time/duration"
+)
+
+// Source is a source of random numbers. *rand.Rand implements Source.
+type Source interface {
+	// Int63n returns a non-negative pseudo-random number
+	// in [0, n). Int63n may panic if n is not positive.
+	Int63n(n int64) int64
+}
+
+type globalSource struct{}
+
+func (globalSource) Int63n(n int64) int64 {
+	return rand.Int63n(n)
+}
+
+// FullJitter returns a random duration in [0, d], chosen uniformly.
+// If d is not positive, it is returned unchanged.
+func FullJitter(d time.Duration, src Source) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return between(0, d, src)
+}
+
+// EqualJitter returns a random duration in [d/2, d], chosen uniformly:
+// half of the delay is kept, and the other half jittered, so that the
+// delay is never shortened by more than half. If d is not positive, it
+// is returned unchanged.
+func EqualJitter(d time.Duration, src Source) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	half := d / 2
+	// For odd d, the kept half is rounded up, so that the
+	// maximum is d itself.
+	return between(d-half, d, src)
+}
+
+// Proportional returns a random duration in [d-frac*d, d+frac*d],
+// chosen uniformly. frac is clamped to [0, 1], so the result is never
+// negative; the result is also limited to the maximum duration. If d
+// is not positive, it is returned unchanged.
+func Proportional(d time.Duration, frac float64, src Source) time.Duration {
+	if d <= 0 || !(frac > 0) {
+		return d
+	}
+	if frac > 1 {
+		frac = 1
+	}
+	// Keep the range symmetric, but within bounds.
+	spread := duration.Clamp(duration.Scale(d, frac), 0, math.MaxInt64-d)
+	return between(d-spread, d+spread, src)
+}
+
+// between returns a random duration in [min, max], chosen uniformly.
+// min must not be greater than max.
+func between(min, max time.Duration, src Source) time.Duration {
+	if src == nil {
+		src = globalSource{}
+	}
+	span := int64(max - min)
+	if span == math.MaxInt64 {
+		// [0, MaxInt64] has one more value than Int63n can
+		// return; losing one of 2^63 values is immaterial.
+		return min + time.Duration(src.Int63n(span))
+	}
+	// Int63n's range excludes its argument, so add one
+	// to include max.
+	return min + time.Duration(src.Int63n(span+1))
+}
+
+// Decorrelated returns the delay following prev for "decorrelated
+// jitter" backoff: a random duration in [base, 3*prev], chosen
+// uniformly, and limited to max. If prev is less than base, base is
+// used in its place, so the first delay is in [base, 3*base]. If max
+// is not positive, the delay is not limited.
+func Decorrelated(base, prev, max time.Duration, src Source) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	if prev < base {
+		prev = base
+	}
+	d := between(base, duration.Mul(prev, 3), src)
+	if max > 0 && d > max {
+		d = max
+	}
+	return d
+}
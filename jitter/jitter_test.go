@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package jitter_test
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/axw/juju-time/jitter"
+	gc "gopkg.in/check.v1"
+)
+
+type jitterSuite struct{}
+
+var _ = gc.Suite(&jitterSuite{})
+
+// extremeSource is a Source that returns either the smallest or the
+// largest value in the requested range.
+type extremeSource struct {
+	max bool
+}
+
+func (s extremeSource) Int63n(n int64) int64 {
+	if s.max {
+		return n - 1
+	}
+	return 0
+}
+
+var (
+	minSource = extremeSource{false}
+	maxSource = extremeSource{true}
+)
+
+func (*jitterSuite) TestBounds(c *gc.C) {
+	const d = 7 * time.Second
+	for _, test := range []struct {
+		about    string
+		f        func(time.Duration, jitter.Source) time.Duration
+		min, max time.Duration
+	}{{
+		about: "full",
+		f:     jitter.FullJitter,
+		min:   0,
+		max:   d,
+	}, {
+		about: "equal",
+		f:     jitter.EqualJitter,
+		min:   3500 * time.Millisecond,
+		max:   d,
+	}, {
+		about: "proportional",
+		f: func(d time.Duration, src jitter.Source) time.Duration {
+			return jitter.Proportional(d, 0.5, src)
+		},
+		min: 3500 * time.Millisecond,
+		max: 10500 * time.Millisecond,
+	}} {
+		c.Logf("%s", test.about)
+		c.Check(test.f(d, minSource), gc.Equals, test.min)
+		c.Check(test.f(d, maxSource), gc.Equals, test.max)
+		// Odd durations are not biased downwards.
+		c.Check(test.f(time.Nanosecond, maxSource), gc.Equals, time.Nanosecond)
+		c.Check(test.f(0, maxSource), gc.Equals, time.Duration(0))
+		c.Check(test.f(-time.Second, maxSource), gc.Equals, -time.Second)
+	}
+}
+
+func (*jitterSuite) TestProportionalFraction(c *gc.C) {
+	c.Check(jitter.Proportional(time.Second, 0, maxSource), gc.Equals, time.Second)
+	c.Check(jitter.Proportional(time.Second, -1, maxSource), gc.Equals, time.Second)
+	c.Check(jitter.Proportional(time.Second, math.NaN(), maxSource), gc.Equals, time.Second)
+	c.Check(jitter.Proportional(time.Second, 2, minSource), gc.Equals, time.Duration(0))
+	c.Check(jitter.Proportional(time.Second, 2, maxSource), gc.Equals, 2*time.Second)
+
+	// The result is limited to the maximum duration.
+	const max = time.Duration(math.MaxInt64)
+	c.Check(jitter.Proportional(max-10, 0.5, minSource), gc.Equals, max-20)
+	c.Check(jitter.Proportional(max-10, 0.5, maxSource), gc.Equals, max)
+}
+
+func (*jitterSuite) TestDistribution(c *gc.C) {
+	src := rand.New(rand.NewSource(1))
+	const n = 10000
+	var sum time.Duration
+	for i := 0; i < n; i++ {
+		d := jitter.FullJitter(time.Second, src)
+		c.Assert(d >= 0 && d <= time.Second, gc.Equals, true)
+		sum += d
+	}
+	mean := sum / n
+	c.Assert(mean > 490*time.Millisecond && mean < 510*time.Millisecond, gc.Equals, true, gc.Commentf("mean %v", mean))
+}
+
+func (*jitterSuite) TestNilSource(c *gc.C) {
+	for i := 0; i < 100; i++ {
+		d := jitter.EqualJitter(time.Second, nil)
+		c.Assert(d >= 500*time.Millisecond && d <= time.Second, gc.Equals, true)
+	}
+}
+
+func (*jitterSuite) TestDecorrelated(c *gc.C) {
+	c.Check(jitter.Decorrelated(time.Second, 0, 0, minSource), gc.Equals, time.Second)
+	c.Check(jitter.Decorrelated(time.Second, 0, 0, maxSource), gc.Equals, 3*time.Second)
+	c.Check(jitter.Decorrelated(time.Second, 10*time.Second, 0, minSource), gc.Equals, time.Second)
+	c.Check(jitter.Decorrelated(time.Second, 10*time.Second, 0, maxSource), gc.Equals, 30*time.Second)
+	c.Check(jitter.Decorrelated(time.Second, 10*time.Second, 20*time.Second, maxSource), gc.Equals, 20*time.Second)
+	c.Check(jitter.Decorrelated(0, time.Second, 0, maxSource), gc.Equals, time.Duration(0))
+
+	// The upper bound does not overflow.
+	const max = time.Duration(math.MaxInt64)
+	c.Check(jitter.Decorrelated(time.Second, max/2, 0, maxSource), gc.Equals, max)
+}
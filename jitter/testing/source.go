@@ -0,0 +1,65 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package testing provides sources of random numbers for testing code
+// that applies jitter, so that the resulting delays are reproducible.
+package testing
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/axw/juju-time/jitter"
+)
+
+// Source is a seeded jitter.Source, whose sequence of numbers is
+// determined entirely by its seed. Unlike *rand.Rand, Source is safe
+// for concurrent use, so it may be shared by the operations of a
+// Runner; the sequence is then reproducible only if the order in which
+// numbers are taken is too, as it is in a simulation.Simulation.
+type Source struct {
+	mu    sync.Mutex
+	seed  int64
+	rand  *rand.Rand
+	count int
+}
+
+var _ jitter.Source = (*Source)(nil)
+
+// NewSource returns a new Source with the specified seed.
+func NewSource(seed int64) *Source {
+	return &Source{
+		seed: seed,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Int63n is part of the jitter.Source interface.
+func (s *Source) Int63n(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	return s.rand.Int63n(n)
+}
+
+// Seed returns the seed with which the source was created, so that
+// it may be logged by a failing test and the sequence reproduced.
+func (s *Source) Seed() int64 {
+	return s.seed
+}
+
+// Count returns the number of numbers that have been taken from
+// the source.
+func (s *Source) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Reset restarts the source's sequence from the beginning.
+func (s *Source) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rand = rand.New(rand.NewSource(s.seed))
+	s.count = 0
+}
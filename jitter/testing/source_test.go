@@ -0,0 +1,55 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/jitter"
+	jittertesting "github.com/axw/juju-time/jitter/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type sourceSuite struct{}
+
+var _ = gc.Suite(&sourceSuite{})
+
+func delays(src jitter.Source, n int) []time.Duration {
+	out := make([]time.Duration, n)
+	for i := range out {
+		out[i] = jitter.FullJitter(time.Minute, src)
+	}
+	return out
+}
+
+func (*sourceSuite) TestReproducible(c *gc.C) {
+	a := jittertesting.NewSource(42)
+	b := jittertesting.NewSource(42)
+	expect := delays(a, 10)
+	c.Assert(delays(b, 10), gc.DeepEquals, expect)
+	c.Assert(a.Count(), gc.Equals, 10)
+	c.Assert(a.Seed(), gc.Equals, int64(42))
+
+	a.Reset()
+	c.Assert(a.Count(), gc.Equals, 0)
+	c.Assert(delays(a, 10), gc.DeepEquals, expect)
+
+	other := jittertesting.NewSource(43)
+	c.Assert(delays(other, 10), gc.Not(gc.DeepEquals), expect)
+}
+
+func (*sourceSuite) TestConcurrent(c *gc.C) {
+	src := jittertesting.NewSource(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			delays(src, 100)
+		}()
+	}
+	wg.Wait()
+	c.Assert(src.Count(), gc.Equals, 1000)
+}
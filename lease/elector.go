@@ -0,0 +1,207 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package lease
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// ElectorConfig holds the configuration for an Elector.
+type ElectorConfig struct {
+	// Clock is used to schedule campaigns and renewals, and
+	// to measure the expiry of the leadership lease.
+	Clock clock.Clock
+
+	// Locker is the lease service shared by the candidates.
+	Locker Locker
+
+	// Name is the name of the leadership lease.
+	Name string
+
+	// Holder identifies this candidate to the Locker. Each
+	// candidate must have a distinct Holder.
+	Holder string
+
+	// Duration is the duration for which the leadership lease is
+	// claimed and extended. If the leader fails to extend the lease,
+	// another candidate may take over once it expires.
+	Duration time.Duration
+
+	// RenewMargin is how long before the leadership lease expires
+	// that the leader extends it. It must be shorter than Duration.
+	RenewMargin time.Duration
+
+	// RetryInterval is the time between attempts by a candidate that
+	// is not the leader to claim the leadership lease.
+	RetryInterval time.Duration
+
+	// OnChange, if non-nil, is called from the Elector's goroutine
+	// each time the candidate is elected, with true, and each time
+	// it loses the leadership or resigns, with false.
+	OnChange func(leader bool)
+}
+
+// Validate checks that the config is valid.
+func (config ElectorConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Locker == nil {
+		return errors.NotValidf("nil Locker")
+	}
+	if config.Name == "" {
+		return errors.NotValidf("empty Name")
+	}
+	if config.Holder == "" {
+		return errors.NotValidf("empty Holder")
+	}
+	if config.RenewMargin <= 0 {
+		return errors.NotValidf("non-positive RenewMargin")
+	}
+	if config.Duration <= config.RenewMargin {
+		return errors.NotValidf("Duration %v within RenewMargin", config.Duration)
+	}
+	if config.RetryInterval <= 0 {
+		return errors.NotValidf("non-positive RetryInterval")
+	}
+	return nil
+}
+
+// Elector campaigns for the leadership of a group of candidates, such
+// as the processes in a highly available deployment, by claiming a
+// lease shared by them. The leader holds the lease, extending it with
+// a Manager; candidates that are not the leader periodically attempt
+// to claim it, so that if the leader stops extending the lease, another
+// candidate takes over once it expires.
+//
+// Elector's methods are safe for concurrent use.
+type Elector struct {
+	config  ElectorConfig
+	manager *Manager
+
+	// deposed is signalled when the leadership lease expires
+	// because it could not be extended in time.
+	deposed chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewElector constructs a new Elector with the given configuration,
+// and starts it campaigning. The Elector will continue to campaign,
+// or to hold the leadership, until it is killed.
+func NewElector(config ElectorConfig) (*Elector, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating elector config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &Elector{
+		config:  config,
+		deposed: make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	manager, err := NewManager(Config{
+		Clock: config.Clock,
+		Claim: func(ctx context.Context, name string, d time.Duration) error {
+			return config.Locker.Claim(ctx, name, config.Holder, d)
+		},
+		Extend: func(ctx context.Context, name string, d time.Duration) error {
+			return config.Locker.Extend(ctx, name, config.Holder, d)
+		},
+		RenewMargin: config.RenewMargin,
+		OnExpired: func(string) {
+			select {
+			case e.deposed <- struct{}{}:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, errors.Trace(err)
+	}
+	e.manager = manager
+	go e.loop(config.Clock.Now())
+	return e, nil
+}
+
+// Kill stops the Elector. If the candidate is the leader, it resigns,
+// releasing the leadership lease so that another candidate may take
+// over without waiting for it to expire. Kill does not wait for the
+// Elector to stop; use Wait for that.
+func (e *Elector) Kill() {
+	e.cancel()
+}
+
+// Wait waits for the Elector to stop.
+func (e *Elector) Wait() error {
+	<-e.done
+	return nil
+}
+
+// IsLeader reports whether the candidate is the leader: that is,
+// whether it holds the leadership lease, and the lease has not
+// expired.
+func (e *Elector) IsLeader() bool {
+	expiry, ok := e.manager.Expiry(e.config.Name)
+	return ok && e.config.Clock.Now().Before(expiry)
+}
+
+// loop campaigns for the leadership, starting at the specified time,
+// until the Elector is killed.
+func (e *Elector) loop(retry time.Time) {
+	defer close(e.done)
+	defer func() {
+		e.manager.Kill()
+		e.manager.Wait()
+	}()
+	leader := false
+	for {
+		var campaign <-chan time.Time
+		if !leader {
+			campaign = clock.Alarm(e.config.Clock, retry)
+		}
+		select {
+		case <-e.ctx.Done():
+			if leader {
+				e.resign()
+			}
+			return
+		case <-e.deposed:
+			leader = false
+			e.notify(false)
+			retry = e.config.Clock.Now()
+		case <-campaign:
+			if err := e.manager.Acquire(e.ctx, e.config.Name, e.config.Duration); err == nil {
+				leader = true
+				e.notify(true)
+				continue
+			}
+			retry = retry.Add(e.config.RetryInterval)
+			if now := e.config.Clock.Now(); retry.Before(now) {
+				retry = now.Add(e.config.RetryInterval)
+			}
+		}
+	}
+}
+
+// resign stops extending the leadership lease, and releases it.
+func (e *Elector) resign() {
+	e.manager.Release(e.config.Name)
+	e.config.Locker.Release(context.Background(), e.config.Name, e.config.Holder)
+	e.notify(false)
+}
+
+func (e *Elector) notify(leader bool) {
+	if e.config.OnChange != nil {
+		e.config.OnChange(leader)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package lease_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/axw/juju-time/lease"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type electorSuite struct {
+	coretesting.BaseSuite
+	clock  *coretesting.Clock
+	locker *partitionedLocker
+}
+
+var _ = gc.Suite(&electorSuite{})
+
+func (s *electorSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.locker = &partitionedLocker{
+		MemoryLocker: lease.NewMemoryLocker(s.clock),
+		claims:       make(chan string, 1000),
+		extensions:   make(chan string, 1000),
+	}
+}
+
+func (s *electorSuite) newElector(c *gc.C, holder string, changes chan<- bool) *lease.Elector {
+	e, err := lease.NewElector(lease.ElectorConfig{
+		Clock:         s.clock,
+		Locker:        s.locker,
+		Name:          "leader",
+		Holder:        holder,
+		Duration:      10 * time.Second,
+		RenewMargin:   2 * time.Second,
+		RetryInterval: time.Second,
+		OnChange: func(leader bool) {
+			changes <- leader
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return e
+}
+
+// electLeader starts an elector for holder "a", and waits
+// for it to be elected.
+func (s *electorSuite) electLeader(c *gc.C, changes chan<- bool) *lease.Elector {
+	a := s.newElector(c, "a", changes)
+	waitUntil(c, a.IsLeader)
+	return a
+}
+
+func (s *electorSuite) TestValidate(c *gc.C) {
+	_, err := lease.NewElector(lease.ElectorConfig{
+		Clock:         s.clock,
+		Locker:        s.locker,
+		Name:          "leader",
+		Holder:        "a",
+		Duration:      time.Second,
+		RenewMargin:   time.Second,
+		RetryInterval: time.Second,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating elector config: Duration 1s within RenewMargin not valid")
+}
+
+func (s *electorSuite) TestElection(c *gc.C) {
+	changesA := make(chan bool, 10)
+	changesB := make(chan bool, 10)
+	a := s.electLeader(c, changesA)
+	defer stopElector(c, a)
+	c.Assert(receive(c, changesA), jc.IsTrue)
+
+	b := s.newElector(c, "b", changesB)
+	defer stopElector(c, b)
+
+	// The leader keeps extending its lease, so the
+	// other candidate is never elected.
+	for i := 1; i <= 30; i++ {
+		s.clock.Advance(time.Second)
+		if i%8 == 0 {
+			c.Assert(receive(c, s.locker.extensions), gc.Equals, "a")
+		}
+		c.Assert(b.IsLeader(), jc.IsFalse)
+	}
+	assertNotReceived(c, changesB)
+	c.Assert(a.IsLeader(), jc.IsTrue)
+	holder, _ := s.locker.Holder("leader")
+	c.Assert(holder, gc.Equals, "a")
+}
+
+func (s *electorSuite) TestFailover(c *gc.C) {
+	changesA := make(chan bool, 10)
+	changesB := make(chan bool, 10)
+	a := s.electLeader(c, changesA)
+	defer stopElector(c, a)
+	c.Assert(receive(c, changesA), jc.IsTrue)
+	b := s.newElector(c, "b", changesB)
+	defer stopElector(c, b)
+
+	// Once the leader is cut off from the lease service, it can no
+	// longer extend its lease; the other candidate takes over when
+	// the lease expires.
+	s.locker.partitioned.Store(true)
+	t0 := s.clock.Now()
+	for !b.IsLeader() {
+		c.Assert(a.IsLeader() && b.IsLeader(), jc.IsFalse)
+		c.Assert(s.clock.Now().Before(t0.Add(time.Minute)), jc.IsTrue)
+		s.clock.Advance(time.Second)
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(s.clock.Now().Before(t0.Add(10*time.Second)), jc.IsFalse)
+	c.Assert(receive(c, changesA), jc.IsFalse)
+	c.Assert(receive(c, changesB), jc.IsTrue)
+	c.Assert(a.IsLeader(), jc.IsFalse)
+}
+
+func (s *electorSuite) TestResign(c *gc.C) {
+	changesA := make(chan bool, 10)
+	changesB := make(chan bool, 10)
+	a := s.electLeader(c, changesA)
+	c.Assert(receive(c, changesA), jc.IsTrue)
+	b := s.newElector(c, "b", changesB)
+	defer stopElector(c, b)
+	c.Assert(receive(c, s.locker.claims), gc.Equals, "a")
+	c.Assert(receive(c, s.locker.claims), gc.Equals, "b")
+
+	// The leader releases its lease when it is stopped, so the other
+	// candidate takes over at its next attempt, without waiting for
+	// the lease to expire.
+	stopElector(c, a)
+	c.Assert(receive(c, changesA), jc.IsFalse)
+	_, held := s.locker.Holder("leader")
+	c.Assert(held, jc.IsFalse)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, changesB), jc.IsTrue)
+	c.Assert(b.IsLeader(), jc.IsTrue)
+}
+
+// partitionedLocker is a MemoryLocker that records the holders
+// attempting claims and making extensions, and rejects claims and
+// extensions by holder "a" while partitioned.
+type partitionedLocker struct {
+	*lease.MemoryLocker
+	partitioned atomic.Bool
+	claims      chan string
+	extensions  chan string
+}
+
+func (l *partitionedLocker) Claim(ctx context.Context, name, holder string, d time.Duration) error {
+	l.claims <- holder
+	if holder == "a" && l.partitioned.Load() {
+		return errors.New("unreachable")
+	}
+	return l.MemoryLocker.Claim(ctx, name, holder, d)
+}
+
+func (l *partitionedLocker) Extend(ctx context.Context, name, holder string, d time.Duration) error {
+	if holder == "a" && l.partitioned.Load() {
+		return errors.New("unreachable")
+	}
+	if err := l.MemoryLocker.Extend(ctx, name, holder, d); err != nil {
+		return err
+	}
+	l.extensions <- holder
+	return nil
+}
+
+// stopElector kills the elector, and waits for it to stop.
+func stopElector(c *gc.C, e *lease.Elector) {
+	e.Kill()
+	c.Check(e.Wait(), jc.ErrorIsNil)
+}
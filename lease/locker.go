@@ -0,0 +1,110 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package lease
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// ErrHeld is returned by a Locker when a lease is held by another holder.
+var ErrHeld = errors.New("lease held by another holder")
+
+// Locker is the interface to a lease service shared by cooperating
+// processes, each of which identifies itself with a distinct holder
+// name. A lease is held by at most one holder at a time, until it
+// expires or is released.
+//
+// Implementations must be safe for concurrent use.
+type Locker interface {
+	// Claim claims the lease with the specified name on behalf of
+	// the holder, for the specified duration. Claim returns ErrHeld
+	// if the lease is held by another holder, and has not expired.
+	Claim(ctx context.Context, name, holder string, duration time.Duration) error
+
+	// Extend extends the holder's lease with the specified name by
+	// the specified duration from now. Extend returns ErrHeld if
+	// the lease is not held by the holder.
+	Extend(ctx context.Context, name, holder string, duration time.Duration) error
+
+	// Release releases the holder's lease with the specified name,
+	// so that another holder may claim it without waiting for it to
+	// expire. Releasing a lease that is not held by the holder is a
+	// no-op.
+	Release(ctx context.Context, name, holder string) error
+}
+
+// MemoryLocker is a Locker that holds leases in memory, for use by
+// cooperating goroutines, and in tests.
+type MemoryLocker struct {
+	clock clock.Clock
+
+	mu     sync.Mutex
+	leases map[string]memoryLease
+}
+
+type memoryLease struct {
+	holder  string
+	expires time.Time
+}
+
+// NewMemoryLocker returns a new MemoryLocker, which uses the
+// specified clock to measure the expiry of leases.
+func NewMemoryLocker(clock clock.Clock) *MemoryLocker {
+	return &MemoryLocker{
+		clock:  clock,
+		leases: make(map[string]memoryLease),
+	}
+}
+
+// Claim is part of the Locker interface.
+func (l *MemoryLocker) Claim(ctx context.Context, name, holder string, duration time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if lease, ok := l.leases[name]; ok && lease.holder != holder && now.Before(lease.expires) {
+		return ErrHeld
+	}
+	l.leases[name] = memoryLease{holder, now.Add(duration)}
+	return nil
+}
+
+// Extend is part of the Locker interface. A holder may extend its
+// lease after it has expired, so long as no other holder has since
+// claimed it.
+func (l *MemoryLocker) Extend(ctx context.Context, name, holder string, duration time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lease, ok := l.leases[name]; !ok || lease.holder != holder {
+		return ErrHeld
+	}
+	l.leases[name] = memoryLease{holder, l.clock.Now().Add(duration)}
+	return nil
+}
+
+// Release is part of the Locker interface.
+func (l *MemoryLocker) Release(ctx context.Context, name, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lease, ok := l.leases[name]; ok && lease.holder == holder {
+		delete(l.leases, name)
+	}
+	return nil
+}
+
+// Holder returns the holder of the unexpired lease with the specified
+// name, and a boolean indicating whether or not the lease is held.
+func (l *MemoryLocker) Holder(name string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lease, ok := l.leases[name]
+	if !ok || !l.clock.Now().Before(lease.expires) {
+		return "", false
+	}
+	return lease.holder, true
+}
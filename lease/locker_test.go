@@ -0,0 +1,68 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package lease_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/lease"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type lockerSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&lockerSuite{})
+
+func (s *lockerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *lockerSuite) TestClaim(c *gc.C) {
+	ctx := context.Background()
+	l := lease.NewMemoryLocker(s.clock)
+	c.Assert(l.Claim(ctx, "l0", "a", time.Second), jc.ErrorIsNil)
+	c.Assert(l.Claim(ctx, "l0", "b", time.Second), gc.Equals, lease.ErrHeld)
+	c.Assert(l.Claim(ctx, "l1", "b", time.Second), jc.ErrorIsNil)
+	holder, ok := l.Holder("l0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(holder, gc.Equals, "a")
+
+	// Expired leases may be claimed by another holder.
+	s.clock.Advance(time.Second)
+	_, ok = l.Holder("l0")
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(l.Claim(ctx, "l0", "b", time.Second), jc.ErrorIsNil)
+	holder, _ = l.Holder("l0")
+	c.Assert(holder, gc.Equals, "b")
+}
+
+func (s *lockerSuite) TestExtend(c *gc.C) {
+	ctx := context.Background()
+	l := lease.NewMemoryLocker(s.clock)
+	c.Assert(l.Extend(ctx, "l0", "a", time.Second), gc.Equals, lease.ErrHeld)
+	c.Assert(l.Claim(ctx, "l0", "a", time.Second), jc.ErrorIsNil)
+	c.Assert(l.Extend(ctx, "l0", "b", time.Second), gc.Equals, lease.ErrHeld)
+
+	s.clock.Advance(time.Second / 2)
+	c.Assert(l.Extend(ctx, "l0", "a", time.Second), jc.ErrorIsNil)
+	s.clock.Advance(time.Second / 2)
+	c.Assert(l.Claim(ctx, "l0", "b", time.Second), gc.Equals, lease.ErrHeld)
+}
+
+func (s *lockerSuite) TestRelease(c *gc.C) {
+	ctx := context.Background()
+	l := lease.NewMemoryLocker(s.clock)
+	c.Assert(l.Claim(ctx, "l0", "a", time.Second), jc.ErrorIsNil)
+	c.Assert(l.Release(ctx, "l0", "b"), jc.ErrorIsNil)
+	c.Assert(l.Claim(ctx, "l0", "b", time.Second), gc.Equals, lease.ErrHeld)
+	c.Assert(l.Release(ctx, "l0", "a"), jc.ErrorIsNil)
+	c.Assert(l.Claim(ctx, "l0", "b", time.Second), jc.ErrorIsNil)
+}
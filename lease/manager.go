@@ -0,0 +1,257 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package lease provides a Manager that holds leases on behalf of a
+// client, automatically scheduling their renewal before they expire.
+package lease
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/schedule"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Manager.
+type Config struct {
+	// Clock is used to schedule renewals and measure expiry.
+	Clock clock.Clock
+
+	// Claim is called to claim a lease with the specified name for
+	// the specified duration, on behalf of Manager.Acquire.
+	Claim func(ctx context.Context, name string, duration time.Duration) error
+
+	// Extend is called to extend a held lease by the specified
+	// duration from now. If Extend fails, it is retried with
+	// exponential backoff until the lease expires.
+	Extend func(ctx context.Context, name string, duration time.Duration) error
+
+	// RenewMargin is how long before a lease expires that it is
+	// extended. It must be shorter than the duration of any lease.
+	RenewMargin time.Duration
+
+	// OnExpired, if non-nil, is called with the name of each lease
+	// that expires because it could not be extended in time. The
+	// expired lease is no longer held.
+	OnExpired func(name string)
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Claim == nil {
+		return errors.NotValidf("nil Claim")
+	}
+	if config.Extend == nil {
+		return errors.NotValidf("nil Extend")
+	}
+	if config.RenewMargin <= 0 {
+		return errors.NotValidf("non-positive RenewMargin")
+	}
+	return nil
+}
+
+// Manager holds leases, extending each one when it is within the renewal
+// margin of its expiry. Renewals are executed by a schedule.Runner.
+//
+// The Runner calls renewals' Delay methods with its lock held, and Delay
+// acquires the Manager's lock, so the Manager must never call the Runner
+// with its own lock held.
+//
+// Manager's methods are safe for concurrent use.
+type Manager struct {
+	config Config
+	runner *schedule.Runner[string, *renewal]
+
+	mu     sync.Mutex
+	leases map[string]*renewal
+}
+
+// NewManager constructs and starts a new Manager with the given
+// configuration. The Manager will continue to renew leases until
+// it is killed.
+func NewManager(config Config) (*Manager, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating lease manager config")
+	}
+	// A renewal for a released lease may still be rescheduled
+	// after the lease is reacquired; the newest renewal wins.
+	s, err := schedule.New(schedule.Config[string, *renewal]{
+		Clock:    config.Clock,
+		Coalesce: schedule.CoalesceExtendDelay,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	runner, err := schedule.NewRunner(schedule.RunnerConfig[string, *renewal]{Schedule: s})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Manager{
+		config: config,
+		runner: runner,
+		leases: make(map[string]*renewal),
+	}, nil
+}
+
+// Kill stops the Manager from renewing leases. Kill does not wait for
+// the Manager to stop; use Wait for that.
+func (m *Manager) Kill() {
+	m.runner.Kill()
+}
+
+// Wait waits for the Manager to stop.
+func (m *Manager) Wait() error {
+	return m.runner.Wait()
+}
+
+// Acquire claims the lease with the specified name for the specified
+// duration, and schedules its renewal. Acquire returns an error
+// satisfying errors.IsAlreadyExists if the lease is already held by
+// the Manager, or the error returned by the Claim function.
+func (m *Manager) Acquire(ctx context.Context, name string, duration time.Duration) error {
+	if duration <= m.config.RenewMargin {
+		return errors.NotValidf("duration %v within renewal margin", duration)
+	}
+	m.mu.Lock()
+	_, held := m.leases[name]
+	m.mu.Unlock()
+	if held {
+		return errors.AlreadyExistsf("lease %q", name)
+	}
+	// The lease's expiry is measured from before it is claimed, so
+	// that it is not overstated by the time taken to claim it.
+	now := m.config.Clock.Now()
+	if err := m.config.Claim(ctx, name, duration); err != nil {
+		return errors.Annotatef(err, "claiming lease %q", name)
+	}
+
+	m.mu.Lock()
+	if _, held := m.leases[name]; held {
+		m.mu.Unlock()
+		return errors.AlreadyExistsf("lease %q", name)
+	}
+	r := &renewal{
+		manager:  m,
+		name:     name,
+		duration: duration,
+		expires:  now.Add(duration),
+		renewed:  true,
+	}
+	r.backoff.Clock = m.config.Clock
+	m.leases[name] = r
+	m.mu.Unlock()
+	m.runner.Add(r)
+	return nil
+}
+
+// Release stops renewing the lease with the specified name, and reports
+// whether or not it was held. The lease is left to expire.
+func (m *Manager) Release(name string) bool {
+	m.mu.Lock()
+	_, ok := m.leases[name]
+	delete(m.leases, name)
+	m.mu.Unlock()
+	if ok {
+		m.runner.Remove(name)
+	}
+	return ok
+}
+
+// Expiry returns the time at which the lease with the specified name
+// will expire, unless extended, and a boolean indicating whether or
+// not the lease is held. The expiry is measured from the time at which
+// Claim or Extend was called, rather than when it returned.
+func (m *Manager) Expiry(name string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.leases[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	return r.expires, true
+}
+
+// renewal is the operation that extends a lease.
+type renewal struct {
+	manager  *Manager
+	name     string
+	duration time.Duration
+
+	// expires is the lease's expiry time, guarded by manager.mu.
+	expires time.Time
+
+	// renewed records whether the lease has been claimed or
+	// extended since the operation was last scheduled, and
+	// backoff determines the delay between failed extensions.
+	// They are accessed only by the Runner.
+	renewed bool
+	backoff schedule.ExponentialBackoff
+}
+
+// Key is part of the schedule.Operation interface.
+func (r *renewal) Key() string {
+	return r.name
+}
+
+// Delay is part of the schedule.Operation interface. Following a
+// successful claim or extension, the lease is next extended at the
+// renewal margin before its expiry; following a failed extension, it
+// is retried with backoff, but no later than its expiry.
+func (r *renewal) Delay() time.Duration {
+	r.manager.mu.Lock()
+	untilExpiry := r.expires.Sub(r.manager.config.Clock.Now())
+	r.manager.mu.Unlock()
+	if r.renewed {
+		r.renewed = false
+		r.backoff.Reset()
+		return untilExpiry - r.manager.config.RenewMargin
+	}
+	d := r.backoff.Delay()
+	if d > untilExpiry {
+		d = untilExpiry
+	}
+	return d
+}
+
+// Do is part of the schedule.RunnableOperation interface.
+func (r *renewal) Do(ctx context.Context) error {
+	m := r.manager
+	m.mu.Lock()
+	held := m.leases[r.name] == r
+	expired := !m.config.Clock.Now().Before(r.expires)
+	if held && expired {
+		delete(m.leases, r.name)
+	}
+	m.mu.Unlock()
+	if !held {
+		return nil
+	}
+	if expired {
+		if m.config.OnExpired != nil {
+			m.config.OnExpired(r.name)
+		}
+		return nil
+	}
+
+	now := m.config.Clock.Now()
+	if err := m.config.Extend(ctx, r.name, r.duration); err != nil {
+		return errors.Annotatef(err, "extending lease %q", r.name)
+	}
+	m.mu.Lock()
+	held = m.leases[r.name] == r
+	if held {
+		r.expires = now.Add(r.duration)
+		r.renewed = true
+	}
+	m.mu.Unlock()
+	if held {
+		m.runner.Add(r)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package lease_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/axw/juju-time/lease"
+	jujuerrors "github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type managerSuite struct {
+	coretesting.BaseSuite
+	clock     *coretesting.Clock
+	extended  chan time.Time
+	extendErr error
+	expired   chan string
+}
+
+var _ = gc.Suite(&managerSuite{})
+
+func (s *managerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.extended = make(chan time.Time, 10)
+	s.extendErr = nil
+	s.expired = make(chan string, 10)
+}
+
+func (s *managerSuite) newManager(c *gc.C) *lease.Manager {
+	m, err := lease.NewManager(lease.Config{
+		Clock: s.clock,
+		Claim: func(ctx context.Context, name string, d time.Duration) error {
+			if name == "taken" {
+				return errors.New("lease taken")
+			}
+			return nil
+		},
+		Extend: func(ctx context.Context, name string, d time.Duration) error {
+			c.Check(d, gc.Equals, 10*time.Second)
+			s.extended <- s.clock.Now()
+			return s.extendErr
+		},
+		RenewMargin: 2 * time.Second,
+		OnExpired: func(name string) {
+			s.expired <- name
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return m
+}
+
+func (s *managerSuite) TestValidate(c *gc.C) {
+	_, err := lease.NewManager(lease.Config{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating lease manager config: nil Claim not valid")
+}
+
+func (s *managerSuite) TestAcquire(c *gc.C) {
+	m := s.newManager(c)
+	defer stop(c, m)
+
+	err := m.Acquire(context.Background(), "taken", 10*time.Second)
+	c.Assert(err, gc.ErrorMatches, `claiming lease "taken": lease taken`)
+	err = m.Acquire(context.Background(), "l0", time.Second)
+	c.Assert(err, gc.ErrorMatches, "duration 1s within renewal margin not valid")
+
+	c.Assert(m.Acquire(context.Background(), "l0", 10*time.Second), jc.ErrorIsNil)
+	err = m.Acquire(context.Background(), "l0", 10*time.Second)
+	c.Assert(err, jc.Satisfies, jujuerrors.IsAlreadyExists)
+	expiry, ok := m.Expiry("l0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(expiry, gc.Equals, s.clock.Now().Add(10*time.Second))
+}
+
+func (s *managerSuite) TestRenewal(c *gc.C) {
+	m := s.newManager(c)
+	defer stop(c, m)
+
+	t0 := s.clock.Now()
+	c.Assert(m.Acquire(context.Background(), "l0", 10*time.Second), jc.ErrorIsNil)
+	s.clock.Advance(7 * time.Second)
+	assertNotReceived(c, s.extended)
+
+	// The lease is extended at the renewal margin before expiry.
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.extended), gc.Equals, t0.Add(8*time.Second))
+	waitUntil(c, func() bool {
+		expiry, _ := m.Expiry("l0")
+		return expiry.Equal(t0.Add(18 * time.Second))
+	})
+	s.clock.Advance(8 * time.Second)
+	c.Assert(receive(c, s.extended), gc.Equals, t0.Add(16*time.Second))
+}
+
+func (s *managerSuite) TestExpiryMeasuredFromCall(c *gc.C) {
+	// Claim and Extend take time to return; the lease's expiry is
+	// measured from when they were called.
+	m, err := lease.NewManager(lease.Config{
+		Clock: s.clock,
+		Claim: func(ctx context.Context, name string, d time.Duration) error {
+			s.clock.Advance(3 * time.Second)
+			return nil
+		},
+		Extend: func(ctx context.Context, name string, d time.Duration) error {
+			s.extended <- s.clock.Now()
+			s.clock.Advance(time.Second)
+			return nil
+		},
+		RenewMargin: 2 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer stop(c, m)
+
+	t0 := s.clock.Now()
+	c.Assert(m.Acquire(context.Background(), "l0", 10*time.Second), jc.ErrorIsNil)
+	expiry, ok := m.Expiry("l0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(expiry, gc.Equals, t0.Add(10*time.Second))
+
+	// The lease is extended at the renewal margin before expiry.
+	s.clock.Advance(4 * time.Second)
+	assertNotReceived(c, s.extended)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.extended), gc.Equals, t0.Add(8*time.Second))
+	waitUntil(c, func() bool {
+		expiry, _ := m.Expiry("l0")
+		return expiry.Equal(t0.Add(18 * time.Second))
+	})
+	s.clock.Advance(7 * time.Second)
+	c.Assert(receive(c, s.extended), gc.Equals, t0.Add(16*time.Second))
+}
+
+func (s *managerSuite) TestExpiry(c *gc.C) {
+	m := s.newManager(c)
+	defer stop(c, m)
+
+	s.extendErr = errors.New("unavailable")
+	c.Assert(m.Acquire(context.Background(), "l0", 10*time.Second), jc.ErrorIsNil)
+	s.clock.Advance(8 * time.Second)
+	receive(c, s.extended)
+
+	// Retries are capped at the lease's expiry, at which
+	// point it is reported as expired.
+	assertNotReceived(c, s.expired)
+	for {
+		s.clock.Advance(time.Second)
+		select {
+		case name := <-s.expired:
+			c.Assert(name, gc.Equals, "l0")
+			_, ok := m.Expiry("l0")
+			c.Assert(ok, jc.IsFalse)
+			return
+		case <-s.extended:
+		case <-time.After(coretesting.LongWait):
+			c.Fatalf("timed out waiting for lease to expire")
+		}
+	}
+}
+
+func (s *managerSuite) TestRelease(c *gc.C) {
+	m := s.newManager(c)
+	defer stop(c, m)
+
+	c.Assert(m.Acquire(context.Background(), "l0", 10*time.Second), jc.ErrorIsNil)
+	c.Assert(m.Release("l0"), jc.IsTrue)
+	c.Assert(m.Release("l0"), jc.IsFalse)
+	s.clock.Advance(time.Minute)
+	assertNotReceived(c, s.extended)
+	assertNotReceived(c, s.expired)
+}
+
+// stop kills the manager, and waits for it to stop.
+func stop(c *gc.C, m *lease.Manager) {
+	m.Kill()
+	c.Check(m.Wait(), jc.ErrorIsNil)
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotReceived[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected value: %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+// waitUntil waits for cond to return true, polling it periodically.
+func waitUntil(c *gc.C, cond func() bool) {
+	timeout := time.After(coretesting.LongWait)
+	for !cond() {
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for condition")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package logging provides the Logger interface through which Runners,
+// Watchdogs and Retry report their decisions, along with Loggers that
+// discard messages, adapt a log/slog Logger, and limit the rate of
+// messages.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// Logger is the interface for logging messages at various levels.
+// loggo.Logger implements Logger.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Nop is a Logger that discards all messages. Types that accept an
+// optional Logger use Nop if none is specified.
+var Nop Logger = nop{}
+
+type nop struct{}
+
+func (nop) Debugf(string, ...interface{})   {}
+func (nop) Infof(string, ...interface{})    {}
+func (nop) Warningf(string, ...interface{}) {}
+func (nop) Errorf(string, ...interface{})   {}
+
+// OrNop returns logger, or Nop if logger is nil.
+func OrNop(logger Logger) Logger {
+	if logger == nil {
+		return Nop
+	}
+	return logger
+}
+
+// Slog returns a Logger that logs formatted messages to the slog.Logger,
+// at the corresponding levels; Warningf logs at slog.LevelWarn.
+func Slog(logger *slog.Logger) Logger {
+	return slogLogger{logger}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogLogger) logf(level slog.Level, format string, args []interface{}) {
+	ctx := context.Background()
+	if l.logger.Enabled(ctx, level) {
+		l.logger.Log(ctx, level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.logf(slog.LevelDebug, format, args)
+}
+
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.logf(slog.LevelInfo, format, args)
+}
+
+func (l slogLogger) Warningf(format string, args ...interface{}) {
+	l.logf(slog.LevelWarn, format, args)
+}
+
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.logf(slog.LevelError, format, args)
+}
+
+// RateLimitConfig holds the configuration for a rate-limited Logger.
+type RateLimitConfig struct {
+	// Logger is the Logger to which messages are passed.
+	Logger Logger
+
+	// Clock is used to measure the interval.
+	Clock clock.Clock
+
+	// Interval is the period over which the number of messages
+	// with each format is limited.
+	Interval time.Duration
+
+	// Burst is the number of messages with each format that may be
+	// logged in each interval. If Burst is zero, 1 is used.
+	Burst int
+}
+
+// Validate checks that the config is valid.
+func (config RateLimitConfig) Validate() error {
+	if config.Logger == nil {
+		return errors.NotValidf("nil Logger")
+	}
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Interval <= 0 {
+		return errors.NotValidf("non-positive Interval")
+	}
+	if config.Burst < 0 {
+		return errors.NotValidf("negative Burst")
+	}
+	return nil
+}
+
+// NewRateLimited returns a Logger that passes at most Burst messages
+// with each format, at each level, to the underlying Logger in each
+// interval, so that a storm of failures, say, does not flood the log.
+// Messages are limited by format rather than content, so that messages
+// about many operations failing in the same way are limited together.
+// The number of messages suppressed is appended to the next message
+// with the format that is logged.
+func NewRateLimited(config RateLimitConfig) (Logger, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating rate limit config")
+	}
+	if config.Burst == 0 {
+		config.Burst = 1
+	}
+	return &rateLimited{
+		config:  config,
+		windows: make(map[rateLimitKey]*rateLimitWindow),
+	}, nil
+}
+
+type rateLimited struct {
+	config RateLimitConfig
+
+	mu      sync.Mutex
+	windows map[rateLimitKey]*rateLimitWindow
+}
+
+type rateLimitKey struct {
+	level  int
+	format string
+}
+
+// rateLimitWindow records the messages logged with a format in the
+// interval starting at start, and the number suppressed since the
+// last message was logged.
+type rateLimitWindow struct {
+	start      time.Time
+	logged     int
+	suppressed int
+}
+
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarning
+	levelError
+)
+
+// allow reports whether a message with the format may be logged at the
+// level, and if so, the number of messages suppressed since the last.
+func (l *rateLimited) allow(level int, format string) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.config.Clock.Now()
+	key := rateLimitKey{level, format}
+	w, ok := l.windows[key]
+	if !ok {
+		w = &rateLimitWindow{start: now}
+		l.windows[key] = w
+	} else if now.Sub(w.start) >= l.config.Interval {
+		w.start = now
+		w.logged = 0
+	}
+	if w.logged >= l.config.Burst {
+		w.suppressed++
+		return false, 0
+	}
+	w.logged++
+	suppressed := w.suppressed
+	w.suppressed = 0
+	return true, suppressed
+}
+
+// logf logs the message with f, if it is allowed.
+func (l *rateLimited) logf(level int, f func(string, ...interface{}), format string, args []interface{}) {
+	ok, suppressed := l.allow(level, format)
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		format += " (%d similar messages suppressed)"
+		args = append(args[:len(args):len(args)], suppressed)
+	}
+	f(format, args...)
+}
+
+func (l *rateLimited) Debugf(format string, args ...interface{}) {
+	l.logf(levelDebug, l.config.Logger.Debugf, format, args)
+}
+
+func (l *rateLimited) Infof(format string, args ...interface{}) {
+	l.logf(levelInfo, l.config.Logger.Infof, format, args)
+}
+
+func (l *rateLimited) Warningf(format string, args ...interface{}) {
+	l.logf(levelWarning, l.config.Logger.Warningf, format, args)
+}
+
+func (l *rateLimited) Errorf(format string, args ...interface{}) {
+	l.logf(levelError, l.config.Logger.Errorf, format, args)
+}
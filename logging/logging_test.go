@@ -0,0 +1,105 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package logging_test
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/axw/juju-time/logging"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type loggingSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&loggingSuite{})
+
+// recorder is a Logger that records the messages logged to it.
+type recorder struct {
+	messages []string
+}
+
+func (r *recorder) logf(level, format string, args []interface{}) {
+	r.messages = append(r.messages, level+": "+fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Debugf(format string, args ...interface{})   { r.logf("DEBUG", format, args) }
+func (r *recorder) Infof(format string, args ...interface{})    { r.logf("INFO", format, args) }
+func (r *recorder) Warningf(format string, args ...interface{}) { r.logf("WARNING", format, args) }
+func (r *recorder) Errorf(format string, args ...interface{})   { r.logf("ERROR", format, args) }
+
+func (*loggingSuite) TestOrNop(c *gc.C) {
+	c.Assert(logging.OrNop(nil), gc.Equals, logging.Nop)
+	r := &recorder{}
+	c.Assert(logging.OrNop(r), gc.Equals, r)
+	// Nop discards everything.
+	logging.Nop.Errorf("%d", 1)
+}
+
+func (*loggingSuite) TestSlog(c *gc.C) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	logger := logging.Slog(slog.New(handler))
+	logger.Debugf("debug %d", 1)
+	logger.Infof("info %d", 2)
+	logger.Warningf("warning %d", 3)
+	logger.Errorf("error %d", 4)
+	c.Assert(buf.String(), gc.Equals, `level=INFO msg="info 2"
+level=WARN msg="warning 3"
+level=ERROR msg="error 4"
+`)
+}
+
+func (*loggingSuite) TestRateLimited(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r := &recorder{}
+	logger, err := logging.NewRateLimited(logging.RateLimitConfig{
+		Logger:   r,
+		Clock:    clock,
+		Interval: time.Minute,
+		Burst:    2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	for i := 0; i < 5; i++ {
+		logger.Warningf("operation %d failed", i)
+	}
+	// Formats are limited separately, as are levels.
+	logger.Warningf("operation %d dropped", 0)
+	logger.Debugf("operation %d failed", 0)
+
+	clock.Advance(time.Minute)
+	logger.Warningf("operation %d failed", 5)
+	logger.Warningf("operation %d failed", 6)
+	c.Assert(r.messages, jc.DeepEquals, []string{
+		"WARNING: operation 0 failed",
+		"WARNING: operation 1 failed",
+		"WARNING: operation 0 dropped",
+		"DEBUG: operation 0 failed",
+		"WARNING: operation 5 failed (3 similar messages suppressed)",
+		"WARNING: operation 6 failed",
+	})
+}
+
+func (*loggingSuite) TestRateLimitedValidate(c *gc.C) {
+	_, err := logging.NewRateLimited(logging.RateLimitConfig{
+		Logger: logging.Nop,
+		Clock:  coretesting.NewClock(time.Time{}),
+	})
+	c.Assert(err, gc.ErrorMatches, "validating rate limit config: non-positive Interval not valid")
+}
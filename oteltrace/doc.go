@@ -0,0 +1,11 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package oteltrace provides a Runner OnExecute hook that traces the
+// executions of operations with OpenTelemetry.
+//
+// So that the other packages remain free of dependencies on the
+// OpenTelemetry API, the hook is only built with the "otel" build tag:
+//
+//	go build -tags otel
+package oteltrace
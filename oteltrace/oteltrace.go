@@ -0,0 +1,84 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build otel
+
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanName is the name of the spans started by OnExecute.
+const SpanName = "schedule.execute"
+
+// Attribute keys set on the spans started by OnExecute.
+const (
+	// KeyAttribute is the operation's key, formatted with fmt.Sprint.
+	KeyAttribute = attribute.Key("schedule.key")
+
+	// AttemptAttribute is the execution's attempt number.
+	AttemptAttribute = attribute.Key("schedule.attempt")
+
+	// ScheduledAttribute and ReadyAttribute are the times for which
+	// the operation was scheduled, and at which it became ready,
+	// formatted as RFC 3339.
+	ScheduledAttribute = attribute.Key("schedule.scheduled")
+	ReadyAttribute     = attribute.Key("schedule.ready")
+
+	// WaitAttribute is the time, in seconds, from when the operation
+	// was scheduled to when it started executing.
+	WaitAttribute = attribute.Key("schedule.wait_seconds")
+
+	// TraceIDAttribute is the operation's trace ID, if it has one;
+	// see schedule.TracedOperation.
+	TraceIDAttribute = attribute.Key("schedule.trace_id")
+)
+
+// OnExecute returns a function for the OnExecute field of a
+// schedule.RunnerConfig, which starts a span with the tracer for each
+// execution, and ends it when the execution completes, recording any
+// error. The span starts when the execution started, and ends when it
+// completes, as measured by the Runner's clock, and records when the
+// operation was scheduled, and became ready, so that traces show the
+// time that it spent waiting. The spans of retried operations are linked
+// to the spans of their previous attempts.
+func OnExecute[K comparable, O schedule.RunnableOperation[K]](tracer trace.Tracer) func(context.Context, O, schedule.Execution[K]) (context.Context, func(error)) {
+	return func(ctx context.Context, op O, exec schedule.Execution[K]) (context.Context, func(error)) {
+		opts := []trace.SpanStartOption{
+			trace.WithTimestamp(exec.Started),
+			trace.WithAttributes(
+				KeyAttribute.String(fmt.Sprint(exec.Key)),
+				AttemptAttribute.Int(exec.Attempt),
+				ScheduledAttribute.String(exec.Scheduled.Format(time.RFC3339Nano)),
+				ReadyAttribute.String(exec.Ready.Format(time.RFC3339Nano)),
+				WaitAttribute.Float64(exec.Started.Sub(exec.Scheduled).Seconds()),
+			),
+		}
+		if exec.TraceID != "" {
+			opts = append(opts, trace.WithAttributes(TraceIDAttribute.String(exec.TraceID)))
+		}
+		if exec.Previous != nil {
+			opts = append(opts, trace.WithLinks(trace.LinkFromContext(exec.Previous)))
+		}
+		ctx, span := tracer.Start(ctx, SpanName, opts...)
+		return ctx, func(err error) {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			var opts []trace.SpanEndOption
+			if exec.Clock != nil {
+				opts = append(opts, trace.WithTimestamp(exec.Clock.Now()))
+			}
+			span.End(opts...)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build otel
+
+package oteltrace_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/axw/juju-time/oteltrace"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	gc "gopkg.in/check.v1"
+)
+
+type traceSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&traceSuite{})
+
+type operation struct {
+	key string
+	err error
+}
+
+func (o operation) Key() string                  { return o.key }
+func (o operation) Delay() time.Duration         { return time.Hour }
+func (o operation) Do(ctx context.Context) error { return o.err }
+
+func (*traceSuite) TestOnExecute(c *gc.C) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	hook := oteltrace.OnExecute[string, operation](provider.Tracer("test"))
+
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := coretesting.NewClock(t0.Add(3 * time.Second))
+	exec := schedule.Execution[string]{
+		Key:       "k0",
+		Attempt:   1,
+		Scheduled: t0,
+		Ready:     t0.Add(time.Second),
+		Started:   t0.Add(3 * time.Second),
+		Clock:     clock,
+	}
+	failed := errors.New("failed")
+	ctx, done := hook(context.Background(), operation{key: "k0"}, exec)
+	clock.Advance(2 * time.Second)
+	done(failed)
+
+	exec.Attempt = 2
+	exec.Previous = ctx
+	_, done = hook(context.Background(), operation{key: "k0"}, exec)
+	done(nil)
+
+	spans := recorder.Ended()
+	c.Assert(spans, gc.HasLen, 2)
+	first, second := spans[0], spans[1]
+	c.Assert(first.Name(), gc.Equals, oteltrace.SpanName)
+	c.Assert(first.StartTime().Equal(exec.Started), jc.IsTrue)
+	// The span ends at the time measured by the Runner's clock.
+	c.Assert(first.EndTime().Equal(t0.Add(5*time.Second)), jc.IsTrue)
+	c.Assert(first.Attributes(), jc.DeepEquals, []attribute.KeyValue{
+		oteltrace.KeyAttribute.String("k0"),
+		oteltrace.AttemptAttribute.Int(1),
+		oteltrace.ScheduledAttribute.String("2015-01-01T00:00:00Z"),
+		oteltrace.ReadyAttribute.String("2015-01-01T00:00:01Z"),
+		oteltrace.WaitAttribute.Float64(3),
+	})
+	c.Assert(first.Status().Code, gc.Equals, codes.Error)
+	c.Assert(first.Links(), gc.HasLen, 0)
+
+	c.Assert(second.Status().Code, gc.Equals, codes.Unset)
+	c.Assert(second.Links(), gc.HasLen, 1)
+	c.Assert(second.Links()[0].SpanContext.SpanID(), gc.Equals, first.SpanContext().SpanID())
+}
+
+func (*traceSuite) TestOnExecuteTraceID(c *gc.C) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	hook := oteltrace.OnExecute[string, operation](provider.Tracer("test"))
+
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, done := hook(context.Background(), operation{key: "k0"}, schedule.Execution[string]{
+		Key:       "k0",
+		TraceID:   "workflow-1",
+		Attempt:   1,
+		Scheduled: t0,
+		Ready:     t0,
+		Started:   t0,
+	})
+	done(nil)
+
+	spans := recorder.Ended()
+	c.Assert(spans, gc.HasLen, 1)
+	c.Assert(spans[0].Attributes(), jc.DeepEquals, []attribute.KeyValue{
+		oteltrace.KeyAttribute.String("k0"),
+		oteltrace.AttemptAttribute.Int(1),
+		oteltrace.ScheduledAttribute.String("2015-01-01T00:00:00Z"),
+		oteltrace.ReadyAttribute.String("2015-01-01T00:00:00Z"),
+		oteltrace.WaitAttribute.Float64(0),
+		oteltrace.TraceIDAttribute.String("workflow-1"),
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package policy
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/axw/juju-time/duration"
+	"github.com/juju/errors"
+)
+
+// Duration is a time.Duration that is marshalled as a string accepted
+// by duration.Parse, such as "1m30s" or "1d", in both JSON and YAML.
+type Duration time.Duration
+
+// String returns the duration formatted as by duration.Format.
+func (d Duration) String() string {
+	return duration.Format(time.Duration(d))
+}
+
+// MarshalJSON is part of the json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON is part of the json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.NotValidf("duration %s", data)
+	}
+	return d.parse(s)
+}
+
+// MarshalYAML is part of the yaml.Marshaler interface.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML is part of the yaml.Unmarshaler interface.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return errors.Trace(err)
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	parsed, err := duration.Parse(s)
+	if err != nil {
+		return errors.NotValidf("duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
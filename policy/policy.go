@@ -0,0 +1,333 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package policy provides types describing backoff, rate-limiting and
+// window policies, which may be unmarshalled from configuration files
+// in JSON or YAML, and which construct the corresponding schedule and
+// retry values. Durations are written as strings, such as "30s".
+//
+// A policy in YAML looks like:
+//
+//	backoff:
+//	  min: 30s
+//	  max: 30m
+//	  factor: 2
+//	  jitter: equal
+//	  max-attempts: 10
+//	rate-limit:
+//	  limit: 100
+//	  window: 1m
+//	windows:
+//	- start: "@daily 02:00"
+//	  duration: 4h
+//	location: Europe/London
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/jitter"
+	"github.com/axw/juju-time/retry"
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/spec"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Jitter identifies the jitter applied to backoff delays; see the
+// jitter package.
+type Jitter string
+
+const (
+	// JitterNone applies no jitter. It is the default.
+	JitterNone Jitter = "none"
+
+	// JitterFull applies jitter.FullJitter.
+	JitterFull Jitter = "full"
+
+	// JitterEqual applies jitter.EqualJitter.
+	JitterEqual Jitter = "equal"
+
+	// JitterProportional applies jitter.Proportional, with the
+	// backoff's JitterFraction.
+	JitterProportional Jitter = "proportional"
+)
+
+// Backoff describes a backoff policy.
+type Backoff struct {
+	// Initial is the delay before the first attempt of an operation.
+	// It does not apply to retry strategies, whose first attempts are
+	// made immediately.
+	Initial Duration `json:"initial,omitempty" yaml:"initial,omitempty"`
+
+	// Min is the delay before the first retry.
+	Min Duration `json:"min,omitempty" yaml:"min,omitempty"`
+
+	// Max is the maximum delay between attempts.
+	Max Duration `json:"max,omitempty" yaml:"max,omitempty"`
+
+	// Factor is the factor by which each delay is multiplied to
+	// compute the next. It must be zero, for the default, or at
+	// least 1.
+	Factor float64 `json:"factor,omitempty" yaml:"factor,omitempty"`
+
+	// Jitter is the jitter applied to each delay.
+	Jitter Jitter `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+
+	// JitterFraction is the fraction for JitterProportional,
+	// in (0, 1].
+	JitterFraction float64 `json:"jitter-fraction,omitempty" yaml:"jitter-fraction,omitempty"`
+
+	// MaxAttempts and MaxDuration, if positive, limit the attempts
+	// made by retry strategies. They do not apply to operations'
+	// backoffs, whose retries are governed by the Runner's error
+	// policy.
+	MaxAttempts int      `json:"max-attempts,omitempty" yaml:"max-attempts,omitempty"`
+	MaxDuration Duration `json:"max-duration,omitempty" yaml:"max-duration,omitempty"`
+}
+
+// Validate checks that the backoff policy is valid.
+func (b Backoff) Validate() error {
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{
+		{"initial", b.Initial},
+		{"min", b.Min},
+		{"max", b.Max},
+		{"max-duration", b.MaxDuration},
+	} {
+		if d.value < 0 {
+			return errors.NotValidf("negative %s", d.name)
+		}
+	}
+	if b.Min > 0 && b.Max > 0 && b.Min > b.Max {
+		return errors.NotValidf("min %v greater than max %v", b.Min, b.Max)
+	}
+	if b.Factor != 0 && !(b.Factor >= 1) {
+		return errors.NotValidf("factor %v", b.Factor)
+	}
+	switch b.Jitter {
+	case "", JitterNone, JitterFull, JitterEqual:
+		if b.JitterFraction != 0 {
+			return errors.NotValidf("jitter-fraction without proportional jitter")
+		}
+	case JitterProportional:
+		if !(b.JitterFraction > 0 && b.JitterFraction <= 1) {
+			return errors.NotValidf("jitter-fraction %v", b.JitterFraction)
+		}
+	default:
+		return errors.NotValidf("jitter %q", b.Jitter)
+	}
+	if b.MaxAttempts < 0 {
+		return errors.NotValidf("negative max-attempts")
+	}
+	return nil
+}
+
+// JitterFunc returns a function applying the policy's jitter, with
+// random numbers from src, or nil if the policy applies no jitter. If
+// src is nil, the math/rand package's shared source is used.
+func (b Backoff) JitterFunc(src jitter.Source) func(time.Duration) time.Duration {
+	switch b.Jitter {
+	case JitterFull:
+		return func(d time.Duration) time.Duration {
+			return jitter.FullJitter(d, src)
+		}
+	case JitterEqual:
+		return func(d time.Duration) time.Duration {
+			return jitter.EqualJitter(d, src)
+		}
+	case JitterProportional:
+		fraction := b.JitterFraction
+		return func(d time.Duration) time.Duration {
+			return jitter.Proportional(d, fraction, src)
+		}
+	}
+	return nil
+}
+
+// ExponentialBackoff returns a schedule.ExponentialBackoff implementing
+// the policy, using the clock, and taking random numbers for jitter from
+// src; see JitterFunc. Unset fields take ExponentialBackoff's defaults.
+func (b Backoff) ExponentialBackoff(clock clock.Clock, src jitter.Source) (schedule.ExponentialBackoff, error) {
+	if err := b.Validate(); err != nil {
+		return schedule.ExponentialBackoff{}, errors.Annotate(err, "validating backoff policy")
+	}
+	return schedule.ExponentialBackoff{
+		Initial: time.Duration(b.Initial),
+		Min:     time.Duration(b.Min),
+		Max:     time.Duration(b.Max),
+		Factor:  b.Factor,
+		Clock:   clock,
+		Jitter:  b.JitterFunc(src),
+	}, nil
+}
+
+// Strategy returns a retry.Strategy implementing the policy, taking
+// random numbers for jitter from src; see JitterFunc. The delay before
+// the first retry is Min, and if Factor is zero, the delay is doubled
+// after each retry.
+func (b Backoff) Strategy(src jitter.Source) (retry.Strategy, error) {
+	if err := b.Validate(); err != nil {
+		return retry.Strategy{}, errors.Annotate(err, "validating backoff policy")
+	}
+	factor := b.Factor
+	if factor == 0 {
+		factor = 2
+	}
+	return retry.Strategy{
+		Delay:       time.Duration(b.Min),
+		Factor:      factor,
+		MaxDelay:    time.Duration(b.Max),
+		MaxAttempts: b.MaxAttempts,
+		MaxDuration: time.Duration(b.MaxDuration),
+		Jitter:      b.JitterFunc(src),
+	}, nil
+}
+
+// RateLimit describes a limit on the rate at which a schedule
+// releases operations; see schedule.RateLimit.
+type RateLimit struct {
+	Limit  int      `json:"limit,omitempty" yaml:"limit,omitempty"`
+	Window Duration `json:"window,omitempty" yaml:"window,omitempty"`
+}
+
+// Validate checks that the rate limit is valid.
+func (r RateLimit) Validate() error {
+	if r.Limit < 0 {
+		return errors.NotValidf("negative limit")
+	}
+	if r.Limit > 0 && r.Window <= 0 {
+		return errors.NotValidf("non-positive window")
+	}
+	return nil
+}
+
+// RateLimit returns the corresponding schedule.RateLimit.
+func (r RateLimit) RateLimit() (schedule.RateLimit, error) {
+	if err := r.Validate(); err != nil {
+		return schedule.RateLimit{}, errors.Annotate(err, "validating rate limit")
+	}
+	return schedule.RateLimit{Limit: r.Limit, Window: time.Duration(r.Window)}, nil
+}
+
+// Window describes a window of time in which operations may execute;
+// see schedule.Window.
+type Window struct {
+	// Start is a schedule spec, as accepted by spec.Parse, giving
+	// the times at which the window opens.
+	Start string `json:"start" yaml:"start"`
+
+	// Duration is the length of time for which the window remains
+	// open, each time it opens.
+	Duration Duration `json:"duration" yaml:"duration"`
+}
+
+// Window returns the corresponding schedule.Window, with its start
+// times in the location.
+func (w Window) Window(loc *time.Location) (schedule.Window, error) {
+	if w.Duration <= 0 {
+		return schedule.Window{}, errors.NotValidf("non-positive duration")
+	}
+	start, err := spec.Parse(w.Start, loc)
+	if err != nil {
+		return schedule.Window{}, errors.Trace(err)
+	}
+	return schedule.Window{Start: start, Duration: time.Duration(w.Duration)}, nil
+}
+
+// Policy gathers the policies that are typically configured together
+// for a kind of operation.
+type Policy struct {
+	Backoff   Backoff   `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	RateLimit RateLimit `json:"rate-limit,omitempty" yaml:"rate-limit,omitempty"`
+	Windows   []Window  `json:"windows,omitempty" yaml:"windows,omitempty"`
+
+	// Location is the name of the location, as accepted by
+	// time.LoadLocation, in which the windows' start times are
+	// interpreted. If Location is empty, UTC is used.
+	Location string `json:"location,omitempty" yaml:"location,omitempty"`
+}
+
+// Validate checks that the policy is valid.
+func (p Policy) Validate() error {
+	if err := p.Backoff.Validate(); err != nil {
+		return errors.Annotate(err, "backoff")
+	}
+	if err := p.RateLimit.Validate(); err != nil {
+		return errors.Annotate(err, "rate-limit")
+	}
+	_, err := p.ScheduleWindows()
+	return errors.Trace(err)
+}
+
+// ScheduleWindows returns the corresponding schedule.Windows.
+func (p Policy) ScheduleWindows() ([]schedule.Window, error) {
+	loc, err := p.location()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var windows []schedule.Window
+	for i, w := range p.Windows {
+		window, err := w.Window(loc)
+		if err != nil {
+			return nil, errors.Annotatef(err, "window %d", i)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func (p Policy) location() (*time.Location, error) {
+	if p.Location == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(p.Location)
+	if err != nil {
+		return nil, errors.NotValidf("location %q", p.Location)
+	}
+	return loc, nil
+}
+
+// ParseJSON parses and validates a policy in JSON. Unknown
+// fields are rejected.
+func ParseJSON(data []byte) (Policy, error) {
+	var p Policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return Policy{}, errors.Annotate(err, "parsing policy")
+	}
+	return validated(p)
+}
+
+// ParseYAML parses and validates a policy in YAML. Unknown
+// fields are rejected.
+func ParseYAML(data []byte) (Policy, error) {
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return Policy{}, errors.Annotate(err, "parsing policy")
+	}
+	return validated(p)
+}
+
+func validated(p Policy) (Policy, error) {
+	if err := p.Validate(); err != nil {
+		return Policy{}, errors.Annotate(err, "validating policy")
+	}
+	return p, nil
+}
+
+// String returns the policy in YAML.
+func (p Policy) String() string {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return fmt.Sprintf("Policy(%v)", err)
+	}
+	return string(data)
+}
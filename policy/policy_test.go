@@ -0,0 +1,208 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package policy_test
+
+import (
+	"encoding/json"
+	"time"
+
+	jittertesting "github.com/axw/juju-time/jitter/testing"
+	"github.com/axw/juju-time/policy"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type policySuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&policySuite{})
+
+const yamlPolicy = `
+backoff:
+  min: 30s
+  max: 30m
+  factor: 3
+  max-attempts: 10
+  max-duration: 2h
+rate-limit:
+  limit: 100
+  window: 1m
+windows:
+- start: "@daily 02:00"
+  duration: 4h
+location: UTC
+`
+
+const jsonPolicy = `{
+	"backoff": {"min": "30s", "max": "30m", "factor": 3, "max-attempts": 10, "max-duration": "2h"},
+	"rate-limit": {"limit": 100, "window": "1m"},
+	"windows": [{"start": "@daily 02:00", "duration": "4h"}],
+	"location": "UTC"
+}`
+
+var expectPolicy = policy.Policy{
+	Backoff: policy.Backoff{
+		Min:         policy.Duration(30 * time.Second),
+		Max:         policy.Duration(30 * time.Minute),
+		Factor:      3,
+		MaxAttempts: 10,
+		MaxDuration: policy.Duration(2 * time.Hour),
+	},
+	RateLimit: policy.RateLimit{
+		Limit:  100,
+		Window: policy.Duration(time.Minute),
+	},
+	Windows: []policy.Window{{
+		Start:    "@daily 02:00",
+		Duration: policy.Duration(4 * time.Hour),
+	}},
+	Location: "UTC",
+}
+
+func (*policySuite) TestParse(c *gc.C) {
+	p, err := policy.ParseYAML([]byte(yamlPolicy))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(p, jc.DeepEquals, expectPolicy)
+
+	p, err = policy.ParseJSON([]byte(jsonPolicy))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(p, jc.DeepEquals, expectPolicy)
+}
+
+func (*policySuite) TestRoundTrip(c *gc.C) {
+	p, err := policy.ParseYAML([]byte(expectPolicy.String()))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(p, jc.DeepEquals, expectPolicy)
+
+	data, err := json.Marshal(expectPolicy)
+	c.Assert(err, jc.ErrorIsNil)
+	p, err = policy.ParseJSON(data)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(p, jc.DeepEquals, expectPolicy)
+}
+
+func (*policySuite) TestParseDays(c *gc.C) {
+	p, err := policy.ParseYAML([]byte("backoff: {min: 1h, max: 1d, max-duration: 2w}"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(p.Backoff.Max, gc.Equals, policy.Duration(24*time.Hour))
+	c.Assert(p.Backoff.MaxDuration, gc.Equals, policy.Duration(14*24*time.Hour))
+	c.Assert(p.Backoff.MaxDuration.String(), gc.Equals, "2w")
+}
+
+func (*policySuite) TestParseErrors(c *gc.C) {
+	for _, test := range []struct {
+		yaml string
+		err  string
+	}{
+		{"backoff: {min: soon}", `parsing policy: duration "soon" not valid`},
+		{"backoff: {min: -1s}", `validating policy: backoff: negative min not valid`},
+		{"backoff: {min: 1m, max: 1s}", `validating policy: backoff: min 1m greater than max 1s not valid`},
+		{"backoff: {factor: 0.5}", `validating policy: backoff: factor 0.5 not valid`},
+		{"backoff: {jitter: some}", `validating policy: backoff: jitter "some" not valid`},
+		{"backoff: {jitter: proportional}", `validating policy: backoff: jitter-fraction 0 not valid`},
+		{"backoff: {jitter: proportional, jitter-fraction: 1.5}", `validating policy: backoff: jitter-fraction 1.5 not valid`},
+		{"backoff: {jitter-fraction: 0.5}", `validating policy: backoff: jitter-fraction without proportional jitter not valid`},
+		{"backoff: {max-attempts: -1}", `validating policy: backoff: negative max-attempts not valid`},
+		{"backoff: {retries: 3}", `(?s)parsing policy: .*field retries not found.*`},
+		{"rate-limit: {limit: -1}", `validating policy: rate-limit: negative limit not valid`},
+		{"rate-limit: {limit: 1}", `validating policy: rate-limit: non-positive window not valid`},
+		{"windows: [{start: '@daily', duration: 0s}]", `validating policy: window 0: non-positive duration not valid`},
+		{"windows: [{start: '@fortnightly', duration: 1h}]", `validating policy: window 0: parsing schedule spec "@fortnightly": unknown macro "@fortnightly"`},
+		{"location: Nowhere/Special", `validating policy: location "Nowhere/Special" not valid`},
+	} {
+		c.Logf("%s", test.yaml)
+		_, err := policy.ParseYAML([]byte(test.yaml))
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+
+	_, err := policy.ParseJSON([]byte(`{"backoff": {"min": 30}}`))
+	c.Check(err, gc.ErrorMatches, `parsing policy: duration 30 not valid`)
+	_, err = policy.ParseJSON([]byte(`{"backof": {}}`))
+	c.Check(err, gc.ErrorMatches, `parsing policy: json: unknown field "backof"`)
+}
+
+func (*policySuite) TestExponentialBackoff(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	b, err := expectPolicy.Backoff.ExponentialBackoff(clock, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(b.Jitter, gc.IsNil)
+	b.Jitter = nil
+	c.Assert(b, jc.DeepEquals, schedule.ExponentialBackoff{
+		Min:    30 * time.Second,
+		Max:    30 * time.Minute,
+		Factor: 3,
+		Clock:  clock,
+	})
+
+	_, err = policy.Backoff{Factor: -1}.ExponentialBackoff(clock, nil)
+	c.Assert(err, gc.ErrorMatches, `validating backoff policy: factor -1 not valid`)
+}
+
+func (*policySuite) TestStrategy(c *gc.C) {
+	s, err := expectPolicy.Backoff.Strategy(nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.Delay, gc.Equals, 30*time.Second)
+	c.Assert(s.Factor, gc.Equals, 3.0)
+	c.Assert(s.MaxDelay, gc.Equals, 30*time.Minute)
+	c.Assert(s.MaxAttempts, gc.Equals, 10)
+	c.Assert(s.MaxDuration, gc.Equals, 2*time.Hour)
+	c.Assert(s.Jitter, gc.IsNil)
+
+	s, err = policy.Backoff{}.Strategy(nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.Factor, gc.Equals, 2.0)
+}
+
+func (*policySuite) TestJitterFunc(c *gc.C) {
+	c.Assert(policy.Backoff{}.JitterFunc(nil), gc.IsNil)
+	c.Assert(policy.Backoff{Jitter: policy.JitterNone}.JitterFunc(nil), gc.IsNil)
+	for _, test := range []struct {
+		backoff  policy.Backoff
+		min, max time.Duration
+	}{
+		{policy.Backoff{Jitter: policy.JitterFull}, 0, time.Minute},
+		{policy.Backoff{Jitter: policy.JitterEqual}, 30 * time.Second, time.Minute},
+		{policy.Backoff{Jitter: policy.JitterProportional, JitterFraction: 0.5}, 30 * time.Second, 90 * time.Second},
+	} {
+		c.Logf("%q", test.backoff.Jitter)
+		f := test.backoff.JitterFunc(jittertesting.NewSource(1))
+		c.Assert(f, gc.NotNil)
+		var delays []time.Duration
+		for i := 0; i < 100; i++ {
+			d := f(time.Minute)
+			c.Assert(d >= test.min && d <= test.max, jc.IsTrue, gc.Commentf("%v", d))
+			delays = append(delays, d)
+		}
+
+		// The same seed produces the same delays.
+		f = test.backoff.JitterFunc(jittertesting.NewSource(1))
+		for _, d := range delays {
+			c.Assert(f(time.Minute), gc.Equals, d)
+		}
+	}
+}
+
+func (*policySuite) TestRateLimit(c *gc.C) {
+	r, err := expectPolicy.RateLimit.RateLimit()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(r, jc.DeepEquals, schedule.RateLimit{Limit: 100, Window: time.Minute})
+}
+
+func (*policySuite) TestScheduleWindows(c *gc.C) {
+	p := expectPolicy
+	p.Location = "Australia/Perth"
+	windows, err := p.ScheduleWindows()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(windows, gc.HasLen, 1)
+	c.Assert(windows[0].Duration, gc.Equals, 4*time.Hour)
+
+	loc, err := time.LoadLocation("Australia/Perth")
+	c.Assert(err, jc.ErrorIsNil)
+	t := time.Date(2015, 7, 15, 3, 0, 0, 0, loc)
+	c.Assert(windows[0].Contains(t), jc.IsTrue)
+	c.Assert(windows[0].Contains(t.Add(4*time.Hour)), jc.IsFalse)
+}
@@ -0,0 +1,219 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package pool provides a Pool of goroutines for executing tasks, with
+// bounded concurrency, recovery from panics, and draining on shutdown.
+package pool
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// ErrStopped is returned by Pool.Go when the pool has been closed
+// or killed.
+var ErrStopped = errors.New("pool stopped")
+
+// Config holds the configuration for a Pool.
+type Config struct {
+	// Size, if positive, is the maximum number of tasks that the
+	// pool will execute concurrently.
+	Size int
+
+	// Idle is the maximum number of idle goroutines that the pool
+	// keeps, waiting for tasks, once they have finished executing a
+	// task. Keeping idle goroutines avoids starting a new goroutine
+	// for each task, at the cost of the idle goroutines' stacks.
+	Idle int
+
+	// OnPanic, if non-nil, is called when a task panics, with the
+	// recovered value and the stack trace of the panicking
+	// goroutine. A panic in a task does not affect the pool or
+	// any other tasks.
+	OnPanic func(value interface{}, stack []byte)
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Size < 0 {
+		return errors.NotValidf("negative Size")
+	}
+	if config.Idle < 0 {
+		return errors.NotValidf("negative Idle")
+	}
+	return nil
+}
+
+// Pool executes tasks in pooled goroutines.
+//
+// Pool's methods are safe for concurrent use.
+type Pool struct {
+	config Config
+
+	mu      sync.Mutex
+	active  int
+	idle    int
+	stopped bool
+
+	// freed is closed, and replaced, whenever a task completes,
+	// to wake callers of Go waiting for a free slot.
+	freed chan struct{}
+
+	// tasks is used to hand tasks to idle goroutines.
+	tasks chan func(context.Context)
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+// New returns a new Pool with the given configuration, with no
+// goroutines.
+func New(config Config) (*Pool, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating pool config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		config: config,
+		freed:  make(chan struct{}),
+		tasks:  make(chan func(context.Context)),
+		ctx:    ctx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// TryGo executes the task in one of the pool's goroutines, and
+// reports whether or not it did so: TryGo returns false without
+// executing the task if the pool is executing as many tasks as
+// its Size allows, or if it has been closed or killed.
+//
+// The task is passed a context that is cancelled when the pool
+// is killed.
+func (p *Pool) TryGo(task func(ctx context.Context)) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return false
+	}
+	if p.config.Size > 0 && p.active >= p.config.Size {
+		return false
+	}
+	p.active++
+	if p.idle > 0 {
+		// An idle goroutine is, or is about to be, waiting
+		// to receive; since the pool has not stopped, it
+		// will not exit in the meantime.
+		p.idle--
+		p.tasks <- task
+		return true
+	}
+	p.workers.Add(1)
+	go p.worker(task)
+	return true
+}
+
+// Go is like TryGo, but waits for a free slot if the pool is executing
+// as many tasks as its Size allows. Go returns the context's error if
+// the context is done first, or ErrStopped if the pool is closed or
+// killed.
+func (p *Pool) Go(ctx context.Context, task func(ctx context.Context)) error {
+	for {
+		p.mu.Lock()
+		stopped, freed := p.stopped, p.freed
+		p.mu.Unlock()
+		if stopped {
+			return ErrStopped
+		}
+		if p.TryGo(task) {
+			return nil
+		}
+		select {
+		case <-freed:
+		case <-p.stop:
+			return ErrStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Active returns the number of tasks currently executing.
+func (p *Pool) Active() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// Close stops the pool from accepting new tasks, leaving the executing
+// tasks to complete; use Wait to wait for them.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.stop)
+	}
+}
+
+// Kill closes the pool, and cancels the context passed to the executing
+// tasks. Kill does not wait for the tasks to return; use Wait for that.
+func (p *Pool) Kill() {
+	p.Close()
+	p.cancel()
+}
+
+// Wait waits for the pool to be closed or killed, and then for all of
+// its tasks to return and its goroutines to exit.
+func (p *Pool) Wait() error {
+	<-p.stop
+	p.workers.Wait()
+	return nil
+}
+
+// worker executes the task, and then any further tasks handed to it
+// while it is idle.
+func (p *Pool) worker(task func(context.Context)) {
+	defer p.workers.Done()
+	for {
+		p.run(task)
+		if !p.finished() {
+			return
+		}
+		select {
+		case task = <-p.tasks:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// finished records the completion of a task, and reports whether
+// the goroutine that executed it should wait, idle, for another.
+func (p *Pool) finished() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active--
+	close(p.freed)
+	p.freed = make(chan struct{})
+	if p.stopped || p.idle >= p.config.Idle {
+		return false
+	}
+	p.idle++
+	return true
+}
+
+// run executes the task, recovering from any panic.
+func (p *Pool) run(task func(context.Context)) {
+	defer func() {
+		if v := recover(); v != nil && p.config.OnPanic != nil {
+			p.config.OnPanic(v, debug.Stack())
+		}
+	}()
+	task(p.ctx)
+}
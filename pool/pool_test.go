@@ -0,0 +1,192 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package pool_test
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/axw/juju-time/pool"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type poolSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&poolSuite{})
+
+func newPool(c *gc.C, config pool.Config) *pool.Pool {
+	p, err := pool.New(config)
+	c.Assert(err, jc.ErrorIsNil)
+	return p
+}
+
+func stop(c *gc.C, p *pool.Pool) {
+	p.Kill()
+	c.Assert(p.Wait(), jc.ErrorIsNil)
+}
+
+func wait(c *gc.C, ch <-chan struct{}) {
+	select {
+	case <-ch:
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting")
+	}
+}
+
+func (*poolSuite) TestValidate(c *gc.C) {
+	_, err := pool.New(pool.Config{Size: -1})
+	c.Assert(err, gc.ErrorMatches, "validating pool config: negative Size not valid")
+	_, err = pool.New(pool.Config{Idle: -1})
+	c.Assert(err, gc.ErrorMatches, "validating pool config: negative Idle not valid")
+}
+
+func (*poolSuite) TestSize(c *gc.C) {
+	p := newPool(c, pool.Config{Size: 2})
+	defer stop(c, p)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	task := func(context.Context) {
+		started <- struct{}{}
+		<-release
+	}
+	c.Assert(p.TryGo(task), jc.IsTrue)
+	c.Assert(p.TryGo(task), jc.IsTrue)
+	c.Assert(p.TryGo(task), jc.IsFalse)
+	wait(c, started)
+	wait(c, started)
+	c.Assert(p.Active(), gc.Equals, 2)
+
+	// Go waits for a free slot.
+	result := make(chan error, 1)
+	go func() {
+		result <- p.Go(context.Background(), task)
+	}()
+	select {
+	case err := <-result:
+		c.Fatalf("Go returned early: %v", err)
+	case <-time.After(coretesting.ShortWait):
+	}
+	release <- struct{}{}
+	select {
+	case err := <-result:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for Go")
+	}
+	wait(c, started)
+	close(release)
+}
+
+func (*poolSuite) TestGoContext(c *gc.C) {
+	p := newPool(c, pool.Config{Size: 1})
+	defer stop(c, p)
+
+	release := make(chan struct{})
+	defer close(release)
+	c.Assert(p.TryGo(func(context.Context) { <-release }), jc.IsTrue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.Go(ctx, func(context.Context) {})
+	c.Assert(err, gc.Equals, context.Canceled)
+}
+
+func (*poolSuite) TestPanic(c *gc.C) {
+	panics := make(chan interface{}, 1)
+	p := newPool(c, pool.Config{
+		OnPanic: func(v interface{}, stack []byte) {
+			c.Check(string(stack), gc.Matches, "(?s).*pool_test.go.*")
+			panics <- v
+		},
+	})
+	defer stop(c, p)
+
+	c.Assert(p.TryGo(func(context.Context) { panic("oops") }), jc.IsTrue)
+	select {
+	case v := <-panics:
+		c.Assert(v, gc.Equals, "oops")
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for panic")
+	}
+
+	// The pool continues to execute tasks.
+	done := make(chan struct{})
+	c.Assert(p.TryGo(func(context.Context) { close(done) }), jc.IsTrue)
+	wait(c, done)
+}
+
+// goroutineID returns the ID of the calling goroutine,
+// from the header of its stack trace.
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	return strings.Fields(string(buf))[1]
+}
+
+func (*poolSuite) TestIdleReuse(c *gc.C) {
+	p := newPool(c, pool.Config{Idle: 1})
+	defer stop(c, p)
+
+	run := func() string {
+		ids := make(chan string, 1)
+		c.Assert(p.TryGo(func(context.Context) {
+			ids <- goroutineID()
+		}), jc.IsTrue)
+		id := <-ids
+		// Wait for the goroutine to become idle.
+		for p.Active() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		return id
+	}
+	first := run()
+	for i := 0; i < 10; i++ {
+		c.Assert(run(), gc.Equals, first)
+	}
+}
+
+func (*poolSuite) TestCloseDrains(c *gc.C) {
+	p := newPool(c, pool.Config{Idle: 2})
+	release := make(chan struct{})
+	var ctxErr error
+	c.Assert(p.TryGo(func(ctx context.Context) {
+		<-release
+		ctxErr = ctx.Err()
+	}), jc.IsTrue)
+	p.Close()
+	c.Assert(p.TryGo(func(context.Context) {}), jc.IsFalse)
+	c.Assert(p.Go(context.Background(), func(context.Context) {}), gc.Equals, pool.ErrStopped)
+
+	waited := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		c.Fatalf("Wait returned before tasks completed")
+	case <-time.After(coretesting.ShortWait):
+	}
+	close(release)
+	wait(c, waited)
+
+	// Closing does not cancel the tasks' context.
+	c.Assert(ctxErr, jc.ErrorIsNil)
+}
+
+func (*poolSuite) TestKill(c *gc.C) {
+	p := newPool(c, pool.Config{Idle: 2})
+	c.Assert(p.TryGo(func(ctx context.Context) {
+		<-ctx.Done()
+	}), jc.IsTrue)
+	stop(c, p)
+	c.Assert(p.Active(), gc.Equals, 0)
+}
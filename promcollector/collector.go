@@ -0,0 +1,138 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build prometheus
+
+package promcollector
+
+import (
+	"github.com/axw/juju-time/schedule"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RunnerCollector is a prometheus.Collector that exports the statistics
+// of a Runner, and the execution latencies that it records, by class:
+//
+//	<namespace>_runner_operations{state="pending|blocked|queued|active|parked"}
+//	<namespace>_runner_ready_total
+//	<namespace>_runner_executions_total
+//	<namespace>_runner_failures_total
+//	<namespace>_runner_retries_total
+//	<namespace>_runner_drops_total
+//	<namespace>_runner_parks_total
+//	<namespace>_runner_expiries_total
+//	<namespace>_runner_latency_seconds{class="...",stat="mean|max|last"}
+//	<namespace>_runner_class_executions_total{class="..."}
+//
+// Latencies are only recorded if the Runner is configured with a
+// LatencyClass function.
+type RunnerCollector[K comparable, O schedule.RunnableOperation[K]] struct {
+	runner *schedule.Runner[K, O]
+
+	operations      *prometheus.Desc
+	ready           *prometheus.Desc
+	executions      *prometheus.Desc
+	failures        *prometheus.Desc
+	retries         *prometheus.Desc
+	drops           *prometheus.Desc
+	parks           *prometheus.Desc
+	expiries        *prometheus.Desc
+	latency         *prometheus.Desc
+	classExecutions *prometheus.Desc
+}
+
+// NewRunnerCollector returns a new RunnerCollector for the runner,
+// whose metrics are named within the namespace, and carry the constant
+// labels.
+func NewRunnerCollector[K comparable, O schedule.RunnableOperation[K]](
+	runner *schedule.Runner[K, O], namespace string, labels prometheus.Labels,
+) *RunnerCollector[K, O] {
+	desc := func(name, help string, variableLabels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "runner", name),
+			help, variableLabels, labels,
+		)
+	}
+	return &RunnerCollector[K, O]{
+		runner:          runner,
+		operations:      desc("operations", "Number of operations held by the runner, by state.", "state"),
+		ready:           desc("ready_total", "Number of operations that have become ready."),
+		executions:      desc("executions_total", "Number of completed executions."),
+		failures:        desc("failures_total", "Number of executions that failed or panicked."),
+		retries:         desc("retries_total", "Number of failed executions whose operations were retried."),
+		drops:           desc("drops_total", "Number of operations dropped after failing."),
+		parks:           desc("parks_total", "Number of failed executions whose operations were parked."),
+		expiries:        desc("expiries_total", "Number of operations dropped on exceeding their maximum lifetime."),
+		latency:         desc("latency_seconds", "Execution latency statistics, by class.", "class", "stat"),
+		classExecutions: desc("class_executions_total", "Number of completed executions, by class.", "class"),
+	}
+}
+
+// Describe is part of the prometheus.Collector interface.
+func (c *RunnerCollector[K, O]) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.operations
+	ch <- c.ready
+	ch <- c.executions
+	ch <- c.failures
+	ch <- c.retries
+	ch <- c.drops
+	ch <- c.parks
+	ch <- c.expiries
+	ch <- c.latency
+	ch <- c.classExecutions
+}
+
+// Collect is part of the prometheus.Collector interface.
+func (c *RunnerCollector[K, O]) Collect(ch chan<- prometheus.Metric) {
+	stats := c.runner.Stats()
+	for _, state := range []struct {
+		name  string
+		count int
+	}{
+		{"pending", stats.Pending},
+		{"blocked", stats.Blocked},
+		{"queued", stats.Queued},
+		{"active", stats.Active},
+		{"parked", stats.Parked},
+	} {
+		ch <- prometheus.MustNewConstMetric(c.operations, prometheus.GaugeValue, float64(state.count), state.name)
+	}
+	counter := func(desc *prometheus.Desc, n uint64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(n))
+	}
+	counter(c.ready, stats.Ready)
+	counter(c.executions, stats.Executed)
+	counter(c.failures, stats.Failed)
+	counter(c.retries, stats.Retried)
+	counter(c.drops, stats.Dropped)
+	counter(c.parks, stats.ParkedTotal)
+	counter(c.expiries, stats.Expired)
+
+	for class, l := range c.runner.Latencies() {
+		ch <- prometheus.MustNewConstMetric(c.latency, prometheus.GaugeValue, l.Mean.Seconds(), class, "mean")
+		ch <- prometheus.MustNewConstMetric(c.latency, prometheus.GaugeValue, l.Max.Seconds(), class, "max")
+		ch <- prometheus.MustNewConstMetric(c.latency, prometheus.GaugeValue, l.Last.Seconds(), class, "last")
+		ch <- prometheus.MustNewConstMetric(c.classExecutions, prometheus.CounterValue, float64(l.Count), class)
+	}
+}
+
+// Lener is implemented by queues and caches that report their length,
+// such as *workqueue.Queue, *timequeue.DelayQueue and *ttlcache.Cache.
+type Lener interface {
+	Len() int
+}
+
+// NewDepthCollector returns a prometheus.Collector that exports the
+// length of the queue as the gauge <namespace>_<name>_depth, with the
+// constant labels.
+func NewDepthCollector(queue Lener, namespace, name string, labels prometheus.Labels) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   name,
+		Name:        "depth",
+		Help:        "Number of items in the queue.",
+		ConstLabels: labels,
+	}, func() float64 {
+		return float64(queue.Len())
+	})
+}
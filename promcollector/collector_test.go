@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build prometheus
+
+package promcollector_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/promcollector"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	gc "gopkg.in/check.v1"
+)
+
+type collectorSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&collectorSuite{})
+
+type operation struct {
+	key string
+	err error
+}
+
+func (o operation) Key() string                  { return o.key }
+func (o operation) Delay() time.Duration         { return time.Hour }
+func (o operation) Do(ctx context.Context) error { return o.err }
+
+func (*collectorSuite) TestRunnerCollector(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	sched := schedule.NewSchedule[string, operation](clock)
+	r, err := schedule.NewRunner(schedule.RunnerConfig[string, operation]{
+		Schedule: sched,
+		LatencyClass: func(op operation) string {
+			return "all"
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Kill()
+
+	// The operation is executed once its delay has passed; it
+	// fails, and is rescheduled for an hour later.
+	r.Add(operation{key: "fails", err: errors.New("failed")})
+	clocktesting.NewHarness(clock).Settle(c)
+	clocktesting.ExpectTimer(c, clock, time.Hour)
+	clock.Advance(time.Hour)
+	timeout := time.After(coretesting.LongWait)
+	for r.Stats().Executed != 1 {
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for execution")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	collector := promcollector.NewRunnerCollector(r, "test", nil)
+	err = testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP test_runner_failures_total Number of executions that failed or panicked.
+# TYPE test_runner_failures_total counter
+test_runner_failures_total 1
+# HELP test_runner_operations Number of operations held by the runner, by state.
+# TYPE test_runner_operations gauge
+test_runner_operations{state="active"} 0
+test_runner_operations{state="blocked"} 0
+test_runner_operations{state="parked"} 0
+test_runner_operations{state="pending"} 1
+test_runner_operations{state="queued"} 0
+# HELP test_runner_retries_total Number of failed executions whose operations were retried.
+# TYPE test_runner_retries_total counter
+test_runner_retries_total 1
+`), "test_runner_failures_total", "test_runner_operations", "test_runner_retries_total")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(testutil.CollectAndCount(collector, "test_runner_latency_seconds"), gc.Equals, 3)
+}
+
+func (*collectorSuite) TestDepthCollector(c *gc.C) {
+	collector := promcollector.NewDepthCollector(fixedLen(3), "test", "work", prometheus.Labels{"queue": "q0"})
+	err := testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP test_work_depth Number of items in the queue.
+# TYPE test_work_depth gauge
+test_work_depth{queue="q0"} 3
+`))
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+type fixedLen int
+
+func (n fixedLen) Len() int {
+	return int(n)
+}
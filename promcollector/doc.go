@@ -0,0 +1,12 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package promcollector provides prometheus.Collectors exporting the
+// metrics of Runners and queues.
+//
+// So that the other packages remain free of dependencies on the
+// Prometheus client, the collectors are only built with the
+// "prometheus" build tag:
+//
+//	go build -tags prometheus
+package promcollector
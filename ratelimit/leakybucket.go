@@ -0,0 +1,111 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package ratelimit provides rate limiters that measure time with
+// an injected clock.Clock, so that they may be tested deterministically.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// ErrBucketFull is returned by LeakyBucket.Wait when the bucket
+// cannot accept any more waiting events.
+var ErrBucketFull = errors.New("bucket full")
+
+// LeakyBucketConfig holds the configuration for a LeakyBucket.
+type LeakyBucketConfig struct {
+	// Clock is used to pace events.
+	Clock clock.Clock
+
+	// Interval is the time between consecutive events
+	// released by the bucket.
+	Interval time.Duration
+
+	// Capacity, if positive, is the maximum number of events that
+	// may be waiting in the bucket at once. Events in excess of the
+	// capacity are rejected.
+	Capacity int
+}
+
+// Validate checks that the config is valid.
+func (config LeakyBucketConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Interval <= 0 {
+		return errors.NotValidf("non-positive Interval")
+	}
+	if config.Capacity < 0 {
+		return errors.NotValidf("negative Capacity")
+	}
+	return nil
+}
+
+// LeakyBucket paces events at a constant rate: no two events are
+// released less than Interval apart, regardless of how bursty their
+// arrival is. Unlike a token bucket, a LeakyBucket never releases
+// bursts of events.
+//
+// LeakyBucket's methods are safe for concurrent use.
+type LeakyBucket struct {
+	config LeakyBucketConfig
+
+	mu sync.Mutex
+	// next is the earliest time at which the next event
+	// may be released.
+	next time.Time
+}
+
+// NewLeakyBucket returns a new LeakyBucket with the given configuration.
+func NewLeakyBucket(config LeakyBucketConfig) (*LeakyBucket, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating leaky bucket config")
+	}
+	return &LeakyBucket{config: config}, nil
+}
+
+// Reserve reserves a slot for an event, returning how long the caller
+// must wait before the event is released, and a boolean indicating
+// whether or not the slot was reserved. If the bucket is at capacity,
+// no slot is reserved.
+func (b *LeakyBucket) Reserve() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.config.Clock.Now()
+	t := b.next
+	if t.Before(now) {
+		t = now
+	}
+	wait := t.Sub(now)
+	if b.config.Capacity > 0 && wait >= time.Duration(b.config.Capacity)*b.config.Interval {
+		return 0, false
+	}
+	b.next = t.Add(b.config.Interval)
+	return wait, true
+}
+
+// Wait reserves a slot for an event, and waits until the event is
+// released. If the bucket is at capacity, Wait returns ErrBucketFull
+// immediately. If the context is cancelled while waiting, Wait returns
+// the context's error; the reserved slot is not reclaimed.
+func (b *LeakyBucket) Wait(ctx context.Context) error {
+	wait, ok := b.Reserve()
+	if !ok {
+		return ErrBucketFull
+	}
+	if wait == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.config.Clock.After(wait):
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ratelimit_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/ratelimit"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type leakyBucketSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&leakyBucketSuite{})
+
+func (*leakyBucketSuite) TestValidate(c *gc.C) {
+	_, err := ratelimit.NewLeakyBucket(ratelimit.LeakyBucketConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating leaky bucket config: nil Clock not valid")
+	_, err = ratelimit.NewLeakyBucket(ratelimit.LeakyBucketConfig{
+		Clock: coretesting.NewClock(time.Time{}),
+	})
+	c.Assert(err, gc.ErrorMatches, "validating leaky bucket config: non-positive Interval not valid")
+}
+
+func (*leakyBucketSuite) TestReserve(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	b, err := ratelimit.NewLeakyBucket(ratelimit.LeakyBucketConfig{
+		Clock:    clock,
+		Interval: time.Second,
+		Capacity: 3,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// A burst is paced out at the bucket's interval.
+	for i := 0; i < 3; i++ {
+		wait, ok := b.Reserve()
+		c.Assert(ok, jc.IsTrue)
+		c.Assert(wait, gc.Equals, time.Duration(i)*time.Second)
+	}
+	_, ok := b.Reserve()
+	c.Assert(ok, jc.IsFalse)
+
+	clock.Advance(1500 * time.Millisecond)
+	wait, ok := b.Reserve()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(wait, gc.Equals, 1500*time.Millisecond)
+
+	// Once idle, events are released immediately.
+	clock.Advance(time.Minute)
+	wait, ok = b.Reserve()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(wait, gc.Equals, time.Duration(0))
+}
+
+func (*leakyBucketSuite) TestWait(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	b, err := ratelimit.NewLeakyBucket(ratelimit.LeakyBucketConfig{
+		Clock:    clock,
+		Interval: time.Second,
+		Capacity: 2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(b.Wait(context.Background()), jc.ErrorIsNil)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Wait(context.Background())
+	}()
+	c.Assert(advanceUntil(c, clock, done, 100*time.Millisecond), jc.ErrorIsNil)
+
+}
+
+func (*leakyBucketSuite) TestWaitFull(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	b, err := ratelimit.NewLeakyBucket(ratelimit.LeakyBucketConfig{
+		Clock:    clock,
+		Interval: time.Second,
+		Capacity: 1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.Reserve()
+	c.Assert(b.Wait(ctx), gc.Equals, ratelimit.ErrBucketFull)
+	clock.Advance(500 * time.Millisecond)
+	c.Assert(b.Wait(ctx), gc.Equals, context.Canceled)
+}
+
+// advanceUntil repeatedly advances the clock by d until a value is
+// received on ch.
+func advanceUntil[T any](c *gc.C, clock *coretesting.Clock, ch <-chan T, d time.Duration) T {
+	timeout := time.After(coretesting.LongWait)
+	for {
+		clock.Advance(d)
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(coretesting.ShortWait):
+		case <-timeout:
+			c.Fatalf("timed out waiting for value")
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// PacerPolicy determines how a Pacer behaves when its caller
+// falls behind, missing one or more instants.
+type PacerPolicy int
+
+const (
+	// CatchUp causes a Pacer to return immediately for each missed
+	// instant, so that the caller catches up with the schedule.
+	CatchUp PacerPolicy = iota
+
+	// Skip causes a Pacer to return immediately for the most recent
+	// missed instant only, skipping those before it, so that the
+	// caller resumes pacing from the next instant.
+	Skip
+)
+
+// PacerConfig holds the configuration for a Pacer.
+type PacerConfig struct {
+	// Clock is used to pace the caller.
+	Clock clock.Clock
+
+	// Interval is the time between consecutive instants.
+	Interval time.Duration
+
+	// Policy determines how the Pacer behaves when its caller
+	// misses instants.
+	Policy PacerPolicy
+}
+
+// Validate checks that the config is valid.
+func (config PacerConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Interval <= 0 {
+		return errors.NotValidf("non-positive Interval")
+	}
+	if config.Policy != CatchUp && config.Policy != Skip {
+		return errors.NotValidf("Policy %d", config.Policy)
+	}
+	return nil
+}
+
+// Pacer paces iterations of a loop at evenly spaced instants, Interval
+// apart, starting when Wait is first called. Unlike a ticker, the
+// instants do not drift with the time taken by each iteration; unlike
+// a LeakyBucket, a Pacer keeps to its schedule when the caller falls
+// behind, catching up or skipping missed instants according to its
+// policy.
+//
+// Pacer's methods are safe for concurrent use, but a Pacer is
+// intended to pace a single loop.
+type Pacer struct {
+	config PacerConfig
+
+	mu sync.Mutex
+	// next is the next instant, or the zero time
+	// if the pacer has not started.
+	next time.Time
+}
+
+// NewPacer returns a new Pacer with the given configuration.
+func NewPacer(config PacerConfig) (*Pacer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating pacer config")
+	}
+	return &Pacer{config: config}, nil
+}
+
+// Reserve takes the next instant, returning how long the caller must
+// wait for it. The first call to Reserve starts the pacer's schedule,
+// and returns zero.
+func (p *Pacer) Reserve() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.config.Clock.Now()
+	if p.next.IsZero() {
+		p.next = now.Add(p.config.Interval)
+		return 0
+	}
+	t := p.next
+	if late := now.Sub(t); late > 0 && p.config.Policy == Skip {
+		// Take the most recent missed instant.
+		t = t.Add(late / p.config.Interval * p.config.Interval)
+	}
+	p.next = t.Add(p.config.Interval)
+	if wait := t.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Wait takes the next instant, and waits until it is reached. If the
+// context is cancelled while waiting, Wait returns the context's error;
+// the instant is not reclaimed.
+func (p *Pacer) Wait(ctx context.Context) error {
+	wait := p.Reserve()
+	if wait == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.config.Clock.After(wait):
+		return nil
+	}
+}
+
+// Reset restarts the pacer's schedule, so that the next call to
+// Wait or Reserve returns immediately.
+func (p *Pacer) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next = time.Time{}
+}
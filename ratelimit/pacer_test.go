@@ -0,0 +1,103 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ratelimit_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/ratelimit"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type pacerSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&pacerSuite{})
+
+func newPacer(c *gc.C, clock *coretesting.Clock, policy ratelimit.PacerPolicy) *ratelimit.Pacer {
+	p, err := ratelimit.NewPacer(ratelimit.PacerConfig{
+		Clock:    clock,
+		Interval: time.Second,
+		Policy:   policy,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return p
+}
+
+func (*pacerSuite) TestValidate(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	_, err := ratelimit.NewPacer(ratelimit.PacerConfig{Clock: clock})
+	c.Assert(err, gc.ErrorMatches, "validating pacer config: non-positive Interval not valid")
+	_, err = ratelimit.NewPacer(ratelimit.PacerConfig{Clock: clock, Interval: time.Second, Policy: 2})
+	c.Assert(err, gc.ErrorMatches, "validating pacer config: Policy 2 not valid")
+}
+
+func (*pacerSuite) TestEvenlySpaced(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	p := newPacer(c, clock, ratelimit.CatchUp)
+	c.Assert(p.Reserve(), gc.Equals, time.Duration(0))
+
+	// However long each iteration takes, the
+	// next starts on the pacer's schedule.
+	for _, work := range []time.Duration{100, 900, 0, 500} {
+		clock.Advance(work * time.Millisecond)
+		wait := p.Reserve()
+		c.Assert(wait, gc.Equals, time.Second-work*time.Millisecond)
+		clock.Advance(wait)
+	}
+}
+
+func (*pacerSuite) TestCatchUp(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	p := newPacer(c, clock, ratelimit.CatchUp)
+	p.Reserve()
+	clock.Advance(3500 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		c.Assert(p.Reserve(), gc.Equals, time.Duration(0))
+	}
+	c.Assert(p.Reserve(), gc.Equals, 500*time.Millisecond)
+}
+
+func (*pacerSuite) TestSkip(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	p := newPacer(c, clock, ratelimit.Skip)
+	p.Reserve()
+	clock.Advance(3500 * time.Millisecond)
+	c.Assert(p.Reserve(), gc.Equals, time.Duration(0))
+	c.Assert(p.Reserve(), gc.Equals, 500*time.Millisecond)
+}
+
+func (*pacerSuite) TestReset(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	p := newPacer(c, clock, ratelimit.CatchUp)
+	p.Reserve()
+	c.Assert(p.Reserve(), gc.Equals, time.Second)
+	p.Reset()
+	c.Assert(p.Reserve(), gc.Equals, time.Duration(0))
+	c.Assert(p.Reserve(), gc.Equals, time.Second)
+}
+
+func (*pacerSuite) TestWait(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	p := newPacer(c, clock, ratelimit.CatchUp)
+	c.Assert(p.Wait(context.Background()), jc.ErrorIsNil)
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Wait(context.Background())
+	}()
+	c.Assert(advanceUntil(c, clock, done, 100*time.Millisecond), jc.ErrorIsNil)
+}
+
+func (*pacerSuite) TestWaitCancelled(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	p := newPacer(c, clock, ratelimit.CatchUp)
+	p.Reserve()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(p.Wait(ctx), gc.Equals, context.Canceled)
+}
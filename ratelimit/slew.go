@@ -0,0 +1,159 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// SlewLimiterConfig holds the configuration for a SlewLimiter.
+type SlewLimiterConfig struct {
+	// Clock is used to measure the time between changes.
+	Clock clock.Clock
+
+	// Rise is the maximum increase in the value per Per. If Rise
+	// is zero, increases are not limited.
+	Rise float64
+
+	// Fall is the maximum decrease in the value per Per. If Fall
+	// is zero, decreases are not limited, so that the value may be
+	// cut immediately, such as when shedding load.
+	Fall float64
+
+	// Per is the period over which Rise and Fall are measured.
+	Per time.Duration
+
+	// Initial is the limiter's initial value.
+	Initial float64
+}
+
+// Validate checks that the config is valid.
+func (config SlewLimiterConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Rise < 0 || math.IsNaN(config.Rise) {
+		return errors.NotValidf("Rise %v", config.Rise)
+	}
+	if config.Fall < 0 || math.IsNaN(config.Fall) {
+		return errors.NotValidf("Fall %v", config.Fall)
+	}
+	if config.Per <= 0 {
+		return errors.NotValidf("non-positive Per")
+	}
+	if math.IsNaN(config.Initial) || math.IsInf(config.Initial, 0) {
+		return errors.NotValidf("Initial %v", config.Initial)
+	}
+	return nil
+}
+
+// SlewLimiter limits the rate at which a value, such as a concurrency
+// or rate limit, may change: each call to Value moves the limiter's
+// value toward a target by no more than the configured rate allows for
+// the time elapsed since the previous call. It may be used to ramp a
+// setpoint up gradually after recovering from a failure, without
+// sleeping between steps.
+//
+// SlewLimiter's methods are safe for concurrent use.
+type SlewLimiter struct {
+	config SlewLimiterConfig
+
+	mu    sync.Mutex
+	value float64
+	last  time.Time
+}
+
+// NewSlewLimiter returns a new SlewLimiter with the given configuration.
+func NewSlewLimiter(config SlewLimiterConfig) (*SlewLimiter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating slew limiter config")
+	}
+	return &SlewLimiter{
+		config: config,
+		value:  config.Initial,
+		last:   config.Clock.Now(),
+	}, nil
+}
+
+// Value moves the limiter's value toward the target, by as much as is
+// permitted for the time elapsed since the limiter was created, Reset
+// or last called, and returns the permitted value.
+func (l *SlewLimiter) Value(target float64) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.config.Clock.Now()
+	elapsed := now.Sub(l.last)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	l.last = now
+	l.value = l.step(target, elapsed)
+	return l.value
+}
+
+// step returns the value moved toward the target by as much
+// as is permitted in the specified time.
+func (l *SlewLimiter) step(target float64, elapsed time.Duration) float64 {
+	periods := float64(elapsed) / float64(l.config.Per)
+	switch {
+	case target > l.value && l.config.Rise > 0:
+		return math.Min(target, l.value+l.config.Rise*periods)
+	case target < l.value && l.config.Fall > 0:
+		return math.Max(target, l.value-l.config.Fall*periods)
+	}
+	return target
+}
+
+// Current returns the value last permitted by the limiter,
+// without moving it.
+func (l *SlewLimiter) Current() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.value
+}
+
+// Until returns how long, from now, it will take for the limiter's
+// value to reach the target, such as to determine when next to call
+// Value. Until does not move the value.
+func (l *SlewLimiter) Until(target float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elapsed := l.config.Clock.Now().Sub(l.last)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	var change, rate float64
+	switch {
+	case target > l.value:
+		change, rate = target-l.value, l.config.Rise
+	case target < l.value:
+		change, rate = l.value-target, l.config.Fall
+	}
+	if change == 0 || rate == 0 {
+		return 0
+	}
+	total := math.Ceil(change / rate * float64(l.config.Per))
+	if total >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	d := time.Duration(total) - elapsed
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Reset sets the limiter's value immediately, such as to drop it on
+// failure, and measures subsequent changes from now.
+func (l *SlewLimiter) Reset(value float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.value = value
+	l.last = l.config.Clock.Now()
+}
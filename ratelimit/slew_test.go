@@ -0,0 +1,120 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ratelimit_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/ratelimit"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type slewSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&slewSuite{})
+
+func newSlewLimiter(c *gc.C, clock *coretesting.Clock, rise, fall float64) *ratelimit.SlewLimiter {
+	l, err := ratelimit.NewSlewLimiter(ratelimit.SlewLimiterConfig{
+		Clock:   clock,
+		Rise:    rise,
+		Fall:    fall,
+		Per:     time.Second,
+		Initial: 10,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return l
+}
+
+func (*slewSuite) TestValidate(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	for _, test := range []struct {
+		config ratelimit.SlewLimiterConfig
+		err    string
+	}{
+		{ratelimit.SlewLimiterConfig{}, "nil Clock not valid"},
+		{ratelimit.SlewLimiterConfig{Clock: clock, Rise: -1}, "Rise -1 not valid"},
+		{ratelimit.SlewLimiterConfig{Clock: clock, Fall: -1}, "Fall -1 not valid"},
+		{ratelimit.SlewLimiterConfig{Clock: clock}, "non-positive Per not valid"},
+	} {
+		_, err := ratelimit.NewSlewLimiter(test.config)
+		c.Check(err, gc.ErrorMatches, "validating slew limiter config: "+test.err)
+	}
+}
+
+func (*slewSuite) TestRise(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	l := newSlewLimiter(c, clock, 2, 0)
+	c.Assert(l.Value(20), gc.Equals, 10.0)
+
+	clock.Advance(time.Second)
+	c.Assert(l.Value(20), gc.Equals, 12.0)
+	clock.Advance(1500 * time.Millisecond)
+	c.Assert(l.Value(20), gc.Equals, 15.0)
+	c.Assert(l.Current(), gc.Equals, 15.0)
+
+	// The value never overshoots the target.
+	clock.Advance(time.Hour)
+	c.Assert(l.Value(20), gc.Equals, 20.0)
+}
+
+func (*slewSuite) TestElapsedMeasuredFromLastCall(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	l := newSlewLimiter(c, clock, 2, 0)
+
+	// Holding the value steady does not bank
+	// permission for a later jump.
+	clock.Advance(time.Minute)
+	c.Assert(l.Value(10), gc.Equals, 10.0)
+	clock.Advance(time.Second)
+	c.Assert(l.Value(100), gc.Equals, 12.0)
+}
+
+func (*slewSuite) TestFall(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+
+	// With no Fall, decreases are immediate.
+	l := newSlewLimiter(c, clock, 2, 0)
+	c.Assert(l.Value(1), gc.Equals, 1.0)
+
+	l = newSlewLimiter(c, clock, 0, 4)
+	clock.Advance(time.Second)
+	c.Assert(l.Value(0), gc.Equals, 6.0)
+	clock.Advance(time.Second)
+	c.Assert(l.Value(0), gc.Equals, 2.0)
+	clock.Advance(time.Second)
+	c.Assert(l.Value(0), gc.Equals, 0.0)
+
+	// With no Rise, increases are immediate.
+	c.Assert(l.Value(50), gc.Equals, 50.0)
+}
+
+func (*slewSuite) TestUntil(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	l := newSlewLimiter(c, clock, 2, 0)
+	c.Assert(l.Until(10), gc.Equals, time.Duration(0))
+	c.Assert(l.Until(5), gc.Equals, time.Duration(0))
+	c.Assert(l.Until(20), gc.Equals, 5*time.Second)
+
+	clock.Advance(2 * time.Second)
+	c.Assert(l.Until(20), gc.Equals, 3*time.Second)
+	c.Assert(l.Current(), gc.Equals, 10.0)
+
+	clock.Advance(3 * time.Second)
+	c.Assert(l.Value(20), gc.Equals, 20.0)
+}
+
+func (*slewSuite) TestReset(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	l := newSlewLimiter(c, clock, 2, 1)
+	clock.Advance(time.Minute)
+	l.Reset(1)
+	c.Assert(l.Current(), gc.Equals, 1.0)
+	c.Assert(l.Value(100), gc.Equals, 1.0)
+	clock.Advance(time.Second)
+	c.Assert(l.Value(100), gc.Equals, 3.0)
+}
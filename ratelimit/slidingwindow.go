@@ -0,0 +1,212 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// SlidingWindowConfig holds the configuration for a SlidingWindow
+// or KeyedSlidingWindow.
+type SlidingWindowConfig struct {
+	// Clock is used to measure the window.
+	Clock clock.Clock
+
+	// Limit is the maximum number of events permitted within
+	// any period of length Window.
+	Limit int
+
+	// Window is the length of the rolling window.
+	Window time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config SlidingWindowConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Limit <= 0 {
+		return errors.NotValidf("non-positive Limit")
+	}
+	if config.Window <= 0 {
+		return errors.NotValidf("non-positive Window")
+	}
+	return nil
+}
+
+// SlidingWindow permits at most Limit events within any rolling window
+// of length Window. SlidingWindow records the time of each permitted
+// event, and so is exact, at a cost of memory proportional to Limit.
+//
+// SlidingWindow's methods are safe for concurrent use.
+type SlidingWindow struct {
+	config SlidingWindowConfig
+
+	mu  sync.Mutex
+	log slidingLog
+}
+
+// NewSlidingWindow returns a new SlidingWindow with the given
+// configuration.
+func NewSlidingWindow(config SlidingWindowConfig) (*SlidingWindow, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating sliding window config")
+	}
+	return &SlidingWindow{config: config}, nil
+}
+
+// Allow reports whether an event is permitted now and, if it is,
+// records it.
+func (w *SlidingWindow) Allow() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.log.allow(w.config, w.config.Clock.Now())
+}
+
+// Remaining returns the number of events that are permitted now.
+func (w *SlidingWindow) Remaining() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.log.expire(w.config, w.config.Clock.Now())
+	return w.config.Limit - len(w.log)
+}
+
+// Delay returns how long until an event will next be permitted.
+// If an event is permitted now, Delay returns zero.
+func (w *SlidingWindow) Delay() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.log.delay(w.config, w.config.Clock.Now())
+}
+
+// KeyedSlidingWindow is like SlidingWindow, but limits events for each
+// key independently. This may be used, for example, to enforce quotas
+// for each of a number of tenants.
+//
+// Keys whose events have all left the window are forgotten, at most a
+// window after the last of them, so that memory use is bounded by the
+// keys with recent events.
+//
+// KeyedSlidingWindow's methods are safe for concurrent use.
+type KeyedSlidingWindow[K comparable] struct {
+	config SlidingWindowConfig
+
+	mu   sync.Mutex
+	logs map[K]slidingLog
+	// swept is the time at which expired logs were last forgotten.
+	swept time.Time
+}
+
+// NewKeyedSlidingWindow returns a new KeyedSlidingWindow with the given
+// configuration, which applies to each key.
+func NewKeyedSlidingWindow[K comparable](config SlidingWindowConfig) (*KeyedSlidingWindow[K], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating sliding window config")
+	}
+	return &KeyedSlidingWindow[K]{config: config, logs: make(map[K]slidingLog)}, nil
+}
+
+// Allow reports whether an event for the key is permitted now and,
+// if it is, records it.
+func (w *KeyedSlidingWindow[K]) Allow(key K) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.config.Clock.Now()
+	w.sweep(now)
+	log := w.logs[key]
+	ok := log.allow(w.config, now)
+	w.store(key, log)
+	return ok
+}
+
+// Len returns the number of keys for which events are held.
+func (w *KeyedSlidingWindow[K]) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.logs)
+}
+
+// Remaining returns the number of events for the key that are
+// permitted now.
+func (w *KeyedSlidingWindow[K]) Remaining(key K) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	log := w.logs[key]
+	log.expire(w.config, w.config.Clock.Now())
+	w.store(key, log)
+	return w.config.Limit - len(log)
+}
+
+// Delay returns how long until an event for the key will next be
+// permitted. If an event is permitted now, Delay returns zero.
+func (w *KeyedSlidingWindow[K]) Delay(key K) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	log := w.logs[key]
+	d := log.delay(w.config, w.config.Clock.Now())
+	w.store(key, log)
+	return d
+}
+
+// sweep forgets the keys with no events in the window, if it has not
+// done so within the last window, so that the cost is amortised over
+// the events recorded in the meantime.
+func (w *KeyedSlidingWindow[K]) sweep(now time.Time) {
+	if now.Sub(w.swept) < w.config.Window {
+		return
+	}
+	w.swept = now
+	for key, log := range w.logs {
+		log.expire(w.config, now)
+		w.store(key, log)
+	}
+}
+
+// store stores the log for the key, forgetting keys with no
+// events in the window.
+func (w *KeyedSlidingWindow[K]) store(key K, log slidingLog) {
+	if len(log) == 0 {
+		delete(w.logs, key)
+	} else {
+		w.logs[key] = log
+	}
+}
+
+// slidingLog holds the times of events within the window,
+// oldest first.
+type slidingLog []time.Time
+
+func (l *slidingLog) allow(config SlidingWindowConfig, now time.Time) bool {
+	l.expire(config, now)
+	if len(*l) >= config.Limit {
+		return false
+	}
+	*l = append(*l, now)
+	return true
+}
+
+func (l *slidingLog) delay(config SlidingWindowConfig, now time.Time) time.Duration {
+	l.expire(config, now)
+	if len(*l) < config.Limit {
+		return 0
+	}
+	// The event that must leave the window before another
+	// event is permitted.
+	oldest := (*l)[len(*l)-config.Limit]
+	return oldest.Add(config.Window).Sub(now)
+}
+
+// expire forgets events that fall outside the window ending at now.
+func (l *slidingLog) expire(config SlidingWindowConfig, now time.Time) {
+	cutoff := now.Add(-config.Window)
+	var n int
+	for n < len(*l) && !(*l)[n].After(cutoff) {
+		n++
+	}
+	*l = append((*l)[:0], (*l)[n:]...)
+}
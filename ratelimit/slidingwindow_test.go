@@ -0,0 +1,94 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ratelimit_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/ratelimit"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type slidingWindowSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&slidingWindowSuite{})
+
+func (*slidingWindowSuite) TestValidate(c *gc.C) {
+	_, err := ratelimit.NewSlidingWindow(ratelimit.SlidingWindowConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating sliding window config: nil Clock not valid")
+	_, err = ratelimit.NewKeyedSlidingWindow[string](ratelimit.SlidingWindowConfig{
+		Clock: coretesting.NewClock(time.Time{}),
+		Limit: 1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating sliding window config: non-positive Window not valid")
+}
+
+func (*slidingWindowSuite) TestAllow(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	w, err := ratelimit.NewSlidingWindow(ratelimit.SlidingWindowConfig{
+		Clock:  clock,
+		Limit:  2,
+		Window: time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(w.Allow(), jc.IsTrue)
+	clock.Advance(20 * time.Second)
+	c.Assert(w.Allow(), jc.IsTrue)
+	c.Assert(w.Allow(), jc.IsFalse)
+	c.Assert(w.Remaining(), gc.Equals, 0)
+	c.Assert(w.Delay(), gc.Equals, 40*time.Second)
+
+	// The window rolls: the first event leaves it after a minute.
+	clock.Advance(40 * time.Second)
+	c.Assert(w.Remaining(), gc.Equals, 1)
+	c.Assert(w.Delay(), gc.Equals, time.Duration(0))
+	c.Assert(w.Allow(), jc.IsTrue)
+	c.Assert(w.Delay(), gc.Equals, 20*time.Second)
+}
+
+func (*slidingWindowSuite) TestKeyed(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	w, err := ratelimit.NewKeyedSlidingWindow[string](ratelimit.SlidingWindowConfig{
+		Clock:  clock,
+		Limit:  1,
+		Window: time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(w.Allow("tenant-a"), jc.IsTrue)
+	c.Assert(w.Allow("tenant-a"), jc.IsFalse)
+	c.Assert(w.Allow("tenant-b"), jc.IsTrue)
+	c.Assert(w.Remaining("tenant-c"), gc.Equals, 1)
+	c.Assert(w.Delay("tenant-a"), gc.Equals, time.Minute)
+
+	clock.Advance(time.Minute)
+	c.Assert(w.Remaining("tenant-a"), gc.Equals, 1)
+	c.Assert(w.Allow("tenant-a"), jc.IsTrue)
+}
+
+func (*slidingWindowSuite) TestKeyedForgetsExpiredKeys(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	w, err := ratelimit.NewKeyedSlidingWindow[int](ratelimit.SlidingWindowConfig{
+		Clock:  clock,
+		Limit:  1,
+		Window: time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	for i := 0; i < 100; i++ {
+		c.Assert(w.Allow(i), jc.IsTrue)
+	}
+	c.Assert(w.Len(), gc.Equals, 100)
+
+	// Keys that are never seen again are forgotten once their
+	// events have left the window.
+	clock.Advance(time.Minute)
+	c.Assert(w.Allow(100), jc.IsTrue)
+	c.Assert(w.Len(), gc.Equals, 1)
+}
@@ -0,0 +1,235 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package reaper provides a Reaper, which calls cleanup functions for
+// contexts when they are done. Deadlines for all tracked contexts are
+// held in a single queue, serviced by one goroutine, rather than each
+// context having a goroutine waiting for it.
+package reaper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Reaper.
+type Config struct {
+	// Clock is used to determine when contexts' deadlines
+	// have passed.
+	Clock clock.Clock
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	return nil
+}
+
+// Reaper tracks contexts, and calls a cleanup function for each when
+// it is done: either when its deadline passes, as measured by the
+// Reaper's clock, or when it is cancelled.
+//
+// Reaper's methods are safe for concurrent use.
+type Reaper struct {
+	config Config
+
+	mu        sync.Mutex
+	nextID    uint64
+	entries   map[uint64]*entry
+	deadlines *timequeue.Queue[uint64, *entry]
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type entry struct {
+	cleanup func(error)
+
+	// stop unregisters the context.AfterFunc callback
+	// that reaps the entry on cancellation.
+	stop func() bool
+}
+
+// New constructs and starts a new Reaper with the given configuration,
+// tracking no contexts. The Reaper will continue to call cleanup
+// functions until it is killed.
+func New(config Config) (*Reaper, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating reaper config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reaper{
+		config:    config,
+		entries:   make(map[uint64]*entry),
+		deadlines: timequeue.New[uint64, *entry](config.Clock),
+		wake:      make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go r.loop()
+	return r, nil
+}
+
+// Kill stops the Reaper. No cleanup functions are called after the
+// Reaper has stopped. Kill does not wait for the Reaper to stop; use
+// Wait for that.
+func (r *Reaper) Kill() {
+	r.cancel()
+}
+
+// Wait waits for the Reaper to stop.
+func (r *Reaper) Wait() error {
+	<-r.done
+	return nil
+}
+
+// Track arranges for cleanup to be called once, when the context is
+// done, with context.DeadlineExceeded if the context's deadline has
+// passed, or otherwise with the context's error. If the context's
+// deadline has already passed, cleanup is called promptly.
+//
+// Cleanup is called without any locks held, and so may call the
+// Reaper's methods. It is called from the Reaper's goroutine when a
+// deadline passes, and from a goroutine started by the context package
+// when the context is cancelled, so it should not block for long.
+//
+// Track returns a function that stops tracking the context, which
+// reports whether it did so before cleanup was called.
+func (r *Reaper) Track(ctx context.Context, cleanup func(err error)) (untrack func() bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	id := r.nextID
+	e := &entry{cleanup: cleanup}
+	r.entries[id] = e
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		r.deadlines.Add(id, e, deadline)
+		r.notify()
+	}
+	e.stop = context.AfterFunc(ctx, func() {
+		err := ctx.Err()
+		if hasDeadline && err == context.DeadlineExceeded {
+			// The context's own timer fired; the Reaper's
+			// clock determines when deadlines pass.
+			return
+		}
+		r.reap(id, err)
+	})
+	return func() bool {
+		return r.untrack(id)
+	}
+}
+
+// Len returns the number of contexts being tracked.
+func (r *Reaper) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+func (r *Reaper) untrack(id uint64) bool {
+	r.mu.Lock()
+	e, ok := r.remove(id)
+	r.mu.Unlock()
+	if ok {
+		e.stop()
+	}
+	return ok
+}
+
+// reap stops tracking the context with the specified ID, and calls
+// its cleanup function, if it has not already been called.
+func (r *Reaper) reap(id uint64, err error) {
+	r.mu.Lock()
+	e, ok := r.remove(id)
+	r.mu.Unlock()
+	if !ok || r.ctx.Err() != nil {
+		return
+	}
+	e.stop()
+	e.cleanup(err)
+}
+
+// remove removes the entry with the specified ID. It must be called
+// with r.mu held.
+func (r *Reaper) remove(id uint64) (*entry, bool) {
+	e, ok := r.entries[id]
+	if !ok {
+		return nil, false
+	}
+	delete(r.entries, id)
+	r.deadlines.Remove(id)
+	return e, true
+}
+
+// notify wakes the loop so it will re-evaluate the next deadline.
+func (r *Reaper) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Reaper) loop() {
+	defer close(r.done)
+	defer r.stopAll()
+	for {
+		r.mu.Lock()
+		next := r.deadlines.Next()
+		r.mu.Unlock()
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.wake:
+		case <-next:
+			r.reapExpired(r.config.Clock.Now())
+		}
+	}
+}
+
+// reapExpired calls the cleanup functions of contexts whose deadlines
+// have passed at the specified time.
+func (r *Reaper) reapExpired(now time.Time) {
+	r.mu.Lock()
+	var expired []*entry
+	for {
+		item, ok := r.deadlines.PopReady(now)
+		if !ok {
+			break
+		}
+		delete(r.entries, item.Key)
+		expired = append(expired, item.Value)
+	}
+	r.mu.Unlock()
+	for _, e := range expired {
+		if r.ctx.Err() != nil {
+			return
+		}
+		e.stop()
+		e.cleanup(context.DeadlineExceeded)
+	}
+}
+
+// stopAll stops tracking all contexts, when the Reaper stops.
+func (r *Reaper) stopAll() {
+	r.mu.Lock()
+	entries := r.entries
+	r.entries = make(map[uint64]*entry)
+	r.deadlines.Clear(nil)
+	r.mu.Unlock()
+	for _, e := range entries {
+		e.stop()
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package reaper_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/reaper"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type reaperSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&reaperSuite{})
+
+// deadlineContext is a context whose deadline is reported, but not
+// enforced, so that the deadline may be measured by a test clock.
+type deadlineContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (ctx deadlineContext) Deadline() (time.Time, bool) {
+	return ctx.deadline, true
+}
+
+func newReaper(c *gc.C, clock *coretesting.Clock) *reaper.Reaper {
+	r, err := reaper.New(reaper.Config{Clock: clock})
+	c.Assert(err, jc.ErrorIsNil)
+	return r
+}
+
+func stop(c *gc.C, r *reaper.Reaper) {
+	r.Kill()
+	c.Assert(r.Wait(), jc.ErrorIsNil)
+}
+
+func waitErr(c *gc.C, ch <-chan error) error {
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for cleanup")
+	}
+	panic("unreachable")
+}
+
+func assertNoCleanup(c *gc.C, ch <-chan error) {
+	select {
+	case err := <-ch:
+		c.Fatalf("unexpected cleanup: %v", err)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+func (*reaperSuite) TestValidate(c *gc.C) {
+	_, err := reaper.New(reaper.Config{})
+	c.Assert(err, gc.ErrorMatches, "validating reaper config: nil Clock not valid")
+}
+
+func (*reaperSuite) TestDeadline(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r := newReaper(c, clock)
+	defer stop(c, r)
+
+	reaped := make(chan string, 3)
+	track := func(name string, d time.Duration) {
+		ctx := deadlineContext{context.Background(), clock.Now().Add(d)}
+		r.Track(ctx, func(err error) {
+			c.Check(err, gc.Equals, context.DeadlineExceeded)
+			reaped <- name
+		})
+	}
+	track("b", 2*time.Second)
+	track("a", time.Second)
+	track("c", 3*time.Second)
+	c.Assert(r.Len(), gc.Equals, 3)
+
+	clock.Advance(2 * time.Second)
+	for _, expect := range []string{"a", "b"} {
+		select {
+		case name := <-reaped:
+			c.Assert(name, gc.Equals, expect)
+		case <-time.After(coretesting.LongWait):
+			c.Fatalf("timed out waiting for %q", expect)
+		}
+	}
+	c.Assert(r.Len(), gc.Equals, 1)
+}
+
+func (*reaperSuite) TestExpiredDeadline(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r := newReaper(c, clock)
+	defer stop(c, r)
+
+	errs := make(chan error, 1)
+	ctx := deadlineContext{context.Background(), clock.Now().Add(-time.Second)}
+	r.Track(ctx, func(err error) { errs <- err })
+	c.Assert(waitErr(c, errs), gc.Equals, context.DeadlineExceeded)
+}
+
+func (*reaperSuite) TestCancel(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r := newReaper(c, clock)
+	defer stop(c, r)
+
+	errs := make(chan error, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Track(deadlineContext{ctx, clock.Now().Add(time.Hour)}, func(err error) { errs <- err })
+	cancel()
+	c.Assert(waitErr(c, errs), gc.Equals, context.Canceled)
+
+	// Cleanup is called only once.
+	clock.Advance(time.Hour)
+	assertNoCleanup(c, errs)
+	c.Assert(r.Len(), gc.Equals, 0)
+}
+
+func (*reaperSuite) TestNoDeadline(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r := newReaper(c, clock)
+	defer stop(c, r)
+
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Track(ctx, func(err error) { errs <- err })
+	clock.Advance(time.Hour)
+	assertNoCleanup(c, errs)
+	cancel()
+	c.Assert(waitErr(c, errs), gc.Equals, context.Canceled)
+}
+
+func (*reaperSuite) TestUntrack(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r := newReaper(c, clock)
+	defer stop(c, r)
+
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	untrack := r.Track(deadlineContext{ctx, clock.Now().Add(time.Second)}, func(err error) { errs <- err })
+	c.Assert(untrack(), jc.IsTrue)
+	c.Assert(untrack(), jc.IsFalse)
+	c.Assert(r.Len(), gc.Equals, 0)
+
+	clock.Advance(time.Second)
+	cancel()
+	assertNoCleanup(c, errs)
+}
+
+func (*reaperSuite) TestKill(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r := newReaper(c, clock)
+
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Track(deadlineContext{ctx, clock.Now().Add(time.Second)}, func(err error) { errs <- err })
+	stop(c, r)
+	c.Assert(r.Len(), gc.Equals, 0)
+
+	clock.Advance(time.Second)
+	cancel()
+	assertNoCleanup(c, errs)
+}
+
+func (*reaperSuite) TestWallClock(c *gc.C) {
+	// With a real clock, the context package's timers and the
+	// Reaper agree on the deadline; the cleanup is called once.
+	r, err := reaper.New(reaper.Config{Clock: clock.WallClock})
+	c.Assert(err, jc.ErrorIsNil)
+	defer stop(c, r)
+
+	errs := make(chan error, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	r.Track(ctx, func(err error) { errs <- err })
+	c.Assert(waitErr(c, errs), gc.Equals, context.DeadlineExceeded)
+	assertNoCleanup(c, errs)
+}
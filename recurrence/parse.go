@@ -0,0 +1,244 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package recurrence
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+)
+
+var frequencies = map[string]Frequency{
+	"HOURLY":  Hourly,
+	"DAILY":   Daily,
+	"WEEKLY":  Weekly,
+	"MONTHLY": Monthly,
+	"YEARLY":  Yearly,
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Parse parses a recurrence set from iCalendar content lines: exactly one
+// DTSTART and one RRULE, and any number of EXDATEs. For example:
+//
+//	DTSTART;TZID=Europe/London:20150105T020000
+//	RRULE:FREQ=WEEKLY;BYDAY=MO,TH;UNTIL=20151231T000000Z
+//	EXDATE;TZID=Europe/London:20150108T020000
+//
+// Times without a time zone are interpreted in loc.
+func Parse(text string, loc *time.Location) (*Set, error) {
+	var starts, exdates [][2]string
+	var rules []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, errors.Errorf("invalid content line %q", line)
+		}
+		name, params, value := line[:i], "", line[i+1:]
+		if j := strings.IndexByte(name, ';'); j >= 0 {
+			name, params = name[:j], name[j+1:]
+		}
+		switch strings.ToUpper(name) {
+		case "DTSTART":
+			starts = append(starts, [2]string{params, value})
+		case "RRULE":
+			rules = append(rules, value)
+		case "EXDATE":
+			exdates = append(exdates, [2]string{params, value})
+		default:
+			return nil, errors.NotSupportedf("property %q", name)
+		}
+	}
+	switch {
+	case len(starts) == 0:
+		return nil, errors.NotValidf("missing DTSTART")
+	case len(starts) > 1:
+		return nil, errors.NotValidf("multiple DTSTARTs")
+	case len(rules) == 0:
+		return nil, errors.NotValidf("missing RRULE")
+	case len(rules) > 1:
+		return nil, errors.NotSupportedf("multiple RRULEs")
+	}
+
+	var config Config
+	var err error
+	if config.Start, err = parseTime(starts[0][0], starts[0][1], loc); err != nil {
+		return nil, errors.Annotate(err, "parsing DTSTART")
+	}
+	// Floating times in the rule and exclusions are interpreted
+	// in the same location as the start time.
+	loc = config.Start.Location()
+	if config.Rule, err = parseRule(rules[0], loc); err != nil {
+		return nil, errors.Annotate(err, "parsing RRULE")
+	}
+	for _, exdate := range exdates {
+		for _, value := range strings.Split(exdate[1], ",") {
+			t, err := parseTime(exdate[0], value, loc)
+			if err != nil {
+				return nil, errors.Annotate(err, "parsing EXDATE")
+			}
+			config.Exclude = append(config.Exclude, t)
+		}
+	}
+	return New(config)
+}
+
+// ParseRule parses the value of an RRULE property, such as
+// "FREQ=MONTHLY;BYDAY=-1FR;COUNT=12". An UNTIL time without
+// a time zone is interpreted in UTC.
+func ParseRule(value string) (Rule, error) {
+	rule, err := parseRule(value, time.UTC)
+	if err != nil {
+		return Rule{}, errors.Annotatef(err, "parsing rule %q", value)
+	}
+	return rule, nil
+}
+
+func parseRule(value string, loc *time.Location) (Rule, error) {
+	var rule Rule
+	for _, part := range strings.Split(value, ";") {
+		i := strings.IndexByte(part, '=')
+		if i < 0 {
+			return Rule{}, errors.Errorf("invalid rule part %q", part)
+		}
+		key, value := strings.ToUpper(part[:i]), part[i+1:]
+		var err error
+		switch key {
+		case "FREQ":
+			freq, ok := frequencies[strings.ToUpper(value)]
+			if !ok {
+				return Rule{}, errors.NotSupportedf("FREQ %q", value)
+			}
+			rule.Freq = freq
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+		case "COUNT":
+			// Rule.Count is zero if there is no COUNT,
+			// so COUNT must be positive.
+			rule.Count, err = strconv.Atoi(value)
+			if err == nil && rule.Count < 1 {
+				return Rule{}, errors.NotValidf("COUNT %d", rule.Count)
+			}
+		case "UNTIL":
+			rule.Until, err = parseTime("", value, loc)
+		case "BYMONTH":
+			var months []int
+			months, err = parseInts(value)
+			for _, m := range months {
+				rule.ByMonth = append(rule.ByMonth, time.Month(m))
+			}
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseInts(value)
+		case "BYDAY":
+			rule.ByDay, err = parseWeekdays(value)
+		case "WKST":
+			// Weeks always start on Monday, the default.
+			if strings.ToUpper(value) != "MO" {
+				return Rule{}, errors.NotSupportedf("WKST %q", value)
+			}
+		default:
+			return Rule{}, errors.NotSupportedf("rule part %q", key)
+		}
+		if err != nil {
+			return Rule{}, errors.Annotatef(err, "parsing %s", key)
+		}
+	}
+	if rule.Freq == 0 {
+		return Rule{}, errors.NotValidf("missing FREQ")
+	}
+	if err := rule.Validate(); err != nil {
+		return Rule{}, errors.Trace(err)
+	}
+	return rule, nil
+}
+
+// parseTime parses an iCalendar DATE or DATE-TIME value, with optional
+// parameters such as "TZID=Europe/London" or "VALUE=DATE". Local times
+// skipped by daylight saving are resolved as by localTime.
+func parseTime(params, value string, loc *time.Location) (time.Time, error) {
+	isDate := len(value) == len(dateLayout)
+	for _, param := range strings.Split(params, ";") {
+		i := strings.IndexByte(param, '=')
+		if i < 0 {
+			continue
+		}
+		switch strings.ToUpper(param[:i]) {
+		case "TZID":
+			var err error
+			if loc, err = time.LoadLocation(param[i+1:]); err != nil {
+				return time.Time{}, errors.Trace(err)
+			}
+		case "VALUE":
+			isDate = strings.ToUpper(param[i+1:]) == "DATE"
+		}
+	}
+	layout := dateTimeLayout
+	if isDate {
+		layout = dateLayout
+	} else if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(dateTimeLayout+"Z", value)
+		return t, errors.Trace(err)
+	}
+	wall, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, errors.Trace(err)
+	}
+	y, m, d := wall.Date()
+	hour, min, sec := wall.Clock()
+	return localTime(y, m, d, hour, min, sec, loc), nil
+}
+
+func parseInts(value string) ([]int, error) {
+	var result []int
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// parseWeekdays parses a BYDAY value, such as "MO,WE" or "1MO,-1FR".
+func parseWeekdays(value string) ([]Weekday, error) {
+	var result []Weekday
+	for _, s := range strings.Split(value, ",") {
+		if len(s) < 2 {
+			return nil, errors.Errorf("invalid weekday %q", s)
+		}
+		day, ok := weekdays[strings.ToUpper(s[len(s)-2:])]
+		if !ok {
+			return nil, errors.Errorf("invalid weekday %q", s)
+		}
+		var n int
+		if prefix := s[:len(s)-2]; prefix != "" {
+			var err error
+			if n, err = strconv.Atoi(prefix); err != nil || n == 0 {
+				return nil, errors.Errorf("invalid weekday %q", s)
+			}
+		}
+		result = append(result, Weekday{Weekday: day, N: n})
+	}
+	return result, nil
+}
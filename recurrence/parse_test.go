@@ -0,0 +1,111 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package recurrence_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/recurrence"
+	gc "gopkg.in/check.v1"
+)
+
+type parseSuite struct{}
+
+var _ = gc.Suite(&parseSuite{})
+
+func (*parseSuite) TestParseRule(c *gc.C) {
+	rule, err := recurrence.ParseRule("FREQ=MONTHLY;INTERVAL=2;BYMONTH=1,7;BYDAY=1MO,-1fr,+2TU;UNTIL=20151231")
+	c.Assert(err, gc.IsNil)
+	c.Assert(rule, gc.DeepEquals, recurrence.Rule{
+		Freq:     recurrence.Monthly,
+		Interval: 2,
+		Until:    time.Date(2015, 12, 31, 0, 0, 0, 0, time.UTC),
+		ByMonth:  []time.Month{time.January, time.July},
+		ByDay: []recurrence.Weekday{
+			{Weekday: time.Monday, N: 1},
+			{Weekday: time.Friday, N: -1},
+			{Weekday: time.Tuesday, N: 2},
+		},
+	})
+}
+
+func (*parseSuite) TestParseRuleErrors(c *gc.C) {
+	for _, test := range []struct {
+		rule string
+		err  string
+	}{
+		{"COUNT=1", `parsing rule "COUNT=1": missing FREQ not valid`},
+		{"FREQ=MINUTELY", `.*FREQ "MINUTELY" not supported`},
+		{"FREQ=DAILY;BYSETPOS=1", `.*rule part "BYSETPOS" not supported`},
+		{"FREQ=DAILY;WKST=SU", `.*WKST "SU" not supported`},
+		{"FREQ=DAILY;COUNT", `.*invalid rule part "COUNT"`},
+		{"FREQ=DAILY;COUNT=x", `.*parsing COUNT: .*invalid syntax`},
+		{"FREQ=DAILY;COUNT=0", `.*COUNT 0 not valid`},
+		{"FREQ=DAILY;COUNT=-1", `.*COUNT -1 not valid`},
+		{"FREQ=DAILY;BYDAY=XX", `.*parsing BYDAY: invalid weekday "XX"`},
+		{"FREQ=DAILY;BYDAY=0MO", `.*parsing BYDAY: invalid weekday "0MO"`},
+		{"FREQ=DAILY;BYDAY=1MO", `.*ByDay ordinal with DAILY Freq not valid`},
+		{"FREQ=MONTHLY;BYDAY=6MO", `.*ByDay ordinal 6 not valid`},
+		{"FREQ=YEARLY;BYMONTH=1;BYDAY=6MO", `.*ByDay ordinal 6 not valid`},
+		{"FREQ=YEARLY;BYDAY=54MO", `.*ByDay ordinal 54 not valid`},
+		{"FREQ=MONTHLY;BYDAY=1MO;BYMONTHDAY=1", `.*ByDay ordinal with ByMonthDay not valid`},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", `.*ByMonthDay with WEEKLY Freq not valid`},
+		{"FREQ=DAILY;BYMONTHDAY=0", `.*ByMonthDay 0 not valid`},
+		{"FREQ=DAILY;BYMONTH=13", `.*ByMonth 13 not valid`},
+		{"FREQ=DAILY;COUNT=1;UNTIL=20150101", `.*both Count and Until not valid`},
+	} {
+		c.Logf("%s", test.rule)
+		_, err := recurrence.ParseRule(test.rule)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*parseSuite) TestParse(c *gc.C) {
+	loc, err := time.LoadLocation("Europe/London")
+	c.Assert(err, gc.IsNil)
+	set, err := recurrence.Parse(`
+DTSTART:20150105T020000
+RRULE:FREQ=DAILY;UNTIL=20150107T020000
+EXDATE:20150106T020000
+`, loc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(next(set, time.Time{}, 10), gc.DeepEquals, []time.Time{
+		time.Date(2015, 1, 5, 2, 0, 0, 0, loc),
+		time.Date(2015, 1, 7, 2, 0, 0, 0, loc),
+	})
+
+	set, err = recurrence.Parse("DTSTART:20150105T020000Z\r\nRRULE:FREQ=DAILY;COUNT=1\r\n", loc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(next(set, time.Time{}, 10), gc.DeepEquals, []time.Time{
+		time.Date(2015, 1, 5, 2, 0, 0, 0, time.UTC),
+	})
+
+	set, err = recurrence.Parse("DTSTART;VALUE=DATE:20150105\nRRULE:FREQ=YEARLY;COUNT=1", loc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(next(set, time.Time{}, 10), gc.DeepEquals, []time.Time{
+		time.Date(2015, 1, 5, 0, 0, 0, 0, loc),
+	})
+}
+
+func (*parseSuite) TestParseErrors(c *gc.C) {
+	for _, test := range []struct {
+		text string
+		err  string
+	}{
+		{"RRULE:FREQ=DAILY", "missing DTSTART not valid"},
+		{"DTSTART:20150105T020000", "missing RRULE not valid"},
+		{"DTSTART:20150105T020000\nDTSTART:20150105T020000\nRRULE:FREQ=DAILY", "multiple DTSTARTs not valid"},
+		{"DTSTART:20150105T020000\nRRULE:FREQ=DAILY\nRRULE:FREQ=WEEKLY", "multiple RRULEs not supported"},
+		{"DTSTART:20150105T020000\nRDATE:20150105T020000\nRRULE:FREQ=DAILY", `property "RDATE" not supported`},
+		{"DTSTART", `invalid content line "DTSTART"`},
+		{"DTSTART:2015\nRRULE:FREQ=DAILY", `parsing DTSTART: .*`},
+		{"DTSTART;TZID=Nowhere/Special:20150105T020000\nRRULE:FREQ=DAILY", `parsing DTSTART: unknown time zone Nowhere/Special`},
+		{"DTSTART:20150105T020000\nRRULE:FREQ=FORTNIGHTLY", `parsing RRULE: FREQ "FORTNIGHTLY" not supported`},
+		{"DTSTART:20150105T020000\nRRULE:FREQ=DAILY\nEXDATE:x", `parsing EXDATE: .*`},
+	} {
+		c.Logf("%q", test.text)
+		_, err := recurrence.Parse(test.text, time.UTC)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
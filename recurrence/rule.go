@@ -0,0 +1,363 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package recurrence computes the occurrences of iCalendar (RFC 5545)
+// recurrence rules, such as those used to define maintenance windows in
+// calendar tooling.
+//
+// The FREQ, INTERVAL, COUNT, UNTIL, BYMONTH, BYMONTHDAY and BYDAY rule
+// parts are supported, along with the DTSTART and EXDATE properties.
+// Frequencies finer than HOURLY are not supported.
+package recurrence
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Frequency identifies the period over which a rule recurs.
+type Frequency int
+
+const (
+	Hourly Frequency = iota + 1
+	Daily
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencyNames = map[Frequency]string{
+	Hourly:  "HOURLY",
+	Daily:   "DAILY",
+	Weekly:  "WEEKLY",
+	Monthly: "MONTHLY",
+	Yearly:  "YEARLY",
+}
+
+// String returns the iCalendar name of the frequency.
+func (f Frequency) String() string {
+	if name, ok := frequencyNames[f]; ok {
+		return name
+	}
+	return "Frequency(" + strconv.Itoa(int(f)) + ")"
+}
+
+// Weekday is a BYDAY rule part value: a day of the week, and optionally
+// which of them within the month or year. N is 1 for the first, 2 for the
+// second and so on, -1 for the last, -2 for the second last and so on,
+// or 0 for every such day.
+type Weekday struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// Rule is an iCalendar recurrence rule.
+type Rule struct {
+	// Freq is the period over which the rule recurs.
+	Freq Frequency
+
+	// Interval is the number of periods between each recurrence.
+	// Zero is treated as one.
+	Interval int
+
+	// Count, if positive, is the number of occurrences after which
+	// the rule stops recurring.
+	Count int
+
+	// Until, if non-zero, is the time after which the rule
+	// stops recurring. Until may not be set with Count.
+	Until time.Time
+
+	// ByMonth, if non-empty, restricts occurrences to these months.
+	ByMonth []time.Month
+
+	// ByMonthDay, if non-empty, restricts occurrences to these days
+	// of the month. Negative days count back from the end of the
+	// month, -1 being the last day. ByMonthDay may not be used with
+	// a Weekly rule.
+	ByMonthDay []int
+
+	// ByDay, if non-empty, restricts occurrences to these days of
+	// the week. Weekdays with non-zero N may be used only with Monthly
+	// or Yearly rules without ByMonthDay.
+	ByDay []Weekday
+}
+
+// Validate checks that the rule is valid.
+func (r Rule) Validate() error {
+	if _, ok := frequencyNames[r.Freq]; !ok {
+		return errors.NotValidf("Freq %v", r.Freq)
+	}
+	if r.Interval < 0 {
+		return errors.NotValidf("negative Interval")
+	}
+	if r.Count < 0 {
+		return errors.NotValidf("negative Count")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return errors.NotValidf("both Count and Until")
+	}
+	for _, m := range r.ByMonth {
+		if m < time.January || m > time.December {
+			return errors.NotValidf("ByMonth %d", m)
+		}
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq == Weekly {
+		return errors.NotValidf("ByMonthDay with %v Freq", r.Freq)
+	}
+	for _, d := range r.ByMonthDay {
+		if d == 0 || d < -31 || d > 31 {
+			return errors.NotValidf("ByMonthDay %d", d)
+		}
+	}
+	for _, d := range r.ByDay {
+		if d.Weekday < time.Sunday || d.Weekday > time.Saturday {
+			return errors.NotValidf("ByDay weekday %d", d.Weekday)
+		}
+		if d.N == 0 {
+			continue
+		}
+		maxN := 53
+		switch {
+		case r.Freq == Monthly || r.Freq == Yearly && len(r.ByMonth) > 0:
+			maxN = 5
+		case r.Freq != Yearly:
+			return errors.NotValidf("ByDay ordinal with %v Freq", r.Freq)
+		}
+		if len(r.ByMonthDay) > 0 {
+			return errors.NotValidf("ByDay ordinal with ByMonthDay")
+		}
+		if d.N < -maxN || d.N > maxN {
+			return errors.NotValidf("ByDay ordinal %d", d.N)
+		}
+	}
+	return nil
+}
+
+func (r Rule) interval() int {
+	if r.Interval == 0 {
+		return 1
+	}
+	return r.Interval
+}
+
+// period returns the start of the i'th period of the rule,
+// beginning with the period containing start. For periods of a day
+// or longer, the time returned is noon on the period's first day,
+// since midnight does not exist where clocks go forward at midnight;
+// see dayStart.
+func (r Rule) period(start time.Time, i int) time.Time {
+	n := i * r.interval()
+	y, m, d := start.Date()
+	loc := start.Location()
+	switch r.Freq {
+	case Hourly:
+		return start.Add(time.Duration(n) * time.Hour)
+	case Daily:
+		return time.Date(y, m, d+n, 12, 0, 0, 0, loc)
+	case Weekly:
+		// Weeks start on Monday.
+		monday := d - (int(start.Weekday())+6)%7
+		return time.Date(y, m, monday+7*n, 12, 0, 0, 0, loc)
+	case Monthly:
+		return time.Date(y, m+time.Month(n), 1, 12, 0, 0, 0, loc)
+	default:
+		return time.Date(y+n, time.January, 1, 12, 0, 0, 0, loc)
+	}
+}
+
+// dayStart returns the start of the period p returned by period. If
+// midnight does not exist on the period's first day, the time returned
+// is shortly before the period starts.
+func (r Rule) dayStart(p time.Time) time.Time {
+	if r.Freq == Hourly {
+		return p
+	}
+	y, m, d := p.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, p.Location())
+}
+
+// expand returns the rule's candidate occurrences within the period
+// starting at p, in order. Occurrences take their time of day from
+// start, and their day from start where the rule does not specify it.
+func (r Rule) expand(start, p time.Time) []time.Time {
+	if r.Freq == Hourly {
+		if !r.matches(p) {
+			return nil
+		}
+		return []time.Time{p}
+	}
+
+	y, m, _ := p.Date()
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		days = []time.Time{p}
+	case Weekly:
+		for i := 0; i < 7; i++ {
+			day := p.AddDate(0, 0, i)
+			if len(r.ByDay) > 0 || day.Weekday() == start.Weekday() {
+				days = append(days, day)
+			}
+		}
+	case Monthly:
+		days = r.monthDays(start, y, m)
+	case Yearly:
+		switch {
+		case len(r.ByMonth) > 0:
+			for _, m := range r.ByMonth {
+				days = append(days, r.monthDays(start, y, m)...)
+			}
+		case len(r.ByMonthDay) > 0:
+			for m := time.January; m <= time.December; m++ {
+				days = append(days, r.monthDays(start, y, m)...)
+			}
+		case len(r.ByDay) > 0:
+			days = r.scopeDays(p, p.AddDate(1, 0, 0))
+		default:
+			day := time.Date(y, start.Month(), start.Day(), 12, 0, 0, 0, p.Location())
+			if day.Day() == start.Day() {
+				days = []time.Time{day}
+			}
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	hour, min, sec := start.Clock()
+	var result []time.Time
+	for i, day := range days {
+		if i > 0 && day.Equal(days[i-1]) {
+			continue
+		}
+		if !r.matches(day) {
+			continue
+		}
+		y, m, d := day.Date()
+		result = append(result, localTime(y, m, d, hour, min, sec, day.Location()))
+	}
+	return result
+}
+
+// monthDays returns the days of the specified month on which the rule
+// may occur, in order.
+func (r Rule) monthDays(start time.Time, y int, m time.Month) []time.Time {
+	first := time.Date(y, m, 1, 12, 0, 0, 0, start.Location())
+	next := first.AddDate(0, 1, 0)
+	switch {
+	case len(r.ByMonthDay) > 0:
+		n := daysIn(y, m)
+		var days []time.Time
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d += n + 1
+			}
+			if d >= 1 && d <= n {
+				days = append(days, first.AddDate(0, 0, d-1))
+			}
+		}
+		return days
+	case len(r.ByDay) > 0:
+		return r.scopeDays(first, next)
+	default:
+		if start.Day() > daysIn(y, m) {
+			return nil
+		}
+		return []time.Time{first.AddDate(0, 0, start.Day()-1)}
+	}
+}
+
+// scopeDays returns the days in [first, next) matching the rule's ByDay
+// weekdays, with ordinals relative to that range.
+func (r Rule) scopeDays(first, next time.Time) []time.Time {
+	n := daysBetween(first, next)
+	var days []time.Time
+	for i := 0; i < n; i++ {
+		day := first.AddDate(0, 0, i)
+		forward, backward := i/7+1, -((n-1-i)/7 + 1)
+		for _, w := range r.ByDay {
+			if w.Weekday == day.Weekday() && (w.N == 0 || w.N == forward || w.N == backward) {
+				days = append(days, day)
+				break
+			}
+		}
+	}
+	return days
+}
+
+// matches reports whether t satisfies the rule's restrictions
+// that are not expanded by its frequency.
+func (r Rule) matches(t time.Time) bool {
+	if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, t.Month()) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq <= Daily {
+		n := daysIn(t.Year(), t.Month())
+		found := false
+		for _, d := range r.ByMonthDay {
+			if d == t.Day() || d < 0 && d+n+1 == t.Day() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ByDay) > 0 {
+		found := false
+		for _, w := range r.ByDay {
+			if w.Weekday == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsMonth(months []time.Month, m time.Month) bool {
+	for _, month := range months {
+		if month == m {
+			return true
+		}
+	}
+	return false
+}
+
+// localTime returns the instant at which the wall-clock time occurs on
+// the specified date in loc. As RFC 5545 requires, a time that is
+// skipped because clocks go forward is interpreted with the offset in
+// effect before the transition, and so is shifted forward by the
+// length of the gap, as by schedule.LocalTimes with GapShift.
+func localTime(y int, m time.Month, d, hour, min, sec int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, hour, min, sec, 0, loc)
+	wall := time.Date(y, m, d, hour, min, sec, 0, time.UTC)
+	if _, offset := t.Zone(); t.Unix()+int64(offset) == wall.Unix() {
+		return t
+	}
+	// DST transitions shift clocks by at most a couple of hours, so
+	// the offset three hours earlier is that before the transition.
+	_, before := t.Add(-3 * time.Hour).Zone()
+	return wall.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+// daysIn returns the number of days in the specified month.
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// daysBetween returns the number of calendar days from first to next,
+// which are both in the same location.
+func daysBetween(first, next time.Time) int {
+	y0, m0, d0 := first.Date()
+	y1, m1, d1 := next.Date()
+	t0 := time.Date(y0, m0, d0, 0, 0, 0, 0, time.UTC)
+	t1 := time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC)
+	return int(t1.Sub(t0) / (24 * time.Hour))
+}
@@ -0,0 +1,121 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package recurrence
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// maxEmptyPeriods is the number of consecutive periods without any
+// occurrence after which a rule is assumed never to occur again.
+const maxEmptyPeriods = 100000
+
+// Config holds the configuration for a Set.
+type Config struct {
+	// Start is the time from which the rule recurs, corresponding to
+	// DTSTART. Occurrences have Start's time of day and location, and
+	// take their day from Start where the rule does not specify it.
+	Start time.Time
+
+	// Rule is the recurrence rule.
+	Rule Rule
+
+	// Exclude holds the times of occurrences to exclude, corresponding
+	// to EXDATE. Excluded occurrences still count towards Rule.Count.
+	Exclude []time.Time
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Start.IsZero() {
+		return errors.NotValidf("zero Start")
+	}
+	if err := config.Rule.Validate(); err != nil {
+		return errors.Annotate(err, "validating rule")
+	}
+	return nil
+}
+
+// Set is a recurrence set: the occurrences of a rule, less any
+// excluded times.
+type Set struct {
+	config  Config
+	exclude map[int64]bool
+}
+
+// New constructs a new Set with the given configuration.
+func New(config Config) (*Set, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating recurrence config")
+	}
+	exclude := make(map[int64]bool)
+	for _, t := range config.Exclude {
+		exclude[t.UnixNano()] = true
+	}
+	return &Set{config: config, exclude: exclude}, nil
+}
+
+// Next returns the first occurrence strictly after the specified time,
+// or the zero time if there is none. Set implements schedule.Recurrence,
+// and so may be used with schedule.RecurrenceDelay.
+func (s *Set) Next(after time.Time) time.Time {
+	var next time.Time
+	s.each(func(t time.Time) bool {
+		if t.After(after) {
+			next = t
+			return false
+		}
+		return true
+	})
+	return next
+}
+
+// Between returns the occurrences at or after start, and before end,
+// in order.
+func (s *Set) Between(start, end time.Time) []time.Time {
+	var result []time.Time
+	s.each(func(t time.Time) bool {
+		if !t.Before(end) {
+			return false
+		}
+		if !t.Before(start) {
+			result = append(result, t)
+		}
+		return true
+	})
+	return result
+}
+
+// each calls f with each occurrence in order, until f returns false
+// or there are no more occurrences.
+func (s *Set) each(f func(time.Time) bool) {
+	rule := s.config.Rule
+	start := s.config.Start
+	var count, empty int
+	for i := 0; empty < maxEmptyPeriods; i++ {
+		p := rule.period(start, i)
+		if !rule.Until.IsZero() && rule.dayStart(p).After(rule.Until) {
+			return
+		}
+		empty++
+		for _, t := range rule.expand(start, p) {
+			if t.Before(start) {
+				continue
+			}
+			if !rule.Until.IsZero() && t.After(rule.Until) {
+				return
+			}
+			empty = 0
+			count++
+			if !s.exclude[t.UnixNano()] && !f(t) {
+				return
+			}
+			if rule.Count > 0 && count >= rule.Count {
+				return
+			}
+		}
+	}
+}
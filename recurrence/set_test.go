@@ -0,0 +1,237 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package recurrence_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/recurrence"
+	gc "gopkg.in/check.v1"
+)
+
+type setSuite struct {
+	newYork *time.Location
+}
+
+var _ = gc.Suite(&setSuite{})
+
+func (s *setSuite) SetUpSuite(c *gc.C) {
+	var err error
+	s.newYork, err = time.LoadLocation("America/New_York")
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *setSuite) date(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, s.newYork)
+}
+
+// next returns up to n successive occurrences of set,
+// starting from the specified time.
+func next(set *recurrence.Set, from time.Time, n int) []time.Time {
+	var result []time.Time
+	for len(result) < n {
+		t := set.Next(from)
+		if t.IsZero() {
+			break
+		}
+		result = append(result, t)
+		from = t
+	}
+	return result
+}
+
+func (s *setSuite) TestRules(c *gc.C) {
+	d := s.date
+	for _, test := range []struct {
+		start    time.Time
+		rule     string
+		expected []time.Time
+	}{{
+		start: d(1997, 9, 2, 9),
+		rule:  "FREQ=DAILY;COUNT=4",
+		expected: []time.Time{
+			d(1997, 9, 2, 9), d(1997, 9, 3, 9), d(1997, 9, 4, 9), d(1997, 9, 5, 9),
+		},
+	}, {
+		start: d(1997, 9, 2, 9),
+		rule:  "FREQ=DAILY;INTERVAL=10;COUNT=3",
+		expected: []time.Time{
+			d(1997, 9, 2, 9), d(1997, 9, 12, 9), d(1997, 9, 22, 9),
+		},
+	}, {
+		start: d(1997, 9, 2, 9),
+		rule:  "FREQ=WEEKLY;INTERVAL=2;WKST=MO;BYDAY=TU,TH;COUNT=8",
+		expected: []time.Time{
+			d(1997, 9, 2, 9), d(1997, 9, 4, 9), d(1997, 9, 16, 9), d(1997, 9, 18, 9),
+			d(1997, 9, 30, 9), d(1997, 10, 2, 9), d(1997, 10, 14, 9), d(1997, 10, 16, 9),
+		},
+	}, {
+		start: d(1997, 9, 22, 9),
+		rule:  "FREQ=MONTHLY;COUNT=6;BYDAY=-2MO",
+		expected: []time.Time{
+			d(1997, 9, 22, 9), d(1997, 10, 20, 9), d(1997, 11, 17, 9),
+			d(1997, 12, 22, 9), d(1998, 1, 19, 9), d(1998, 2, 16, 9),
+		},
+	}, {
+		start: d(1997, 9, 28, 9),
+		rule:  "FREQ=MONTHLY;BYMONTHDAY=-3;COUNT=6",
+		expected: []time.Time{
+			d(1997, 9, 28, 9), d(1997, 10, 29, 9), d(1997, 11, 28, 9),
+			d(1997, 12, 29, 9), d(1998, 1, 29, 9), d(1998, 2, 26, 9),
+		},
+	}, {
+		start: d(1997, 9, 2, 9),
+		rule:  "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13;COUNT=4",
+		expected: []time.Time{
+			d(1998, 2, 13, 9), d(1998, 3, 13, 9), d(1998, 11, 13, 9), d(1999, 8, 13, 9),
+		},
+	}, {
+		start: d(1997, 1, 31, 9),
+		rule:  "FREQ=MONTHLY;COUNT=4",
+		expected: []time.Time{
+			// Months without a 31st are skipped.
+			d(1997, 1, 31, 9), d(1997, 3, 31, 9), d(1997, 5, 31, 9), d(1997, 7, 31, 9),
+		},
+	}, {
+		start: d(1997, 5, 19, 9),
+		rule:  "FREQ=YEARLY;BYDAY=20MO;COUNT=3",
+		expected: []time.Time{
+			d(1997, 5, 19, 9), d(1998, 5, 18, 9), d(1999, 5, 17, 9),
+		},
+	}, {
+		start: d(1997, 3, 13, 9),
+		rule:  "FREQ=YEARLY;BYMONTH=3;BYDAY=TH;COUNT=5",
+		expected: []time.Time{
+			d(1997, 3, 13, 9), d(1997, 3, 20, 9), d(1997, 3, 27, 9),
+			d(1998, 3, 5, 9), d(1998, 3, 12, 9),
+		},
+	}, {
+		start: d(1997, 6, 10, 9),
+		rule:  "FREQ=YEARLY;BYMONTH=6,1;COUNT=4",
+		expected: []time.Time{
+			d(1997, 6, 10, 9), d(1998, 1, 10, 9), d(1998, 6, 10, 9), d(1999, 1, 10, 9),
+		},
+	}, {
+		start: d(2000, 2, 29, 9),
+		rule:  "FREQ=YEARLY;COUNT=3",
+		expected: []time.Time{
+			d(2000, 2, 29, 9), d(2004, 2, 29, 9), d(2008, 2, 29, 9),
+		},
+	}, {
+		start: d(1997, 9, 2, 9),
+		rule:  "FREQ=HOURLY;INTERVAL=3;UNTIL=19970902T170000Z",
+		expected: []time.Time{
+			d(1997, 9, 2, 9), d(1997, 9, 2, 12),
+		},
+	}, {
+		start: d(1997, 9, 2, 9),
+		rule:  "FREQ=DAILY;UNTIL=19970904T090000",
+		expected: []time.Time{
+			d(1997, 9, 2, 9), d(1997, 9, 3, 9), d(1997, 9, 4, 9),
+		},
+	}, {
+		start: d(1997, 9, 2, 9),
+		rule:  "FREQ=DAILY;BYMONTH=2;BYMONTHDAY=30",
+	}} {
+		c.Logf("%s", test.rule)
+		set, err := recurrence.Parse("DTSTART;TZID=America/New_York:"+
+			test.start.Format("20060102T150405")+"\nRRULE:"+test.rule, time.UTC)
+		c.Assert(err, gc.IsNil)
+		c.Check(next(set, test.start.Add(-time.Second), 10), gc.DeepEquals, test.expected)
+	}
+}
+
+func (s *setSuite) TestExclude(c *gc.C) {
+	rule, err := recurrence.ParseRule("FREQ=DAILY;COUNT=4")
+	c.Assert(err, gc.IsNil)
+	set, err := recurrence.New(recurrence.Config{
+		Start:   s.date(2015, 1, 1, 2),
+		Rule:    rule,
+		Exclude: []time.Time{s.date(2015, 1, 2, 2), s.date(2015, 1, 5, 2).UTC()},
+	})
+	c.Assert(err, gc.IsNil)
+	// Excluded occurrences count towards COUNT.
+	c.Assert(next(set, time.Time{}, 10), gc.DeepEquals, []time.Time{
+		s.date(2015, 1, 1, 2), s.date(2015, 1, 3, 2), s.date(2015, 1, 4, 2),
+	})
+}
+
+func (s *setSuite) TestBetween(c *gc.C) {
+	set, err := recurrence.Parse(`
+DTSTART;TZID=America/New_York:20150105T020000
+RRULE:FREQ=WEEKLY;BYDAY=MO,TH
+EXDATE;TZID=America/New_York:20150112T020000,20150115T020000
+`, time.UTC)
+	c.Assert(err, gc.IsNil)
+	c.Assert(set.Between(s.date(2015, 1, 8, 2), s.date(2015, 1, 22, 2)), gc.DeepEquals, []time.Time{
+		s.date(2015, 1, 8, 2), s.date(2015, 1, 19, 2),
+	})
+	c.Assert(set.Between(s.date(2014, 1, 1, 0), s.date(2015, 1, 5, 2)), gc.HasLen, 0)
+}
+
+func (s *setSuite) TestDaylightSaving(c *gc.C) {
+	// Clocks went forward in New York on 8 March 2015.
+	set, err := recurrence.Parse("DTSTART;TZID=America/New_York:20150306T090000\nRRULE:FREQ=DAILY", time.UTC)
+	c.Assert(err, gc.IsNil)
+	c.Assert(next(set, s.date(2015, 3, 6, 12), 3), gc.DeepEquals, []time.Time{
+		s.date(2015, 3, 7, 9), s.date(2015, 3, 8, 9), s.date(2015, 3, 9, 9),
+	})
+
+	// 02:30 was skipped on 8 March 2015, and so occurs an hour later,
+	// as it would with the offset before the transition; EXDATE is
+	// interpreted likewise.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2015, 3, day, hour, min, 0, 0, s.newYork)
+	}
+	set, err = recurrence.Parse("DTSTART;TZID=America/New_York:20150306T023000\nRRULE:FREQ=DAILY", time.UTC)
+	c.Assert(err, gc.IsNil)
+	c.Assert(next(set, at(6, 12, 0), 3), gc.DeepEquals, []time.Time{
+		at(7, 2, 30), at(8, 3, 30), at(9, 2, 30),
+	})
+	c.Assert(at(8, 3, 30).Sub(at(7, 2, 30)), gc.Equals, 24*time.Hour)
+	set, err = recurrence.Parse(`
+DTSTART;TZID=America/New_York:20150306T023000
+RRULE:FREQ=DAILY
+EXDATE;TZID=America/New_York:20150308T023000
+`, time.UTC)
+	c.Assert(err, gc.IsNil)
+	c.Assert(next(set, at(6, 12, 0), 2), gc.DeepEquals, []time.Time{
+		at(7, 2, 30), at(9, 2, 30),
+	})
+}
+
+func (s *setSuite) TestDaylightSavingAtMidnight(c *gc.C) {
+	// Clocks went forward at midnight in Santiago on 8 September
+	// 2024, so that day had no midnight.
+	santiago, err := time.LoadLocation("America/Santiago")
+	c.Assert(err, gc.IsNil)
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 9, 0, 0, 0, santiago)
+	}
+	for _, test := range []struct {
+		rule     string
+		expected []time.Time
+	}{{
+		rule:     "FREQ=DAILY",
+		expected: []time.Time{date(9, 6), date(9, 7), date(9, 8), date(9, 9)},
+	}, {
+		rule:     "FREQ=WEEKLY;BYDAY=SU",
+		expected: []time.Time{date(9, 8), date(9, 15), date(9, 22), date(9, 29)},
+	}, {
+		rule:     "FREQ=MONTHLY;BYMONTHDAY=8",
+		expected: []time.Time{date(9, 8), date(10, 8), date(11, 8), date(12, 8)},
+	}} {
+		c.Logf("%s", test.rule)
+		set, err := recurrence.Parse("DTSTART;TZID=America/Santiago:20240906T090000\nRRULE:"+test.rule, time.UTC)
+		c.Assert(err, gc.IsNil)
+		c.Check(next(set, date(9, 6).Add(-time.Second), 4), gc.DeepEquals, test.expected)
+	}
+}
+
+func (s *setSuite) TestNewValidation(c *gc.C) {
+	_, err := recurrence.New(recurrence.Config{Rule: recurrence.Rule{Freq: recurrence.Daily}})
+	c.Assert(err, gc.ErrorMatches, "validating recurrence config: zero Start not valid")
+	_, err = recurrence.New(recurrence.Config{Start: time.Now()})
+	c.Assert(err, gc.ErrorMatches, "validating recurrence config: validating rule: Freq Frequency\\(0\\) not valid")
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// BudgetConfig holds the configuration for a Budget.
+type BudgetConfig struct {
+	// Clock is used to measure the budget's window.
+	Clock clock.Clock
+
+	// Limit is the maximum number of retries permitted within
+	// any period of length Window.
+	Limit int
+
+	// Window is the period over which retries are limited.
+	Window time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config BudgetConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Limit <= 0 {
+		return errors.NotValidf("non-positive Limit")
+	}
+	if config.Window <= 0 {
+		return errors.NotValidf("non-positive Window")
+	}
+	return nil
+}
+
+// Budget limits the number of retries made within a sliding window of
+// time, across all of the callers that share it. A Budget may be shared
+// by Strategies, so that a failing dependency is not retried by every
+// caller independently.
+//
+// Budget's methods are safe for concurrent use.
+type Budget struct {
+	config BudgetConfig
+
+	mu sync.Mutex
+	// spent holds the times of retries within the window,
+	// oldest first.
+	spent []time.Time
+}
+
+// NewBudget returns a new Budget with the given configuration.
+func NewBudget(config BudgetConfig) (*Budget, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating budget config")
+	}
+	return &Budget{config: config}, nil
+}
+
+// TrySpend attempts to spend a retry from the budget, and reports
+// whether or not it was successful.
+func (b *Budget) TrySpend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.config.Clock.Now()
+	b.expire(now)
+	if len(b.spent) >= b.config.Limit {
+		return false
+	}
+	b.spent = append(b.spent, now)
+	return true
+}
+
+// Available returns the number of retries that may currently be spent.
+func (b *Budget) Available() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(b.config.Clock.Now())
+	return b.config.Limit - len(b.spent)
+}
+
+// expire forgets retries that fall outside the window ending at now.
+func (b *Budget) expire(now time.Time) {
+	cutoff := now.Add(-b.config.Window)
+	var n int
+	for n < len(b.spent) && !b.spent[n].After(cutoff) {
+		n++
+	}
+	b.spent = append(b.spent[:0], b.spent[n:]...)
+}
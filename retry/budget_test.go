@@ -0,0 +1,71 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/axw/juju-time/retry"
+	jujuerrors "github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type budgetSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&budgetSuite{})
+
+func (*budgetSuite) TestValidate(c *gc.C) {
+	_, err := retry.NewBudget(retry.BudgetConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating budget config: nil Clock not valid")
+	_, err = retry.NewBudget(retry.BudgetConfig{Clock: coretesting.NewClock(time.Time{})})
+	c.Assert(err, gc.ErrorMatches, "validating budget config: non-positive Limit not valid")
+}
+
+func (*budgetSuite) TestTrySpend(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	b, err := retry.NewBudget(retry.BudgetConfig{Clock: clock, Limit: 2, Window: time.Minute})
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(b.TrySpend(), jc.IsTrue)
+	clock.Advance(30 * time.Second)
+	c.Assert(b.TrySpend(), jc.IsTrue)
+	c.Assert(b.TrySpend(), jc.IsFalse)
+	c.Assert(b.Available(), gc.Equals, 0)
+
+	// The first retry leaves the window.
+	clock.Advance(30 * time.Second)
+	c.Assert(b.Available(), gc.Equals, 1)
+	c.Assert(b.TrySpend(), jc.IsTrue)
+	c.Assert(b.TrySpend(), jc.IsFalse)
+}
+
+func (*budgetSuite) TestSharedBudget(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	b, err := retry.NewBudget(retry.BudgetConfig{Clock: clock, Limit: 3, Window: time.Minute})
+	c.Assert(err, jc.ErrorIsNil)
+	strategy := retry.Strategy{MaxAttempts: 10, Budget: b}
+
+	// Each caller's retries are spent from the same budget.
+	failed := errors.New("failed")
+	var calls int
+	f := func() error {
+		calls++
+		return failed
+	}
+	err = retry.Retry(context.Background(), clock, strategy, f)
+	c.Assert(err, gc.ErrorMatches, "retry budget exhausted: failed")
+	c.Assert(jujuerrors.Cause(err), gc.Equals, failed)
+	c.Assert(calls, gc.Equals, 4)
+
+	calls = 0
+	err = retry.Retry(context.Background(), clock, strategy, f)
+	c.Assert(err, gc.ErrorMatches, "retry budget exhausted: failed")
+	c.Assert(calls, gc.Equals, 1)
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// ErrNotDone is returned by Poll if the strategy's attempts are
+// exhausted before the polled function reports that it is done.
+var ErrNotDone = errors.New("condition not met")
+
+// Poll calls f until it reports that it is done, or until the strategy
+// dictates that no more attempts should be made, waiting between
+// attempts as Retry does.
+//
+// An error returned by f is treated as transient, and polling continues,
+// unless the error was created with Permanent, in which case the wrapped
+// error is returned immediately. If the attempts are exhausted, Poll
+// returns the error from the final attempt, or ErrNotDone if the final
+// attempt returned no error. If the context is cancelled, such as when
+// its deadline passes, while waiting between attempts, Poll returns the
+// context's error.
+func Poll(ctx context.Context, c clock.Clock, strategy Strategy, f func() (done bool, err error)) error {
+	return Retry(ctx, c, strategy, func() error {
+		done, err := f()
+		if err != nil {
+			return err
+		}
+		if !done {
+			return ErrNotDone
+		}
+		return nil
+	})
+}
+
+// PollInterval is like Poll, calling f at a constant interval until it
+// is done, or until the context is cancelled.
+func PollInterval(ctx context.Context, c clock.Clock, interval time.Duration, f func() (done bool, err error)) error {
+	return Poll(ctx, c, Strategy{Delay: interval}, f)
+}
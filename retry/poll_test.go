@@ -0,0 +1,110 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/axw/juju-time/retry"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type pollSuite struct {
+	coretesting.BaseSuite
+	clock *afterClock
+}
+
+var _ = gc.Suite(&pollSuite{})
+
+func (s *pollSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = &afterClock{
+		Clock:  coretesting.NewClock(time.Time{}),
+		afters: make(chan time.Duration, 1),
+	}
+}
+
+// pollResult is the result of a call to the polled function.
+type pollResult struct {
+	done bool
+	err  error
+}
+
+// start calls poll in a goroutine, with a function returning the
+// results in turn, and then reporting that it is done.
+func (s *pollSuite) start(poll func(f func() (bool, error)) error, results ...pollResult) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- poll(func() (bool, error) {
+			if len(results) == 0 {
+				return true, nil
+			}
+			r := results[0]
+			results = results[1:]
+			return r.done, r.err
+		})
+	}()
+	return result
+}
+
+func (s *pollSuite) poll(ctx context.Context, strategy retry.Strategy) func(f func() (bool, error)) error {
+	return func(f func() (bool, error)) error {
+		return retry.Poll(ctx, s.clock, strategy, f)
+	}
+}
+
+func (s *pollSuite) TestDone(c *gc.C) {
+	result := s.start(s.poll(context.Background(), retry.Strategy{Delay: time.Second}),
+		pollResult{},
+		pollResult{err: errors.New("transient")},
+	)
+	c.Assert(receive(c, s.clock.afters), gc.Equals, time.Second)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.clock.afters), gc.Equals, time.Second)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, result), jc.ErrorIsNil)
+}
+
+func (s *pollSuite) TestNotDone(c *gc.C) {
+	result := s.start(s.poll(context.Background(), retry.Strategy{MaxAttempts: 2}),
+		pollResult{},
+		pollResult{},
+	)
+	c.Assert(receive(c, s.clock.afters), gc.Equals, time.Duration(0))
+	c.Assert(receive(c, result), gc.Equals, retry.ErrNotDone)
+}
+
+func (s *pollSuite) TestLastError(c *gc.C) {
+	failed := errors.New("failed")
+	result := s.start(s.poll(context.Background(), retry.Strategy{MaxAttempts: 2}),
+		pollResult{},
+		pollResult{err: failed},
+	)
+	receive(c, s.clock.afters)
+	c.Assert(receive(c, result), gc.Equals, failed)
+}
+
+func (s *pollSuite) TestPermanent(c *gc.C) {
+	failed := errors.New("failed")
+	result := s.start(s.poll(context.Background(), retry.Strategy{MaxAttempts: 3}),
+		pollResult{err: retry.Permanent(failed)},
+	)
+	c.Assert(receive(c, result), gc.Equals, failed)
+}
+
+func (s *pollSuite) TestInterval(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	result := s.start(func(f func() (bool, error)) error {
+		return retry.PollInterval(ctx, s.clock, time.Minute, f)
+	}, pollResult{}, pollResult{})
+	c.Assert(receive(c, s.clock.afters), gc.Equals, time.Minute)
+	s.clock.Advance(time.Minute)
+	c.Assert(receive(c, s.clock.afters), gc.Equals, time.Minute)
+	cancel()
+	c.Assert(receive(c, result), gc.Equals, context.Canceled)
+}
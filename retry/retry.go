@@ -0,0 +1,186 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package retry provides a simple means of calling a function
+// repeatedly until it succeeds, with delays between attempts
+// determined by a Strategy, and measured with a clock.Clock.
+package retry
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/duration"
+	"github.com/axw/juju-time/logging"
+	"github.com/juju/errors"
+)
+
+// Strategy determines how many times, and how often, a function is
+// attempted by Retry. The zero value is not valid; at least one of
+// MaxAttempts and MaxDuration must be set, or the function will be
+// retried until the context is cancelled.
+type Strategy struct {
+	// Delay is the delay before the second attempt.
+	Delay time.Duration
+
+	// Factor, if greater than 1, is the factor by which the
+	// delay is multiplied after each subsequent attempt. Otherwise,
+	// the delay is constant.
+	Factor float64
+
+	// MaxDelay, if positive, is the maximum delay between attempts.
+	MaxDelay time.Duration
+
+	// MaxAttempts, if positive, is the maximum number of attempts.
+	MaxAttempts int
+
+	// MaxDuration, if positive, is the maximum time to spend
+	// retrying. No attempt is started if it would begin after
+	// MaxDuration has elapsed since the first attempt.
+	MaxDuration time.Duration
+
+	// Budget, if non-nil, is a budget from which each retry must be
+	// spent. If the budget is exhausted, no further attempts are made.
+	Budget *Budget
+
+	// Jitter, if non-nil, is applied to each delay between attempts,
+	// after MaxDelay, e.g. a function calling jitter.FullJitter.
+	Jitter func(time.Duration) time.Duration
+
+	// Logger, if non-nil, is used to log failed attempts,
+	// at debug level.
+	Logger logging.Logger
+
+	// OnRetry, if non-nil, is called after each failed attempt that
+	// is to be retried, with the attempt's number, counting from 1,
+	// the delay before the next attempt, and the attempt's error.
+	// OnRetry is called from the retrying goroutine, before waiting.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// Validate checks that the strategy is valid.
+func (s Strategy) Validate() error {
+	if s.Delay < 0 {
+		return errors.NotValidf("negative Delay")
+	}
+	if s.Factor < 0 {
+		return errors.NotValidf("negative Factor")
+	}
+	if s.MaxDelay < 0 {
+		return errors.NotValidf("negative MaxDelay")
+	}
+	if s.MaxAttempts < 0 {
+		return errors.NotValidf("negative MaxAttempts")
+	}
+	if s.MaxDuration < 0 {
+		return errors.NotValidf("negative MaxDuration")
+	}
+	return nil
+}
+
+// delay returns the delay following the specified attempt, counting
+// from 1, with jitter applied.
+func (s Strategy) delay(attempt int) time.Duration {
+	d := s.backoff(attempt)
+	if s.Jitter != nil {
+		d = s.Jitter(d)
+	}
+	return d
+}
+
+// backoff returns the delay following the specified attempt, counting
+// from 1, without jitter.
+func (s Strategy) backoff(attempt int) time.Duration {
+	d := s.Delay
+	if s.Factor > 1 {
+		// Scale saturates, so that the delay cannot overflow
+		// when there is no MaxDelay.
+		d = duration.Scale(d, math.Pow(s.Factor, float64(attempt-1)))
+	}
+	if s.MaxDelay > 0 && d > s.MaxDelay {
+		return s.MaxDelay
+	}
+	return d
+}
+
+// Retry calls f until it returns nil, or until the strategy dictates
+// that no more attempts should be made, waiting between attempts as
+// determined by the strategy and measured by the clock.
+//
+// If the attempts are exhausted, Retry returns the error returned by
+// the final attempt. If the strategy's budget is exhausted, Retry returns
+// that error annotated with "retry budget exhausted". If f returns an
+// error created with Permanent, no further attempts are made, and the
+// wrapped error is returned. If the context is cancelled while waiting
+// between attempts, Retry returns the context's error.
+func Retry(ctx context.Context, c clock.Clock, strategy Strategy, f func() error) error {
+	if err := strategy.Validate(); err != nil {
+		return errors.Annotate(err, "validating retry strategy")
+	}
+	logger := logging.OrNop(strategy.Logger)
+	start := c.Now()
+	// A single timer is used for all waits between attempts.
+	timers := clock.Timers(c)
+	var timer clock.Timer
+	defer func() {
+		if timer != nil {
+			timers.Put(timer)
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if p, ok := err.(*permanentError); ok {
+			logger.Debugf("attempt %d failed permanently: %v", attempt, p.err)
+			return p.err
+		}
+		if strategy.MaxAttempts > 0 && attempt >= strategy.MaxAttempts {
+			logger.Debugf("attempt %d failed, giving up: %v", attempt, err)
+			return err
+		}
+		delay := strategy.delay(attempt)
+		if strategy.MaxDuration > 0 {
+			if c.Now().Add(delay).Sub(start) > strategy.MaxDuration {
+				logger.Debugf("attempt %d failed, giving up after %v: %v", attempt, c.Now().Sub(start), err)
+				return err
+			}
+		}
+		if strategy.Budget != nil && !strategy.Budget.TrySpend() {
+			logger.Debugf("attempt %d failed, retry budget exhausted: %v", attempt, err)
+			return errors.Annotate(err, "retry budget exhausted")
+		}
+		logger.Debugf("attempt %d failed, retrying in %v: %v", attempt, delay, err)
+		if strategy.OnRetry != nil {
+			strategy.OnRetry(attempt, delay, err)
+		}
+		if timer == nil {
+			timer = timers.Get(delay)
+		} else {
+			timer.Reset(delay)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.Chan():
+		}
+	}
+}
+
+// Permanent wraps an error to indicate that it is permanent, and that
+// Retry should not make any further attempts.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+type permanentError struct {
+	err error
+}
+
+// Error is part of the error interface.
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
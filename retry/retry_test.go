@@ -0,0 +1,258 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/axw/juju-time/retry"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type retrySuite struct {
+	coretesting.BaseSuite
+	clock *afterClock
+}
+
+var _ = gc.Suite(&retrySuite{})
+
+func (s *retrySuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = &afterClock{
+		Clock:  coretesting.NewClock(time.Time{}),
+		afters: make(chan time.Duration, 1),
+	}
+}
+
+// afterClock is a test clock that sends the duration passed
+// to each call to After on a channel.
+type afterClock struct {
+	*coretesting.Clock
+	afters chan time.Duration
+}
+
+func (c *afterClock) After(d time.Duration) <-chan time.Time {
+	ch := c.Clock.After(d)
+	c.afters <- d
+	return ch
+}
+
+// wait waits for Retry to wait on the clock, asserts the delay,
+// and advances the clock by it.
+func (s *retrySuite) wait(c *gc.C, expect time.Duration) {
+	c.Assert(receive(c, s.clock.afters), gc.Equals, expect)
+	s.clock.Advance(expect)
+}
+
+// start calls retry.Retry in a goroutine, sending the time of each
+// attempt on the returned channel, and the result of Retry on the
+// other. Attempts fail with the errors in errs, in turn, and then
+// succeed.
+func (s *retrySuite) start(ctx context.Context, strategy retry.Strategy, errs ...error) (<-chan time.Time, <-chan error) {
+	attempts := make(chan time.Time)
+	result := make(chan error, 1)
+	go func() {
+		result <- retry.Retry(ctx, s.clock, strategy, func() error {
+			attempts <- s.clock.Now()
+			if len(errs) == 0 {
+				return nil
+			}
+			err := errs[0]
+			errs = errs[1:]
+			return err
+		})
+	}()
+	return attempts, result
+}
+
+func (s *retrySuite) TestSuccess(c *gc.C) {
+	attempts, result := s.start(context.Background(), retry.Strategy{MaxAttempts: 3})
+	receive(c, attempts)
+	c.Assert(receive(c, result), jc.ErrorIsNil)
+}
+
+func (s *retrySuite) TestBackoff(c *gc.C) {
+	t0 := s.clock.Now()
+	failed := errors.New("failed")
+	attempts, result := s.start(context.Background(), retry.Strategy{
+		Delay:       time.Second,
+		Factor:      2,
+		MaxDelay:    3 * time.Second,
+		MaxAttempts: 4,
+	}, failed, failed, failed, failed)
+
+	c.Assert(receive(c, attempts), gc.Equals, t0)
+	s.wait(c, time.Second)
+	c.Assert(receive(c, attempts), gc.Equals, t0.Add(time.Second))
+	s.wait(c, 2*time.Second)
+	c.Assert(receive(c, attempts), gc.Equals, t0.Add(3*time.Second))
+	s.wait(c, 3*time.Second)
+	c.Assert(receive(c, attempts), gc.Equals, t0.Add(6*time.Second))
+	c.Assert(receive(c, result), gc.Equals, failed)
+}
+
+func (s *retrySuite) TestBackoffSaturates(c *gc.C) {
+	// Without a MaxDelay, the delay grows until it
+	// saturates, rather than overflowing.
+	failed := errors.New("failed")
+	attempts, result := s.start(context.Background(), retry.Strategy{
+		Delay:       time.Hour,
+		Factor:      1e6,
+		MaxAttempts: 4,
+	}, failed, failed, failed, failed)
+
+	receive(c, attempts)
+	s.wait(c, time.Hour)
+	receive(c, attempts)
+	s.wait(c, 1e6*time.Hour)
+	receive(c, attempts)
+	s.wait(c, math.MaxInt64)
+	receive(c, attempts)
+	c.Assert(receive(c, result), gc.Equals, failed)
+}
+
+func (s *retrySuite) TestJitter(c *gc.C) {
+	failed := errors.New("failed")
+	var jittered []time.Duration
+	attempts, result := s.start(context.Background(), retry.Strategy{
+		Delay:       time.Second,
+		Factor:      2,
+		MaxDelay:    3 * time.Second,
+		MaxAttempts: 4,
+		Jitter: func(d time.Duration) time.Duration {
+			jittered = append(jittered, d)
+			return d / 2
+		},
+	}, failed, failed, failed, failed)
+
+	// Jitter is applied after MaxDelay, and does not
+	// affect the progression of delays.
+	receive(c, attempts)
+	s.wait(c, 500*time.Millisecond)
+	receive(c, attempts)
+	s.wait(c, time.Second)
+	receive(c, attempts)
+	s.wait(c, 1500*time.Millisecond)
+	receive(c, attempts)
+	c.Assert(receive(c, result), gc.Equals, failed)
+	c.Assert(jittered, jc.DeepEquals, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second})
+}
+
+func (s *retrySuite) TestLogger(c *gc.C) {
+	var messages []string
+	logger := loggerFunc(func(format string, args ...interface{}) {
+		messages = append(messages, fmt.Sprintf(format, args...))
+	})
+	failed := errors.New("failed")
+	attempts, result := s.start(context.Background(), retry.Strategy{
+		Delay:       time.Second,
+		MaxAttempts: 2,
+		Logger:      logger,
+	}, failed, failed)
+
+	receive(c, attempts)
+	s.wait(c, time.Second)
+	receive(c, attempts)
+	c.Assert(receive(c, result), gc.Equals, failed)
+	c.Assert(messages, jc.DeepEquals, []string{
+		"attempt 1 failed, retrying in 1s: failed",
+		"attempt 2 failed, giving up: failed",
+	})
+}
+
+// loggerFunc is a logging.Logger that passes debug messages
+// to a function, and discards others.
+type loggerFunc func(format string, args ...interface{})
+
+func (f loggerFunc) Debugf(format string, args ...interface{}) { f(format, args...) }
+func (loggerFunc) Infof(string, ...interface{})                {}
+func (loggerFunc) Warningf(string, ...interface{})             {}
+func (loggerFunc) Errorf(string, ...interface{})               {}
+
+func (s *retrySuite) TestOnRetry(c *gc.C) {
+	type retried struct {
+		attempt int
+		delay   time.Duration
+		err     error
+	}
+	var calls []retried
+	failed := errors.New("failed")
+	attempts, result := s.start(context.Background(), retry.Strategy{
+		Delay:       time.Second,
+		Factor:      2,
+		MaxAttempts: 3,
+		OnRetry: func(attempt int, delay time.Duration, err error) {
+			calls = append(calls, retried{attempt, delay, err})
+		},
+	}, failed, failed, failed)
+
+	receive(c, attempts)
+	s.wait(c, time.Second)
+	receive(c, attempts)
+	s.wait(c, 2*time.Second)
+	receive(c, attempts)
+	c.Assert(receive(c, result), gc.Equals, failed)
+
+	// OnRetry is not called for the final attempt,
+	// which is not retried.
+	c.Assert(calls, jc.DeepEquals, []retried{
+		{1, time.Second, failed},
+		{2, 2 * time.Second, failed},
+	})
+}
+
+func (s *retrySuite) TestMaxDuration(c *gc.C) {
+	failed := errors.New("failed")
+	attempts, result := s.start(context.Background(), retry.Strategy{
+		Delay:       time.Second,
+		MaxDuration: 1500 * time.Millisecond,
+	}, failed, failed, failed)
+
+	receive(c, attempts)
+	s.wait(c, time.Second)
+	receive(c, attempts)
+	c.Assert(receive(c, result), gc.Equals, failed)
+}
+
+func (s *retrySuite) TestPermanent(c *gc.C) {
+	failed := errors.New("failed")
+	attempts, result := s.start(context.Background(), retry.Strategy{
+		MaxAttempts: 3,
+	}, retry.Permanent(failed))
+
+	receive(c, attempts)
+	c.Assert(receive(c, result), gc.Equals, failed)
+}
+
+func (s *retrySuite) TestContextCancelled(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts, result := s.start(ctx, retry.Strategy{Delay: time.Hour}, errors.New("failed"))
+	receive(c, attempts)
+	cancel()
+	c.Assert(receive(c, result), gc.Equals, context.Canceled)
+}
+
+func (s *retrySuite) TestValidate(c *gc.C) {
+	err := retry.Retry(context.Background(), s.clock, retry.Strategy{Delay: -1}, func() error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	c.Assert(err, gc.ErrorMatches, "validating retry strategy: negative Delay not valid")
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
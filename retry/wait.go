@@ -0,0 +1,113 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// ErrTimeout is the error held by a WaitError when a channel wait
+// times out.
+var ErrTimeout = errors.New("timed out")
+
+// WaitError is the error returned when a wait by WaitFor, WaitReceive
+// or WaitClosed fails, recording how long was waited, and how many
+// attempts were made.
+type WaitError struct {
+	// Waited is the time spent waiting.
+	Waited time.Duration
+
+	// Attempts is the number of times the condition was checked.
+	// It is zero for channel waits.
+	Attempts int
+
+	// Err is the reason the wait failed: the error from the final
+	// check of the condition, ErrNotDone, ErrTimeout, or the
+	// context's error.
+	Err error
+
+	// LastErr, if non-nil, is the error returned by the final check
+	// of the condition, when Err is the context's error.
+	LastErr error
+}
+
+// Error is part of the error interface.
+func (e *WaitError) Error() string {
+	msg := fmt.Sprintf("waited %v", e.Waited)
+	if e.Attempts > 0 {
+		msg += fmt.Sprintf(" (%d attempts)", e.Attempts)
+	}
+	msg += ": " + e.Err.Error()
+	if e.LastErr != nil {
+		msg += fmt.Sprintf(" (last error: %v)", e.LastErr)
+	}
+	return msg
+}
+
+// Unwrap returns the reason the wait failed.
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
+
+// WaitFor is like Poll, waiting for the condition to be met, and
+// checking it again after delays determined by the strategy. If the wait
+// fails, WaitFor returns a *WaitError.
+func WaitFor(ctx context.Context, c clock.Clock, strategy Strategy, condition func() (bool, error)) error {
+	start := c.Now()
+	var attempts int
+	var lastErr error
+	err := Poll(ctx, c, strategy, func() (bool, error) {
+		attempts++
+		done, err := condition()
+		lastErr = err
+		if p, ok := err.(*permanentError); ok {
+			lastErr = p.err
+		}
+		return done, err
+	})
+	if err == nil {
+		return nil
+	}
+	werr := &WaitError{
+		Waited:   c.Now().Sub(start),
+		Attempts: attempts,
+		Err:      err,
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && err == ctxErr {
+		werr.LastErr = lastErr
+	}
+	return werr
+}
+
+// WaitReceive waits for a value to be received on ch, and returns it.
+// If the timeout, as measured by the clock, elapses first, WaitReceive
+// returns a *WaitError holding ErrTimeout; if the context is done first,
+// the *WaitError holds the context's error. If ch is closed, WaitReceive
+// returns the zero value.
+func WaitReceive[T any](ctx context.Context, c clock.Clock, ch <-chan T, timeout time.Duration) (T, error) {
+	start := c.Now()
+	timer := clock.NewTimer(c, timeout)
+	defer timer.Stop()
+	var zero T
+	select {
+	case v := <-ch:
+		return v, nil
+	case <-timer.Chan():
+		return zero, &WaitError{Waited: c.Now().Sub(start), Err: ErrTimeout}
+	case <-ctx.Done():
+		return zero, &WaitError{Waited: c.Now().Sub(start), Err: ctx.Err()}
+	}
+}
+
+// WaitClosed is like WaitReceive, waiting for ch to be closed, or for
+// a value to be received on it.
+func WaitClosed(ctx context.Context, c clock.Clock, ch <-chan struct{}, timeout time.Duration) error {
+	_, err := WaitReceive(ctx, c, ch, timeout)
+	return err
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/retry"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type waitSuite struct {
+	coretesting.BaseSuite
+	clock   *clocktesting.Clock
+	harness *clocktesting.Harness
+}
+
+var _ = gc.Suite(&waitSuite{})
+
+func (s *waitSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = clocktesting.NewClock(time.Time{})
+	s.harness = clocktesting.NewHarness(s.clock)
+}
+
+func (s *waitSuite) waitFor(ctx context.Context, strategy retry.Strategy, condition func() (bool, error)) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- retry.WaitFor(ctx, s.clock, strategy, condition)
+	}()
+	return result
+}
+
+func (s *waitSuite) TestWaitFor(c *gc.C) {
+	var checks int
+	result := s.waitFor(context.Background(), retry.Strategy{Delay: time.Second}, func() (bool, error) {
+		checks++
+		return checks == 3, nil
+	})
+	s.harness.Settle(c)
+	s.harness.AdvanceAndSettle(c, time.Second)
+	s.harness.AdvanceAndSettle(c, time.Second)
+	c.Assert(receive(c, result), jc.ErrorIsNil)
+	s.harness.AssertNoLeaks(c)
+}
+
+func (s *waitSuite) TestWaitForExhausted(c *gc.C) {
+	result := s.waitFor(context.Background(), retry.Strategy{
+		Delay:       time.Second,
+		MaxDuration: 2 * time.Second,
+	}, func() (bool, error) {
+		return false, nil
+	})
+	s.harness.Settle(c)
+	s.harness.AdvanceAndSettle(c, time.Second)
+	s.harness.AdvanceAndSettle(c, time.Second)
+	err := receive(c, result)
+	c.Assert(err, gc.ErrorMatches, `waited 2s \(3 attempts\): condition not met`)
+	werr, ok := err.(*retry.WaitError)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(werr.Attempts, gc.Equals, 3)
+	c.Assert(werr.Waited, gc.Equals, 2*time.Second)
+	c.Assert(errors.Is(err, retry.ErrNotDone), jc.IsTrue)
+	s.harness.AssertNoLeaks(c)
+}
+
+func (s *waitSuite) TestWaitForContextDone(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	failed := errors.New("not ready")
+	result := s.waitFor(ctx, retry.Strategy{Delay: time.Minute}, func() (bool, error) {
+		return false, failed
+	})
+	s.harness.Settle(c)
+	s.harness.AdvanceAndSettle(c, 30*time.Second)
+	cancel()
+	err := receive(c, result)
+	c.Assert(err, gc.ErrorMatches, `waited 30s \(1 attempts\): context canceled \(last error: not ready\)`)
+	c.Assert(errors.Is(err, context.Canceled), jc.IsTrue)
+	c.Assert(err.(*retry.WaitError).LastErr, gc.Equals, failed)
+	s.harness.AssertNoLeaks(c)
+}
+
+func (s *waitSuite) TestWaitForPermanent(c *gc.C) {
+	failed := errors.New("failed")
+	err := retry.WaitFor(context.Background(), s.clock, retry.Strategy{}, func() (bool, error) {
+		return false, retry.Permanent(failed)
+	})
+	c.Assert(err, gc.ErrorMatches, `waited 0s \(1 attempts\): failed`)
+	c.Assert(err.(*retry.WaitError).Err, gc.Equals, failed)
+	c.Assert(err.(*retry.WaitError).LastErr, gc.IsNil)
+}
+
+func (s *waitSuite) TestWaitReceive(c *gc.C) {
+	ch := make(chan int, 1)
+	ch <- 42
+	v, err := retry.WaitReceive(context.Background(), s.clock, ch, time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(v, gc.Equals, 42)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := retry.WaitReceive(context.Background(), s.clock, ch, time.Second)
+		result <- err
+	}()
+	s.harness.Settle(c)
+	s.harness.AdvanceAndSettle(c, time.Second)
+	err = receive(c, result)
+	c.Assert(err, gc.ErrorMatches, "waited 1s: timed out")
+	c.Assert(errors.Is(err, retry.ErrTimeout), jc.IsTrue)
+	s.harness.AssertNoLeaks(c)
+}
+
+func (s *waitSuite) TestWaitClosed(c *gc.C) {
+	ch := make(chan struct{})
+	close(ch)
+	c.Assert(retry.WaitClosed(context.Background(), s.clock, ch, time.Second), jc.ErrorIsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := retry.WaitClosed(ctx, s.clock, make(chan struct{}), time.Second)
+	c.Assert(err, gc.ErrorMatches, "waited 0s: context canceled")
+	clocktesting.ExpectNoTimers(c, s.clock)
+}
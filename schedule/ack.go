@@ -0,0 +1,106 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+)
+
+// Ack acknowledges the processing of the in-flight operation with the
+// specified key, removing it from the schedule, and reports whether or
+// not the operation was in flight. An operation whose ack timeout has
+// passed is no longer in flight, and will be returned by Ready again.
+// See Config.AckTimeout.
+func (s *Schedule[K, O]) Ack(key K) bool {
+	return s.TryAck(key) == nil
+}
+
+// TryAck is like Ack, except that it returns an *OperationError wrapping
+// ErrNotFound if no operation with the key is in flight, or ErrExpired
+// if the operation's ack timeout has passed.
+func (s *Schedule[K, O]) TryAck(key K) error {
+	now := s.time.Now()
+	if err := s.checkInFlight(now, key); err != nil {
+		return err
+	}
+	delete(s.inflight, key)
+	op, _ := s.q.Remove(key)
+	s.audit(AuditAck, key, op, now, time.Time{})
+	s.notify()
+	return nil
+}
+
+// Nack reports the failure to process the in-flight operation with the
+// specified key, returning it to the schedule for the time computed from
+// its delay, as if it were added again by Add, and reports whether or not
+// the operation was in flight, as for Ack. See Config.AckTimeout.
+func (s *Schedule[K, O]) Nack(key K) bool {
+	return s.TryNack(key) == nil
+}
+
+// TryNack is like Nack, except that it returns an error as for TryAck.
+func (s *Schedule[K, O]) TryNack(key K) error {
+	now := s.time.Now()
+	if err := s.checkInFlight(now, key); err != nil {
+		return err
+	}
+	delete(s.inflight, key)
+	op, _, _ := s.q.Get(key)
+	when := s.when(now, op)
+	s.q.Update(key, op, when)
+	s.audit(AuditNack, key, op, now, when)
+	s.notify()
+	return nil
+}
+
+// checkInFlight returns an *OperationError if the operation with the
+// specified key is not in flight at the specified time.
+func (s *Schedule[K, O]) checkInFlight(now time.Time, key K) error {
+	if _, ok := s.inflight[key]; !ok {
+		return operationError(key, ErrNotFound)
+	}
+	if _, deadline, _ := s.q.Get(key); !deadline.After(now) {
+		return operationError(key, ErrExpired)
+	}
+	return nil
+}
+
+// AckTimeout returns the time for which the operations returned by
+// Ready are held in flight, or zero if the schedule does not hand out
+// operations in two phases. See Config.AckTimeout.
+func (s *Schedule[K, O]) AckTimeout() time.Duration {
+	return s.ackTimeout
+}
+
+// InFlight returns the number of operations returned by Ready that
+// have been neither acknowledged nor returned to the schedule.
+func (s *Schedule[K, O]) InFlight() int {
+	return len(s.inflight)
+}
+
+// supersede forgets that the operation with the specified key is in
+// flight, if it is, so that an operation added with the key replaces
+// it as a pending operation.
+func (s *Schedule[K, O]) supersede(key K) {
+	if _, ok := s.inflight[key]; ok {
+		delete(s.inflight, key)
+		s.q.Remove(key)
+	}
+}
+
+// hold keeps the ready items in the schedule as in-flight operations,
+// until they are acknowledged, or the ack timeout passes, if the schedule
+// has one.
+func (s *Schedule[K, O]) hold(now time.Time, ready []timequeue.Item[K, O]) {
+	if s.inflight == nil {
+		return
+	}
+	deadline := now.Add(s.ackTimeout)
+	for _, item := range ready {
+		s.q.Add(item.Key, item.Value, deadline)
+		s.inflight[item.Key] = struct{}{}
+	}
+}
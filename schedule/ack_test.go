@@ -0,0 +1,97 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (*scheduleSuite) TestAck(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		AckTimeout: 10 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := operation{"k0", "v0", time.Second}
+	op1 := operation{"k1", "v1", 2 * time.Second}
+	op2 := operation{"k2", "v2", 3 * time.Second}
+	s.AddAll([]operation{op0, op1, op2})
+
+	// Ready operations are held in flight, rather than removed.
+	clock.Advance(3 * time.Second)
+	assertReady(c, s, clock, op0, op1, op2)
+	assertReady(c, s, clock /* nothing */)
+	c.Assert(s.InFlight(), gc.Equals, 3)
+
+	c.Assert(s.Ack("k0"), jc.IsTrue)
+	c.Assert(s.Ack("k0"), jc.IsFalse)
+	_, _, ok := s.Get("k0")
+	c.Assert(ok, jc.IsFalse)
+
+	// A returned operation is rescheduled according to its delay.
+	c.Assert(s.Nack("k1"), jc.IsTrue)
+	c.Assert(s.Nack("k1"), jc.IsFalse)
+	c.Assert(s.InFlight(), gc.Equals, 1)
+	clock.Advance(2 * time.Second)
+	assertReady(c, s, clock, op1)
+	c.Assert(s.Ack("k1"), jc.IsTrue)
+
+	// An operation that is not acknowledged within the
+	// timeout is returned by Ready again.
+	clock.Advance(8 * time.Second)
+	assertReady(c, s, clock, op2)
+	c.Assert(s.Ack("k2"), jc.IsTrue)
+	c.Assert(s.InFlight(), gc.Equals, 0)
+	c.Assert(s.Next(), gc.IsNil)
+}
+
+func (*scheduleSuite) TestAckSuperseded(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		AckTimeout: 10 * time.Second,
+		AuditSize:  10,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := clock.Now()
+	s.Add(operation{"k0", "v0", 0})
+	assertReady(c, s, clock, operation{"k0", "v0", 0})
+
+	// Adding an operation with the key of an in-flight
+	// operation replaces it, so it is not acknowledged.
+	s.Add(operation{"k0", "v1", time.Second})
+	c.Assert(s.InFlight(), gc.Equals, 0)
+	c.Assert(s.Ack("k0"), jc.IsFalse)
+	op, t, ok := s.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(op.value, gc.Equals, "v1")
+	c.Assert(t, gc.Equals, t0.Add(time.Second))
+
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, operation{"k0", "v1", time.Second})
+	c.Assert(s.Nack("k0"), jc.IsTrue)
+	var kinds []schedule.AuditKind
+	for _, event := range s.AuditLog() {
+		kinds = append(kinds, event.Kind)
+	}
+	c.Assert(kinds, jc.DeepEquals, []schedule.AuditKind{
+		schedule.AuditAdd, schedule.AuditReady,
+		schedule.AuditAdd, schedule.AuditReady,
+		schedule.AuditNack,
+	})
+}
+
+func (*scheduleSuite) TestAckTimeoutValidation(c *gc.C) {
+	_, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clocktesting.NewClock(time.Time{}),
+		AckTimeout: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating schedule config: negative AckTimeout not valid")
+}
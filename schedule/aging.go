@@ -0,0 +1,41 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"sort"
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+)
+
+// agedPriority returns the priority of the operation scheduled for the
+// specified time, boosted by one for every interval of aging for which it
+// has waited past that time, at the specified time.
+func agedPriority(op interface{}, scheduled, now time.Time, aging time.Duration) int {
+	priority := operationPriority(op)
+	if waited := now.Sub(scheduled); waited > 0 {
+		priority += int(waited / aging)
+	}
+	return priority
+}
+
+// choose chooses n of the ready items, by their aged priorities at the
+// specified time, preferring earlier items where priorities are equal.
+// The chosen items are returned in order of time, along with the rest.
+func (s *Schedule[K, O]) choose(now time.Time, ready []timequeue.Item[K, O], n int) (chosen, rest []timequeue.Item[K, O]) {
+	priorities := make(map[K]int, len(ready))
+	for _, item := range ready {
+		priorities[item.Key] = agedPriority(item.Value, item.Time, now, s.priorityAging)
+	}
+	sort.SliceStable(ready, func(i, j int) bool {
+		return priorities[ready[i].Key] > priorities[ready[j].Key]
+	})
+	chosen = append([]timequeue.Item[K, O](nil), ready[:n]...)
+	rest = ready[n:]
+	sort.SliceStable(chosen, func(i, j int) bool {
+		return chosen[i].Time.Before(chosen[j].Time)
+	})
+	return chosen, rest
+}
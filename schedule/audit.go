@@ -0,0 +1,155 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditKind identifies the kind of a schedule decision recorded in
+// the audit log.
+type AuditKind int
+
+const (
+	// AuditAdd records the addition of an operation.
+	AuditAdd AuditKind = iota
+
+	// AuditCoalesce records the addition of an operation whose key
+	// was already scheduled, and which was coalesced with the
+	// existing operation.
+	AuditCoalesce
+
+	// AuditReject records the rejection of an operation by a
+	// bounded schedule.
+	AuditReject
+
+	// AuditDrop records the dropping of a pending operation from a
+	// bounded schedule, to make room for another.
+	AuditDrop
+
+	// AuditRemove records the removal of an operation, by Remove,
+	// RemoveAll or Clear.
+	AuditRemove
+
+	// AuditDefer records a ready operation being rescheduled by
+	// Ready, because it was outside its windows, or because of
+	// smoothing.
+	AuditDefer
+
+	// AuditReady records an operation being returned by Ready.
+	AuditReady
+
+	// AuditFlush records an operation being returned by Flush,
+	// regardless of the time for which it was scheduled.
+	AuditFlush
+
+	// AuditReschedule records a pending operation being moved
+	// to a new time by Reconcile.
+	AuditReschedule
+
+	// AuditAck records an in-flight operation being acknowledged,
+	// and AuditNack one being returned to the schedule by Nack.
+	AuditAck
+	AuditNack
+)
+
+// String returns a string representation of the kind.
+func (k AuditKind) String() string {
+	switch k {
+	case AuditAdd:
+		return "add"
+	case AuditCoalesce:
+		return "coalesce"
+	case AuditReject:
+		return "reject"
+	case AuditDrop:
+		return "drop"
+	case AuditRemove:
+		return "remove"
+	case AuditDefer:
+		return "defer"
+	case AuditReady:
+		return "ready"
+	case AuditFlush:
+		return "flush"
+	case AuditReschedule:
+		return "reschedule"
+	case AuditAck:
+		return "ack"
+	case AuditNack:
+		return "nack"
+	}
+	return fmt.Sprintf("AuditKind(%d)", int(k))
+}
+
+// AuditEvent records a decision made by a Schedule about an operation.
+type AuditEvent[K comparable] struct {
+	// Kind is the kind of decision.
+	Kind AuditKind
+
+	// Key is the key of the operation.
+	Key K
+
+	// TraceID is the operation's trace ID, if it implements
+	// TracedOperation.
+	TraceID string
+
+	// Time is the time at which the decision was made: the time
+	// passed to Ready, or the schedule's clock time otherwise.
+	Time time.Time
+
+	// Scheduled is the time for which the operation is, or was,
+	// scheduled. For AuditAdd, AuditCoalesce, AuditDefer,
+	// AuditReschedule and AuditNack events, this is the newly computed
+	// time; for AuditReady and AuditFlush events, it is the time for
+	// which the operation was scheduled. Scheduled is zero for
+	// AuditReject events.
+	Scheduled time.Time
+
+	// Delay is the difference between Scheduled and Time.
+	Delay time.Duration
+}
+
+// auditLog is a ring buffer of the most recent audit events.
+type auditLog[K comparable] struct {
+	events []AuditEvent[K]
+	next   int
+	full   bool
+}
+
+func newAuditLog[K comparable](size int) *auditLog[K] {
+	if size == 0 {
+		return nil
+	}
+	return &auditLog[K]{events: make([]AuditEvent[K], size)}
+}
+
+func (l *auditLog[K]) record(kind AuditKind, key K, traceID string, now, scheduled time.Time) {
+	event := AuditEvent[K]{Kind: kind, Key: key, TraceID: traceID, Time: now, Scheduled: scheduled}
+	if !scheduled.IsZero() {
+		event.Delay = scheduled.Sub(now)
+	}
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// list returns the recorded events, oldest first.
+func (l *auditLog[K]) list() []AuditEvent[K] {
+	if !l.full {
+		return append([]AuditEvent[K](nil), l.events[:l.next]...)
+	}
+	events := make([]AuditEvent[K], 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
+
+func (l *auditLog[K]) clone() *auditLog[K] {
+	clone := *l
+	clone.events = append([]AuditEvent[K](nil), l.events...)
+	return &clone
+}
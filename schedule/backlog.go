@@ -0,0 +1,66 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+// Backpressure reports whether the Runner is signalling backpressure,
+// its ready backlog having reached BacklogHighWater and not yet fallen
+// to BacklogLowWater, so that producers may poll it rather than, or as
+// well as, configuring OnBacklog. Backpressure always returns false if
+// BacklogHighWater is not positive.
+func (r *Runner[K, O]) Backpressure() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.backlogHigh
+}
+
+// checkBacklog starts or stops signalling backpressure, if the ready
+// backlog has crossed its high or low watermark. checkBacklog must be
+// called with r.mu held.
+func (r *Runner[K, O]) checkBacklog() {
+	if r.backlogChanged == nil {
+		return
+	}
+	backlog := len(r.blocked) + r.queued.size
+	switch {
+	case !r.backlogHigh && backlog >= r.config.BacklogHighWater:
+		r.backlogHigh = true
+	case r.backlogHigh && backlog <= r.config.BacklogLowWater:
+		r.backlogHigh = false
+	default:
+		return
+	}
+	select {
+	case r.backlogChanged <- struct{}{}:
+	default:
+	}
+}
+
+// backlogLoop calls OnBacklog each time the Runner starts or stops
+// signalling backpressure, until the Runner is stopped, and then
+// closes done.
+func (r *Runner[K, O]) backlogLoop(done chan<- struct{}) {
+	defer close(done)
+	var signalled bool
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.backlogChanged:
+		}
+		r.mu.Lock()
+		high := r.backlogHigh
+		backlog := len(r.blocked) + r.queued.size
+		r.mu.Unlock()
+		if high == signalled {
+			continue
+		}
+		signalled = high
+		if high {
+			r.logger.Warningf("ready backlog of %d operations reached high watermark %d", backlog, r.config.BacklogHighWater)
+		} else {
+			r.logger.Infof("ready backlog of %d operations fell to low watermark %d", backlog, r.config.BacklogLowWater)
+		}
+		r.config.OnBacklog(high)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (s *runnerSuite) TestBacklogValidate(c *gc.C) {
+	onBacklog := func(bool) {}
+	for _, test := range []struct {
+		high, low int
+		onBacklog func(bool)
+		err       string
+	}{
+		{-1, 0, onBacklog, "negative BacklogHighWater not valid"},
+		{2, 2, onBacklog, "BacklogLowWater 2 with BacklogHighWater 2 not valid"},
+		{2, -1, onBacklog, "BacklogLowWater -1 with BacklogHighWater 2 not valid"},
+		{2, 1, nil, "nil OnBacklog not valid"},
+	} {
+		_, err := schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+			Schedule:         s.schedule,
+			BacklogHighWater: test.high,
+			BacklogLowWater:  test.low,
+			OnBacklog:        test.onBacklog,
+		})
+		c.Check(err, gc.ErrorMatches, "validating runner config: "+test.err)
+	}
+}
+
+func (s *runnerSuite) TestBacklog(c *gc.C) {
+	backlog := make(chan bool, 2)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		MaxConcurrent:    1,
+		BacklogHighWater: 3,
+		BacklogLowWater:  1,
+		OnBacklog: func(high bool) {
+			backlog <- high
+		},
+	})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(chan struct{})
+	do := func(op *runnableOperation, ctx context.Context) error {
+		started <- op.key
+		<-release
+		return nil
+	}
+	r.Add(&runnableOperation{key: "k0", do: do})
+	c.Assert(receive(c, started), gc.Equals, "k0")
+	c.Assert(r.Backpressure(), jc.IsFalse)
+
+	// Backpressure is signalled once the
+	// backlog reaches the high watermark.
+	r.Add(&runnableOperation{key: "k1", do: do})
+	r.Add(&runnableOperation{key: "k2", do: do})
+	assertNotReceived(c, backlog)
+	r.Add(&runnableOperation{key: "k3", do: do})
+	c.Assert(receive(c, backlog), jc.IsTrue)
+	c.Assert(r.Backpressure(), jc.IsTrue)
+
+	// It continues until the backlog falls
+	// to the low watermark.
+	release <- struct{}{}
+	c.Assert(receive(c, started), gc.Equals, "k1")
+	assertNotReceived(c, backlog)
+	c.Assert(r.Backpressure(), jc.IsTrue)
+	release <- struct{}{}
+	c.Assert(receive(c, started), gc.Equals, "k2")
+	c.Assert(receive(c, backlog), jc.IsFalse)
+	c.Assert(r.Backpressure(), jc.IsFalse)
+
+	release <- struct{}{}
+	c.Assert(receive(c, started), gc.Equals, "k3")
+	close(release)
+	r.Kill()
+	c.Assert(r.Wait(), jc.ErrorIsNil)
+	assertNotReceived(c, backlog)
+}
+
+func (s *runnerSuite) TestBacklogCleared(c *gc.C) {
+	backlog := make(chan bool, 2)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		MaxConcurrent:    1,
+		BacklogHighWater: 2,
+		OnBacklog: func(high bool) {
+			backlog <- high
+		},
+	})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(chan struct{})
+	defer close(release)
+	do := func(op *runnableOperation, ctx context.Context) error {
+		started <- op.key
+		<-release
+		return nil
+	}
+	r.Add(&runnableOperation{key: "k0", do: do})
+	c.Assert(receive(c, started), gc.Equals, "k0")
+	r.AddAll([]*runnableOperation{{key: "k1", do: do}, {key: "k2", do: do}})
+	c.Assert(receive(c, backlog), jc.IsTrue)
+
+	// Clearing the backlog stops the backpressure.
+	r.Clear(nil)
+	c.Assert(receive(c, backlog), jc.IsFalse)
+	c.Assert(r.Backpressure(), jc.IsFalse)
+}
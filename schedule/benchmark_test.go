@@ -0,0 +1,50 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"fmt"
+	stdtesting "testing"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/schedule"
+)
+
+// unpooledClock hides WallClock's NewTimer method, so that each
+// call to Next allocates a new timer with After.
+type unpooledClock struct {
+	clock.Clock
+}
+
+// benchmarkNextChurn measures waiting on a schedule of 10k operations
+// whose earliest operation is repeatedly removed and added again.
+func benchmarkNextChurn(b *stdtesting.B, clock clock.Clock) {
+	const n = 10000
+	s := schedule.NewSchedule[string, operation](clock)
+	ops := make([]operation, n)
+	for i := range ops {
+		ops[i] = operation{
+			key:   fmt.Sprint(i),
+			delay: time.Hour + time.Duration(i)*time.Millisecond,
+		}
+		s.Add(ops[i])
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		op := ops[i%n]
+		s.Remove(op.key)
+		s.Add(op)
+		s.Next()
+	}
+}
+
+func BenchmarkNextChurnPooled(b *stdtesting.B) {
+	benchmarkNextChurn(b, clock.WallClock)
+}
+
+func BenchmarkNextChurnUnpooled(b *stdtesting.B) {
+	benchmarkNextChurn(b, unpooledClock{clock.WallClock})
+}
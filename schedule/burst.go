@@ -0,0 +1,215 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/logging"
+	"github.com/juju/errors"
+)
+
+// Burst describes a period during which operations became ready in a
+// Runner at a rate exceeding a BurstDetector's threshold.
+type Burst struct {
+	// Start is the start of the first check interval in
+	// which the rate exceeded the threshold.
+	Start time.Time
+
+	// Duration is the time for which the rate has exceeded the
+	// threshold: as of the check at which the burst was detected,
+	// or, once it has ended, its total duration.
+	Duration time.Duration
+
+	// Rate is the rate, in operations per second, at which operations
+	// became ready over the most recent check interval.
+	Rate float64
+
+	// Peak is the highest rate, in operations per second, over
+	// any check interval during the burst.
+	Peak float64
+}
+
+// BurstDetectorConfig holds the configuration for a BurstDetector.
+type BurstDetectorConfig[K comparable, O RunnableOperation[K]] struct {
+	// Clock is used to determine when to check the Runner.
+	Clock clock.Clock
+
+	// Runner is the Runner to watch.
+	Runner *Runner[K, O]
+
+	// Interval is the interval between checks. The rate at which
+	// operations become ready is measured over each interval.
+	Interval time.Duration
+
+	// Threshold is the rate, in operations per second, at which
+	// operations may become ready without being considered a burst.
+	Threshold float64
+
+	// Sustain is how long the rate must exceed Threshold before a
+	// burst is reported, so that brief spikes are ignored. If Sustain
+	// is zero, a burst is reported at the first check at which the
+	// rate exceeds Threshold.
+	Sustain time.Duration
+
+	// OnBurst is called when a burst is detected; e.g. to shed
+	// load or open a circuit breaker. It is called once for each
+	// burst, rather than at every check. OnBurst is called without
+	// any locks held, and so may call the Runner's methods.
+	OnBurst func(Burst)
+
+	// OnBurstEnd, if non-nil, is called when the rate no longer
+	// exceeds Threshold, after OnBurst has been called. It is called
+	// without any locks held, and so may call the Runner's methods.
+	OnBurstEnd func(Burst)
+
+	// Logger, if non-nil, is used to log bursts, as they are
+	// reported to OnBurst and OnBurstEnd.
+	Logger logging.Logger
+}
+
+// Validate checks that the config is valid.
+func (config BurstDetectorConfig[K, O]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Runner == nil {
+		return errors.NotValidf("nil Runner")
+	}
+	if config.Interval <= 0 {
+		return errors.NotValidf("non-positive Interval")
+	}
+	if config.Threshold <= 0 {
+		return errors.NotValidf("non-positive Threshold")
+	}
+	if config.Sustain < 0 {
+		return errors.NotValidf("negative Sustain")
+	}
+	if config.OnBurst == nil {
+		return errors.NotValidf("nil OnBurst")
+	}
+	return nil
+}
+
+// BurstDetector periodically measures the rate at which operations
+// become ready in a Runner, and reports bursts: periods in which the
+// rate exceeds a threshold for a sustained time, such as those caused
+// by many failing operations being retried at once.
+type BurstDetector[K comparable, O RunnableOperation[K]] struct {
+	config BurstDetectorConfig[K, O]
+	logger logging.Logger
+
+	// The following fields are only accessed by the loop goroutine.
+	//
+	// last and count are the time of, and the Runner's count of ready
+	// operations at, the previous check. burst holds the current
+	// burst, if bursting is true, and reported records whether it
+	// has been reported to OnBurst.
+	last     time.Time
+	count    uint64
+	burst    Burst
+	bursting bool
+	reported bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewBurstDetector constructs and starts a new BurstDetector with the
+// given configuration. The BurstDetector will continue to run until it
+// is killed.
+func NewBurstDetector[K comparable, O RunnableOperation[K]](config BurstDetectorConfig[K, O]) (*BurstDetector[K, O], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating burst detector config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &BurstDetector[K, O]{
+		config: config,
+		logger: logging.OrNop(config.Logger),
+		last:   config.Clock.Now(),
+		count:  config.Runner.readyCount(),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go d.loop()
+	return d, nil
+}
+
+// Kill stops the BurstDetector. Kill does not wait for the
+// BurstDetector to stop; use Wait for that.
+func (d *BurstDetector[K, O]) Kill() {
+	d.cancel()
+}
+
+// Wait waits for the BurstDetector to stop.
+func (d *BurstDetector[K, O]) Wait() error {
+	<-d.done
+	return nil
+}
+
+func (d *BurstDetector[K, O]) loop() {
+	defer close(d.done)
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-d.config.Clock.After(d.config.Interval):
+			d.check(d.config.Clock.Now())
+		}
+	}
+}
+
+// check measures the rate at which operations became ready since
+// the previous check, and reports any burst starting or ending.
+func (d *BurstDetector[K, O]) check(now time.Time) {
+	count := d.config.Runner.readyCount()
+	elapsed := now.Sub(d.last)
+	if elapsed <= 0 {
+		return
+	}
+	rate := float64(count-d.count) / elapsed.Seconds()
+	start := d.last
+	d.last, d.count = now, count
+
+	if rate <= d.config.Threshold {
+		if d.bursting && d.reported {
+			d.burst.Duration = start.Sub(d.burst.Start)
+			d.burst.Rate = rate
+			d.logger.Infof("burst ended after %v: %.2f operations/s", d.burst.Duration, rate)
+			if d.config.OnBurstEnd != nil {
+				d.config.OnBurstEnd(d.burst)
+			}
+		}
+		d.bursting, d.reported = false, false
+		return
+	}
+	if !d.bursting {
+		d.burst = Burst{Start: start}
+		d.bursting = true
+	}
+	d.burst.Duration = now.Sub(d.burst.Start)
+	d.burst.Rate = rate
+	if rate > d.burst.Peak {
+		d.burst.Peak = rate
+	}
+	if !d.reported && d.burst.Duration >= d.config.Sustain {
+		d.reported = true
+		d.logger.Warningf(
+			"burst for %v: %.2f operations/s, threshold %.2f",
+			d.burst.Duration, rate, d.config.Threshold,
+		)
+		d.config.OnBurst(d.burst)
+	}
+}
+
+// readyCount returns the number of operations that have become ready.
+func (r *Runner[K, O]) readyCount() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts.ready
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type burstSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&burstSuite{})
+
+func (*burstSuite) TestValidate(c *gc.C) {
+	_, err := schedule.NewBurstDetector(schedule.BurstDetectorConfig[string, *runnableOperation]{})
+	c.Assert(err, gc.ErrorMatches, "validating burst detector config: nil Clock not valid")
+}
+
+func (*burstSuite) TestRetryStorm(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, *runnableOperation]{Clock: clock})
+	c.Assert(err, jc.ErrorIsNil)
+	r, err := schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+		Schedule: s,
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			return schedule.ActionRetryNow
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Kill()
+
+	bursts := make(chan schedule.Burst, 1)
+	ended := make(chan schedule.Burst, 1)
+	d, err := schedule.NewBurstDetector(schedule.BurstDetectorConfig[string, *runnableOperation]{
+		Clock:     clock,
+		Runner:    r,
+		Interval:  time.Second,
+		Threshold: 10,
+		Sustain:   3 * time.Second,
+		OnBurst: func(b schedule.Burst) {
+			bursts <- b
+		},
+		OnBurstEnd: func(b schedule.Burst) {
+			ended <- b
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer d.Kill()
+
+	// k0 fails, and is retried immediately, until stopped.
+	stop := make(chan struct{})
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(time.Millisecond):
+			return errors.New("failed")
+		}
+	}})
+
+	b := advanceUntil(c, clock, bursts, time.Second)
+	c.Assert(b.Duration >= 3*time.Second, jc.IsTrue)
+	c.Assert(b.Rate > 10, jc.IsTrue)
+	c.Assert(b.Peak >= b.Rate, jc.IsTrue)
+	assertNotReceived(c, ended)
+
+	// The burst is reported only once.
+	clock.Advance(time.Second)
+	assertNotReceived(c, bursts)
+
+	close(stop)
+	waitUntil(c, "operation to succeed", func() bool {
+		stats := r.Stats()
+		return stats.Executed > stats.Failed
+	})
+	end := advanceUntil(c, clock, ended, time.Second)
+	c.Assert(end.Start, gc.Equals, b.Start)
+	c.Assert(end.Duration >= b.Duration, jc.IsTrue)
+	c.Assert(end.Rate <= 10, jc.IsTrue)
+	assertNotReceived(c, bursts)
+}
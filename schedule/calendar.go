@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// Recurrence computes the times of a recurring event.
+type Recurrence interface {
+	// Next returns the first time strictly after the specified
+	// time at which the event occurs.
+	Next(after time.Time) time.Time
+}
+
+// RecurrenceDelay is a type that can be embedded in an Operation to
+// implement the Delay() method, scheduling the operation for the next
+// time of a Recurrence.
+type RecurrenceDelay struct {
+	// Clock is used to determine the current time.
+	Clock clock.Clock
+
+	// Recurrence determines the time at which the operation will
+	// next be ready.
+	Recurrence Recurrence
+}
+
+// Delay is part of the Operation interface.
+func (d RecurrenceDelay) Delay() time.Duration {
+	now := d.Clock.Now()
+	return d.Recurrence.Next(now).Sub(now)
+}
+
+// Daily returns a Recurrence that occurs every day at the specified
+// wall-clock time of day in the specified location.
+//
+// On days where the time of day occurs twice, because clocks have gone
+// back, the recurrence occurs at the first instance only. On days where
+// the time of day does not occur, because clocks have gone forward, the
+// recurrence occurs at the time of day shifted forward by the length of
+// the gap; e.g. 02:30 becomes 03:30 when clocks go forward an hour at
+// 02:00. Use DailyWithPolicy to treat these days differently.
+func Daily(hour, minute int, loc *time.Location) Recurrence {
+	return DailyWithPolicy(hour, minute, loc, DSTPolicy{})
+}
+
+// DailyWithPolicy is like Daily, but resolves skipped and repeated
+// times of day according to the policy.
+func DailyWithPolicy(hour, minute int, loc *time.Location, policy DSTPolicy) Recurrence {
+	return weekly{allDays, hour, minute, loc, policy}
+}
+
+// Weekly returns a Recurrence that occurs every week on the specified
+// day, at the specified wall-clock time of day in the specified
+// location. The treatment of daylight saving transitions is the same
+// as for Daily.
+func Weekly(day time.Weekday, hour, minute int, loc *time.Location) Recurrence {
+	return WeeklyWithPolicy(day, hour, minute, loc, DSTPolicy{})
+}
+
+// WeeklyWithPolicy is like Weekly, but resolves skipped and repeated
+// times of day according to the policy.
+func WeeklyWithPolicy(day time.Weekday, hour, minute int, loc *time.Location, policy DSTPolicy) Recurrence {
+	return weekly{1 << uint(day), hour, minute, loc, policy}
+}
+
+const allDays = 1<<7 - 1
+
+// weekly is a Recurrence that occurs at a fixed wall-clock time of day,
+// on a set of days of the week.
+type weekly struct {
+	days         uint8 // bitmask of time.Weekday
+	hour, minute int
+	loc          *time.Location
+	policy       DSTPolicy
+}
+
+// Next is part of the Recurrence interface.
+func (w weekly) Next(after time.Time) time.Time {
+	local := after.In(w.loc)
+	year, month, day := local.Date()
+	// Start with the previous day, in case the time of day has
+	// been shifted into the following day by a DST gap; and look
+	// two weeks ahead, in case the only day's time is skipped.
+	for i := -1; i <= 14; i++ {
+		date := time.Date(year, month, day+i, 12, 0, 0, 0, w.loc)
+		if w.days&(1<<uint(date.Weekday())) == 0 {
+			continue
+		}
+		for _, t := range LocalTimes(year, month, day+i, w.hour, w.minute, w.loc, w.policy) {
+			if t.After(after) {
+				return t
+			}
+		}
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type calendarSuite struct {
+	coretesting.BaseSuite
+	berlin *time.Location
+}
+
+var _ = gc.Suite(&calendarSuite{})
+
+func (s *calendarSuite) SetUpSuite(c *gc.C) {
+	s.BaseSuite.SetUpSuite(c)
+	loc, err := time.LoadLocation("Europe/Berlin")
+	c.Assert(err, jc.ErrorIsNil)
+	s.berlin = loc
+}
+
+func (s *calendarSuite) date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, s.berlin)
+}
+
+func (s *calendarSuite) TestDaily(c *gc.C) {
+	r := schedule.Daily(2, 0, s.berlin)
+	s.assertNext(c, r, s.date(2015, 6, 1, 1, 0), s.date(2015, 6, 1, 2, 0))
+	s.assertNext(c, r, s.date(2015, 6, 1, 2, 0), s.date(2015, 6, 2, 2, 0))
+	s.assertNext(c, r, s.date(2015, 6, 1, 23, 0), s.date(2015, 6, 2, 2, 0))
+	// Month and year boundaries.
+	s.assertNext(c, r, s.date(2015, 6, 30, 3, 0), s.date(2015, 7, 1, 2, 0))
+	s.assertNext(c, r, s.date(2015, 12, 31, 3, 0), s.date(2016, 1, 1, 2, 0))
+}
+
+func (s *calendarSuite) TestDailyDSTForward(c *gc.C) {
+	// Clocks go forward from 02:00 to 03:00 on 2015-03-29.
+	r := schedule.Daily(2, 30, s.berlin)
+	next := r.Next(s.date(2015, 3, 29, 0, 0))
+	c.Assert(next.Equal(time.Date(2015, 3, 29, 1, 30, 0, 0, time.UTC)), jc.IsTrue)
+	c.Assert(next.Hour(), gc.Equals, 3)
+	s.assertNext(c, r, next, s.date(2015, 3, 30, 2, 30))
+
+	// Either side of the transition, the delay between
+	// occurrences is correctly reduced by the missing hour.
+	r = schedule.Daily(9, 0, s.berlin)
+	prev := s.date(2015, 3, 28, 9, 0)
+	c.Assert(r.Next(prev).Sub(prev), gc.Equals, 23*time.Hour)
+}
+
+func (s *calendarSuite) TestDailyDSTBack(c *gc.C) {
+	// Clocks go back from 03:00 to 02:00 on 2015-10-25.
+	r := schedule.Daily(2, 30, s.berlin)
+	first := r.Next(s.date(2015, 10, 25, 0, 0))
+	c.Assert(first.Equal(time.Date(2015, 10, 25, 0, 30, 0, 0, time.UTC)), jc.IsTrue)
+
+	// The repeated 02:30 does not recur.
+	s.assertNext(c, r, first, s.date(2015, 10, 26, 2, 30))
+
+	r = schedule.Daily(9, 0, s.berlin)
+	prev := s.date(2015, 10, 24, 9, 0)
+	c.Assert(r.Next(prev).Sub(prev), gc.Equals, 25*time.Hour)
+}
+
+func (s *calendarSuite) TestWeekly(c *gc.C) {
+	// 2015-06-01 is a Monday.
+	r := schedule.Weekly(time.Monday, 9, 0, s.berlin)
+	s.assertNext(c, r, s.date(2015, 6, 1, 8, 0), s.date(2015, 6, 1, 9, 0))
+	s.assertNext(c, r, s.date(2015, 6, 1, 9, 0), s.date(2015, 6, 8, 9, 0))
+	s.assertNext(c, r, s.date(2015, 6, 3, 12, 0), s.date(2015, 6, 8, 9, 0))
+	s.assertNext(c, r, s.date(2015, 5, 31, 23, 59), s.date(2015, 6, 1, 9, 0))
+}
+
+func (s *calendarSuite) TestRecurrenceDelay(c *gc.C) {
+	clock := coretesting.NewClock(s.date(2015, 6, 1, 1, 0))
+	d := schedule.RecurrenceDelay{
+		Clock:      clock,
+		Recurrence: schedule.Daily(2, 0, s.berlin),
+	}
+	c.Assert(d.Delay(), gc.Equals, time.Hour)
+	clock.Advance(90 * time.Minute)
+	c.Assert(d.Delay(), gc.Equals, 23*time.Hour+30*time.Minute)
+}
+
+func (s *calendarSuite) assertNext(c *gc.C, r schedule.Recurrence, after, expect time.Time) {
+	next := r.Next(after)
+	c.Assert(next.Equal(expect), jc.IsTrue, gc.Commentf("next after %s: got %s, expected %s", after, next, expect))
+}
+
+func (s *calendarSuite) TestWindowConstrain(c *gc.C) {
+	w := schedule.Window{
+		Start:    schedule.Daily(2, 0, s.berlin),
+		Duration: 2 * time.Hour,
+	}
+	for _, t := range []time.Time{
+		s.date(2015, 6, 1, 2, 0),
+		s.date(2015, 6, 1, 3, 59),
+	} {
+		c.Assert(w.Contains(t), jc.IsTrue)
+		c.Assert(w.Constrain(t), gc.Equals, t)
+	}
+	c.Assert(w.Contains(s.date(2015, 6, 1, 4, 0)), jc.IsFalse)
+	c.Assert(w.Constrain(s.date(2015, 6, 1, 4, 0)), gc.Equals, s.date(2015, 6, 2, 2, 0))
+	c.Assert(w.Constrain(s.date(2015, 6, 1, 1, 0)), gc.Equals, s.date(2015, 6, 1, 2, 0))
+}
+
+func (s *calendarSuite) TestWindowedOperation(c *gc.C) {
+	clock := coretesting.NewClock(s.date(2015, 6, 1, 1, 0))
+	sched := schedule.NewSchedule[string, windowedOperation](clock)
+	op := windowedOperation{
+		operation: operation{"k0", "v0", time.Minute},
+		windows: []schedule.Window{{
+			Start:    schedule.Daily(2, 0, s.berlin),
+			Duration: time.Hour,
+		}, {
+			Start:    schedule.Daily(12, 0, s.berlin),
+			Duration: time.Hour,
+		}},
+	}
+
+	// The operation's delay elapses outside of its windows,
+	// so it is deferred to the start of the next one.
+	when := sched.Add(op)
+	c.Assert(when, gc.Equals, s.date(2015, 6, 1, 2, 0))
+
+	// If Ready isn't called until after the window has
+	// closed, the operation is deferred to the next one.
+	clock.Advance(2 * time.Hour)
+	c.Assert(sched.Ready(clock.Now()), gc.HasLen, 0)
+	clock.Advance(9*time.Hour - time.Nanosecond)
+	c.Assert(sched.Ready(clock.Now()), gc.HasLen, 0)
+	clock.Advance(time.Nanosecond)
+	c.Assert(sched.Ready(clock.Now()), jc.DeepEquals, []windowedOperation{op})
+
+	// Within a window, the delay applies as usual.
+	c.Assert(sched.Add(op), gc.Equals, s.date(2015, 6, 1, 12, 1))
+}
+
+type windowedOperation struct {
+	operation
+	windows []schedule.Window
+}
+
+func (o windowedOperation) Windows() []schedule.Window {
+	return o.windows
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// CoalescePolicy determines how a Schedule handles the addition of an
+// operation whose key is already scheduled.
+type CoalescePolicy int
+
+const (
+	// CoalesceNone is the default policy: adding an operation whose
+	// key is already scheduled causes a panic.
+	CoalesceNone CoalescePolicy = iota
+
+	// CoalesceKeepEarliest keeps whichever of the existing and new
+	// operations is scheduled for the earlier time.
+	CoalesceKeepEarliest
+
+	// CoalesceKeepLatest keeps whichever of the existing and new
+	// operations is scheduled for the later time.
+	CoalesceKeepLatest
+
+	// CoalesceReplaceValue replaces the existing operation with the
+	// new one, but leaves the scheduled time unchanged. The new
+	// operation's Delay method is not called.
+	CoalesceReplaceValue
+
+	// CoalesceExtendDelay replaces the existing operation with the
+	// new one, and reschedules it for the current time plus the new
+	// operation's delay, even if that is earlier than the existing
+	// operation's time. Repeated triggers thus keep pushing the
+	// operation back, until they stop for long enough.
+	CoalesceExtendDelay
+)
+
+// String returns a string representation of the policy.
+func (p CoalescePolicy) String() string {
+	switch p {
+	case CoalesceNone:
+		return "none"
+	case CoalesceKeepEarliest:
+		return "keep-earliest"
+	case CoalesceKeepLatest:
+		return "keep-latest"
+	case CoalesceReplaceValue:
+		return "replace-value"
+	case CoalesceExtendDelay:
+		return "extend-delay"
+	}
+	return fmt.Sprintf("CoalescePolicy(%d)", int(p))
+}
+
+func (p CoalescePolicy) valid() bool {
+	return p >= CoalesceNone && p <= CoalesceExtendDelay
+}
+
+// coalesce determines the operation and time to keep, given the
+// existing operation and time, and the new operation. The when
+// function, which computes the new operation's scheduled time, is
+// called only if the policy requires it.
+func coalesce[K comparable, O Operation[K]](
+	p CoalescePolicy,
+	existing O, existingTime time.Time,
+	op O, when func() time.Time,
+) (O, time.Time) {
+	switch p {
+	case CoalesceKeepEarliest:
+		if t := when(); t.Before(existingTime) {
+			return op, t
+		}
+		return existing, existingTime
+	case CoalesceKeepLatest:
+		if t := when(); t.After(existingTime) {
+			return op, t
+		}
+		return existing, existingTime
+	case CoalesceReplaceValue:
+		return op, existingTime
+	case CoalesceExtendDelay:
+		return op, when()
+	}
+	panic(fmt.Sprintf("unexpected coalesce policy %v", p))
+}
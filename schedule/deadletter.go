@@ -0,0 +1,185 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// failureHistory is the maximum number of failed executions
+// recorded for each operation; see DeadLetter.Failures.
+const failureHistory = 10
+
+// Failure describes a failed execution of an operation.
+type Failure struct {
+	// Attempt is the number of the execution; see Execution.Attempt.
+	Attempt int
+
+	// Started and Finished are the times at which the
+	// execution started and finished.
+	Started  time.Time
+	Finished time.Time
+
+	// Err is the error returned by the execution, or an
+	// error describing its panic.
+	Err error
+}
+
+// DeadLetterReason describes why an operation was given up on.
+type DeadLetterReason int
+
+const (
+	// DeadLetterParked is the reason for operations parked
+	// by the error policy.
+	DeadLetterParked DeadLetterReason = iota
+
+	// DeadLetterDropped is the reason for operations
+	// dropped by the error policy.
+	DeadLetterDropped
+
+	// DeadLetterExpired is the reason for operations dropped
+	// on exceeding the Runner's MaxLifetime.
+	DeadLetterExpired
+)
+
+// String returns a string representation of the reason.
+func (r DeadLetterReason) String() string {
+	switch r {
+	case DeadLetterParked:
+		return "parked"
+	case DeadLetterDropped:
+		return "dropped"
+	case DeadLetterExpired:
+		return "expired"
+	}
+	return fmt.Sprintf("DeadLetterReason(%d)", int(r))
+}
+
+// DeadLetter describes an operation that a Runner has given up on,
+// after it failed: one that was parked, or dropped in place of being
+// retried. See Runner.DeadLetters.
+type DeadLetter[O any] struct {
+	// Op is the operation.
+	Op O
+
+	// Reason is the reason that the operation was given up on.
+	Reason DeadLetterReason
+
+	// Time is the time at which the operation was given up on.
+	Time time.Time
+
+	// Failures holds the operation's consecutive failed executions,
+	// ending with the one after which it was given up on, in the
+	// order that they finished. Only the most recent failures are
+	// recorded, up to 10; the first's Attempt indicates how many
+	// have been forgotten.
+	Failures []Failure
+}
+
+// DeadLetters returns the operations that the Runner has given up on,
+// in the order that it gave up on them: the parked operations, and if
+// the Runner's DeadLetterSize is positive, the most recently dropped
+// operations. The operations may be inspected, and resubmitted with
+// Resubmit.
+func (r *Runner[K, O]) DeadLetters() []DeadLetter[O] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deadLetters()
+}
+
+// deadLetters returns the Runner's dead letters, as described for
+// DeadLetters. deadLetters must be called with r.mu held.
+func (r *Runner[K, O]) deadLetters() []DeadLetter[O] {
+	letters := make([]DeadLetter[O], 0, len(r.parked)+len(r.dropped))
+	letters = append(letters, r.parked...)
+	letters = append(letters, r.dropped...)
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].Time.Before(letters[j].Time)
+	})
+	return letters
+}
+
+// Resubmit removes the operation with the specified key from the dead
+// letters, parked or dropped, and adds it back to the Runner's schedule,
+// as if by TryAdd; its failure history is forgotten. Resubmit reports
+// whether or not the operation was resubmitted; if there is no dead
+// letter with the key, or the operation cannot be added, Resubmit
+// returns false and the dead letter is kept.
+func (r *Runner[K, O]) Resubmit(key K) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	letters := &r.parked
+	letter, ok := removeDeadLetter(letters, key)
+	if !ok {
+		letters = &r.dropped
+		if letter, ok = removeDeadLetter(letters, key); !ok {
+			return false
+		}
+	}
+	if _, err := r.schedule.TryAdd(letter.Op); err != nil {
+		restoreDeadLetter(letters, letter)
+		return false
+	}
+	r.notify()
+	return true
+}
+
+// recordFailure returns the failure history of an operation, from
+// its previous consecutive failures, with the failure of the execution
+// added.
+func recordFailure[K comparable](previous []Failure, exec Execution[K], finished time.Time, err error) []Failure {
+	failures := make([]Failure, 0, failureHistory)
+	if n := len(previous) - (failureHistory - 1); n > 0 {
+		previous = previous[n:]
+	}
+	failures = append(failures, previous...)
+	return append(failures, Failure{
+		Attempt:  exec.Attempt,
+		Started:  exec.Started,
+		Finished: finished,
+		Err:      err,
+	})
+}
+
+// addDropped records an operation dropped by the error policy, or on
+// exceeding MaxLifetime, in the dead letters, if they are enabled,
+// replacing any earlier dead letter with the same key and discarding
+// the oldest in excess of DeadLetterSize. addDropped must be called
+// with r.mu held.
+func (r *Runner[K, O]) addDropped(letter DeadLetter[O]) {
+	if r.config.DeadLetterSize <= 0 {
+		return
+	}
+	removeDeadLetter(&r.dropped, letter.Op.Key())
+	if len(r.dropped) == r.config.DeadLetterSize {
+		r.dropped[0] = DeadLetter[O]{}
+		r.dropped = r.dropped[1:]
+	}
+	r.dropped = append(r.dropped, letter)
+}
+
+// removeDeadLetter removes the dead letter with the
+// specified key, and reports whether there was one.
+func removeDeadLetter[K comparable, O Operation[K]](letters *[]DeadLetter[O], key K) (DeadLetter[O], bool) {
+	for i, letter := range *letters {
+		if letter.Op.Key() == key {
+			*letters = append((*letters)[:i], (*letters)[i+1:]...)
+			return letter, true
+		}
+	}
+	return DeadLetter[O]{}, false
+}
+
+// restoreDeadLetter returns a dead letter removed by removeDeadLetter
+// to the letters, in order of time.
+func restoreDeadLetter[O any](letters *[]DeadLetter[O], letter DeadLetter[O]) {
+	i := sort.Search(len(*letters), func(i int) bool {
+		return (*letters)[i].Time.After(letter.Time)
+	})
+	*letters = append(*letters, DeadLetter[O]{})
+	copy((*letters)[i+1:], (*letters)[i:])
+	(*letters)[i] = letter
+}
@@ -3,7 +3,13 @@
 
 package schedule
 
-import "time"
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/duration"
+	"github.com/axw/juju-time/jitter"
+)
 
 // minRetryDelay is the minimum delay to apply
 // to operation retries; this does not apply to
@@ -15,20 +21,376 @@ const minRetryDelay = 30 * time.Second
 // up to this ceiling.
 const maxRetryDelay = 30 * time.Minute
 
+// defaultBackoffFactor is the factor by which retry
+// delays are multiplied by default.
+const defaultBackoffFactor = 2
+
+// CappedOperation may be implemented by an Operation to override the
+// maximum delay applied to it by a Schedule, irrespective of how the
+// operation computes its delay. For example, an operation embedding
+// ExponentialBackoff may implement CappedOperation to cap its delay
+// based on the operation's kind, without configuring each instance.
+type CappedOperation interface {
+	// MaxDelay returns the maximum delay to apply to the operation.
+	// If MaxDelay returns a non-positive value, the delay is not
+	// capped.
+	MaxDelay() time.Duration
+}
+
+// operationDelay returns the delay for the operation, capped by
+// MaxDelay if the operation implements CappedOperation.
+func operationDelay[K comparable](op Operation[K]) time.Duration {
+	delay := op.Delay()
+	if capped, ok := op.(CappedOperation); ok {
+		if max := capped.MaxDelay(); max > 0 && delay > max {
+			delay = max
+		}
+	}
+	return delay
+}
+
+// DelaySinceOperation may be implemented by an Operation to measure its
+// delay from a time other than when it is added to the schedule. This
+// may be used, for example, to ensure that an operation which is removed
+// and re-added does not have its scheduled time pushed ever later.
+type DelaySinceOperation interface {
+	// DelaySince returns the time from which the operation's delay
+	// is measured, given the current time.
+	DelaySince(now time.Time) time.Time
+}
+
+// FirstScheduled is a type that can be embedded in an Operation to
+// implement DelaySinceOperation, measuring the operation's delay from
+// the time it was first added to a schedule.
+type FirstScheduled struct {
+	scheduled bool
+	first     time.Time
+}
+
+// DelaySince is part of the DelaySinceOperation interface.
+func (f *FirstScheduled) DelaySince(now time.Time) time.Time {
+	if !f.scheduled {
+		f.scheduled = true
+		f.first = now
+	}
+	return f.first
+}
+
+// Reset forgets the time that the operation was first scheduled, so
+// that the next time it is added its delay is measured from then.
+func (f *FirstScheduled) Reset() {
+	*f = FirstScheduled{}
+}
+
+// delayBase returns the time from which the operation's delay should
+// be measured, given the current time.
+func delayBase(op interface{}, now time.Time) time.Time {
+	if ds, ok := op.(DelaySinceOperation); ok {
+		return ds.DelaySince(now)
+	}
+	return now
+}
+
 // ExponentialBackoff is a type that can be embedded in an Operation to
-// implement the Delay() method, providing truncated binary exponential
-// backoff for operations that may be rescheduled.
-type ExponentialBackoff time.Duration
+// implement the Delay() method, providing truncated exponential backoff
+// for operations that may be rescheduled.
+//
+// The zero value provides truncated binary exponential backoff: the first
+// attempt is not delayed, the first retry is delayed by 30 seconds, and
+// each subsequent retry's delay is doubled, up to a maximum of 30 minutes.
+//
+// ExponentialBackoff was formerly a time.Duration holding the current
+// delay; code converting a duration with ExponentialBackoff(d) should
+// instead use ExponentialBackoff{Initial: d}.
+type ExponentialBackoff struct {
+	// Initial is the delay to apply to the first attempt.
+	Initial time.Duration
+
+	// Min is the minimum delay to apply to retries, and the delay
+	// for the first retry if Initial is smaller. If Min is zero,
+	// 30 seconds is used. If Min exceeds the maximum, the maximum
+	// is used.
+	Min time.Duration
+
+	// Max is the maximum delay to apply to retries. If Max is zero,
+	// 30 minutes is used. Max may be set differently for individual
+	// operations; see also CappedOperation.
+	Max time.Duration
+
+	// Factor is the factor by which each retry's delay is multiplied
+	// to compute the next. If Factor is zero, 2 is used; factors less
+	// than 1 are treated as 1.
+	Factor float64
+
+	// Clock, if non-nil, is used to record the time of the first
+	// attempt, for ElapsedSinceFirst. If Clock is nil, WallClock
+	// is used.
+	Clock clock.Clock
+
+	// Jitter, if non-nil, is applied to each delay returned by Delay,
+	// e.g. a function calling jitter.FullJitter. Jitter does not
+	// affect the progression of delays.
+	Jitter func(time.Duration) time.Duration
 
+	attempts int
+	first    time.Time
+	current  time.Duration
+}
+
+// Delay is part of the Operation interface.
 func (e *ExponentialBackoff) Delay() time.Duration {
-	current := time.Duration(*e)
-	if time.Duration(*e) < minRetryDelay {
-		*e = ExponentialBackoff(minRetryDelay)
+	if e.attempts == 0 {
+		e.first = e.clock().Now()
+		e.current = e.Initial
+	}
+	e.attempts++
+	current := e.current
+	if min := e.min(); e.current < min {
+		e.current = min
 	} else {
-		*e *= 2
-		if time.Duration(*e) > maxRetryDelay {
-			*e = ExponentialBackoff(maxRetryDelay)
-		}
+		e.current = e.next(e.current)
+	}
+	if e.Jitter != nil {
+		current = e.Jitter(current)
 	}
 	return current
 }
+
+// Attempts returns the number of attempts for which the backoff has
+// been used; that is, the number of times Delay has been called since
+// the backoff was created or last reset.
+func (e *ExponentialBackoff) Attempts() int {
+	return e.attempts
+}
+
+// ElapsedSinceFirst returns the time elapsed since the first attempt,
+// or zero if there have been no attempts.
+func (e *ExponentialBackoff) ElapsedSinceFirst() time.Duration {
+	if e.attempts == 0 {
+		return 0
+	}
+	return e.clock().Now().Sub(e.first)
+}
+
+// Reset resets the backoff to its initial state, so that the next
+// attempt is delayed by Initial, and the attempt count starts again
+// from zero. The configuration fields are unchanged.
+func (e *ExponentialBackoff) Reset() {
+	e.attempts = 0
+	e.first = time.Time{}
+	e.current = 0
+}
+
+func (e *ExponentialBackoff) clock() clock.Clock {
+	if e.Clock == nil {
+		return clock.WallClock
+	}
+	return e.Clock
+}
+
+// next returns the delay following d.
+func (e *ExponentialBackoff) next(d time.Duration) time.Duration {
+	factor := e.Factor
+	if factor == 0 {
+		factor = defaultBackoffFactor
+	} else if factor < 1 {
+		factor = 1
+	}
+	if next := duration.Scale(d, factor); next < e.max() {
+		return next
+	}
+	return e.max()
+}
+
+func (e *ExponentialBackoff) min() time.Duration {
+	min := e.Min
+	if min == 0 {
+		min = minRetryDelay
+	}
+	if max := e.max(); min > max {
+		return max
+	}
+	return min
+}
+
+func (e *ExponentialBackoff) max() time.Duration {
+	if e.Max == 0 {
+		return maxRetryDelay
+	}
+	return e.Max
+}
+
+// DecorrelatedBackoff is a type that can be embedded in an Operation to
+// implement the Delay() method, providing "decorrelated jitter" backoff:
+// each retry's delay is chosen randomly between Min and three times the
+// previous delay, up to Max; see jitter.Decorrelated. Compared with
+// jittered exponential backoff, delays grow similarly on average, but
+// operations that fail together spread out more quickly.
+//
+// As with ExponentialBackoff, the zero value does not delay the first
+// attempt, and uses a minimum of 30 seconds and a maximum of 30 minutes
+// for retries.
+type DecorrelatedBackoff struct {
+	// Initial is the delay to apply to the first attempt.
+	Initial time.Duration
+
+	// Min is the minimum delay to apply to retries. If Min is zero,
+	// 30 seconds is used.
+	Min time.Duration
+
+	// Max is the maximum delay to apply to retries. If Max is zero,
+	// 30 minutes is used.
+	Max time.Duration
+
+	// Clock, if non-nil, is used to record the time of the first
+	// attempt, for ElapsedSinceFirst. If Clock is nil, WallClock
+	// is used.
+	Clock clock.Clock
+
+	// Source, if non-nil, is the source of random numbers used to
+	// choose delays; tests may supply a seeded one, to make delays
+	// reproducible. If Source is nil, the math/rand package's shared
+	// source is used.
+	Source jitter.Source
+
+	attempts int
+	first    time.Time
+	previous time.Duration
+}
+
+// Delay is part of the Operation interface.
+func (e *DecorrelatedBackoff) Delay() time.Duration {
+	e.attempts++
+	if e.attempts == 1 {
+		e.first = e.clock().Now()
+		return e.Initial
+	}
+	max := e.Max
+	if max == 0 {
+		max = maxRetryDelay
+	}
+	min := e.Min
+	if min == 0 {
+		min = minRetryDelay
+	}
+	e.previous = jitter.Decorrelated(min, e.previous, max, e.Source)
+	return e.previous
+}
+
+// Attempts returns the number of attempts for which the backoff has
+// been used; that is, the number of times Delay has been called since
+// the backoff was created or last reset.
+func (e *DecorrelatedBackoff) Attempts() int {
+	return e.attempts
+}
+
+// ElapsedSinceFirst returns the time elapsed since the first attempt,
+// or zero if there have been no attempts.
+func (e *DecorrelatedBackoff) ElapsedSinceFirst() time.Duration {
+	if e.attempts == 0 {
+		return 0
+	}
+	return e.clock().Now().Sub(e.first)
+}
+
+// Reset resets the backoff to its initial state. The configuration
+// fields are unchanged.
+func (e *DecorrelatedBackoff) Reset() {
+	e.attempts = 0
+	e.first = time.Time{}
+	e.previous = 0
+}
+
+func (e *DecorrelatedBackoff) clock() clock.Clock {
+	if e.Clock == nil {
+		return clock.WallClock
+	}
+	return e.Clock
+}
+
+// LinearBackoff is a type that can be embedded in an Operation to
+// implement the Delay() method, providing linear backoff: each retry's
+// delay is Step longer than the previous, up to Max.
+//
+// The zero value does not delay the first attempt, delays the first
+// retry by 30 seconds, and each subsequent retry by 30 seconds more,
+// up to a maximum of 30 minutes.
+type LinearBackoff struct {
+	// Initial is the delay to apply to the first attempt.
+	Initial time.Duration
+
+	// Min is the delay for the first retry. If Min is zero,
+	// 30 seconds is used.
+	Min time.Duration
+
+	// Step is the amount by which each retry's delay exceeds the
+	// previous. If Step is zero, Min is used.
+	Step time.Duration
+
+	// Max is the maximum delay to apply to retries. If Max is zero,
+	// 30 minutes is used.
+	Max time.Duration
+
+	// Clock, if non-nil, is used to record the time of the first
+	// attempt, for ElapsedSinceFirst. If Clock is nil, WallClock
+	// is used.
+	Clock clock.Clock
+
+	attempts int
+	first    time.Time
+}
+
+// Delay is part of the Operation interface.
+func (e *LinearBackoff) Delay() time.Duration {
+	e.attempts++
+	if e.attempts == 1 {
+		e.first = e.clock().Now()
+		return e.Initial
+	}
+	min := e.Min
+	if min == 0 {
+		min = minRetryDelay
+	}
+	step := e.Step
+	if step == 0 {
+		step = min
+	}
+	max := e.Max
+	if max == 0 {
+		max = maxRetryDelay
+	}
+	if d := duration.Add(min, duration.Mul(step, int64(e.attempts-2))); d < max {
+		return d
+	}
+	return max
+}
+
+// Attempts returns the number of attempts for which the backoff has
+// been used; that is, the number of times Delay has been called since
+// the backoff was created or last reset.
+func (e *LinearBackoff) Attempts() int {
+	return e.attempts
+}
+
+// ElapsedSinceFirst returns the time elapsed since the first attempt,
+// or zero if there have been no attempts.
+func (e *LinearBackoff) ElapsedSinceFirst() time.Duration {
+	if e.attempts == 0 {
+		return 0
+	}
+	return e.clock().Now().Sub(e.first)
+}
+
+// Reset resets the backoff to its initial state. The configuration
+// fields are unchanged.
+func (e *LinearBackoff) Reset() {
+	e.attempts = 0
+	e.first = time.Time{}
+}
+
+func (e *LinearBackoff) clock() clock.Clock {
+	if e.Clock == nil {
+		return clock.WallClock
+	}
+	return e.Clock
+}
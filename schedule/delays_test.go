@@ -0,0 +1,101 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	jittertesting "github.com/axw/juju-time/jitter/testing"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type delaysSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&delaysSuite{})
+
+func (*delaysSuite) TestExponentialBackoffJitter(c *gc.C) {
+	b := schedule.ExponentialBackoff{
+		Initial: time.Second,
+		Min:     time.Second,
+		Clock:   coretesting.NewClock(time.Time{}),
+		Jitter: func(d time.Duration) time.Duration {
+			return d / 2
+		},
+	}
+	// Jitter applies to each delay, but not to the progression.
+	c.Assert(b.Delay(), gc.Equals, 500*time.Millisecond)
+	c.Assert(b.Delay(), gc.Equals, time.Second)
+	c.Assert(b.Delay(), gc.Equals, 2*time.Second)
+}
+
+func (*delaysSuite) TestDecorrelatedBackoff(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	newBackoff := func() *schedule.DecorrelatedBackoff {
+		return &schedule.DecorrelatedBackoff{
+			Min:    time.Second,
+			Max:    time.Minute,
+			Clock:  clock,
+			Source: jittertesting.NewSource(1),
+		}
+	}
+	b := newBackoff()
+	c.Assert(b.Delay(), gc.Equals, time.Duration(0))
+	prev := time.Second
+	var delays []time.Duration
+	for i := 0; i < 20; i++ {
+		d := b.Delay()
+		c.Assert(d >= time.Second && d <= 3*prev && d <= time.Minute, gc.Equals, true, gc.Commentf("%v", d))
+		prev = d
+		delays = append(delays, d)
+	}
+	c.Assert(b.Attempts(), gc.Equals, 21)
+
+	// The same seed produces the same delays.
+	b = newBackoff()
+	b.Delay()
+	for _, d := range delays {
+		c.Assert(b.Delay(), gc.Equals, d)
+	}
+
+	b.Reset()
+	c.Assert(b.Attempts(), gc.Equals, 0)
+	c.Assert(b.Delay(), gc.Equals, time.Duration(0))
+}
+
+func (*delaysSuite) TestLinearBackoff(c *gc.C) {
+	b := schedule.LinearBackoff{
+		Initial: time.Second,
+		Min:     10 * time.Second,
+		Step:    5 * time.Second,
+		Max:     22 * time.Second,
+		Clock:   coretesting.NewClock(time.Time{}),
+	}
+	for _, expect := range []time.Duration{
+		time.Second,
+		10 * time.Second,
+		15 * time.Second,
+		20 * time.Second,
+		22 * time.Second,
+		22 * time.Second,
+	} {
+		c.Assert(b.Delay(), gc.Equals, expect)
+	}
+	c.Assert(b.Attempts(), gc.Equals, 6)
+	b.Reset()
+	c.Assert(b.Delay(), gc.Equals, time.Second)
+
+	// The zero value steps by 30 seconds, to 30 minutes.
+	var zero schedule.LinearBackoff
+	c.Assert(zero.Delay(), gc.Equals, time.Duration(0))
+	c.Assert(zero.Delay(), gc.Equals, 30*time.Second)
+	c.Assert(zero.Delay(), gc.Equals, time.Minute)
+	for i := 0; i < 100; i++ {
+		zero.Delay()
+	}
+	c.Assert(zero.Delay(), gc.Equals, 30*time.Minute)
+}
@@ -0,0 +1,181 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timing"
+	"github.com/juju/errors"
+)
+
+// LateDelivery describes an operation delivered later than a
+// DeliveryTracker's tolerance allows.
+type LateDelivery[K comparable] struct {
+	// Key is the operation's key.
+	Key K
+
+	// TraceID is the operation's trace ID, if it implements
+	// TracedOperation. Deliveries recorded directly with Record
+	// have no trace ID.
+	TraceID string
+
+	// Scheduled is the time for which the operation was scheduled.
+	Scheduled time.Time
+
+	// Delivered is the time at which the operation was delivered.
+	Delivered time.Time
+
+	// Lag is the time between Scheduled and Delivered.
+	Lag time.Duration
+}
+
+// DeliveryReport summarises the lag between the times for which
+// operations were scheduled and the times at which they were delivered,
+// as recorded by a DeliveryTracker.
+type DeliveryReport struct {
+	// Count is the number of deliveries recorded.
+	Count uint64
+
+	// Late is the number of deliveries whose lag exceeded
+	// the tolerance.
+	Late uint64
+
+	// Tolerance is the tracker's tolerance.
+	Tolerance time.Duration
+
+	// Min, Mean and Max are the shortest, mean and longest lags.
+	Min, Mean, Max time.Duration
+
+	// P50, P90, P99 and P999 are estimates of the 50th, 90th, 99th
+	// and 99.9th percentiles of the lags, within the precision of
+	// the tracker's histogram.
+	P50, P90, P99, P999 time.Duration
+}
+
+// DeliveryTrackerConfig holds the configuration for a DeliveryTracker.
+type DeliveryTrackerConfig[K comparable] struct {
+	// Tolerance is the lag, between the time for which an operation
+	// was scheduled and the time at which it was delivered, beyond
+	// which the delivery is late.
+	Tolerance time.Duration
+
+	// OnLate, if non-nil, is called with each late delivery. OnLate
+	// is called with the lock of the Schedule or Runner that delivered
+	// the operation held, and so must not call its methods.
+	OnLate func(LateDelivery[K])
+
+	// Precision is the precision of the histogram in which lags are
+	// recorded; see timing.HistogramConfig.
+	Precision int
+}
+
+// Validate checks that the config is valid.
+func (config DeliveryTrackerConfig[K]) Validate() error {
+	if config.Tolerance < 0 {
+		return errors.NotValidf("negative Tolerance")
+	}
+	return errors.Trace(timing.HistogramConfig{
+		Clock:     clock.WallClock,
+		Precision: config.Precision,
+	}.Validate())
+}
+
+// DeliveryTracker records the lag between the times for which
+// operations were scheduled and the times at which they were delivered:
+// returned by a Schedule's Ready, or started by a Runner, according to
+// which is configured with the tracker. A DeliveryTracker may be used
+// to verify soft real-time expectations, by reporting percentiles of
+// the lags, and flagging deliveries that exceed a tolerance.
+//
+// DeliveryTracker's methods are safe for concurrent use.
+type DeliveryTracker[K comparable] struct {
+	config DeliveryTrackerConfig[K]
+	lags   *timing.Histogram
+
+	mu   sync.Mutex
+	late uint64
+}
+
+// NewDeliveryTracker returns a new DeliveryTracker with the given
+// configuration, with no deliveries recorded.
+func NewDeliveryTracker[K comparable](config DeliveryTrackerConfig[K]) (*DeliveryTracker[K], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating delivery tracker config")
+	}
+	// The histogram's clock is only used by Since,
+	// which the tracker does not call.
+	lags, err := timing.NewHistogram(timing.HistogramConfig{
+		Clock:     clock.WallClock,
+		Precision: config.Precision,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &DeliveryTracker[K]{config: config, lags: lags}, nil
+}
+
+// Record records the delivery of the operation with the specified key,
+// scheduled for one time and delivered at another, calling OnLate if
+// the delivery is late. Deliveries earlier than scheduled are recorded
+// with no lag.
+func (t *DeliveryTracker[K]) Record(key K, scheduled, delivered time.Time) {
+	t.record(key, "", scheduled, delivered)
+}
+
+// record is like Record, reporting the trace ID of late deliveries.
+func (t *DeliveryTracker[K]) record(key K, traceID string, scheduled, delivered time.Time) {
+	lag := delivered.Sub(scheduled)
+	t.lags.Record(lag)
+	if lag <= t.config.Tolerance {
+		return
+	}
+	t.mu.Lock()
+	t.late++
+	t.mu.Unlock()
+	if t.config.OnLate != nil {
+		t.config.OnLate(LateDelivery[K]{
+			Key:       key,
+			TraceID:   traceID,
+			Scheduled: scheduled,
+			Delivered: delivered,
+			Lag:       lag,
+		})
+	}
+}
+
+// Report returns a summary of the deliveries recorded.
+func (t *DeliveryTracker[K]) Report() DeliveryReport {
+	t.mu.Lock()
+	late := t.late
+	t.mu.Unlock()
+	return DeliveryReport{
+		Count:     t.lags.Count(),
+		Late:      late,
+		Tolerance: t.config.Tolerance,
+		Min:       t.lags.Min(),
+		Mean:      t.lags.Mean(),
+		Max:       t.lags.Max(),
+		P50:       t.lags.Percentile(50),
+		P90:       t.lags.Percentile(90),
+		P99:       t.lags.Percentile(99),
+		P999:      t.lags.Percentile(99.9),
+	}
+}
+
+// Percentile returns an estimate of the lag below or at which the
+// specified percentage of deliveries fall.
+func (t *DeliveryTracker[K]) Percentile(p float64) time.Duration {
+	return t.lags.Percentile(p)
+}
+
+// Reset discards all recorded deliveries.
+func (t *DeliveryTracker[K]) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lags.Reset()
+	t.late = 0
+}
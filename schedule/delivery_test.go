@@ -0,0 +1,163 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type deliverySuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&deliverySuite{})
+
+func (*deliverySuite) TestValidate(c *gc.C) {
+	_, err := schedule.NewDeliveryTracker(schedule.DeliveryTrackerConfig[string]{Tolerance: -1})
+	c.Assert(err, gc.ErrorMatches, "validating delivery tracker config: negative Tolerance not valid")
+	_, err = schedule.NewDeliveryTracker(schedule.DeliveryTrackerConfig[string]{Precision: 11})
+	c.Assert(err, gc.ErrorMatches, "validating delivery tracker config: Precision 11 not valid")
+}
+
+func (*deliverySuite) TestReport(c *gc.C) {
+	var late []schedule.LateDelivery[string]
+	t, err := schedule.NewDeliveryTracker(schedule.DeliveryTrackerConfig[string]{
+		Tolerance: 100 * time.Millisecond,
+		OnLate: func(d schedule.LateDelivery[string]) {
+			late = append(late, d)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 99; i++ {
+		t.Record("on-time", t0, t0.Add(10*time.Millisecond))
+	}
+	t.Record("late", t0, t0.Add(time.Second))
+	t.Record("early", t0, t0.Add(-time.Second))
+
+	c.Assert(late, jc.DeepEquals, []schedule.LateDelivery[string]{{
+		Key:       "late",
+		Scheduled: t0,
+		Delivered: t0.Add(time.Second),
+		Lag:       time.Second,
+	}})
+	report := t.Report()
+	c.Assert(report.Count, gc.Equals, uint64(101))
+	c.Assert(report.Late, gc.Equals, uint64(1))
+	c.Assert(report.Tolerance, gc.Equals, 100*time.Millisecond)
+	c.Assert(report.Min, gc.Equals, time.Duration(0))
+	c.Assert(report.Max, gc.Equals, time.Second)
+	assertApprox(c, report.P50, 10*time.Millisecond)
+	assertApprox(c, report.P99, 10*time.Millisecond)
+	assertApprox(c, report.P999, time.Second)
+	c.Assert(t.Percentile(100), gc.Equals, time.Second)
+
+	t.Reset()
+	c.Assert(t.Report(), jc.DeepEquals, schedule.DeliveryReport{Tolerance: 100 * time.Millisecond})
+}
+
+func (*deliverySuite) TestSchedule(c *gc.C) {
+	late := make(chan schedule.LateDelivery[string], 10)
+	tracker, err := schedule.NewDeliveryTracker(schedule.DeliveryTrackerConfig[string]{
+		Tolerance: time.Second,
+		OnLate: func(d schedule.LateDelivery[string]) {
+			late <- d
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:    clock,
+		Delivery: tracker,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := clock.Now()
+	op0 := operation{"k0", "v0", time.Second}
+	op1 := operation{"k1", "v1", 3 * time.Second}
+	s.AddAll([]operation{op0, op1})
+
+	clock.Advance(1500 * time.Millisecond)
+	assertReady(c, s, clock, op0)
+	clock.Advance(3 * time.Second)
+	assertReady(c, s, clock, op1)
+	c.Assert(receive(c, late), jc.DeepEquals, schedule.LateDelivery[string]{
+		Key:       "k1",
+		Scheduled: t0.Add(3 * time.Second),
+		Delivered: t0.Add(4500 * time.Millisecond),
+		Lag:       1500 * time.Millisecond,
+	})
+	assertNotReceived(c, late)
+	report := tracker.Report()
+	c.Assert(report.Count, gc.Equals, uint64(2))
+	c.Assert(report.Late, gc.Equals, uint64(1))
+	c.Assert(report.Max, gc.Equals, 1500*time.Millisecond)
+}
+
+func (s *runnerSuite) TestDelivery(c *gc.C) {
+	late := make(chan schedule.LateDelivery[string], 10)
+	tracker, err := schedule.NewDeliveryTracker(schedule.DeliveryTrackerConfig[string]{
+		Tolerance: time.Second,
+		OnLate: func(d schedule.LateDelivery[string]) {
+			late <- d
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		MaxConcurrent: 1,
+		Delivery:      tracker,
+	})
+	defer r.Kill()
+
+	// The operations are ready at once, but only one may execute at a
+	// time; the first takes 5s, so the second starts 5s late.
+	var once sync.Once
+	do := func(op *runnableOperation, ctx context.Context) error {
+		once.Do(func() { s.clock.Advance(5 * time.Second) })
+		return nil
+	}
+	r.Add(&runnableOperation{key: "k0", do: do})
+	r.Add(&runnableOperation{key: "k1", do: do})
+	waitUntil(c, "operations executed", func() bool { return r.Stats().Executed == 2 })
+	c.Assert(receive(c, late).Lag, gc.Equals, 5*time.Second)
+	c.Assert(tracker.Report().Count, gc.Equals, uint64(2))
+	c.Assert(tracker.Report().Late, gc.Equals, uint64(1))
+}
+
+// assertApprox asserts that the duration is within the default
+// precision of the histogram in which delivery lags are recorded.
+func assertApprox(c *gc.C, obtained, expected time.Duration) {
+	c.Assert(obtained >= expected-expected/32 && obtained <= expected+expected/32, jc.IsTrue,
+		gc.Commentf("obtained %v, expected approximately %v", obtained, expected))
+}
+
+func (*deliverySuite) TestScheduleClone(c *gc.C) {
+	var late []schedule.LateDelivery[string]
+	tracker, err := schedule.NewDeliveryTracker(schedule.DeliveryTrackerConfig[string]{
+		OnLate: func(d schedule.LateDelivery[string]) {
+			late = append(late, d)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:    clock,
+		Delivery: tracker,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.Add(operation{"k0", "v0", time.Second})
+
+	// Deliveries simulated with a clone are not recorded.
+	clone := s.Clone()
+	c.Assert(clone.Ready(clock.Now().Add(time.Hour)), gc.HasLen, 1)
+	c.Assert(tracker.Report().Count, gc.Equals, uint64(0))
+	c.Assert(late, gc.HasLen, 0)
+}
@@ -0,0 +1,29 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+// DependentOperation may be implemented by a RunnableOperation to declare
+// that it depends on other operations, identified by their keys. A Runner
+// will not execute a ready operation while any of the operations that it
+// depends on are pending: that is, scheduled, waiting to execute, or
+// executing. Once they have all completed successfully, or have been
+// removed from the Runner, the dependent operation is executed.
+//
+// Dependencies on keys with no corresponding operation in the Runner are
+// considered satisfied. Operations with cyclic dependencies will never be
+// executed, until one of them is removed.
+type DependentOperation[K comparable] interface {
+	// DependsOn returns the keys of the operations that the
+	// operation depends on.
+	DependsOn() []K
+}
+
+// operationDependencies returns the keys of the operations that
+// the operation depends on.
+func operationDependencies[K comparable](op interface{}) []K {
+	if d, ok := op.(DependentOperation[K]); ok {
+		return d.DependsOn()
+	}
+	return nil
+}
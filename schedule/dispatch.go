@@ -0,0 +1,281 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+)
+
+// GroupedOperation may be implemented by an Operation to associate it
+// with a group, such as the entity that it operates on. Groups are used
+// by the Runner to dispatch operations fairly, and to limit their
+// concurrency (see RunnerConfig.GroupLimits), and by Schedule.Ready to
+// interleave operations scheduled for the same time. Operations that do
+// not implement GroupedOperation belong to the group "".
+type GroupedOperation interface {
+	// Group returns the name of the operation's group.
+	Group() string
+}
+
+// operationGroup returns the group of the operation.
+func operationGroup(op interface{}) string {
+	if g, ok := op.(GroupedOperation); ok {
+		return g.Group()
+	}
+	return ""
+}
+
+// interleave reorders, in place, each run of consecutive items scheduled
+// for the same time, so that the items' groups take turns round-robin,
+// in the order in which each group first appears in the run. The items
+// of each group keep their relative order.
+func interleave[K comparable, O Operation[K]](items []timequeue.Item[K, O]) {
+	for i := 0; i < len(items); {
+		j := i + 1
+		for j < len(items) && items[j].Time.Equal(items[i].Time) {
+			j++
+		}
+		if j-i > 1 {
+			interleaveRun(items[i:j])
+		}
+		i = j
+	}
+}
+
+// interleaveRun reorders the items round-robin by group.
+func interleaveRun[K comparable, O Operation[K]](run []timequeue.Item[K, O]) {
+	var order []string
+	groups := make(map[string][]timequeue.Item[K, O])
+	for _, item := range run {
+		group := operationGroup(item.Value)
+		if _, ok := groups[group]; !ok {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], item)
+	}
+	if len(order) == 1 {
+		return
+	}
+	i := 0
+	for len(order) > 0 {
+		remaining := order[:0]
+		for _, group := range order {
+			queued := groups[group]
+			run[i] = queued[0]
+			i++
+			if len(queued) > 1 {
+				groups[group] = queued[1:]
+				remaining = append(remaining, group)
+			}
+		}
+		order = remaining
+	}
+}
+
+// queuedOperation is a ready operation waiting to execute, with the
+// time for which it was scheduled, and the time it became ready.
+type queuedOperation[O any] struct {
+	op        O
+	scheduled time.Time
+	ready     time.Time
+}
+
+// dispatchQueue holds ready operations waiting to be executed by a
+// Runner. Operations are taken from the queue either in the order that
+// they were added, or if the queue is fair, by weighted round-robin
+// across the operations' groups. If the queue ages priorities, the
+// operation taken, from each group in its turn, is the one with the
+// greatest aged priority; see agedPriority.
+type dispatchQueue[K comparable, O Operation[K]] struct {
+	fair    bool
+	weights map[string]int
+	aging   time.Duration
+
+	// groups holds the queued operations for each group, in the
+	// order that they were added. If the queue is not fair, all
+	// operations are in the "" group.
+	groups map[string][]queuedOperation[O]
+
+	// ring holds the names of groups with queued operations, in
+	// round-robin order. next is the index in ring of the group
+	// whose turn it is, and credit is the number of operations
+	// that group may still take in its turn.
+	ring   []string
+	next   int
+	credit int
+
+	size int
+}
+
+func newDispatchQueue[K comparable, O Operation[K]](fair bool, weights map[string]int, aging time.Duration) *dispatchQueue[K, O] {
+	return &dispatchQueue[K, O]{
+		fair:    fair,
+		weights: weights,
+		aging:   aging,
+		groups:  make(map[string][]queuedOperation[O]),
+	}
+}
+
+func (q *dispatchQueue[K, O]) group(op O) string {
+	if !q.fair {
+		return ""
+	}
+	return operationGroup(op)
+}
+
+func (q *dispatchQueue[K, O]) weight(group string) int {
+	if w, ok := q.weights[group]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// push adds an operation to the queue.
+func (q *dispatchQueue[K, O]) push(item queuedOperation[O]) {
+	group := q.group(item.op)
+	queued := q.groups[group]
+	if len(queued) == 0 {
+		q.ring = append(q.ring, group)
+	}
+	q.groups[group] = append(queued, item)
+	q.size++
+}
+
+// pop removes and returns the next operation from the queue, at the
+// specified time. If full is non-nil, operations in groups for which it
+// returns true are passed over, keeping their places in the queue, and
+// pop returns false if there are no others.
+func (q *dispatchQueue[K, O]) pop(now time.Time, full func(group string) bool) (queuedOperation[O], bool) {
+	for n := 0; n < len(q.ring); n++ {
+		index := (q.next + n) % len(q.ring)
+		group := q.ring[index]
+		queued := q.groups[group]
+		i := q.choose(queued, now, full)
+		if i < 0 {
+			continue
+		}
+		if index != q.next {
+			// The preceding groups are full,
+			// and so forgo their turns.
+			q.next, q.credit = index, 0
+		}
+		if q.credit == 0 {
+			q.credit = q.weight(group)
+		}
+		item := queued[i]
+		if i == 0 {
+			queued[0] = queuedOperation[O]{}
+			q.groups[group] = queued[1:]
+		} else {
+			last := len(queued) - 1
+			copy(queued[i:], queued[i+1:])
+			queued[last] = queuedOperation[O]{}
+			q.groups[group] = queued[:last]
+		}
+		q.size--
+		q.credit--
+		if len(queued) == 1 {
+			q.removeGroup(q.next)
+		} else if q.credit == 0 {
+			q.next = (q.next + 1) % len(q.ring)
+		}
+		return item, true
+	}
+	return queuedOperation[O]{}, false
+}
+
+// choose returns the index of the queued operation to take next, at the
+// specified time: the first, or if the queue ages priorities, the first
+// with the greatest aged priority, of those whose groups are not full.
+// choose returns -1 if there is no such operation.
+func (q *dispatchQueue[K, O]) choose(queued []queuedOperation[O], now time.Time, full func(group string) bool) int {
+	best, bestPriority := -1, 0
+	for i, item := range queued {
+		if full != nil && full(operationGroup(item.op)) {
+			continue
+		}
+		if q.aging <= 0 {
+			return i
+		}
+		priority := agedPriority(item.op, item.scheduled, now, q.aging)
+		if best < 0 || priority > bestPriority {
+			best, bestPriority = i, priority
+		}
+	}
+	return best
+}
+
+// has reports whether an operation with the specified key is queued.
+func (q *dispatchQueue[K, O]) has(key K) bool {
+	for _, group := range q.ring {
+		for _, item := range q.groups[group] {
+			if item.op.Key() == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// remove removes the operation with the specified key from the queue,
+// returning it and a boolean indicating whether or not it was found.
+func (q *dispatchQueue[K, O]) remove(key K) (O, bool) {
+	for i, group := range q.ring {
+		queued := q.groups[group]
+		for j, item := range queued {
+			if item.op.Key() != key {
+				continue
+			}
+			q.groups[group] = append(queued[:j], queued[j+1:]...)
+			q.size--
+			if len(queued) == 1 {
+				q.removeGroup(i)
+			}
+			return item.op, true
+		}
+	}
+	var zero O
+	return zero, false
+}
+
+// removeGroup removes the (empty) group at index i in the ring.
+func (q *dispatchQueue[K, O]) removeGroup(i int) {
+	delete(q.groups, q.ring[i])
+	q.ring = append(q.ring[:i], q.ring[i+1:]...)
+	switch {
+	case i < q.next:
+		q.next--
+	case i == q.next:
+		// The following group takes its turn.
+		q.credit = 0
+	}
+	if q.next >= len(q.ring) {
+		q.next = 0
+	}
+}
+
+// list returns all operations in the queue, in no particular order,
+// without removing them.
+func (q *dispatchQueue[K, O]) list() []O {
+	var all []O
+	for _, group := range q.ring {
+		for _, item := range q.groups[group] {
+			all = append(all, item.op)
+		}
+	}
+	return all
+}
+
+// drain removes and returns all operations from the queue,
+// in no particular order.
+func (q *dispatchQueue[K, O]) drain() []queuedOperation[O] {
+	var all []queuedOperation[O]
+	for _, group := range q.ring {
+		all = append(all, q.groups[group]...)
+	}
+	*q = *newDispatchQueue[K, O](q.fair, q.weights, q.aging)
+	return all
+}
@@ -0,0 +1,176 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// Drain stops the schedule from accepting new operations, and then waits
+// until none of the operations returned by Ready are in flight: each has
+// been acknowledged, returned to the schedule with Nack, or has passed
+// its ack timeout. If the context is done first, Drain returns the
+// context's error. See Config.AckTimeout.
+//
+// Once the schedule is draining, its Add methods and Restore fail with
+// ErrDraining; the schedule is never resumed. The operations that remain
+// pending may be executed immediately, or persisted, with Flush.
+//
+// If the schedule is configured with a Locker, Drain must be called with
+// the lock held; as with Pop, Drain releases the lock while it waits, so
+// that other goroutines may acknowledge the in-flight operations.
+func (s *Schedule[K, O]) Drain(ctx context.Context) error {
+	s.draining = true
+	for {
+		deadline, ok := s.nextInFlightDeadline(s.time.Now())
+		if !ok {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.changed == nil {
+			s.changed = make(chan struct{}, 1)
+		}
+		expired := s.time.After(deadline.Sub(s.time.Now()))
+		if s.locker != nil {
+			s.locker.Unlock()
+		}
+		select {
+		case <-expired:
+		case <-s.changed:
+		case <-ctx.Done():
+		}
+		if s.locker != nil {
+			s.locker.Lock()
+		}
+	}
+}
+
+// nextInFlightDeadline returns the earliest ack timeout, after now, of
+// the in-flight operations, and a boolean indicating whether or not any
+// operations are in flight at now.
+func (s *Schedule[K, O]) nextInFlightDeadline(now time.Time) (time.Time, bool) {
+	var next time.Time
+	var ok bool
+	for key := range s.inflight {
+		_, deadline, _ := s.q.Get(key)
+		if deadline.After(now) && (!ok || deadline.Before(next)) {
+			next, ok = deadline, true
+		}
+	}
+	return next, ok
+}
+
+// DrainConfig determines what Runner.Drain does with the operations
+// that are pending when it is called.
+type DrainConfig[O any] struct {
+	// FastForward, if true, causes the pending operations to be
+	// executed immediately, as if their times had come, regardless
+	// of their windows, or the schedule's rate limit and smoothing,
+	// as for Schedule.Flush. Otherwise, they remain pending.
+	FastForward bool
+
+	// Persist, if non-nil, is called once the executing operations
+	// have completed, or the context passed to Drain is done, with the
+	// operations that remain pending and the times for which they are
+	// scheduled, including those that failed while draining, so that
+	// they may be restored when the process restarts; see Restore. The
+	// operations are removed from the schedule, and returned to it if
+	// Persist returns an error. Persist is called without any locks
+	// held.
+	Persist func(ops []ScheduledOperation[O]) error
+}
+
+// Drain stops the Runner gracefully: the Runner no longer accepts new
+// operations, as for Schedule.Drain, nor starts executing those that
+// become ready, but waits for the executing operations to complete.
+// Operations that fail while draining are handled according to the
+// error policy, but are not retried. Once there are no executing
+// operations, or the context is done, Drain persists the pending
+// operations as configured, stops the Runner, as Kill does, and returns
+// the context's error, if it is done, or the error returned by Persist.
+// Operations still executing when the context is done are cancelled,
+// and not persisted.
+//
+// Ready operations waiting for a free slot, or for their dependencies,
+// are returned to the schedule, unless they are executed because the
+// config requests FastForward.
+func (r *Runner[K, O]) Drain(ctx context.Context, config DrainConfig[O]) error {
+	r.mu.Lock()
+	if !r.draining {
+		r.draining = true
+		r.schedule.draining = true
+		r.drained = make(chan struct{})
+		if config.FastForward {
+			now := r.schedule.time.Now()
+			for _, item := range r.schedule.flushItems() {
+				r.blocked = append(r.blocked, queuedOperation[O]{item.Value, item.Time, now})
+				r.counts.ready++
+			}
+			r.unblock()
+			r.startQueued()
+		} else {
+			r.requeueLocked()
+		}
+		r.checkDrained()
+	}
+	drained := r.drained
+	r.mu.Unlock()
+	r.notify()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	r.Kill()
+
+	r.mu.Lock()
+	r.requeueLocked()
+	var pending []timequeue.Item[K, O]
+	if config.Persist != nil {
+		pending = r.schedule.flushItems()
+	}
+	r.mu.Unlock()
+	if len(pending) == 0 {
+		return err
+	}
+	ops := make([]ScheduledOperation[O], len(pending))
+	for i, item := range pending {
+		ops[i] = ScheduledOperation[O]{Op: item.Value, Time: item.Time}
+	}
+	if persistErr := config.Persist(ops); persistErr != nil {
+		r.mu.Lock()
+		for _, item := range pending {
+			if _, _, ok := r.schedule.q.Get(item.Key); !ok {
+				r.schedule.q.Add(item.Key, item.Value, item.Time)
+			}
+		}
+		r.mu.Unlock()
+		if err == nil {
+			err = errors.Annotate(persistErr, "persisting pending operations")
+		}
+	}
+	return err
+}
+
+// checkDrained signals that the Runner has drained, if it is draining
+// and no operations are executing or waiting for a free slot.
+// checkDrained must be called with r.mu held.
+func (r *Runner[K, O]) checkDrained() {
+	if !r.draining || r.active > 0 || r.queued.size > 0 {
+		return
+	}
+	select {
+	case <-r.drained:
+	default:
+		close(r.drained)
+	}
+}
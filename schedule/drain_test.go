@@ -0,0 +1,227 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (*scheduleSuite) TestDrain(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	var mu sync.Mutex
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		AckTimeout: time.Minute,
+		Locker:     &mu,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := operation{"k0", "v0", 0}
+	op1 := operation{"k1", "v1", 0}
+	op2 := operation{"k2", "v2", time.Hour}
+	s.AddAll([]operation{op0, op1, op2})
+	assertReady(c, s, clock, op0, op1)
+
+	drained := make(chan error, 1)
+	mu.Lock()
+	go func() {
+		defer mu.Unlock()
+		drained <- s.Drain(context.Background())
+	}()
+
+	// New operations are rejected while draining, and
+	// Drain waits for the in-flight operations.
+	mu.Lock()
+	_, err = s.TryAdd(operation{"k3", "v3", 0})
+	c.Assert(err, gc.ErrorMatches, "operation k3: draining")
+	c.Assert(errors.Is(err, schedule.ErrDraining), jc.IsTrue)
+	c.Assert(s.Ack("k0"), jc.IsTrue)
+	mu.Unlock()
+	assertNotReceived(c, drained)
+	mu.Lock()
+	c.Assert(s.Nack("k1"), jc.IsTrue)
+	mu.Unlock()
+	c.Assert(receive(c, drained), jc.ErrorIsNil)
+
+	// The pending operations may then be flushed.
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(s.Flush(), jc.DeepEquals, []operation{op1, op2})
+}
+
+func (*scheduleSuite) TestDrainAckTimeout(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		AckTimeout: time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := operation{"k0", "v0", 0}
+	s.Add(op0)
+	assertReady(c, s, clock, op0)
+
+	h := clocktesting.NewHarness(clock)
+	drained := make(chan error, 1)
+	go func() {
+		drained <- s.Drain(context.Background())
+	}()
+	h.Settle(c)
+	clocktesting.ExpectTimer(c, clock, time.Minute)
+	assertNotReceived(c, drained)
+	clock.Advance(time.Minute)
+	c.Assert(receive(c, drained), jc.ErrorIsNil)
+	c.Assert(s.Flush(), jc.DeepEquals, []operation{op0})
+}
+
+func (*scheduleSuite) TestDrainContextDone(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		AckTimeout: time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.Add(operation{"k0", "v0", 0})
+	assertReady(c, s, clock, operation{"k0", "v0", 0})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(s.Drain(ctx), gc.Equals, context.Canceled)
+	c.Assert(func() { s.Add(operation{"k1", "v1", 0}) }, gc.PanicMatches, "operation k1: draining")
+}
+
+func (s *runnerSuite) TestDrain(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(chan struct{})
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		started <- op.key
+		<-release
+		return errors.New("failed")
+	}})
+	c.Assert(receive(c, started), gc.Equals, "k0")
+	pending := &runnableOperation{key: "k1", ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Hour}}
+	r.Add(pending)
+
+	persisted := make(chan []schedule.ScheduledOperation[*runnableOperation], 1)
+	drained := make(chan error, 1)
+	go func() {
+		drained <- r.Drain(context.Background(), schedule.DrainConfig[*runnableOperation]{
+			Persist: func(ops []schedule.ScheduledOperation[*runnableOperation]) error {
+				persisted <- ops
+				return nil
+			},
+		})
+	}()
+
+	// New operations are rejected, and the executing
+	// operation is allowed to complete.
+	waitUntil(c, "runner to drain", func() bool {
+		_, err := r.TryAdd(&runnableOperation{key: "k2"})
+		return errors.Is(err, schedule.ErrDraining)
+	})
+	r.Remove("k2")
+	assertNotReceived(c, drained)
+	close(release)
+	c.Assert(receive(c, drained), jc.ErrorIsNil)
+	c.Assert(r.Wait(), jc.ErrorIsNil)
+
+	// The pending operations, including the failed one,
+	// are persisted for their times.
+	ops := receive(c, persisted)
+	times := make(map[string]time.Time)
+	for _, op := range ops {
+		times[op.Op.Key()] = op.Time
+	}
+	c.Assert(times, gc.HasLen, 2)
+	c.Assert(times["k0"].After(s.clock.Now()), jc.IsTrue)
+	c.Assert(times["k1"], gc.Equals, s.clock.Now().Add(time.Hour))
+}
+
+func (s *runnerSuite) TestDrainFastForward(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{MaxConcurrent: 1})
+	defer r.Kill()
+
+	ran := make(chan string, 2)
+	do := func(op *runnableOperation, ctx context.Context) error {
+		ran <- op.key
+		return nil
+	}
+	for i, key := range []string{"k0", "k1"} {
+		r.Add(&runnableOperation{
+			key:                key,
+			ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Duration(i+1) * time.Hour},
+			do:                 do,
+		})
+	}
+
+	// The pending operations are executed immediately,
+	// in order of their times.
+	err := r.Drain(context.Background(), schedule.DrainConfig[*runnableOperation]{
+		FastForward: true,
+		Persist: func(ops []schedule.ScheduledOperation[*runnableOperation]) error {
+			c.Errorf("unexpected pending operations %v", ops)
+			return nil
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(receive(c, ran), gc.Equals, "k0")
+	c.Assert(receive(c, ran), gc.Equals, "k1")
+	c.Assert(r.Wait(), jc.ErrorIsNil)
+}
+
+func (s *runnerSuite) TestDrainContextDone(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	started := make(chan string)
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		started <- op.key
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	c.Assert(receive(c, started), gc.Equals, "k0")
+
+	// The executing operation is cancelled once the
+	// context passed to Drain is done.
+	ctx, cancel := context.WithTimeout(context.Background(), coretesting.ShortWait)
+	defer cancel()
+	err := r.Drain(ctx, schedule.DrainConfig[*runnableOperation]{
+		Persist: func(ops []schedule.ScheduledOperation[*runnableOperation]) error {
+			return errors.New("not persisted")
+		},
+	})
+	c.Assert(err, gc.Equals, context.DeadlineExceeded)
+	c.Assert(r.Wait(), jc.ErrorIsNil)
+}
+
+func (s *runnerSuite) TestDrainPersistError(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	op := &runnableOperation{key: "k0", ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Hour}}
+	r.Add(op)
+	err := r.Drain(context.Background(), schedule.DrainConfig[*runnableOperation]{
+		Persist: func(ops []schedule.ScheduledOperation[*runnableOperation]) error {
+			return errors.New("disk full")
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, "persisting pending operations: disk full")
+	c.Assert(r.Wait(), jc.ErrorIsNil)
+
+	// The operations that could not be persisted remain
+	// in the schedule.
+	_, when, ok := s.schedule.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(when, gc.Equals, s.clock.Now().Add(time.Hour))
+}
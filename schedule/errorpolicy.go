@@ -0,0 +1,46 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import "fmt"
+
+// ErrorAction determines what a Runner does with an operation that
+// has failed.
+type ErrorAction int
+
+const (
+	// ActionRetry is the default action: the operation is
+	// rescheduled, with its Delay method determining when it will
+	// next be executed.
+	ActionRetry ErrorAction = iota
+
+	// ActionRetryNow reschedules the operation for immediate
+	// execution, without calling its Delay method.
+	ActionRetryNow
+
+	// ActionDrop drops the operation. Operations that depend on it
+	// are no longer blocked by it. See RunnerConfig.DeadLetterSize.
+	ActionDrop
+
+	// ActionPark sets the operation aside for manual intervention.
+	// Parked operations are not executed, and continue to block
+	// operations that depend on them, until they are unparked or
+	// removed. See Runner.Parked, Runner.Unpark and Runner.DeadLetters.
+	ActionPark
+)
+
+// String returns a string representation of the action.
+func (a ErrorAction) String() string {
+	switch a {
+	case ActionRetry:
+		return "retry"
+	case ActionRetryNow:
+		return "retry-now"
+	case ActionDrop:
+		return "drop"
+	case ActionPark:
+		return "park"
+	}
+	return fmt.Sprintf("ErrorAction(%d)", int(a))
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+)
+
+// The following errors describe the expected conditions under which
+// operations cannot be added to, or acknowledged by, a schedule. They
+// are returned by the schedule's Try methods wrapped in an
+// *OperationError, which identifies the operation; use errors.Is to
+// test for them, and errors.As to obtain the operation's key.
+//
+// Of the corresponding methods without the Try prefix, Add and AddAll
+// panic with the *OperationError, while Ack and Nack return false.
+var (
+	// ErrDuplicateKey indicates that an operation with the same key
+	// is already scheduled, and the coalesce policy is CoalesceNone.
+	ErrDuplicateKey = errors.New("duplicate key")
+
+	// ErrNotFound indicates that there is no operation with the key.
+	ErrNotFound = errors.New("not found")
+
+	// ErrQueueFull indicates that the schedule is bounded, and the
+	// operation was rejected by the overflow policy.
+	ErrQueueFull = errors.New("schedule full")
+
+	// ErrExpired indicates that the operation's ack timeout has
+	// passed, so it may no longer be acknowledged.
+	ErrExpired = errors.New("expired")
+
+	// ErrDraining indicates that the schedule is draining, and so
+	// no longer accepts new operations; see Schedule.Drain.
+	ErrDraining = errors.New("draining")
+)
+
+// ErrScheduleFull is the former name of ErrQueueFull.
+//
+// Deprecated: use ErrQueueFull.
+var ErrScheduleFull = ErrQueueFull
+
+// OperationError is the error returned when an operation cannot be
+// added to, or acknowledged by, a schedule.
+type OperationError struct {
+	// Key is the operation's key.
+	Key interface{}
+
+	// Err is one of ErrDuplicateKey, ErrNotFound, ErrQueueFull,
+	// ErrExpired or ErrDraining.
+	Err error
+}
+
+// Error is part of the error interface.
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %v: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the error describing the condition.
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// operationError returns an *OperationError for the key and error.
+func operationError[K comparable](key K, err error) error {
+	return &OperationError{Key: key, Err: err}
+}
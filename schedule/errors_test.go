@@ -0,0 +1,95 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"errors"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+// assertOperationError asserts that err is an *OperationError for
+// the key, wrapping the expected error.
+func assertOperationError(c *gc.C, err error, key string, expect error) {
+	c.Assert(errors.Is(err, expect), jc.IsTrue, gc.Commentf("%v", err))
+	var opErr *schedule.OperationError
+	c.Assert(errors.As(err, &opErr), jc.IsTrue)
+	c.Assert(opErr.Key, gc.Equals, key)
+}
+
+func (*scheduleSuite) TestTryAddDuplicate(c *gc.C) {
+	s := schedule.NewSchedule[string, operation](clocktesting.NewClock(time.Time{}))
+	_, err := s.TryAdd(operation{"k0", "v0", time.Second})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.TryAdd(operation{"k0", "v1", time.Second})
+	assertOperationError(c, err, "k0", schedule.ErrDuplicateKey)
+	c.Assert(err, gc.ErrorMatches, "operation k0: duplicate key")
+	op, _, _ := s.Get("k0")
+	c.Assert(op.value, gc.Equals, "v0")
+}
+
+func (*scheduleSuite) TestTryAddAll(c *gc.C) {
+	s := schedule.NewSchedule[string, operation](clocktesting.NewClock(time.Time{}))
+	s.Add(operation{"k0", "v0", time.Second})
+
+	// Duplicates, whether of pending operations or within the
+	// operations being added, leave the schedule unmodified.
+	_, err := s.TryAddAll([]operation{{"k1", "v1", time.Second}, {"k0", "v0", time.Second}})
+	assertOperationError(c, err, "k0", schedule.ErrDuplicateKey)
+	_, err = s.TryAddAll([]operation{{"k1", "v1", time.Second}, {"k1", "v1", time.Second}})
+	assertOperationError(c, err, "k1", schedule.ErrDuplicateKey)
+	c.Assert(len(s.DueWithin(time.Hour)), gc.Equals, 1)
+	c.Assert(func() {
+		s.AddAll([]operation{{"k0", "v0", time.Second}})
+	}, gc.PanicMatches, "operation k0: duplicate key")
+
+	times, err := s.TryAddAll([]operation{{"k1", "v1", time.Second}, {"k2", "v2", time.Second}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(times, gc.HasLen, 2)
+	c.Assert(len(s.DueWithin(time.Hour)), gc.Equals, 3)
+}
+
+func (*scheduleSuite) TestTryAddAllBounded(c *gc.C) {
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clocktesting.NewClock(time.Time{}),
+		MaxPending: 2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	times, err := s.TryAddAll([]operation{
+		{"k0", "v0", time.Second},
+		{"k1", "v1", time.Second},
+		{"k2", "v2", time.Second},
+	})
+	assertOperationError(c, err, "k2", schedule.ErrQueueFull)
+	c.Assert(times, gc.HasLen, 2)
+	c.Assert(len(s.DueWithin(time.Hour)), gc.Equals, 2)
+}
+
+func (*scheduleSuite) TestTryAck(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		AckTimeout: 10 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := operation{"k0", "v0", 0}
+	s.Add(op0)
+	assertOperationError(c, s.TryAck("k0"), "k0", schedule.ErrNotFound)
+	assertOperationError(c, s.TryNack("k1"), "k1", schedule.ErrNotFound)
+
+	// Once the ack timeout passes, the operation may no longer be
+	// acknowledged, and is returned by Ready again.
+	assertReady(c, s, clock, op0)
+	clock.Advance(10 * time.Second)
+	assertOperationError(c, s.TryAck("k0"), "k0", schedule.ErrExpired)
+	assertOperationError(c, s.TryNack("k0"), "k0", schedule.ErrExpired)
+	c.Assert(s.Ack("k0"), jc.IsFalse)
+	assertReady(c, s, clock, op0)
+	c.Assert(s.TryAck("k0"), jc.ErrorIsNil)
+	c.Assert(s.Next(), gc.IsNil)
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// Execution describes an execution of an operation by a Runner, for
+// the Runner's OnExecute hook.
+type Execution[K comparable] struct {
+	// Key is the operation's key.
+	Key K
+
+	// TraceID is the operation's trace ID, if it implements
+	// TracedOperation.
+	TraceID string
+
+	// Attempt is the number of the execution among consecutive
+	// executions of operations with the key, counting from 1. The
+	// count is reset when an execution succeeds, or its operation
+	// is dropped or removed.
+	Attempt int
+
+	// Scheduled is the time for which the operation was scheduled,
+	// Ready the time at which it was released by the schedule, and
+	// Started the time at which it started executing. The differences
+	// between them are the time that the operation spent waiting: for
+	// the schedule's dispatch loop, to be released by rate limiting
+	// or smoothing, for the operations it depends on, and for a free
+	// slot.
+	Scheduled time.Time
+	Ready     time.Time
+	Started   time.Time
+
+	// FirstStarted is the time at which the first of the consecutive
+	// executions counted by Attempt started; for the first attempt,
+	// it is the same as Started. See RunnerConfig.MaxLifetime.
+	FirstStarted time.Time
+
+	// Previous is the context returned by OnExecute for the previous
+	// attempt, if Attempt is greater than 1, and nil otherwise. It
+	// may be used to link the executions of retried operations.
+	Previous context.Context
+
+	// Clock is the Runner's clock, by which the times above are
+	// measured, so that the time at which the execution completes
+	// may be measured likewise.
+	Clock clock.Clock
+}
+
+// attempt records the failed executions of operations with a key.
+type attempt struct {
+	n        int
+	ctx      context.Context
+	first    time.Time
+	failures []Failure
+}
+
+// newExecution returns an Execution describing the execution of the
+// queued operation, started at the specified time. newExecution must
+// be called with r.mu held.
+func (r *Runner[K, O]) newExecution(q queuedOperation[O], started time.Time) Execution[K] {
+	key := q.op.Key()
+	previous := r.attempts[key]
+	first := previous.first
+	if previous.n == 0 {
+		first = started
+	}
+	return Execution[K]{
+		Key:          key,
+		TraceID:      operationTraceID(q.op),
+		Attempt:      previous.n + 1,
+		Scheduled:    q.scheduled,
+		Ready:        q.ready,
+		Started:      started,
+		FirstStarted: first,
+		Previous:     previous.ctx,
+		Clock:        r.schedule.time,
+	}
+}
+
+// recordAttempt records the failure of an execution whose operation
+// is to be retried, along with the context returned for it by the
+// OnExecute hook, and the operation's failure history. recordAttempt
+// must be called with r.mu held.
+func (r *Runner[K, O]) recordAttempt(key K, exec Execution[K], ctx context.Context, failures []Failure) {
+	r.attempts[key] = attempt{n: exec.Attempt, ctx: ctx, first: exec.FirstStarted, failures: failures}
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+)
+
+// Handle refers to an operation added to a schedule by AddHandle, so
+// that the caller that added it may cancel or await it, without racing
+// with others that later add operations with the same key. A Handle
+// remains valid after its operation leaves the schedule.
+//
+// Cancel must not be called concurrently with the schedule's methods;
+// Done and Key may be called at any time.
+type Handle[K comparable, O Operation[K]] struct {
+	s *Schedule[K, O]
+	h *timequeue.Handle[K, O]
+}
+
+// Key returns the key of the handle's operation.
+func (h *Handle[K, O]) Key() K {
+	return h.h.Key()
+}
+
+// Cancel removes the handle's operation from the schedule, as if by
+// Remove, if it is still pending, and reports whether or not it was
+// removed. Once the operation has been returned by Ready, or removed,
+// Cancel does not affect any other operation added with the same key.
+func (h *Handle[K, O]) Cancel() bool {
+	if !h.h.Pending() {
+		return false
+	}
+	h.s.Remove(h.Key())
+	return true
+}
+
+// Done returns a channel that is closed when the handle's operation
+// leaves the schedule: when it is returned by Ready, or is removed,
+// cancelled or dropped to make room for another.
+func (h *Handle[K, O]) Done() <-chan struct{} {
+	return h.h.Done()
+}
+
+// AddHandle is like Add, but also returns a Handle for the added
+// operation. If the operation is coalesced with a pending operation
+// with the same key, the Handle refers to the pending operation, which
+// then holds the result of coalescing them.
+func (s *Schedule[K, O]) AddHandle(op O) (*Handle[K, O], time.Time) {
+	when := s.Add(op)
+	h, _ := s.q.Handle(op.Key())
+	return &Handle[K, O]{s: s, h: h}, when
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+// assertHandleDone asserts whether or not the handle's channel is closed.
+func assertHandleDone(c *gc.C, h *schedule.Handle[string, operation], done bool) {
+	select {
+	case <-h.Done():
+		c.Assert(done, jc.IsTrue, gc.Commentf("handle for %v done", h.Key()))
+	default:
+		c.Assert(done, jc.IsFalse, gc.Commentf("handle for %v not done", h.Key()))
+	}
+}
+
+func (*scheduleSuite) TestAddHandle(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clock,
+		AuditSize: 10,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := clock.Now()
+
+	op0 := operation{"k0", "v0", time.Second}
+	h0, when := s.AddHandle(op0)
+	c.Assert(when, gc.Equals, t0.Add(time.Second))
+	c.Assert(h0.Key(), gc.Equals, "k0")
+	assertHandleDone(c, h0, false)
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, op0)
+	assertHandleDone(c, h0, true)
+
+	// Once the operation has left the schedule, cancelling its
+	// handle does not affect another with the same key.
+	op1 := operation{"k0", "v1", time.Second}
+	h1, _ := s.AddHandle(op1)
+	c.Assert(h0.Cancel(), jc.IsFalse)
+	_, _, ok := s.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(h1.Cancel(), jc.IsTrue)
+	c.Assert(h1.Cancel(), jc.IsFalse)
+	assertHandleDone(c, h1, true)
+	_, _, ok = s.Get("k0")
+	c.Assert(ok, jc.IsFalse)
+
+	var kinds []schedule.AuditKind
+	for _, event := range s.AuditLog() {
+		kinds = append(kinds, event.Kind)
+	}
+	c.Assert(kinds, jc.DeepEquals, []schedule.AuditKind{
+		schedule.AuditAdd, schedule.AuditReady,
+		schedule.AuditAdd, schedule.AuditRemove,
+	})
+}
+
+func (*scheduleSuite) TestAddHandleCoalesced(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:    clock,
+		Coalesce: schedule.CoalesceKeepEarliest,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	h0, _ := s.AddHandle(operation{"k0", "v0", 2 * time.Second})
+	h1, _ := s.AddHandle(operation{"k0", "v1", time.Second})
+
+	// Both handles refer to the coalesced operation.
+	c.Assert(h0.Cancel(), jc.IsTrue)
+	assertHandleDone(c, h0, true)
+	assertHandleDone(c, h1, true)
+	c.Assert(h1.Cancel(), jc.IsFalse)
+}
+
+func (*scheduleSuite) TestAddHandleDropped(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		MaxPending: 1,
+		Overflow:   schedule.OverflowDropFurthest,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	h0, _ := s.AddHandle(operation{"k0", "v0", 2 * time.Second})
+	h1, _ := s.AddHandle(operation{"k1", "v1", time.Second})
+	assertHandleDone(c, h0, true)
+	assertHandleDone(c, h1, false)
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// ClockHealth reports whether the system's time is reliable. It is
+// implemented by *clock.HealthMonitor.
+type ClockHealth interface {
+	// Health returns the current health of the time.
+	Health() clock.Health
+
+	// Changed returns a channel that is closed when
+	// the health next changes.
+	Changed() <-chan struct{}
+}
+
+// UnhealthyClockPolicy determines what a Schedule does while its
+// ClockHealth reports that the time is unreliable.
+type UnhealthyClockPolicy int
+
+const (
+	// UnhealthyClockIgnore is the default policy: the schedule
+	// continues to use its Clock as usual.
+	UnhealthyClockIgnore UnhealthyClockPolicy = iota
+
+	// UnhealthyClockPause pauses the schedule: Ready returns no
+	// operations, and the channel returned by Next does not send
+	// until the time is reliable again. Operations may still be
+	// added and removed.
+	UnhealthyClockPause
+
+	// UnhealthyClockMonotonic causes the schedule to stop following
+	// its Clock, and instead measure time by the time elapsed on its
+	// MonotonicClock from the last time that it read from its Clock
+	// while the time was reliable, so that steps of the Clock's time
+	// neither make all pending operations ready at once nor stall
+	// them. The schedule follows its Clock again, including any step,
+	// once the time is reliable.
+	UnhealthyClockMonotonic
+)
+
+// String returns a string representation of the policy.
+func (p UnhealthyClockPolicy) String() string {
+	switch p {
+	case UnhealthyClockIgnore:
+		return "ignore"
+	case UnhealthyClockPause:
+		return "pause"
+	case UnhealthyClockMonotonic:
+		return "monotonic"
+	}
+	return fmt.Sprintf("UnhealthyClockPolicy(%d)", int(p))
+}
+
+func (p UnhealthyClockPolicy) valid() bool {
+	return p >= UnhealthyClockIgnore && p <= UnhealthyClockMonotonic
+}
+
+// Now returns the schedule's current time, as used by Add and Next: the
+// time of its Clock, except while the schedule is measuring monotonic
+// time because the Clock is unreliable; see UnhealthyClockMonotonic.
+// Callers of Ready should pass the time returned by Now.
+func (s *Schedule[K, O]) Now() time.Time {
+	return s.time.Now()
+}
+
+// healthClock is the clock with which a schedule configured with a
+// ClockHealth measures time, pausing or measuring monotonic time
+// according to its policy while the time is unreliable.
+type healthClock struct {
+	clock     clock.Clock
+	monotonic clock.Clock
+	health    ClockHealth
+	policy    UnhealthyClockPolicy
+
+	mu sync.Mutex
+	// wall and reference are the times last read from the clock and
+	// the monotonic clock, while the time was reliable.
+	wall      time.Time
+	reference time.Time
+	// resume, if non-nil, sends when the health next changes
+	// while paused; see pausedNext.
+	resume chan time.Time
+}
+
+// Now is part of the Clock interface.
+func (c *healthClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy != UnhealthyClockMonotonic || c.health.Health().Healthy {
+		c.wall = c.clock.Now()
+		c.reference = c.monotonic.Now()
+		return c.wall
+	}
+	return c.wall.Add(c.monotonic.Now().Sub(c.reference))
+}
+
+// After is part of the Clock interface.
+func (c *healthClock) After(d time.Duration) <-chan time.Time {
+	return c.clock.After(d)
+}
+
+// NewTimer is part of the TimerClock interface.
+func (c *healthClock) NewTimer(d time.Duration) clock.Timer {
+	return clock.NewTimer(c.clock, d)
+}
+
+// clone returns a copy of the clock, with the times that it last read
+// while the time was reliable, for a clone of its schedule. The copy
+// consults the same ClockHealth, but waits for its changes separately.
+func (c *healthClock) clone() *healthClock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &healthClock{
+		clock:     c.clock,
+		monotonic: c.monotonic,
+		health:    c.health,
+		policy:    c.policy,
+		wall:      c.wall,
+		reference: c.reference,
+	}
+}
+
+// paused reports whether the schedule is paused, because the
+// time is unreliable.
+func (c *healthClock) paused() bool {
+	return c.policy == UnhealthyClockPause && !c.health.Health().Healthy
+}
+
+// pausedNext returns a channel that sends when the health next changes,
+// and true, if the schedule is paused; Next returns the channel, so that
+// a consumer waiting on it re-evaluates the schedule. At most one
+// goroutine waits for the change.
+func (c *healthClock) pausedNext() (<-chan time.Time, bool) {
+	// The channel is obtained before the health is checked, so
+	// that a change in between is not missed.
+	changed := c.health.Changed()
+	if !c.paused() {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resume == nil {
+		c.resume = make(chan time.Time, 1)
+		go func() {
+			<-changed
+			c.mu.Lock()
+			resume := c.resume
+			c.resume = nil
+			c.mu.Unlock()
+			resume <- c.clock.Now()
+		}()
+	}
+	return c.resume, true
+}
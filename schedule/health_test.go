@@ -0,0 +1,175 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (*scheduleSuite) TestUnhealthyClockPause(c *gc.C) {
+	testClock := clocktesting.NewClock(time.Time{})
+	health := newFakeClockHealth()
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:          testClock,
+		ClockHealth:    health,
+		UnhealthyClock: schedule.UnhealthyClockPause,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := operation{"k0", "v0", time.Second}
+	op1 := operation{"k1", "v1", time.Second}
+	s.Add(op0)
+
+	health.set(false)
+	testClock.Advance(time.Second)
+	assertReady(c, s, testClock /* nothing */)
+
+	// Operations may be added while paused, and the
+	// channel returned by Next sends once resumed.
+	s.Add(op1)
+	testClock.Advance(time.Second)
+	next := s.Next()
+	c.Assert(next, gc.NotNil)
+	assertReady(c, s, testClock /* nothing */)
+	health.set(true)
+	receive(c, next)
+	assertReady(c, s, testClock, op0, op1)
+}
+
+func (*scheduleSuite) TestUnhealthyClockMonotonic(c *gc.C) {
+	wall := clocktesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	monotonic := clocktesting.NewClock(time.Time{})
+	health := newFakeClockHealth()
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:          wall,
+		ClockHealth:    health,
+		UnhealthyClock: schedule.UnhealthyClockMonotonic,
+		MonotonicClock: monotonic,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := wall.Now()
+	op0 := operation{"k0", "v0", 10 * time.Second}
+	op1 := operation{"k1", "v1", 20 * time.Second}
+	s.AddAll([]operation{op0, op1})
+
+	// The wall clock is stepped an hour forward while the time is
+	// unreliable: the schedule measures the monotonic time instead.
+	health.set(false)
+	wall.Advance(time.Hour)
+	monotonic.Advance(5 * time.Second)
+	c.Assert(s.Now(), gc.Equals, t0.Add(5*time.Second))
+	c.Assert(s.Ready(s.Now()), gc.HasLen, 0)
+	monotonic.Advance(5 * time.Second)
+	c.Assert(s.Ready(s.Now()), jc.DeepEquals, []operation{op0})
+
+	// The schedule follows the wall clock again, including
+	// its step, once the time is reliable.
+	health.set(true)
+	c.Assert(s.Now(), gc.Equals, t0.Add(time.Hour))
+	c.Assert(s.Ready(s.Now()), jc.DeepEquals, []operation{op1})
+}
+
+func (*scheduleSuite) TestUnhealthyClockClone(c *gc.C) {
+	wall := clocktesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	monotonic := clocktesting.NewClock(time.Time{})
+	health := newFakeClockHealth()
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:          wall,
+		ClockHealth:    health,
+		UnhealthyClock: schedule.UnhealthyClockMonotonic,
+		MonotonicClock: monotonic,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := wall.Now()
+
+	// Reading the clone's time does not change the times
+	// from which the original measures monotonic time.
+	clone := s.Clone()
+	wall.Advance(time.Minute)
+	c.Assert(clone.Now(), gc.Equals, t0.Add(time.Minute))
+	health.set(false)
+	monotonic.Advance(5 * time.Second)
+	c.Assert(s.Now(), gc.Equals, t0.Add(5*time.Second))
+	c.Assert(clone.Now(), gc.Equals, t0.Add(time.Minute+5*time.Second))
+}
+
+func (*scheduleSuite) TestUnhealthyClockPauseClone(c *gc.C) {
+	testClock := clocktesting.NewClock(time.Time{})
+	health := newFakeClockHealth()
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:          testClock,
+		ClockHealth:    health,
+		UnhealthyClock: schedule.UnhealthyClockPause,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.Add(operation{"k0", "v0", time.Second})
+	clone := s.Clone()
+
+	// The original and the clone are each
+	// notified when the schedule resumes.
+	health.set(false)
+	next := s.Next()
+	cloneNext := clone.Next()
+	health.set(true)
+	receive(c, next)
+	receive(c, cloneNext)
+}
+
+func (*scheduleSuite) TestUnhealthyClockValidation(c *gc.C) {
+	_, err := schedule.New(schedule.Config[string, operation]{
+		Clock:          clocktesting.NewClock(time.Time{}),
+		UnhealthyClock: schedule.UnhealthyClockPause,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating schedule config: nil ClockHealth not valid")
+
+	_, err = schedule.New(schedule.Config[string, operation]{
+		Clock:          clocktesting.NewClock(time.Time{}),
+		ClockHealth:    newFakeClockHealth(),
+		UnhealthyClock: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, `validating schedule config: unhealthy clock policy UnhealthyClockPolicy\(-1\) not valid`)
+}
+
+// fakeClockHealth is a ClockHealth whose health is set by the test.
+type fakeClockHealth struct {
+	mu      sync.Mutex
+	health  clock.Health
+	changed chan struct{}
+}
+
+func newFakeClockHealth() *fakeClockHealth {
+	return &fakeClockHealth{
+		health:  clock.Health{Healthy: true},
+		changed: make(chan struct{}),
+	}
+}
+
+func (h *fakeClockHealth) Health() clock.Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.health
+}
+
+func (h *fakeClockHealth) Changed() <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.changed
+}
+
+func (h *fakeClockHealth) set(healthy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.health = clock.Health{Healthy: healthy}
+	if !healthy {
+		h.health.Reason = "unreliable"
+	}
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
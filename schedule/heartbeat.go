@@ -0,0 +1,209 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// ExtendableOperation may be implemented by a RunnableOperation whose
+// executions are limited by a timeout, to allow each execution to extend
+// its timeout by reporting progress with a Heartbeat, up to a hard cap.
+// This suits long-running operations, such as migrations, whose total
+// duration is hard to predict, but which should be interrupted if they
+// stop making progress.
+type ExtendableOperation interface {
+	// MaxTimeout returns the maximum duration of each execution
+	// of the operation, however often it reports progress. If
+	// MaxTimeout returns a non-positive value, the Runner's
+	// MaxExecutionTimeout applies.
+	MaxTimeout() time.Duration
+}
+
+// Heartbeat is a handle with which an executing operation reports its
+// progress to the Runner, extending the execution's timeout. An
+// operation obtains its Heartbeat from the context passed to its Do
+// method, with HeartbeatFromContext.
+//
+// Heartbeat's methods are safe for concurrent use, and may be called on
+// a nil Heartbeat, in which case they do nothing; so an operation may
+// report progress regardless of whether its timeout may be extended.
+type Heartbeat struct {
+	ctx *heartbeatContext
+}
+
+type heartbeatKey struct{}
+
+// HeartbeatFromContext returns the Heartbeat for the execution to which
+// the context was passed, or nil if the execution's timeout may not be
+// extended: that is, if the execution has no timeout, or its maximum
+// timeout does not exceed its timeout.
+func HeartbeatFromContext(ctx context.Context) *Heartbeat {
+	h, _ := ctx.Value(heartbeatKey{}).(*Heartbeat)
+	return h
+}
+
+// Beat reports that the execution is making progress, extending its
+// deadline to a full timeout from now, but no later than its maximum
+// timeout from when it started. Beat reports whether or not the deadline
+// was extended; once the maximum timeout is reached, or the execution's
+// context is done, it is not.
+func (h *Heartbeat) Beat() bool {
+	if h == nil {
+		return false
+	}
+	return h.ctx.extend()
+}
+
+// heartbeatContext is a context that is done when an execution's timeout
+// elapses, and whose deadline is extended by the execution's heartbeats.
+//
+// heartbeatContext does not embed its parent, so that contexts derived
+// from it observe its Err rather than that of an ancestor.
+type heartbeatContext struct {
+	parent  context.Context
+	clock   clock.Clock
+	timeout time.Duration
+	limit   time.Time
+	started time.Time
+	done    chan struct{}
+	hb      *Heartbeat
+
+	mu       sync.Mutex
+	deadline time.Time
+	err      error
+}
+
+// newHeartbeatContext returns a copy of the parent context that is done
+// once the timeout elapses without a heartbeat, or maxTimeout elapses,
+// or the parent is done, or the returned cancel function is called,
+// whichever happens first. If the timeout elapses first, the context's
+// Err method returns context.DeadlineExceeded.
+func newHeartbeatContext(
+	parent context.Context, c clock.Clock, timeout, maxTimeout time.Duration,
+) (*heartbeatContext, context.CancelFunc) {
+	now := c.Now()
+	ctx := &heartbeatContext{
+		parent:   parent,
+		clock:    c,
+		timeout:  timeout,
+		limit:    now.Add(maxTimeout),
+		started:  now,
+		done:     make(chan struct{}),
+		deadline: now.Add(timeout),
+	}
+	if maxTimeout > timeout {
+		ctx.hb = &Heartbeat{ctx}
+	}
+	cancel := func() { ctx.finish(context.Canceled) }
+	timer := clock.NewTimer(c, timeout)
+	go func() {
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.Chan():
+				// The deadline may have been extended since
+				// the timer was set, in which case the timer
+				// is reset for the remainder.
+				if remaining := ctx.remaining(); remaining > 0 {
+					timer.Reset(remaining)
+					continue
+				}
+				ctx.finish(context.DeadlineExceeded)
+			case <-parent.Done():
+				ctx.finish(parent.Err())
+			case <-ctx.done:
+			}
+			return
+		}
+	}()
+	return ctx, cancel
+}
+
+// remaining returns the time remaining until the deadline, or zero if
+// it has passed, in which case the deadline may no longer be extended.
+func (c *heartbeatContext) remaining() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.deadline.Sub(c.clock.Now())
+	if d <= 0 {
+		c.limit = c.deadline
+		return 0
+	}
+	return d
+}
+
+// extend extends the deadline to a full timeout from now,
+// limited by the maximum timeout, and reports whether or
+// not it was extended.
+func (c *heartbeatContext) extend() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return false
+	}
+	deadline := c.clock.Now().Add(c.timeout)
+	if deadline.After(c.limit) {
+		deadline = c.limit
+	}
+	if !deadline.After(c.deadline) {
+		return false
+	}
+	c.deadline = deadline
+	return true
+}
+
+// allowed returns the duration that the execution was allowed
+// by its deadline, including any extensions.
+func (c *heartbeatContext) allowed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline.Sub(c.started)
+}
+
+// finish records the context's error and closes its done channel,
+// if it is not already done.
+func (c *heartbeatContext) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
+
+// Deadline is part of the context.Context interface.
+func (c *heartbeatContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	if parent, ok := c.parent.Deadline(); ok && parent.Before(deadline) {
+		return parent, true
+	}
+	return deadline, true
+}
+
+// Done is part of the context.Context interface.
+func (c *heartbeatContext) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err is part of the context.Context interface.
+func (c *heartbeatContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Value is part of the context.Context interface.
+func (c *heartbeatContext) Value(key interface{}) interface{} {
+	if _, ok := key.(heartbeatKey); ok {
+		return c.hb
+	}
+	return c.parent.Value(key)
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timing"
+)
+
+// defaultLatencyHalfLife is the half-life of the latency moving
+// averages recorded by a Runner, if none is specified.
+const defaultLatencyHalfLife = time.Minute
+
+// LatencyStats summarises the execution durations of a class of
+// operations executed by a Runner.
+type LatencyStats struct {
+	// Count is the number of executions recorded.
+	Count int
+
+	// Mean is the exponentially weighted moving average of the
+	// execution durations.
+	Mean time.Duration
+
+	// Max is the longest execution duration recorded.
+	Max time.Duration
+
+	// Last is the duration of the most recent execution.
+	Last time.Duration
+
+	// Rate is the exponentially weighted moving average of the
+	// rate of executions, per second.
+	Rate float64
+}
+
+// latencyTracker records the execution durations of operations,
+// by class.
+type latencyTracker struct {
+	clock    clock.Clock
+	halfLife time.Duration
+
+	mu      sync.Mutex
+	classes map[string]*latencyClass
+}
+
+type latencyClass struct {
+	estimator *timing.Estimator
+	count     int
+	max       time.Duration
+	last      time.Duration
+}
+
+func newLatencyTracker(clock clock.Clock, halfLife time.Duration) *latencyTracker {
+	if halfLife == 0 {
+		halfLife = defaultLatencyHalfLife
+	}
+	return &latencyTracker{
+		clock:    clock,
+		halfLife: halfLife,
+		classes:  make(map[string]*latencyClass),
+	}
+}
+
+// observe records an execution of an operation in the class,
+// which took the specified duration.
+func (t *latencyTracker) observe(class string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.classes[class]
+	if !ok {
+		// The configuration has already been validated.
+		estimator, _ := timing.NewEstimator(timing.EstimatorConfig{
+			Clock:    t.clock,
+			HalfLife: t.halfLife,
+		})
+		c = &latencyClass{estimator: estimator}
+		t.classes[class] = c
+	}
+	c.estimator.Observe(d)
+	c.count++
+	c.last = d
+	if d > c.max {
+		c.max = d
+	}
+}
+
+// stats returns the statistics for the class, and a boolean
+// indicating whether any executions have been recorded for it.
+func (t *latencyTracker) stats(class string) (LatencyStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.classes[class]
+	if !ok {
+		return LatencyStats{}, false
+	}
+	return c.stats(), true
+}
+
+// all returns the statistics for every class.
+func (t *latencyTracker) all() map[string]LatencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	all := make(map[string]LatencyStats, len(t.classes))
+	for class, c := range t.classes {
+		all[class] = c.stats()
+	}
+	return all
+}
+
+func (c *latencyClass) stats() LatencyStats {
+	return LatencyStats{
+		Count: c.count,
+		Mean:  c.estimator.Latency(),
+		Max:   c.max,
+		Last:  c.last,
+		Rate:  c.estimator.Rate(),
+	}
+}
+
+// Latency returns the execution statistics for the class of operations,
+// and a boolean indicating whether any executions of the class have
+// been recorded. Latencies are only recorded if the Runner is configured
+// with a LatencyClass function.
+func (r *Runner[K, O]) Latency(class string) (LatencyStats, bool) {
+	if r.latencies == nil {
+		return LatencyStats{}, false
+	}
+	return r.latencies.stats(class)
+}
+
+// Latencies returns the execution statistics for each class of
+// operations for which executions have been recorded.
+func (r *Runner[K, O]) Latencies() map[string]LatencyStats {
+	if r.latencies == nil {
+		return map[string]LatencyStats{}
+	}
+	return r.latencies.all()
+}
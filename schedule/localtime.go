@@ -0,0 +1,138 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"sort"
+	"time"
+)
+
+// GapPolicy determines when a wall-clock time that is skipped, because
+// clocks go forward for daylight saving, is considered to occur.
+type GapPolicy int
+
+const (
+	// GapShift causes a skipped time to occur at the time shifted
+	// forward by the length of the gap; e.g. 02:30 occurs at 03:30
+	// when clocks go forward an hour at 02:00.
+	GapShift GapPolicy = iota
+
+	// GapSnap causes a skipped time to occur at the end of the
+	// gap; e.g. 02:30 occurs at 03:00 when clocks go forward an
+	// hour at 02:00.
+	GapSnap
+
+	// GapSkip causes a skipped time not to occur at all.
+	GapSkip
+)
+
+// OverlapPolicy determines when a wall-clock time that is repeated,
+// because clocks go back for daylight saving, is considered to occur.
+type OverlapPolicy int
+
+const (
+	// OverlapFirst causes a repeated time to occur at its first
+	// instance only.
+	OverlapFirst OverlapPolicy = iota
+
+	// OverlapSecond causes a repeated time to occur at its second
+	// instance only.
+	OverlapSecond
+
+	// OverlapBoth causes a repeated time to occur at both instances.
+	OverlapBoth
+)
+
+// DSTPolicy holds the policies for resolving wall-clock times around
+// daylight saving transitions. The zero value shifts skipped times
+// forward, and takes the first instance of repeated times.
+type DSTPolicy struct {
+	Gap     GapPolicy
+	Overlap OverlapPolicy
+}
+
+// LocalTimes returns the instants, in order, at which the specified
+// wall-clock time occurs on the specified date in loc, resolving
+// skipped and repeated times according to the policy. Usually exactly
+// one instant is returned; none may be returned for a skipped time, and
+// two for a repeated time, depending on the policy. The date is
+// normalised as by time.Date.
+func LocalTimes(year int, month time.Month, day, hour, minute int, loc *time.Location, policy DSTPolicy) []time.Time {
+	// Normalise the date and time, and then express the wall-clock
+	// time as if it were UTC, so that subtracting a zone offset
+	// gives the instant at which it occurs with that offset.
+	wall := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	t := time.Date(year, month, day, hour, minute, 0, 0, loc)
+
+	// DST transitions shift clocks by at most a couple of hours, so
+	// the offsets either side of any transition affecting the time
+	// are those in effect three hours either side of it.
+	_, before := t.Add(-3 * time.Hour).Zone()
+	_, after := t.Add(3 * time.Hour).Zone()
+	var instants []time.Time
+	for _, offset := range []int{before, after} {
+		instant := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if !sameWallTime(instant, wall) {
+			continue
+		}
+		if len(instants) == 0 || !instant.Equal(instants[0]) {
+			instants = append(instants, instant)
+		}
+	}
+	sort.Slice(instants, func(i, j int) bool {
+		return instants[i].Before(instants[j])
+	})
+
+	switch len(instants) {
+	case 0:
+		// The time is skipped: with the offset before the
+		// transition, it would be the shifted time; with the
+		// offset after, it would be before the transition.
+		shifted := wall.Add(-time.Duration(before) * time.Second).In(loc)
+		switch policy.Gap {
+		case GapSkip:
+			return nil
+		case GapSnap:
+			early := wall.Add(-time.Duration(after) * time.Second).In(loc)
+			return []time.Time{transition(early, shifted)}
+		}
+		return []time.Time{shifted}
+	case 2:
+		switch policy.Overlap {
+		case OverlapFirst:
+			return instants[:1]
+		case OverlapSecond:
+			return instants[1:]
+		}
+	}
+	return instants
+}
+
+// NextLocalTime returns the first instant strictly after the specified
+// time at which the wall-clock time of day occurs in loc, resolving
+// skipped and repeated times according to the policy.
+func NextLocalTime(after time.Time, hour, minute int, loc *time.Location, policy DSTPolicy) time.Time {
+	return DailyWithPolicy(hour, minute, loc, policy).Next(after)
+}
+
+func sameWallTime(t, wall time.Time) bool {
+	y0, m0, d0 := t.Date()
+	y1, m1, d1 := wall.Date()
+	return y0 == y1 && m0 == m1 && d0 == d1 && t.Hour() == wall.Hour() && t.Minute() == wall.Minute()
+}
+
+// transition returns the first instant in (lo, hi] whose zone offset
+// differs from that at lo, to the second.
+func transition(lo, hi time.Time) time.Time {
+	_, offset := lo.Zone()
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+		if _, o := mid.Zone(); o == offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type localTimeSuite struct {
+	coretesting.BaseSuite
+	berlin *time.Location
+}
+
+var _ = gc.Suite(&localTimeSuite{})
+
+func (s *localTimeSuite) SetUpSuite(c *gc.C) {
+	s.BaseSuite.SetUpSuite(c)
+	loc, err := time.LoadLocation("Europe/Berlin")
+	c.Assert(err, jc.ErrorIsNil)
+	s.berlin = loc
+}
+
+func utc(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2015, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func (s *localTimeSuite) assertLocalTimes(c *gc.C, month time.Month, day, hour, minute int, policy schedule.DSTPolicy, expect ...time.Time) {
+	times := schedule.LocalTimes(2015, month, day, hour, minute, s.berlin, policy)
+	c.Assert(times, gc.HasLen, len(expect))
+	for i, t := range times {
+		c.Check(t.Location(), gc.Equals, s.berlin)
+		c.Check(t.Equal(expect[i]), jc.IsTrue, gc.Commentf("got %s, expected %s", t, expect[i]))
+	}
+}
+
+func (s *localTimeSuite) TestLocalTimes(c *gc.C) {
+	for _, policy := range []schedule.DSTPolicy{
+		{},
+		{Gap: schedule.GapSkip, Overlap: schedule.OverlapBoth},
+	} {
+		s.assertLocalTimes(c, 6, 1, 2, 30, policy, utc(6, 1, 0, 30))
+		s.assertLocalTimes(c, 12, 1, 2, 30, policy, utc(12, 1, 1, 30))
+	}
+	// Dates are normalised.
+	s.assertLocalTimes(c, 5, 32, 2, 30, schedule.DSTPolicy{}, utc(6, 1, 0, 30))
+}
+
+func (s *localTimeSuite) TestGap(c *gc.C) {
+	// Clocks go forward from 02:00 CET to 03:00 CEST on 2015-03-29,
+	// at 01:00 UTC.
+	s.assertLocalTimes(c, 3, 29, 2, 30, schedule.DSTPolicy{Gap: schedule.GapShift}, utc(3, 29, 1, 30))
+	s.assertLocalTimes(c, 3, 29, 2, 30, schedule.DSTPolicy{Gap: schedule.GapSnap}, utc(3, 29, 1, 0))
+	s.assertLocalTimes(c, 3, 29, 2, 30, schedule.DSTPolicy{Gap: schedule.GapSkip})
+	s.assertLocalTimes(c, 3, 29, 2, 0, schedule.DSTPolicy{Gap: schedule.GapSnap}, utc(3, 29, 1, 0))
+	// The times either side of the gap are unaffected.
+	s.assertLocalTimes(c, 3, 29, 1, 59, schedule.DSTPolicy{Gap: schedule.GapSkip}, utc(3, 29, 0, 59))
+	s.assertLocalTimes(c, 3, 29, 3, 0, schedule.DSTPolicy{Gap: schedule.GapSkip}, utc(3, 29, 1, 0))
+}
+
+func (s *localTimeSuite) TestOverlap(c *gc.C) {
+	// Clocks go back from 03:00 CEST to 02:00 CET on 2015-10-25,
+	// at 01:00 UTC.
+	first, second := utc(10, 25, 0, 30), utc(10, 25, 1, 30)
+	s.assertLocalTimes(c, 10, 25, 2, 30, schedule.DSTPolicy{Overlap: schedule.OverlapFirst}, first)
+	s.assertLocalTimes(c, 10, 25, 2, 30, schedule.DSTPolicy{Overlap: schedule.OverlapSecond}, second)
+	s.assertLocalTimes(c, 10, 25, 2, 30, schedule.DSTPolicy{Overlap: schedule.OverlapBoth}, first, second)
+	s.assertLocalTimes(c, 10, 25, 3, 0, schedule.DSTPolicy{Overlap: schedule.OverlapBoth}, utc(10, 25, 2, 0))
+}
+
+func (s *localTimeSuite) TestNextLocalTime(c *gc.C) {
+	policy := schedule.DSTPolicy{Gap: schedule.GapSkip, Overlap: schedule.OverlapBoth}
+	next := func(after time.Time) time.Time {
+		return schedule.NextLocalTime(after, 2, 30, s.berlin, policy)
+	}
+	// The skipped time does not occur.
+	c.Assert(next(utc(3, 28, 12, 0)).Equal(utc(3, 30, 0, 30)), jc.IsTrue)
+	// The repeated time occurs twice.
+	c.Assert(next(utc(10, 24, 12, 0)).Equal(utc(10, 25, 0, 30)), jc.IsTrue)
+	c.Assert(next(utc(10, 25, 0, 30)).Equal(utc(10, 25, 1, 30)), jc.IsTrue)
+	c.Assert(next(utc(10, 25, 1, 30)).Equal(utc(10, 26, 1, 30)), jc.IsTrue)
+}
+
+func (s *localTimeSuite) TestWeeklyWithPolicySkip(c *gc.C) {
+	// 2015-03-29 is a Sunday; its 02:30 is skipped, so
+	// the recurrence next occurs a week later.
+	r := schedule.WeeklyWithPolicy(time.Sunday, 2, 30, s.berlin, schedule.DSTPolicy{Gap: schedule.GapSkip})
+	c.Assert(r.Next(utc(3, 28, 0, 0)).Equal(utc(4, 5, 0, 30)), jc.IsTrue)
+}
@@ -0,0 +1,166 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"sort"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// MultiSchedule aggregates several schedules, such as one for each of
+// an agent's subsystems, presenting a single Next channel, and a single
+// Ready call which dispatches each schedule's ready operations to the
+// function with which it was added. A loop may then wait on one channel
+// rather than selecting over the schedules' channels. Schedules are
+// added with AddToMulti, since their operation types may differ.
+//
+// Like Schedule, MultiSchedule is not safe for concurrent use; callers
+// that add operations to its schedules from other goroutines should
+// guard the MultiSchedule and its schedules with the same lock.
+type MultiSchedule struct {
+	time     clock.Clock
+	children []*multiChild
+
+	// timer is reused by Next.
+	timer clock.Timer
+}
+
+// multiChild is a schedule added to a MultiSchedule.
+type multiChild struct {
+	name     string
+	nextTime func() (time.Time, bool)
+	ready    func(now time.Time) int
+}
+
+// NewMultiSchedule returns a new MultiSchedule, with no schedules, that
+// uses the given clock to wait for the next operation.
+func NewMultiSchedule(clock clock.Clock) *MultiSchedule {
+	return &MultiSchedule{time: clock}
+}
+
+// AddToMulti adds the schedule to the MultiSchedule under the specified
+// name. dispatch is called by the MultiSchedule's Ready with each
+// non-empty batch of the schedule's ready operations, as returned by
+// the schedule's Ready. AddToMulti returns an error if a schedule has
+// already been added with the name.
+//
+// Schedules that pause while their Clock is unreliable may not be
+// added, as their Next channels cannot be merged; see
+// UnhealthyClockPause.
+func AddToMulti[K comparable, O Operation[K]](m *MultiSchedule, name string, s *Schedule[K, O], dispatch func(ops []O)) error {
+	if m.child(name) >= 0 {
+		return errors.AlreadyExistsf("schedule %q", name)
+	}
+	if s.health != nil && s.health.policy == UnhealthyClockPause {
+		return errors.NotSupportedf("schedule %q pausing while the clock is unhealthy", name)
+	}
+	m.children = append(m.children, &multiChild{
+		name:     name,
+		nextTime: s.NextTime,
+		ready: func(now time.Time) int {
+			ops := s.Ready(now)
+			if len(ops) > 0 {
+				dispatch(ops)
+			}
+			return len(ops)
+		},
+	})
+	return nil
+}
+
+// Remove removes the schedule with the specified name from the
+// MultiSchedule, leaving its operations in it, and reports whether
+// or not there was such a schedule.
+func (m *MultiSchedule) Remove(name string) bool {
+	i := m.child(name)
+	if i < 0 {
+		return false
+	}
+	m.children = append(m.children[:i], m.children[i+1:]...)
+	return true
+}
+
+// Names returns the names of the schedules, in the order
+// in which they were added.
+func (m *MultiSchedule) Names() []string {
+	names := make([]string, len(m.children))
+	for i, child := range m.children {
+		names[i] = child.name
+	}
+	return names
+}
+
+func (m *MultiSchedule) child(name string) int {
+	for i, child := range m.children {
+		if child.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// NextTime returns the earliest time at which any schedule's Next
+// channel would send, and a boolean indicating whether or not there
+// are any scheduled operations.
+func (m *MultiSchedule) NextTime() (time.Time, bool) {
+	var next time.Time
+	var found bool
+	for _, child := range m.children {
+		if t, ok := child.nextTime(); ok && (!found || t.Before(next)) {
+			next, found = t, true
+		}
+	}
+	return next, found
+}
+
+// Next returns a channel which will send after the time returned by
+// NextTime has been reached. If there are no scheduled operations, nil
+// is returned. As with Schedule.Next, a channel returned by an earlier
+// call to Next should not be waited on after calling Next again, and
+// Next should be called again after operations are added.
+func (m *MultiSchedule) Next() <-chan time.Time {
+	next, ok := m.NextTime()
+	if !ok {
+		if m.timer != nil {
+			m.timer.Stop()
+		}
+		return nil
+	}
+	d := next.Sub(m.time.Now())
+	if m.timer == nil {
+		m.timer = clock.NewTimer(m.time, d)
+	} else {
+		m.timer.Reset(d)
+	}
+	return m.timer.Chan()
+}
+
+// Ready calls the Ready method of each schedule with ready operations,
+// in order of the schedules' next times, dispatching the operations
+// to the function with which the schedule was added, and returns the
+// total number of operations dispatched. The dispatch functions are
+// called synchronously, and so may add operations to the schedules.
+func (m *MultiSchedule) Ready(now time.Time) int {
+	type due struct {
+		child *multiChild
+		t     time.Time
+	}
+	var ready []due
+	for _, child := range m.children {
+		if t, ok := child.nextTime(); ok && !t.After(now) {
+			ready = append(ready, due{child, t})
+		}
+	}
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].t.Before(ready[j].t)
+	})
+	var n int
+	for _, due := range ready {
+		n += due.child.ready(now)
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type multiSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&multiSuite{})
+
+func (*multiSuite) TestNextReady(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	m := schedule.NewMultiSchedule(clock)
+	c.Assert(m.Next(), gc.IsNil)
+
+	// The schedules may have different operation types.
+	strings := schedule.NewSchedule[string, operation](clock)
+	ints := schedule.NewSchedule[int, intOperation](clock)
+	var dispatched []interface{}
+	err := schedule.AddToMulti(m, "strings", strings, func(ops []operation) {
+		for _, op := range ops {
+			dispatched = append(dispatched, op.key)
+		}
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = schedule.AddToMulti(m, "ints", ints, func(ops []intOperation) {
+		for _, op := range ops {
+			dispatched = append(dispatched, op.key)
+		}
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(m.Names(), jc.DeepEquals, []string{"strings", "ints"})
+
+	strings.Add(operation{"k0", "v0", 2 * time.Second})
+	ints.Add(intOperation{key: 1, delay: time.Second})
+	ints.Add(intOperation{key: 2, delay: 3 * time.Second})
+
+	next, ok := m.NextTime()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(next, gc.Equals, clock.Now().Add(time.Second))
+	c.Assert(m.Next(), gc.NotNil)
+	clocktesting.ExpectTimer(c, clock, time.Second)
+	clock.Advance(time.Second)
+	c.Assert(m.Ready(clock.Now()), gc.Equals, 1)
+	c.Assert(dispatched, jc.DeepEquals, []interface{}{1})
+
+	// Schedules are dispatched in order of their next times.
+	clock.Advance(2 * time.Second)
+	clocktesting.ExpectSignalled(c, m.Next())
+	c.Assert(m.Ready(clock.Now()), gc.Equals, 2)
+	c.Assert(dispatched, jc.DeepEquals, []interface{}{1, "k0", 2})
+	c.Assert(m.Next(), gc.IsNil)
+	c.Assert(m.Ready(clock.Now()), gc.Equals, 0)
+
+	c.Assert(m.Remove("ints"), jc.IsTrue)
+	c.Assert(m.Remove("ints"), jc.IsFalse)
+	ints.Add(intOperation{key: 3})
+	c.Assert(m.Next(), gc.IsNil)
+}
+
+func (*multiSuite) TestAddErrors(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	m := schedule.NewMultiSchedule(clock)
+	s := schedule.NewSchedule[string, operation](clock)
+	dispatch := func([]operation) {}
+	c.Assert(schedule.AddToMulti(m, "s", s, dispatch), jc.ErrorIsNil)
+	c.Assert(schedule.AddToMulti(m, "s", s, dispatch), gc.ErrorMatches, `schedule "s" already exists`)
+
+	paused, err := schedule.New(schedule.Config[string, operation]{
+		Clock:          clock,
+		ClockHealth:    newFakeClockHealth(),
+		UnhealthyClock: schedule.UnhealthyClockPause,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = schedule.AddToMulti(m, "paused", paused, dispatch)
+	c.Assert(err, gc.ErrorMatches, `schedule "paused" pausing while the clock is unhealthy not supported`)
+}
+
+type intOperation struct {
+	key   int
+	delay time.Duration
+}
+
+func (o intOperation) Key() int {
+	return o.key
+}
+
+func (o intOperation) Delay() time.Duration {
+	return o.delay
+}
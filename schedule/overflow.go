@@ -0,0 +1,87 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"fmt"
+
+	"github.com/axw/juju-time/timequeue"
+)
+
+// OverflowPolicy determines how a bounded Schedule handles the addition
+// of an operation when it already holds the maximum number of pending
+// operations.
+type OverflowPolicy int
+
+const (
+	// OverflowReject is the default policy: the new operation is
+	// rejected.
+	OverflowReject OverflowPolicy = iota
+
+	// OverflowDropLowestPriority drops the pending operation with
+	// the lowest priority, as reported by PrioritizedOperation, to
+	// make room for the new operation. Of operations with the same
+	// priority, the one scheduled furthest in the future is dropped.
+	// If the new operation would itself be dropped, it is rejected.
+	OverflowDropLowestPriority
+
+	// OverflowDropFurthest drops the pending operation scheduled
+	// furthest in the future, to make room for the new operation.
+	// If the new operation would itself be dropped, it is rejected.
+	OverflowDropFurthest
+)
+
+// String returns a string representation of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowReject:
+		return "reject"
+	case OverflowDropLowestPriority:
+		return "drop-lowest-priority"
+	case OverflowDropFurthest:
+		return "drop-furthest"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+func (p OverflowPolicy) valid() bool {
+	return p >= OverflowReject && p <= OverflowDropFurthest
+}
+
+// PrioritizedOperation may be implemented by an Operation to give it
+// a priority. Operations that do not implement PrioritizedOperation
+// have priority zero.
+type PrioritizedOperation interface {
+	// Priority returns the operation's priority; operations
+	// with greater values are more important.
+	Priority() int
+}
+
+// operationPriority returns the priority of the operation.
+func operationPriority(op interface{}) int {
+	if p, ok := op.(PrioritizedOperation); ok {
+		return p.Priority()
+	}
+	return 0
+}
+
+// evictionOrder returns the eviction order for the overflow policy,
+// for use with timequeue.Queue.SetEvictionOrder.
+func evictionOrder[K comparable, O Operation[K]](p OverflowPolicy) func(a, b timequeue.Item[K, O]) bool {
+	switch p {
+	case OverflowDropLowestPriority:
+		return func(a, b timequeue.Item[K, O]) bool {
+			pa, pb := operationPriority(a.Value), operationPriority(b.Value)
+			if pa != pb {
+				return pa < pb
+			}
+			return a.Time.After(b.Time)
+		}
+	case OverflowDropFurthest:
+		return func(a, b timequeue.Item[K, O]) bool {
+			return a.Time.After(b.Time)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import "time"
+
+// DelayOverride is a hook that inspects, and may override, the delay
+// computed for an operation as it is added to a Schedule, returning the
+// delay to apply instead. The computed delay is that returned by the
+// operation's Delay method, capped as for CappedOperation. The
+// DelayOverride of a Runner's schedule is called with the Runner's lock
+// held, and so must not call the Runner's methods.
+type DelayOverride[O any] func(op O, delay time.Duration) time.Duration
+
+// ScaleDelays returns a DelayOverride that multiplies every delay by
+// the specified factor; a factor of zero makes every operation ready
+// at the time it is added.
+func ScaleDelays[O any](factor float64) DelayOverride[O] {
+	return func(_ O, delay time.Duration) time.Duration {
+		return time.Duration(float64(delay) * factor)
+	}
+}
+
+// SetDelayOverride installs the hook through which the delays of the
+// operations subsequently added to the schedule are computed, replacing
+// any installed previously, or configured with Config.DelayOverride. If
+// f is nil, the computed delays are used as they are. Operations that are
+// already scheduled are not affected.
+func (s *Schedule[K, O]) SetDelayOverride(f DelayOverride[O]) {
+	s.delayOverride = f
+}
+
+// SetDelayOverride installs the hook through which the delays of the
+// operations subsequently added to, or rescheduled by, the Runner are
+// computed. See Schedule.SetDelayOverride.
+func (r *Runner[K, O]) SetDelayOverride(f DelayOverride[O]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedule.SetDelayOverride(f)
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (*scheduleSuite) TestDelayOverride(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	type override struct {
+		key   string
+		delay time.Duration
+	}
+	var overrides []override
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock: clock,
+		DelayOverride: func(op operation, delay time.Duration) time.Duration {
+			overrides = append(overrides, override{op.key, delay})
+			if op.key == "k1" {
+				return time.Hour
+			}
+			return delay
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	now := clock.Now()
+	c.Assert(s.Add(operation{"k0", "v0", time.Minute}), gc.Equals, now.Add(time.Minute))
+	c.Assert(s.Add(operation{"k1", "v1", time.Minute}), gc.Equals, now.Add(time.Hour))
+	c.Assert(overrides, jc.DeepEquals, []override{{"k0", time.Minute}, {"k1", time.Minute}})
+
+	// Replacing the override affects only the
+	// operations subsequently added.
+	s.SetDelayOverride(schedule.ScaleDelays[operation](10))
+	c.Assert(s.Add(operation{"k2", "v2", time.Minute}), gc.Equals, now.Add(10*time.Minute))
+	_, when, _ := s.Get("k1")
+	c.Assert(when, gc.Equals, now.Add(time.Hour))
+
+	s.SetDelayOverride(nil)
+	c.Assert(s.Add(operation{"k3", "v3", time.Minute}), gc.Equals, now.Add(time.Minute))
+}
+
+func (*scheduleSuite) TestScaleDelays(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:         clock,
+		DelayOverride: schedule.ScaleDelays[operation](0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	times := s.AddAll([]operation{{"k0", "v0", time.Minute}, {"k1", "v1", time.Hour}})
+	c.Assert(times, jc.DeepEquals, []time.Time{clock.Now(), clock.Now()})
+	c.Assert(s.Ready(clock.Now()), jc.DeepEquals, []operation{{"k0", "v0", time.Minute}, {"k1", "v1", time.Hour}})
+
+	half := schedule.ScaleDelays[operation](0.5)
+	c.Assert(half(operation{}, time.Minute), gc.Equals, 30*time.Second)
+}
+
+func (s *runnerSuite) TestDelayOverride(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+	r.SetDelayOverride(schedule.ScaleDelays[*runnableOperation](0))
+
+	// Failed operations are rescheduled with
+	// the overridden delay, and so retried
+	// without the clock advancing.
+	attempts := make(chan int)
+	var attempt int
+	r.Add(&runnableOperation{
+		key:                "k0",
+		ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Hour},
+		do: func(op *runnableOperation, ctx context.Context) error {
+			attempt++
+			attempts <- attempt
+			if attempt < 3 {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	})
+	c.Assert(receive(c, attempts), gc.Equals, 1)
+	c.Assert(receive(c, attempts), gc.Equals, 2)
+	c.Assert(receive(c, attempts), gc.Equals, 3)
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// QuotaOperation may be implemented by an Operation to declare the
+// class of quota that it consumes, such as the API of the provider
+// that it calls. See Config.Quota.
+type QuotaOperation interface {
+	// QuotaClass returns the operation's quota class. If QuotaClass
+	// returns the empty string, the operation consumes no quota.
+	QuotaClass() string
+}
+
+// QuotaTracker tracks the consumption of quotas by operations, for a
+// Schedule. A QuotaTracker may be shared by several schedules whose
+// operations consume the same quotas; its methods must then be safe
+// for concurrent use.
+type QuotaTracker interface {
+	// Reserve reserves quota for one operation of the class, at the
+	// earliest time at or after now at which the class's quota allows,
+	// and returns that time.
+	Reserve(class string, now time.Time) time.Time
+}
+
+// QuotaLimiter is a QuotaTracker that limits the rate at which
+// operations of each class are released, such as to a number of
+// requests per minute for each provider. Classes without a limit
+// are unconstrained.
+//
+// QuotaLimiter's methods are safe for concurrent use.
+type QuotaLimiter struct {
+	limits map[string]RateLimit
+
+	mu sync.Mutex
+	// reserved holds, for each class, the times of the reservations
+	// within the most recent window, and after, in order of time.
+	reserved map[string][]time.Time
+}
+
+// NewQuotaLimiter returns a new QuotaLimiter that limits each class to
+// the corresponding rate limit: no more than Limit operations of the
+// class are released within any period of length Window.
+func NewQuotaLimiter(limits map[string]RateLimit) (*QuotaLimiter, error) {
+	copied := make(map[string]RateLimit, len(limits))
+	for class, limit := range limits {
+		if err := limit.Validate(); err != nil {
+			return nil, errors.Annotatef(err, "validating quota %q", class)
+		}
+		if limit.Limit > 0 {
+			copied[class] = limit
+		}
+	}
+	return &QuotaLimiter{
+		limits:   copied,
+		reserved: make(map[string][]time.Time),
+	}, nil
+}
+
+// Reserve is part of the QuotaTracker interface.
+func (q *QuotaLimiter) Reserve(class string, now time.Time) time.Time {
+	limit, ok := q.limits[class]
+	if !ok {
+		return now
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	reserved := q.reserved[class]
+	var expired int
+	for _, t := range reserved {
+		if t.Add(limit.Window).After(now) {
+			break
+		}
+		expired++
+	}
+	reserved = reserved[expired:]
+	t := now
+	if n := len(reserved); n >= limit.Limit {
+		// The reservation must fall outside the window of the
+		// Limit'th latest reservation.
+		if next := reserved[n-limit.Limit].Add(limit.Window); next.After(t) {
+			t = next
+		}
+	}
+	q.reserved[class] = append(reserved, t)
+	return t
+}
+
+// clone returns a copy of the limiter, with its own copy of the
+// reservations.
+func (q *QuotaLimiter) clone() *QuotaLimiter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	reserved := make(map[string][]time.Time, len(q.reserved))
+	for class, times := range q.reserved {
+		reserved[class] = append([]time.Time(nil), times...)
+	}
+	return &QuotaLimiter{limits: q.limits, reserved: reserved}
+}
+
+// quotaClass returns the operation's quota class, or the empty string
+// if it does not implement QuotaOperation.
+func quotaClass(op interface{}) string {
+	if q, ok := op.(QuotaOperation); ok {
+		return q.QuotaClass()
+	}
+	return ""
+}
+
+// reserveQuota reserves quota for the ready operation with the key, and
+// returns the time at which it may be released. Operations that were
+// deferred until their reservations, or that were not released after
+// reserving, use their existing reservations.
+func (s *Schedule[K, O]) reserveQuota(key K, op O, now time.Time) time.Time {
+	if s.quota == nil {
+		return now
+	}
+	if s.reserved[key] {
+		delete(s.reserved, key)
+		return now
+	}
+	class := quotaClass(op)
+	if class == "" {
+		return now
+	}
+	t := s.quota.Reserve(class, now)
+	if t.After(now) {
+		s.reserved[key] = true
+	}
+	return t
+}
+
+// retainQuota records that the item, which has reserved quota, is being
+// returned to the schedule unreleased, so that it uses its existing
+// reservation when it is next ready.
+func (s *Schedule[K, O]) retainQuota(item timequeue.Item[K, O]) {
+	if s.quota != nil && quotaClass(item.Value) != "" {
+		s.reserved[item.Key] = true
+	}
+}
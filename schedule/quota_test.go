@@ -0,0 +1,112 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (*scheduleSuite) TestQuotaLimiter(c *gc.C) {
+	q, err := schedule.NewQuotaLimiter(map[string]schedule.RateLimit{
+		"aws": {Limit: 2, Window: time.Minute},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.Assert(q.Reserve("aws", t0), gc.Equals, t0)
+	c.Assert(q.Reserve("aws", t0.Add(time.Second)), gc.Equals, t0.Add(time.Second))
+	c.Assert(q.Reserve("aws", t0.Add(2*time.Second)), gc.Equals, t0.Add(time.Minute))
+	c.Assert(q.Reserve("aws", t0.Add(2*time.Second)), gc.Equals, t0.Add(time.Minute+time.Second))
+	c.Assert(q.Reserve("aws", t0.Add(2*time.Second)), gc.Equals, t0.Add(2*time.Minute))
+	// Classes without limits are unconstrained.
+	c.Assert(q.Reserve("gce", t0), gc.Equals, t0)
+
+	_, err = schedule.NewQuotaLimiter(map[string]schedule.RateLimit{
+		"aws": {Limit: 1},
+	})
+	c.Assert(err, gc.ErrorMatches, `validating quota "aws": non-positive Window not valid`)
+}
+
+func (*scheduleSuite) TestQuota(c *gc.C) {
+	quota, err := schedule.NewQuotaLimiter(map[string]schedule.RateLimit{
+		"aws": {Limit: 2, Window: time.Minute},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, quotaOperation]{
+		Clock: clock,
+		Quota: quota,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	ops := make([]quotaOperation, 5)
+	for i := range ops {
+		ops[i] = quotaOperation{
+			operation: operation{key: string(rune('a' + i)), delay: time.Duration(i) * time.Second},
+			class:     "aws",
+		}
+	}
+	free := quotaOperation{operation: operation{key: "free", delay: 4 * time.Second}}
+	s.AddAll(append(ops, free))
+
+	// Operations that would exceed the quota are deferred until
+	// the quota allows, and released in order of time.
+	clock.Advance(4 * time.Second)
+	assertReady(c, s, clock, ops[0], ops[1], free)
+	next, ok := s.NextTime()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(next, gc.Equals, clock.Now().Add(time.Minute))
+	clock.Advance(time.Minute)
+	c.Assert(s.Ready(clock.Now()), jc.SameContents, []quotaOperation{ops[2], ops[3]})
+	clock.Advance(59 * time.Second)
+	assertReady(c, s, clock /* nothing */)
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, ops[4])
+
+	// Deferred operations do not reserve quota again when they are
+	// released, so one of the two slots in the window remains.
+	c.Assert(quota.Reserve("aws", clock.Now()), gc.Equals, clock.Now())
+	c.Assert(quota.Reserve("aws", clock.Now()), gc.Equals, clock.Now().Add(time.Minute))
+}
+
+type quotaOperation struct {
+	operation
+	class string
+}
+
+func (o quotaOperation) QuotaClass() string {
+	return o.class
+}
+
+func (*scheduleSuite) TestQuotaClone(c *gc.C) {
+	quota, err := schedule.NewQuotaLimiter(map[string]schedule.RateLimit{
+		"aws": {Limit: 1, Window: time.Minute},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, quotaOperation]{
+		Clock: clock,
+		Quota: quota,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := quotaOperation{operation: operation{key: "a"}, class: "aws"}
+	op1 := quotaOperation{operation: operation{key: "b"}, class: "aws"}
+	s.AddAll([]quotaOperation{op0, op1})
+
+	// The clone defers operations within the quota,
+	// as the original would.
+	clone := s.Clone()
+	now := clock.Now()
+	c.Assert(clone.Ready(now), jc.DeepEquals, []quotaOperation{op0})
+	c.Assert(clone.Ready(now.Add(time.Minute)), jc.DeepEquals, []quotaOperation{op1})
+
+	// The original schedule's quota is untouched.
+	assertReady(c, s, clock, op0)
+	clock.Advance(time.Minute)
+	assertReady(c, s, clock, op1)
+	c.Assert(quota.Reserve("aws", clock.Now()), gc.Equals, clock.Now().Add(time.Minute))
+}
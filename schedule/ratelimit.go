@@ -0,0 +1,84 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// RateLimit limits the rate at which a Schedule releases ready
+// operations.
+//
+// The zero value imposes no limit.
+type RateLimit struct {
+	// Limit is the maximum number of operations that will be released
+	// by Ready within any period of length Window. Operations that
+	// would exceed the limit are left in the schedule, in their
+	// original order, until they can be released.
+	Limit int
+
+	// Window is the length of the rolling window over which
+	// Limit applies.
+	Window time.Duration
+}
+
+// Validate checks that the rate limit is valid.
+func (r RateLimit) Validate() error {
+	if r.Limit < 0 {
+		return errors.NotValidf("negative Limit")
+	}
+	if r.Limit > 0 && r.Window <= 0 {
+		return errors.NotValidf("non-positive Window")
+	}
+	return nil
+}
+
+// rateLimiter records the times at which operations were released, to
+// enforce a RateLimit over a sliding window.
+type rateLimiter struct {
+	RateLimit
+
+	// released holds the release times of operations within the
+	// most recent window, oldest first.
+	released []time.Time
+}
+
+func newRateLimiter(r RateLimit) *rateLimiter {
+	if r.Limit == 0 {
+		return nil
+	}
+	return &rateLimiter{RateLimit: r}
+}
+
+// available returns the number of operations that may be released
+// at the specified time.
+func (r *rateLimiter) available(now time.Time) int {
+	var expired int
+	for _, t := range r.released {
+		if t.Add(r.Window).After(now) {
+			break
+		}
+		expired++
+	}
+	r.released = r.released[expired:]
+	return r.Limit - len(r.released)
+}
+
+// nextAvailable returns the earliest time at which an operation may be
+// released, given that none may be released at the specified time.
+func (r *rateLimiter) nextAvailable(now time.Time) time.Time {
+	if r.available(now) > 0 {
+		return now
+	}
+	return r.released[0].Add(r.Window)
+}
+
+// record records the release of n operations at the specified time.
+func (r *rateLimiter) record(now time.Time, n int) {
+	for i := 0; i < n; i++ {
+		r.released = append(r.released, now)
+	}
+}
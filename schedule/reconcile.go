@@ -0,0 +1,154 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"github.com/axw/juju-time/timequeue"
+)
+
+// ReconcileResult describes the changes made by Reconcile.
+type ReconcileResult[K comparable] struct {
+	// Added holds the keys of the operations added to the schedule,
+	// and Rescheduled those of the pending operations moved to a new
+	// time, in the order they were desired.
+	Added       []K
+	Rescheduled []K
+
+	// Removed holds the keys of the pending operations that were not
+	// desired, and so were removed, in order of their times.
+	Removed []K
+
+	// Rejected holds the keys of the desired operations that could
+	// not be added, because the schedule is bounded and full, in the
+	// order they were desired.
+	Rejected []K
+}
+
+// Reconcile changes the schedule's pending operations to match the
+// desired operations, making only the changes needed:
+//   - desired operations whose keys are not pending are added, for
+//     their specified times, or if their times are zero, for the
+//     times computed from their delays, as if by Add;
+//   - pending operations whose keys are desired are kept, along with
+//     any state that they hold, such as their backoff state; if the
+//     desired operation's time is non-zero, and differs from that of
+//     the pending operation, the pending operation is rescheduled for
+//     it, unless it is in flight (see Config.AckTimeout). The desired
+//     operation itself is discarded;
+//   - pending operations whose keys are not desired are removed.
+//
+// Reconcile thus allows a reconciler to compute the operations that it
+// wants each pass, without churning the schedule or resetting the state
+// of operations that it already has. Reconcile will panic if desired
+// has more than one operation with the same key.
+func (s *Schedule[K, O]) Reconcile(desired []ScheduledOperation[O]) ReconcileResult[K] {
+	var result ReconcileResult[K]
+	wanted := make(map[K]bool, len(desired))
+	for _, d := range desired {
+		key := d.Op.Key()
+		if wanted[key] {
+			panic(operationError(key, ErrDuplicateKey))
+		}
+		wanted[key] = true
+	}
+	for _, item := range s.q.Due(maxTime) {
+		if !wanted[item.Key] {
+			result.Removed = append(result.Removed, item.Key)
+		}
+	}
+	if len(result.Removed) > 0 {
+		s.RemoveAll(result.Removed)
+	}
+
+	now := s.time.Now()
+	var added []timequeue.Item[K, O]
+	for _, d := range desired {
+		key := d.Op.Key()
+		if existing, existingTime, ok := s.q.Get(key); ok {
+			// In-flight operations are kept at their ack timeouts.
+			_, inflight := s.inflight[key]
+			if !inflight && !d.Time.IsZero() && !d.Time.Equal(existingTime) {
+				s.q.Update(key, existing, d.Time)
+				delete(s.smoothed, key)
+				delete(s.reserved, key)
+				s.audit(AuditReschedule, key, existing, now, d.Time)
+				result.Rescheduled = append(result.Rescheduled, key)
+			}
+			continue
+		}
+		when := d.Time
+		if when.IsZero() {
+			when = s.when(now, d.Op)
+		}
+		if s.maxPending > 0 {
+			if err := s.addAt(now, d.Op, when); err != nil {
+				result.Rejected = append(result.Rejected, key)
+				continue
+			}
+		} else {
+			added = append(added, timequeue.Item[K, O]{Key: key, Value: d.Op, Time: when})
+		}
+		result.Added = append(result.Added, key)
+	}
+	if len(added) > 0 {
+		s.q.AddAll(added)
+		for _, item := range added {
+			s.audit(AuditAdd, item.Key, item.Value, now, item.Time)
+		}
+	}
+	s.notify()
+	return result
+}
+
+// Reconcile changes the Runner's operations to match the desired
+// operations, as Schedule.Reconcile does for a schedule's pending
+// operations. Desired operations that are waiting to execute, executing
+// or parked are kept, rather than added again. Operations that are not
+// desired are removed if they are pending, waiting to execute or parked,
+// and reported in the result's Removed after the pending operations;
+// executing operations are not affected.
+func (r *Runner[K, O]) Reconcile(desired []ScheduledOperation[O]) ReconcileResult[K] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	wanted := make(map[K]bool, len(desired))
+	var scheduled []ScheduledOperation[O]
+	for _, d := range desired {
+		key := d.Op.Key()
+		if wanted[key] {
+			panic(operationError(key, ErrDuplicateKey))
+		}
+		wanted[key] = true
+		if _, _, ok := r.schedule.q.Get(key); !ok && r.pending(key) {
+			continue
+		}
+		scheduled = append(scheduled, d)
+	}
+	result := r.schedule.Reconcile(scheduled)
+
+	var unwanted []K
+	for _, q := range r.blocked {
+		if !wanted[q.op.Key()] {
+			unwanted = append(unwanted, q.op.Key())
+		}
+	}
+	for _, op := range r.queued.list() {
+		if !wanted[op.Key()] {
+			unwanted = append(unwanted, op.Key())
+		}
+	}
+	for _, letter := range r.parked {
+		if !wanted[letter.Op.Key()] {
+			unwanted = append(unwanted, letter.Op.Key())
+		}
+	}
+	for _, key := range unwanted {
+		r.remove(key)
+		delete(r.attempts, key)
+	}
+	result.Removed = append(result.Removed, unwanted...)
+	r.unblock()
+	r.startQueued()
+	return result
+}
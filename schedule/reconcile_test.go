@@ -0,0 +1,111 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (*scheduleSuite) TestReconcile(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	t0 := clock.Now()
+	s := schedule.NewSchedule[string, operation](clock)
+	s.AddAll([]operation{
+		{"k0", "v0", time.Second},
+		{"k1", "v1", 2 * time.Second},
+		{"k2", "v2", 3 * time.Second},
+	})
+
+	desired := []schedule.ScheduledOperation[operation]{
+		{Op: operation{"k0", "new", time.Hour}},
+		{Op: operation{"k1", "v1", 0}, Time: t0.Add(5 * time.Second)},
+		{Op: operation{"k3", "v3", 4 * time.Second}},
+		{Op: operation{"k4", "v4", 0}, Time: t0.Add(10 * time.Second)},
+	}
+	result := s.Reconcile(desired)
+	c.Assert(result, jc.DeepEquals, schedule.ReconcileResult[string]{
+		Added:       []string{"k3", "k4"},
+		Rescheduled: []string{"k1"},
+		Removed:     []string{"k2"},
+	})
+
+	// The pending operation k0 is kept, rather than replaced.
+	c.Assert(s.DueWithin(time.Hour), jc.DeepEquals, []schedule.ScheduledOperation[operation]{
+		{Op: operation{"k0", "v0", time.Second}, Time: t0.Add(time.Second)},
+		{Op: operation{"k3", "v3", 4 * time.Second}, Time: t0.Add(4 * time.Second)},
+		{Op: operation{"k1", "v1", 2 * time.Second}, Time: t0.Add(5 * time.Second)},
+		{Op: operation{"k4", "v4", 0}, Time: t0.Add(10 * time.Second)},
+	})
+
+	// Reconciling again changes nothing.
+	c.Assert(s.Reconcile(desired), jc.DeepEquals, schedule.ReconcileResult[string]{})
+
+	c.Assert(func() {
+		s.Reconcile([]schedule.ScheduledOperation[operation]{
+			{Op: operation{"k5", "v5", 0}},
+			{Op: operation{"k5", "v5", 0}},
+		})
+	}, gc.PanicMatches, "operation k5: duplicate key")
+}
+
+func (*scheduleSuite) TestReconcileBounded(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		MaxPending: 1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	result := s.Reconcile([]schedule.ScheduledOperation[operation]{
+		{Op: operation{"k0", "v0", time.Second}},
+		{Op: operation{"k1", "v1", time.Second}},
+	})
+	c.Assert(result, jc.DeepEquals, schedule.ReconcileResult[string]{
+		Added:    []string{"k0"},
+		Rejected: []string{"k1"},
+	})
+}
+
+func (s *runnerSuite) TestReconcile(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{MaxConcurrent: 1})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(chan struct{})
+	do := func(op *runnableOperation, ctx context.Context) error {
+		started <- op.key
+		<-release
+		return nil
+	}
+	op := func(key string) *runnableOperation {
+		return &runnableOperation{key: key, do: do}
+	}
+	r.Add(op("k0"))
+	c.Assert(receive(c, started), gc.Equals, "k0")
+	r.Add(op("k1"))
+	r.Add(op("k2"))
+	waitUntil(c, "operations to be queued", func() bool { return r.Queued() >= 2 })
+
+	// k0 is executing, and k1 queued, so neither is added again;
+	// k2 is queued, but not desired, so it is removed.
+	result := r.Reconcile([]schedule.ScheduledOperation[*runnableOperation]{
+		{Op: op("k0")},
+		{Op: op("k1")},
+		{Op: op("k3")},
+	})
+	c.Assert(result, jc.DeepEquals, schedule.ReconcileResult[string]{
+		Added:   []string{"k3"},
+		Removed: []string{"k2"},
+	})
+	c.Assert(r.Queued(), gc.Equals, 1)
+	close(release)
+	c.Assert(receive(c, started), gc.Equals, "k1")
+	c.Assert(advanceUntil(c, s.clock, started, time.Millisecond), gc.Equals, "k3")
+	assertNotReceived(c, started)
+}
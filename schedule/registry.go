@@ -0,0 +1,193 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/jitter"
+	"github.com/juju/errors"
+)
+
+// DelayStrategy computes the delays for successive attempts of an
+// operation. ExponentialBackoff, LinearBackoff and DecorrelatedBackoff
+// implement DelayStrategy.
+type DelayStrategy interface {
+	// Delay returns the delay for the next attempt.
+	Delay() time.Duration
+
+	// Attempts returns the number of attempts for which the
+	// strategy has been used.
+	Attempts() int
+
+	// Reset resets the strategy to its initial state.
+	Reset()
+}
+
+// DelayParams holds the parameters from which a DelayFactory constructs
+// a DelayStrategy. Each factory uses only the parameters that apply to
+// its strategy.
+type DelayParams struct {
+	// Initial is the delay to apply to the first attempt.
+	Initial time.Duration
+
+	// Min is the minimum delay to apply to retries.
+	Min time.Duration
+
+	// Max is the maximum delay to apply to retries.
+	Max time.Duration
+
+	// Factor is the factor by which exponential backoff
+	// multiplies each delay.
+	Factor float64
+
+	// Step is the amount by which linear backoff increases
+	// each delay.
+	Step time.Duration
+
+	// Clock, if non-nil, is the clock used by the strategy.
+	Clock clock.Clock
+
+	// Source, if non-nil, is the source of random numbers used
+	// by the strategy.
+	Source jitter.Source
+
+	// Attempts is the number of attempts already made, such as
+	// when restoring an operation from persistent storage. The
+	// strategy is advanced past these attempts, as if Delay had
+	// been called for each.
+	Attempts int
+}
+
+// Validate checks that the parameters are valid.
+func (params DelayParams) Validate() error {
+	if params.Initial < 0 {
+		return errors.NotValidf("negative Initial")
+	}
+	if params.Min < 0 {
+		return errors.NotValidf("negative Min")
+	}
+	if params.Max < 0 {
+		return errors.NotValidf("negative Max")
+	}
+	if params.Step < 0 {
+		return errors.NotValidf("negative Step")
+	}
+	if params.Attempts < 0 {
+		return errors.NotValidf("negative Attempts")
+	}
+	return nil
+}
+
+// DelayFactory constructs a DelayStrategy from parameters.
+type DelayFactory func(params DelayParams) (DelayStrategy, error)
+
+// Names of the strategies registered in a new DelayRegistry.
+const (
+	DelayExponential  = "exponential"
+	DelayLinear       = "linear"
+	DelayDecorrelated = "decorrelated"
+)
+
+// DelayRegistry maps names to DelayFactories, so that an operation's
+// delay strategy may be recorded by name, such as in persistent storage
+// or configuration, and reconstructed later.
+//
+// DelayRegistry's methods are safe for concurrent use.
+type DelayRegistry struct {
+	mu        sync.Mutex
+	factories map[string]DelayFactory
+}
+
+// NewDelayRegistry returns a new DelayRegistry, with the exponential,
+// linear and decorrelated strategies registered.
+func NewDelayRegistry() *DelayRegistry {
+	return &DelayRegistry{factories: map[string]DelayFactory{
+		DelayExponential: func(params DelayParams) (DelayStrategy, error) {
+			return &ExponentialBackoff{
+				Initial: params.Initial,
+				Min:     params.Min,
+				Max:     params.Max,
+				Factor:  params.Factor,
+				Clock:   params.Clock,
+			}, nil
+		},
+		DelayLinear: func(params DelayParams) (DelayStrategy, error) {
+			return &LinearBackoff{
+				Initial: params.Initial,
+				Min:     params.Min,
+				Step:    params.Step,
+				Max:     params.Max,
+				Clock:   params.Clock,
+			}, nil
+		},
+		DelayDecorrelated: func(params DelayParams) (DelayStrategy, error) {
+			return &DecorrelatedBackoff{
+				Initial: params.Initial,
+				Min:     params.Min,
+				Max:     params.Max,
+				Clock:   params.Clock,
+				Source:  params.Source,
+			}, nil
+		},
+	}}
+}
+
+// Register registers a factory with the specified name. Register
+// returns an error satisfying errors.IsAlreadyExists if a factory
+// is already registered with the name.
+func (r *DelayRegistry) Register(name string, factory DelayFactory) error {
+	if name == "" {
+		return errors.NotValidf("empty name")
+	}
+	if factory == nil {
+		return errors.NotValidf("nil factory")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[name]; ok {
+		return errors.AlreadyExistsf("delay strategy %q", name)
+	}
+	r.factories[name] = factory
+	return nil
+}
+
+// New constructs a DelayStrategy with the factory registered with the
+// specified name. New returns an error satisfying errors.IsNotFound if
+// no factory is registered with the name.
+func (r *DelayRegistry) New(name string, params DelayParams) (DelayStrategy, error) {
+	if err := params.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating delay params")
+	}
+	r.mu.Lock()
+	factory, ok := r.factories[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil, errors.NotFoundf("delay strategy %q", name)
+	}
+	strategy, err := factory(params)
+	if err != nil {
+		return nil, errors.Annotatef(err, "creating delay strategy %q", name)
+	}
+	for i := 0; i < params.Attempts; i++ {
+		strategy.Delay()
+	}
+	return strategy, nil
+}
+
+// Names returns the names of the registered factories, in
+// lexical order.
+func (r *DelayRegistry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type registrySuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&registrySuite{})
+
+var (
+	_ schedule.DelayStrategy = (*schedule.ExponentialBackoff)(nil)
+	_ schedule.DelayStrategy = (*schedule.LinearBackoff)(nil)
+	_ schedule.DelayStrategy = (*schedule.DecorrelatedBackoff)(nil)
+	_ schedule.DelayStrategy = (*schedule.HintedBackoff)(nil)
+)
+
+func (*registrySuite) TestBuiltin(c *gc.C) {
+	r := schedule.NewDelayRegistry()
+	c.Assert(r.Names(), jc.DeepEquals, []string{"decorrelated", "exponential", "linear"})
+	params := schedule.DelayParams{
+		Min:   time.Second,
+		Max:   time.Minute,
+		Clock: coretesting.NewClock(time.Time{}),
+	}
+
+	s, err := r.New(schedule.DelayExponential, params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s, gc.FitsTypeOf, &schedule.ExponentialBackoff{})
+	c.Assert(s.Delay(), gc.Equals, time.Duration(0))
+	c.Assert(s.Delay(), gc.Equals, time.Second)
+	c.Assert(s.Delay(), gc.Equals, 2*time.Second)
+
+	params.Step = 3 * time.Second
+	s, err = r.New(schedule.DelayLinear, params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s, gc.FitsTypeOf, &schedule.LinearBackoff{})
+	s.Delay()
+	c.Assert(s.Delay(), gc.Equals, time.Second)
+	c.Assert(s.Delay(), gc.Equals, 4*time.Second)
+
+	s, err = r.New(schedule.DelayDecorrelated, params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s, gc.FitsTypeOf, &schedule.DecorrelatedBackoff{})
+}
+
+func (*registrySuite) TestRestoreAttempts(c *gc.C) {
+	r := schedule.NewDelayRegistry()
+	s, err := r.New(schedule.DelayExponential, schedule.DelayParams{
+		Min:      time.Second,
+		Clock:    coretesting.NewClock(time.Time{}),
+		Attempts: 3,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.Attempts(), gc.Equals, 3)
+	c.Assert(s.Delay(), gc.Equals, 4*time.Second)
+}
+
+func (*registrySuite) TestRegister(c *gc.C) {
+	r := schedule.NewDelayRegistry()
+	constant := func(params schedule.DelayParams) (schedule.DelayStrategy, error) {
+		return &schedule.LinearBackoff{Initial: params.Min, Min: params.Min, Step: 1, Max: params.Min}, nil
+	}
+	c.Assert(r.Register("constant", constant), jc.ErrorIsNil)
+	c.Assert(r.Names(), jc.DeepEquals, []string{"constant", "decorrelated", "exponential", "linear"})
+	s, err := r.New("constant", schedule.DelayParams{Min: time.Minute})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.Delay(), gc.Equals, time.Minute)
+	c.Assert(s.Delay(), gc.Equals, time.Minute)
+
+	err = r.Register("linear", constant)
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Assert(err, gc.ErrorMatches, `delay strategy "linear" already exists`)
+	c.Assert(r.Register("", constant), gc.ErrorMatches, "empty name not valid")
+	c.Assert(r.Register("nil", nil), gc.ErrorMatches, "nil factory not valid")
+}
+
+func (*registrySuite) TestNewErrors(c *gc.C) {
+	r := schedule.NewDelayRegistry()
+	_, err := r.New("quadratic", schedule.DelayParams{})
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `delay strategy "quadratic" not found`)
+	_, err = r.New("linear", schedule.DelayParams{Step: -1})
+	c.Assert(err, gc.ErrorMatches, "validating delay params: negative Step not valid")
+
+	c.Assert(r.Register("broken", func(schedule.DelayParams) (schedule.DelayStrategy, error) {
+		return nil, errors.New("no")
+	}), jc.ErrorIsNil)
+	_, err = r.New("broken", schedule.DelayParams{})
+	c.Assert(err, gc.ErrorMatches, `creating delay strategy "broken": no`)
+}
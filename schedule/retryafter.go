@@ -0,0 +1,109 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// httpDateFormats holds the formats of HTTP-dates: the preferred
+// IMF-fixdate format, followed by the obsolete RFC 850 and ANSI C
+// asctime formats, which recipients must also accept.
+var httpDateFormats = []string{
+	"Mon, 02 Jan 2006 15:04:05 GMT",
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+// maxRetryAfter is the longest delay returned by ParseRetryAfter; larger
+// numbers of seconds, which would overflow a Duration, are truncated.
+const maxRetryAfter = 1<<63 - 1
+
+// ParseRetryAfter parses the value of a Retry-After header, which is
+// either a number of seconds to wait, or an HTTP-date after which to
+// retry, and returns the delay it specifies relative to now. A date in
+// the past specifies no delay.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value != "" && strings.Trim(value, "0123456789") == "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds > int64(maxRetryAfter/time.Second) {
+			return maxRetryAfter, nil
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	for _, format := range httpDateFormats {
+		t, err := time.Parse(format, value)
+		if err != nil {
+			continue
+		}
+		if d := t.Sub(now); d > 0 {
+			return d, nil
+		}
+		return 0, nil
+	}
+	return 0, errors.NotValidf("Retry-After %q", value)
+}
+
+// HintedBackoff is a type that can be embedded in an Operation to
+// implement the Delay() method, providing exponential backoff as for
+// ExponentialBackoff, except that the delay for the next attempt may be
+// overridden by a hint, such as the Retry-After header of a response
+// from a service that specifies when to try again.
+//
+// A hint overrides a single delay; the backoff continues to grow with
+// each attempt, so that subsequent attempts without hints are delayed
+// as if there had been none.
+type HintedBackoff struct {
+	ExponentialBackoff
+
+	hint   time.Duration
+	hinted bool
+}
+
+// Hint sets the delay to apply to the next attempt, replacing any
+// previous hint. Negative delays are treated as zero.
+func (h *HintedBackoff) Hint(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.hint = d
+	h.hinted = true
+}
+
+// HintRetryAfter sets the delay to apply to the next attempt from the
+// value of a Retry-After header, as parsed by ParseRetryAfter with the
+// backoff's clock. An empty value is ignored.
+func (h *HintedBackoff) HintRetryAfter(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	d, err := ParseRetryAfter(value, h.clock().Now())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	h.Hint(d)
+	return nil
+}
+
+// Delay is part of the Operation interface.
+func (h *HintedBackoff) Delay() time.Duration {
+	d := h.ExponentialBackoff.Delay()
+	if h.hinted {
+		d = h.hint
+		h.hinted = false
+	}
+	return d
+}
+
+// Reset resets the backoff to its initial state, discarding any hint.
+func (h *HintedBackoff) Reset() {
+	h.ExponentialBackoff.Reset()
+	h.hint = 0
+	h.hinted = false
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type retryAfterSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&retryAfterSuite{})
+
+func (*retryAfterSuite) TestParseRetryAfter(c *gc.C) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	for _, test := range []struct {
+		value  string
+		expect time.Duration
+	}{
+		{"120", 2 * time.Minute},
+		{" 0 ", 0},
+		{"99999999999999999999", 1<<63 - 1},
+		{"Wed, 21 Oct 2015 07:30:00 GMT", 2 * time.Minute},
+		{"Wednesday, 21-Oct-15 07:28:30 GMT", 30 * time.Second},
+		{"Wed Oct 21 07:29:00 2015", time.Minute},
+		{"Wed, 21 Oct 2015 07:00:00 GMT", 0},
+	} {
+		c.Logf("%q", test.value)
+		d, err := schedule.ParseRetryAfter(test.value, now)
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(d, gc.Equals, test.expect)
+	}
+	for _, value := range []string{"", "-1", "1.5", "tomorrow", "2015-10-21T07:30:00Z"} {
+		_, err := schedule.ParseRetryAfter(value, now)
+		c.Check(err, gc.ErrorMatches, `Retry-After ".*" not valid`)
+	}
+}
+
+func (*retryAfterSuite) TestHintedBackoff(c *gc.C) {
+	clock := coretesting.NewClock(time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC))
+	b := schedule.HintedBackoff{
+		ExponentialBackoff: schedule.ExponentialBackoff{
+			Min:   time.Second,
+			Clock: clock,
+		},
+	}
+	c.Assert(b.Delay(), gc.Equals, time.Duration(0))
+	c.Assert(b.Delay(), gc.Equals, time.Second)
+
+	// A hint overrides only the next delay; the backoff
+	// continues to grow as if there had been no hint.
+	b.Hint(time.Minute)
+	c.Assert(b.Delay(), gc.Equals, time.Minute)
+	c.Assert(b.Delay(), gc.Equals, 4*time.Second)
+
+	c.Assert(b.HintRetryAfter("Wed, 21 Oct 2015 07:30:00 GMT"), jc.ErrorIsNil)
+	c.Assert(b.HintRetryAfter(""), jc.ErrorIsNil)
+	c.Assert(b.Delay(), gc.Equals, 2*time.Minute)
+	c.Assert(b.HintRetryAfter("soon"), gc.ErrorMatches, `Retry-After "soon" not valid`)
+	c.Assert(b.Delay(), gc.Equals, 16*time.Second)
+
+	b.Hint(time.Hour)
+	b.Reset()
+	c.Assert(b.Delay(), gc.Equals, time.Duration(0))
+	c.Assert(b.Attempts(), gc.Equals, 1)
+}
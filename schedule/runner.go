@@ -0,0 +1,854 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/logging"
+	"github.com/axw/juju-time/pool"
+	"github.com/juju/errors"
+)
+
+// RunnableOperation is the interface for operations executed by a Runner.
+type RunnableOperation[K comparable] interface {
+	Operation[K]
+
+	// Do executes the operation. If Do returns an error or panics,
+	// the Runner's error policy determines what happens to the
+	// operation; by default, it will be rescheduled, with its Delay
+	// method determining when it will next be executed.
+	Do(ctx context.Context) error
+}
+
+// RunnerConfig holds the configuration for a Runner.
+type RunnerConfig[K comparable, O RunnableOperation[K]] struct {
+	// Schedule is the schedule from which the Runner takes ready
+	// operations. The Runner takes ownership of the schedule; once
+	// the Runner is started, the schedule must only be manipulated
+	// via the Runner's methods.
+	Schedule *Schedule[K, O]
+
+	// OnPanic, if non-nil, is called when an operation's Do method
+	// panics, with the recovered value and the stack trace of the
+	// panicking goroutine. The operation is rescheduled after OnPanic
+	// returns.
+	OnPanic func(op O, value interface{}, stack []byte)
+
+	// MaxConcurrent, if positive, is the maximum number of operations
+	// that the Runner will execute concurrently. Ready operations in
+	// excess of the limit are queued, in the order they became ready,
+	// until an executing operation completes.
+	MaxConcurrent int
+
+	// IdleWorkers is the maximum number of idle goroutines that the
+	// Runner keeps for executing operations, so that it need not
+	// start a goroutine for each execution; see pool.Config.Idle. If
+	// IdleWorkers is zero, MaxConcurrent is used.
+	IdleWorkers int
+
+	// FairDispatch, if true, causes queued operations to be executed
+	// in weighted round-robin order across their groups (see
+	// GroupedOperation), rather than in the order they became ready,
+	// so that no single group can monopolize the Runner. Each group
+	// takes its turn executing up to its weight in operations.
+	FairDispatch bool
+
+	// GroupWeights holds the weights of groups for fair dispatch.
+	// Groups without a positive weight have weight 1.
+	GroupWeights map[string]int
+
+	// GroupLimits holds the maximum number of operations in each group
+	// that the Runner will execute concurrently, so that the operations
+	// of one group, such as those for a single machine, cannot occupy
+	// all of the slots allowed by MaxConcurrent. Ready operations in a
+	// group at its limit remain queued, in order, until one of the
+	// group's executing operations completes, while those of other
+	// groups are started. Groups without a positive limit are limited
+	// only by MaxConcurrent.
+	GroupLimits map[string]int
+
+	// ErrorPolicy, if non-nil, is called with each operation that
+	// fails, along with the error that it returned (or an error
+	// describing its panic), and determines what the Runner does
+	// with the operation. If ErrorPolicy is nil, or returns an
+	// unknown action, failed operations are retried as for
+	// ActionRetry.
+	//
+	// ErrorPolicy is called without any locks held, and so may
+	// call the Runner's methods.
+	ErrorPolicy func(op O, err error) ErrorAction
+
+	// LatencyClass, if non-nil, is called with each operation after
+	// it executes, and returns the class under which its execution
+	// duration is recorded; e.g. its key, formatted with fmt.Sprint,
+	// or its group. See Runner.Latency. LatencyClass is called
+	// without any locks held.
+	LatencyClass func(op O) string
+
+	// Delivery, if non-nil, records the lag between the time for which
+	// each operation was scheduled and the time at which it starts
+	// executing, including any time for which it waits for its
+	// dependencies or for MaxConcurrent. See DeliveryTracker. Configure
+	// the Schedule with a DeliveryTracker instead to measure only the
+	// lag until operations are ready.
+	Delivery *DeliveryTracker[K]
+
+	// OnExecute, if non-nil, is called as each operation starts
+	// executing, with the context that would be passed to its Do
+	// method, and a description of the execution. OnExecute returns
+	// the context to pass to Do instead, and a function, which may be
+	// nil, to call with the error returned by Do when it completes.
+	// OnExecute may be used to trace executions, for example by
+	// starting a span. OnExecute and the function that it returns are
+	// called without any locks held.
+	OnExecute func(ctx context.Context, op O, exec Execution[K]) (context.Context, func(error))
+
+	// Logger, if non-nil, is used to log the Runner's decisions:
+	// executions at debug level, and failed operations being retried,
+	// dropped or parked as warnings. Logger's methods may be called
+	// with the Runner's lock held, and so must not call the Runner's
+	// methods. Use logging.NewRateLimited to limit the rate at which
+	// failures are logged.
+	Logger logging.Logger
+
+	// LatencyHalfLife is the half-life of the moving averages of
+	// recorded execution durations. If LatencyHalfLife is zero,
+	// one minute is used.
+	LatencyHalfLife time.Duration
+
+	// ExecutionTimeout, if positive, is the maximum duration of each
+	// execution of operations that do not declare their own timeout;
+	// see TimeoutOperation.
+	ExecutionTimeout time.Duration
+
+	// MaxLifetime, if positive, is the maximum time for which a failing
+	// operation is retried: once MaxLifetime has passed since the first
+	// of its consecutive failed executions started, an operation whose
+	// execution fails is dropped rather than retried, and reported to
+	// OnExpire. This prevents operations that can never succeed, such
+	// as those for entities that no longer exist, from being retried
+	// forever. Operations parked by the error policy are not affected.
+	MaxLifetime time.Duration
+
+	// OnExpire, if non-nil, is called with each operation that is
+	// dropped on exceeding MaxLifetime, along with the error returned
+	// by its last execution. OnExpire is called without any locks
+	// held, and so may call the Runner's methods.
+	OnExpire func(op O, err error)
+
+	// MaxExecutionTimeout, if greater than an execution's timeout, is
+	// the maximum duration to which the execution may extend its
+	// timeout with heartbeats, for operations that do not declare
+	// their own maximum; see ExtendableOperation.
+	MaxExecutionTimeout time.Duration
+
+	// DeadLetterSize, if positive, is the number of operations dropped
+	// by the error policy, or on exceeding MaxLifetime, that the Runner
+	// keeps in its dead letters, along with their failure histories, so
+	// that they may be inspected and resubmitted; once there are more,
+	// the oldest are discarded. Parked operations are always kept. See
+	// Runner.DeadLetters.
+	DeadLetterSize int
+
+	// BacklogHighWater, if positive, is the size of the Runner's ready
+	// backlog, the ready operations waiting for a free slot or for
+	// their dependencies, at which the Runner signals backpressure to
+	// its producers by calling OnBacklog with true, so that they may
+	// slow down. Once the backlog has fallen to BacklogLowWater, the
+	// Runner calls OnBacklog with false. Operations held back in the
+	// schedule by its rate limit are not counted; see Watchdog for
+	// detecting those.
+	BacklogHighWater int
+
+	// BacklogLowWater is the size of the ready backlog at which the
+	// Runner stops signalling backpressure. BacklogLowWater must be
+	// less than BacklogHighWater.
+	BacklogLowWater int
+
+	// OnBacklog is called when the Runner starts signalling
+	// backpressure, with true, and when it stops, with false; see
+	// BacklogHighWater. Calls alternate, starting with true, and are
+	// made from a single goroutine without any locks held; a backlog
+	// that crosses and recrosses its watermarks before OnBacklog is
+	// called may not be reported. OnBacklog must be non-nil if
+	// BacklogHighWater is positive.
+	OnBacklog func(high bool)
+}
+
+// Validate checks that the config is valid.
+func (config RunnerConfig[K, O]) Validate() error {
+	if config.Schedule == nil {
+		return errors.NotValidf("nil Schedule")
+	}
+	if config.Schedule.ackTimeout > 0 {
+		return errors.NotValidf("Schedule with AckTimeout")
+	}
+	if config.MaxConcurrent < 0 {
+		return errors.NotValidf("negative MaxConcurrent")
+	}
+	for group, limit := range config.GroupLimits {
+		if limit < 0 {
+			return errors.NotValidf("negative GroupLimits[%q]", group)
+		}
+	}
+	if config.IdleWorkers < 0 {
+		return errors.NotValidf("negative IdleWorkers")
+	}
+	if config.LatencyHalfLife < 0 {
+		return errors.NotValidf("negative LatencyHalfLife")
+	}
+	if config.ExecutionTimeout < 0 {
+		return errors.NotValidf("negative ExecutionTimeout")
+	}
+	if config.MaxExecutionTimeout < 0 {
+		return errors.NotValidf("negative MaxExecutionTimeout")
+	}
+	if config.MaxLifetime < 0 {
+		return errors.NotValidf("negative MaxLifetime")
+	}
+	if config.DeadLetterSize < 0 {
+		return errors.NotValidf("negative DeadLetterSize")
+	}
+	if config.BacklogHighWater < 0 {
+		return errors.NotValidf("negative BacklogHighWater")
+	}
+	if config.BacklogHighWater > 0 {
+		if config.BacklogLowWater < 0 || config.BacklogLowWater >= config.BacklogHighWater {
+			return errors.NotValidf("BacklogLowWater %d with BacklogHighWater %d", config.BacklogLowWater, config.BacklogHighWater)
+		}
+		if config.OnBacklog == nil {
+			return errors.NotValidf("nil OnBacklog")
+		}
+	}
+	return nil
+}
+
+// Runner executes operations from a Schedule as they become ready. Each
+// ready operation is executed in a goroutine from the Runner's pool,
+// subject to the limits on concurrent operations; operations that fail,
+// or panic, are handled according to the error policy, and by default
+// are rescheduled. A panic in one operation will not affect the Runner
+// or any other operations.
+//
+// Runner's methods are safe for concurrent use.
+type Runner[K comparable, O RunnableOperation[K]] struct {
+	config RunnerConfig[K, O]
+	logger logging.Logger
+
+	mu       sync.Mutex
+	schedule *Schedule[K, O]
+
+	// blocked holds ready operations waiting for the operations
+	// that they depend on to complete, in the order they became
+	// ready. See DependentOperation.
+	blocked []queuedOperation[O]
+
+	// queued holds ready operations waiting for a free slot.
+	queued *dispatchQueue[K, O]
+
+	// parked holds failed operations set aside by the error
+	// policy, in the order that they were parked.
+	parked []DeadLetter[O]
+
+	// dropped holds the most recent operations dropped by the
+	// error policy, or on exceeding MaxLifetime, in the order
+	// that they were dropped, if DeadLetterSize is positive.
+	dropped []DeadLetter[O]
+
+	// active is the number of operations currently executing,
+	// executing holds the number executing for each key, and
+	// groupActive the number executing for each group that has
+	// a limit in GroupLimits.
+	active      int
+	executing   map[K]int
+	groupActive map[string]int
+
+	// executions holds the currently executing operations, keyed
+	// by a unique execution ID.
+	executions    map[uint64]execution[O]
+	nextExecution uint64
+
+	// latencies records execution durations, if the config
+	// has a LatencyClass function.
+	latencies *latencyTracker
+
+	// counts records the outcomes of executions.
+	counts runnerCounts
+
+	// attempts records, for each key whose last execution failed
+	// and whose operation was retried or parked, the number of
+	// consecutive failed executions.
+	attempts map[K]attempt
+
+	// draining records that Drain has been called, so the Runner
+	// takes no more ready operations from the schedule, and drained
+	// is closed once no operations are executing or queued.
+	draining bool
+	drained  chan struct{}
+
+	// backlogHigh records whether the Runner is signalling
+	// backpressure, and backlogChanged is signalled when it starts
+	// or stops, so that the backlog goroutine calls OnBacklog.
+	backlogHigh    bool
+	backlogChanged chan struct{}
+
+	// wake is signalled whenever the schedule is modified
+	// outside of the loop, so the loop re-evaluates Next.
+	wake chan struct{}
+
+	// pool executes operations. The Runner limits concurrency
+	// itself, so the pool's size is unlimited.
+	pool *pool.Pool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRunner constructs and starts a new Runner with the given
+// configuration. The Runner will continue to run until it is
+// killed.
+func NewRunner[K comparable, O RunnableOperation[K]](config RunnerConfig[K, O]) (*Runner[K, O], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating runner config")
+	}
+	idle := config.IdleWorkers
+	if idle == 0 {
+		idle = config.MaxConcurrent
+	}
+	logger := logging.OrNop(config.Logger)
+	workers, err := pool.New(pool.Config{
+		Idle: idle,
+		OnPanic: func(v interface{}, stack []byte) {
+			logger.Errorf("runner goroutine panicked: %v\n%s", v, stack)
+		},
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Runner[K, O]{
+		config:      config,
+		logger:      logger,
+		schedule:    config.Schedule,
+		queued:      newDispatchQueue[K, O](config.FairDispatch, config.GroupWeights, config.Schedule.priorityAging),
+		executing:   make(map[K]int),
+		groupActive: make(map[string]int),
+		executions:  make(map[uint64]execution[O]),
+		attempts:    make(map[K]attempt),
+		wake:        make(chan struct{}, 1),
+		pool:        workers,
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	if config.LatencyClass != nil {
+		r.latencies = newLatencyTracker(config.Schedule.time, config.LatencyHalfLife)
+	}
+	if config.BacklogHighWater > 0 {
+		r.backlogChanged = make(chan struct{}, 1)
+	}
+	go r.loop()
+	return r, nil
+}
+
+// Kill stops the Runner, and cancels the contexts passed to any
+// executing operations. Kill does not wait for the Runner to stop;
+// use Wait for that.
+func (r *Runner[K, O]) Kill() {
+	r.cancel()
+}
+
+// Wait waits for the Runner to stop, including waiting for all
+// executing operations to return.
+func (r *Runner[K, O]) Wait() error {
+	<-r.done
+	return nil
+}
+
+// Add adds an operation to the Runner's schedule. See Schedule.Add.
+func (r *Runner[K, O]) Add(op O) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	return r.schedule.Add(op)
+}
+
+// TryAdd adds an operation to the Runner's schedule, returning an error
+// rather than panicking if it cannot be added. See Schedule.TryAdd.
+func (r *Runner[K, O]) TryAdd(op O) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	return r.schedule.TryAdd(op)
+}
+
+// AddOrAdvance adds an operation to the Runner's schedule, keeping the
+// earlier of its time and that of any pending operation with the same
+// key. See Schedule.AddOrAdvance.
+func (r *Runner[K, O]) AddOrAdvance(op O) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	return r.schedule.AddOrAdvance(op)
+}
+
+// AddAll adds operations to the Runner's schedule. See Schedule.AddAll.
+func (r *Runner[K, O]) AddAll(ops []O) []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	return r.schedule.AddAll(ops)
+}
+
+// TryAddAll adds operations to the Runner's schedule, returning an error
+// rather than panicking if any cannot be added. See Schedule.TryAddAll.
+func (r *Runner[K, O]) TryAddAll(ops []O) ([]time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	return r.schedule.TryAddAll(ops)
+}
+
+// Remove removes a pending operation from the Runner's schedule, from
+// the ready operations waiting to execute, or from the parked
+// operations. Remove does not affect the operation if it is currently
+// executing. See Schedule.Remove.
+func (r *Runner[K, O]) Remove(key K) (O, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	op, ok := r.remove(key)
+	if ok {
+		delete(r.attempts, key)
+		r.unblock()
+		r.startQueued()
+	}
+	return op, ok
+}
+
+func (r *Runner[K, O]) remove(key K) (O, bool) {
+	if op, ok := r.schedule.Remove(key); ok {
+		return op, true
+	}
+	for i, q := range r.blocked {
+		if q.op.Key() == key {
+			r.blocked = append(r.blocked[:i], r.blocked[i+1:]...)
+			return q.op, true
+		}
+	}
+	if op, ok := r.removeParked(key); ok {
+		return op, true
+	}
+	return r.queued.remove(key)
+}
+
+func (r *Runner[K, O]) removeParked(key K) (O, bool) {
+	letter, ok := removeDeadLetter(&r.parked, key)
+	return letter.Op, ok
+}
+
+// Clear removes all pending operations from the Runner's schedule, all
+// ready operations waiting to execute, and all parked operations,
+// calling f, if non-nil, with each of them. Clear does not affect
+// operations that are currently executing. See Schedule.Clear.
+//
+// f is called while the Runner's schedule is locked, and so must not
+// call any of the Runner's methods.
+func (r *Runner[K, O]) Clear(f func(op O)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	queued := append(r.blocked, r.queued.drain()...)
+	parked := r.parked
+	r.blocked = nil
+	r.parked = nil
+	r.attempts = make(map[K]attempt)
+	r.schedule.Clear(f)
+	r.checkBacklog()
+	if f != nil {
+		for _, q := range queued {
+			f(q.op)
+		}
+		for _, letter := range parked {
+			f(letter.Op)
+		}
+	}
+}
+
+// Active returns the number of operations currently executing.
+func (r *Runner[K, O]) Active() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.active
+}
+
+// Queued returns the number of ready operations waiting to execute,
+// due to the limit on concurrent operations.
+func (r *Runner[K, O]) Queued() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.queued.size
+}
+
+// Blocked returns the number of ready operations waiting for the
+// operations that they depend on to complete.
+func (r *Runner[K, O]) Blocked() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.blocked)
+}
+
+// Parked returns the operations that have been parked by the error
+// policy, in the order that they were parked.
+func (r *Runner[K, O]) Parked() []O {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.parkedOps()
+}
+
+// parkedOps returns the parked operations. parkedOps
+// must be called with r.mu held.
+func (r *Runner[K, O]) parkedOps() []O {
+	var ops []O
+	for _, letter := range r.parked {
+		ops = append(ops, letter.Op)
+	}
+	return ops
+}
+
+// Unpark removes the parked operation with the specified key, and adds
+// it back to the Runner's schedule, as if by TryAdd. Unpark reports
+// whether or not the operation was unparked; if there is no parked
+// operation with the key, or the operation cannot be added, because
+// another with the same key has been added since it was parked, the
+// schedule is full, or the Runner is draining, Unpark returns false
+// and the operation remains parked.
+func (r *Runner[K, O]) Unpark(key K) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	letter, ok := removeDeadLetter(&r.parked, key)
+	if !ok {
+		return false
+	}
+	if _, err := r.schedule.TryAdd(letter.Op); err != nil {
+		restoreDeadLetter(&r.parked, letter)
+		return false
+	}
+	r.notify()
+	return true
+}
+
+// notify wakes the loop so it will re-evaluate the schedule.
+func (r *Runner[K, O]) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner[K, O]) loop() {
+	defer close(r.done)
+	defer r.pool.Wait()
+	defer r.pool.Close()
+	defer r.requeue()
+	if r.backlogChanged != nil {
+		backlogDone := make(chan struct{})
+		go r.backlogLoop(backlogDone)
+		defer func() { <-backlogDone }()
+	}
+	for {
+		r.mu.Lock()
+		var next <-chan time.Time
+		if !r.draining {
+			next = r.schedule.Next()
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.wake:
+		case <-next:
+			r.mu.Lock()
+			now := r.schedule.time.Now()
+			for _, item := range r.schedule.readyItems(now, nil, -1) {
+				r.blocked = append(r.blocked, queuedOperation[O]{item.Value, item.Time, now})
+				r.counts.ready++
+			}
+			r.unblock()
+			r.startQueued()
+			r.mu.Unlock()
+		}
+	}
+}
+
+// startQueued starts executing queued operations, until there are none
+// left, the concurrency limit is reached, or the groups of those left
+// are at their limits. startQueued must be called with r.mu held.
+func (r *Runner[K, O]) startQueued() {
+	if r.ctx.Err() != nil {
+		return
+	}
+	now := r.schedule.time.Now()
+	for r.queued.size > 0 {
+		if r.config.MaxConcurrent > 0 && r.active >= r.config.MaxConcurrent {
+			break
+		}
+		q, ok := r.queued.pop(now, r.groupFull)
+		if !ok {
+			break
+		}
+		op := q.op
+		id := r.nextExecution
+		r.nextExecution++
+		r.active++
+		r.executing[op.Key()]++
+		if group := operationGroup(op); r.config.GroupLimits[group] > 0 {
+			r.groupActive[group]++
+		}
+		started := r.schedule.time.Now()
+		if r.config.Delivery != nil {
+			r.config.Delivery.record(op.Key(), operationTraceID(op), q.scheduled, started)
+		}
+		r.executions[id] = execution[O]{op, started}
+		exec := r.newExecution(q, started)
+		if !r.pool.TryGo(func(context.Context) { r.run(id, op, exec) }) {
+			// The pool is closed, so the Runner is stopping.
+			r.active--
+			r.finished(id, op.Key())
+			r.requeueOne(q)
+			continue
+		}
+	}
+	r.checkBacklog()
+	r.checkDrained()
+}
+
+// groupFull reports whether the group has as many executing operations
+// as its limit allows. groupFull must be called with r.mu held.
+func (r *Runner[K, O]) groupFull(group string) bool {
+	limit := r.config.GroupLimits[group]
+	return limit > 0 && r.groupActive[group] >= limit
+}
+
+// unblock queues blocked operations whose dependencies have all
+// completed. unblock must be called with r.mu held.
+func (r *Runner[K, O]) unblock() {
+	for i := 0; i < len(r.blocked); {
+		q := r.blocked[i]
+		if r.dependenciesPending(q.op) {
+			i++
+			continue
+		}
+		r.blocked = append(r.blocked[:i], r.blocked[i+1:]...)
+		r.queued.push(q)
+	}
+}
+
+// dependenciesPending reports whether any of the operations that op
+// depends on are pending. dependenciesPending must be called with r.mu
+// held.
+func (r *Runner[K, O]) dependenciesPending(op O) bool {
+	for _, key := range operationDependencies[K](op) {
+		if key != op.Key() && r.pending(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// pending reports whether an operation with the specified key is
+// scheduled, waiting to execute, executing, or parked. pending must be
+// called with r.mu held.
+func (r *Runner[K, O]) pending(key K) bool {
+	if _, _, ok := r.schedule.q.Get(key); ok {
+		return true
+	}
+	if r.executing[key] > 0 || r.queued.has(key) {
+		return true
+	}
+	for _, letter := range r.parked {
+		if letter.Op.Key() == key {
+			return true
+		}
+	}
+	for _, q := range r.blocked {
+		if q.op.Key() == key {
+			return true
+		}
+	}
+	return false
+}
+
+// requeue returns any blocked or queued operations to the schedule,
+// when the Runner is stopping, so they are not lost.
+func (r *Runner[K, O]) requeue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requeueLocked()
+}
+
+// requeueLocked is like requeue, but must be called with r.mu held.
+func (r *Runner[K, O]) requeueLocked() {
+	queued := append(r.blocked, r.queued.drain()...)
+	r.blocked = nil
+	for _, q := range queued {
+		r.requeueOne(q)
+	}
+	r.checkBacklog()
+}
+
+// requeueOne returns a ready operation to the schedule, for the time
+// it became ready, unless another with the same key has been added.
+// requeueOne must be called with r.mu held.
+func (r *Runner[K, O]) requeueOne(q queuedOperation[O]) {
+	if _, _, ok := r.schedule.q.Get(q.op.Key()); !ok {
+		r.schedule.q.Add(q.op.Key(), q.op, q.ready)
+	}
+}
+
+// run executes the operation, handling it according to the error policy
+// if it fails, and then starts the next queued operation, along with any
+// operations that were waiting for it to complete.
+func (r *Runner[K, O]) run(id uint64, op O, exec Execution[K]) {
+	r.logger.Debugf("executing operation %s (attempt %d, scheduled %v ago)", describeOperation(exec.Key, op), exec.Attempt, exec.Started.Sub(exec.Scheduled))
+	ctx, timedOut := r.timeoutContext(r.ctx, op)
+	var done func(error)
+	if r.config.OnExecute != nil {
+		ctx, done = r.config.OnExecute(ctx, op, exec)
+	}
+	err := timedOut(r.do(ctx, op))
+	if done != nil {
+		done(err)
+	}
+	now := r.schedule.time.Now()
+	if r.latencies != nil {
+		r.latencies.observe(r.config.LatencyClass(op), now.Sub(exec.Started))
+	}
+	action := ActionRetry
+	if err != nil && r.config.ErrorPolicy != nil {
+		action = r.config.ErrorPolicy(op, err)
+	}
+	expired := err != nil && action != ActionDrop && action != ActionPark &&
+		r.config.MaxLifetime > 0 && now.Sub(exec.FirstStarted) >= r.config.MaxLifetime
+	if expired {
+		action = ActionDrop
+		if r.config.OnExpire != nil {
+			r.config.OnExpire(op, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active--
+	r.counts.executed++
+	key := op.Key()
+	r.finished(id, key)
+	previous := r.attempts[key]
+	delete(r.attempts, key)
+	if err != nil {
+		r.counts.failed++
+		failures := recordFailure(previous.failures, exec, now, err)
+		desc := describeOperation(key, op)
+		switch action {
+		case ActionRetryNow:
+			r.logger.Warningf("operation %s failed (attempt %d), retrying now: %v", desc, exec.Attempt, err)
+			r.counts.retried++
+			r.recordAttempt(key, exec, ctx, failures)
+			r.reschedule(op, true)
+		case ActionDrop:
+			reason := DeadLetterDropped
+			if expired {
+				r.logger.Warningf("operation %s failed (attempt %d), expired after %v: %v", desc, exec.Attempt, r.config.MaxLifetime, err)
+				r.counts.expired++
+				reason = DeadLetterExpired
+			} else {
+				r.logger.Warningf("operation %s failed (attempt %d), dropping: %v", desc, exec.Attempt, err)
+			}
+			r.counts.dropped++
+			r.addDropped(DeadLetter[O]{Op: op, Reason: reason, Time: now, Failures: failures})
+		case ActionPark:
+			r.logger.Warningf("operation %s failed (attempt %d), parking: %v", desc, exec.Attempt, err)
+			r.counts.parked++
+			r.recordAttempt(key, exec, ctx, failures)
+			r.parked = append(r.parked, DeadLetter[O]{Op: op, Reason: DeadLetterParked, Time: now, Failures: failures})
+		default:
+			r.logger.Warningf("operation %s failed (attempt %d), retrying: %v", desc, exec.Attempt, err)
+			r.counts.retried++
+			r.recordAttempt(key, exec, ctx, failures)
+			r.reschedule(op, false)
+		}
+	}
+	r.unblock()
+	r.startQueued()
+}
+
+// finished forgets the execution with the specified ID, of an operation
+// with the specified key. finished must be called with r.mu held.
+func (r *Runner[K, O]) finished(id uint64, key K) {
+	if group := operationGroup(r.executions[id].op); r.groupActive[group] > 0 {
+		r.groupActive[group]--
+		if r.groupActive[group] == 0 {
+			delete(r.groupActive, group)
+		}
+	}
+	delete(r.executions, id)
+	r.executing[key]--
+	if r.executing[key] == 0 {
+		delete(r.executing, key)
+	}
+}
+
+// execution records an executing operation.
+type execution[O any] struct {
+	op      O
+	started time.Time
+}
+
+// do calls the operation's Do method, recovering from any panic.
+func (r *Runner[K, O]) do(ctx context.Context, op O) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if r.config.OnPanic != nil {
+				r.config.OnPanic(op, v, debug.Stack())
+			}
+			err = errors.Errorf("operation %v panicked: %v", op.Key(), v)
+		}
+	}()
+	return op.Do(ctx)
+}
+
+// reschedule adds the operation back to the schedule, unless another
+// operation with the same key was added while it was executing. If
+// now is true, the operation is scheduled for the current time, rather
+// than according to its delay. If the schedule is bounded and full,
+// the operation is dropped. reschedule must be called with r.mu held.
+func (r *Runner[K, O]) reschedule(op O, now bool) {
+	if _, _, ok := r.schedule.q.Get(op.Key()); ok {
+		return
+	}
+	var err error
+	if now {
+		t := r.schedule.time.Now()
+		err = r.schedule.addAt(t, op, t)
+	} else {
+		// Failed operations are rescheduled even while draining.
+		_, err = r.schedule.tryAdd(op, r.schedule.coalesce)
+	}
+	if err != nil {
+		r.logger.Warningf("dropping operation %s: %v", describeOperation(op.Key(), op), err)
+		r.counts.dropped++
+		delete(r.attempts, op.Key())
+		if r.schedule.onDrop != nil {
+			r.schedule.onDrop(op)
+		}
+		return
+	}
+	r.notify()
+}
@@ -0,0 +1,1089 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type runnerSuite struct {
+	coretesting.BaseSuite
+	clock    *coretesting.Clock
+	schedule *schedule.Schedule[string, *runnableOperation]
+}
+
+var _ = gc.Suite(&runnerSuite{})
+
+func (s *runnerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.schedule = schedule.NewSchedule[string, *runnableOperation](s.clock)
+}
+
+func (s *runnerSuite) newRunner(c *gc.C, config schedule.RunnerConfig[string, *runnableOperation]) *schedule.Runner[string, *runnableOperation] {
+	config.Schedule = s.schedule
+	r, err := schedule.NewRunner(config)
+	c.Assert(err, jc.ErrorIsNil)
+	return r
+}
+
+func (s *runnerSuite) TestValidate(c *gc.C) {
+	_, err := schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{})
+	c.Assert(err, gc.ErrorMatches, "validating runner config: nil Schedule not valid")
+	acked, err := schedule.New(schedule.Config[string, *runnableOperation]{
+		Clock:      s.clock,
+		AckTimeout: time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{Schedule: acked})
+	c.Assert(err, gc.ErrorMatches, "validating runner config: Schedule with AckTimeout not valid")
+	_, err = schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+		Schedule:    s.schedule,
+		IdleWorkers: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating runner config: negative IdleWorkers not valid")
+	_, err = schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+		Schedule:    s.schedule,
+		GroupLimits: map[string]int{"a": -1},
+	})
+	c.Assert(err, gc.ErrorMatches, `validating runner config: negative GroupLimits\["a"\] not valid`)
+	_, err = schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+		Schedule:         s.schedule,
+		ExecutionTimeout: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating runner config: negative ExecutionTimeout not valid")
+	_, err = schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+		Schedule:            s.schedule,
+		MaxExecutionTimeout: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating runner config: negative MaxExecutionTimeout not valid")
+	_, err = schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+		Schedule:    s.schedule,
+		MaxLifetime: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating runner config: negative MaxLifetime not valid")
+	_, err = schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+		Schedule:       s.schedule,
+		DeadLetterSize: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating runner config: negative DeadLetterSize not valid")
+}
+
+func (s *runnerSuite) TestRunsReadyOperations(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	ran := make(chan string)
+	for _, key := range []string{"k0", "k1"} {
+		r.Add(&runnableOperation{key: key, do: func(op *runnableOperation, ctx context.Context) error {
+			ran <- op.key
+			return nil
+		}})
+	}
+	keys := map[string]bool{}
+	keys[receive(c, ran)] = true
+	keys[receive(c, ran)] = true
+	c.Assert(keys, jc.DeepEquals, map[string]bool{"k0": true, "k1": true})
+	assertNotReceived(c, ran)
+}
+
+func (s *runnerSuite) TestRescheduleOnError(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	attempts := make(chan int)
+	var n int
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		n++
+		attempts <- n
+		if n == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	}})
+	c.Assert(receive(c, attempts), gc.Equals, 1)
+	c.Assert(advanceUntil(c, s.clock, attempts, 30*time.Second), gc.Equals, 2)
+	assertNotReceived(c, attempts)
+}
+
+func (s *runnerSuite) TestRescheduleOnPanic(c *gc.C) {
+	panics := make(chan interface{}, 1)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		OnPanic: func(op *runnableOperation, value interface{}, stack []byte) {
+			c.Check(op.key, gc.Equals, "k0")
+			c.Check(string(stack), gc.Matches, "(?s).*runtime/debug.Stack.*")
+			panics <- value
+		},
+	})
+	defer r.Kill()
+
+	attempts := make(chan int)
+	var n int
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		n++
+		attempts <- n
+		if n == 1 {
+			panic("boom")
+		}
+		return nil
+	}})
+	c.Assert(receive(c, attempts), gc.Equals, 1)
+	c.Assert(receive(c, panics), gc.Equals, "boom")
+
+	// The runner survives, and the operation is retried with backoff.
+	c.Assert(advanceUntil(c, s.clock, attempts, 30*time.Second), gc.Equals, 2)
+}
+
+func (s *runnerSuite) TestKillCancelsOperations(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+
+	started := make(chan struct{})
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	receive(c, started)
+	r.Kill()
+	c.Assert(r.Wait(), jc.ErrorIsNil)
+}
+
+func (s *runnerSuite) TestMaxConcurrent(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{MaxConcurrent: 2})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(map[string]chan struct{})
+	for i, key := range []string{"k0", "k1", "k2", "k3"} {
+		release[key] = make(chan struct{})
+		r.Add(&runnableOperation{
+			key:                key,
+			ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Duration(i+1) * time.Millisecond},
+			do: func(op *runnableOperation, ctx context.Context) error {
+				started <- op.key
+				<-release[op.key]
+				return nil
+			},
+		})
+	}
+	// k0 and k1 start concurrently, in no particular order.
+	keys := map[string]bool{}
+	keys[advanceUntil(c, s.clock, started, 4*time.Millisecond)] = true
+	keys[receive(c, started)] = true
+	c.Assert(keys, jc.DeepEquals, map[string]bool{"k0": true, "k1": true})
+	assertNotReceived(c, started)
+
+	close(release["k1"])
+	c.Assert(receive(c, started), gc.Equals, "k2")
+	assertNotReceived(c, started)
+	close(release["k0"])
+	c.Assert(receive(c, started), gc.Equals, "k3")
+	close(release["k2"])
+	close(release["k3"])
+}
+
+func (s *runnerSuite) TestQueuedOperationsRemovable(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{MaxConcurrent: 1})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(chan struct{})
+	do := func(op *runnableOperation, ctx context.Context) error {
+		started <- op.key
+		<-release
+		return nil
+	}
+	r.Add(&runnableOperation{key: "k0", do: do})
+	c.Assert(receive(c, started), gc.Equals, "k0")
+	r.Add(&runnableOperation{key: "k1", do: do})
+	r.Add(&runnableOperation{key: "k2", do: do})
+
+	// Wait for the operations to be queued, then remove one.
+	waitUntil(c, "operations to be queued", func() bool { return r.Queued() >= 2 })
+	c.Assert(r.Active(), gc.Equals, 1)
+	_, ok := r.Remove("k1")
+	c.Assert(ok, jc.IsTrue)
+	close(release)
+	c.Assert(receive(c, started), gc.Equals, "k2")
+	assertNotReceived(c, started)
+}
+
+func (s *runnerSuite) TestRemove(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	ran := make(chan string)
+	do := func(op *runnableOperation, ctx context.Context) error {
+		ran <- op.key
+		return nil
+	}
+	r.Add(&runnableOperation{key: "k0", do: do, ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Second}})
+	r.Add(&runnableOperation{key: "k1", do: do, ExponentialBackoff: schedule.ExponentialBackoff{Initial: 2 * time.Second}})
+	r.Remove("k0")
+	c.Assert(advanceUntil(c, s.clock, ran, time.Second), gc.Equals, "k1")
+	assertNotReceived(c, ran)
+}
+
+func (s *runnerSuite) TestFairDispatch(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		MaxConcurrent: 1,
+		FairDispatch:  true,
+		GroupWeights:  map[string]int{"a": 2},
+	})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(chan struct{})
+	do := func(op *runnableOperation, ctx context.Context) error {
+		started <- op.key
+		<-release
+		return nil
+	}
+	r.Add(&runnableOperation{key: "k0", do: do})
+	c.Assert(receive(c, started), gc.Equals, "k0")
+
+	// Group "a" has most of the ready operations, but must
+	// take turns with the other groups.
+	for i, key := range []string{"a0", "a1", "a2", "a3", "b0", "c0"} {
+		r.Add(&runnableOperation{
+			key:                key,
+			group:              key[:1],
+			ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Duration(i+1) * time.Millisecond},
+			do:                 do,
+		})
+	}
+	s.clock.Advance(6 * time.Millisecond)
+	waitUntil(c, "operations to be queued", func() bool { return r.Queued() >= 6 })
+	close(release)
+	var keys []string
+	for i := 0; i < 6; i++ {
+		keys = append(keys, receive(c, started))
+	}
+	c.Assert(keys, jc.DeepEquals, []string{"a0", "a1", "b0", "c0", "a2", "a3"})
+}
+
+func (s *runnerSuite) TestGroupLimits(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		MaxConcurrent: 3,
+		GroupLimits:   map[string]int{"a": 2},
+	})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(map[string]chan struct{})
+	for i, key := range []string{"a0", "a1", "a2", "a3", "b0", "b1"} {
+		release[key] = make(chan struct{})
+		r.Add(&runnableOperation{
+			key:                key,
+			group:              key[:1],
+			ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Duration(i+1) * time.Millisecond},
+			do: func(op *runnableOperation, ctx context.Context) error {
+				started <- op.key
+				<-release[op.key]
+				return nil
+			},
+		})
+	}
+	s.clock.Advance(6 * time.Millisecond)
+
+	// Group "a" may only take two of the slots; the
+	// operations held back keep their order.
+	keys := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		keys[receive(c, started)] = true
+	}
+	c.Assert(keys, jc.DeepEquals, map[string]bool{"a0": true, "a1": true, "b0": true})
+	assertNotReceived(c, started)
+	c.Assert(r.Queued(), gc.Equals, 3)
+
+	// A slot freed by group "b" is taken by group "b",
+	// since group "a" is still at its limit.
+	close(release["b0"])
+	c.Assert(receive(c, started), gc.Equals, "b1")
+	assertNotReceived(c, started)
+	close(release["a1"])
+	c.Assert(receive(c, started), gc.Equals, "a2")
+	close(release["b1"])
+	assertNotReceived(c, started)
+	close(release["a0"])
+	c.Assert(receive(c, started), gc.Equals, "a3")
+	close(release["a2"])
+	close(release["a3"])
+}
+
+func (s *runnerSuite) TestPriorityAging(c *gc.C) {
+	var err error
+	s.schedule, err = schedule.New(schedule.Config[string, *runnableOperation]{
+		Clock:         s.clock,
+		PriorityAging: time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{MaxConcurrent: 1})
+	defer r.Kill()
+
+	started := make(chan string)
+	release := make(chan struct{})
+	do := func(op *runnableOperation, ctx context.Context) error {
+		started <- op.key
+		<-release
+		return nil
+	}
+	add := func(key string, priority int) {
+		r.Add(&runnableOperation{
+			key:                key,
+			priority:           priority,
+			ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Millisecond},
+			do:                 do,
+		})
+	}
+	r.Add(&runnableOperation{key: "k0", do: do})
+	c.Assert(receive(c, started), gc.Equals, "k0")
+
+	// The higher priority operation is started first.
+	add("low", 0)
+	add("high0", 1)
+	s.clock.Advance(time.Millisecond)
+	waitUntil(c, "operations to be queued", func() bool { return r.Queued() >= 2 })
+	release <- struct{}{}
+	c.Assert(receive(c, started), gc.Equals, "high0")
+
+	// Having waited for two seconds, the low priority operation
+	// is preferred to one that has only just become ready.
+	s.clock.Advance(2 * time.Second)
+	add("high1", 1)
+	s.clock.Advance(time.Millisecond)
+	waitUntil(c, "operations to be queued", func() bool { return r.Queued() >= 2 })
+	release <- struct{}{}
+	c.Assert(receive(c, started), gc.Equals, "low")
+	release <- struct{}{}
+	c.Assert(receive(c, started), gc.Equals, "high1")
+	close(release)
+}
+
+func (s *runnerSuite) TestDependencies(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	ran := make(chan string)
+	var unmounts int
+	r.Add(&runnableOperation{
+		key:                "unmount",
+		ExponentialBackoff: schedule.ExponentialBackoff{Initial: 2 * time.Millisecond},
+		do: func(op *runnableOperation, ctx context.Context) error {
+			ran <- op.key
+			unmounts++
+			if unmounts == 1 {
+				return errors.New("busy")
+			}
+			return nil
+		},
+	})
+	r.Add(&runnableOperation{
+		key:                "detach",
+		dependsOn:          []string{"unmount"},
+		ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Millisecond},
+		do: func(op *runnableOperation, ctx context.Context) error {
+			ran <- op.key
+			return nil
+		},
+	})
+
+	// detach is ready first, but must wait for unmount to succeed.
+	c.Assert(advanceUntil(c, s.clock, ran, 2*time.Millisecond), gc.Equals, "unmount")
+	assertNotReceived(c, ran)
+	c.Assert(r.Blocked(), gc.Equals, 1)
+	c.Assert(advanceUntil(c, s.clock, ran, 30*time.Second), gc.Equals, "unmount")
+	c.Assert(receive(c, ran), gc.Equals, "detach")
+	c.Assert(r.Blocked(), gc.Equals, 0)
+}
+
+func (s *runnerSuite) TestRemoveDependency(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	ran := make(chan string)
+	do := func(op *runnableOperation, ctx context.Context) error {
+		ran <- op.key
+		return nil
+	}
+	r.Add(&runnableOperation{key: "k0", do: do, ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Hour}})
+	r.Add(&runnableOperation{key: "k1", do: do, dependsOn: []string{"k0"}})
+	waitUntil(c, "operation to be blocked", func() bool { return r.Blocked() >= 1 })
+	r.Remove("k0")
+	c.Assert(receive(c, ran), gc.Equals, "k1")
+}
+
+func (s *runnerSuite) TestErrorPolicy(c *gc.C) {
+	errRetryNow := errors.New("retry now")
+	errPark := errors.New("park")
+	errDrop := errors.New("drop")
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			switch err {
+			case errRetryNow:
+				return schedule.ActionRetryNow
+			case errPark:
+				return schedule.ActionPark
+			case errDrop:
+				return schedule.ActionDrop
+			}
+			return schedule.ActionRetry
+		},
+	})
+	defer r.Kill()
+
+	ran := make(chan error)
+	results := []error{errRetryNow, errPark, errDrop}
+	op := &runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		err := results[0]
+		results = results[1:]
+		ran <- err
+		return err
+	}}
+	r.Add(op)
+	c.Assert(receive(c, ran), gc.Equals, errRetryNow)
+	c.Assert(receive(c, ran), gc.Equals, errPark)
+	waitUntil(c, "operation to be parked", func() bool { return len(r.Parked()) > 0 })
+	c.Assert(r.Parked(), jc.DeepEquals, []*runnableOperation{op})
+	assertNotReceived(c, ran)
+
+	c.Assert(r.Unpark("k0"), jc.IsTrue)
+	c.Assert(r.Unpark("k0"), jc.IsFalse)
+	c.Assert(r.Parked(), gc.HasLen, 0)
+	c.Assert(advanceUntil(c, s.clock, ran, 30*time.Second), gc.Equals, errDrop)
+	s.clock.Advance(time.Hour)
+	assertNotReceived(c, ran)
+}
+
+func (s *runnerSuite) TestUnparkDuplicateKey(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			return schedule.ActionPark
+		},
+	})
+	defer r.Kill()
+
+	ran := make(chan struct{})
+	op := &runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		ran <- struct{}{}
+		return errors.New("park")
+	}}
+	r.Add(op)
+	receive(c, ran)
+	waitUntil(c, "operation to be parked", func() bool { return len(r.Parked()) > 0 })
+
+	// Another operation with the same key has been added since
+	// the first was parked, so it cannot be unparked.
+	r.Add(&runnableOperation{key: "k0", ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Hour}})
+	c.Assert(r.Unpark("k0"), jc.IsFalse)
+	c.Assert(r.Parked(), jc.DeepEquals, []*runnableOperation{op})
+}
+
+func (s *runnerSuite) TestDeadLetters(c *gc.C) {
+	errRetryNow := errors.New("retry now")
+	errPark := errors.New("park")
+	errDrop := errors.New("drop")
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		DeadLetterSize: 1,
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			switch err {
+			case errRetryNow:
+				return schedule.ActionRetryNow
+			case errPark:
+				return schedule.ActionPark
+			}
+			return schedule.ActionDrop
+		},
+	})
+	defer r.Kill()
+
+	ran := make(chan string)
+	results := map[string][]error{
+		"park":  {errRetryNow, errPark, nil},
+		"drop0": {errDrop},
+		"drop1": {errDrop, nil},
+	}
+	do := func(op *runnableOperation, ctx context.Context) error {
+		err := results[op.key][0]
+		results[op.key] = results[op.key][1:]
+		ran <- op.key
+		return err
+	}
+	park := &runnableOperation{key: "park", do: do}
+	r.Add(park)
+	c.Assert(receive(c, ran), gc.Equals, "park")
+	c.Assert(receive(c, ran), gc.Equals, "park")
+	waitUntil(c, "operation to be parked", func() bool { return len(r.DeadLetters()) == 1 })
+	letters := r.DeadLetters()
+	c.Assert(letters[0].Op, gc.Equals, park)
+	c.Assert(letters[0].Reason, gc.Equals, schedule.DeadLetterParked)
+	c.Assert(letters[0].Failures, gc.HasLen, 2)
+	c.Assert(letters[0].Failures[0].Attempt, gc.Equals, 1)
+	c.Assert(letters[0].Failures[0].Err, gc.Equals, errRetryNow)
+	c.Assert(letters[0].Failures[1].Attempt, gc.Equals, 2)
+	c.Assert(letters[0].Failures[1].Err, gc.Equals, errPark)
+
+	// Only the most recently dropped operation is kept.
+	for _, key := range []string{"drop0", "drop1"} {
+		r.Add(&runnableOperation{key: key, do: do})
+		c.Assert(receive(c, ran), gc.Equals, key)
+		waitUntil(c, "operation to be dropped", func() bool {
+			letters := r.DeadLetters()
+			return len(letters) == 2 && letters[1].Op.key == key
+		})
+	}
+	letters = r.DeadLetters()
+	c.Assert(letters[1].Reason, gc.Equals, schedule.DeadLetterDropped)
+	c.Assert(letters[1].Failures, gc.HasLen, 1)
+	c.Assert(letters[1].Failures[0].Err, gc.Equals, errDrop)
+	c.Assert(r.Snapshot().DeadLetters, jc.DeepEquals, letters)
+
+	c.Assert(r.Resubmit("drop0"), jc.IsFalse)
+	c.Assert(r.Resubmit("drop1"), jc.IsTrue)
+	c.Assert(advanceUntil(c, s.clock, ran, 30*time.Second), gc.Equals, "drop1")
+	c.Assert(r.Resubmit("park"), jc.IsTrue)
+	c.Assert(advanceUntil(c, s.clock, ran, 30*time.Second), gc.Equals, "park")
+	waitUntil(c, "operations to succeed", func() bool { return r.Stats().Executed == 6 })
+	c.Assert(r.DeadLetters(), gc.HasLen, 0)
+	c.Assert(r.Parked(), gc.HasLen, 0)
+}
+
+func (s *runnerSuite) TestResubmitDuplicateKey(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		DeadLetterSize: 1,
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			return schedule.ActionDrop
+		},
+	})
+	defer r.Kill()
+
+	ran := make(chan struct{})
+	op := &runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		ran <- struct{}{}
+		return errors.New("drop")
+	}}
+	r.Add(op)
+	receive(c, ran)
+	waitUntil(c, "operation to be dropped", func() bool { return len(r.DeadLetters()) > 0 })
+	letters := r.DeadLetters()
+
+	// Another operation with the same key has been added since
+	// the first was dropped, so it cannot be resubmitted.
+	r.Add(&runnableOperation{key: "k0", ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Hour}})
+	c.Assert(r.Resubmit("k0"), jc.IsFalse)
+	c.Assert(r.DeadLetters(), jc.DeepEquals, letters)
+}
+
+func (s *runnerSuite) TestExecutionTimeout(c *gc.C) {
+	failures := make(chan error, 10)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		ExecutionTimeout: time.Minute,
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			failures <- err
+			if !schedule.IsTimeout(err) {
+				return schedule.ActionDrop
+			}
+			return schedule.ActionRetryNow
+		},
+	})
+	defer r.Kill()
+
+	// An execution that exceeds the operation's timeout has its
+	// context cancelled, and fails with a TimeoutError.
+	var n int
+	attempts := make(chan int, 10)
+	r.Add(&runnableOperation{key: "k0", timeout: 10 * time.Second, do: func(op *runnableOperation, ctx context.Context) error {
+		n++
+		attempts <- n
+		if n == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}})
+	c.Assert(receive(c, attempts), gc.Equals, 1)
+	err := advanceUntil(c, s.clock, failures, 10*time.Second)
+	c.Assert(err, gc.ErrorMatches, "timed out after 10s: context deadline exceeded")
+	c.Assert(schedule.IsTimeout(err), jc.IsTrue)
+	c.Assert(errors.Is(err, context.DeadlineExceeded), jc.IsTrue)
+	c.Assert(receive(c, attempts), gc.Equals, 2)
+
+	// Operations without a timeout of their own are
+	// limited by the Runner's ExecutionTimeout.
+	r.Add(&runnableOperation{key: "k1", do: func(op *runnableOperation, ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+		case <-time.After(coretesting.LongWait):
+			c.Errorf("context not cancelled")
+		}
+		return errors.New("hung")
+	}})
+	err = advanceUntil(c, s.clock, failures, 10*time.Second)
+	c.Assert(err, gc.ErrorMatches, "timed out after 1m0s: hung")
+
+	// Errors returned within the timeout are not timeouts.
+	r.Add(&runnableOperation{key: "k2", do: func(op *runnableOperation, ctx context.Context) error {
+		return errors.New("failed")
+	}})
+	err = receive(c, failures)
+	c.Assert(err, gc.ErrorMatches, "failed")
+	c.Assert(schedule.IsTimeout(err), jc.IsFalse)
+}
+
+func (s *runnerSuite) TestHeartbeat(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	harness := clocktesting.NewHarness(clock)
+	failures := make(chan error, 10)
+	r, err := schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{
+		Schedule: schedule.NewSchedule[string, *runnableOperation](clock),
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			failures <- err
+			return schedule.ActionDrop
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer func() {
+		r.Kill()
+		c.Check(r.Wait(), jc.ErrorIsNil)
+		harness.AssertNoLeaks(c)
+	}()
+
+	// Each heartbeat extends the execution's deadline to a full
+	// timeout from now, up to the operation's maximum timeout.
+	beats := make(chan struct{})
+	extended := make(chan bool)
+	r.Add(&runnableOperation{key: "k0", timeout: 10 * time.Second, maxTimeout: 30 * time.Second, do: func(op *runnableOperation, ctx context.Context) error {
+		hb := schedule.HeartbeatFromContext(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-beats:
+				extended <- hb.Beat()
+			}
+		}
+	}})
+	beat := func() bool {
+		beats <- struct{}{}
+		return receive(c, extended)
+	}
+	c.Assert(beat(), jc.IsFalse) // T+0, already a full timeout away
+	harness.AdvanceAndSettle(c, 5*time.Second)
+	c.Assert(beat(), jc.IsTrue) // T+5, deadline T+15
+	harness.AdvanceAndSettle(c, 9*time.Second)
+	c.Assert(beat(), jc.IsTrue) // T+14, deadline T+24
+	harness.AdvanceAndSettle(c, 9*time.Second)
+	c.Assert(beat(), jc.IsTrue) // T+23, deadline capped at T+30
+	harness.AdvanceAndSettle(c, 6*time.Second)
+	c.Assert(beat(), jc.IsFalse) // T+29
+	assertNotReceived(c, failures)
+
+	harness.AdvanceAndSettle(c, time.Second)
+	err = receive(c, failures)
+	c.Assert(err, gc.ErrorMatches, "timed out after 30s: context deadline exceeded")
+	c.Assert(schedule.IsTimeout(err), jc.IsTrue)
+
+	// Executions whose timeout may not be extended have no Heartbeat,
+	// and the nil Heartbeat does nothing.
+	r.Add(&runnableOperation{key: "k1", timeout: 10 * time.Second, do: func(op *runnableOperation, ctx context.Context) error {
+		hb := schedule.HeartbeatFromContext(ctx)
+		if hb != nil || hb.Beat() {
+			return errors.New("unexpected heartbeat")
+		}
+		return errors.New("done")
+	}})
+	c.Assert(receive(c, failures), gc.ErrorMatches, "done")
+}
+
+// advanceUntil repeatedly advances the clock by d until a value is
+// received on ch. We cannot know when the runner has rescheduled an
+// operation, so we keep advancing until it has run again.
+func (s *runnerSuite) TestLatency(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		// Operations are executed one at a time, so
+		// that each may advance the clock in turn.
+		MaxConcurrent: 1,
+		LatencyClass: func(op *runnableOperation) string {
+			return op.group
+		},
+	})
+	defer r.Kill()
+
+	_, ok := r.Latency("g0")
+	c.Assert(ok, jc.IsFalse)
+	for i, d := range []time.Duration{time.Second, 3 * time.Second, 2 * time.Second} {
+		group := "g0"
+		if i == 2 {
+			group = "g1"
+		}
+		d := d
+		r.Add(&runnableOperation{key: fmt.Sprint("k", i), group: group, do: func(op *runnableOperation, ctx context.Context) error {
+			s.clock.Advance(d)
+			return nil
+		}})
+	}
+	waitUntil(c, "latencies recorded", func() bool {
+		g0, _ := r.Latency("g0")
+		g1, _ := r.Latency("g1")
+		return g0.Count == 2 && g1.Count == 1
+	})
+
+	latencies := r.Latencies()
+	c.Assert(latencies, gc.HasLen, 2)
+	g0 := latencies["g0"]
+	c.Assert(g0.Max, gc.Equals, 3*time.Second)
+	c.Assert(g0.Mean > time.Second && g0.Mean < 3*time.Second, jc.IsTrue, gc.Commentf("mean %v", g0.Mean))
+	g1 := latencies["g1"]
+	c.Assert(g1.Max, gc.Equals, 2*time.Second)
+	c.Assert(g1.Last, gc.Equals, 2*time.Second)
+	c.Assert(g1.Mean, gc.Equals, 2*time.Second)
+}
+
+func (s *runnerSuite) TestLatencyDisabled(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{})
+	defer r.Kill()
+
+	ran := make(chan struct{})
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		close(ran)
+		return nil
+	}})
+	receive(c, ran)
+	c.Assert(r.Latencies(), gc.HasLen, 0)
+}
+
+func (s *runnerSuite) TestSnapshot(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{MaxConcurrent: 1})
+	defer r.Kill()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	t0 := s.clock.Now()
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}})
+	receive(c, started)
+	noop := func(op *runnableOperation, ctx context.Context) error { return nil }
+	r.Add(&runnableOperation{key: "k1", do: noop})
+	r.Add(&runnableOperation{key: "k2", do: noop, ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Minute}})
+	waitUntil(c, "k1 queued", func() bool { return r.Queued() == 1 })
+
+	snapshot := r.Snapshot()
+	c.Assert(snapshot.Time, gc.Equals, t0)
+	c.Assert(snapshot.Executing, gc.HasLen, 1)
+	c.Assert(snapshot.Executing[0].Op.key, gc.Equals, "k0")
+	c.Assert(snapshot.Executing[0].Started, gc.Equals, t0)
+	c.Assert(snapshot.Queued, gc.HasLen, 1)
+	c.Assert(snapshot.Queued[0].key, gc.Equals, "k1")
+	c.Assert(snapshot.Pending, gc.HasLen, 1)
+	c.Assert(snapshot.Pending[0].Op.key, gc.Equals, "k2")
+	c.Assert(snapshot.Pending[0].Time, gc.Equals, t0.Add(time.Minute))
+	c.Assert(snapshot.Blocked, gc.HasLen, 0)
+	c.Assert(snapshot.Parked, gc.HasLen, 0)
+	c.Assert(snapshot.AuditLog, gc.IsNil)
+}
+
+func (s *runnerSuite) TestStats(c *gc.C) {
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			switch op.key {
+			case "drop":
+				return schedule.ActionDrop
+			case "park":
+				return schedule.ActionPark
+			}
+			return schedule.ActionRetry
+		},
+	})
+	defer r.Kill()
+
+	fail := func(op *runnableOperation, ctx context.Context) error {
+		return errors.New("failed")
+	}
+	for _, key := range []string{"drop", "park", "retry"} {
+		r.Add(&runnableOperation{key: key, do: fail})
+	}
+	r.Add(&runnableOperation{key: "ok", do: func(op *runnableOperation, ctx context.Context) error {
+		return nil
+	}})
+	waitUntil(c, "operations executed", func() bool { return r.Stats().Executed == 4 })
+	c.Assert(r.Stats(), jc.DeepEquals, schedule.RunnerStats{
+		Pending:     1,
+		Parked:      1,
+		Ready:       4,
+		Executed:    4,
+		Failed:      3,
+		Retried:     1,
+		Dropped:     1,
+		ParkedTotal: 1,
+	})
+}
+
+func (s *runnerSuite) TestMaxLifetime(c *gc.C) {
+	type expiry struct {
+		key string
+		err error
+	}
+	expired := make(chan expiry, 1)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		MaxLifetime: 25 * time.Second,
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			return schedule.ActionRetryNow
+		},
+		OnExpire: func(op *runnableOperation, err error) {
+			expired <- expiry{op.key, err}
+		},
+	})
+	defer r.Kill()
+
+	// Each execution takes 10s, and fails; the third ends
+	// beyond the operation's lifetime, and so is not retried.
+	var attempts int
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		attempts++
+		s.clock.Advance(10 * time.Second)
+		return errors.New("failed")
+	}})
+	e := receive(c, expired)
+	c.Assert(e.key, gc.Equals, "k0")
+	c.Assert(e.err, gc.ErrorMatches, "failed")
+	waitUntil(c, "operation dropped", func() bool { return r.Stats().Dropped == 1 })
+	c.Assert(attempts, gc.Equals, 3)
+	c.Assert(r.Stats(), jc.DeepEquals, schedule.RunnerStats{
+		Ready:    3,
+		Executed: 3,
+		Failed:   3,
+		Retried:  2,
+		Dropped:  1,
+		Expired:  1,
+	})
+}
+
+func (s *runnerSuite) TestOnExecute(c *gc.C) {
+	type attemptKey struct{}
+	type call struct {
+		exec schedule.Execution[string]
+		err  error
+	}
+	calls := make(chan call, 10)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		OnExecute: func(ctx context.Context, op *runnableOperation, exec schedule.Execution[string]) (context.Context, func(error)) {
+			ctx = context.WithValue(ctx, attemptKey{}, exec.Attempt)
+			return ctx, func(err error) {
+				calls <- call{exec, err}
+			}
+		},
+	})
+	defer r.Kill()
+
+	t0 := s.clock.Now()
+	failed := errors.New("failed")
+	var n int
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		n++
+		// The operation is passed the context returned by OnExecute.
+		c.Check(ctx.Value(attemptKey{}), gc.Equals, n)
+		if n < 3 {
+			return failed
+		}
+		return nil
+	}})
+
+	first := receive(c, calls)
+	c.Assert(first.err, gc.Equals, failed)
+	c.Assert(first.exec.Key, gc.Equals, "k0")
+	c.Assert(first.exec.Attempt, gc.Equals, 1)
+	c.Assert(first.exec.Scheduled, gc.Equals, t0)
+	c.Assert(first.exec.Ready, gc.Equals, t0)
+	c.Assert(first.exec.Started, gc.Equals, t0)
+	c.Assert(first.exec.FirstStarted, gc.Equals, t0)
+	c.Assert(first.exec.Previous, gc.IsNil)
+	c.Assert(first.exec.Clock, gc.Equals, s.clock)
+
+	// Retries are linked to the previous attempt.
+	second := advanceUntil(c, s.clock, calls, 30*time.Second)
+	c.Assert(second.err, gc.Equals, failed)
+	c.Assert(second.exec.Attempt, gc.Equals, 2)
+	c.Assert(second.exec.Scheduled, gc.Equals, t0.Add(30*time.Second))
+	c.Assert(second.exec.Ready.Before(second.exec.Scheduled), jc.IsFalse)
+	c.Assert(second.exec.Previous.Value(attemptKey{}), gc.Equals, 1)
+	c.Assert(second.exec.FirstStarted, gc.Equals, t0)
+
+	third := advanceUntil(c, s.clock, calls, 30*time.Second)
+	c.Assert(third.err, jc.ErrorIsNil)
+	c.Assert(third.exec.Attempt, gc.Equals, 3)
+	c.Assert(third.exec.Previous.Value(attemptKey{}), gc.Equals, 2)
+
+	// Success resets the count.
+	r.Add(&runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		return nil
+	}})
+	fourth := receive(c, calls)
+	c.Assert(fourth.exec.Attempt, gc.Equals, 1)
+	c.Assert(fourth.exec.Previous, gc.IsNil)
+}
+
+func (s *runnerSuite) TestLogger(c *gc.C) {
+	logger := &recordingLogger{}
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		Logger: logger,
+		ErrorPolicy: func(op *runnableOperation, err error) schedule.ErrorAction {
+			if op.key == "drop" {
+				return schedule.ActionDrop
+			}
+			return schedule.ActionRetry
+		},
+	})
+	defer r.Kill()
+
+	do := func(op *runnableOperation, ctx context.Context) error {
+		return errors.New("failed")
+	}
+	r.Add(&runnableOperation{key: "drop", do: do})
+	waitUntil(c, "operation executed", func() bool { return r.Stats().Executed == 1 })
+	r.Add(&runnableOperation{key: "retry", do: do})
+	waitUntil(c, "operation executed", func() bool { return r.Stats().Executed == 2 })
+	c.Assert(logger.list(), jc.DeepEquals, []string{
+		"DEBUG: executing operation drop (attempt 1, scheduled 0s ago)",
+		"WARNING: operation drop failed (attempt 1), dropping: failed",
+		"DEBUG: executing operation retry (attempt 1, scheduled 0s ago)",
+		"WARNING: operation retry failed (attempt 1), retrying: failed",
+	})
+}
+
+func advanceUntil[T any](c *gc.C, clock *coretesting.Clock, ch <-chan T, d time.Duration) T {
+	timeout := time.After(coretesting.LongWait)
+	for {
+		clock.Advance(d)
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(coretesting.ShortWait):
+		case <-timeout:
+			c.Fatalf("timed out waiting for value")
+		}
+	}
+}
+
+// waitUntil waits for cond to return true, polling it periodically.
+func waitUntil(c *gc.C, what string, cond func() bool) {
+	timeout := time.After(coretesting.LongWait)
+	for !cond() {
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for %s", what)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotReceived[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected value: %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+// recordingLogger is a logging.Logger that records the
+// messages logged to it.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) logf(level, format string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level+": "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.messages...)
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.logf("DEBUG", format, args)
+}
+
+func (l *recordingLogger) Infof(format string, args ...interface{}) {
+	l.logf("INFO", format, args)
+}
+
+func (l *recordingLogger) Warningf(format string, args ...interface{}) {
+	l.logf("WARNING", format, args)
+}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.logf("ERROR", format, args)
+}
+
+type runnableOperation struct {
+	schedule.ExponentialBackoff
+	key        string
+	group      string
+	timeout    time.Duration
+	maxTimeout time.Duration
+	priority   int
+	dependsOn  []string
+	traceID    string
+	do         func(op *runnableOperation, ctx context.Context) error
+}
+
+func (o *runnableOperation) Key() string {
+	return o.key
+}
+
+func (o *runnableOperation) Timeout() time.Duration {
+	return o.timeout
+}
+
+func (o *runnableOperation) MaxTimeout() time.Duration {
+	return o.maxTimeout
+}
+
+func (o *runnableOperation) Priority() int {
+	return o.priority
+}
+
+func (o *runnableOperation) Group() string {
+	return o.group
+}
+
+func (o *runnableOperation) DependsOn() []string {
+	return o.dependsOn
+}
+
+func (o *runnableOperation) TraceID() string {
+	return o.traceID
+}
+
+func (o *runnableOperation) Do(ctx context.Context) error {
+	return o.do(o, ctx)
+}
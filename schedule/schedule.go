@@ -4,10 +4,13 @@
 package schedule
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/axw/juju-time/clock"
 	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
 )
 
 // Schedule provides a schedule of operations, with the following properties:
@@ -20,15 +23,82 @@ import (
 //  - fast to add and remove operations by key: O(log(n)); n is the total number of operations
 //  - fast to identify the next queued operation: O(log(n))
 //  - fast to remove arbitrary operations: O(log(n))
-type Schedule struct {
-	time clock.Clock
-	q    *timequeue.Queue
+//
+// Schedule is parameterised over the operations' key type K, and the
+// operation type O, so that callers get back the concrete operation
+// type from Ready without any type assertions.
+type Schedule[K comparable, O Operation[K]] struct {
+	time     clock.Clock
+	q        *timequeue.Queue[K, O]
+	coalesce CoalescePolicy
+	limiter  *rateLimiter
+
+	maxPending int
+	evictLess  func(a, b timequeue.Item[K, O]) bool
+	onDrop     func(O)
+
+	// smoothing is the interval over which bursts of ready operations
+	// are spread, and smoothed holds the keys of operations that have
+	// been deferred by smoothing, and so will not be deferred again.
+	smoothing time.Duration
+	smoothed  map[K]bool
+
+	// warmUp is the window over which the operations that are overdue
+	// when the schedule is restored, or resumes after being paused, are
+	// spread, and resuming records that the schedule has been found
+	// paused, so that it warms up when it resumes.
+	warmUp   time.Duration
+	resuming bool
+
+	// quota, if non-nil, tracks the quotas consumed by operations, and
+	// reserved holds the keys of operations that have reserved quota
+	// but have not been released, and so will not reserve it again.
+	quota    QuotaTracker
+	reserved map[K]bool
+
+	// delayOverride, if non-nil, overrides the delays
+	// computed for operations; see Config.DelayOverride.
+	delayOverride DelayOverride[O]
+
+	// priorityAging, if positive, is the interval of waiting
+	// for which an operation's priority is boosted by one.
+	priorityAging time.Duration
+
+	// ackTimeout, if positive, is the time for which operations
+	// returned by Ready are held in flight, and inflight holds
+	// the keys of the in-flight operations.
+	ackTimeout time.Duration
+	inflight   map[K]struct{}
+
+	// draining records that the schedule no longer accepts new
+	// operations; see Drain.
+	draining bool
+
+	// auditLog, if non-nil, records the schedule's decisions.
+	auditLog *auditLog[K]
+
+	// delivery, if non-nil, records the lag of ready operations.
+	delivery *DeliveryTracker[K]
+
+	// health, if non-nil, is the schedule's time, which pauses or
+	// measures monotonic time while the Clock is unreliable.
+	health *healthClock
+
+	// timer is reused by Next when the schedule is rate limited.
+	timer clock.Timer
+
+	// locker, if non-nil, is released by Pop while it waits, and
+	// changed is signalled when operations are added or removed,
+	// so that a waiting Pop can rearm its timer.
+	locker  sync.Locker
+	changed chan struct{}
 }
 
-// Operation is the interface for schedule operations.
-type Operation interface {
+// Operation is the interface for schedule operations, whose keys are
+// of type K.
+type Operation[K comparable] interface {
 	// Key uniquely identifies the schedule operation.
-	Key() interface{}
+	Key() K
 
 	// Delay is the duration to add to the current time
 	// when enqueuing the operation, to determine the
@@ -36,44 +106,958 @@ type Operation interface {
 	Delay() time.Duration
 }
 
+// Config holds the configuration for a Schedule.
+type Config[K comparable, O Operation[K]] struct {
+	// Clock is used for the Next and Add methods.
+	Clock clock.Clock
+
+	// Coalesce determines what happens when an operation is added
+	// with the same key as an already-scheduled operation. The
+	// default is to panic.
+	Coalesce CoalescePolicy
+
+	// RateLimit, if non-zero, limits the rate at which operations
+	// are released by Ready.
+	RateLimit RateLimit
+
+	// MaxPending, if positive, is the maximum number of operations
+	// that the schedule will hold.
+	MaxPending int
+
+	// Overflow determines what happens when an operation is added
+	// to a schedule already holding MaxPending operations. The
+	// default is to reject the new operation.
+	Overflow OverflowPolicy
+
+	// OnDrop, if non-nil, is called with each pending operation
+	// that is dropped from the schedule to make room for another,
+	// according to the Overflow policy.
+	OnDrop func(op O)
+
+	// Smoothing, if positive, is the interval over which Ready spreads
+	// bursts of ready operations. When more than one operation is ready,
+	// Ready returns only the first, and reschedules the remainder evenly
+	// across the interval, so that a large batch of operations becoming
+	// ready at once (for example, after a restart) does not result in a
+	// thundering herd. Operations are deferred by smoothing at most once.
+	// Smoothing involves no randomness, so the operations' times are
+	// reproducible.
+	Smoothing time.Duration
+
+	// WarmUp, if positive, is the window over which the operations that
+	// are overdue when the schedule is restored, by Restore, or when it
+	// resumes after being paused while its Clock was unreliable (see
+	// UnhealthyClockPause), are spread evenly, in order of their times:
+	// the first is left as it is, and the others are rescheduled at equal
+	// intervals across the window, rather than all becoming ready at once
+	// and overwhelming the services that they call. Unlike Smoothing,
+	// WarmUp does not affect operations becoming ready in normal operation.
+	WarmUp time.Duration
+
+	// PriorityAging, if positive, causes the ready operations released
+	// by a rate limited schedule to be chosen by priority, rather than
+	// time (see PrioritizedOperation), with each operation's priority
+	// boosted by one for every PriorityAging for which it has waited
+	// past its scheduled time, so that low priority operations are not
+	// starved by a steady supply of higher priority ones; the chosen
+	// operations are still returned in order of time. A Runner for the
+	// schedule likewise chooses by aged priority among the operations
+	// waiting for a free slot, within each group's turn if its dispatch
+	// is fair.
+	PriorityAging time.Duration
+
+	// AckTimeout, if positive, causes the schedule to hand out ready
+	// operations in two phases, so that operations are not lost if
+	// their consumer fails to process them. The operations returned by
+	// Ready, ReadyMatching and Pop are not removed from the schedule,
+	// but held in flight until acknowledged with Ack, or returned to
+	// the schedule with Nack. An operation that is neither acknowledged
+	// nor returned within AckTimeout becomes ready again, and is
+	// returned by Ready once more. Adding an operation with the key of
+	// an in-flight operation replaces it, as a new pending operation.
+	//
+	// In-flight operations are held in the schedule, and so count
+	// towards MaxPending, and are returned by Get, DueWithin and
+	// Flush, for the time at which their ack timeouts pass. A schedule
+	// with an AckTimeout may not be used by a Runner.
+	AckTimeout time.Duration
+
+	// AuditSize, if positive, is the number of recent decisions made by
+	// the schedule to record in its audit log. See Schedule.AuditLog.
+	AuditSize int
+
+	// Quota, if non-nil, is consulted by Ready before releasing each
+	// ready operation that implements QuotaOperation; an operation that
+	// would exceed its class's quota is deferred until the time at which
+	// the quota allows, for which it is reserved, so that operations are
+	// released in order within the quota rather than all released and
+	// throttled afterwards. See QuotaLimiter.
+	Quota QuotaTracker
+
+	// Delivery, if non-nil, records the lag between the time for which
+	// each operation returned by Ready was scheduled and the time passed
+	// to Ready. See DeliveryTracker.
+	Delivery *DeliveryTracker[K]
+
+	// WakeupWindow, if positive, coalesces the schedule's wakeups: the
+	// channel returned by Next sends once for the operations scheduled
+	// within WakeupWindow of the next, at the latest of their times, so
+	// that Ready returns them together. Operations waited for with Next
+	// may thus be delivered up to WakeupWindow late, saving wakeups, and
+	// so power, on hosts where that matters. Ready itself is unaffected.
+	// See timequeue.Config.WakeupWindow.
+	WakeupWindow time.Duration
+
+	// ClockHealth, if non-nil, reports whether the system's time is
+	// reliable; e.g. a *clock.HealthMonitor. While it is not, the
+	// schedule behaves according to UnhealthyClock.
+	ClockHealth ClockHealth
+
+	// UnhealthyClock determines what the schedule does while
+	// ClockHealth reports that the time is unreliable. The default
+	// is to ignore it.
+	UnhealthyClock UnhealthyClockPolicy
+
+	// MonotonicClock is the clock with which the schedule measures
+	// elapsed time while the time is unreliable, if UnhealthyClock is
+	// UnhealthyClockMonotonic. If MonotonicClock is nil, the wall clock
+	// is used, whose times carry the runtime's monotonic readings.
+	MonotonicClock clock.Clock
+
+	// Locker, if non-nil, is the lock with which callers guard access
+	// to the schedule. Pop must be called with Locker held, and
+	// releases it while waiting, so that other goroutines may add and
+	// remove operations meanwhile.
+	Locker sync.Locker
+
+	// DelayOverride, if non-nil, is called with each operation added
+	// to the schedule, including those rescheduled by a Runner, and the
+	// delay computed for it, and returns the delay to apply instead;
+	// e.g. ScaleDelays[O](10) to slow everything down for chaos
+	// testing, or ScaleDelays[O](0) to make every operation ready
+	// immediately in tests. The operation's windows, if any, constrain
+	// the overridden delay as they do the computed one. See Schedule.SetDelayOverride.
+	DelayOverride DelayOverride[O]
+}
+
+// Validate checks that the config is valid.
+func (config Config[K, O]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if !config.Coalesce.valid() {
+		return errors.NotValidf("coalesce policy %v", config.Coalesce)
+	}
+	if err := config.RateLimit.Validate(); err != nil {
+		return errors.Annotate(err, "validating RateLimit")
+	}
+	if config.MaxPending < 0 {
+		return errors.NotValidf("negative MaxPending")
+	}
+	if !config.Overflow.valid() {
+		return errors.NotValidf("overflow policy %v", config.Overflow)
+	}
+	if config.Smoothing < 0 {
+		return errors.NotValidf("negative Smoothing")
+	}
+	if config.WarmUp < 0 {
+		return errors.NotValidf("negative WarmUp")
+	}
+	if config.PriorityAging < 0 {
+		return errors.NotValidf("negative PriorityAging")
+	}
+	if config.AckTimeout < 0 {
+		return errors.NotValidf("negative AckTimeout")
+	}
+	if config.AuditSize < 0 {
+		return errors.NotValidf("negative AuditSize")
+	}
+	if config.WakeupWindow < 0 {
+		return errors.NotValidf("negative WakeupWindow")
+	}
+	if !config.UnhealthyClock.valid() {
+		return errors.NotValidf("unhealthy clock policy %v", config.UnhealthyClock)
+	}
+	if config.UnhealthyClock != UnhealthyClockIgnore && config.ClockHealth == nil {
+		return errors.NotValidf("nil ClockHealth")
+	}
+	return nil
+}
+
+// New constructs a new schedule with the given configuration.
+func New[K comparable, O Operation[K]](config Config[K, O]) (*Schedule[K, O], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating schedule config")
+	}
+	var health *healthClock
+	if config.UnhealthyClock != UnhealthyClockIgnore {
+		health = &healthClock{
+			clock:     config.Clock,
+			monotonic: config.MonotonicClock,
+			health:    config.ClockHealth,
+			policy:    config.UnhealthyClock,
+		}
+		if health.monotonic == nil {
+			health.monotonic = clock.WallClock
+		}
+		health.wall = health.clock.Now()
+		health.reference = health.monotonic.Now()
+		config.Clock = health
+	}
+	q, err := timequeue.NewWithConfig[K, O](timequeue.Config{
+		Clock:        config.Clock,
+		WakeupWindow: config.WakeupWindow,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &Schedule[K, O]{
+		time:          config.Clock,
+		q:             q,
+		health:        health,
+		delivery:      config.Delivery,
+		coalesce:      config.Coalesce,
+		limiter:       newRateLimiter(config.RateLimit),
+		maxPending:    config.MaxPending,
+		onDrop:        config.OnDrop,
+		smoothing:     config.Smoothing,
+		warmUp:        config.WarmUp,
+		auditLog:      newAuditLog[K](config.AuditSize),
+		priorityAging: config.PriorityAging,
+		ackTimeout:    config.AckTimeout,
+		locker:        config.Locker,
+		delayOverride: config.DelayOverride,
+	}
+	if config.AckTimeout > 0 {
+		s.inflight = make(map[K]struct{})
+	}
+	if config.Smoothing > 0 {
+		s.smoothed = make(map[K]bool)
+	}
+	if config.Quota != nil {
+		s.quota = config.Quota
+		s.reserved = make(map[K]bool)
+	}
+	if config.MaxPending > 0 {
+		s.evictLess = evictionOrder[K, O](config.Overflow)
+		s.q.SetEvictionOrder(s.evictLess)
+	}
+	return s, nil
+}
+
 // NewSchedule constructs a new schedule, using the given Clock for the Next
-// and Add methods.
-func NewSchedule(clock clock.Clock) *Schedule {
-	return &Schedule{time: clock, q: timequeue.New(clock)}
+// and Add methods, and otherwise the default configuration.
+func NewSchedule[K comparable, O Operation[K]](clock clock.Clock) *Schedule[K, O] {
+	return &Schedule[K, O]{time: clock, q: timequeue.New[K, O](clock)}
 }
 
 // Next returns a channel which will send after the next scheduled operation's
 // time has been reached. If there are no scheduled operations, nil is returned.
-func (s *Schedule) Next() <-chan time.Time {
-	return s.q.Next()
+//
+// If the schedule is rate limited, and the limit has been reached, then the
+// channel will not send until the next operation may be released.
+//
+// If the schedule is paused while its Clock is unreliable, the channel
+// sends when the Clock's health next changes; see UnhealthyClockPause.
+//
+// The schedule reuses timers for Next, so a channel returned by an earlier
+// call to Next should not be waited on after calling Next again.
+func (s *Schedule[K, O]) Next() <-chan time.Time {
+	if s.health != nil {
+		if resumed, ok := s.health.pausedNext(); ok {
+			s.resuming = true
+			return resumed
+		}
+	}
+	if s.limiter == nil {
+		return s.q.Next()
+	}
+	next, ok := s.NextTime()
+	if !ok {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		return nil
+	}
+	d := next.Sub(s.time.Now())
+	if s.timer == nil {
+		s.timer = clock.NewTimer(s.time, d)
+	} else {
+		s.timer.Reset(d)
+	}
+	return s.timer.Chan()
+}
+
+// NextTime returns the time at which the channel returned by Next would
+// send, and a boolean indicating whether or not there are any scheduled
+// operations.
+func (s *Schedule[K, O]) NextTime() (time.Time, bool) {
+	next, ok := s.q.NextWakeTime()
+	if !ok || s.limiter == nil {
+		return next, ok
+	}
+	if available := s.limiter.nextAvailable(s.time.Now()); available.After(next) {
+		next = available
+	}
+	return next, true
 }
 
 // Ready returns the parameters for operations that are scheduled at or before
 // "now", and removes them from the schedule. The resulting slices are in
-// order of time; operations scheduled for the same time have no defined relative
-// order.
-func (s *Schedule) Ready(now time.Time) []Operation {
-	readyItems := s.q.Ready(now)
-	ready := make([]Operation, len(readyItems))
-	for i, item := range readyItems {
-		ready[i] = item.(Operation)
+// order of time. Operations scheduled for the same time are interleaved
+// round-robin across their groups (see GroupedOperation), so that one group's
+// operations do not all precede another's; otherwise, they have no defined
+// relative order.
+//
+// If the schedule is rate limited, then Ready will return no more operations
+// than the limit allows; the remainder will be returned by later calls.
+//
+// Operations implementing WindowedOperation that are not within one of
+// their windows at "now" are not returned, but are rescheduled for the
+// start of their next window.
+//
+// If the schedule is configured with Smoothing, then Ready may return fewer
+// operations than are ready, deferring the others; see Config.Smoothing.
+//
+// If the schedule is paused while its Clock is unreliable, then Ready
+// returns no operations; see UnhealthyClockPause. If the schedule is
+// configured with WarmUp, then when it resumes, Ready first spreads the
+// overdue operations across the warm-up window; see Config.WarmUp.
+func (s *Schedule[K, O]) Ready(now time.Time) []O {
+	return s.ready(now, nil)
+}
+
+// ReadyMatching is like Ready, but returns only operations whose tags
+// match the selector; other ready operations are left in the schedule.
+// Operations that do not implement TaggedOperation have no tags.
+func (s *Schedule[K, O]) ReadyMatching(now time.Time, selector TagSelector) []O {
+	return s.ready(now, func(op O) bool {
+		return selector(operationTags(op))
+	})
+}
+
+func (s *Schedule[K, O]) ready(now time.Time, match func(O) bool) []O {
+	ready := s.readyItems(now, match, -1)
+	if len(ready) == 0 {
+		return nil
 	}
+	ops := make([]O, len(ready))
+	for i, item := range ready {
+		ops[i] = item.Value
+	}
+	return ops
+}
+
+// readyItems is like ready, but returns the ready operations' items,
+// which record the times for which they were scheduled. If limit is
+// non-negative, at most limit items are returned.
+func (s *Schedule[K, O]) readyItems(now time.Time, match func(O) bool, limit int) []timequeue.Item[K, O] {
+	if s.health != nil && s.health.paused() {
+		s.resuming = true
+		return nil
+	}
+	if s.resuming {
+		s.resuming = false
+		s.warm(now)
+	}
+	n := limit
+	if s.limiter != nil {
+		if available := s.limiter.available(now); n < 0 || available < n {
+			n = available
+		}
+	}
+	// With priority aging, all of the ready operations are
+	// taken from the queue, and then chosen from.
+	take := n
+	if s.priorityAging > 0 && n != 0 {
+		take = -1
+	}
+	var ready, unmatched []timequeue.Item[K, O]
+	for len(ready) != take {
+		item, ok := s.q.PopReady(now)
+		if !ok {
+			break
+		}
+		// An in-flight operation whose ack timeout has
+		// passed is returned to the schedule.
+		delete(s.inflight, item.Key)
+		op := item.Value
+		if match != nil && !match(op) {
+			unmatched = append(unmatched, item)
+			continue
+		}
+		if t := constrain(op, now); t.After(now) {
+			s.q.Add(item.Key, op, t)
+			s.audit(AuditDefer, item.Key, op, now, t)
+			continue
+		}
+		if t := s.reserveQuota(item.Key, op, now); t.After(now) {
+			s.q.Add(item.Key, op, t)
+			s.audit(AuditDefer, item.Key, op, now, t)
+			continue
+		}
+		ready = append(ready, item)
+	}
+	if n >= 0 && len(ready) > n {
+		var rest []timequeue.Item[K, O]
+		ready, rest = s.choose(now, ready, n)
+		for _, item := range rest {
+			s.retainQuota(item)
+		}
+		unmatched = append(unmatched, rest...)
+	}
+	if len(unmatched) > 0 {
+		s.q.AddAll(unmatched)
+	}
+	interleave(ready)
+	if s.smoothing > 0 {
+		ready = s.smooth(now, ready)
+	}
+	if s.limiter != nil {
+		s.limiter.record(now, len(ready))
+	}
+	for _, item := range ready {
+		s.audit(AuditReady, item.Key, item.Value, now, item.Time)
+		if s.delivery != nil {
+			s.delivery.record(item.Key, operationTraceID(item.Value), item.Time, now)
+		}
+	}
+	s.hold(now, ready)
 	return ready
 }
 
+// smooth releases the first of the ready items, along with any that have
+// already been deferred by smoothing, and reschedules the others evenly
+// across the smoothing interval.
+func (s *Schedule[K, O]) smooth(now time.Time, ready []timequeue.Item[K, O]) []timequeue.Item[K, O] {
+	var deferred []timequeue.Item[K, O]
+	released := ready[:0]
+	for _, item := range ready {
+		if s.smoothed[item.Key] {
+			delete(s.smoothed, item.Key)
+			released = append(released, item)
+		} else {
+			deferred = append(deferred, item)
+		}
+	}
+	if len(deferred) == 0 {
+		return released
+	}
+	released = append(released, deferred[0])
+	interval := s.smoothing / time.Duration(len(deferred))
+	for i, item := range deferred[1:] {
+		t := now.Add(time.Duration(i+1) * interval)
+		s.smoothed[item.Key] = true
+		s.retainQuota(item)
+		s.q.Add(item.Key, item.Value, t)
+		s.audit(AuditDefer, item.Key, item.Value, now, t)
+	}
+	return released
+}
+
+// MemoryUsage returns an estimate of the memory used by the pending
+// operations; see timequeue.Queue.MemoryUsage. Operations may implement
+// timequeue.Sizer to report the memory they reference.
+func (s *Schedule[K, O]) MemoryUsage() timequeue.MemoryUsage {
+	return s.q.MemoryUsage()
+}
+
+// ScheduledOperation describes an operation and the time for which
+// it is scheduled.
+type ScheduledOperation[O any] struct {
+	Op   O
+	Time time.Time
+}
+
+// DueWithin returns the operations scheduled at or before d after the
+// current time, in order of time, without removing them from the schedule.
+// This includes operations whose time has already passed, but which have
+// not been returned by Ready.
+//
+// DueWithin considers only the operations' scheduled times; Ready may
+// release them later than forecast, due to rate limiting, windows or
+// smoothing.
+func (s *Schedule[K, O]) DueWithin(d time.Duration) []ScheduledOperation[O] {
+	items := s.q.Due(s.time.Now().Add(d))
+	if len(items) == 0 {
+		return nil
+	}
+	due := make([]ScheduledOperation[O], len(items))
+	for i, item := range items {
+		due[i] = ScheduledOperation[O]{Op: item.Value, Time: item.Time}
+	}
+	return due
+}
+
 // Add adds an operation with the specified value, with the corresponding key
 // and time to the schedule, and returns the time for which the operation is
-// scheduled. Add will panic if there already exists an operation with the same
-// key.
-func (s *Schedule) Add(op Operation) time.Time {
-	key, delay := op.Key(), op.Delay()
-	when := s.time.Now().Add(delay)
-	s.q.Add(key, op, when)
+// scheduled. If there already exists an operation with the same key, then the
+// schedule's coalesce policy determines the outcome; by default, Add will
+// panic with an *OperationError wrapping ErrDuplicateKey.
+//
+// If the operation implements WindowedOperation, and the time computed from
+// its delay falls outside of its windows, then the operation is scheduled for
+// the start of its next window.
+//
+// Add will panic, with an *OperationError wrapping ErrQueueFull, if the
+// schedule is bounded and the operation is rejected by the overflow policy,
+// or wrapping ErrDraining, if the schedule is draining; see Drain. Use
+// TryAdd to handle these conditions.
+func (s *Schedule[K, O]) Add(op O) time.Time {
+	when, err := s.TryAdd(op)
+	if err != nil {
+		panic(err)
+	}
+	return when
+}
+
+// TryAdd is like Add, except that rather than panicking, TryAdd returns
+// an *OperationError wrapping ErrDuplicateKey, ErrQueueFull or ErrDraining.
+func (s *Schedule[K, O]) TryAdd(op O) (time.Time, error) {
+	if s.draining {
+		return time.Time{}, operationError(op.Key(), ErrDraining)
+	}
+	return s.tryAdd(op, s.coalesce)
+}
+
+// AddOrAdvance is like Add, except that if there already exists an
+// operation with the same key, then whichever of the existing and new
+// operations is scheduled for the earlier time is kept, as if by
+// CoalesceKeepEarliest, regardless of the schedule's coalesce policy.
+// AddOrAdvance thus never postpones a pending operation.
+func (s *Schedule[K, O]) AddOrAdvance(op O) time.Time {
+	if s.draining {
+		panic(operationError(op.Key(), ErrDraining))
+	}
+	when, err := s.tryAdd(op, CoalesceKeepEarliest)
+	if err != nil {
+		panic(err)
+	}
 	return when
 }
 
+// tryAdd is like TryAdd, coalescing with the specified policy.
+func (s *Schedule[K, O]) tryAdd(op O, policy CoalescePolicy) (time.Time, error) {
+	key := op.Key()
+	now := s.time.Now()
+	s.supersede(key)
+	if existing, existingTime, ok := s.q.Get(key); ok {
+		if policy == CoalesceNone {
+			return time.Time{}, operationError(key, ErrDuplicateKey)
+		}
+		op, when := coalesce[K](policy, existing, existingTime, op, s.whenFunc(now, op))
+		s.q.Update(key, op, when)
+		delete(s.smoothed, key)
+		delete(s.reserved, key)
+		s.audit(AuditCoalesce, key, op, now, when)
+		s.notify()
+		return when, nil
+	}
+	when := s.when(now, op)
+	if err := s.addAt(now, op, when); err != nil {
+		return time.Time{}, err
+	}
+	return when, nil
+}
+
+// addAt adds an operation, whose key must not already be scheduled,
+// for the specified time, making room for it if the schedule is
+// bounded.
+func (s *Schedule[K, O]) addAt(now time.Time, op O, when time.Time) error {
+	key := op.Key()
+	if err := s.makeRoom(now, timequeue.Item[K, O]{Key: key, Value: op, Time: when}); err != nil {
+		s.audit(AuditReject, key, op, now, time.Time{})
+		return operationError(key, err)
+	}
+	s.q.Add(key, op, when)
+	s.audit(AuditAdd, key, op, now, when)
+	s.notify()
+	return nil
+}
+
+// makeRoom ensures there is room in the schedule to add the specified
+// item, dropping a pending operation if required by the overflow policy.
+func (s *Schedule[K, O]) makeRoom(now time.Time, item timequeue.Item[K, O]) error {
+	if s.maxPending == 0 || s.q.Len() < s.maxPending {
+		return nil
+	}
+	if s.evictLess == nil {
+		return ErrQueueFull
+	}
+	if first, _ := s.q.PeekEvict(); !s.evictLess(first, item) {
+		// The new item would be the first to go.
+		return ErrQueueFull
+	}
+	evicted, _ := s.q.Evict()
+	delete(s.smoothed, evicted.Key)
+	delete(s.reserved, evicted.Key)
+	delete(s.inflight, evicted.Key)
+	s.audit(AuditDrop, evicted.Key, evicted.Value, now, evicted.Time)
+	if s.onDrop != nil {
+		s.onDrop(evicted.Value)
+	}
+	return nil
+}
+
+// AddAll adds all of the specified operations to the schedule, and
+// returns the times for which the operations are scheduled, in the
+// same order as ops. AddAll is equivalent to calling Add for each
+// operation in turn, but is considerably cheaper when adding many
+// operations at once. Operations with keys that are already scheduled,
+// or duplicated within ops, are subject to the coalesce policy; by
+// default, AddAll will panic and leave the schedule unmodified.
+//
+// If the schedule is bounded, AddAll adds the operations one at a time, as
+// if by calling Add; AddAll will panic if an operation is rejected by the
+// overflow policy, leaving the preceding operations in the schedule.
+func (s *Schedule[K, O]) AddAll(ops []O) []time.Time {
+	times, err := s.TryAddAll(ops)
+	if err != nil {
+		panic(err)
+	}
+	return times
+}
+
+// TryAddAll is like AddAll, except that rather than panicking, TryAddAll
+// returns an *OperationError wrapping ErrDuplicateKey, ErrQueueFull or
+// ErrDraining, along with the times of the operations added before the
+// error; the schedule is left unmodified by duplicate keys.
+func (s *Schedule[K, O]) TryAddAll(ops []O) ([]time.Time, error) {
+	if s.draining && len(ops) > 0 {
+		return nil, operationError(ops[0].Key(), ErrDraining)
+	}
+	if s.maxPending > 0 {
+		times := make([]time.Time, 0, len(ops))
+		for _, op := range ops {
+			when, err := s.TryAdd(op)
+			if err != nil {
+				return times, err
+			}
+			times = append(times, when)
+		}
+		return times, nil
+	}
+	if s.coalesce == CoalesceNone {
+		if err := s.checkDuplicates(ops); err != nil {
+			return nil, err
+		}
+	}
+	now := s.time.Now()
+	times := make([]time.Time, len(ops))
+	items := make([]timequeue.Item[K, O], 0, len(ops))
+	var pending map[K]int
+	if s.coalesce != CoalesceNone {
+		pending = make(map[K]int)
+	}
+	for i, op := range ops {
+		key := op.Key()
+		s.supersede(key)
+		if pending != nil {
+			if existing, existingTime, ok := s.q.Get(key); ok {
+				op, when := coalesce[K](s.coalesce, existing, existingTime, op, s.whenFunc(now, op))
+				s.q.Update(key, op, when)
+				delete(s.smoothed, key)
+				delete(s.reserved, key)
+				s.audit(AuditCoalesce, key, op, now, when)
+				times[i] = when
+				continue
+			}
+			if j, ok := pending[key]; ok {
+				item := &items[j]
+				item.Value, item.Time = coalesce[K](s.coalesce, item.Value, item.Time, op, s.whenFunc(now, op))
+				times[i] = item.Time
+				s.audit(AuditCoalesce, key, item.Value, now, item.Time)
+				continue
+			}
+			pending[key] = len(items)
+		}
+		times[i] = s.when(now, op)
+		items = append(items, timequeue.Item[K, O]{Key: key, Value: op, Time: times[i]})
+	}
+	s.q.AddAll(items)
+	for _, item := range items {
+		s.audit(AuditAdd, item.Key, item.Value, now, item.Time)
+	}
+	s.notify()
+	return times, nil
+}
+
+// checkDuplicates returns an *OperationError wrapping ErrDuplicateKey if
+// any of the operations has the key of a pending operation, other than
+// an in-flight one that it would supersede, or of another of ops.
+func (s *Schedule[K, O]) checkDuplicates(ops []O) error {
+	seen := make(map[K]bool, len(ops))
+	for _, op := range ops {
+		key := op.Key()
+		_, inflight := s.inflight[key]
+		if _, _, ok := s.q.Get(key); (ok && !inflight) || seen[key] {
+			return operationError(key, ErrDuplicateKey)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// when returns the time for which the operation should be scheduled,
+// if it were added at the specified time.
+func (s *Schedule[K, O]) when(now time.Time, op O) time.Time {
+	delay := operationDelay[K](op)
+	if s.delayOverride != nil {
+		delay = s.delayOverride(op, delay)
+	}
+	return constrain(op, delayBase(op, now).Add(delay))
+}
+
+func (s *Schedule[K, O]) whenFunc(now time.Time, op O) func() time.Time {
+	return func() time.Time {
+		return s.when(now, op)
+	}
+}
+
+// Get returns the operation corresponding to the specified key, the time
+// for which it is scheduled, and a boolean indicating whether or not it
+// exists.
+func (s *Schedule[K, O]) Get(key K) (O, time.Time, bool) {
+	return s.q.Get(key)
+}
+
 // Remove removes the operation corresponding to the specified key from the
-// schedule. If no operation with the specified key exists, this is a no-op.
-func (s *Schedule) Remove(key interface{}) {
-	s.q.Remove(key)
+// schedule, and returns the removed operation and a boolean indicating whether
+// or not it existed. If no operation with the specified key exists, this is a
+// no-op.
+func (s *Schedule[K, O]) Remove(key K) (O, bool) {
+	delete(s.smoothed, key)
+	delete(s.reserved, key)
+	delete(s.inflight, key)
+	op, ok := s.q.Remove(key)
+	if ok {
+		s.audit(AuditRemove, key, op, s.time.Now(), time.Time{})
+		s.notify()
+	}
+	return op, ok
+}
+
+// RemoveAll removes the operations corresponding to the specified keys
+// from the schedule. Keys with no corresponding operation are ignored.
+func (s *Schedule[K, O]) RemoveAll(keys []K) {
+	for _, key := range keys {
+		delete(s.smoothed, key)
+		delete(s.reserved, key)
+		delete(s.inflight, key)
+		if s.auditLog != nil {
+			if op, _, ok := s.q.Get(key); ok {
+				s.audit(AuditRemove, key, op, s.time.Now(), time.Time{})
+			}
+		}
+	}
+	s.q.RemoveAll(keys)
+	s.notify()
+}
+
+// Clear removes all operations from the schedule. If f is non-nil, it is
+// called with each removed operation, in no particular order, after the
+// schedule has been emptied.
+func (s *Schedule[K, O]) Clear(f func(op O)) {
+	defer s.notify()
+	if s.smoothed != nil {
+		s.smoothed = make(map[K]bool)
+	}
+	if s.reserved != nil {
+		s.reserved = make(map[K]bool)
+	}
+	if s.inflight != nil {
+		s.inflight = make(map[K]struct{})
+	}
+	if f == nil && s.auditLog == nil {
+		s.q.Clear(nil)
+		return
+	}
+	now := s.time.Now()
+	s.q.Clear(func(key K, op O) {
+		s.audit(AuditRemove, key, op, now, time.Time{})
+		if f != nil {
+			f(op)
+		}
+	})
+}
+
+// Flush removes all operations from the schedule, and returns them
+// immediately, in order of the times for which they were scheduled,
+// regardless of those times; operations scheduled for the same time
+// have no defined relative order. Unlike Ready, Flush disregards the
+// operations' windows, the schedule's rate limit and smoothing, so
+// that every pending operation may be executed or persisted during a
+// controlled shutdown, rather than abandoned.
+func (s *Schedule[K, O]) Flush() []O {
+	flushed := s.flushItems()
+	if len(flushed) == 0 {
+		return nil
+	}
+	ops := make([]O, len(flushed))
+	for i, item := range flushed {
+		ops[i] = item.Value
+	}
+	return ops
+}
+
+// flushItems is like Flush, but returns the flushed operations' items,
+// which record the times for which they were scheduled.
+func (s *Schedule[K, O]) flushItems() []timequeue.Item[K, O] {
+	flushed := s.q.Due(maxTime)
+	if len(flushed) == 0 {
+		return nil
+	}
+	s.q.Clear(nil)
+	if s.smoothed != nil {
+		s.smoothed = make(map[K]bool)
+	}
+	if s.reserved != nil {
+		s.reserved = make(map[K]bool)
+	}
+	if s.inflight != nil {
+		s.inflight = make(map[K]struct{})
+	}
+	now := s.time.Now()
+	for _, item := range flushed {
+		s.audit(AuditFlush, item.Key, item.Value, now, item.Time)
+	}
+	s.notify()
+	return flushed
+}
+
+// Pop waits until the next operation is ready, and then removes and
+// returns it, as Ready would. If the context is done first, Pop returns
+// the context's error.
+//
+// If the schedule is configured with a Locker, Pop must be called with
+// the lock held; Pop releases the lock while waiting, and reacquires it
+// before returning. Operations added or removed by other goroutines
+// while Pop waits are taken into account. Otherwise, Pop is intended for
+// a consumer that owns the schedule, and nothing else may modify it
+// while Pop waits.
+//
+// Pop calls Next, and so should not be used together with other callers
+// of Next.
+func (s *Schedule[K, O]) Pop(ctx context.Context) (O, error) {
+	if s.changed == nil {
+		s.changed = make(chan struct{}, 1)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			var zero O
+			return zero, err
+		}
+		if ready := s.readyItems(s.time.Now(), nil, 1); len(ready) > 0 {
+			return ready[0].Value, nil
+		}
+		next := s.Next()
+		if s.locker != nil {
+			s.locker.Unlock()
+		}
+		select {
+		case <-next:
+		case <-s.changed:
+		case <-ctx.Done():
+		}
+		if s.locker != nil {
+			s.locker.Lock()
+		}
+	}
+}
+
+// notify wakes a waiting Pop, if any, after operations are added or
+// removed.
+func (s *Schedule[K, O]) notify() {
+	if s.changed == nil {
+		return
+	}
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Clone returns an independent copy of the schedule, with the same
+// configuration and pending operations. This may be used, for example,
+// to determine which operations would be made ready by calls to Ready
+// at future times, without affecting the original schedule.
+//
+// The operations themselves are copied as if by assignment, so if O is
+// a pointer type, the original schedule and the clone will share the
+// operations. The OnDrop hook and the DeliveryTracker are not carried
+// over to the clone, so that its simulated deliveries are not recorded.
+// A clone of a schedule configured with a ClockHealth consults the same
+// ClockHealth, but measures time independently of the original while
+// the time is unreliable.
+//
+// The clone has its own copy of a QuotaLimiter's reservations, so that
+// it defers operations as the original would, without consuming the
+// original's quota; a QuotaTracker of any other type is not carried
+// over, since it cannot be copied.
+func (s *Schedule[K, O]) Clone() *Schedule[K, O] {
+	clone := *s
+	clone.q = s.q.Clone()
+	if s.health != nil {
+		clone.health = s.health.clone()
+		clone.time = clone.health
+		clone.q.SetClock(clone.health)
+	}
+	clone.onDrop = nil
+	clone.delivery = nil
+	clone.timer = nil
+	clone.locker = nil
+	clone.changed = nil
+	if s.smoothed != nil {
+		clone.smoothed = make(map[K]bool, len(s.smoothed))
+		for key := range s.smoothed {
+			clone.smoothed[key] = true
+		}
+	}
+	switch quota := s.quota.(type) {
+	case nil:
+	case *QuotaLimiter:
+		clone.quota = quota.clone()
+	default:
+		clone.quota = nil
+	}
+	if clone.quota != nil {
+		clone.reserved = make(map[K]bool, len(s.reserved))
+		for key := range s.reserved {
+			clone.reserved[key] = true
+		}
+	} else {
+		clone.reserved = nil
+	}
+	if s.inflight != nil {
+		clone.inflight = make(map[K]struct{}, len(s.inflight))
+		for key := range s.inflight {
+			clone.inflight[key] = struct{}{}
+		}
+	}
+	if s.auditLog != nil {
+		clone.auditLog = s.auditLog.clone()
+	}
+	if s.limiter != nil {
+		limiter := *s.limiter
+		limiter.released = append([]time.Time(nil), s.limiter.released...)
+		clone.limiter = &limiter
+	}
+	return &clone
+}
+
+// AuditLog returns the most recent decisions made by the schedule, oldest
+// first, up to the configured AuditSize. If the schedule was not configured
+// with an audit log, AuditLog returns nil.
+func (s *Schedule[K, O]) AuditLog() []AuditEvent[K] {
+	if s.auditLog == nil {
+		return nil
+	}
+	return s.auditLog.list()
+}
+
+// audit records a decision in the audit log, if there is one.
+func (s *Schedule[K, O]) audit(kind AuditKind, key K, op O, now, scheduled time.Time) {
+	if s.auditLog != nil {
+		s.auditLog.record(kind, key, operationTraceID(op), now, scheduled)
+	}
 }
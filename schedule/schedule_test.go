@@ -4,8 +4,13 @@
 package schedule_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	clocktesting "github.com/axw/juju-time/clock/testing"
 	"github.com/axw/juju-time/schedule"
 	coretesting "github.com/juju/juju/testing"
 	jc "github.com/juju/testing/checkers"
@@ -19,14 +24,14 @@ type scheduleSuite struct {
 var _ = gc.Suite(&scheduleSuite{})
 
 func (*scheduleSuite) TestNextNoEvents(c *gc.C) {
-	s := schedule.NewSchedule(coretesting.NewClock(time.Time{}))
+	s := schedule.NewSchedule[string, operation](clocktesting.NewClock(time.Time{}))
 	next := s.Next()
 	c.Assert(next, gc.IsNil)
 }
 
 func (*scheduleSuite) TestNext(c *gc.C) {
-	clock := coretesting.NewClock(time.Time{})
-	s := schedule.NewSchedule(clock)
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
 
 	op0 := operation{"k0", "v0", 3 * time.Second}
 	op1 := operation{"k1", "v1", 1500 * time.Millisecond}
@@ -38,30 +43,31 @@ func (*scheduleSuite) TestNext(c *gc.C) {
 	s.Add(op2)
 	s.Add(op3)
 
-	assertNextOp(c, s, clock, 1500*time.Millisecond)
+	c.Assert(s.Next(), gc.NotNil)
+	clocktesting.ExpectTimer(c, clock, 1500*time.Millisecond)
 	clock.Advance(1500 * time.Millisecond)
 	assertReady(c, s, clock, op1)
 
 	clock.Advance(500 * time.Millisecond)
-	assertNextOp(c, s, clock, 0)
+	clocktesting.ExpectSignalled(c, s.Next())
 	assertReady(c, s, clock, op2)
 
 	s.Remove("k3")
 
 	clock.Advance(2 * time.Second) // T+4
-	assertNextOp(c, s, clock, 0)
+	clocktesting.ExpectSignalled(c, s.Next())
 	assertReady(c, s, clock, op0)
 }
 
 func (*scheduleSuite) TestReadyNoEvents(c *gc.C) {
-	s := schedule.NewSchedule(coretesting.NewClock(time.Time{}))
+	s := schedule.NewSchedule[string, operation](clocktesting.NewClock(time.Time{}))
 	ready := s.Ready(time.Now())
 	c.Assert(ready, gc.HasLen, 0)
 }
 
 func (*scheduleSuite) TestAdd(c *gc.C) {
-	clock := coretesting.NewClock(time.Time{})
-	s := schedule.NewSchedule(clock)
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
 
 	op0 := operation{"k0", "v0", 3 * time.Second}
 	op1 := operation{"k1", "v1", 1500 * time.Millisecond}
@@ -86,29 +92,641 @@ func (*scheduleSuite) TestAdd(c *gc.C) {
 }
 
 func (*scheduleSuite) TestRemove(c *gc.C) {
-	clock := coretesting.NewClock(time.Time{})
-	s := schedule.NewSchedule(clock)
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
 
 	op0 := operation{"k0", "v0", 3 * time.Second}
 	op1 := operation{"k1", "v1", 2 * time.Second}
 	s.Add(op0)
 	s.Add(op1)
-	s.Remove("k0")
+	removed, ok := s.Remove("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(removed, jc.DeepEquals, op0)
 	assertReady(c, s, clock /* nothing */)
 
 	clock.Advance(3 * time.Second)
 	assertReady(c, s, clock, op1)
 }
 
+func (*scheduleSuite) TestGet(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := schedule.NewSchedule[string, operation](clock)
+
+	op0 := operation{"k0", "v0", 3 * time.Second}
+	s.Add(op0)
+	op, t, ok := s.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(op, jc.DeepEquals, op0)
+	c.Assert(t, gc.Equals, now.Add(3*time.Second))
+
+	_, _, ok = s.Get("k1")
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (*scheduleSuite) TestAddAll(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := schedule.NewSchedule[string, operation](clock)
+
+	op0 := operation{"k0", "v0", 3 * time.Second}
+	op1 := operation{"k1", "v1", 1500 * time.Millisecond}
+	op2 := operation{"k2", "v2", 2 * time.Second}
+
+	times := s.AddAll([]operation{op0, op1, op2})
+	c.Assert(times, jc.DeepEquals, []time.Time{
+		now.Add(3 * time.Second),
+		now.Add(1500 * time.Millisecond),
+		now.Add(2 * time.Second),
+	})
+
+	clock.Advance(2 * time.Second) // T+2
+	assertReady(c, s, clock, op1, op2)
+
+	clock.Advance(time.Second) // T+3
+	assertReady(c, s, clock, op0)
+}
+
+func (*scheduleSuite) TestRemoveAll(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
+
+	op0 := operation{"k0", "v0", 3 * time.Second}
+	op1 := operation{"k1", "v1", 2 * time.Second}
+	op2 := operation{"k2", "v2", 1 * time.Second}
+	s.AddAll([]operation{op0, op1, op2})
+	s.RemoveAll([]string{"k0", "k2"})
+
+	clock.Advance(3 * time.Second)
+	assertReady(c, s, clock, op1)
+}
+
+func (*scheduleSuite) TestClear(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
+
+	op0 := operation{"k0", "v0", 3 * time.Second}
+	op1 := operation{"k1", "v1", 2 * time.Second}
+	s.AddAll([]operation{op0, op1})
+	var cleared []operation
+	s.Clear(func(op operation) {
+		cleared = append(cleared, op)
+	})
+	c.Assert(cleared, jc.SameContents, []operation{op0, op1})
+	c.Assert(s.Next(), gc.IsNil)
+
+	clock.Advance(3 * time.Second)
+	assertReady(c, s, clock /* nothing */)
+}
+
+func (*scheduleSuite) TestFlush(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clock,
+		RateLimit: schedule.RateLimit{Limit: 1, Window: time.Second},
+		AuditSize: 1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.Flush(), gc.HasLen, 0)
+
+	// Operations are flushed in order of time, regardless
+	// of their times and the schedule's rate limit.
+	op0 := operation{"k0", "v0", 3 * time.Second}
+	op1 := operation{"k1", "v1", time.Hour}
+	op2 := operation{"k2", "v2", 2 * time.Second}
+	s.AddAll([]operation{op0, op1, op2})
+	t0 := clock.Now()
+	c.Assert(s.Flush(), jc.DeepEquals, []operation{op2, op0, op1})
+	c.Assert(s.Next(), gc.IsNil)
+	c.Assert(s.AuditLog(), jc.DeepEquals, []schedule.AuditEvent[string]{
+		{Kind: schedule.AuditFlush, Key: "k1", Time: t0, Scheduled: t0.Add(time.Hour), Delay: time.Hour},
+	})
+
+	clock.Advance(time.Hour)
+	assertReady(c, s, clock /* nothing */)
+}
+
+func (*scheduleSuite) TestClone(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clock,
+		RateLimit: schedule.RateLimit{Limit: 1, Window: time.Second},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	op0 := operation{"k0", "v0", 0}
+	op1 := operation{"k1", "v1", 0}
+	op2 := operation{"k2", "v2", time.Second}
+	s.AddAll([]operation{op0, op1, op2})
+	assertReady(c, s, clock, op0)
+
+	// Simulate the future with a clone; the rate limit
+	// state is carried over.
+	clone := s.Clone()
+	now := clock.Now()
+	c.Assert(clone.Ready(now), gc.HasLen, 0)
+	c.Assert(clone.Ready(now.Add(time.Second)), jc.DeepEquals, []operation{op1})
+	c.Assert(clone.Ready(now.Add(2*time.Second)), jc.DeepEquals, []operation{op2})
+
+	// The original schedule is unaffected.
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, op1)
+}
+
+func (*scheduleSuite) TestDueWithin(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := schedule.NewSchedule[string, operation](clock)
+	c.Assert(s.DueWithin(time.Hour), gc.HasLen, 0)
+
+	ops := []operation{
+		{"k0", "v0", 3 * time.Second},
+		{"k1", "v1", time.Second},
+		{"k2", "v2", time.Hour},
+	}
+	s.AddAll(ops)
+	c.Assert(s.DueWithin(3*time.Second), jc.DeepEquals, []schedule.ScheduledOperation[operation]{
+		{Op: ops[1], Time: now.Add(time.Second)},
+		{Op: ops[0], Time: now.Add(3 * time.Second)},
+	})
+
+	// Operations are not removed, and include those already due.
+	clock.Advance(2 * time.Second)
+	c.Assert(s.DueWithin(0), jc.DeepEquals, []schedule.ScheduledOperation[operation]{
+		{Op: ops[1], Time: now.Add(time.Second)},
+	})
+	assertReady(c, s, clock, ops[1])
+}
+
 func (*scheduleSuite) TestRemoveKeyNotFound(c *gc.C) {
-	s := schedule.NewSchedule(coretesting.NewClock(time.Time{}))
-	s.Remove("0") // does not explode
+	s := schedule.NewSchedule[string, operation](clocktesting.NewClock(time.Time{}))
+	_, ok := s.Remove("0") // does not explode
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (*scheduleSuite) TestNewValidation(c *gc.C) {
+	_, err := schedule.New(schedule.Config[string, operation]{})
+	c.Assert(err, gc.ErrorMatches, "validating schedule config: nil Clock not valid")
+
+	_, err = schedule.New(schedule.Config[string, operation]{
+		Clock:    clocktesting.NewClock(time.Time{}),
+		Coalesce: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, `validating schedule config: coalesce policy CoalescePolicy\(-1\) not valid`)
+}
+
+func (*scheduleSuite) TestWakeupWindow(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:        clock,
+		WakeupWindow: 100 * time.Millisecond,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := operation{"k0", "v0", time.Second}
+	op1 := operation{"k1", "v1", time.Second + 80*time.Millisecond}
+	op2 := operation{"k2", "v2", 2 * time.Second}
+	s.AddAll([]operation{op0, op1, op2})
+
+	c.Assert(s.Next(), gc.NotNil)
+	clocktesting.ExpectTimer(c, clock, time.Second+80*time.Millisecond)
+	clock.Advance(time.Second + 80*time.Millisecond)
+	clocktesting.ExpectSignalled(c, s.Next())
+	assertReady(c, s, clock, op0, op1)
+	next, ok := s.NextTime()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(next, gc.Equals, clock.Now().Add(920*time.Millisecond))
+
+	_, err = schedule.New(schedule.Config[string, operation]{
+		Clock:        clock,
+		WakeupWindow: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating schedule config: negative WakeupWindow not valid")
+}
+
+func (*scheduleSuite) TestAddDuplicatePanics(c *gc.C) {
+	s := schedule.NewSchedule[string, operation](clocktesting.NewClock(time.Time{}))
+	s.Add(operation{"k0", "v0", time.Second})
+	c.Assert(func() {
+		s.Add(operation{"k0", "v1", time.Second})
+	}, gc.PanicMatches, "operation k0: duplicate key")
+}
+
+func (*scheduleSuite) TestCoalesce(c *gc.C) {
+	type test struct {
+		policy schedule.CoalescePolicy
+		delay  time.Duration
+		expect operation
+		when   time.Duration
+	}
+	tests := []test{{
+		policy: schedule.CoalesceKeepEarliest,
+		delay:  time.Second,
+		expect: operation{"k0", "v1", time.Second},
+		when:   2 * time.Second,
+	}, {
+		policy: schedule.CoalesceKeepEarliest,
+		delay:  5 * time.Second,
+		expect: operation{"k0", "v0", 3 * time.Second},
+		when:   3 * time.Second,
+	}, {
+		policy: schedule.CoalesceKeepLatest,
+		delay:  time.Second,
+		expect: operation{"k0", "v0", 3 * time.Second},
+		when:   3 * time.Second,
+	}, {
+		policy: schedule.CoalesceKeepLatest,
+		delay:  5 * time.Second,
+		expect: operation{"k0", "v1", 5 * time.Second},
+		when:   6 * time.Second,
+	}, {
+		policy: schedule.CoalesceReplaceValue,
+		delay:  5 * time.Second,
+		expect: operation{"k0", "v1", 5 * time.Second},
+		when:   3 * time.Second,
+	}, {
+		policy: schedule.CoalesceExtendDelay,
+		delay:  time.Second,
+		expect: operation{"k0", "v1", time.Second},
+		when:   2 * time.Second,
+	}, {
+		policy: schedule.CoalesceExtendDelay,
+		delay:  5 * time.Second,
+		expect: operation{"k0", "v1", 5 * time.Second},
+		when:   6 * time.Second,
+	}}
+	for i, test := range tests {
+		c.Logf("test %d: %v, delay %v", i, test.policy, test.delay)
+		clock := clocktesting.NewClock(time.Time{})
+		now := clock.Now()
+		s, err := schedule.New(schedule.Config[string, operation]{
+			Clock:    clock,
+			Coalesce: test.policy,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+
+		s.Add(operation{"k0", "v0", 3 * time.Second})
+		clock.Advance(time.Second)
+		when := s.Add(operation{"k0", "v1", test.delay})
+		c.Assert(when, gc.Equals, now.Add(test.when))
+
+		clock.Advance(test.when - time.Second - 1)
+		assertReady(c, s, clock /* nothing */)
+		clock.Advance(1)
+		assertReady(c, s, clock, test.expect)
+	}
+}
+
+func (*scheduleSuite) TestCoalesceAddAll(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:    clock,
+		Coalesce: schedule.CoalesceKeepEarliest,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.Add(operation{"k0", "v0", 3 * time.Second})
+	times := s.AddAll([]operation{
+		{"k0", "v0'", time.Second},
+		{"k1", "v1", 2 * time.Second},
+		{"k1", "v1'", 4 * time.Second},
+	})
+	c.Assert(times, jc.DeepEquals, []time.Time{
+		now.Add(time.Second),
+		now.Add(2 * time.Second),
+		now.Add(2 * time.Second),
+	})
+
+	clock.Advance(2 * time.Second)
+	assertReady(c, s, clock, operation{"k0", "v0'", time.Second}, operation{"k1", "v1", 2 * time.Second})
+}
+
+func (*scheduleSuite) TestAddOrAdvance(c *gc.C) {
+	for _, policy := range []schedule.CoalescePolicy{
+		schedule.CoalesceNone,
+		schedule.CoalesceKeepLatest,
+	} {
+		c.Logf("coalesce policy %v", policy)
+		clock := clocktesting.NewClock(time.Time{})
+		now := clock.Now()
+		s, err := schedule.New(schedule.Config[string, operation]{
+			Clock:    clock,
+			Coalesce: policy,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+
+		when := s.AddOrAdvance(operation{"k0", "v0", 3 * time.Second})
+		c.Assert(when, gc.Equals, now.Add(3*time.Second))
+
+		// A later time does not postpone the pending operation.
+		when = s.AddOrAdvance(operation{"k0", "v1", 5 * time.Second})
+		c.Assert(when, gc.Equals, now.Add(3*time.Second))
+
+		// An earlier time advances it.
+		op := operation{"k0", "v2", time.Second}
+		when = s.AddOrAdvance(op)
+		c.Assert(when, gc.Equals, now.Add(time.Second))
+
+		clock.Advance(time.Second)
+		assertReady(c, s, clock, op)
+	}
+}
+
+func (*scheduleSuite) TestRateLimit(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clock,
+		RateLimit: schedule.RateLimit{Limit: 2, Window: time.Second},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	ops := []operation{
+		{"k0", "v0", 0},
+		{"k1", "v1", 1 * time.Millisecond},
+		{"k2", "v2", 2 * time.Millisecond},
+		{"k3", "v3", 3 * time.Millisecond},
+		{"k4", "v4", 4 * time.Millisecond},
+	}
+	s.AddAll(ops)
+
+	clock.Advance(5 * time.Millisecond)
+	assertReady(c, s, clock, ops[0], ops[1])
+	assertReady(c, s, clock /* nothing */)
+
+	// The limit has been reached, so Next won't fire
+	// until a second after the first release.
+	c.Assert(s.Next(), gc.NotNil)
+	clocktesting.ExpectTimer(c, clock, time.Second)
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, ops[2], ops[3])
+
+	clock.Advance(500 * time.Millisecond)
+	assertReady(c, s, clock /* nothing */)
+	clock.Advance(500 * time.Millisecond)
+	clocktesting.ExpectSignalled(c, s.Next())
+	assertReady(c, s, clock, ops[4])
+}
+
+func (*scheduleSuite) TestRateLimitValidation(c *gc.C) {
+	_, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clocktesting.NewClock(time.Time{}),
+		RateLimit: schedule.RateLimit{Limit: 1},
+	})
+	c.Assert(err, gc.ErrorMatches, "validating schedule config: validating RateLimit: non-positive Window not valid")
+}
+
+func (*scheduleSuite) TestPriorityAging(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, schedule.Operation[string]]{
+		Clock:         clock,
+		RateLimit:     schedule.RateLimit{Limit: 1, Window: time.Second},
+		PriorityAging: 2 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	low := prioritizedOperation{operation{"low", "low", 0}, 0}
+	high := func(i int) schedule.Operation[string] {
+		key := "high" + string(rune('0'+i))
+		return prioritizedOperation{operation{key, key, 0}, 2}
+	}
+	s.AddAll([]schedule.Operation[string]{low, high(0)})
+	assertReady(c, s, clock, high(0))
+
+	// A higher priority operation becomes ready every second, as
+	// fast as the rate limit allows, but the low priority operation
+	// has aged to the same priority after four seconds, and then
+	// is preferred for having been scheduled earlier.
+	for i := 1; i < 4; i++ {
+		s.Add(high(i))
+		clock.Advance(time.Second)
+		assertReady(c, s, clock, high(i))
+	}
+	s.Add(high(4))
+	clock.Advance(time.Second)
+	assertReady[schedule.Operation[string]](c, s, clock, low)
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, high(4))
+}
+
+func (*scheduleSuite) TestPriorityAgingValidation(c *gc.C) {
+	_, err := schedule.New(schedule.Config[string, operation]{
+		Clock:         clocktesting.NewClock(time.Time{}),
+		PriorityAging: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating schedule config: negative PriorityAging not valid")
+}
+
+func (*scheduleSuite) TestSmoothing(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clock,
+		Smoothing: 30 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	ops := []operation{
+		{"k0", "v0", 1 * time.Millisecond},
+		{"k1", "v1", 2 * time.Millisecond},
+		{"k2", "v2", 3 * time.Millisecond},
+		{"k3", "v3", 4 * time.Millisecond},
+	}
+	s.AddAll(ops)
+
+	// The burst is spread evenly across the smoothing interval.
+	clock.Advance(4 * time.Millisecond)
+	assertReady(c, s, clock, ops[0])
+	clock.Advance(7499 * time.Millisecond)
+	assertReady(c, s, clock)
+	clock.Advance(time.Millisecond)
+	assertReady(c, s, clock, ops[1])
+
+	// Deferred operations are not deferred again.
+	clock.Advance(time.Minute)
+	assertReady(c, s, clock, ops[2], ops[3])
+}
+
+func (*scheduleSuite) TestSmoothingValidation(c *gc.C) {
+	_, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clocktesting.NewClock(time.Time{}),
+		Smoothing: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating schedule config: negative Smoothing not valid")
+}
+
+func (*scheduleSuite) TestAuditLog(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clock,
+		AuditSize: 3,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.AuditLog(), gc.HasLen, 0)
+
+	t0 := clock.Now()
+	s.Add(operation{"k0", "v0", time.Second})
+	s.Add(operation{"k1", "v1", 2 * time.Second})
+	c.Assert(s.AuditLog(), jc.DeepEquals, []schedule.AuditEvent[string]{
+		{Kind: schedule.AuditAdd, Key: "k0", Time: t0, Scheduled: t0.Add(time.Second), Delay: time.Second},
+		{Kind: schedule.AuditAdd, Key: "k1", Time: t0, Scheduled: t0.Add(2 * time.Second), Delay: 2 * time.Second},
+	})
+
+	s.Remove("k1")
+	clock.Advance(3 * time.Second)
+	t1 := clock.Now()
+	assertReady(c, s, clock, operation{"k0", "v0", time.Second})
+
+	// Only the most recent events are kept.
+	c.Assert(s.AuditLog(), jc.DeepEquals, []schedule.AuditEvent[string]{
+		{Kind: schedule.AuditAdd, Key: "k1", Time: t0, Scheduled: t0.Add(2 * time.Second), Delay: 2 * time.Second},
+		{Kind: schedule.AuditRemove, Key: "k1", Time: t0},
+		{Kind: schedule.AuditReady, Key: "k0", Time: t1, Scheduled: t0.Add(time.Second), Delay: -2 * time.Second},
+	})
+}
+
+func (*scheduleSuite) TestAuditLogDisabled(c *gc.C) {
+	s := schedule.NewSchedule[string, operation](clocktesting.NewClock(time.Time{}))
+	s.Add(operation{"k0", "v0", time.Second})
+	c.Assert(s.AuditLog(), gc.IsNil)
+}
+
+func (*scheduleSuite) TestReadyMatching(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, schedule.Operation[string]](clock)
+
+	op0 := taggedOperation{operation{"k0", "v0", 1 * time.Second}, []string{"storage", "volume"}}
+	op1 := taggedOperation{operation{"k1", "v1", 2 * time.Second}, []string{"machine"}}
+	op2 := taggedOperation{operation{"k2", "v2", 3 * time.Second}, []string{"storage", "filesystem"}}
+	op3 := operation{"k3", "v3", 4 * time.Second}
+	s.AddAll([]schedule.Operation[string]{op0, op1, op2, op3})
+
+	clock.Advance(4 * time.Second)
+	now := clock.Now()
+	c.Assert(s.ReadyMatching(now, schedule.AllTags("storage", "filesystem")), jc.DeepEquals, []schedule.Operation[string]{op2})
+	c.Assert(s.ReadyMatching(now, schedule.AnyTag("storage", "machine")), jc.DeepEquals, []schedule.Operation[string]{op0, op1})
+	c.Assert(s.ReadyMatching(now, schedule.AnyTag("storage")), gc.HasLen, 0)
+	c.Assert(s.ReadyMatching(now, schedule.Not(schedule.AnyTag())), jc.DeepEquals, []schedule.Operation[string]{op3})
+}
+
+func (*scheduleSuite) TestReadyInterleavesGroups(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, groupedOperation](clock)
+
+	machine0 := groupedOperation{operation{"m0", "v0", time.Second}, "machine"}
+	machine1 := groupedOperation{operation{"m1", "v1", time.Second}, "machine"}
+	machine2 := groupedOperation{operation{"m2", "v2", time.Second}, "machine"}
+	volume0 := groupedOperation{operation{"vol0", "v3", time.Second}, "volume"}
+	volume1 := groupedOperation{operation{"vol1", "v4", time.Second}, "volume"}
+	later := groupedOperation{operation{"m3", "v5", 2 * time.Second}, "machine"}
+	s.AddAll([]groupedOperation{machine0, machine1, machine2, volume0, volume1, later})
+
+	// Operations for the same time alternate between groups,
+	// each group being represented in turn until exhausted;
+	// later operations follow.
+	clock.Advance(2 * time.Second)
+	ready := s.Ready(clock.Now())
+	c.Assert(ready, gc.HasLen, 6)
+	groups := make([]string, len(ready))
+	for i, op := range ready {
+		groups[i] = op.Group()
+	}
+	if groups[0] == "machine" {
+		c.Assert(groups, jc.DeepEquals, []string{"machine", "volume", "machine", "volume", "machine", "machine"})
+	} else {
+		c.Assert(groups, jc.DeepEquals, []string{"volume", "machine", "volume", "machine", "machine", "machine"})
+	}
+	c.Assert(ready[5], gc.Equals, later)
+}
+
+func (*scheduleSuite) TestBoundedReject(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		MaxPending: 2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	op0 := operation{"k0", "v0", 1 * time.Second}
+	op1 := operation{"k1", "v1", 2 * time.Second}
+	op2 := operation{"k2", "v2", 3 * time.Second}
+	s.Add(op0)
+	s.Add(op1)
+	_, err = s.TryAdd(op2)
+	c.Assert(errors.Is(err, schedule.ErrQueueFull), jc.IsTrue)
+	c.Assert(func() { s.Add(op2) }, gc.PanicMatches, "operation k2: schedule full")
+
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, op0)
+	_, err = s.TryAdd(op2)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*scheduleSuite) TestBoundedDropFurthest(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	var dropped []operation
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      clock,
+		MaxPending: 2,
+		Overflow:   schedule.OverflowDropFurthest,
+		OnDrop: func(op operation) {
+			dropped = append(dropped, op)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	op0 := operation{"k0", "v0", 1 * time.Second}
+	op1 := operation{"k1", "v1", 3 * time.Second}
+	op2 := operation{"k2", "v2", 2 * time.Second}
+	op3 := operation{"k3", "v3", 4 * time.Second}
+	s.Add(op0)
+	s.Add(op1)
+	s.Add(op2)
+	c.Assert(dropped, jc.DeepEquals, []operation{op1})
+
+	// The new operation would be furthest in the future.
+	_, err = s.TryAdd(op3)
+	c.Assert(errors.Is(err, schedule.ErrQueueFull), jc.IsTrue)
+
+	clock.Advance(4 * time.Second)
+	assertReady(c, s, clock, op0, op2)
+}
+
+func (*scheduleSuite) TestBoundedDropLowestPriority(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	var dropped []schedule.Operation[string]
+	s, err := schedule.New(schedule.Config[string, schedule.Operation[string]]{
+		Clock:      clock,
+		MaxPending: 3,
+		Overflow:   schedule.OverflowDropLowestPriority,
+		OnDrop: func(op schedule.Operation[string]) {
+			dropped = append(dropped, op)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	op0 := prioritizedOperation{operation{"k0", "v0", 1 * time.Second}, 1}
+	op1 := operation{"k1", "v1", 2 * time.Second}
+	op2 := operation{"k2", "v2", 3 * time.Second}
+	op3 := prioritizedOperation{operation{"k3", "v3", 4 * time.Second}, 2}
+	op4 := prioritizedOperation{operation{"k4", "v4", 5 * time.Second}, -1}
+	s.AddAll([]schedule.Operation[string]{op0, op1, op2})
+
+	// op1 and op2 have the lowest priority; op2 is further
+	// in the future, so it is dropped first.
+	s.Add(op3)
+	c.Assert(dropped, jc.DeepEquals, []schedule.Operation[string]{op2})
+
+	// op4 would have the lowest priority of all.
+	_, err = s.TryAdd(op4)
+	c.Assert(errors.Is(err, schedule.ErrQueueFull), jc.IsTrue)
+
+	clock.Advance(5 * time.Second)
+	assertReady[schedule.Operation[string]](c, s, clock, op0, op1, op3)
 }
 
 func (*scheduleSuite) TestExponentialBackoff(c *gc.C) {
-	clock := coretesting.NewClock(time.Time{})
+	clock := clocktesting.NewClock(time.Time{})
 	now := clock.Now()
-	s := schedule.NewSchedule(clock)
+	s := schedule.NewSchedule[string, *exponentialBackoffOperation](clock)
 	op := &exponentialBackoffOperation{key: "key"}
 
 	expectedTimes := []time.Time{
@@ -130,13 +748,268 @@ func (*scheduleSuite) TestExponentialBackoff(c *gc.C) {
 	}
 }
 
+func (*scheduleSuite) TestExponentialBackoffConfig(c *gc.C) {
+	b := schedule.ExponentialBackoff{
+		Initial: 5 * time.Second,
+		Min:     10 * time.Second,
+		Max:     time.Minute,
+		Factor:  1.5,
+	}
+	var delays []time.Duration
+	for i := 0; i < 8; i++ {
+		delays = append(delays, b.Delay())
+	}
+	c.Assert(delays, jc.DeepEquals, []time.Duration{
+		5 * time.Second,
+		10 * time.Second,
+		15 * time.Second,
+		22500 * time.Millisecond,
+		33750 * time.Millisecond,
+		50625 * time.Millisecond,
+		time.Minute, // truncated
+		time.Minute,
+	})
+}
+
+func (*scheduleSuite) TestExponentialBackoffInitialAboveMin(c *gc.C) {
+	b := schedule.ExponentialBackoff{Initial: time.Minute}
+	c.Assert(b.Delay(), gc.Equals, time.Minute)
+	c.Assert(b.Delay(), gc.Equals, 2*time.Minute)
+	c.Assert(b.Delay(), gc.Equals, 4*time.Minute)
+}
+
+func (*scheduleSuite) TestExponentialBackoffMinAboveMax(c *gc.C) {
+	// Min is clamped to Max, so no retry is delayed beyond Max.
+	b := schedule.ExponentialBackoff{Min: time.Minute, Max: 10 * time.Second}
+	c.Assert(b.Delay(), gc.Equals, time.Duration(0))
+	c.Assert(b.Delay(), gc.Equals, 10*time.Second)
+	c.Assert(b.Delay(), gc.Equals, 10*time.Second)
+
+	// The default minimum is clamped likewise.
+	b = schedule.ExponentialBackoff{Max: 10 * time.Second}
+	c.Assert(b.Delay(), gc.Equals, time.Duration(0))
+	c.Assert(b.Delay(), gc.Equals, 10*time.Second)
+	c.Assert(b.Delay(), gc.Equals, 10*time.Second)
+}
+
+func (*scheduleSuite) TestCappedOperation(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := schedule.NewSchedule[string, *cappedOperation](clock)
+	op := &cappedOperation{exponentialBackoffOperation{key: "key"}, 2 * time.Minute}
+
+	expectedTimes := []time.Time{
+		now,
+		now.Add(30 * time.Second),
+		now.Add(1 * time.Minute),
+		now.Add(2 * time.Minute),
+		now.Add(2 * time.Minute), // capped
+		now.Add(2 * time.Minute),
+	}
+	for i, expected := range expectedTimes {
+		c.Logf("%d: expect %s", i, expected)
+		t := s.Add(op)
+		c.Assert(t, gc.DeepEquals, expected)
+		s.Remove(op.Key())
+	}
+}
+
+func (*scheduleSuite) TestDelaySince(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := schedule.NewSchedule[string, *firstScheduledOperation](clock)
+	op := &firstScheduledOperation{operation: operation{"k0", "v0", 3 * time.Second}}
+
+	c.Assert(s.Add(op), gc.Equals, now.Add(3*time.Second))
+
+	// Removing and re-adding the operation does not
+	// push its scheduled time later.
+	clock.Advance(2 * time.Second)
+	s.Remove("k0")
+	c.Assert(s.Add(op), gc.Equals, now.Add(3*time.Second))
+
+	// If the delay has already elapsed, the operation
+	// is ready immediately.
+	clock.Advance(2 * time.Second)
+	s.Remove("k0")
+	c.Assert(s.Add(op), gc.Equals, now.Add(3*time.Second))
+	assertReady(c, s, clock, op)
+
+	op.Reset()
+	c.Assert(s.Add(op), gc.Equals, now.Add(7*time.Second))
+}
+
+func (*scheduleSuite) TestExponentialBackoffAttempts(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	b := schedule.ExponentialBackoff{Clock: clock}
+	c.Assert(b.Attempts(), gc.Equals, 0)
+	c.Assert(b.ElapsedSinceFirst(), gc.Equals, time.Duration(0))
+
+	clock.Advance(time.Minute)
+	b.Delay()
+	clock.Advance(30 * time.Second)
+	b.Delay()
+	clock.Advance(time.Minute)
+	c.Assert(b.Attempts(), gc.Equals, 2)
+	c.Assert(b.ElapsedSinceFirst(), gc.Equals, 90*time.Second)
+
+	b.Reset()
+	c.Assert(b.Attempts(), gc.Equals, 0)
+	c.Assert(b.ElapsedSinceFirst(), gc.Equals, time.Duration(0))
+	c.Assert(b.Delay(), gc.Equals, time.Duration(0))
+	c.Assert(b.Delay(), gc.Equals, 30*time.Second)
+}
+
+func (*scheduleSuite) TestMemoryUsage(c *gc.C) {
+	s := schedule.NewSchedule[string, operation](clocktesting.NewClock(time.Time{}))
+	s.Add(operation{key: "k0"})
+	s.Add(operation{key: "k1"})
+	usage := s.MemoryUsage()
+	c.Assert(usage.Items, gc.Equals, 2)
+	c.Assert(usage.Sized, gc.Equals, 0)
+	c.Assert(usage.Bytes > 0, jc.IsTrue)
+}
+
+func (*scheduleSuite) TestPop(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
+	op0 := operation{"k0", "v0", 0}
+	op1 := operation{"k1", "v1", time.Second}
+	s.Add(op1)
+	s.Add(op0)
+
+	op, err := s.Pop(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(op, gc.Equals, op0)
+
+	h := clocktesting.NewHarness(clock)
+	popped := make(chan operation, 1)
+	go func() {
+		op, err := s.Pop(context.Background())
+		c.Check(err, jc.ErrorIsNil)
+		popped <- op
+	}()
+	h.Settle(c)
+	clocktesting.ExpectTimer(c, clock, time.Second)
+	assertNotReceived(c, popped)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(<-popped, gc.Equals, op1)
+	c.Assert(s.DueWithin(time.Hour), gc.HasLen, 0)
+	h.AssertNoLeaks(c)
+}
+
+func (*scheduleSuite) TestPopContextDone(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Pop(ctx)
+	c.Assert(err, gc.Equals, context.Canceled)
+
+	h := clocktesting.NewHarness(clock)
+	ctx, cancel = context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.Pop(ctx)
+		errs <- err
+	}()
+	h.Settle(c)
+	cancel()
+	select {
+	case err := <-errs:
+		c.Assert(err, gc.Equals, context.Canceled)
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("Pop did not return")
+	}
+	h.AssertNoLeaks(c)
+}
+
+func (*scheduleSuite) TestPopLocker(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	var mu sync.Mutex
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:  clock,
+		Locker: &mu,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.Add(operation{"k0", "v0", time.Minute})
+
+	h := clocktesting.NewHarness(clock)
+	popped := make(chan operation, 1)
+	go func() {
+		mu.Lock()
+		defer mu.Unlock()
+		op, err := s.Pop(context.Background())
+		c.Check(err, jc.ErrorIsNil)
+		popped <- op
+	}()
+	h.Settle(c)
+	clocktesting.ExpectTimer(c, clock, time.Minute)
+
+	// Adding an earlier operation while Pop waits rearms its timer.
+	op1 := operation{"k1", "v1", time.Second}
+	mu.Lock()
+	s.Add(op1)
+	mu.Unlock()
+	h.Settle(c)
+	clocktesting.ExpectTimer(c, clock, time.Second)
+
+	// As does removing it again.
+	mu.Lock()
+	s.Remove("k1")
+	mu.Unlock()
+	h.Settle(c)
+	clocktesting.ExpectTimer(c, clock, time.Minute)
+
+	mu.Lock()
+	s.Add(op1)
+	mu.Unlock()
+	h.Settle(c)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(<-popped, gc.Equals, op1)
+	h.AssertNoLeaks(c)
+
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(s.DueWithin(time.Hour), gc.HasLen, 1)
+}
+
+func (*scheduleSuite) TestPopRateLimit(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:     clock,
+		RateLimit: schedule.RateLimit{Limit: 1, Window: time.Second},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := operation{"k0", "v0", 0}
+	op1 := operation{"k1", "v1", 0}
+	s.AddAll([]operation{op0, op1})
+
+	op, err := s.Pop(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(op, gc.Equals, op0)
+
+	h := clocktesting.NewHarness(clock)
+	popped := make(chan operation, 1)
+	go func() {
+		op, err := s.Pop(context.Background())
+		c.Check(err, jc.ErrorIsNil)
+		popped <- op
+	}()
+	h.Settle(c)
+	clocktesting.ExpectTimer(c, clock, time.Second)
+	h.AdvanceAndSettle(c, time.Second)
+	c.Assert(<-popped, gc.Equals, op1)
+	h.AssertNoLeaks(c)
+}
+
 type operation struct {
 	key   string
 	value string
 	delay time.Duration
 }
 
-func (o operation) Key() interface{} {
+func (o operation) Key() string {
 	return o.key
 }
 
@@ -144,40 +1017,108 @@ func (o operation) Delay() time.Duration {
 	return o.delay
 }
 
+type taggedOperation struct {
+	operation
+	tags []string
+}
+
+func (o taggedOperation) Tags() []string {
+	return o.tags
+}
+
+type groupedOperation struct {
+	operation
+	group string
+}
+
+func (o groupedOperation) Group() string {
+	return o.group
+}
+
 type exponentialBackoffOperation struct {
 	schedule.ExponentialBackoff
 	key string
 }
 
-func (o *exponentialBackoffOperation) Key() interface{} {
+func (o *exponentialBackoffOperation) Key() string {
 	return o.key
 }
 
-func assertNextOp(c *gc.C, s *schedule.Schedule, clock *coretesting.Clock, d time.Duration) {
-	next := s.Next()
-	c.Assert(next, gc.NotNil)
-	if d > 0 {
-		select {
-		case <-next:
-			c.Fatal("Next channel signalled too soon")
-		default:
-		}
-	}
+type firstScheduledOperation struct {
+	schedule.FirstScheduled
+	operation
+}
 
-	// temporarily move time forward
-	clock.Advance(d)
-	defer clock.Advance(-d)
+type prioritizedOperation struct {
+	operation
+	priority int
+}
 
-	select {
-	case _, ok := <-next:
-		c.Assert(ok, jc.IsTrue)
-		// the time value is unimportant to us
-	default:
-		c.Fatal("Next channel not signalled")
-	}
+func (o prioritizedOperation) Priority() int {
+	return o.priority
+}
+
+type cappedOperation struct {
+	exponentialBackoffOperation
+	max time.Duration
 }
 
-func assertReady(c *gc.C, s *schedule.Schedule, clock *coretesting.Clock, expect ...schedule.Operation) {
+func (o *cappedOperation) MaxDelay() time.Duration {
+	return o.max
+}
+
+func assertReady[O schedule.Operation[string]](c *gc.C, s *schedule.Schedule[string, O], clock *clocktesting.Clock, expect ...O) {
 	ready := s.Ready(clock.Now())
 	c.Assert(ready, jc.DeepEquals, expect)
 }
+
+func (*scheduleSuite) TestRandomClock(c *gc.C) {
+	configs := map[string]schedule.Config[string, operation]{
+		"default":    {},
+		"rate limit": {RateLimit: schedule.RateLimit{Limit: 5, Window: 100 * time.Millisecond}},
+		"smoothing":  {Smoothing: 50 * time.Millisecond},
+		"ack":        {AckTimeout: time.Second},
+	}
+	for name, config := range configs {
+		for seed := int64(0); seed < 20; seed++ {
+			clock := clocktesting.NewRandomClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), seed, time.Millisecond)
+			config.Clock = clock
+			s, err := schedule.New(config)
+			c.Assert(err, jc.ErrorIsNil)
+
+			// Every operation is released exactly once, and
+			// not before the time for which it was scheduled,
+			// however the time moves between observations.
+			scheduled := make(map[string]time.Time)
+			for i := 0; i < 50; i++ {
+				op := operation{fmt.Sprintf("k%d", i), "v", time.Duration(i%7) * 3 * time.Millisecond}
+				scheduled[op.key] = s.Add(op)
+			}
+			for steps := 0; len(scheduled) > 0; steps++ {
+				if steps > 10000 {
+					c.Fatalf("%s (seed %d): operations not released: %v", name, clock.Seed(), scheduled)
+				}
+				now := clock.Now()
+				for _, op := range s.Ready(now) {
+					when, ok := scheduled[op.key]
+					if !ok {
+						c.Fatalf("%s (seed %d): operation %s released twice", name, clock.Seed(), op.key)
+					}
+					if now.Before(when) {
+						c.Fatalf("%s (seed %d): operation %s scheduled for %v released at %v", name, clock.Seed(), op.key, when, now)
+					}
+					delete(scheduled, op.key)
+					if config.AckTimeout > 0 {
+						c.Assert(s.Ack(op.key), jc.IsTrue)
+					}
+				}
+				select {
+				case <-s.Next():
+				default:
+					clock.Advance(time.Millisecond)
+				}
+			}
+			c.Assert(s.Next(), gc.IsNil)
+		}
+	}
+}
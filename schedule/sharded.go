@@ -0,0 +1,416 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// ShardedConfig holds the configuration for a ShardedSchedule.
+type ShardedConfig[K comparable, O Operation[K]] struct {
+	// Config is the configuration for each of the shards. Limits,
+	// such as RateLimit and MaxPending, apply to each shard alone.
+	Config[K, O]
+
+	// Shards is the number of shards over which operations are
+	// partitioned.
+	Shards int
+
+	// Shard, if non-nil, returns the shard for an operation's key,
+	// which is taken modulo the number of shards. This may be used,
+	// for example, to place all of a tenant's operations in the same
+	// shard. If Shard is nil, keys are partitioned by their hash.
+	Shard func(key K) int
+}
+
+// Validate checks that the config is valid.
+func (config ShardedConfig[K, O]) Validate() error {
+	if err := config.Config.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if config.Shards <= 0 {
+		return errors.NotValidf("non-positive Shards")
+	}
+	return nil
+}
+
+// ShardedSchedule partitions operations across a number of schedules,
+// each with its own lock, so that concurrent callers adding and removing
+// operations with different keys rarely contend. Next, NextTime and Ready
+// present a merged view of the shards.
+//
+// Unlike Schedule, ShardedSchedule's methods are safe for concurrent use.
+// Ready, ReadyMatching and Flush observe an atomic snapshot of the shards:
+// they hold every shard's lock at once, and AddAll holds the locks of all
+// the shards to which it adds, so the operations added by a concurrent
+// call to AddAll are either all included or none are. Other methods that
+// visit each shard in turn, such as NextTime, Len and Clear, do not; for
+// example, NextTime may miss an operation that is added to an earlier
+// shard meanwhile. Callbacks configured for the shards, such as OnDrop,
+// are called with the shard's lock held, and so must not call the
+// ShardedSchedule's methods.
+type ShardedSchedule[K comparable, O Operation[K]] struct {
+	time   clock.Clock
+	shards []shard[K, O]
+	shard  func(key K) int
+	seed   maphash.Seed
+
+	// mu protects timer, which is reused by Next.
+	mu    sync.Mutex
+	timer clock.Timer
+}
+
+type shard[K comparable, O Operation[K]] struct {
+	mu sync.Mutex
+	s  *Schedule[K, O]
+}
+
+// NewSharded constructs a new sharded schedule with the given
+// configuration.
+func NewSharded[K comparable, O Operation[K]](config ShardedConfig[K, O]) (*ShardedSchedule[K, O], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating sharded schedule config")
+	}
+	s := &ShardedSchedule[K, O]{
+		time:   config.Clock,
+		shards: make([]shard[K, O], config.Shards),
+		shard:  config.Shard,
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range s.shards {
+		shard, err := New(config.Config)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		s.shards[i].s = shard
+	}
+	return s, nil
+}
+
+// Shard returns the index of the shard holding operations with the
+// specified key.
+func (s *ShardedSchedule[K, O]) Shard(key K) int {
+	n := len(s.shards)
+	if s.shard == nil {
+		return int(s.hash(key) % uint64(n))
+	}
+	i := s.shard(key) % n
+	if i < 0 {
+		i += n
+	}
+	return i
+}
+
+// hash returns the hash of the key. String and integer keys are hashed
+// directly; other keys are hashed by their formatted value.
+func (s *ShardedSchedule[K, O]) hash(key K) uint64 {
+	switch key := any(key).(type) {
+	case string:
+		return maphash.String(s.seed, key)
+	case int:
+		return s.hashUint(uint64(key))
+	case int64:
+		return s.hashUint(uint64(key))
+	case uint64:
+		return s.hashUint(key)
+	}
+	return maphash.String(s.seed, fmt.Sprint(key))
+}
+
+func (s *ShardedSchedule[K, O]) hashUint(v uint64) uint64 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return maphash.Bytes(s.seed, b[:])
+}
+
+func (s *ShardedSchedule[K, O]) shardFor(key K) *shard[K, O] {
+	return &s.shards[s.Shard(key)]
+}
+
+// Add is like Schedule.Add, locking only the operation's shard.
+func (s *ShardedSchedule[K, O]) Add(op O) time.Time {
+	shard := s.shardFor(op.Key())
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.Add(op)
+}
+
+// TryAdd is like Schedule.TryAdd, locking only the operation's shard.
+func (s *ShardedSchedule[K, O]) TryAdd(op O) (time.Time, error) {
+	shard := s.shardFor(op.Key())
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.TryAdd(op)
+}
+
+// AddOrAdvance is like Schedule.AddOrAdvance, locking only the
+// operation's shard.
+func (s *ShardedSchedule[K, O]) AddOrAdvance(op O) time.Time {
+	shard := s.shardFor(op.Key())
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.AddOrAdvance(op)
+}
+
+// AddAll is like Schedule.AddAll, adding the operations to each shard
+// in turn. The locks of all the shards to which operations are added are
+// held throughout, so that Ready observes all of the operations or none.
+func (s *ShardedSchedule[K, O]) AddAll(ops []O) []time.Time {
+	byShard := make([][]int, len(s.shards))
+	var locked []int
+	for i, op := range ops {
+		j := s.Shard(op.Key())
+		byShard[j] = append(byShard[j], i)
+	}
+	for j, indices := range byShard {
+		if len(indices) != 0 {
+			locked = append(locked, j)
+		}
+	}
+	defer s.lock(locked)()
+	times := make([]time.Time, len(ops))
+	for _, j := range locked {
+		indices := byShard[j]
+		shardOps := make([]O, len(indices))
+		for k, i := range indices {
+			shardOps[k] = ops[i]
+		}
+		shardTimes := s.shards[j].s.AddAll(shardOps)
+		for k, i := range indices {
+			times[i] = shardTimes[k]
+		}
+	}
+	return times
+}
+
+// lock locks the shards with the specified indices, which must be in
+// ascending order, so that callers locking several shards at once do
+// not deadlock, and returns a function that unlocks them. If indices
+// is nil, all shards are locked.
+func (s *ShardedSchedule[K, O]) lock(indices []int) (unlock func()) {
+	if indices == nil {
+		indices = make([]int, len(s.shards))
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+	for _, i := range indices {
+		s.shards[i].mu.Lock()
+	}
+	return func() {
+		for _, i := range indices {
+			s.shards[i].mu.Unlock()
+		}
+	}
+}
+
+// Get is like Schedule.Get, locking only the operation's shard.
+func (s *ShardedSchedule[K, O]) Get(key K) (O, time.Time, bool) {
+	shard := s.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.Get(key)
+}
+
+// Remove is like Schedule.Remove, locking only the operation's shard.
+func (s *ShardedSchedule[K, O]) Remove(key K) (O, bool) {
+	shard := s.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.Remove(key)
+}
+
+// Ack is like Schedule.Ack, locking only the operation's shard.
+func (s *ShardedSchedule[K, O]) Ack(key K) bool {
+	shard := s.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.Ack(key)
+}
+
+// Nack is like Schedule.Nack, locking only the operation's shard.
+func (s *ShardedSchedule[K, O]) Nack(key K) bool {
+	shard := s.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.Nack(key)
+}
+
+// TryAck is like Schedule.TryAck, locking only the operation's shard.
+func (s *ShardedSchedule[K, O]) TryAck(key K) error {
+	shard := s.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.TryAck(key)
+}
+
+// TryNack is like Schedule.TryNack, locking only the operation's shard.
+func (s *ShardedSchedule[K, O]) TryNack(key K) error {
+	shard := s.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.s.TryNack(key)
+}
+
+// Clear is like Schedule.Clear, clearing each shard in turn. f is
+// called without any locks held.
+func (s *ShardedSchedule[K, O]) Clear(f func(op O)) {
+	var removed []O
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		if f == nil {
+			shard.s.Clear(nil)
+		} else {
+			shard.s.Clear(func(op O) {
+				removed = append(removed, op)
+			})
+		}
+		shard.mu.Unlock()
+	}
+	for _, op := range removed {
+		f(op)
+	}
+}
+
+// Flush is like Schedule.Flush, flushing all shards at once, and
+// returning the operations of all shards in order of time.
+func (s *ShardedSchedule[K, O]) Flush() []O {
+	var flushed []timequeue.Item[K, O]
+	unlock := s.lock(nil)
+	for i := range s.shards {
+		flushed = append(flushed, s.shards[i].s.flushItems()...)
+	}
+	unlock()
+	if len(flushed) == 0 {
+		return nil
+	}
+	sort.SliceStable(flushed, func(i, j int) bool {
+		return flushed[i].Time.Before(flushed[j].Time)
+	})
+	ops := make([]O, len(flushed))
+	for i, item := range flushed {
+		ops[i] = item.Value
+	}
+	return ops
+}
+
+// Len returns the number of operations in the schedule.
+func (s *ShardedSchedule[K, O]) Len() int {
+	var n int
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		n += shard.s.q.Len()
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// MemoryUsage returns the total estimated memory used by the pending
+// operations of all shards; see Schedule.MemoryUsage.
+func (s *ShardedSchedule[K, O]) MemoryUsage() timequeue.MemoryUsage {
+	var usage timequeue.MemoryUsage
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		usage = usage.Add(shard.s.MemoryUsage())
+		shard.mu.Unlock()
+	}
+	return usage
+}
+
+// NextTime returns the earliest time at which any shard's Next channel
+// would send, and a boolean indicating whether or not there are any
+// scheduled operations.
+func (s *ShardedSchedule[K, O]) NextTime() (time.Time, bool) {
+	var next time.Time
+	var found bool
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		t, ok := shard.s.NextTime()
+		shard.mu.Unlock()
+		if ok && (!found || t.Before(next)) {
+			next, found = t, true
+		}
+	}
+	return next, found
+}
+
+// Next returns a channel which will send after the time returned by
+// NextTime has been reached. If there are no scheduled operations, nil
+// is returned. As with Schedule.Next, a channel returned by an earlier
+// call to Next should not be waited on after calling Next again.
+//
+// Operations added after Next returns may be due earlier than the
+// channel sends; callers that add operations concurrently with waiting
+// should arrange to call Next again, as a Runner does.
+func (s *ShardedSchedule[K, O]) Next() <-chan time.Time {
+	next, ok := s.NextTime()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !ok {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		return nil
+	}
+	d := next.Sub(s.time.Now())
+	if s.timer == nil {
+		s.timer = clock.NewTimer(s.time, d)
+	} else {
+		s.timer.Reset(d)
+	}
+	return s.timer.Chan()
+}
+
+// Ready is like Schedule.Ready, returning the ready operations of all
+// shards, in order of time, interleaved by group. Ready holds the locks
+// of all shards at once, so that it observes an atomic snapshot of them.
+func (s *ShardedSchedule[K, O]) Ready(now time.Time) []O {
+	return s.ready(now, nil)
+}
+
+// ReadyMatching is like Schedule.ReadyMatching, returning the ready
+// operations of all shards, in order of time.
+func (s *ShardedSchedule[K, O]) ReadyMatching(now time.Time, selector TagSelector) []O {
+	return s.ready(now, func(op O) bool {
+		return selector(operationTags(op))
+	})
+}
+
+func (s *ShardedSchedule[K, O]) ready(now time.Time, match func(O) bool) []O {
+	var ready []timequeue.Item[K, O]
+	unlock := s.lock(nil)
+	for i := range s.shards {
+		ready = append(ready, s.shards[i].s.readyItems(now, match, -1)...)
+	}
+	unlock()
+	if len(ready) == 0 {
+		return nil
+	}
+	// Each shard's items are already in order; a stable sort
+	// keeps them so, while merging them with the others.
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].Time.Before(ready[j].Time)
+	})
+	// Operations for the same time from different
+	// shards may share groups.
+	interleave(ready)
+	ops := make([]O, len(ready))
+	for i, item := range ready {
+		ops[i] = item.Value
+	}
+	return ops
+}
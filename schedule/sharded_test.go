@@ -0,0 +1,284 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type shardedSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&shardedSuite{})
+
+func newSharded(c *gc.C, clock *coretesting.Clock, shards int, shard func(string) int) *schedule.ShardedSchedule[string, operation] {
+	s, err := schedule.NewSharded(schedule.ShardedConfig[string, operation]{
+		Config: schedule.Config[string, operation]{Clock: clock},
+		Shards: shards,
+		Shard:  shard,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return s
+}
+
+func (*shardedSuite) TestValidate(c *gc.C) {
+	_, err := schedule.NewSharded(schedule.ShardedConfig[string, operation]{
+		Config: schedule.Config[string, operation]{Clock: coretesting.NewClock(time.Time{})},
+	})
+	c.Assert(err, gc.ErrorMatches, "validating sharded schedule config: non-positive Shards not valid")
+	_, err = schedule.NewSharded(schedule.ShardedConfig[string, operation]{Shards: 1})
+	c.Assert(err, gc.ErrorMatches, "validating sharded schedule config: nil Clock not valid")
+}
+
+func (*shardedSuite) TestMergedReady(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s := newSharded(c, clock, 4, nil)
+	c.Assert(s.Next(), gc.IsNil)
+	for i := 0; i < 20; i++ {
+		s.Add(operation{key: fmt.Sprint(i), delay: time.Duration(20-i) * time.Second})
+	}
+	c.Assert(s.Len(), gc.Equals, 20)
+	next, ok := s.NextTime()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(next, gc.Equals, clock.Now().Add(time.Second))
+
+	clock.Advance(10 * time.Second)
+	select {
+	case <-s.Next():
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for Next")
+	}
+	ready := s.Ready(clock.Now())
+	keys := make([]string, len(ready))
+	for i, op := range ready {
+		keys[i] = op.key
+	}
+	c.Assert(keys, jc.DeepEquals, []string{
+		"19", "18", "17", "16", "15", "14", "13", "12", "11", "10",
+	})
+	c.Assert(s.Len(), gc.Equals, 10)
+
+	op, ok := s.Remove("0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(op.key, gc.Equals, "0")
+
+	var cleared []string
+	s.Clear(func(op operation) {
+		cleared = append(cleared, op.key)
+	})
+	c.Assert(cleared, gc.HasLen, 9)
+	c.Assert(s.Len(), gc.Equals, 0)
+}
+
+func (*shardedSuite) TestFlush(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s := newSharded(c, clock, 4, nil)
+	c.Assert(s.Flush(), gc.HasLen, 0)
+	for i := 0; i < 20; i++ {
+		s.Add(operation{key: fmt.Sprint(i), delay: time.Duration(20-i) * time.Second})
+	}
+	flushed := s.Flush()
+	keys := make([]string, len(flushed))
+	for i, op := range flushed {
+		keys[i] = op.key
+	}
+	c.Assert(keys, jc.DeepEquals, []string{
+		"19", "18", "17", "16", "15", "14", "13", "12", "11", "10",
+		"9", "8", "7", "6", "5", "4", "3", "2", "1", "0",
+	})
+	c.Assert(s.Len(), gc.Equals, 0)
+	c.Assert(s.Next(), gc.IsNil)
+}
+
+func (*shardedSuite) TestShardFunc(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	tenants := map[string]int{"a": 0, "b": 1, "c": 5}
+	s := newSharded(c, clock, 3, func(key string) int {
+		return tenants[strings.SplitN(key, "/", 2)[0]]
+	})
+	c.Assert(s.Shard("a/1"), gc.Equals, 0)
+	c.Assert(s.Shard("a/2"), gc.Equals, 0)
+	c.Assert(s.Shard("b/1"), gc.Equals, 1)
+	c.Assert(s.Shard("c/1"), gc.Equals, 2)
+
+	s = newSharded(c, clock, 3, func(string) int { return -1 })
+	c.Assert(s.Shard("x"), gc.Equals, 2)
+
+	// Hashing is consistent for a schedule.
+	s = newSharded(c, clock, 8, nil)
+	c.Assert(s.Shard("x"), gc.Equals, s.Shard("x"))
+}
+
+func (*shardedSuite) TestAddAll(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s := newSharded(c, clock, 4, nil)
+	var ops []operation
+	for i := 0; i < 10; i++ {
+		ops = append(ops, operation{key: fmt.Sprint(i), delay: time.Duration(i) * time.Second})
+	}
+	times := s.AddAll(ops)
+	for i, t := range times {
+		c.Assert(t, gc.Equals, clock.Now().Add(time.Duration(i)*time.Second))
+	}
+	c.Assert(s.Len(), gc.Equals, 10)
+}
+
+func (*shardedSuite) TestAddOrAdvance(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s := newSharded(c, clock, 4, nil)
+	now := clock.Now()
+	c.Assert(s.AddOrAdvance(operation{"k0", "v0", 3 * time.Second}), gc.Equals, now.Add(3*time.Second))
+	c.Assert(s.AddOrAdvance(operation{"k0", "v1", 5 * time.Second}), gc.Equals, now.Add(3*time.Second))
+	c.Assert(s.AddOrAdvance(operation{"k0", "v2", time.Second}), gc.Equals, now.Add(time.Second))
+	c.Assert(s.Len(), gc.Equals, 1)
+}
+
+func (*shardedSuite) TestMaxPendingPerShard(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s, err := schedule.NewSharded(schedule.ShardedConfig[string, operation]{
+		Config: schedule.Config[string, operation]{Clock: clock, MaxPending: 1},
+		Shards: 2,
+		Shard: func(key string) int {
+			return len(key)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.TryAdd(operation{key: "a"})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.TryAdd(operation{key: "bb"})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.TryAdd(operation{key: "c"})
+	c.Assert(errors.Is(err, schedule.ErrQueueFull), jc.IsTrue)
+}
+
+func (*shardedSuite) TestConcurrent(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s := newSharded(c, clock, 8, nil)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("%d/%d", g, i)
+				s.Add(operation{key: key})
+				if i%2 == 0 {
+					s.Remove(key)
+				}
+				s.NextTime()
+			}
+		}(g)
+	}
+	wg.Wait()
+	c.Assert(s.Len(), gc.Equals, 400)
+	c.Assert(s.Ready(clock.Now()), gc.HasLen, 400)
+}
+
+func (*shardedSuite) TestReadySnapshot(c *gc.C) {
+	const (
+		writers   = 4
+		batches   = 200
+		batchSize = 8
+	)
+	clock := coretesting.NewClock(time.Time{})
+	s := newSharded(c, clock, 8, nil)
+
+	// Each writer adds batches of operations, spread across the shards,
+	// with AddAll; each call to Ready must observe all of a batch's
+	// operations or none of them.
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for b := 0; b < batches; b++ {
+				ops := make([]operation, batchSize)
+				for i := range ops {
+					ops[i] = operation{key: fmt.Sprintf("%d/%d/%d", w, b, i)}
+				}
+				s.AddAll(ops)
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	seen := make(map[string]int)
+	check := func(ready []operation) {
+		counts := make(map[string]int)
+		for _, op := range ready {
+			batch := op.key[:strings.LastIndex(op.key, "/")]
+			counts[batch]++
+		}
+		for batch, n := range counts {
+			c.Assert(n, gc.Equals, batchSize, gc.Commentf("batch %s", batch))
+			seen[batch] += n
+		}
+	}
+	for {
+		select {
+		case <-done:
+			check(s.Ready(clock.Now()))
+			c.Assert(seen, gc.HasLen, writers*batches)
+			c.Assert(s.Len(), gc.Equals, 0)
+			return
+		default:
+			check(s.Ready(clock.Now()))
+		}
+	}
+}
+
+func (*shardedSuite) TestHashKeys(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	type key struct{ a, b int }
+	s, err := schedule.NewSharded(schedule.ShardedConfig[key, keyedOperation[key]]{
+		Config: schedule.Config[key, keyedOperation[key]]{Clock: clock},
+		Shards: 16,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	used := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		k := key{i, i}
+		c.Assert(s.Shard(k), gc.Equals, s.Shard(k))
+		used[s.Shard(k)] = true
+	}
+	// Keys are spread across the shards.
+	c.Assert(len(used) > 8, jc.IsTrue)
+}
+
+type keyedOperation[K comparable] struct {
+	key K
+}
+
+func (o keyedOperation[K]) Key() K {
+	return o.key
+}
+
+func (o keyedOperation[K]) Delay() time.Duration {
+	return 0
+}
+
+func (*shardedSuite) TestMemoryUsage(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s := newSharded(c, clock, 4, nil)
+	for i := 0; i < 10; i++ {
+		s.Add(operation{key: fmt.Sprint(i)})
+	}
+	usage := s.MemoryUsage()
+	c.Assert(usage.Items, gc.Equals, 10)
+	c.Assert(usage.Bytes > 0, jc.IsTrue)
+}
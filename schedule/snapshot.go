@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"sort"
+	"time"
+)
+
+// maxTime is the latest representable time.
+var maxTime = time.Unix(1<<63-62135596801, 999999999)
+
+// ExecutingOperation describes an operation executing in a Runner.
+type ExecutingOperation[O any] struct {
+	Op      O
+	Started time.Time
+}
+
+// RunnerSnapshot describes the state of a Runner at an instant, for
+// diagnostic purposes.
+type RunnerSnapshot[K comparable, O any] struct {
+	// Time is the time of the snapshot, according to the clock
+	// of the Runner's schedule.
+	Time time.Time
+
+	// Pending holds the operations in the Runner's schedule,
+	// in order of time.
+	Pending []ScheduledOperation[O]
+
+	// Blocked holds the ready operations waiting for the operations
+	// that they depend on to complete, in the order they became
+	// ready.
+	Blocked []O
+
+	// Queued holds the ready operations waiting for a free slot,
+	// in no particular order.
+	Queued []O
+
+	// Executing holds the operations currently executing,
+	// in the order they started.
+	Executing []ExecutingOperation[O]
+
+	// Parked holds the operations parked by the error policy,
+	// in the order they were parked.
+	Parked []O
+
+	// DeadLetters holds the operations that the Runner has
+	// given up on; see Runner.DeadLetters.
+	DeadLetters []DeadLetter[O]
+
+	// AuditLog holds the most recent decisions made by the
+	// Runner's schedule; see Schedule.AuditLog.
+	AuditLog []AuditEvent[K]
+
+	// Latencies holds the execution statistics recorded by the
+	// Runner, by class; see Runner.Latencies.
+	Latencies map[string]LatencyStats
+}
+
+// Snapshot returns a snapshot of the Runner's state. The operations
+// are copied as if by assignment, so if O is a pointer type, they are
+// shared with the Runner, and must not be modified.
+func (r *Runner[K, O]) Snapshot() RunnerSnapshot[K, O] {
+	r.mu.Lock()
+	snapshot := RunnerSnapshot[K, O]{
+		Time:        r.schedule.time.Now(),
+		Queued:      r.queued.list(),
+		Parked:      r.parkedOps(),
+		DeadLetters: r.deadLetters(),
+		AuditLog:    r.schedule.AuditLog(),
+	}
+	for _, item := range r.schedule.q.Due(maxTime) {
+		snapshot.Pending = append(snapshot.Pending, ScheduledOperation[O]{Op: item.Value, Time: item.Time})
+	}
+	for _, q := range r.blocked {
+		snapshot.Blocked = append(snapshot.Blocked, q.op)
+	}
+	ids := make([]uint64, 0, len(r.executions))
+	for id := range r.executions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		e := r.executions[id]
+		snapshot.Executing = append(snapshot.Executing, ExecutingOperation[O]{e.op, e.started})
+	}
+	r.mu.Unlock()
+	snapshot.Latencies = r.Latencies()
+	return snapshot
+}
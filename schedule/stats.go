@@ -0,0 +1,76 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+// RunnerStats holds the sizes of a Runner's collections of operations,
+// and counts of the outcomes of its executions since it was created.
+// RunnerStats is intended for exporting as metrics, so the counts only
+// ever increase.
+type RunnerStats struct {
+	// Pending is the number of operations in the Runner's schedule.
+	Pending int
+
+	// Blocked, Queued, Active and Parked are as returned by the
+	// Runner methods of the same names.
+	Blocked int
+	Queued  int
+	Active  int
+	Parked  int
+
+	// Ready is the number of operations that have become ready,
+	// having been taken from the Runner's schedule for execution.
+	Ready uint64
+
+	// Executed is the number of executions that have completed,
+	// and Failed the number of those that returned an error or
+	// panicked.
+	Executed uint64
+	Failed   uint64
+
+	// Retried is the number of failed executions whose operations
+	// were retried, as directed by the error policy, and Dropped
+	// the number whose operations were dropped, either by the error
+	// policy or because the schedule was full. ParkedTotal is the
+	// number of failed executions whose operations were parked.
+	Retried     uint64
+	Dropped     uint64
+	ParkedTotal uint64
+
+	// Expired is the number of failed executions whose operations
+	// were dropped on exceeding the Runner's MaxLifetime; these are
+	// included in Dropped.
+	Expired uint64
+}
+
+// runnerCounts records the outcomes of a Runner's executions;
+// see RunnerStats.
+type runnerCounts struct {
+	ready    uint64
+	executed uint64
+	failed   uint64
+	retried  uint64
+	dropped  uint64
+	parked   uint64
+	expired  uint64
+}
+
+// Stats returns the Runner's current statistics.
+func (r *Runner[K, O]) Stats() RunnerStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RunnerStats{
+		Pending:     r.schedule.q.Len(),
+		Blocked:     len(r.blocked),
+		Queued:      r.queued.size,
+		Active:      r.active,
+		Parked:      len(r.parked),
+		Ready:       r.counts.ready,
+		Executed:    r.counts.executed,
+		Failed:      r.counts.failed,
+		Retried:     r.counts.retried,
+		Dropped:     r.counts.dropped,
+		ParkedTotal: r.counts.parked,
+		Expired:     r.counts.expired,
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+// TaggedOperation may be implemented by an Operation to associate it
+// with a set of arbitrary string tags, which may be used to select
+// operations with ReadyMatching.
+type TaggedOperation interface {
+	// Tags returns the operation's tags.
+	Tags() []string
+}
+
+// TagSelector reports whether or not an operation with the
+// specified tags is selected.
+type TagSelector func(tags []string) bool
+
+// AnyTag returns a TagSelector that selects operations with
+// at least one of the specified tags.
+func AnyTag(tags ...string) TagSelector {
+	return func(opTags []string) bool {
+		for _, tag := range tags {
+			if hasTag(opTags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllTags returns a TagSelector that selects operations with
+// all of the specified tags.
+func AllTags(tags ...string) TagSelector {
+	return func(opTags []string) bool {
+		for _, tag := range tags {
+			if !hasTag(opTags, tag) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Not returns a TagSelector that selects operations that are
+// not selected by the specified selector.
+func Not(selector TagSelector) TagSelector {
+	return func(opTags []string) bool {
+		return !selector(opTags)
+	}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// operationTags returns the tags of the operation, if it
+// implements TaggedOperation, and nil otherwise.
+func operationTags(op interface{}) []string {
+	if tagged, ok := op.(TaggedOperation); ok {
+		return tagged.Tags()
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package testing provides helpers for deterministically testing code
+// that uses schedules, by driving a Schedule and a test clock through
+// scripted scenarios.
+package testing
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/schedule"
+	gc "gopkg.in/check.v1"
+)
+
+// Clock is the interface for test clocks that may be used with a
+// Harness: a clock.Clock whose time is advanced manually.
+type Clock interface {
+	clock.Clock
+
+	// Advance advances the clock by the specified duration,
+	// triggering any alarms whose time is reached.
+	Advance(d time.Duration)
+}
+
+// Harness drives a Schedule and the test clock that it was
+// constructed with, making assertions about the operations that
+// become ready as the clock is advanced.
+type Harness[K comparable, O schedule.Operation[K]] struct {
+	Schedule *schedule.Schedule[K, O]
+	Clock    Clock
+}
+
+// NewHarness returns a new Harness for the given schedule, which
+// must have been constructed with the given clock.
+func NewHarness[K comparable, O schedule.Operation[K]](s *schedule.Schedule[K, O], clock Clock) *Harness[K, O] {
+	return &Harness[K, O]{Schedule: s, Clock: clock}
+}
+
+// Advance advances the harness's clock by the specified duration.
+func (h *Harness[K, O]) Advance(d time.Duration) {
+	h.Clock.Advance(d)
+}
+
+// AssertReady calls Ready on the schedule with the current time,
+// and asserts that the keys of the returned operations are exactly
+// those specified, in any order. The ready operations are returned.
+func (h *Harness[K, O]) AssertReady(c *gc.C, expect ...K) []O {
+	return h.assertReady(c, nil, expect)
+}
+
+func (h *Harness[K, O]) assertReady(c *gc.C, comment gc.CommentInterface, expect []K) []O {
+	now := h.Clock.Now()
+	ready := h.Schedule.Ready(now)
+	keys := make([]K, len(ready))
+	for i, op := range ready {
+		keys[i] = op.Key()
+	}
+	obtained, expected := sortedKeys(keys), sortedKeys(expect)
+	if comment == nil {
+		comment = gc.Commentf("ready operations at %v", now)
+	}
+	c.Assert(obtained, gc.DeepEquals, expected, comment)
+	return ready
+}
+
+// AssertNextIn asserts that the schedule's next operation is due at
+// exactly d after the current time.
+func (h *Harness[K, O]) AssertNextIn(c *gc.C, d time.Duration) {
+	h.AssertNextAt(c, h.Clock.Now().Add(d))
+}
+
+// AssertNextAt asserts that the schedule's next operation is due at
+// exactly the specified time.
+func (h *Harness[K, O]) AssertNextAt(c *gc.C, t time.Time) {
+	h.assertNextAt(c, "", t)
+}
+
+func (h *Harness[K, O]) assertNextAt(c *gc.C, prefix string, t time.Time) {
+	now := h.Clock.Now()
+	next, ok := h.Schedule.NextTime()
+	if !ok {
+		c.Fatalf("%sexpected next operation at %v, but the schedule is empty", prefix, t)
+	}
+	if !next.Equal(t) {
+		c.Fatalf("%sexpected next operation at %v (%v from now), got %v (%v from now)",
+			prefix, t, t.Sub(now), next, next.Sub(now),
+		)
+	}
+}
+
+// AssertEmpty asserts that the schedule has no scheduled operations.
+func (h *Harness[K, O]) AssertEmpty(c *gc.C) {
+	h.assertEmpty(c, "")
+}
+
+func (h *Harness[K, O]) assertEmpty(c *gc.C, prefix string) {
+	if next, ok := h.Schedule.NextTime(); ok {
+		c.Fatalf("%sexpected empty schedule, but next operation is at %v", prefix, next)
+	}
+}
+
+// Step is a step in a scenario run by Harness.Run.
+type Step[K comparable] struct {
+	// Advance is the duration by which to advance
+	// the clock at the start of the step.
+	Advance time.Duration
+
+	// Ready holds the keys of the operations expected to be
+	// ready after advancing the clock, in any order.
+	Ready []K
+
+	// Next, if non-zero, is the expected duration from the
+	// step's time until the next operation is due.
+	Next time.Duration
+
+	// Empty, if true, asserts that the schedule has no
+	// scheduled operations at the end of the step.
+	Empty bool
+}
+
+// Run runs the steps of a scenario in order. For each step, the clock
+// is advanced, the operations returned by Ready are checked, and then
+// the schedule's next time is checked. Failures identify the step and
+// the time at which they occurred.
+func (h *Harness[K, O]) Run(c *gc.C, steps ...Step[K]) {
+	for i, step := range steps {
+		h.Advance(step.Advance)
+		now := h.Clock.Now()
+		prefix := fmt.Sprintf("step %d: ", i)
+		h.assertReady(c, gc.Commentf("%sready operations at %v", prefix, now), step.Ready)
+		if step.Next != 0 {
+			h.assertNextAt(c, prefix, now.Add(step.Next))
+		}
+		if step.Empty {
+			h.assertEmpty(c, prefix)
+		}
+	}
+}
+
+// sortedKeys returns the keys sorted by their string representation,
+// so that sets of keys may be compared irrespective of order. An empty
+// set of keys is returned as nil.
+func sortedKeys[K comparable](keys []K) []K {
+	if len(keys) == 0 {
+		return nil
+	}
+	sorted := append([]K(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return fmt.Sprint(sorted[i]) < fmt.Sprint(sorted[j])
+	})
+	return sorted
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	scheduletesting "github.com/axw/juju-time/schedule/testing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type harnessSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&harnessSuite{})
+
+func (*harnessSuite) TestRun(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
+	s.AddAll([]operation{{"k0", time.Second}, {"k1", time.Second}, {"k2", 3 * time.Second}})
+
+	h := scheduletesting.NewHarness(s, clock)
+	h.AssertNextIn(c, time.Second)
+	h.Run(c, []scheduletesting.Step[string]{{
+		Next: time.Second,
+	}, {
+		Advance: time.Second,
+		Ready:   []string{"k1", "k0"},
+		Next:    2 * time.Second,
+	}, {
+		Advance: time.Second,
+	}, {
+		Advance: time.Second,
+		Ready:   []string{"k2"},
+		Empty:   true,
+	}}...)
+}
+
+func (*harnessSuite) TestAssertReady(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	s := schedule.NewSchedule[string, operation](clock)
+	s.Add(operation{"k0", time.Second})
+
+	h := scheduletesting.NewHarness(s, clock)
+	h.AssertReady(c)
+	h.Advance(time.Second)
+	ready := h.AssertReady(c, "k0")
+	c.Assert(ready, jc.DeepEquals, []operation{{"k0", time.Second}})
+	h.AssertEmpty(c)
+}
+
+type operation struct {
+	key   string
+	delay time.Duration
+}
+
+func (o operation) Key() string {
+	return o.key
+}
+
+func (o operation) Delay() time.Duration {
+	return o.delay
+}
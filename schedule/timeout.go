@@ -0,0 +1,104 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// TimeoutOperation may be implemented by a RunnableOperation to limit
+// the duration of each of its executions by a Runner. The context passed
+// to the operation's Do method is done once the timeout has elapsed, as
+// measured by the schedule's Clock; if Do then returns an error, the
+// execution is treated as failed with a *TimeoutError, which by default
+// is retried.
+//
+// The Runner cannot abandon an execution whose Do method ignores its
+// context: such an execution continues to occupy a slot until it
+// returns. A Watchdog's MaxExecuting may be used to detect them. An
+// operation that implements ExtendableOperation may extend its timeout
+// while it makes progress.
+type TimeoutOperation interface {
+	// Timeout returns the maximum duration of each execution of
+	// the operation. If Timeout returns a non-positive value, the
+	// Runner's ExecutionTimeout applies.
+	Timeout() time.Duration
+}
+
+// TimeoutError is the error with which an execution fails when it
+// returns an error after exceeding its timeout.
+type TimeoutError struct {
+	// Timeout is the execution's timeout, including any
+	// extensions by its heartbeats.
+	Timeout time.Duration
+
+	// Err is the error returned by the operation's Do method.
+	Err error
+}
+
+// Error is part of the error interface.
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v: %v", e.Timeout, e.Err)
+}
+
+// Unwrap returns the error returned by the operation's Do method.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// IsTimeout reports whether the error, or the cause of an error
+// annotated with the juju/errors package, is a *TimeoutError.
+func IsTimeout(err error) bool {
+	_, ok := errors.Cause(err).(*TimeoutError)
+	return ok
+}
+
+// operationTimeout returns the timeout for executions of the
+// operation, or zero if they are not limited.
+func (r *Runner[K, O]) operationTimeout(op O) time.Duration {
+	if t, ok := interface{}(op).(TimeoutOperation); ok {
+		if timeout := t.Timeout(); timeout > 0 {
+			return timeout
+		}
+	}
+	return r.config.ExecutionTimeout
+}
+
+// operationMaxTimeout returns the maximum timeout, as extended by
+// heartbeats, for executions of the operation, or zero if they may
+// not be extended.
+func (r *Runner[K, O]) operationMaxTimeout(op O) time.Duration {
+	if t, ok := interface{}(op).(ExtendableOperation); ok {
+		if timeout := t.MaxTimeout(); timeout > 0 {
+			return timeout
+		}
+	}
+	return r.config.MaxExecutionTimeout
+}
+
+// timeoutContext returns a context for an execution of the operation,
+// derived from the parent, which is done once the execution's timeout
+// has elapsed, and a function to call with the error returned by the
+// execution, which releases the context's resources and returns the
+// error to record for the execution. If the execution's timeout may be
+// extended, the context holds its Heartbeat.
+func (r *Runner[K, O]) timeoutContext(parent context.Context, op O) (context.Context, func(error) error) {
+	timeout := r.operationTimeout(op)
+	if timeout <= 0 {
+		return parent, func(err error) error { return err }
+	}
+	ctx, cancel := newHeartbeatContext(parent, r.schedule.time, timeout, r.operationMaxTimeout(op))
+	return ctx, func(err error) error {
+		expired := ctx.Err() == context.DeadlineExceeded
+		cancel()
+		if err != nil && expired {
+			return &TimeoutError{Timeout: ctx.allowed(), Err: err}
+		}
+		return err
+	}
+}
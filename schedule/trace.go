@@ -0,0 +1,37 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import "fmt"
+
+// TracedOperation may be implemented by an Operation to carry a trace
+// ID, correlating the operations of a single logical workflow, and the
+// successive schedulings of each, such as its retries. A Schedule records
+// the trace ID in its audit log, and a Runner in the Execution passed to
+// its OnExecute hook, in its reports of late deliveries and in its log
+// messages.
+type TracedOperation interface {
+	// TraceID returns the operation's trace ID, or the
+	// empty string if it has none.
+	TraceID() string
+}
+
+// operationTraceID returns the operation's trace ID, if it implements
+// TracedOperation, and the empty string otherwise.
+func operationTraceID(op interface{}) string {
+	if traced, ok := op.(TracedOperation); ok {
+		return traced.TraceID()
+	}
+	return ""
+}
+
+// describeOperation returns a description of the operation with the
+// specified key, for log messages: the key, followed by the operation's
+// trace ID, if it has one.
+func describeOperation[K comparable](key K, op interface{}) string {
+	if id := operationTraceID(op); id != "" {
+		return fmt.Sprintf("%v (trace %s)", key, id)
+	}
+	return fmt.Sprint(key)
+}
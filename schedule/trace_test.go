@@ -0,0 +1,94 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (*scheduleSuite) TestTraceID(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	var late []schedule.LateDelivery[string]
+	delivery, err := schedule.NewDeliveryTracker(schedule.DeliveryTrackerConfig[string]{
+		OnLate: func(d schedule.LateDelivery[string]) {
+			late = append(late, d)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s, err := schedule.New(schedule.Config[string, schedule.Operation[string]]{
+		Clock:     clock,
+		AuditSize: 10,
+		Delivery:  delivery,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := clock.Now()
+	op0 := tracedOperation{operation{"k0", "v0", time.Second}, "workflow-1"}
+	op1 := operation{"k1", "v1", time.Second}
+	s.AddAll([]schedule.Operation[string]{op0, op1})
+	s.Remove("k1")
+	clock.Advance(2 * time.Second)
+	c.Assert(s.Ready(clock.Now()), jc.DeepEquals, []schedule.Operation[string]{op0})
+
+	// The trace ID is recorded in the audit log, and reported
+	// with the late delivery, for operations that have one.
+	t1 := t0.Add(time.Second)
+	c.Assert(s.AuditLog(), jc.DeepEquals, []schedule.AuditEvent[string]{
+		{Kind: schedule.AuditAdd, Key: "k0", TraceID: "workflow-1", Time: t0, Scheduled: t1, Delay: time.Second},
+		{Kind: schedule.AuditAdd, Key: "k1", Time: t0, Scheduled: t1, Delay: time.Second},
+		{Kind: schedule.AuditRemove, Key: "k1", Time: t0},
+		{Kind: schedule.AuditReady, Key: "k0", TraceID: "workflow-1", Time: clock.Now(), Scheduled: t1, Delay: -time.Second},
+	})
+	c.Assert(late, jc.DeepEquals, []schedule.LateDelivery[string]{{
+		Key:       "k0",
+		TraceID:   "workflow-1",
+		Scheduled: t1,
+		Delivered: clock.Now(),
+		Lag:       time.Second,
+	}})
+}
+
+func (s *runnerSuite) TestTraceID(c *gc.C) {
+	traces := make(chan string, 10)
+	r := s.newRunner(c, schedule.RunnerConfig[string, *runnableOperation]{
+		OnExecute: func(ctx context.Context, op *runnableOperation, exec schedule.Execution[string]) (context.Context, func(error)) {
+			traces <- exec.TraceID
+			return ctx, func(error) {}
+		},
+	})
+	defer r.Kill()
+
+	// The trace ID follows the operation across its retries.
+	failed := errors.New("failed")
+	var n int
+	r.Add(&runnableOperation{key: "k0", traceID: "workflow-1", do: func(op *runnableOperation, ctx context.Context) error {
+		n++
+		if n < 2 {
+			return failed
+		}
+		return nil
+	}})
+	c.Assert(receive(c, traces), gc.Equals, "workflow-1")
+	c.Assert(advanceUntil(c, s.clock, traces, 30*time.Second), gc.Equals, "workflow-1")
+
+	r.Add(&runnableOperation{key: "k1", do: func(op *runnableOperation, ctx context.Context) error {
+		return nil
+	}})
+	c.Assert(receive(c, traces), gc.Equals, "")
+}
+
+type tracedOperation struct {
+	operation
+	traceID string
+}
+
+func (o tracedOperation) TraceID() string {
+	return o.traceID
+}
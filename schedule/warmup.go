@@ -0,0 +1,87 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+)
+
+// Restore adds the specified operations to the schedule, such as those
+// replayed from a persisted store: each is added for its specified time,
+// or if its time is zero, for the time computed from its delay, as if by
+// Add. If the schedule is configured with WarmUp, the operations that
+// are then overdue, including any that were already pending, are spread
+// across the warm-up window; see Config.WarmUp.
+//
+// Restore returns an *OperationError wrapping ErrDuplicateKey if an
+// operation's key is already scheduled, regardless of the schedule's
+// coalesce policy, ErrQueueFull if the schedule is bounded and the
+// operation is rejected by the overflow policy, or ErrDraining if the
+// schedule is draining; the preceding operations are left in the
+// schedule.
+func (s *Schedule[K, O]) Restore(ops []ScheduledOperation[O]) error {
+	now := s.time.Now()
+	// The operations added before any error are warmed up all the same.
+	defer s.warm(now)
+	for _, d := range ops {
+		key := d.Op.Key()
+		if s.draining {
+			return operationError(key, ErrDraining)
+		}
+		s.supersede(key)
+		if _, _, ok := s.q.Get(key); ok {
+			return operationError(key, ErrDuplicateKey)
+		}
+		when := d.Time
+		if when.IsZero() {
+			when = s.when(now, d.Op)
+		}
+		if err := s.addAt(now, d.Op, when); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore adds the specified operations to the Runner's schedule. See
+// Schedule.Restore.
+func (r *Runner[K, O]) Restore(ops []ScheduledOperation[O]) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	return r.schedule.Restore(ops)
+}
+
+// warm spreads the operations that are overdue at now evenly across the
+// warm-up window, in order of their times, leaving the first as it is.
+// In-flight operations are kept at their ack timeouts.
+func (s *Schedule[K, O]) warm(now time.Time) {
+	if s.warmUp <= 0 {
+		return
+	}
+	var overdue []timequeue.Item[K, O]
+	for _, item := range s.q.Due(now) {
+		if _, inflight := s.inflight[item.Key]; !inflight {
+			overdue = append(overdue, item)
+		}
+	}
+	if len(overdue) < 2 {
+		return
+	}
+	interval := s.warmUp / time.Duration(len(overdue))
+	for i, item := range overdue[1:] {
+		t := now.Add(time.Duration(i+1) * interval)
+		s.q.Update(item.Key, item.Value, t)
+		delete(s.reserved, item.Key)
+		if s.smoothed != nil {
+			// Operations spread by warming up
+			// are not deferred again by smoothing.
+			s.smoothed[item.Key] = true
+		}
+		s.audit(AuditDefer, item.Key, item.Value, now, t)
+	}
+	s.notify()
+}
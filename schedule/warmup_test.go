@@ -0,0 +1,137 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"errors"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func (*scheduleSuite) TestRestore(c *gc.C) {
+	clock := clocktesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	s, err := schedule.New(schedule.Config[string, operation]{Clock: clock})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := clock.Now()
+	op0 := operation{"k0", "v0", 0}
+	op1 := operation{"k1", "v1", time.Second}
+	err = s.Restore([]schedule.ScheduledOperation[operation]{
+		{Op: op0, Time: t0.Add(-time.Minute)},
+		{Op: op1},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Without WarmUp, overdue operations are ready at
+	// once, and those without times use their delays.
+	assertReady(c, s, clock, op0)
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, op1)
+}
+
+func (*scheduleSuite) TestRestoreDuplicate(c *gc.C) {
+	clock := clocktesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:    clock,
+		Coalesce: schedule.CoalesceReplaceValue,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	op0 := operation{"k0", "v0", time.Second}
+	op1 := operation{"k1", "v1", time.Second}
+	s.Add(op0)
+
+	err = s.Restore([]schedule.ScheduledOperation[operation]{
+		{Op: op1, Time: clock.Now()},
+		{Op: operation{"k0", "v0'", 0}, Time: clock.Now()},
+	})
+	c.Assert(err, gc.ErrorMatches, "operation k0: duplicate key")
+	c.Assert(errors.Is(err, schedule.ErrDuplicateKey), jc.IsTrue)
+	assertReady(c, s, clock, op1)
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, op0)
+}
+
+func (*scheduleSuite) TestRestoreWarmUp(c *gc.C) {
+	clock := clocktesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:  clock,
+		WarmUp: 40 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	t0 := clock.Now()
+	ops := []operation{
+		{"k0", "v0", 0},
+		{"k1", "v1", 0},
+		{"k2", "v2", 0},
+		{"k3", "v3", 0},
+		{"k4", "v4", 0},
+	}
+	err = s.Restore([]schedule.ScheduledOperation[operation]{
+		{Op: ops[3], Time: t0.Add(-time.Minute)},
+		{Op: ops[0], Time: t0.Add(-4 * time.Minute)},
+		{Op: ops[4], Time: t0.Add(15 * time.Second)},
+		{Op: ops[2], Time: t0.Add(-2 * time.Minute)},
+		{Op: ops[1], Time: t0.Add(-3 * time.Minute)},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// The overdue operations are spread evenly across the
+	// window, in order of their times; the others are not
+	// affected.
+	assertReady(c, s, clock, ops[0])
+	clock.Advance(9 * time.Second)
+	assertReady(c, s, clock)
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, ops[1])
+	clock.Advance(5 * time.Second)
+	assertReady(c, s, clock, ops[4])
+	clock.Advance(5 * time.Second)
+	assertReady(c, s, clock, ops[2])
+	clock.Advance(10 * time.Second)
+	assertReady(c, s, clock, ops[3])
+}
+
+func (*scheduleSuite) TestWarmUpOnResume(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	health := newFakeClockHealth()
+	s, err := schedule.New(schedule.Config[string, operation]{
+		Clock:          clock,
+		ClockHealth:    health,
+		UnhealthyClock: schedule.UnhealthyClockPause,
+		WarmUp:         30 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	ops := []operation{
+		{"k0", "v0", time.Second},
+		{"k1", "v1", 2 * time.Second},
+		{"k2", "v2", 3 * time.Second},
+	}
+	s.AddAll(ops)
+
+	health.set(false)
+	clock.Advance(time.Minute)
+	next := s.Next()
+	c.Assert(next, gc.NotNil)
+	health.set(true)
+	receive(c, next)
+
+	// The operations that became overdue while the
+	// schedule was paused are spread across the window.
+	assertReady(c, s, clock, ops[0])
+	clock.Advance(10 * time.Second)
+	assertReady(c, s, clock, ops[1])
+	clock.Advance(10 * time.Second)
+	assertReady(c, s, clock, ops[2])
+}
+
+func (*scheduleSuite) TestWarmUpValidation(c *gc.C) {
+	_, err := schedule.New(schedule.Config[string, operation]{
+		Clock:  clocktesting.NewClock(time.Time{}),
+		WarmUp: -1,
+	})
+	c.Assert(err, gc.ErrorMatches, "validating schedule config: negative WarmUp not valid")
+}
@@ -0,0 +1,220 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/logging"
+	"github.com/juju/errors"
+)
+
+// StuckReason describes why a Watchdog considers an operation stuck.
+type StuckReason int
+
+const (
+	// StuckOverdue indicates that the operation is still scheduled,
+	// long after the time for which it was scheduled.
+	StuckOverdue StuckReason = iota
+
+	// StuckExecuting indicates that the operation has been
+	// executing for too long.
+	StuckExecuting
+)
+
+// String returns a string representation of the reason.
+func (r StuckReason) String() string {
+	switch r {
+	case StuckOverdue:
+		return "overdue"
+	case StuckExecuting:
+		return "executing"
+	}
+	return fmt.Sprintf("StuckReason(%d)", int(r))
+}
+
+// StuckOperation describes an operation that a Watchdog considers stuck.
+type StuckOperation[O any] struct {
+	// Op is the stuck operation.
+	Op O
+
+	// Reason describes why the operation is considered stuck.
+	Reason StuckReason
+
+	// Since is the time for which the operation was scheduled, if
+	// it is overdue, or the time at which it started executing.
+	Since time.Time
+
+	// Duration is the time that has elapsed since Since.
+	Duration time.Duration
+}
+
+// WatchdogConfig holds the configuration for a Watchdog.
+type WatchdogConfig[K comparable, O RunnableOperation[K]] struct {
+	// Clock is used to determine when to check the Runner.
+	Clock clock.Clock
+
+	// Runner is the Runner to watch.
+	Runner *Runner[K, O]
+
+	// Interval is the interval between checks.
+	Interval time.Duration
+
+	// MaxOverdue, if positive, is how long an operation may remain
+	// in the Runner's schedule after its scheduled time before it is
+	// considered stuck. This detects a stalled dispatch loop.
+	MaxOverdue time.Duration
+
+	// MaxExecuting, if positive, is how long an operation may
+	// execute before it is considered stuck.
+	MaxExecuting time.Duration
+
+	// OnStuck is called with each operation found to be stuck. It
+	// is called once for each operation each time that it becomes
+	// stuck, rather than at every check. OnStuck is called without
+	// any locks held.
+	OnStuck func(StuckOperation[O])
+
+	// Logger, if non-nil, is used to log stuck operations, as they
+	// are reported to OnStuck.
+	Logger logging.Logger
+}
+
+// Validate checks that the config is valid.
+func (config WatchdogConfig[K, O]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Runner == nil {
+		return errors.NotValidf("nil Runner")
+	}
+	if config.Interval <= 0 {
+		return errors.NotValidf("non-positive Interval")
+	}
+	if config.MaxOverdue < 0 {
+		return errors.NotValidf("negative MaxOverdue")
+	}
+	if config.MaxExecuting < 0 {
+		return errors.NotValidf("negative MaxExecuting")
+	}
+	if config.MaxOverdue == 0 && config.MaxExecuting == 0 {
+		return errors.NotValidf("missing MaxOverdue and MaxExecuting")
+	}
+	if config.OnStuck == nil {
+		return errors.NotValidf("nil OnStuck")
+	}
+	return nil
+}
+
+// Watchdog periodically checks a Runner for stuck operations: those that
+// have remained scheduled long past their scheduled time, and those that
+// have been executing for too long.
+type Watchdog[K comparable, O RunnableOperation[K]] struct {
+	config WatchdogConfig[K, O]
+	logger logging.Logger
+
+	// reported holds the identities of stuck operations that have
+	// been reported, and are still stuck. Only the loop goroutine
+	// accesses it.
+	reported map[interface{}]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWatchdog constructs and starts a new Watchdog with the given
+// configuration. The Watchdog will continue to run until it is killed.
+func NewWatchdog[K comparable, O RunnableOperation[K]](config WatchdogConfig[K, O]) (*Watchdog[K, O], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating watchdog config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watchdog[K, O]{
+		config:   config,
+		logger:   logging.OrNop(config.Logger),
+		reported: make(map[interface{}]bool),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Kill stops the Watchdog. Kill does not wait for the Watchdog
+// to stop; use Wait for that.
+func (w *Watchdog[K, O]) Kill() {
+	w.cancel()
+}
+
+// Wait waits for the Watchdog to stop.
+func (w *Watchdog[K, O]) Wait() error {
+	<-w.done
+	return nil
+}
+
+func (w *Watchdog[K, O]) loop() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-w.config.Clock.After(w.config.Interval):
+			w.check(w.config.Clock.Now())
+		}
+	}
+}
+
+// overdueID and executionID identify stuck operations, so that
+// each is reported only once while it remains stuck.
+type overdueID[K comparable] struct {
+	key       K
+	scheduled time.Time
+}
+
+type executionID uint64
+
+// check reports any newly stuck operations.
+func (w *Watchdog[K, O]) check(now time.Time) {
+	stuck := make(map[interface{}]StuckOperation[O])
+	r := w.config.Runner
+	r.mu.Lock()
+	if w.config.MaxOverdue > 0 {
+		for _, item := range r.schedule.q.Due(now.Add(-w.config.MaxOverdue)) {
+			stuck[overdueID[K]{item.Key, item.Time}] = StuckOperation[O]{
+				Op:       item.Value,
+				Reason:   StuckOverdue,
+				Since:    item.Time,
+				Duration: now.Sub(item.Time),
+			}
+		}
+	}
+	if w.config.MaxExecuting > 0 {
+		for id, e := range r.executions {
+			if d := now.Sub(e.started); d >= w.config.MaxExecuting {
+				stuck[executionID(id)] = StuckOperation[O]{
+					Op:       e.op,
+					Reason:   StuckExecuting,
+					Since:    e.started,
+					Duration: d,
+				}
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	reported := make(map[interface{}]bool, len(stuck))
+	for id, op := range stuck {
+		reported[id] = true
+		if !w.reported[id] {
+			w.logger.Warningf("operation %s stuck (%s) for %v", describeOperation(op.Op.Key(), op.Op), op.Reason, op.Duration)
+			w.config.OnStuck(op)
+		}
+	}
+	w.reported = reported
+}
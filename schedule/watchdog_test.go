@@ -0,0 +1,90 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type watchdogSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&watchdogSuite{})
+
+func (*watchdogSuite) TestValidate(c *gc.C) {
+	_, err := schedule.NewWatchdog(schedule.WatchdogConfig[string, *runnableOperation]{})
+	c.Assert(err, gc.ErrorMatches, "validating watchdog config: nil Clock not valid")
+}
+
+func (*watchdogSuite) TestStuckOperations(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	t0 := clock.Now()
+	s, err := schedule.New(schedule.Config[string, *runnableOperation]{
+		Clock:     clock,
+		RateLimit: schedule.RateLimit{Limit: 1, Window: time.Hour},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	r, err := schedule.NewRunner(schedule.RunnerConfig[string, *runnableOperation]{Schedule: s})
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Kill()
+
+	stuck := make(chan schedule.StuckOperation[*runnableOperation])
+	w, err := schedule.NewWatchdog(schedule.WatchdogConfig[string, *runnableOperation]{
+		Clock:        clock,
+		Runner:       r,
+		Interval:     time.Second,
+		MaxOverdue:   10 * time.Second,
+		MaxExecuting: 20 * time.Second,
+		OnStuck: func(op schedule.StuckOperation[*runnableOperation]) {
+			stuck <- op
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer w.Kill()
+
+	// k0 executes until released; k1 is held back by the rate limit.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	k0 := &runnableOperation{key: "k0", do: func(op *runnableOperation, ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}}
+	k1 := &runnableOperation{
+		key:                "k1",
+		ExponentialBackoff: schedule.ExponentialBackoff{Initial: time.Millisecond},
+		do: func(op *runnableOperation, ctx context.Context) error {
+			return nil
+		},
+	}
+	r.Add(k0)
+	r.Add(k1)
+	receive(c, started)
+
+	overdue := advanceUntil(c, clock, stuck, time.Second)
+	c.Assert(overdue.Op, gc.Equals, k1)
+	c.Assert(overdue.Reason, gc.Equals, schedule.StuckOverdue)
+	c.Assert(overdue.Since, gc.Equals, t0.Add(time.Millisecond))
+	c.Assert(overdue.Duration >= 10*time.Second, jc.IsTrue)
+
+	executing := advanceUntil(c, clock, stuck, time.Second)
+	c.Assert(executing.Op, gc.Equals, k0)
+	c.Assert(executing.Reason, gc.Equals, schedule.StuckExecuting)
+	c.Assert(executing.Since, gc.Equals, t0)
+	c.Assert(executing.Duration >= 20*time.Second, jc.IsTrue)
+
+	// Each stuck operation is reported only once.
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		assertNotReceived(c, stuck)
+	}
+}
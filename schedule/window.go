@@ -0,0 +1,72 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package schedule
+
+import "time"
+
+// Window is a recurring window of time, such as a maintenance window.
+type Window struct {
+	// Start determines the times at which the window opens.
+	Start Recurrence
+
+	// Duration is the length of time for which the window
+	// remains open, each time it opens.
+	Duration time.Duration
+}
+
+// Contains reports whether or not the specified time falls within
+// an occurrence of the window.
+func (w Window) Contains(t time.Time) bool {
+	return !w.Constrain(t).After(t)
+}
+
+// Constrain returns t if it falls within an occurrence of the window,
+// and otherwise returns the time at which the window next opens.
+func (w Window) Constrain(t time.Time) time.Time {
+	// The only occurrence of the window that could contain t is
+	// the first one to start after t-Duration.
+	start := w.Start.Next(t.Add(-w.Duration))
+	if start.After(t) {
+		return start
+	}
+	return t
+}
+
+// WindowedOperation may be implemented by an Operation to restrict the
+// times at which it may be made ready to a set of time windows. Adding
+// a windowed operation whose delay elapses outside of all of its windows
+// will schedule the operation at the start of the next window, and Ready
+// will defer windowed operations that it encounters outside of their
+// windows.
+type WindowedOperation interface {
+	// Windows returns the windows within which the operation
+	// may be made ready. If Windows returns no windows, then
+	// the operation is unconstrained.
+	Windows() []Window
+}
+
+// constrain returns the earliest time at or after t that is within one
+// of the operation's windows. If the operation does not implement
+// WindowedOperation, t is returned.
+func constrain(op interface{}, t time.Time) time.Time {
+	windowed, ok := op.(WindowedOperation)
+	if !ok {
+		return t
+	}
+	windows := windowed.Windows()
+	if len(windows) == 0 {
+		return t
+	}
+	var earliest time.Time
+	for i, w := range windows {
+		constrained := w.Constrain(t)
+		if !constrained.After(t) {
+			return t
+		}
+		if i == 0 || constrained.Before(earliest) {
+			earliest = constrained
+		}
+	}
+	return earliest
+}
@@ -0,0 +1,183 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package api exposes a Scheduler over HTTP, on a unix socket or a
+// loopback TCP address, so that tooling running alongside an agent,
+// such as a sidecar or an operator's shell, can inspect and manipulate
+// the agent's jobs at runtime; see the client subpackage.
+//
+// Since functions cannot be sent over the API, jobs are added with the
+// name of one of the functions registered with the Server, and with a
+// cron expression or an interval as their trigger.
+//
+// The API has the following endpoints, whose request and response
+// bodies are the JSON encodings of the types in this package:
+//
+//	GET    /jobs               lists the jobs, as []Job
+//	POST   /jobs               adds a job, from AddJobParams
+//	DELETE /jobs/{name}        removes a job
+//	POST   /jobs/{name}/pause  pauses a job
+//	POST   /jobs/{name}/resume resumes a job
+//	GET    /state              dumps the scheduler's state, as State
+//
+// Requests must be for a loopback host, such as "localhost", and must
+// not have an Origin header; requests other than GET requests must have
+// the Content-Type "application/json". These restrictions prevent web
+// pages from using the API. Failed requests respond with an Error.
+package api
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/axw/juju-time/scheduler"
+	"github.com/juju/errors"
+)
+
+// Job describes a job, as scheduler.JobInfo does.
+type Job struct {
+	Name         string        `json:"name"`
+	Next         time.Time     `json:"next"`
+	Fired        time.Time     `json:"fired"`
+	Paused       bool          `json:"paused"`
+	Running      bool          `json:"running"`
+	Runs         int           `json:"runs"`
+	Failures     int           `json:"failures"`
+	LastRun      time.Time     `json:"last-run"`
+	LastDuration time.Duration `json:"last-duration"`
+	LastError    string        `json:"last-error,omitempty"`
+}
+
+// newJob returns the Job describing the job info.
+func newJob(info scheduler.JobInfo) Job {
+	j := Job{
+		Name:         info.Name,
+		Next:         info.Next,
+		Fired:        info.Fired,
+		Paused:       info.Paused,
+		Running:      info.Running,
+		Runs:         info.Runs,
+		Failures:     info.Failures,
+		LastRun:      info.LastRun,
+		LastDuration: info.LastDuration,
+	}
+	if info.LastError != nil {
+		j.LastError = info.LastError.Error()
+	}
+	return j
+}
+
+// AddJobParams holds the parameters for adding a job.
+type AddJobParams struct {
+	// Name is the name of the job.
+	Name string `json:"name"`
+
+	// Func is the name of the registered function that the job runs;
+	// see ServerConfig.Funcs.
+	Func string `json:"func"`
+
+	// Cron, if non-empty, is the cron expression giving the times at
+	// which the job runs; see cron.Parse. Otherwise, the job runs
+	// with the delay Every between runs. Exactly one of Cron and
+	// Every must be specified.
+	Cron  string        `json:"cron,omitempty"`
+	Every time.Duration `json:"every,omitempty"`
+
+	// Misfire is the job's misfire policy: "skip", which is the
+	// default, "fire-once" or "fire-all"; see scheduler.MisfirePolicy.
+	Misfire string `json:"misfire,omitempty"`
+
+	// Since, if non-zero, is as for scheduler.JobOptions.Since.
+	Since time.Time `json:"since,omitempty"`
+}
+
+// State is a dump of the scheduler's state.
+type State struct {
+	// Jobs describes the jobs, ordered by name.
+	Jobs []Job `json:"jobs"`
+
+	// Funcs holds the names of the registered functions,
+	// in order.
+	Funcs []string `json:"funcs"`
+}
+
+// Error is the body of the response to a failed request.
+type Error struct {
+	// Message describes the error.
+	Message string `json:"error"`
+
+	// Code, if non-empty, classifies the error: one of the
+	// Code constants.
+	Code string `json:"code,omitempty"`
+}
+
+// The following codes classify the errors returned by the API, so
+// that the client can return errors satisfying the corresponding
+// errors.Is* functions.
+const (
+	CodeNotFound      = "not found"
+	CodeAlreadyExists = "already exists"
+	CodeNotValid      = "not valid"
+	CodeForbidden     = "forbidden"
+	CodeNotSupported  = "not supported"
+)
+
+// misfirePolicies maps the names of misfire policies to the policies.
+var misfirePolicies = map[string]scheduler.MisfirePolicy{
+	"":          scheduler.MisfireSkip,
+	"skip":      scheduler.MisfireSkip,
+	"fire-once": scheduler.MisfireFireOnce,
+	"fire-all":  scheduler.MisfireFireAll,
+}
+
+// ParseAddress returns the network and address with which to listen on,
+// or dial, the specified API address: the path of a unix socket, which
+// may be prefixed by "unix:", or a loopback TCP host and port, such as
+// "localhost:8080" or "127.0.0.1:8080". ParseAddress returns an error
+// satisfying errors.IsNotValid if the address is a TCP address whose
+// host is not a loopback address, since the API is unauthenticated.
+func ParseAddress(address string) (network, addr string, err error) {
+	if path := strings.TrimPrefix(address, "unix:"); path != address || strings.Contains(address, "/") {
+		if path == "" {
+			return "", "", errors.NotValidf("empty socket path")
+		}
+		return "unix", path, nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", errors.NotValidf("address %q", address)
+	}
+	if !isLoopbackHost(host) {
+		return "", "", errors.NotValidf("non-loopback address %q", address)
+	}
+	return "tcp", address, nil
+}
+
+// isLoopbackHost reports whether the host, which may have a port, is
+// "localhost" or a loopback IP address.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Listen listens on the specified API address; see ParseAddress.
+func Listen(address string) (net.Listener, error) {
+	network, addr, err := ParseAddress(address)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, errors.Annotate(err, "listening")
+	}
+	return l, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package api_test
+
+import (
+	"path/filepath"
+
+	"github.com/axw/juju-time/scheduler/api"
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type apiSuite struct{}
+
+var _ = gc.Suite(&apiSuite{})
+
+func (*apiSuite) TestParseAddress(c *gc.C) {
+	for _, test := range []struct {
+		address, network, addr string
+	}{
+		{"/run/agent/scheduler.sock", "unix", "/run/agent/scheduler.sock"},
+		{"unix:scheduler.sock", "unix", "scheduler.sock"},
+		{"localhost:8080", "tcp", "localhost:8080"},
+		{"127.0.0.1:0", "tcp", "127.0.0.1:0"},
+		{"[::1]:8080", "tcp", "[::1]:8080"},
+	} {
+		network, addr, err := api.ParseAddress(test.address)
+		c.Assert(err, jc.ErrorIsNil, gc.Commentf("%s", test.address))
+		c.Check(network, gc.Equals, test.network)
+		c.Check(addr, gc.Equals, test.addr)
+	}
+}
+
+func (*apiSuite) TestParseAddressInvalid(c *gc.C) {
+	for address, expect := range map[string]string{
+		"unix:":          "empty socket path not valid",
+		"example.com:80": `non-loopback address "example.com:80" not valid`,
+		"0.0.0.0:80":     `non-loopback address "0.0.0.0:80" not valid`,
+		"localhost":      `address "localhost" not valid`,
+	} {
+		_, _, err := api.ParseAddress(address)
+		c.Check(err, gc.ErrorMatches, expect)
+		c.Check(errors.IsNotValid(err), jc.IsTrue)
+	}
+}
+
+func (*apiSuite) TestListen(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "scheduler.sock")
+	l, err := api.Listen(path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer l.Close()
+	c.Assert(l.Addr().Network(), gc.Equals, "unix")
+	c.Assert(l.Addr().String(), gc.Equals, path)
+
+	_, err = api.Listen("example.com:80")
+	c.Assert(err, gc.ErrorMatches, `non-loopback address "example.com:80" not valid`)
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package client provides a client for the scheduler API served by
+// api.Server, with which tooling running alongside an agent may
+// inspect and manipulate the agent's jobs.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/axw/juju-time/scheduler/api"
+	"github.com/juju/errors"
+)
+
+// Client makes requests to the scheduler API.
+//
+// Client's methods are safe for concurrent use.
+type Client struct {
+	http *http.Client
+}
+
+// New returns a new Client for the API served at the specified address:
+// the path of a unix socket, or a loopback TCP host and port; see
+// api.ParseAddress. New does not connect to the server; each request
+// dials it as required.
+func New(address string) (*Client, error) {
+	network, addr, err := api.ParseAddress(address)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var dialer net.Dialer
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport}}, nil
+}
+
+// Close closes the Client's idle connections.
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// ListJobs returns descriptions of the jobs, ordered by name.
+func (c *Client) ListJobs(ctx context.Context) ([]api.Job, error) {
+	var jobs []api.Job
+	if err := c.call(ctx, "GET", "/jobs", nil, &jobs); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return jobs, nil
+}
+
+// AddJob adds a job. AddJob returns an error satisfying
+// errors.IsAlreadyExists if a job with the name already exists,
+// errors.IsNotFound if the function is not registered with the server,
+// or errors.IsNotValid if the parameters are not valid.
+func (c *Client) AddJob(ctx context.Context, params api.AddJobParams) error {
+	return errors.Trace(c.call(ctx, "POST", "/jobs", params, nil))
+}
+
+// RemoveJob removes the job with the specified name. RemoveJob returns
+// an error satisfying errors.IsNotFound if no job with the name exists.
+func (c *Client) RemoveJob(ctx context.Context, name string) error {
+	return errors.Trace(c.call(ctx, "DELETE", jobPath(name, ""), nil, nil))
+}
+
+// PauseJob pauses the job with the specified name. PauseJob returns an
+// error satisfying errors.IsNotFound if no job with the name exists.
+func (c *Client) PauseJob(ctx context.Context, name string) error {
+	return errors.Trace(c.call(ctx, "POST", jobPath(name, "/pause"), nil, nil))
+}
+
+// ResumeJob resumes the job with the specified name. ResumeJob returns
+// an error satisfying errors.IsNotFound if no job with the name exists.
+func (c *Client) ResumeJob(ctx context.Context, name string) error {
+	return errors.Trace(c.call(ctx, "POST", jobPath(name, "/resume"), nil, nil))
+}
+
+// State returns a dump of the scheduler's state.
+func (c *Client) State(ctx context.Context) (api.State, error) {
+	var state api.State
+	if err := c.call(ctx, "GET", "/state", nil, &state); err != nil {
+		return api.State{}, errors.Trace(err)
+	}
+	return state, nil
+}
+
+func jobPath(name, action string) string {
+	return "/jobs/" + url.PathEscape(name) + action
+}
+
+// call makes a request with the JSON encoding of params, if non-nil,
+// as its body, and decodes the response's body into result, if
+// non-nil.
+func (c *Client) call(ctx context.Context, method, path string, params, result interface{}) error {
+	var body io.Reader
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return errors.Annotate(err, "encoding request")
+		}
+		body = bytes.NewReader(data)
+	}
+	// The host is ignored by the transport, which always dials
+	// the server's address, but the server requires a loopback
+	// host, and a JSON Content-Type for mutating requests.
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.Annotate(err, "making request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Annotate(err, "decoding response")
+	}
+	return nil
+}
+
+// responseError returns the error described by the response to a
+// failed request, satisfying the errors.Is* function corresponding
+// to its code.
+func responseError(resp *http.Response) error {
+	var body api.Error
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Message == "" {
+		return errors.Errorf("request failed: %s", resp.Status)
+	}
+	switch body.Code {
+	case api.CodeNotFound:
+		return errors.NewNotFound(nil, body.Message)
+	case api.CodeAlreadyExists:
+		return errors.NewAlreadyExists(nil, body.Message)
+	case api.CodeNotValid:
+		return errors.NewNotValid(nil, body.Message)
+	case api.CodeForbidden:
+		return errors.NewForbidden(nil, body.Message)
+	case api.CodeNotSupported:
+		return errors.NewNotSupported(nil, body.Message)
+	}
+	return errors.Errorf("request failed: %s", body.Message)
+}
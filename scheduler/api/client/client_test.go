@@ -0,0 +1,136 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package client_test
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/axw/juju-time/scheduler"
+	"github.com/axw/juju-time/scheduler/api"
+	"github.com/axw/juju-time/scheduler/api/client"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type clientSuite struct {
+	coretesting.BaseSuite
+	clock     *coretesting.Clock
+	scheduler *scheduler.Scheduler
+	server    *api.Server
+}
+
+var _ = gc.Suite(&clientSuite{})
+
+func (s *clientSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	var err error
+	s.scheduler, err = scheduler.New(scheduler.Config{Clock: s.clock})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *clientSuite) TearDownTest(c *gc.C) {
+	if s.server != nil {
+		s.server.Kill()
+		c.Check(s.server.Wait(), jc.ErrorIsNil)
+		s.server = nil
+	}
+	s.BaseSuite.TearDownTest(c)
+}
+
+func (s *clientSuite) newClient(c *gc.C, address string) *client.Client {
+	l, err := api.Listen(address)
+	c.Assert(err, jc.ErrorIsNil)
+	s.server, err = api.NewServer(api.ServerConfig{
+		Scheduler: s.scheduler,
+		Funcs: map[string]scheduler.Func{
+			"noop": func(context.Context) error { return nil },
+		},
+		Listener: l,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	if l.Addr().Network() == "tcp" {
+		address = l.Addr().String()
+	}
+	cl, err := client.New(address)
+	c.Assert(err, jc.ErrorIsNil)
+	return cl
+}
+
+func (s *clientSuite) TestUnixSocket(c *gc.C) {
+	cl := s.newClient(c, filepath.Join(c.MkDir(), "scheduler.sock"))
+	defer cl.Close()
+	s.testJobs(c, cl)
+}
+
+func (s *clientSuite) TestLoopback(c *gc.C) {
+	cl := s.newClient(c, "127.0.0.1:0")
+	defer cl.Close()
+	s.testJobs(c, cl)
+}
+
+func (s *clientSuite) testJobs(c *gc.C, cl *client.Client) {
+	ctx := context.Background()
+	err := cl.AddJob(ctx, api.AddJobParams{Name: "a", Func: "noop", Every: time.Minute})
+	c.Assert(err, jc.ErrorIsNil)
+	err = cl.AddJob(ctx, api.AddJobParams{Name: "b", Func: "noop", Cron: "0 * * * *"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cl.PauseJob(ctx, "b"), jc.ErrorIsNil)
+
+	jobs, err := cl.ListJobs(ctx)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(jobs, gc.HasLen, 2)
+	c.Assert(jobs[0].Name, gc.Equals, "a")
+	c.Assert(jobs[0].Paused, jc.IsFalse)
+	c.Assert(jobs[1].Name, gc.Equals, "b")
+	c.Assert(jobs[1].Paused, jc.IsTrue)
+
+	c.Assert(cl.ResumeJob(ctx, "b"), jc.ErrorIsNil)
+	c.Assert(cl.RemoveJob(ctx, "a"), jc.ErrorIsNil)
+	state, err := cl.State(ctx)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(state.Funcs, jc.DeepEquals, []string{"noop"})
+	c.Assert(state.Jobs, gc.HasLen, 1)
+	c.Assert(state.Jobs[0].Name, gc.Equals, "b")
+	c.Assert(state.Jobs[0].Paused, jc.IsFalse)
+}
+
+func (s *clientSuite) TestErrors(c *gc.C) {
+	cl := s.newClient(c, filepath.Join(c.MkDir(), "scheduler.sock"))
+	defer cl.Close()
+	ctx := context.Background()
+
+	err := cl.RemoveJob(ctx, "a")
+	c.Assert(err, gc.ErrorMatches, `job "a" not found`)
+	c.Assert(errors.IsNotFound(err), jc.IsTrue)
+
+	err = cl.AddJob(ctx, api.AddJobParams{Name: "a", Func: "missing", Every: time.Minute})
+	c.Assert(err, gc.ErrorMatches, `func "missing" not found`)
+	c.Assert(errors.IsNotFound(err), jc.IsTrue)
+
+	err = cl.AddJob(ctx, api.AddJobParams{Name: "a", Func: "noop"})
+	c.Assert(err, gc.ErrorMatches, "job without positive interval or cron expression not valid")
+	c.Assert(errors.IsNotValid(err), jc.IsTrue)
+
+	err = cl.AddJob(ctx, api.AddJobParams{Name: "a", Func: "noop", Every: time.Minute})
+	c.Assert(err, jc.ErrorIsNil)
+	err = cl.AddJob(ctx, api.AddJobParams{Name: "a", Func: "noop", Every: time.Minute})
+	c.Assert(err, gc.ErrorMatches, `job "a" already exists`)
+	c.Assert(errors.IsAlreadyExists(err), jc.IsTrue)
+}
+
+func (s *clientSuite) TestNew(c *gc.C) {
+	_, err := client.New("example.com:80")
+	c.Assert(err, gc.ErrorMatches, `non-loopback address "example.com:80" not valid`)
+
+	// Requests fail if there is no server.
+	cl, err := client.New(filepath.Join(c.MkDir(), "scheduler.sock"))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = cl.ListJobs(context.Background())
+	c.Assert(err, gc.ErrorMatches, "making request: .*")
+}
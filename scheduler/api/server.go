@@ -0,0 +1,295 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package api
+
+import (
+	"encoding/json"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/axw/juju-time/cron"
+	"github.com/axw/juju-time/logging"
+	"github.com/axw/juju-time/scheduler"
+	"github.com/juju/errors"
+)
+
+// ServerConfig holds the configuration for a Server.
+type ServerConfig struct {
+	// Scheduler is the scheduler exposed by the server.
+	Scheduler *scheduler.Scheduler
+
+	// Funcs holds the functions that jobs added through the API may
+	// run, by name. Jobs added in-process need not use them.
+	Funcs map[string]scheduler.Func
+
+	// Listener is the listener on which the server accepts requests.
+	// It should listen on a unix socket, or a loopback TCP address,
+	// as those returned by Listen do, since the API does not
+	// authenticate its clients. The server closes the listener when
+	// it is killed.
+	Listener net.Listener
+
+	// Logger, if non-nil, is used to log failed requests.
+	Logger logging.Logger
+}
+
+// Validate checks that the config is valid.
+func (config ServerConfig) Validate() error {
+	if config.Scheduler == nil {
+		return errors.NotValidf("nil Scheduler")
+	}
+	for name, f := range config.Funcs {
+		if f == nil {
+			return errors.NotValidf("nil func %q", name)
+		}
+	}
+	if config.Listener == nil {
+		return errors.NotValidf("nil Listener")
+	}
+	return nil
+}
+
+// Server serves the API for a Scheduler; see the package documentation.
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+	done     chan struct{}
+	err      error
+}
+
+// NewServer constructs and starts a new Server with the given
+// configuration. The Server will continue to serve requests until it
+// is killed.
+func NewServer(config ServerConfig) (*Server, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating server config")
+	}
+	s := &Server{
+		listener: config.Listener,
+		server:   &http.Server{Handler: newHandler(config)},
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		if err := s.server.Serve(s.listener); err != http.ErrServerClosed {
+			s.err = errors.Annotate(err, "serving API")
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the address on which the Server accepts requests.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Kill stops the Server, closing its listener and connections. Kill
+// does not wait for the Server to stop; use Wait for that.
+func (s *Server) Kill() {
+	s.server.Close()
+}
+
+// Wait waits for the Server to stop, and returns the error with which
+// it stopped serving, if it was not killed.
+func (s *Server) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// NewHandler returns an http.Handler that serves the API for the
+// scheduler, with the specified functions registered, so that the API
+// may be served by an existing HTTP server; see ServerConfig. The
+// handler serves the API's endpoints at the root of its path.
+func NewHandler(s *scheduler.Scheduler, funcs map[string]scheduler.Func) http.Handler {
+	return newHandler(ServerConfig{Scheduler: s, Funcs: funcs})
+}
+
+type handler struct {
+	scheduler *scheduler.Scheduler
+	funcs     map[string]scheduler.Func
+	logger    logging.Logger
+}
+
+func newHandler(config ServerConfig) http.Handler {
+	h := &handler{
+		scheduler: config.Scheduler,
+		funcs:     config.Funcs,
+		logger:    logging.OrNop(config.Logger),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs", h.serve(h.listJobs))
+	mux.HandleFunc("POST /jobs", h.serve(h.addJob))
+	mux.HandleFunc("DELETE /jobs/{name}", h.serve(h.removeJob))
+	mux.HandleFunc("POST /jobs/{name}/pause", h.serve(h.pauseJob))
+	mux.HandleFunc("POST /jobs/{name}/resume", h.serve(h.resumeJob))
+	mux.HandleFunc("GET /state", h.serve(h.state))
+	return h.guard(mux)
+}
+
+// guard returns an http.Handler that passes requests on to next, unless
+// they may have been made by a web page rather than a client of the API.
+// Since the API is unauthenticated, and a page in an operator's browser
+// can make requests to loopback addresses, guard rejects requests with
+// an Origin header, which browsers send with cross-origin requests, and
+// requests for a host that is not a loopback host, as a page whose
+// domain is rebound to a loopback address would make. Mutating requests
+// must also have a JSON Content-Type, which a page cannot send without
+// a CORS preflight request, to which the API does not respond.
+func (h *handler) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := checkRequest(req); err != nil {
+			h.fail(w, req, err)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// checkRequest returns an error satisfying errors.IsForbidden or
+// errors.IsNotSupported if the request is rejected by guard.
+func checkRequest(req *http.Request) error {
+	if origin := req.Header.Get("Origin"); origin != "" {
+		return errors.Forbiddenf("forbidden request with Origin %q", origin)
+	}
+	if !isLoopbackHost(req.Host) {
+		return errors.Forbiddenf("forbidden request for non-loopback host %q", req.Host)
+	}
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return nil
+	}
+	contentType := req.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+		return errors.NotSupportedf("Content-Type %q", contentType)
+	}
+	return nil
+}
+
+// serve returns an http.HandlerFunc that calls f, and writes the value
+// that it returns, if non-nil, or the error, as JSON.
+func (h *handler) serve(f func(req *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		result, err := f(req)
+		if err != nil {
+			h.fail(w, req, err)
+			return
+		}
+		if result == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// fail logs the error with which the request failed, and writes it as
+// JSON.
+func (h *handler) fail(w http.ResponseWriter, req *http.Request, err error) {
+	h.logger.Warningf("%s %s: %v", req.Method, req.URL.Path, err)
+	status, body := errorResponse(err)
+	writeJSON(w, status, body)
+}
+
+// errorResponse returns the status and body of the response for the
+// error.
+func errorResponse(err error) (int, Error) {
+	body := Error{Message: err.Error()}
+	switch {
+	case errors.IsNotFound(err):
+		body.Code = CodeNotFound
+		return http.StatusNotFound, body
+	case errors.IsAlreadyExists(err):
+		body.Code = CodeAlreadyExists
+		return http.StatusConflict, body
+	case errors.IsNotValid(err):
+		body.Code = CodeNotValid
+		return http.StatusBadRequest, body
+	case errors.IsForbidden(err):
+		body.Code = CodeForbidden
+		return http.StatusForbidden, body
+	case errors.IsNotSupported(err):
+		body.Code = CodeNotSupported
+		return http.StatusUnsupportedMediaType, body
+	}
+	return http.StatusInternalServerError, body
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *handler) listJobs(*http.Request) (interface{}, error) {
+	return h.jobs(), nil
+}
+
+func (h *handler) jobs() []Job {
+	infos := h.scheduler.ListJobs()
+	jobs := make([]Job, len(infos))
+	for i, info := range infos {
+		jobs[i] = newJob(info)
+	}
+	return jobs
+}
+
+func (h *handler) addJob(req *http.Request) (interface{}, error) {
+	var params AddJobParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		return nil, errors.NewNotValid(err, "decoding request")
+	}
+	if params.Name == "" {
+		return nil, errors.NotValidf("empty job name")
+	}
+	f, ok := h.funcs[params.Func]
+	if !ok {
+		return nil, errors.NotFoundf("func %q", params.Func)
+	}
+	var trigger scheduler.Trigger
+	switch {
+	case params.Cron != "" && params.Every != 0:
+		return nil, errors.NotValidf("job with both cron expression and interval")
+	case params.Cron != "":
+		expr, err := cron.Parse(params.Cron)
+		if err != nil {
+			return nil, errors.NewNotValid(err, "parsing cron expression")
+		}
+		trigger = expr
+	case params.Every > 0:
+		trigger = scheduler.Every(params.Every)
+	default:
+		return nil, errors.NotValidf("job without positive interval or cron expression")
+	}
+	misfire, ok := misfirePolicies[params.Misfire]
+	if !ok {
+		return nil, errors.NotValidf("misfire policy %q", params.Misfire)
+	}
+	err := h.scheduler.AddJobWithOptions(params.Name, trigger, f, scheduler.JobOptions{
+		Misfire: misfire,
+		Since:   params.Since,
+	})
+	return nil, errors.Trace(err)
+}
+
+func (h *handler) removeJob(req *http.Request) (interface{}, error) {
+	return nil, errors.Trace(h.scheduler.RemoveJob(req.PathValue("name")))
+}
+
+func (h *handler) pauseJob(req *http.Request) (interface{}, error) {
+	return nil, errors.Trace(h.scheduler.PauseJob(req.PathValue("name")))
+}
+
+func (h *handler) resumeJob(req *http.Request) (interface{}, error) {
+	return nil, errors.Trace(h.scheduler.ResumeJob(req.PathValue("name")))
+}
+
+func (h *handler) state(*http.Request) (interface{}, error) {
+	funcs := make([]string, 0, len(h.funcs))
+	for name := range h.funcs {
+		funcs = append(funcs, name)
+	}
+	sort.Strings(funcs)
+	return State{Jobs: h.jobs(), Funcs: funcs}, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/axw/juju-time/scheduler"
+	"github.com/axw/juju-time/scheduler/api"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type serverSuite struct {
+	coretesting.BaseSuite
+	clock     *coretesting.Clock
+	scheduler *scheduler.Scheduler
+	handler   http.Handler
+}
+
+var _ = gc.Suite(&serverSuite{})
+
+func (s *serverSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	var err error
+	s.scheduler, err = scheduler.New(scheduler.Config{Clock: s.clock})
+	c.Assert(err, jc.ErrorIsNil)
+	s.handler = api.NewHandler(s.scheduler, map[string]scheduler.Func{
+		"noop": func(context.Context) error { return nil },
+	})
+}
+
+func (s *serverSuite) request(c *gc.C, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Host = "localhost"
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *serverSuite) assertError(c *gc.C, rec *httptest.ResponseRecorder, status int, expect api.Error) {
+	c.Assert(rec.Code, gc.Equals, status)
+	var body api.Error
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), jc.ErrorIsNil)
+	c.Assert(body, jc.DeepEquals, expect)
+}
+
+func (s *serverSuite) TestValidate(c *gc.C) {
+	_, err := api.NewServer(api.ServerConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating server config: nil Scheduler not valid")
+	_, err = api.NewServer(api.ServerConfig{
+		Scheduler: s.scheduler,
+		Funcs:     map[string]scheduler.Func{"f": nil},
+	})
+	c.Assert(err, gc.ErrorMatches, `validating server config: nil func "f" not valid`)
+	_, err = api.NewServer(api.ServerConfig{Scheduler: s.scheduler})
+	c.Assert(err, gc.ErrorMatches, "validating server config: nil Listener not valid")
+}
+
+func (s *serverSuite) TestAddJob(c *gc.C) {
+	rec := s.request(c, "POST", "/jobs", `{"name": "a", "func": "noop", "every": 60000000000}`)
+	c.Assert(rec.Code, gc.Equals, http.StatusNoContent)
+	rec = s.request(c, "POST", "/jobs", `{"name": "b", "func": "noop", "cron": "0 * * * *", "misfire": "fire-once"}`)
+	c.Assert(rec.Code, gc.Equals, http.StatusNoContent)
+
+	jobs := s.scheduler.ListJobs()
+	c.Assert(jobs, gc.HasLen, 2)
+	c.Assert(jobs[0].Name, gc.Equals, "a")
+	c.Assert(jobs[1].Name, gc.Equals, "b")
+
+	rec = s.request(c, "POST", "/jobs", `{"name": "a", "func": "noop", "every": 1}`)
+	s.assertError(c, rec, http.StatusConflict, api.Error{Message: `job "a" already exists`, Code: api.CodeAlreadyExists})
+}
+
+func (s *serverSuite) TestAddJobInvalid(c *gc.C) {
+	for body, expect := range map[string]string{
+		`{`:                             "decoding request: unexpected EOF",
+		`{"func": "noop", "every": 1}`:  "empty job name not valid",
+		`{"name": "a", "func": "noop"}`: "job without positive interval or cron expression not valid",
+		`{"name": "a", "func": "noop", "every": 1, "cron": "* * * * *"}`: "job with both cron expression and interval not valid",
+		`{"name": "a", "func": "noop", "cron": "bad"}`:                   "parsing cron expression: .*",
+		`{"name": "a", "func": "noop", "every": 1, "misfire": "never"}`:  `misfire policy "never" not valid`,
+	} {
+		rec := s.request(c, "POST", "/jobs", body)
+		c.Assert(rec.Code, gc.Equals, http.StatusBadRequest, gc.Commentf("%s", body))
+		var e api.Error
+		c.Assert(json.Unmarshal(rec.Body.Bytes(), &e), jc.ErrorIsNil)
+		c.Check(e.Message, gc.Matches, expect)
+		c.Check(e.Code, gc.Equals, api.CodeNotValid)
+	}
+
+	rec := s.request(c, "POST", "/jobs", `{"name": "a", "func": "missing", "every": 1}`)
+	s.assertError(c, rec, http.StatusNotFound, api.Error{Message: `func "missing" not found`, Code: api.CodeNotFound})
+	c.Assert(s.scheduler.ListJobs(), gc.HasLen, 0)
+}
+
+func (s *serverSuite) TestForbidden(c *gc.C) {
+	for _, test := range []struct {
+		method, path, host, origin string
+		expect                     string
+	}{
+		{"GET", "/jobs", "evil.example.com", "", `forbidden request for non-loopback host "evil.example.com"`},
+		{"GET", "/jobs", "evil.example.com:8080", "", `forbidden request for non-loopback host "evil.example.com:8080"`},
+		{"POST", "/jobs", "localhost:8080", "http://evil.example.com", `forbidden request with Origin "http://evil.example.com"`},
+		{"DELETE", "/jobs/a", "127.0.0.1:8080", "null", `forbidden request with Origin "null"`},
+	} {
+		c.Logf("%s %s, host %q, origin %q", test.method, test.path, test.host, test.origin)
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(`{"name": "a", "func": "noop", "every": 1}`))
+		req.Host = test.host
+		req.Header.Set("Content-Type", "application/json")
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		s.assertError(c, rec, http.StatusForbidden, api.Error{Message: test.expect, Code: api.CodeForbidden})
+	}
+	c.Assert(s.scheduler.ListJobs(), gc.HasLen, 0)
+
+	for _, host := range []string{"localhost", "LOCALHOST:8080", "127.0.0.1", "[::1]:8080", "[::1]"} {
+		req := httptest.NewRequest("GET", "/jobs", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		c.Check(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("%s", host))
+	}
+}
+
+func (s *serverSuite) TestContentType(c *gc.C) {
+	err := s.scheduler.AddJob("a", scheduler.Every(time.Minute), func(context.Context) error { return nil })
+	c.Assert(err, jc.ErrorIsNil)
+
+	// A web page can make a POST request with a text/plain body
+	// without a CORS preflight request, so mutating requests must
+	// have a JSON Content-Type.
+	for _, test := range []struct {
+		method, path, contentType string
+	}{
+		{"POST", "/jobs", "text/plain"},
+		{"POST", "/jobs", ""},
+		{"POST", "/jobs/a/pause", "application/x-www-form-urlencoded"},
+		{"DELETE", "/jobs/a", ""},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(`{"name": "b", "func": "noop", "every": 1}`))
+		req.Host = "localhost"
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		s.assertError(c, rec, http.StatusUnsupportedMediaType, api.Error{
+			Message: `Content-Type "` + test.contentType + `" not supported`,
+			Code:    api.CodeNotSupported,
+		})
+	}
+	jobs := s.scheduler.ListJobs()
+	c.Assert(jobs, gc.HasLen, 1)
+	c.Assert(jobs[0].Paused, jc.IsFalse)
+
+	req := httptest.NewRequest("POST", "/jobs/a/pause", nil)
+	req.Host = "localhost"
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	c.Assert(rec.Code, gc.Equals, http.StatusNoContent)
+}
+
+func (s *serverSuite) TestManageJob(c *gc.C) {
+	err := s.scheduler.AddJob("a/b", scheduler.Every(time.Minute), func(context.Context) error { return nil })
+	c.Assert(err, jc.ErrorIsNil)
+
+	rec := s.request(c, "POST", "/jobs/a%2Fb/pause", "")
+	c.Assert(rec.Code, gc.Equals, http.StatusNoContent)
+	c.Assert(s.scheduler.ListJobs()[0].Paused, jc.IsTrue)
+	rec = s.request(c, "POST", "/jobs/a%2Fb/resume", "")
+	c.Assert(rec.Code, gc.Equals, http.StatusNoContent)
+	c.Assert(s.scheduler.ListJobs()[0].Paused, jc.IsFalse)
+	rec = s.request(c, "DELETE", "/jobs/a%2Fb", "")
+	c.Assert(rec.Code, gc.Equals, http.StatusNoContent)
+	c.Assert(s.scheduler.ListJobs(), gc.HasLen, 0)
+
+	rec = s.request(c, "DELETE", "/jobs/a%2Fb", "")
+	s.assertError(c, rec, http.StatusNotFound, api.Error{Message: `job "a/b" not found`, Code: api.CodeNotFound})
+}
+
+func (s *serverSuite) TestListJobs(c *gc.C) {
+	err := s.scheduler.AddJob("a", scheduler.Every(time.Minute), func(context.Context) error { return nil })
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.scheduler.PauseJob("a"), jc.ErrorIsNil)
+
+	rec := s.request(c, "GET", "/jobs", "")
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	var jobs []api.Job
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &jobs), jc.ErrorIsNil)
+	c.Assert(jobs, jc.DeepEquals, []api.Job{{
+		Name:   "a",
+		Fired:  s.clock.Now(),
+		Paused: true,
+	}})
+
+	rec = s.request(c, "GET", "/state", "")
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	var state api.State
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &state), jc.ErrorIsNil)
+	c.Assert(state, jc.DeepEquals, api.State{Jobs: jobs, Funcs: []string{"noop"}})
+}
@@ -0,0 +1,538 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package scheduler provides an embeddable job scheduler, which runs
+// named jobs at the times given by their triggers, such as cron
+// expressions or recurrence sets, and records metrics about their runs.
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/timing"
+	"github.com/juju/errors"
+)
+
+// Trigger determines the times at which a job runs. *cron.Expression,
+// *recurrence.Set and schedule.Recurrence values are all Triggers.
+type Trigger interface {
+	// Next returns the first time strictly after the specified time
+	// at which the job should run, or the zero time if there is none.
+	Next(after time.Time) time.Time
+}
+
+// Every returns a Trigger that fires at the specified interval after
+// the time it is asked about. Since a job's next run time is computed
+// when its previous run completes, a job triggered by Every runs with a
+// fixed delay between runs.
+func Every(interval time.Duration) Trigger {
+	return every(interval)
+}
+
+type every time.Duration
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+// Func is the function run by a job. The context passed to it is
+// cancelled when the Scheduler is stopped, and holds the trigger time
+// for which the job is run; see ScheduledTime.
+type Func func(ctx context.Context) error
+
+// MisfirePolicy determines how a job is run when its trigger times
+// pass while it cannot run: while the Scheduler is stopped, the job is
+// paused, or, for a job restored with JobOptions.Since, before it was
+// added.
+type MisfirePolicy int
+
+const (
+	// MisfireSkip skips missed times: the job next runs at the
+	// first trigger time after it is started or resumed.
+	MisfireSkip MisfirePolicy = iota
+
+	// MisfireFireOnce runs the job once, immediately, if any times
+	// were missed, and then at the first trigger time after that.
+	MisfireFireOnce
+
+	// MisfireFireAll runs the job for each missed time in turn,
+	// immediately and one after another, until it has caught up.
+	// Times that pass while such a job is running are also run,
+	// once the run completes, rather than skipped.
+	MisfireFireAll
+)
+
+// JobOptions holds the optional settings of a job.
+type JobOptions struct {
+	// Misfire determines how the job is run when
+	// trigger times are missed.
+	Misfire MisfirePolicy
+
+	// Since, if non-zero, is the time from which missed trigger
+	// times are counted when the job is first scheduled. Pass the
+	// Fired time recorded in the job's JobInfo, when restoring a
+	// persisted job, to handle the times missed while the process
+	// was down according to the misfire policy. If Since is zero,
+	// the time at which the job is added is used.
+	Since time.Time
+}
+
+// Validate checks that the options are valid.
+func (opts JobOptions) Validate() error {
+	switch opts.Misfire {
+	case MisfireSkip, MisfireFireOnce, MisfireFireAll:
+	default:
+		return errors.NotValidf("misfire policy %d", opts.Misfire)
+	}
+	return nil
+}
+
+type scheduledTimeKey struct{}
+
+// ScheduledTime returns the trigger time for which a job is run, from
+// the context passed to its Func, and a boolean indicating whether or
+// not the context holds one. For a run of a job with MisfireFireOnce
+// making up for missed times, the scheduled time is the time the run
+// was scheduled, rather than any of the missed times.
+func ScheduledTime(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(scheduledTimeKey{}).(time.Time)
+	return t, ok
+}
+
+// Config holds the configuration for a Scheduler.
+type Config struct {
+	// Clock is used to determine when jobs run, and to measure
+	// their durations.
+	Clock clock.Clock
+
+	// MaxConcurrent, if positive, is the maximum number of jobs
+	// that the Scheduler will run concurrently.
+	MaxConcurrent int
+
+	// OnError, if non-nil, is called with the name of a job and the
+	// error it returned, each time the job fails. OnError is called
+	// without any locks held, and so may call the Scheduler's methods.
+	OnError func(name string, err error)
+
+	// Leader, if non-nil, is called each time a job is due to run,
+	// and the run is skipped unless it returns true; the job is
+	// rescheduled either way. When several processes run Schedulers
+	// with the same jobs, such as the controllers of a highly
+	// available deployment, setting Leader to the IsLeader method
+	// of a lease.Elector shared by them ensures, so long as their
+	// clocks agree, that each run of a job occurs in only one
+	// process, and that another process takes over if the leader
+	// fails.
+	Leader func() bool
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.MaxConcurrent < 0 {
+		return errors.NotValidf("negative MaxConcurrent")
+	}
+	return nil
+}
+
+// JobInfo describes a job, and records metrics about its runs.
+type JobInfo struct {
+	// Name is the name of the job.
+	Name string
+
+	// Next is the time at which the job will next run, or the zero
+	// time if it is not scheduled to run: because the Scheduler is
+	// not started, the job is paused or running, or its trigger has
+	// no more times. For a job catching up with missed times under
+	// MisfireFireAll, Next may be in the past.
+	Next time.Time
+
+	// Fired is the time up to which the job's trigger times have
+	// been run or skipped. It may be persisted, and passed as
+	// JobOptions.Since when the job is restored.
+	Fired time.Time
+
+	// Paused reports whether the job is paused.
+	Paused bool
+
+	// Running reports whether the job is running.
+	Running bool
+
+	// Runs is the number of times the job has run, and Failures
+	// the number of those runs that returned an error.
+	Runs, Failures int
+
+	// LastRun is the time at which the job last started running,
+	// LastDuration is how long that run took, and LastError is the
+	// error that it returned.
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    error
+
+	// Durations records the durations of all of the job's runs.
+	Durations *timing.Histogram
+}
+
+// Scheduler runs named jobs at the times given by their triggers. A
+// job's next run time is computed when it is added or resumed, and
+// each time a run completes, so runs of a job never overlap; times that
+// pass while a job is running are skipped. Times that pass while a job
+// cannot run are handled according to its MisfirePolicy.
+//
+// Jobs run only while the Scheduler is started. Jobs may be added to,
+// removed from, paused and resumed whether or not it is started.
+//
+// Scheduler's methods are safe for concurrent use.
+type Scheduler struct {
+	config Config
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	runner *schedule.Runner[string, run]
+}
+
+type job struct {
+	name      string
+	trigger   Trigger
+	f         Func
+	misfire   MisfirePolicy
+	durations *timing.Histogram
+
+	// The following fields are protected by the Scheduler's mutex.
+	// fired is the time up to which trigger times have been run or
+	// skipped, from which missed times are counted. seq identifies
+	// the most recently scheduled run of the job.
+	seq          uint64
+	next         time.Time
+	fired        time.Time
+	paused       bool
+	running      bool
+	removed      bool
+	runs         int
+	failures     int
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    error
+}
+
+// New returns a new, stopped, Scheduler with the given configuration.
+func New(config Config) (*Scheduler, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating scheduler config")
+	}
+	return &Scheduler{
+		config: config,
+		jobs:   make(map[string]*job),
+	}, nil
+}
+
+// Start starts the Scheduler running jobs. Start returns an error if
+// the Scheduler is already started.
+func (s *Scheduler) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.runner != nil {
+		return errors.New("scheduler already started")
+	}
+	runner, err := schedule.NewRunner(schedule.RunnerConfig[string, run]{
+		Schedule:      schedule.NewSchedule[string, run](s.config.Clock),
+		MaxConcurrent: s.config.MaxConcurrent,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	s.runner = runner
+	for _, j := range s.jobs {
+		if !j.paused {
+			s.schedule(j)
+		}
+	}
+	return nil
+}
+
+// Stop stops the Scheduler, cancelling the contexts of any running
+// jobs, and waits for them to return. The Scheduler may be started
+// again, whereupon jobs' next run times are recomputed. If the
+// Scheduler is not started, Stop is a no-op.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	runner := s.runner
+	s.runner = nil
+	for _, j := range s.jobs {
+		j.next = time.Time{}
+	}
+	s.mu.Unlock()
+	if runner != nil {
+		runner.Kill()
+		runner.Wait()
+	}
+}
+
+// AddJob adds a job with the specified name, which runs f at the times
+// given by trigger, skipping missed times. AddJob returns an error
+// satisfying errors.IsAlreadyExists if a job with the name already
+// exists.
+func (s *Scheduler) AddJob(name string, trigger Trigger, f Func) error {
+	return s.AddJobWithOptions(name, trigger, f, JobOptions{})
+}
+
+// AddJobWithOptions is like AddJob, but with the specified options.
+func (s *Scheduler) AddJobWithOptions(name string, trigger Trigger, f Func, opts JobOptions) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if trigger == nil {
+		return errors.NotValidf("nil trigger")
+	}
+	if f == nil {
+		return errors.NotValidf("nil func")
+	}
+	durations, err := timing.NewHistogram(timing.HistogramConfig{Clock: s.config.Clock})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return errors.AlreadyExistsf("job %q", name)
+	}
+	j := &job{
+		name:      name,
+		trigger:   trigger,
+		f:         f,
+		misfire:   opts.Misfire,
+		durations: durations,
+		fired:     opts.Since,
+	}
+	if j.fired.IsZero() {
+		j.fired = s.config.Clock.Now()
+	}
+	s.jobs[name] = j
+	s.schedule(j)
+	return nil
+}
+
+// RemoveJob removes the job with the specified name. If the job is
+// running, the run is not interrupted. RemoveJob returns an error
+// satisfying errors.IsNotFound if no job with the name exists.
+func (s *Scheduler) RemoveJob(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, err := s.job(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	delete(s.jobs, name)
+	j.removed = true
+	s.unschedule(j)
+	return nil
+}
+
+// PauseJob pauses the job with the specified name, so that it will not
+// run until it is resumed. If the job is running, the run is not
+// interrupted. Pausing a paused job is a no-op. PauseJob returns an
+// error satisfying errors.IsNotFound if no job with the name exists.
+func (s *Scheduler) PauseJob(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, err := s.job(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	j.paused = true
+	s.unschedule(j)
+	return nil
+}
+
+// ResumeJob resumes the paused job with the specified name, computing
+// its next run time according to its misfire policy. Resuming a job
+// that is not paused is a no-op. ResumeJob returns an error satisfying
+// errors.IsNotFound if no job with the name exists.
+func (s *Scheduler) ResumeJob(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, err := s.job(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if j.paused {
+		j.paused = false
+		if !j.running {
+			s.schedule(j)
+		}
+	}
+	return nil
+}
+
+// ListJobs returns information about all of the jobs, ordered by name.
+func (s *Scheduler) ListJobs() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		infos = append(infos, JobInfo{
+			Name:         j.name,
+			Next:         j.next,
+			Fired:        j.fired,
+			Paused:       j.paused,
+			Running:      j.running,
+			Runs:         j.runs,
+			Failures:     j.failures,
+			LastRun:      j.lastRun,
+			LastDuration: j.lastDuration,
+			LastError:    j.lastError,
+			Durations:    j.durations,
+		})
+	}
+	sort.Slice(infos, func(i, k int) bool {
+		return infos[i].Name < infos[k].Name
+	})
+	return infos
+}
+
+func (s *Scheduler) job(name string) (*job, error) {
+	j, ok := s.jobs[name]
+	if !ok {
+		return nil, errors.NotFoundf("job %q", name)
+	}
+	return j, nil
+}
+
+// schedule computes the job's next run time, according to its misfire
+// policy, and adds a run of the job to the runner, if the Scheduler is
+// started and the trigger has a next time. schedule must be called with
+// s.mu held.
+func (s *Scheduler) schedule(j *job) {
+	j.next = time.Time{}
+	if s.runner == nil {
+		return
+	}
+	now := s.config.Clock.Now()
+	from := now
+	if j.misfire != MisfireSkip && j.fired.Before(now) {
+		from = j.fired
+	}
+	next := j.trigger.Next(from)
+	if next.IsZero() {
+		return
+	}
+	if j.misfire == MisfireFireOnce && next.Before(now) {
+		next = now
+	}
+	j.next = next
+	j.seq++
+	s.runner.Add(run{s: s, job: j, at: next, seq: j.seq})
+}
+
+// unschedule removes any pending run of the job from the runner.
+// unschedule must be called with s.mu held.
+func (s *Scheduler) unschedule(j *job) {
+	j.next = time.Time{}
+	if s.runner != nil {
+		s.runner.Remove(j.name)
+	}
+}
+
+// run is a scheduled run of a job, executed by the Scheduler's runner.
+// A run is superseded if its seq is not the job's: the job was paused
+// and resumed after the runner took the run from its schedule, and so
+// another run has since been scheduled.
+type run struct {
+	s   *Scheduler
+	job *job
+	at  time.Time
+	seq uint64
+}
+
+// Key is part of the schedule.Operation interface.
+func (r run) Key() string {
+	return r.job.name
+}
+
+// Delay is part of the schedule.Operation interface.
+func (r run) Delay() time.Duration {
+	return r.at.Sub(r.s.config.Clock.Now())
+}
+
+// Do is part of the schedule.RunnableOperation interface. Do always
+// returns nil: failures are recorded in the job's metrics, and the job
+// is rescheduled according to its trigger whether or not it failed, or
+// was skipped because the process is not the leader. A superseded run
+// is skipped, and the job is not rescheduled.
+func (r run) Do(ctx context.Context) error {
+	s, j := r.s, r.job
+	leader := s.config.Leader == nil || s.config.Leader()
+	if !r.start(ctx, leader) {
+		return nil
+	}
+	start := s.config.Clock.Now()
+	err := call(context.WithValue(ctx, scheduledTimeKey{}, r.at), j)
+	r.finish(ctx, start, j.durations.Since(start), err)
+	if err != nil && s.config.OnError != nil {
+		s.config.OnError(j.name, err)
+	}
+	return nil
+}
+
+// start marks the job as running, and reports whether or not it should
+// be run. If the run is superseded, or the process is not the leader,
+// the job is not run; in the latter case it is rescheduled.
+func (r run) start(ctx context.Context, leader bool) bool {
+	s, j := r.s, r.job
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.seq != j.seq {
+		return false
+	}
+	if !leader {
+		j.fired = s.config.Clock.Now()
+		if !j.removed && !j.paused && ctx.Err() == nil {
+			s.schedule(j)
+		}
+		return false
+	}
+	j.running = true
+	j.next = time.Time{}
+	return true
+}
+
+// finish records the outcome of the job's run, and reschedules it.
+func (r run) finish(ctx context.Context, start time.Time, d time.Duration, err error) {
+	s, j := r.s, r.job
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.running = false
+	if j.misfire == MisfireFireAll {
+		j.fired = r.at
+	} else {
+		j.fired = s.config.Clock.Now()
+	}
+	j.runs++
+	if err != nil {
+		j.failures++
+	}
+	j.lastRun = start
+	j.lastDuration = d
+	j.lastError = err
+	if !j.removed && !j.paused && ctx.Err() == nil {
+		s.schedule(j)
+	}
+}
+
+// call calls the job's function, converting a panic into an error, so
+// that the runner does not reschedule the run.
+func call(ctx context.Context, j *job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = errors.Errorf("job %q panicked: %v", j.name, v)
+		}
+	}()
+	return j.f(ctx)
+}
@@ -0,0 +1,500 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package scheduler_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/axw/juju-time/cron"
+	"github.com/axw/juju-time/scheduler"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type schedulerSuite struct {
+	coretesting.BaseSuite
+	clock  *coretesting.Clock
+	t0     time.Time
+	errors chan error
+}
+
+var _ = gc.Suite(&schedulerSuite{})
+
+func (s *schedulerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.t0 = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.clock = coretesting.NewClock(s.t0)
+	s.errors = make(chan error, 10)
+}
+
+func (s *schedulerSuite) newScheduler(c *gc.C) *scheduler.Scheduler {
+	sched, err := scheduler.New(scheduler.Config{
+		Clock: s.clock,
+		OnError: func(name string, err error) {
+			s.errors <- errors.Annotate(err, name)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return sched
+}
+
+func (s *schedulerSuite) TestValidate(c *gc.C) {
+	_, err := scheduler.New(scheduler.Config{})
+	c.Assert(err, gc.ErrorMatches, "validating scheduler config: nil Clock not valid")
+	_, err = scheduler.New(scheduler.Config{Clock: s.clock, MaxConcurrent: -1})
+	c.Assert(err, gc.ErrorMatches, "validating scheduler config: negative MaxConcurrent not valid")
+}
+
+func (s *schedulerSuite) TestStart(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+
+	runs := make(chan time.Time, 10)
+	err := sched.AddJob("a", scheduler.Every(time.Second), func(context.Context) error {
+		runs <- s.clock.Now()
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Jobs are not scheduled until the scheduler is started.
+	assertJobs(c, sched, scheduler.JobInfo{Name: "a"})
+	s.clock.Advance(time.Second)
+	assertNotReceived(c, runs)
+
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+	c.Assert(sched.Start(), gc.ErrorMatches, "scheduler already started")
+	assertJobs(c, sched, scheduler.JobInfo{Name: "a", Next: s.t0.Add(2 * time.Second)})
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(2*time.Second))
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(3 * time.Second))
+	})
+	info := sched.ListJobs()[0]
+	c.Assert(info.Runs, gc.Equals, 1)
+	c.Assert(info.Failures, gc.Equals, 0)
+	c.Assert(info.LastRun, gc.Equals, s.t0.Add(2*time.Second))
+	c.Assert(info.Durations.Count(), gc.Equals, uint64(1))
+
+	// Stopping the scheduler unschedules the jobs; starting it
+	// again recomputes their next run times.
+	sched.Stop()
+	assertJobs(c, sched, scheduler.JobInfo{
+		Name:    "a",
+		Runs:    1,
+		LastRun: s.t0.Add(2 * time.Second),
+	})
+	s.clock.Advance(time.Second)
+	assertNotReceived(c, runs)
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+	c.Assert(sched.ListJobs()[0].Next, gc.Equals, s.t0.Add(4*time.Second))
+}
+
+func (s *schedulerSuite) TestAddJob(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	f := func(context.Context) error { return nil }
+	c.Assert(sched.AddJob("a", nil, f), gc.ErrorMatches, "nil trigger not valid")
+	c.Assert(sched.AddJob("a", scheduler.Every(time.Second), nil), gc.ErrorMatches, "nil func not valid")
+	c.Assert(sched.AddJob("b", scheduler.Every(time.Minute), f), jc.ErrorIsNil)
+	c.Assert(sched.AddJob("a", scheduler.Every(time.Second), f), jc.ErrorIsNil)
+	err := sched.AddJob("a", scheduler.Every(time.Second), f)
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Assert(err, gc.ErrorMatches, `job "a" already exists`)
+
+	assertJobs(c, sched,
+		scheduler.JobInfo{Name: "a", Next: s.t0.Add(time.Second)},
+		scheduler.JobInfo{Name: "b", Next: s.t0.Add(time.Minute)},
+	)
+}
+
+func (s *schedulerSuite) TestCron(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	expr, err := cron.Parse("*/15 * * * *")
+	c.Assert(err, jc.ErrorIsNil)
+	runs := make(chan time.Time, 10)
+	err = sched.AddJob("a", expr, func(context.Context) error {
+		runs <- s.clock.Now()
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sched.ListJobs()[0].Next, gc.Equals, s.t0.Add(15*time.Minute))
+
+	s.clock.Advance(15 * time.Minute)
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(15*time.Minute))
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(30 * time.Minute))
+	})
+}
+
+func (s *schedulerSuite) TestExhaustedTrigger(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	// "30 February" never occurs, so the job never runs.
+	expr, err := cron.Parse("0 0 30 2 *")
+	c.Assert(err, jc.ErrorIsNil)
+	err = sched.AddJob("a", expr, func(context.Context) error { return nil })
+	c.Assert(err, jc.ErrorIsNil)
+	assertJobs(c, sched, scheduler.JobInfo{Name: "a"})
+}
+
+func (s *schedulerSuite) TestRemoveJob(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	runs := make(chan time.Time, 10)
+	err := sched.AddJob("a", scheduler.Every(time.Second), func(context.Context) error {
+		runs <- s.clock.Now()
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sched.RemoveJob("a"), jc.ErrorIsNil)
+	c.Assert(sched.ListJobs(), gc.HasLen, 0)
+	s.clock.Advance(time.Second)
+	assertNotReceived(c, runs)
+
+	err = sched.RemoveJob("a")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `job "a" not found`)
+}
+
+func (s *schedulerSuite) TestRemoveRunningJob(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	started := make(chan struct{}, 10)
+	finish := make(chan struct{})
+	err := sched.AddJob("a", scheduler.Every(time.Second), func(context.Context) error {
+		started <- struct{}{}
+		<-finish
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.clock.Advance(time.Second)
+	receive(c, started)
+	c.Assert(sched.ListJobs()[0].Running, jc.IsTrue)
+
+	// The run is not interrupted, but the job
+	// is not rescheduled once it completes.
+	c.Assert(sched.RemoveJob("a"), jc.ErrorIsNil)
+	close(finish)
+	s.clock.Advance(time.Second)
+	assertNotReceived(c, started)
+}
+
+func (s *schedulerSuite) TestPauseJob(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	runs := make(chan time.Time, 10)
+	err := sched.AddJob("a", scheduler.Every(time.Second), func(context.Context) error {
+		runs <- s.clock.Now()
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sched.PauseJob("a"), jc.ErrorIsNil)
+	c.Assert(sched.PauseJob("a"), jc.ErrorIsNil)
+	assertJobs(c, sched, scheduler.JobInfo{Name: "a", Paused: true})
+	s.clock.Advance(time.Second)
+	assertNotReceived(c, runs)
+
+	// Resuming a job computes its next run time from now.
+	c.Assert(sched.ResumeJob("a"), jc.ErrorIsNil)
+	assertJobs(c, sched, scheduler.JobInfo{Name: "a", Next: s.t0.Add(2 * time.Second)})
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(2*time.Second))
+
+	err = sched.PauseJob("b")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	err = sched.ResumeJob("b")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *schedulerSuite) TestFailure(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	var n int
+	err := sched.AddJob("a", scheduler.Every(time.Second), func(context.Context) error {
+		n++
+		if n == 1 {
+			return errors.New("boom")
+		}
+		panic("kaboom")
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Failed jobs are rescheduled according to their trigger.
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.errors), gc.ErrorMatches, "a: boom")
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(2 * time.Second))
+	})
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.errors), gc.ErrorMatches, `a: job "a" panicked: kaboom`)
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(3 * time.Second))
+	})
+
+	info := sched.ListJobs()[0]
+	c.Assert(info.Runs, gc.Equals, 2)
+	c.Assert(info.Failures, gc.Equals, 2)
+	c.Assert(info.LastError, gc.ErrorMatches, `job "a" panicked: kaboom`)
+}
+
+func (s *schedulerSuite) TestLeader(c *gc.C) {
+	var leader atomic.Bool
+	sched, err := scheduler.New(scheduler.Config{
+		Clock:  s.clock,
+		Leader: leader.Load,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	runs := make(chan time.Time, 10)
+	err = sched.AddJob("a", scheduler.Every(time.Second), func(context.Context) error {
+		runs <- s.clock.Now()
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Runs are skipped while the scheduler is not the
+	// leader, but the job is still rescheduled.
+	s.clock.Advance(time.Second)
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(2 * time.Second))
+	})
+	assertNotReceived(c, runs)
+	c.Assert(sched.ListJobs()[0].Runs, gc.Equals, 0)
+
+	leader.Store(true)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(2*time.Second))
+}
+
+func (s *schedulerSuite) TestPauseResumeInFlight(c *gc.C) {
+	// The leader check is called after the runner has taken the
+	// run from its schedule, and before the job starts running,
+	// so blocking it holds the run in flight.
+	checking := make(chan struct{})
+	release := make(chan bool)
+	var blocked atomic.Bool
+	blocked.Store(true)
+	sched, err := scheduler.New(scheduler.Config{
+		Clock: s.clock,
+		Leader: func() bool {
+			if !blocked.Load() {
+				return true
+			}
+			checking <- struct{}{}
+			return <-release
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer sched.Stop()
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	runs := make(chan time.Time, 10)
+	err = sched.AddJob("a", scheduler.Every(time.Second), func(context.Context) error {
+		runs <- s.clock.Now()
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	for _, leader := range []bool{true, false} {
+		s.clock.Advance(time.Second)
+		receive(c, checking)
+		c.Assert(sched.PauseJob("a"), jc.ErrorIsNil)
+		c.Assert(sched.ResumeJob("a"), jc.ErrorIsNil)
+		next := s.clock.Now().Add(time.Second)
+		assertJobs(c, sched, scheduler.JobInfo{Name: "a", Next: next})
+
+		// The run in flight was superseded by the one scheduled
+		// when the job was resumed, so it is skipped.
+		release <- leader
+		assertNotReceived(c, runs)
+		assertJobs(c, sched, scheduler.JobInfo{Name: "a", Next: next})
+	}
+
+	blocked.Store(false)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(3*time.Second))
+}
+
+func (s *schedulerSuite) TestStopCancelsRunningJobs(c *gc.C) {
+	sched := s.newScheduler(c)
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	started := make(chan struct{}, 10)
+	err := sched.AddJob("a", scheduler.Every(time.Second), func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.clock.Advance(time.Second)
+	receive(c, started)
+
+	sched.Stop()
+	info := sched.ListJobs()[0]
+	c.Assert(info.Running, jc.IsFalse)
+	c.Assert(info.Next.IsZero(), jc.IsTrue)
+	c.Assert(info.LastError, gc.Equals, context.Canceled)
+}
+
+func (s *schedulerSuite) TestAddJobWithOptions(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+
+	f := func(context.Context) error { return nil }
+	err := sched.AddJobWithOptions("a", scheduler.Every(time.Second), f, scheduler.JobOptions{Misfire: 3})
+	c.Assert(err, gc.ErrorMatches, "misfire policy 3 not valid")
+	err = sched.AddJobWithOptions("a", scheduler.Every(time.Second), f, scheduler.JobOptions{
+		Since: s.t0.Add(-time.Hour),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sched.AddJob("b", scheduler.Every(time.Second), f), jc.ErrorIsNil)
+	jobs := sched.ListJobs()
+	c.Assert(jobs[0].Fired, gc.Equals, s.t0.Add(-time.Hour))
+	c.Assert(jobs[1].Fired, gc.Equals, s.t0)
+}
+
+// addMisfireJob adds a job, triggered every minute with the specified
+// misfire policy and last fired an hour ago, which sends the time at
+// which it is scheduled to run on the returned channel.
+func (s *schedulerSuite) addMisfireJob(c *gc.C, sched *scheduler.Scheduler, policy scheduler.MisfirePolicy) <-chan time.Time {
+	runs := make(chan time.Time, 100)
+	err := sched.AddJobWithOptions("a", scheduler.Every(time.Minute), func(ctx context.Context) error {
+		t, ok := scheduler.ScheduledTime(ctx)
+		c.Check(ok, jc.IsTrue)
+		runs <- t
+		return nil
+	}, scheduler.JobOptions{
+		Misfire: policy,
+		Since:   s.t0.Add(-150 * time.Second),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return runs
+}
+
+func (s *schedulerSuite) TestMisfireSkip(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	runs := s.addMisfireJob(c, sched, scheduler.MisfireSkip)
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+	c.Assert(sched.ListJobs()[0].Next, gc.Equals, s.t0.Add(time.Minute))
+	assertNotReceived(c, runs)
+}
+
+func (s *schedulerSuite) TestMisfireFireOnce(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	runs := s.addMisfireJob(c, sched, scheduler.MisfireFireOnce)
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	// The missed times are made up for with one run, now.
+	c.Assert(receive(c, runs), gc.Equals, s.t0)
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(time.Minute))
+	})
+	c.Assert(sched.ListJobs()[0].Fired, gc.Equals, s.t0)
+	assertNotReceived(c, runs)
+
+	// Times missed while paused are handled the same way.
+	c.Assert(sched.PauseJob("a"), jc.ErrorIsNil)
+	s.clock.Advance(5 * time.Minute)
+	c.Assert(sched.ResumeJob("a"), jc.ErrorIsNil)
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(5*time.Minute))
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(6 * time.Minute))
+	})
+	assertNotReceived(c, runs)
+}
+
+func (s *schedulerSuite) TestMisfireFireAll(c *gc.C) {
+	sched := s.newScheduler(c)
+	defer sched.Stop()
+	runs := s.addMisfireJob(c, sched, scheduler.MisfireFireAll)
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+
+	// Each missed time is run in turn.
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(-90*time.Second))
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(-30*time.Second))
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(30 * time.Second))
+	})
+	c.Assert(sched.ListJobs()[0].Fired, gc.Equals, s.t0.Add(-30*time.Second))
+	assertNotReceived(c, runs)
+
+	// Times missed while the scheduler is stopped are
+	// caught up with when it is started again.
+	sched.Stop()
+	s.clock.Advance(2 * time.Minute)
+	c.Assert(sched.Start(), jc.ErrorIsNil)
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(30*time.Second))
+	c.Assert(receive(c, runs), gc.Equals, s.t0.Add(90*time.Second))
+	waitUntil(c, func() bool {
+		return sched.ListJobs()[0].Next.Equal(s.t0.Add(150 * time.Second))
+	})
+	assertNotReceived(c, runs)
+}
+
+// assertJobs asserts that the scheduler's jobs have the expected
+// names, next run times, states, and run counts and times. Fired
+// times are checked by the misfire tests.
+func assertJobs(c *gc.C, sched *scheduler.Scheduler, expect ...scheduler.JobInfo) {
+	jobs := sched.ListJobs()
+	for i := range jobs {
+		c.Assert(jobs[i].Durations, gc.NotNil)
+		jobs[i].Durations = nil
+		jobs[i].LastDuration = 0
+		jobs[i].Fired = time.Time{}
+	}
+	c.Assert(jobs, jc.DeepEquals, expect)
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotReceived[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected value: %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+// waitUntil waits for cond to return true, polling it periodically.
+func waitUntil(c *gc.C, cond func() bool) {
+	timeout := time.After(coretesting.LongWait)
+	for !cond() {
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for condition")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
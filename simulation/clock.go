@@ -0,0 +1,63 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simulation
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the virtual clock of a Simulation, which advances only
+// when the simulation steps. Clock implements clock.Clock.
+//
+// Clock's methods are safe for concurrent use.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	t  time.Time
+	ch chan time.Time
+}
+
+// Now is part of the clock.Clock interface.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After is part of the clock.Clock interface. The returned channel is
+// sent the time when the simulation steps to or past the duration from
+// now; if the duration is not positive, it is sent the time immediately.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{c.now.Add(d), ch})
+	return ch
+}
+
+// set sets the clock's time, and notifies the waiters whose
+// times have arrived, in order of time.
+func (c *Clock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].t.Before(c.waiters[j].t)
+	})
+	n := 0
+	for ; n < len(c.waiters) && !c.waiters[n].t.After(now); n++ {
+		c.waiters[n].ch <- now
+	}
+	c.waiters = append(c.waiters[:0], c.waiters[n:]...)
+}
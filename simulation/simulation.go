@@ -0,0 +1,185 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package simulation provides a deterministic harness for running many
+// schedules on a shared virtual clock, so that long-running scenarios,
+// such as retry storms, may be reproduced exactly and quickly in tests.
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Simulation.
+type Config struct {
+	// Start is the initial time of the virtual clock.
+	Start time.Time
+
+	// Step is the amount by which the virtual clock advances
+	// at each step of the simulation.
+	Step time.Duration
+
+	// OnDispatch, if non-nil, is called with each dispatch as it
+	// occurs, instead of the dispatch being recorded; use it to
+	// aggregate dispatches in long simulations.
+	OnDispatch func(Dispatch)
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Step <= 0 {
+		return errors.NotValidf("non-positive Step")
+	}
+	return nil
+}
+
+// Dispatch records the execution of an operation by a Simulation.
+type Dispatch struct {
+	// Time is the virtual time at which the operation was executed.
+	Time time.Time
+
+	// Schedule is the name of the operation's schedule.
+	Schedule string
+
+	// Key is the operation's key, formatted with fmt.Sprint.
+	Key string
+
+	// Err is the error returned by the operation, if any.
+	Err error
+}
+
+// Simulation hosts schedules on a shared virtual clock, and executes
+// their operations as a Runner would, but synchronously, as the clock
+// advances in discrete steps. At each step, the ready operations of
+// each schedule are executed in turn, in the order in which the
+// schedules were added and the order of their readiness; operations
+// that fail or panic are rescheduled, with their Delay methods
+// determining when they will next be executed. Given the same schedules
+// and operations, a Simulation therefore always dispatches the same
+// operations at the same times.
+//
+// Operations are executed by the goroutine that steps the simulation,
+// and so must not block waiting for the virtual clock to advance.
+//
+// Simulation's methods are not safe for concurrent use.
+type Simulation struct {
+	config     Config
+	clock      *Clock
+	hosts      []host
+	names      map[string]bool
+	dispatches []Dispatch
+}
+
+// host is a schedule hosted by a Simulation.
+type host interface {
+	// dispatch executes the schedule's operations that are ready
+	// at the specified time, and returns the resulting dispatches.
+	dispatch(ctx context.Context, now time.Time) []Dispatch
+}
+
+// New returns a new Simulation with the given configuration, with no
+// schedules.
+func New(config Config) (*Simulation, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating simulation config")
+	}
+	return &Simulation{
+		config: config,
+		clock:  &Clock{now: config.Start},
+		names:  make(map[string]bool),
+	}, nil
+}
+
+// Clock returns the simulation's virtual clock, which must be the clock
+// of every schedule added to the simulation, and of their operations.
+func (s *Simulation) Clock() *Clock {
+	return s.clock
+}
+
+// AddSchedule adds a schedule, with the specified name, to the
+// simulation. The simulation takes ownership of the schedule; the
+// schedule must only be manipulated by its operations, or between
+// steps. AddSchedule returns an error satisfying errors.IsAlreadyExists
+// if a schedule with the name has already been added.
+func AddSchedule[K comparable, O schedule.RunnableOperation[K]](s *Simulation, name string, sched *schedule.Schedule[K, O]) error {
+	if s.names[name] {
+		return errors.AlreadyExistsf("schedule %q", name)
+	}
+	s.names[name] = true
+	s.hosts = append(s.hosts, &scheduleHost[K, O]{name: name, schedule: sched})
+	return nil
+}
+
+// Step advances the virtual clock by one step, and executes
+// the operations that are then ready.
+func (s *Simulation) Step() {
+	now := s.clock.Now().Add(s.config.Step)
+	s.clock.set(now)
+	ctx := context.Background()
+	for _, h := range s.hosts {
+		for _, d := range h.dispatch(ctx, now) {
+			if s.config.OnDispatch != nil {
+				s.config.OnDispatch(d)
+			} else {
+				s.dispatches = append(s.dispatches, d)
+			}
+		}
+	}
+}
+
+// Run steps the simulation until the virtual clock has advanced
+// by at least the specified duration.
+func (s *Simulation) Run(d time.Duration) {
+	end := s.clock.Now().Add(d)
+	for s.clock.Now().Before(end) {
+		s.Step()
+	}
+}
+
+// Dispatches returns the recorded dispatches, in the order
+// in which they occurred.
+func (s *Simulation) Dispatches() []Dispatch {
+	return append([]Dispatch(nil), s.dispatches...)
+}
+
+type scheduleHost[K comparable, O schedule.RunnableOperation[K]] struct {
+	name     string
+	schedule *schedule.Schedule[K, O]
+}
+
+func (h *scheduleHost[K, O]) dispatch(ctx context.Context, now time.Time) []Dispatch {
+	ready := h.schedule.Ready(now)
+	if len(ready) == 0 {
+		return nil
+	}
+	dispatches := make([]Dispatch, len(ready))
+	for i, op := range ready {
+		err := do(ctx, op)
+		if err != nil {
+			h.schedule.Add(op)
+		}
+		dispatches[i] = Dispatch{
+			Time:     now,
+			Schedule: h.name,
+			Key:      fmt.Sprint(op.Key()),
+			Err:      err,
+		}
+	}
+	return dispatches
+}
+
+// do calls the operation's Do method, converting a panic into an error,
+// as a Runner does.
+func do[K comparable, O schedule.RunnableOperation[K]](ctx context.Context, op O) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = errors.Errorf("operation %v panicked: %v", op.Key(), v)
+		}
+	}()
+	return op.Do(ctx)
+}
@@ -0,0 +1,177 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simulation_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/simulation"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type simulationSuite struct {
+	coretesting.BaseSuite
+	t0 time.Time
+}
+
+var _ = gc.Suite(&simulationSuite{})
+
+func (s *simulationSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.t0 = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func (s *simulationSuite) newSimulation(c *gc.C, step time.Duration) *simulation.Simulation {
+	sim, err := simulation.New(simulation.Config{Start: s.t0, Step: step})
+	c.Assert(err, jc.ErrorIsNil)
+	return sim
+}
+
+func (s *simulationSuite) TestValidate(c *gc.C) {
+	_, err := simulation.New(simulation.Config{})
+	c.Assert(err, gc.ErrorMatches, "validating simulation config: non-positive Step not valid")
+}
+
+func (s *simulationSuite) TestStep(c *gc.C) {
+	sim := s.newSimulation(c, time.Second)
+	sched := schedule.NewSchedule[string, *testOp](sim.Clock())
+	c.Assert(simulation.AddSchedule(sim, "s0", sched), jc.ErrorIsNil)
+	err := simulation.AddSchedule(sim, "s0", sched)
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+
+	sched.Add(&testOp{key: "a", delay: 1500 * time.Millisecond})
+	sched.Add(&testOp{key: "b", delay: time.Second, fail: 1})
+	sim.Step()
+	sim.Step()
+	sim.Step()
+	c.Assert(sim.Clock().Now(), gc.Equals, s.t0.Add(3*time.Second))
+	c.Assert(sim.Dispatches(), jc.DeepEquals, []simulation.Dispatch{
+		{Time: s.t0.Add(time.Second), Schedule: "s0", Key: "b", Err: errFailed},
+		{Time: s.t0.Add(2 * time.Second), Schedule: "s0", Key: "a"},
+		{Time: s.t0.Add(2 * time.Second), Schedule: "s0", Key: "b"},
+	})
+}
+
+func (s *simulationSuite) TestClock(c *gc.C) {
+	sim := s.newSimulation(c, time.Minute)
+	ch := sim.Clock().After(90 * time.Second)
+	sim.Step()
+	select {
+	case <-ch:
+		c.Fatalf("unexpected time")
+	default:
+	}
+	sim.Step()
+	c.Assert(<-ch, gc.Equals, s.t0.Add(2*time.Minute))
+	c.Assert(<-sim.Clock().After(0), gc.Equals, s.t0.Add(2*time.Minute))
+}
+
+func (s *simulationSuite) TestPanic(c *gc.C) {
+	sim := s.newSimulation(c, time.Second)
+	sched := schedule.NewSchedule[string, *testOp](sim.Clock())
+	c.Assert(simulation.AddSchedule(sim, "s0", sched), jc.ErrorIsNil)
+	sched.Add(&testOp{key: "a", delay: time.Second, panic: true})
+	sim.Step()
+	dispatches := sim.Dispatches()
+	c.Assert(dispatches, gc.HasLen, 1)
+	c.Assert(dispatches[0].Err, gc.ErrorMatches, "operation a panicked: boom")
+}
+
+// TestRetryStorm simulates a thousand hours of a fleet of agents
+// whose operations fail, with backoff, during an hour-long outage,
+// and checks that the results are reproducible.
+func (s *simulationSuite) TestRetryStorm(c *gc.C) {
+	run := func() (int, []simulation.Dispatch) {
+		sim := s.newSimulation(c, time.Minute)
+		outage := s.t0.Add(time.Hour)
+		var n int
+		for agent := 0; agent < 10; agent++ {
+			sched := schedule.NewSchedule[string, *outageOp](sim.Clock())
+			name := fmt.Sprintf("agent-%d", agent)
+			c.Assert(simulation.AddSchedule(sim, name, sched), jc.ErrorIsNil)
+			for i := 0; i < 10; i++ {
+				op := &outageOp{
+					key:   fmt.Sprintf("op-%d", i),
+					clock: sim.Clock(),
+					until: outage,
+					count: &n,
+				}
+				op.Min = time.Duration(i+1) * time.Minute
+				op.Max = time.Hour
+				op.Clock = sim.Clock()
+				sched.Add(op)
+			}
+		}
+		sim.Run(1000 * time.Hour)
+		return n, sim.Dispatches()
+	}
+	n, dispatches := run()
+	c.Assert(n, gc.Equals, len(dispatches))
+	c.Assert(n > 100, jc.IsTrue)
+	last := dispatches[len(dispatches)-1]
+	c.Assert(last.Err, jc.ErrorIsNil)
+	c.Assert(last.Time.Before(s.t0.Add(3*time.Hour)), jc.IsTrue)
+
+	n2, dispatches2 := run()
+	c.Assert(n2, gc.Equals, n)
+	c.Assert(dispatches2, jc.DeepEquals, dispatches)
+}
+
+var errFailed = errors.New("failed")
+
+// testOp is an operation with a fixed delay, which fails a
+// specified number of times, or panics.
+type testOp struct {
+	key   string
+	delay time.Duration
+	fail  int
+	panic bool
+}
+
+func (op *testOp) Key() string {
+	return op.key
+}
+
+func (op *testOp) Delay() time.Duration {
+	return op.delay
+}
+
+func (op *testOp) Do(context.Context) error {
+	if op.panic {
+		panic("boom")
+	}
+	if op.fail > 0 {
+		op.fail--
+		return errFailed
+	}
+	return nil
+}
+
+// outageOp is an operation that fails until a specified time,
+// retrying with exponential backoff, and counts its attempts.
+type outageOp struct {
+	schedule.ExponentialBackoff
+	key   string
+	clock *simulation.Clock
+	until time.Time
+	count *int
+}
+
+func (op *outageOp) Key() string {
+	return op.key
+}
+
+func (op *outageOp) Do(context.Context) error {
+	*op.count++
+	if op.clock.Now().Before(op.until) {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package sla provides a Tracker for in-flight operations, which reports
+// operations that are not completed by their deadlines as they happen.
+package sla
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// Breach describes an operation that was not completed by its deadline.
+type Breach[K comparable] struct {
+	// Key identifies the operation.
+	Key K
+
+	// Started is the time at which the operation was tracked.
+	Started time.Time
+
+	// Deadline is the time by which the operation was expected
+	// to complete.
+	Deadline time.Time
+}
+
+// Config holds the configuration for a Tracker.
+type Config[K comparable] struct {
+	// Clock is used to measure deadlines.
+	Clock clock.Clock
+
+	// OnBreach is called, once, for each operation that is not
+	// completed by its deadline. Breaching operations remain tracked
+	// until they are completed. OnBreach is called without any locks
+	// held, and so may call the Tracker's methods.
+	OnBreach func(Breach[K])
+}
+
+// Validate checks that the config is valid.
+func (config Config[K]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.OnBreach == nil {
+		return errors.NotValidf("nil OnBreach")
+	}
+	return nil
+}
+
+// Tracker tracks in-flight operations, identified by keys of type K,
+// each of which is expected to complete by a deadline. Deadlines for all
+// operations are held in a single queue, serviced by the Tracker's
+// goroutine.
+//
+// Tracker's methods are safe for concurrent use.
+type Tracker[K comparable] struct {
+	config Config[K]
+
+	mu       sync.Mutex
+	inFlight map[K]*operation[K]
+	// deadlines holds the deadlines of operations that
+	// have not breached them.
+	deadlines *timequeue.Queue[K, *operation[K]]
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type operation[K comparable] struct {
+	key      K
+	started  time.Time
+	deadline time.Time
+}
+
+// NewTracker constructs and starts a new Tracker with the given
+// configuration. The Tracker will continue to run until it is killed.
+func NewTracker[K comparable](config Config[K]) (*Tracker[K], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating tracker config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &Tracker[K]{
+		config:    config,
+		inFlight:  make(map[K]*operation[K]),
+		deadlines: timequeue.New[K, *operation[K]](config.Clock),
+		wake:      make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go t.loop()
+	return t, nil
+}
+
+// Kill stops the Tracker. Kill does not wait for the Tracker to stop;
+// use Wait for that.
+func (t *Tracker[K]) Kill() {
+	t.cancel()
+}
+
+// Wait waits for the Tracker to stop.
+func (t *Tracker[K]) Wait() error {
+	<-t.done
+	return nil
+}
+
+// Track starts tracking an operation with the specified key, which is
+// expected to complete within the specified duration from now. Track
+// returns an error satisfying errors.IsAlreadyExists if an operation with
+// the same key is already being tracked.
+func (t *Tracker[K]) Track(key K, within time.Duration) error {
+	if within <= 0 {
+		return errors.NotValidf("non-positive duration")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.track(key, t.config.Clock.Now().Add(within))
+}
+
+// TrackDeadline is like Track, but takes the operation's deadline
+// rather than a duration.
+func (t *Tracker[K]) TrackDeadline(key K, deadline time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.track(key, deadline)
+}
+
+func (t *Tracker[K]) track(key K, deadline time.Time) error {
+	if _, ok := t.inFlight[key]; ok {
+		return errors.AlreadyExistsf("operation %v", key)
+	}
+	op := &operation[K]{key: key, started: t.config.Clock.Now(), deadline: deadline}
+	t.inFlight[key] = op
+	t.deadlines.Add(key, op, deadline)
+	t.notify()
+	return nil
+}
+
+// Complete stops tracking the operation with the specified key, and
+// reports whether it was being tracked. If the operation has not yet
+// breached its deadline, it will not do so.
+func (t *Tracker[K]) Complete(key K) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.inFlight[key]; !ok {
+		return false
+	}
+	delete(t.inFlight, key)
+	t.deadlines.Remove(key)
+	t.notify()
+	return true
+}
+
+// Len returns the number of operations being tracked,
+// including those that have breached their deadlines.
+func (t *Tracker[K]) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.inFlight)
+}
+
+// notify wakes the loop so it will re-evaluate the deadlines.
+func (t *Tracker[K]) notify() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (t *Tracker[K]) loop() {
+	defer close(t.done)
+	for {
+		t.mu.Lock()
+		next := t.deadlines.Next()
+		t.mu.Unlock()
+
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-t.wake:
+		case <-next:
+			t.mu.Lock()
+			var breaches []Breach[K]
+			for _, op := range t.deadlines.Ready(t.config.Clock.Now()) {
+				breaches = append(breaches, Breach[K]{
+					Key:      op.key,
+					Started:  op.started,
+					Deadline: op.deadline,
+				})
+			}
+			t.mu.Unlock()
+			for _, breach := range breaches {
+				t.config.OnBreach(breach)
+			}
+		}
+	}
+}
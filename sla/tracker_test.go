@@ -0,0 +1,106 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package sla_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/sla"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type trackerSuite struct {
+	coretesting.BaseSuite
+	clock    *coretesting.Clock
+	breaches chan sla.Breach[string]
+}
+
+var _ = gc.Suite(&trackerSuite{})
+
+func (s *trackerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.breaches = make(chan sla.Breach[string], 10)
+}
+
+func (s *trackerSuite) newTracker(c *gc.C) *sla.Tracker[string] {
+	t, err := sla.NewTracker(sla.Config[string]{
+		Clock: s.clock,
+		OnBreach: func(b sla.Breach[string]) {
+			s.breaches <- b
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return t
+}
+
+func (s *trackerSuite) TestValidate(c *gc.C) {
+	_, err := sla.NewTracker(sla.Config[string]{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating tracker config: nil OnBreach not valid")
+}
+
+func (s *trackerSuite) TestTrack(c *gc.C) {
+	t := s.newTracker(c)
+	defer stop(c, t)
+
+	c.Assert(t.Track("a", 0), gc.ErrorMatches, "non-positive duration not valid")
+	c.Assert(t.Track("a", time.Second), jc.ErrorIsNil)
+	err := t.Track("a", time.Second)
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Assert(err, gc.ErrorMatches, "operation a already exists")
+	c.Assert(t.Len(), gc.Equals, 1)
+}
+
+func (s *trackerSuite) TestBreach(c *gc.C) {
+	t := s.newTracker(c)
+	defer stop(c, t)
+
+	t0 := s.clock.Now()
+	c.Assert(t.Track("a", 2*time.Second), jc.ErrorIsNil)
+	c.Assert(t.TrackDeadline("b", t0.Add(time.Second)), jc.ErrorIsNil)
+	c.Assert(t.Track("c", time.Second), jc.ErrorIsNil)
+	c.Assert(t.Complete("c"), jc.IsTrue)
+
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.breaches), jc.DeepEquals, sla.Breach[string]{
+		Key: "b", Started: t0, Deadline: t0.Add(time.Second),
+	})
+	assertNoBreach(c, s.breaches)
+
+	// Breaching operations remain tracked until completed.
+	c.Assert(t.Len(), gc.Equals, 2)
+	c.Assert(t.Complete("b"), jc.IsTrue)
+	c.Assert(t.Complete("b"), jc.IsFalse)
+
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.breaches).Key, gc.Equals, "a")
+	s.clock.Advance(time.Hour)
+	assertNoBreach(c, s.breaches)
+}
+
+func stop(c *gc.C, t *sla.Tracker[string]) {
+	t.Kill()
+	c.Check(t.Wait(), jc.ErrorIsNil)
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNoBreach(c *gc.C, ch <-chan sla.Breach[string]) {
+	select {
+	case b := <-ch:
+		c.Fatalf("unexpected breach: %+v", b)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
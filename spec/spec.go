@@ -0,0 +1,170 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package spec parses the schedule specifications exposed to operators
+// in configuration, producing schedule.Recurrence values that may be
+// used with schedule.RecurrenceDelay, or as scheduler.Triggers.
+//
+// A specification is one of:
+//
+//	@every <duration>          e.g. "@every 5m", "@every 1h30m", "@every 1d"
+//	@hourly [:<MM>]            e.g. "@hourly", "@hourly :15"
+//	@daily [<HH:MM>]           e.g. "@daily", "@daily 03:00"
+//	@weekly [<day>] [<HH:MM>]  e.g. "@weekly", "@weekly sat 22:30"
+//	a cron expression          e.g. "*/10 * * * *", "@monthly"
+//
+// Durations are as accepted by duration.Parse, which also accepts days
+// and weeks, and must be positive. Days are three-letter English names, case-insensitively;
+// @weekly defaults to Sunday, and times of day default to midnight.
+// Anything else is parsed with cron.ParseInLocation, so the remaining
+// cron macros and time zone prefixes are also accepted.
+package spec
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axw/juju-time/cron"
+	"github.com/axw/juju-time/duration"
+	"github.com/axw/juju-time/schedule"
+	"github.com/juju/errors"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Parse parses a schedule specification, interpreting times of day
+// in the specified location.
+func Parse(spec string, loc *time.Location) (schedule.Recurrence, error) {
+	r, err := parse(spec, loc)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing schedule spec %q", spec)
+	}
+	return r, nil
+}
+
+func parse(spec string, loc *time.Location) (schedule.Recurrence, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, errors.New("empty spec")
+	}
+	args := fields[1:]
+	switch strings.ToLower(fields[0]) {
+	case "@every":
+		if len(args) != 1 {
+			return nil, errors.New("expected @every <duration>")
+		}
+		d, err := duration.Parse(args[0])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if d <= 0 {
+			return nil, errors.Errorf("non-positive duration %v", d)
+		}
+		return Every(d), nil
+	case "@hourly":
+		if len(args) > 1 {
+			return nil, errors.New("expected @hourly [:<MM>]")
+		}
+		minute := 0
+		if len(args) == 1 {
+			var err error
+			if !strings.HasPrefix(args[0], ":") {
+				return nil, errors.Errorf("invalid minute %q", args[0])
+			}
+			if minute, err = parseInt(args[0][1:], 59); err != nil {
+				return nil, errors.Errorf("invalid minute %q", args[0])
+			}
+		}
+		e, err := cron.ParseInLocation(strconv.Itoa(minute)+" * * * *", loc)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return e, nil
+	case "@daily":
+		if len(args) > 1 {
+			return nil, errors.New("expected @daily [<HH:MM>]")
+		}
+		hour, minute, err := parseTimeOfDay(args)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return schedule.Daily(hour, minute, loc), nil
+	case "@weekly":
+		if len(args) > 2 {
+			return nil, errors.New("expected @weekly [<day>] [<HH:MM>]")
+		}
+		day := time.Sunday
+		if len(args) > 0 && !strings.Contains(args[0], ":") {
+			var ok bool
+			if day, ok = weekdays[strings.ToLower(args[0])]; !ok {
+				return nil, errors.Errorf("invalid day %q", args[0])
+			}
+			args = args[1:]
+		}
+		if len(args) > 1 {
+			return nil, errors.New("expected @weekly [<day>] [<HH:MM>]")
+		}
+		hour, minute, err := parseTimeOfDay(args)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return schedule.Weekly(day, hour, minute, loc), nil
+	}
+	e, err := cron.ParseInLocation(spec, loc)
+	if err != nil {
+		return nil, errors.Cause(err)
+	}
+	return e, nil
+}
+
+// parseTimeOfDay parses an optional time of day, "HH:MM",
+// in 24-hour time, which defaults to midnight.
+func parseTimeOfDay(args []string) (hour, minute int, err error) {
+	if len(args) == 0 {
+		return 0, 0, nil
+	}
+	parts := strings.Split(args[0], ":")
+	if len(parts) == 2 {
+		hour, err = parseInt(parts[0], 23)
+		if err == nil {
+			minute, err = parseInt(parts[1], 59)
+		}
+	}
+	if len(parts) != 2 || err != nil {
+		return 0, 0, errors.Errorf("invalid time of day %q", args[0])
+	}
+	return hour, minute, nil
+}
+
+// parseInt parses a non-negative decimal integer no greater than max.
+func parseInt(s string, max int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > max || strings.HasPrefix(s, "+") {
+		return 0, errors.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// Every returns a Recurrence that occurs at the specified interval
+// after the time it is asked about. Since an operation's delay is
+// computed when it is rescheduled, an operation whose delay is given
+// by Every runs with a fixed delay between runs.
+func Every(interval time.Duration) schedule.Recurrence {
+	return every(interval)
+}
+
+type every time.Duration
+
+// Next is part of the schedule.Recurrence interface.
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
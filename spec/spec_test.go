@@ -0,0 +1,85 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package spec_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/scheduler"
+	"github.com/axw/juju-time/spec"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type specSuite struct{}
+
+var _ = gc.Suite(&specSuite{})
+
+// The specs' recurrences may be used as scheduler triggers.
+var _ scheduler.Trigger = spec.Every(time.Second)
+
+func (*specSuite) TestParseErrors(c *gc.C) {
+	for _, test := range []struct {
+		spec string
+		err  string
+	}{
+		{"", `parsing schedule spec "": empty spec`},
+		{"@every", `.*expected @every <duration>`},
+		{"@every 5", `.*parsing duration "5": missing unit after "5"`},
+		{"@every 1y", `.*parsing duration "1y": .*`},
+		{"@every -5m", `.*non-positive duration -5m0s`},
+		{"@hourly 15", `.*invalid minute "15"`},
+		{"@hourly :60", `.*invalid minute ":60"`},
+		{"@daily 3am", `.*invalid time of day "3am"`},
+		{"@daily 24:00", `.*invalid time of day "24:00"`},
+		{"@daily 03:00 04:00", `.*expected @daily \[<HH:MM>\]`},
+		{"@weekly someday", `.*invalid day "someday"`},
+		{"@weekly sat sun", `.*invalid time of day "sun"`},
+		{"@weekly sat 01:00 02:00", `.*expected @weekly \[<day>\] \[<HH:MM>\]`},
+		{"@fortnightly", `parsing schedule spec "@fortnightly": unknown macro "@fortnightly"`},
+		{"* * * *", `.*expected 5 or 6 fields, got 4`},
+	} {
+		c.Logf("%q", test.spec)
+		_, err := spec.Parse(test.spec, time.UTC)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*specSuite) TestNext(c *gc.C) {
+	from := time.Date(2015, 7, 15, 10, 30, 0, 0, time.UTC) // Wednesday
+	for _, test := range []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"@every 5m", time.Date(2015, 7, 15, 10, 35, 0, 0, time.UTC)},
+		{"@EVERY 1h30m", time.Date(2015, 7, 15, 12, 0, 0, 0, time.UTC)},
+		{"@every 1d", time.Date(2015, 7, 16, 10, 30, 0, 0, time.UTC)},
+		{"@every 1w12h", time.Date(2015, 7, 22, 22, 30, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2015, 7, 15, 11, 0, 0, 0, time.UTC)},
+		{"@hourly :45", time.Date(2015, 7, 15, 10, 45, 0, 0, time.UTC)},
+		{"@daily", time.Date(2015, 7, 16, 0, 0, 0, 0, time.UTC)},
+		{"@daily 03:00", time.Date(2015, 7, 16, 3, 0, 0, 0, time.UTC)},
+		{"@daily 22:15", time.Date(2015, 7, 15, 22, 15, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2015, 7, 19, 0, 0, 0, 0, time.UTC)},
+		{"@weekly Sat", time.Date(2015, 7, 18, 0, 0, 0, 0, time.UTC)},
+		{"@weekly 06:30", time.Date(2015, 7, 19, 6, 30, 0, 0, time.UTC)},
+		{"@weekly wed 22:30", time.Date(2015, 7, 15, 22, 30, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2015, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/10 * * * *", time.Date(2015, 7, 15, 10, 40, 0, 0, time.UTC)},
+	} {
+		c.Logf("%q", test.spec)
+		r, err := spec.Parse(test.spec, time.UTC)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(r.Next(from).UTC(), gc.Equals, test.expected)
+	}
+}
+
+func (*specSuite) TestLocation(c *gc.C) {
+	loc, err := time.LoadLocation("Australia/Perth")
+	c.Assert(err, jc.ErrorIsNil)
+	r, err := spec.Parse("@daily 03:00", loc)
+	c.Assert(err, jc.ErrorIsNil)
+	from := time.Date(2015, 7, 15, 0, 0, 0, 0, time.UTC) // 08:00 in Perth
+	c.Assert(r.Next(from).UTC(), gc.Equals, time.Date(2015, 7, 15, 19, 0, 0, 0, time.UTC))
+}
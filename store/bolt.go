@@ -0,0 +1,441 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// recordsBucket maps keys to encoded boltRecords.
+	recordsBucket = []byte("records")
+
+	// orderBucket maps big-endian sequence numbers to keys, so
+	// that records may be replayed in the order that they were
+	// last appended.
+	orderBucket = []byte("order")
+)
+
+// BoltConfig holds the configuration for a Bolt store.
+type BoltConfig struct {
+	// Path is the path of the database file. The file is
+	// created if it does not exist.
+	Path string
+
+	// Timeout, if positive, is the maximum time to wait to
+	// obtain the lock on the database file, which is held by
+	// at most one process at a time. If Timeout is zero,
+	// OpenBolt waits indefinitely.
+	Timeout time.Duration
+
+	// OnRecover, if non-nil, is called when OpenBolt finds that the
+	// database file is corrupt, and recovers from it. It is called
+	// with the error describing the corruption, and the number of
+	// records that were salvaged from the corrupt file.
+	OnRecover func(err error, salvaged int)
+}
+
+// Validate checks that the config is valid.
+func (config BoltConfig) Validate() error {
+	if config.Path == "" {
+		return errors.NotValidf("empty Path")
+	}
+	if config.Timeout < 0 {
+		return errors.NotValidf("negative Timeout")
+	}
+	return nil
+}
+
+// Bolt is a Store that persists records in a bbolt database. Unlike a
+// File store, a Bolt store need not be read in its entirety to make
+// changes, and each change costs the same however many records there
+// are, so it is suitable for stores holding many records.
+//
+// When a Bolt store is opened, the database is checked for consistency.
+// If it is corrupt, the corrupt file is moved aside, with the suffix
+// ".corrupt", and replaced with a new database holding whatever records
+// could be salvaged from it.
+type Bolt struct {
+	config BoltConfig
+
+	mu sync.Mutex
+	db *bolt.DB
+}
+
+// boltRecord is a record, as encoded in the records bucket.
+type boltRecord struct {
+	Seq  uint64    `json:"seq"`
+	Due  time.Time `json:"due"`
+	Data []byte    `json:"data,omitempty"`
+}
+
+// OpenBolt opens a Bolt store with the given configuration.
+func OpenBolt(config BoltConfig) (*Bolt, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating bolt store config")
+	}
+	s := &Bolt{config: config}
+	db, err := s.open(config.Path)
+	if err == nil {
+		err = check(db)
+		if err != nil {
+			db.Close()
+		}
+	}
+	if isCorrupt(err) {
+		db, err = s.recoverCorrupt(err)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "opening store")
+	}
+	s.db = db
+	return s, nil
+}
+
+func (s *Bolt) open(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: s.config.Timeout})
+	if err != nil {
+		return nil, corruptIf(err, isBoltCorrupt(err))
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(recordsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(orderBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	return db, nil
+}
+
+// corruptError records that a database is corrupt.
+type corruptError struct {
+	err error
+}
+
+func (e *corruptError) Error() string {
+	return fmt.Sprintf("database corrupt: %v", e.err)
+}
+
+func corruptIf(err error, corrupt bool) error {
+	if corrupt {
+		return &corruptError{err}
+	}
+	return errors.Trace(err)
+}
+
+func isCorrupt(err error) bool {
+	_, ok := errors.Cause(err).(*corruptError)
+	return ok
+}
+
+func isBoltCorrupt(err error) bool {
+	switch err {
+	case bolt.ErrInvalid, bolt.ErrVersionMismatch, bolt.ErrChecksum:
+		return true
+	}
+	return false
+}
+
+// check checks the consistency of the database, returning a
+// corruptError describing the first inconsistency found.
+func check(db *bolt.DB) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &corruptError{errors.Errorf("%v", v)}
+		}
+	}()
+	return db.View(func(tx *bolt.Tx) error {
+		var first error
+		for err := range tx.Check() {
+			if first == nil {
+				first = &corruptError{err}
+			}
+		}
+		return first
+	})
+}
+
+// recoverCorrupt moves the corrupt database file aside, and creates a new
+// database holding the records that can be salvaged from it.
+func (s *Bolt) recoverCorrupt(cause error) (*bolt.DB, error) {
+	corrupt := s.config.Path + ".corrupt"
+	if err := os.Rename(s.config.Path, corrupt); err != nil {
+		return nil, errors.Annotate(err, "moving corrupt database aside")
+	}
+	records := salvage(corrupt, s.config.Timeout)
+	db, err := s.open(s.config.Path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, r := range records {
+			if err := appendRecord(tx, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Annotate(err, "restoring salvaged records")
+	}
+	if s.config.OnRecover != nil {
+		s.config.OnRecover(errors.Cause(cause), len(records))
+	}
+	return db, nil
+}
+
+// salvage returns the records that can be read from the corrupt
+// database at the specified path, skipping any that cannot be decoded.
+// Reading stops at the first page that cannot be read.
+func salvage(path string, timeout time.Duration) (records []Record) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: timeout})
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+	defer func() {
+		// bbolt panics when it encounters some kinds of
+		// corrupt page; keep the records read until then.
+		recover()
+	}()
+	db.View(func(tx *bolt.Tx) error {
+		records = readRecords(tx, true)
+		return nil
+	})
+	return records
+}
+
+// Append is part of the Store interface.
+func (s *Bolt) Append(r Record) error {
+	err := s.update(func(tx *bolt.Tx) error {
+		return appendRecord(tx, r)
+	})
+	return errors.Annotate(err, "appending record")
+}
+
+// Remove is part of the Store interface.
+func (s *Bolt) Remove(key string) error {
+	err := s.update(func(tx *bolt.Tx) error {
+		return removeRecord(tx, key)
+	})
+	return errors.Annotate(err, "removing record")
+}
+
+// Snapshot is part of the Store interface. The existing records are
+// replaced within a single transaction.
+func (s *Bolt) Snapshot(records []Record) error {
+	err := s.update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{recordsBucket, orderBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		for _, r := range records {
+			if err := appendRecord(tx, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Annotate(err, "writing snapshot")
+}
+
+// Replay is part of the Store interface. The records are read in a
+// single transaction before f is called, so f may call the store's
+// methods.
+func (s *Bolt) Replay(f func(Record) error) error {
+	records, err := s.read()
+	if err != nil {
+		return errors.Annotate(err, "reading store")
+	}
+	for _, r := range records {
+		if err := f(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact rewrites the database file, reclaiming the space left by
+// removed and replaced records, which bbolt reuses but does not
+// release. The database is copied to a temporary file alongside the
+// store's file, which is then renamed over it; if Compact fails, the
+// store's contents are unchanged.
+func (s *Bolt) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return errors.New("store closed")
+	}
+	if err := s.compact(); err != nil {
+		return errors.Annotate(err, "compacting store")
+	}
+	return nil
+}
+
+// compact must be called with s.mu held.
+func (s *Bolt) compact() error {
+	tmp := s.config.Path + ".tmp"
+	os.Remove(tmp)
+	dst, err := bolt.Open(tmp, 0600, &bolt.Options{Timeout: s.config.Timeout})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := bolt.Compact(dst, s.db, 0); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return errors.Trace(err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return errors.Trace(err)
+	}
+	if err := s.db.Close(); err != nil {
+		os.Remove(tmp)
+		return errors.Trace(err)
+	}
+	renameErr := os.Rename(tmp, s.config.Path)
+	if renameErr == nil {
+		renameErr = syncDir(filepath.Dir(s.config.Path))
+	} else {
+		os.Remove(tmp)
+	}
+	// Reopen whichever file is now in place, so that the
+	// store remains usable if the rename failed.
+	db, err := s.open(s.config.Path)
+	if err != nil {
+		s.db = nil
+		return errors.Annotate(err, "reopening store")
+	}
+	s.db = db
+	return errors.Trace(renameErr)
+}
+
+// Close is part of the Store interface.
+func (s *Bolt) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return errors.Trace(err)
+}
+
+func (s *Bolt) read() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil, errors.New("store closed")
+	}
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		records = readRecords(tx, false)
+		return nil
+	})
+	return records, errors.Trace(err)
+}
+
+func (s *Bolt) update(f func(tx *bolt.Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return errors.New("store closed")
+	}
+	return errors.Trace(s.db.Update(f))
+}
+
+func appendRecord(tx *bolt.Tx, r Record) error {
+	if err := removeRecord(tx, r.Key); err != nil {
+		return err
+	}
+	order := tx.Bucket(orderBucket)
+	seq, err := order.NextSequence()
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(boltRecord{Seq: seq, Due: r.Due, Data: r.Data})
+	if err != nil {
+		return err
+	}
+	if err := order.Put(seqKey(seq), []byte(r.Key)); err != nil {
+		return err
+	}
+	return tx.Bucket(recordsBucket).Put([]byte(r.Key), value)
+}
+
+func removeRecord(tx *bolt.Tx, key string) error {
+	records := tx.Bucket(recordsBucket)
+	value := records.Get([]byte(key))
+	if value == nil {
+		return nil
+	}
+	var br boltRecord
+	if err := json.Unmarshal(value, &br); err != nil {
+		return errors.Annotatef(err, "decoding record %q", key)
+	}
+	if err := tx.Bucket(orderBucket).Delete(seqKey(br.Seq)); err != nil {
+		return err
+	}
+	return records.Delete([]byte(key))
+}
+
+// readRecords reads the records in the order that they were last
+// appended. Records that cannot be decoded are skipped.
+func readRecords(tx *bolt.Tx, salvaging bool) []Record {
+	records, order := tx.Bucket(recordsBucket), tx.Bucket(orderBucket)
+	if records == nil || order == nil {
+		return nil
+	}
+	var result []Record
+	read := func(key []byte) {
+		value := records.Get(key)
+		if value == nil {
+			return
+		}
+		var br boltRecord
+		if err := json.Unmarshal(value, &br); err != nil {
+			return
+		}
+		result = append(result, Record{Key: string(key), Due: br.Due, Data: br.Data})
+	}
+	if salvaging {
+		// The order bucket may itself be damaged, so
+		// salvage records in key order instead.
+		records.ForEach(func(key, _ []byte) error {
+			read(key)
+			return nil
+		})
+		return result
+	}
+	order.ForEach(func(_, key []byte) error {
+		read(key)
+		return nil
+	})
+	return result
+}
+
+func seqKey(seq uint64) []byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], seq)
+	return key[:]
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/axw/juju-time/store"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type boltSuite struct {
+	coretesting.BaseSuite
+	path string
+}
+
+var _ = gc.Suite(&boltSuite{})
+
+func (s *boltSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.path = filepath.Join(c.MkDir(), "store.db")
+}
+
+func (s *boltSuite) open(c *gc.C) *store.Bolt {
+	st, err := store.OpenBolt(store.BoltConfig{Path: s.path})
+	c.Assert(err, jc.ErrorIsNil)
+	return st
+}
+
+func (s *boltSuite) TestValidate(c *gc.C) {
+	_, err := store.OpenBolt(store.BoltConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating bolt store config: empty Path not valid")
+	_, err = store.OpenBolt(store.BoltConfig{Path: s.path, Timeout: -1})
+	c.Assert(err, gc.ErrorMatches, "validating bolt store config: negative Timeout not valid")
+}
+
+func (s *boltSuite) TestStore(c *gc.C) {
+	checkStore(c, s.open(c))
+}
+
+func (s *boltSuite) TestReopen(c *gc.C) {
+	a := store.Record{Key: "a", Data: []byte("A")}
+	b := store.Record{Key: "b", Data: []byte("B")}
+	st := s.open(c)
+	c.Assert(st.Append(a), jc.ErrorIsNil)
+	c.Assert(st.Append(b), jc.ErrorIsNil)
+	c.Assert(st.Append(a), jc.ErrorIsNil)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+
+	st = s.open(c)
+	defer st.Close()
+	assertRecords(c, st, b, a)
+}
+
+func (s *boltSuite) TestLocked(c *gc.C) {
+	st := s.open(c)
+	defer st.Close()
+	_, err := store.OpenBolt(store.BoltConfig{Path: s.path, Timeout: 10 * time.Millisecond})
+	c.Assert(err, gc.ErrorMatches, "opening store: timeout")
+}
+
+func (s *boltSuite) TestCompact(c *gc.C) {
+	st := s.open(c)
+	defer st.Close()
+	data := bytes.Repeat([]byte("x"), 1000)
+	for i := 0; i < 1000; i++ {
+		c.Assert(st.Append(store.Record{Key: fmt.Sprint(i), Data: data}), jc.ErrorIsNil)
+	}
+	for i := 0; i < 999; i++ {
+		c.Assert(st.Remove(fmt.Sprint(i)), jc.ErrorIsNil)
+	}
+	before, err := os.Stat(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(st.Compact(), jc.ErrorIsNil)
+	after, err := os.Stat(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(after.Size() < before.Size()/10, jc.IsTrue,
+		gc.Commentf("size before %d, after %d", before.Size(), after.Size()))
+
+	// The store remains usable after compaction.
+	assertRecords(c, st, store.Record{Key: "999", Data: data})
+	c.Assert(st.Append(store.Record{Key: "a"}), jc.ErrorIsNil)
+	assertRecords(c, st, store.Record{Key: "999", Data: data}, store.Record{Key: "a"})
+}
+
+func (s *boltSuite) TestRecoverCorrupt(c *gc.C) {
+	err := os.WriteFile(s.path, bytes.Repeat([]byte("garbage!"), 4096), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var recovered []error
+	st, err := store.OpenBolt(store.BoltConfig{
+		Path: s.path,
+		OnRecover: func(err error, salvaged int) {
+			c.Check(salvaged, gc.Equals, 0)
+			recovered = append(recovered, err)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer st.Close()
+	c.Assert(recovered, gc.HasLen, 1)
+	c.Assert(recovered[0], gc.ErrorMatches, "database corrupt: invalid database")
+
+	// The corrupt file is kept for inspection, and
+	// the store is replaced with an empty one.
+	_, err = os.Stat(s.path + ".corrupt")
+	c.Assert(err, jc.ErrorIsNil)
+	assertRecords(c, st)
+	c.Assert(st.Append(store.Record{Key: "a"}), jc.ErrorIsNil)
+	assertRecords(c, st, store.Record{Key: "a"})
+}
+
+func (s *boltSuite) TestClosed(c *gc.C) {
+	st := s.open(c)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+	c.Assert(st.Append(store.Record{Key: "a"}), gc.ErrorMatches, "appending record: store closed")
+	c.Assert(st.Compact(), gc.ErrorMatches, "store closed")
+	err := st.Replay(func(store.Record) error { return nil })
+	c.Assert(err, gc.ErrorMatches, "reading store: store closed")
+}
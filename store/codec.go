@@ -0,0 +1,302 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/jitter"
+	"github.com/axw/juju-time/schedule"
+	"github.com/juju/errors"
+)
+
+// TypedOperation is the interface that operations must implement to be
+// encoded by a Codec. The type name identifies the constructor with
+// which the operation is decoded, and so must be registered with the
+// Codec, and must not change while records of the type are persisted.
+type TypedOperation interface {
+	// OperationType returns the name with which the operation's
+	// type is registered.
+	OperationType() string
+}
+
+// OperationMarshaler may be implemented by operations that encode
+// themselves. Operations that do not implement OperationMarshaler are
+// encoded as JSON.
+type OperationMarshaler interface {
+	MarshalOperation() ([]byte, error)
+}
+
+// OperationUnmarshaler may be implemented by operations that decode
+// themselves, from the data returned by MarshalOperation. Operations
+// that do not implement OperationUnmarshaler are decoded as JSON.
+type OperationUnmarshaler interface {
+	UnmarshalOperation(data []byte) error
+}
+
+// DelayOperation may be implemented by operations that retry with a
+// schedule.DelayStrategy, so that their backoff state is persisted with
+// them, and the strategy is reconstructed, with the Codec's
+// DelayRegistry, when they are decoded.
+type DelayOperation interface {
+	// DelayState returns the operation's backoff state. If the
+	// state's Strategy is empty, no backoff state is persisted.
+	DelayState() DelayState
+
+	// RestoreDelay restores the operation's backoff state, with
+	// the persisted state and the strategy reconstructed from it.
+	RestoreDelay(state DelayState, strategy schedule.DelayStrategy) error
+}
+
+// DelayState is the persisted backoff state of an operation: the name
+// with which its delay strategy is registered, the strategy's
+// parameters and the number of attempts made.
+type DelayState struct {
+	Strategy string        `json:"strategy"`
+	Initial  time.Duration `json:"initial,omitempty"`
+	Min      time.Duration `json:"min,omitempty"`
+	Max      time.Duration `json:"max,omitempty"`
+	Factor   float64       `json:"factor,omitempty"`
+	Step     time.Duration `json:"step,omitempty"`
+	Attempts int           `json:"attempts,omitempty"`
+}
+
+// NewDelayState returns the DelayState for a strategy constructed,
+// with the specified name and parameters, by a DelayRegistry. The
+// number of attempts is taken from the strategy.
+func NewDelayState(name string, params schedule.DelayParams, strategy schedule.DelayStrategy) DelayState {
+	return DelayState{
+		Strategy: name,
+		Initial:  params.Initial,
+		Min:      params.Min,
+		Max:      params.Max,
+		Factor:   params.Factor,
+		Step:     params.Step,
+		Attempts: strategy.Attempts(),
+	}
+}
+
+// Params returns the parameters with which to reconstruct the
+// strategy, using the specified clock and source of random numbers.
+func (state DelayState) Params(clock clock.Clock, source jitter.Source) schedule.DelayParams {
+	return schedule.DelayParams{
+		Initial:  state.Initial,
+		Min:      state.Min,
+		Max:      state.Max,
+		Factor:   state.Factor,
+		Step:     state.Step,
+		Clock:    clock,
+		Source:   source,
+		Attempts: state.Attempts,
+	}
+}
+
+// CodecConfig holds the configuration for a Codec.
+type CodecConfig struct {
+	// Delays is the registry with which the delay strategies of
+	// decoded operations are reconstructed.
+	Delays *schedule.DelayRegistry
+
+	// Clock, if non-nil, is the clock used by reconstructed
+	// delay strategies.
+	Clock clock.Clock
+
+	// Source, if non-nil, is the source of random numbers used
+	// by reconstructed delay strategies.
+	Source jitter.Source
+}
+
+// Validate checks that the config is valid.
+func (config CodecConfig) Validate() error {
+	if config.Delays == nil {
+		return errors.NotValidf("nil Delays")
+	}
+	return nil
+}
+
+// Codec encodes operations as Records, and decodes them again, so that
+// every Store persists operations in the same format. Each operation is
+// encoded in an envelope holding its registered type name, its encoded
+// data and its backoff state, if any.
+//
+// Records are keyed by the operation's key, formatted with fmt.Sprint;
+// keys must therefore format uniquely.
+//
+// Codec's methods are safe for concurrent use.
+type Codec[K comparable, O schedule.Operation[K]] struct {
+	config CodecConfig
+
+	mu    sync.Mutex
+	types map[string]func() O
+}
+
+// envelope is an operation, as encoded in a Record's Data.
+type envelope struct {
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Delay *DelayState     `json:"delay,omitempty"`
+
+	// Token is the idempotency token of an operation that has
+	// been dispatched, but not acknowledged; see Dispatcher.
+	Token string `json:"token,omitempty"`
+}
+
+// NewCodec constructs a new Codec with the given configuration, and
+// no registered types.
+func NewCodec[K comparable, O schedule.Operation[K]](config CodecConfig) (*Codec[K, O], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating codec config")
+	}
+	return &Codec[K, O]{
+		config: config,
+		types:  make(map[string]func() O),
+	}, nil
+}
+
+// Register registers a constructor for operations with the specified
+// type name. The constructor returns the value into which an encoded
+// operation is decoded. Register returns an error satisfying
+// errors.IsAlreadyExists if the type name is already registered.
+func (c *Codec[K, O]) Register(typeName string, newOp func() O) error {
+	if typeName == "" {
+		return errors.NotValidf("empty type name")
+	}
+	if newOp == nil {
+		return errors.NotValidf("nil constructor")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.types[typeName]; ok {
+		return errors.AlreadyExistsf("operation type %q", typeName)
+	}
+	c.types[typeName] = newOp
+	return nil
+}
+
+func (c *Codec[K, O]) constructor(typeName string) (func() O, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	newOp, ok := c.types[typeName]
+	if !ok {
+		return nil, errors.NotFoundf("operation type %q", typeName)
+	}
+	return newOp, nil
+}
+
+// MarshalOperation encodes an operation, which is due at the specified
+// time, as a Record. The operation must implement TypedOperation, and
+// its type must be registered.
+func (c *Codec[K, O]) MarshalOperation(op O, due time.Time) (Record, error) {
+	r, err := c.marshal(op, due, "")
+	if err != nil {
+		return Record{}, errors.Annotate(err, "marshalling operation")
+	}
+	return r, nil
+}
+
+// marshal encodes an operation as a Record, along with
+// its idempotency token, if it has one.
+func (c *Codec[K, O]) marshal(op O, due time.Time, token string) (Record, error) {
+	typed, ok := any(op).(TypedOperation)
+	if !ok {
+		return Record{}, errors.NotValidf("operation type %T without OperationType", op)
+	}
+	env := envelope{Type: typed.OperationType(), Token: token}
+	if _, err := c.constructor(env.Type); err != nil {
+		return Record{}, errors.Trace(err)
+	}
+	var err error
+	if m, ok := any(op).(OperationMarshaler); ok {
+		env.Data, err = m.MarshalOperation()
+	} else {
+		env.Data, err = json.Marshal(op)
+	}
+	if err != nil {
+		return Record{}, errors.Trace(err)
+	}
+	if d, ok := any(op).(DelayOperation); ok {
+		if state := d.DelayState(); state.Strategy != "" {
+			env.Delay = &state
+		}
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return Record{}, errors.Trace(err)
+	}
+	return Record{
+		Key:  fmt.Sprint(op.Key()),
+		Due:  due,
+		Data: data,
+	}, nil
+}
+
+// UnmarshalOperation decodes an operation, and the time at which it is
+// due, from a Record encoded by MarshalOperation. If the operation was
+// persisted with backoff state, its delay strategy is reconstructed and
+// restored with DelayOperation.RestoreDelay.
+func (c *Codec[K, O]) UnmarshalOperation(r Record) (O, time.Time, error) {
+	op, _, err := c.unmarshal(r)
+	if err != nil {
+		var zero O
+		return zero, time.Time{}, errors.Annotatef(err, "unmarshalling operation %q", r.Key)
+	}
+	return op, r.Due, nil
+}
+
+// unmarshal decodes an operation from a Record, along
+// with its idempotency token, if it has one.
+func (c *Codec[K, O]) unmarshal(r Record) (O, string, error) {
+	var op O
+	var env envelope
+	if err := json.Unmarshal(r.Data, &env); err != nil {
+		return op, "", errors.Trace(err)
+	}
+	newOp, err := c.constructor(env.Type)
+	if err != nil {
+		return op, "", errors.Trace(err)
+	}
+	op = newOp()
+	if u, ok := any(op).(OperationUnmarshaler); ok {
+		err = u.UnmarshalOperation(env.Data)
+	} else if len(env.Data) > 0 {
+		err = json.Unmarshal(env.Data, &op)
+	}
+	if err != nil {
+		return op, "", errors.Trace(err)
+	}
+	if env.Delay == nil {
+		return op, env.Token, nil
+	}
+	d, ok := any(op).(DelayOperation)
+	if !ok {
+		return op, "", errors.NotValidf("delay state for operation type %T without RestoreDelay", op)
+	}
+	params := env.Delay.Params(c.config.Clock, c.config.Source)
+	strategy, err := c.config.Delays.New(env.Delay.Strategy, params)
+	if err != nil {
+		return op, "", errors.Trace(err)
+	}
+	if err := d.RestoreDelay(*env.Delay, strategy); err != nil {
+		return op, "", errors.Annotate(err, "restoring delay")
+	}
+	return op, env.Token, nil
+}
+
+// Restore replays the records in the store, calling f with each decoded
+// operation and the time at which it is due, such as to add it to a
+// schedule. If a record cannot be decoded, or f returns an error,
+// Restore stops and returns the error.
+func (c *Codec[K, O]) Restore(st Store, f func(op O, due time.Time) error) error {
+	return st.Replay(func(r Record) error {
+		op, due, err := c.UnmarshalOperation(r)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return f(op, due)
+	})
+}
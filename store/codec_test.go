@@ -0,0 +1,247 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/store"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type codecSuite struct {
+	coretesting.BaseSuite
+	codec *store.Codec[string, operation]
+}
+
+var _ = gc.Suite(&codecSuite{})
+
+func (s *codecSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	codec, err := store.NewCodec[string, operation](store.CodecConfig{
+		Delays: schedule.NewDelayRegistry(),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(codec.Register("json", func() operation { return &jsonOperation{} }), jc.ErrorIsNil)
+	c.Assert(codec.Register("text", func() operation { return &textOperation{} }), jc.ErrorIsNil)
+	s.codec = codec
+}
+
+func (s *codecSuite) TestValidate(c *gc.C) {
+	_, err := store.NewCodec[string, operation](store.CodecConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating codec config: nil Delays not valid")
+}
+
+func (s *codecSuite) TestRegister(c *gc.C) {
+	err := s.codec.Register("json", func() operation { return &jsonOperation{} })
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Assert(err, gc.ErrorMatches, `operation type "json" already exists`)
+	err = s.codec.Register("", func() operation { return &jsonOperation{} })
+	c.Assert(err, gc.ErrorMatches, "empty type name not valid")
+	err = s.codec.Register("other", nil)
+	c.Assert(err, gc.ErrorMatches, "nil constructor not valid")
+}
+
+func (s *codecSuite) TestRoundTripJSON(c *gc.C) {
+	due := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	op := &jsonOperation{ID: "a", Payload: "hello"}
+	r, err := s.codec.MarshalOperation(op, due)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(r.Key, gc.Equals, "a")
+	c.Assert(r.Due, gc.Equals, due)
+	c.Assert(string(r.Data), gc.Equals, `{"type":"json","data":{"id":"a","payload":"hello"}}`)
+
+	decoded, decodedDue, err := s.codec.UnmarshalOperation(r)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(decoded, jc.DeepEquals, op)
+	c.Assert(decodedDue, gc.Equals, due)
+}
+
+func (s *codecSuite) TestRoundTripMarshaler(c *gc.C) {
+	op := &textOperation{id: "b"}
+	r, err := s.codec.MarshalOperation(op, time.Time{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(r.Data), gc.Equals, `{"type":"text","data":"text:b"}`)
+
+	decoded, _, err := s.codec.UnmarshalOperation(r)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(decoded, jc.DeepEquals, op)
+}
+
+func (s *codecSuite) TestRoundTripDelay(c *gc.C) {
+	params := schedule.DelayParams{
+		Initial: time.Second,
+		Max:     time.Minute,
+		Factor:  2,
+	}
+	strategy, err := schedule.NewDelayRegistry().New(schedule.DelayExponential, params)
+	c.Assert(err, jc.ErrorIsNil)
+	strategy.Delay()
+	strategy.Delay()
+	op := &jsonOperation{ID: "c"}
+	op.delay = store.NewDelayState(schedule.DelayExponential, params, strategy)
+
+	r, err := s.codec.MarshalOperation(op, time.Time{})
+	c.Assert(err, jc.ErrorIsNil)
+	decoded, _, err := s.codec.UnmarshalOperation(r)
+	c.Assert(err, jc.ErrorIsNil)
+	restored := decoded.(*jsonOperation)
+	c.Assert(restored.delay, jc.DeepEquals, store.DelayState{
+		Strategy: schedule.DelayExponential,
+		Initial:  time.Second,
+		Max:      time.Minute,
+		Factor:   2,
+		Attempts: 2,
+	})
+	c.Assert(restored.strategy, gc.NotNil)
+	c.Assert(restored.strategy.Attempts(), gc.Equals, 2)
+	c.Assert(restored.strategy.Delay(), gc.Equals, strategy.Delay())
+}
+
+func (s *codecSuite) TestMarshalUnregistered(c *gc.C) {
+	_, err := s.codec.MarshalOperation(&untypedOperation{}, time.Time{})
+	c.Assert(err, gc.ErrorMatches, `marshalling operation: operation type \*store_test.untypedOperation without OperationType not valid`)
+
+	codec, err := store.NewCodec[string, operation](store.CodecConfig{
+		Delays: schedule.NewDelayRegistry(),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = codec.MarshalOperation(&jsonOperation{ID: "a"}, time.Time{})
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `marshalling operation: operation type "json" not found`)
+}
+
+func (s *codecSuite) TestUnmarshalErrors(c *gc.C) {
+	_, _, err := s.codec.UnmarshalOperation(store.Record{Key: "a", Data: []byte(`{"type":"other"}`)})
+	c.Assert(errors.Cause(err), jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `unmarshalling operation "a": operation type "other" not found`)
+
+	_, _, err = s.codec.UnmarshalOperation(store.Record{Key: "b", Data: []byte(`{"type":"text","data":"bad"}`)})
+	c.Assert(err, gc.ErrorMatches, `unmarshalling operation "b": invalid text operation "bad"`)
+
+	_, _, err = s.codec.UnmarshalOperation(store.Record{
+		Key:  "c",
+		Data: []byte(`{"type":"text","data":"text:c","delay":{"strategy":"linear"}}`),
+	})
+	c.Assert(err, gc.ErrorMatches, `unmarshalling operation "c": delay state for operation type \*store_test.textOperation without RestoreDelay not valid`)
+
+	_, _, err = s.codec.UnmarshalOperation(store.Record{
+		Key:  "d",
+		Data: []byte(`{"type":"json","data":{"id":"d"},"delay":{"strategy":"unknown"}}`),
+	})
+	c.Assert(err, gc.ErrorMatches, `unmarshalling operation "d": delay strategy "unknown" not found`)
+}
+
+func (s *codecSuite) TestRestore(c *gc.C) {
+	t0 := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	st := store.NewMemory()
+	ops := []operation{
+		&jsonOperation{ID: "a", Payload: "A"},
+		&textOperation{id: "b"},
+	}
+	for i, op := range ops {
+		r, err := s.codec.MarshalOperation(op, t0.Add(time.Duration(i)*time.Second))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(st.Append(r), jc.ErrorIsNil)
+	}
+
+	var restored []operation
+	var due []time.Time
+	err := s.codec.Restore(st, func(op operation, t time.Time) error {
+		restored = append(restored, op)
+		due = append(due, t)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(restored, jc.DeepEquals, ops)
+	c.Assert(due, jc.DeepEquals, []time.Time{t0, t0.Add(time.Second)})
+
+	err = s.codec.Restore(st, func(operation, time.Time) error {
+		return errors.New("boom")
+	})
+	c.Assert(err, gc.ErrorMatches, "boom")
+}
+
+type operation interface {
+	schedule.Operation[string]
+}
+
+// jsonOperation is encoded as JSON, with its backoff state.
+type jsonOperation struct {
+	ID      string `json:"id"`
+	Payload string `json:"payload,omitempty"`
+
+	delay    store.DelayState
+	strategy schedule.DelayStrategy
+}
+
+func (op *jsonOperation) Key() string {
+	return op.ID
+}
+
+func (op *jsonOperation) Delay() time.Duration {
+	if op.strategy == nil {
+		return 0
+	}
+	return op.strategy.Delay()
+}
+
+func (op *jsonOperation) OperationType() string {
+	return "json"
+}
+
+func (op *jsonOperation) DelayState() store.DelayState {
+	return op.delay
+}
+
+func (op *jsonOperation) RestoreDelay(state store.DelayState, strategy schedule.DelayStrategy) error {
+	op.delay = state
+	op.strategy = strategy
+	return nil
+}
+
+// textOperation encodes itself.
+type textOperation struct {
+	id string
+}
+
+func (op *textOperation) Key() string {
+	return op.id
+}
+
+func (op *textOperation) Delay() time.Duration {
+	return 0
+}
+
+func (op *textOperation) OperationType() string {
+	return "text"
+}
+
+func (op *textOperation) MarshalOperation() ([]byte, error) {
+	return []byte(`"text:` + op.id + `"`), nil
+}
+
+func (op *textOperation) UnmarshalOperation(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if !strings.HasPrefix(s, "text:") {
+		return errors.Errorf("invalid text operation %q", s)
+	}
+	op.id = strings.TrimPrefix(s, "text:")
+	return nil
+}
+
+type untypedOperation struct{}
+
+func (*untypedOperation) Key() string {
+	return ""
+}
+
+func (*untypedOperation) Delay() time.Duration {
+	return 0
+}
@@ -0,0 +1,338 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/logging"
+	"github.com/axw/juju-time/schedule"
+	"github.com/juju/errors"
+)
+
+// DispatchFunc executes an operation dispatched by a Dispatcher. The
+// token is the operation's idempotency token: it is the same for every
+// dispatch of the operation until one succeeds, including dispatches
+// after a restart, so that the function may use it to ensure that the
+// operation's effects are applied only once.
+type DispatchFunc[O any] func(ctx context.Context, op O, token string) error
+
+// DispatcherConfig holds the configuration for a Dispatcher.
+type DispatcherConfig[K comparable, O schedule.Operation[K]] struct {
+	// Schedule is the schedule from which operations are dispatched.
+	// It must be configured with an AckTimeout, and must not be used
+	// other than through the Dispatcher. Operations are dispatched
+	// again if they are neither acknowledged nor returned to the
+	// schedule within the AckTimeout, such as because the process
+	// crashed while dispatching them; see Dispatcher.
+	Schedule *schedule.Schedule[K, O]
+
+	// Store is the store in which the pending and dispatched
+	// operations are persisted.
+	Store Store
+
+	// Codec is used to encode the operations in Store.
+	Codec *Codec[K, O]
+
+	// Dispatch is called to execute each ready operation. Operations
+	// for which Dispatch returns an error are returned to the schedule,
+	// and retried after their delays.
+	Dispatch DispatchFunc[O]
+
+	// Logger, if non-nil, is used to log failures to dispatch or
+	// persist operations.
+	Logger logging.Logger
+}
+
+// Validate checks that the config is valid.
+func (config DispatcherConfig[K, O]) Validate() error {
+	if config.Schedule == nil {
+		return errors.NotValidf("nil Schedule")
+	}
+	if config.Schedule.AckTimeout() <= 0 {
+		return errors.NotValidf("Schedule without AckTimeout")
+	}
+	if config.Store == nil {
+		return errors.NotValidf("nil Store")
+	}
+	if config.Codec == nil {
+		return errors.NotValidf("nil Codec")
+	}
+	if config.Dispatch == nil {
+		return errors.NotValidf("nil Dispatch")
+	}
+	return nil
+}
+
+// Dispatcher dispatches the operations of a two-phase schedule (see
+// schedule.Config.AckTimeout), persisting them in a Store, so that each
+// operation's effects are applied exactly once across restarts:
+//   - an operation is persisted when it is added, and again, along with
+//     a newly generated idempotency token, before it is first dispatched;
+//   - the record is removed once the operation has been dispatched
+//     successfully, before the operation is acknowledged, so that an
+//     acknowledged operation is never dispatched again;
+//   - an operation that fails is persisted again for the time of its
+//     retry, keeping its token;
+//   - operations that were dispatched, but not acknowledged, before the
+//     Dispatcher stopped, such as because the process crashed, are
+//     dispatched again, with their tokens, as soon as the Dispatcher is
+//     next constructed with the same Store.
+//
+// An operation may thus be dispatched more than once, but always with
+// the same token, which the DispatchFunc must use to make its effects
+// idempotent.
+//
+// Dispatcher's methods are safe for concurrent use.
+type Dispatcher[K comparable, O schedule.Operation[K]] struct {
+	config DispatcherConfig[K, O]
+	logger logging.Logger
+
+	mu sync.Mutex
+	// tokens holds the idempotency tokens of the operations that have
+	// been dispatched but not acknowledged, and executing holds the
+	// tokens of those currently executing.
+	tokens    map[K]string
+	executing map[K]string
+	// changed is signalled when operations are added or removed,
+	// so that the loop re-evaluates the schedule.
+	changed chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher constructs a new Dispatcher with the given configuration,
+// restores the persisted operations to its schedule, and starts
+// dispatching them. Operations that were dispatched but not acknowledged
+// are scheduled to be dispatched again immediately; others are restored
+// for the times at which they were due. The Dispatcher will continue to
+// dispatch operations until it is killed.
+func NewDispatcher[K comparable, O schedule.Operation[K]](config DispatcherConfig[K, O]) (*Dispatcher[K, O], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating dispatcher config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher[K, O]{
+		config:    config,
+		logger:    logging.OrNop(config.Logger),
+		tokens:    make(map[K]string),
+		executing: make(map[K]string),
+		changed:   make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if err := d.restore(); err != nil {
+		cancel()
+		return nil, errors.Annotate(err, "restoring operations")
+	}
+	d.wg.Add(1)
+	go d.loop()
+	return d, nil
+}
+
+// restore adds the persisted operations to the schedule.
+func (d *Dispatcher[K, O]) restore() error {
+	now := d.config.Schedule.Now()
+	var restored []schedule.ScheduledOperation[O]
+	err := d.config.Store.Replay(func(r Record) error {
+		op, token, err := d.config.Codec.unmarshal(r)
+		if err != nil {
+			return errors.Annotatef(err, "unmarshalling operation %q", r.Key)
+		}
+		due := r.Due
+		if token != "" {
+			d.tokens[op.Key()] = token
+			due = now
+		}
+		restored = append(restored, schedule.ScheduledOperation[O]{Op: op, Time: due})
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return d.config.Schedule.Restore(restored)
+}
+
+// Kill stops the Dispatcher from dispatching operations, and cancels
+// the context passed to executing operations. Kill does not wait for
+// the Dispatcher to stop; use Wait for that.
+func (d *Dispatcher[K, O]) Kill() {
+	d.cancel()
+}
+
+// Wait waits for the Dispatcher to stop, and for its executing
+// operations to complete.
+func (d *Dispatcher[K, O]) Wait() error {
+	d.wg.Wait()
+	return nil
+}
+
+// Add adds the operation to the schedule, and persists it, returning
+// the time for which it is scheduled. If there already exists an
+// operation with the same key, the schedule's coalesce policy determines
+// the outcome, as for schedule.Schedule.TryAdd. An executing operation
+// with the key is superseded: it is not acknowledged when it completes,
+// and the new operation is dispatched with a new token. A pending
+// operation that has failed keeps its token.
+//
+// If the operation cannot be persisted, Add returns the error, and the
+// operation, along with any with which it was coalesced, is removed from
+// the schedule.
+func (d *Dispatcher[K, O]) Add(op O) (time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.notify()
+	key := op.Key()
+	if _, err := d.config.Schedule.TryAdd(op); err != nil {
+		return time.Time{}, errors.Trace(err)
+	}
+	if _, ok := d.executing[key]; ok {
+		delete(d.tokens, key)
+	}
+	kept, when, _ := d.config.Schedule.Get(key)
+	if err := d.persist(kept, when, d.tokens[key]); err != nil {
+		d.config.Schedule.Remove(key)
+		delete(d.tokens, key)
+		return time.Time{}, errors.Trace(err)
+	}
+	return when, nil
+}
+
+// Remove removes the pending or dispatched operation with the specified
+// key from the schedule and the store, and reports whether or not it
+// existed. An executing operation is not affected, other than that it
+// is not acknowledged when it completes.
+func (d *Dispatcher[K, O]) Remove(key K) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.notify()
+	if err := d.config.Store.Remove(fmt.Sprint(key)); err != nil {
+		return false, errors.Annotate(err, "removing operation")
+	}
+	delete(d.tokens, key)
+	_, ok := d.config.Schedule.Remove(key)
+	return ok, nil
+}
+
+// notify wakes the loop, after operations are added or removed.
+func (d *Dispatcher[K, O]) notify() {
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher[K, O]) loop() {
+	defer d.wg.Done()
+	for {
+		d.mu.Lock()
+		next := d.config.Schedule.Next()
+		d.mu.Unlock()
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-d.changed:
+		case <-next:
+		}
+		d.dispatchReady()
+	}
+}
+
+// dispatchReady dispatches the ready operations, persisting each with
+// its idempotency token before it is executed.
+func (d *Dispatcher[K, O]) dispatchReady() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.config.Schedule
+	now := s.Now()
+	for _, op := range s.Ready(now) {
+		key := op.Key()
+		if _, ok := d.executing[key]; ok {
+			// The operation outlasted its ack timeout; it is held
+			// in flight again, rather than executed concurrently.
+			continue
+		}
+		token, ok := d.tokens[key]
+		if !ok {
+			token = newToken()
+		}
+		_, deadline, _ := s.Get(key)
+		if err := d.persist(op, deadline, token); err != nil {
+			d.logger.Warningf("not dispatching operation %v: %v", key, err)
+			s.Nack(key)
+			continue
+		}
+		d.tokens[key] = token
+		d.executing[key] = token
+		d.wg.Add(1)
+		go d.execute(op, token)
+	}
+}
+
+// execute calls Dispatch with the operation, and acknowledges it, or
+// returns it to the schedule, according to the result.
+func (d *Dispatcher[K, O]) execute(op O, token string) {
+	defer d.wg.Done()
+	err := d.config.Dispatch(d.ctx, op, token)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.notify()
+	key := op.Key()
+	delete(d.executing, key)
+	if d.tokens[key] != token {
+		// The operation was removed or superseded.
+		return
+	}
+	s := d.config.Schedule
+	if err != nil {
+		d.logger.Warningf("dispatching operation %v failed, retrying: %v", key, err)
+		if !s.Nack(key) {
+			return
+		}
+		_, when, _ := s.Get(key)
+		if err := d.persist(op, when, token); err != nil {
+			d.logger.Warningf("persisting operation %v: %v", key, err)
+		}
+		return
+	}
+	// The record is removed before the operation is acknowledged. If
+	// it cannot be removed, the operation remains in flight, and will
+	// be dispatched again, with the same token, after its ack timeout.
+	if err := d.config.Store.Remove(fmt.Sprint(key)); err != nil {
+		d.logger.Warningf("removing operation %v: %v", key, err)
+		return
+	}
+	delete(d.tokens, key)
+	s.Ack(key)
+}
+
+// persist appends a record for the operation, due at the specified
+// time, with its idempotency token, if it has been dispatched.
+func (d *Dispatcher[K, O]) persist(op O, due time.Time, token string) error {
+	r, err := d.config.Codec.marshal(op, due, token)
+	if err != nil {
+		return errors.Annotate(err, "marshalling operation")
+	}
+	if err := d.config.Store.Append(r); err != nil {
+		return errors.Annotate(err, "persisting operation")
+	}
+	return nil
+}
+
+// newToken returns a new, random, idempotency token.
+func newToken() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(errors.Annotate(err, "generating token"))
+	}
+	return hex.EncodeToString(b[:])
+}
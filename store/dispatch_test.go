@@ -0,0 +1,213 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/store"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type dispatchSuite struct {
+	coretesting.BaseSuite
+	clock       *clocktesting.Clock
+	codec       *store.Codec[string, operation]
+	store       *store.Memory
+	dispatchers []*store.Dispatcher[string, operation]
+}
+
+var _ = gc.Suite(&dispatchSuite{})
+
+func (s *dispatchSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = clocktesting.NewClock(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	codec, err := store.NewCodec[string, operation](store.CodecConfig{
+		Delays: schedule.NewDelayRegistry(),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(codec.Register("json", func() operation { return &jsonOperation{} }), jc.ErrorIsNil)
+	s.codec = codec
+	s.store = store.NewMemory()
+	s.dispatchers = nil
+}
+
+func (s *dispatchSuite) TearDownTest(c *gc.C) {
+	for _, d := range s.dispatchers {
+		d.Kill()
+		c.Check(d.Wait(), jc.ErrorIsNil)
+	}
+	s.BaseSuite.TearDownTest(c)
+}
+
+// dispatched records a call to a DispatchFunc.
+type dispatched struct {
+	id    string
+	token string
+}
+
+// newDispatcher starts a Dispatcher for a new schedule and the
+// specified store, whose DispatchFunc sends each call on the returned
+// channel, and then returns the result of f.
+func (s *dispatchSuite) newDispatcher(c *gc.C, st store.Store, f func(ctx context.Context) error) (*store.Dispatcher[string, operation], <-chan dispatched) {
+	sched, err := schedule.New(schedule.Config[string, operation]{
+		Clock:      s.clock,
+		AckTimeout: time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	calls := make(chan dispatched, 10)
+	d, err := store.NewDispatcher(store.DispatcherConfig[string, operation]{
+		Schedule: sched,
+		Store:    st,
+		Codec:    s.codec,
+		Dispatch: func(ctx context.Context, op operation, token string) error {
+			calls <- dispatched{op.Key(), token}
+			return f(ctx)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.dispatchers = append(s.dispatchers, d)
+	return d, calls
+}
+
+// records returns the keys of the records in the store.
+func (s *dispatchSuite) records(c *gc.C, st store.Store) map[string]bool {
+	keys := make(map[string]bool)
+	err := st.Replay(func(r store.Record) error {
+		keys[r.Key] = true
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return keys
+}
+
+func (s *dispatchSuite) waitRecords(c *gc.C, st store.Store, expect map[string]bool) {
+	timeout := time.After(coretesting.LongWait)
+	for {
+		records := s.records(c, st)
+		if len(records) == len(expect) {
+			c.Assert(records, jc.DeepEquals, expect)
+			return
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for records %v, have %v", expect, records)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *dispatchSuite) TestValidate(c *gc.C) {
+	sched := schedule.NewSchedule[string, operation](s.clock)
+	_, err := store.NewDispatcher(store.DispatcherConfig[string, operation]{})
+	c.Assert(err, gc.ErrorMatches, "validating dispatcher config: nil Schedule not valid")
+	_, err = store.NewDispatcher(store.DispatcherConfig[string, operation]{Schedule: sched})
+	c.Assert(err, gc.ErrorMatches, "validating dispatcher config: Schedule without AckTimeout not valid")
+}
+
+func (s *dispatchSuite) TestAcknowledged(c *gc.C) {
+	d, calls := s.newDispatcher(c, s.store, func(context.Context) error { return nil })
+	_, err := d.Add(&jsonOperation{ID: "a"})
+	c.Assert(err, jc.ErrorIsNil)
+	call := receive(c, calls)
+	c.Assert(call.id, gc.Equals, "a")
+	c.Assert(call.token, gc.Not(gc.Equals), "")
+	s.waitRecords(c, s.store, map[string]bool{})
+	d.Kill()
+	c.Assert(d.Wait(), jc.ErrorIsNil)
+
+	// Acknowledged operations are not dispatched after a restart.
+	_, calls = s.newDispatcher(c, s.store, func(context.Context) error { return nil })
+	assertNotReceived(c, calls)
+}
+
+func (s *dispatchSuite) TestRetryKeepsToken(c *gc.C) {
+	var n int
+	d, calls := s.newDispatcher(c, s.store, func(context.Context) error {
+		n++
+		if n == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	_, err := d.Add(&jsonOperation{ID: "a"})
+	c.Assert(err, jc.ErrorIsNil)
+	first := receive(c, calls)
+	second := receive(c, calls)
+	c.Assert(second, gc.Equals, first)
+	s.waitRecords(c, s.store, map[string]bool{})
+
+	// Once acknowledged, an operation added again has a new token.
+	_, err = d.Add(&jsonOperation{ID: "a"})
+	c.Assert(err, jc.ErrorIsNil)
+	third := receive(c, calls)
+	c.Assert(third.token, gc.Not(gc.Equals), first.token)
+}
+
+func (s *dispatchSuite) TestRedispatchAfterCrash(c *gc.C) {
+	release := make(chan struct{})
+	defer close(release)
+	d, calls := s.newDispatcher(c, s.store, func(context.Context) error {
+		<-release
+		return nil
+	})
+	_, err := d.Add(&jsonOperation{ID: "a"})
+	c.Assert(err, jc.ErrorIsNil)
+	first := receive(c, calls)
+
+	// The process crashes while the operation is executing, leaving
+	// the store as it was; the operation is dispatched again after
+	// the restart, with the same token.
+	crashed := store.NewMemory()
+	err = s.store.Replay(crashed.Append)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.records(c, crashed), jc.DeepEquals, map[string]bool{"a": true})
+	_, calls = s.newDispatcher(c, crashed, func(context.Context) error { return nil })
+	c.Assert(receive(c, calls), gc.Equals, first)
+	s.waitRecords(c, crashed, map[string]bool{})
+}
+
+func (s *dispatchSuite) TestRestorePending(c *gc.C) {
+	for i, id := range []string{"a", "b"} {
+		r, err := s.codec.MarshalOperation(&jsonOperation{ID: id}, s.clock.Now().Add(time.Duration(i)*time.Hour))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(s.store.Append(r), jc.ErrorIsNil)
+	}
+	d, calls := s.newDispatcher(c, s.store, func(context.Context) error { return nil })
+
+	// Operations that were not dispatched are restored for their times.
+	call := receive(c, calls)
+	c.Assert(call.id, gc.Equals, "a")
+	assertNotReceived(c, calls)
+	s.waitRecords(c, s.store, map[string]bool{"b": true})
+
+	removed, err := d.Remove("b")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(removed, jc.IsTrue)
+	c.Assert(s.records(c, s.store), jc.DeepEquals, map[string]bool{})
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotReceived[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected value %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
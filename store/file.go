@@ -0,0 +1,243 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// FileConfig holds the configuration for a File store.
+type FileConfig struct {
+	// Path is the path of the file in which records are stored.
+	// The file is created if it does not exist.
+	Path string
+
+	// Sync, if true, causes the file to be synced to stable
+	// storage after each change, so that acknowledged changes
+	// survive a crash of the host, not just of the process.
+	Sync bool
+}
+
+// Validate checks that the config is valid.
+func (config FileConfig) Validate() error {
+	if config.Path == "" {
+		return errors.NotValidf("empty Path")
+	}
+	return nil
+}
+
+// File is a Store that persists records in a file. Changes are appended
+// to the file as they are made, one JSON-encoded entry per line, and the
+// file is rewritten atomically, by writing a temporary file and renaming
+// it into place, when a snapshot is taken. Consumers should take
+// snapshots periodically to bound the size of the file.
+//
+// If the process is interrupted while appending an entry, the incomplete
+// entry is discarded when the file is next opened.
+type File struct {
+	config FileConfig
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// entry is a change to the records, as encoded in the file.
+type entry struct {
+	Op     string `json:"op"`
+	Record Record `json:"record"`
+}
+
+const (
+	opAppend = "append"
+	opRemove = "remove"
+)
+
+// OpenFile opens a File store with the given configuration.
+func OpenFile(config FileConfig) (*File, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating file store config")
+	}
+	f, err := os.OpenFile(config.Path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Annotate(err, "opening store")
+	}
+	if err := truncateIncomplete(f); err != nil {
+		f.Close()
+		return nil, errors.Annotate(err, "opening store")
+	}
+	return &File{config: config, f: f}, nil
+}
+
+// truncateIncomplete truncates the file after its last complete line,
+// and leaves the file offset at the end of the file.
+func truncateIncomplete(f *os.File) error {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	n := bytes.LastIndexByte(data, '\n') + 1
+	if n < len(data) {
+		if err := f.Truncate(int64(n)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	_, err = f.Seek(int64(n), io.SeekStart)
+	return errors.Trace(err)
+}
+
+// Append is part of the Store interface.
+func (s *File) Append(r Record) error {
+	return errors.Annotate(s.write(entry{Op: opAppend, Record: r}), "appending record")
+}
+
+// Remove is part of the Store interface.
+func (s *File) Remove(key string) error {
+	return errors.Annotate(s.write(entry{Op: opRemove, Record: Record{Key: key}}), "removing record")
+}
+
+func (s *File) write(e entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return errors.New("store closed")
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return errors.Trace(err)
+	}
+	if s.config.Sync {
+		return errors.Trace(s.f.Sync())
+	}
+	return nil
+}
+
+// Snapshot is part of the Store interface. The records are written to
+// a temporary file alongside the store's file, which is then renamed
+// over it; if Snapshot fails, the store's contents are unchanged.
+func (s *File) Snapshot(records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return errors.New("store closed")
+	}
+	f, err := s.rewrite(records)
+	if err != nil {
+		return errors.Annotate(err, "writing snapshot")
+	}
+	s.f.Close()
+	s.f = f
+	return nil
+}
+
+// rewrite atomically replaces the store's file with one holding the
+// specified records, and returns the new file, opened for appending.
+// rewrite must be called with s.mu held.
+func (s *File) rewrite(records []Record) (_ *os.File, err error) {
+	tmp := s.config.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(entry{Op: opAppend, Record: r}); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := os.Rename(tmp, s.config.Path); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := syncDir(filepath.Dir(s.config.Path)); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return f, nil
+}
+
+// syncDir syncs the directory, so that a rename within
+// it is persisted to stable storage.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Replay is part of the Store interface. The records are read from
+// the file before f is called, so f may call the store's methods.
+func (s *File) Replay(f func(Record) error) error {
+	state, err := s.read()
+	if err != nil {
+		return errors.Annotate(err, "reading store")
+	}
+	return state.replay(f)
+}
+
+func (s *File) read() (*state, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil, errors.New("store closed")
+	}
+	data, err := os.ReadFile(s.config.Path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	state := newState()
+	for i, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, errors.Annotatef(err, "line %d", i+1)
+		}
+		switch e.Op {
+		case opAppend:
+			state.append(e.Record)
+		case opRemove:
+			state.remove(e.Record.Key)
+		default:
+			return nil, errors.Errorf("line %d: unknown op %q", i+1, e.Op)
+		}
+	}
+	return state, nil
+}
+
+// Close is part of the Store interface.
+func (s *File) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return errors.Trace(err)
+}
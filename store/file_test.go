@@ -0,0 +1,118 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/axw/juju-time/store"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type fileSuite struct {
+	coretesting.BaseSuite
+	path string
+}
+
+var _ = gc.Suite(&fileSuite{})
+
+func (s *fileSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.path = filepath.Join(c.MkDir(), "store")
+}
+
+func (s *fileSuite) open(c *gc.C) *store.File {
+	st, err := store.OpenFile(store.FileConfig{Path: s.path, Sync: true})
+	c.Assert(err, jc.ErrorIsNil)
+	return st
+}
+
+func (s *fileSuite) TestValidate(c *gc.C) {
+	_, err := store.OpenFile(store.FileConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating file store config: empty Path not valid")
+}
+
+func (s *fileSuite) TestStore(c *gc.C) {
+	checkStore(c, s.open(c))
+}
+
+func (s *fileSuite) TestReopen(c *gc.C) {
+	a := store.Record{Key: "a", Data: []byte("A")}
+	b := store.Record{Key: "b", Data: []byte("B")}
+	st := s.open(c)
+	c.Assert(st.Append(a), jc.ErrorIsNil)
+	c.Assert(st.Append(b), jc.ErrorIsNil)
+	c.Assert(st.Remove("a"), jc.ErrorIsNil)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+
+	st = s.open(c)
+	defer st.Close()
+	assertRecords(c, st, b)
+}
+
+func (s *fileSuite) TestSnapshotRewrites(c *gc.C) {
+	st := s.open(c)
+	defer st.Close()
+	for i := 0; i < 10; i++ {
+		c.Assert(st.Append(store.Record{Key: "a"}), jc.ErrorIsNil)
+	}
+	before, err := os.Stat(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(st.Snapshot([]store.Record{{Key: "a"}}), jc.ErrorIsNil)
+	after, err := os.Stat(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(after.Size()*10, gc.Equals, before.Size())
+	_, err = os.Stat(s.path + ".tmp")
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+
+	// Appends following a snapshot go to the new file.
+	c.Assert(st.Append(store.Record{Key: "b"}), jc.ErrorIsNil)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+	st = s.open(c)
+	assertRecords(c, st, store.Record{Key: "a"}, store.Record{Key: "b"})
+}
+
+func (s *fileSuite) TestIncompleteEntry(c *gc.C) {
+	st := s.open(c)
+	c.Assert(st.Append(store.Record{Key: "a"}), jc.ErrorIsNil)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+
+	// Simulate an interrupted append; the incomplete
+	// entry is discarded when the store is opened.
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = f.WriteString(`{"op":"append","rec`)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(f.Close(), jc.ErrorIsNil)
+
+	st = s.open(c)
+	defer st.Close()
+	assertRecords(c, st, store.Record{Key: "a"})
+	c.Assert(st.Append(store.Record{Key: "b"}), jc.ErrorIsNil)
+	assertRecords(c, st, store.Record{Key: "a"}, store.Record{Key: "b"})
+}
+
+func (s *fileSuite) TestCorrupt(c *gc.C) {
+	err := os.WriteFile(s.path, []byte(`{"op":"append","record":{"key":"a"}}`+"\n"+`{"op":"frob"}`+"\n"), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	st := s.open(c)
+	defer st.Close()
+	err = st.Replay(func(store.Record) error { return nil })
+	c.Assert(err, gc.ErrorMatches, `reading store: line 2: unknown op "frob"`)
+}
+
+func (s *fileSuite) TestClosed(c *gc.C) {
+	st := s.open(c)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+	c.Assert(st.Append(store.Record{Key: "a"}), gc.ErrorMatches, "appending record: store closed")
+	c.Assert(st.Remove("a"), gc.ErrorMatches, "removing record: store closed")
+	c.Assert(st.Snapshot(nil), gc.ErrorMatches, "store closed")
+	err := st.Replay(func(store.Record) error { return nil })
+	c.Assert(err, gc.ErrorMatches, "reading store: store closed")
+}
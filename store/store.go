@@ -0,0 +1,149 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package store provides persistence for pending operations and jobs,
+// so that schedules may be restored after a restart. A Codec encodes
+// operations as Records, in a format shared by all Store implementations,
+// and a Dispatcher combines a Store with a two-phase schedule, so that
+// operations are dispatched exactly once across restarts.
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// Record is a persisted operation or job.
+type Record struct {
+	// Key uniquely identifies the record within a store.
+	Key string `json:"key"`
+
+	// Due is the time at which the operation is due, if any.
+	Due time.Time `json:"due"`
+
+	// Data holds the encoded operation, in a format chosen
+	// by the consumer.
+	Data []byte `json:"data,omitempty"`
+}
+
+// Store is the interface for persisting records.
+//
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Append persists a record, replacing any existing
+	// record with the same key.
+	Append(r Record) error
+
+	// Remove removes the record with the specified key. Removing
+	// a record that does not exist is not an error.
+	Remove(key string) error
+
+	// Snapshot replaces the entire contents of the store with the
+	// specified records, atomically.
+	Snapshot(records []Record) error
+
+	// Replay calls f with each persisted record, in the order that
+	// the records were last appended. If f returns an error, Replay
+	// stops and returns that error.
+	Replay(f func(Record) error) error
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// state holds the records in a store, in the order
+// that they were last appended.
+type state struct {
+	records []Record
+	index   map[string]int
+}
+
+func newState() *state {
+	return &state{index: make(map[string]int)}
+}
+
+func (s *state) append(r Record) {
+	s.remove(r.Key)
+	s.index[r.Key] = len(s.records)
+	s.records = append(s.records, r)
+}
+
+func (s *state) remove(key string) {
+	i, ok := s.index[key]
+	if !ok {
+		return
+	}
+	delete(s.index, key)
+	copy(s.records[i:], s.records[i+1:])
+	s.records = s.records[:len(s.records)-1]
+	for ; i < len(s.records); i++ {
+		s.index[s.records[i].Key] = i
+	}
+}
+
+func (s *state) replay(f func(Record) error) error {
+	for _, r := range s.records {
+		if err := f(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Memory is a Store that holds records in memory, for use in tests
+// and by consumers that do not need records to survive a restart.
+type Memory struct {
+	mu    sync.Mutex
+	state *state
+}
+
+// NewMemory returns a new, empty, Memory store.
+func NewMemory() *Memory {
+	return &Memory{state: newState()}
+}
+
+// Append is part of the Store interface.
+func (m *Memory) Append(r Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.append(r)
+	return nil
+}
+
+// Remove is part of the Store interface.
+func (m *Memory) Remove(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.remove(key)
+	return nil
+}
+
+// Snapshot is part of the Store interface.
+func (m *Memory) Snapshot(records []Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = newState()
+	for _, r := range records {
+		m.state.append(r)
+	}
+	return nil
+}
+
+// Replay is part of the Store interface. f is called with a copy of
+// the records, so it may call the store's methods.
+func (m *Memory) Replay(f func(Record) error) error {
+	m.mu.Lock()
+	records := append([]Record(nil), m.state.records...)
+	m.mu.Unlock()
+	for _, r := range records {
+		if err := f(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close is part of the Store interface.
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package store_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/store"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type memorySuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&memorySuite{})
+
+func (s *memorySuite) TestStore(c *gc.C) {
+	checkStore(c, store.NewMemory())
+}
+
+// checkStore checks the behaviour common to all Store
+// implementations, starting with an empty store.
+func checkStore(c *gc.C, st store.Store) {
+	t0 := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	assertRecords(c, st)
+
+	a := store.Record{Key: "a", Due: t0, Data: []byte("A")}
+	b := store.Record{Key: "b", Due: t0.Add(time.Second)}
+	c.Assert(st.Append(a), jc.ErrorIsNil)
+	c.Assert(st.Append(b), jc.ErrorIsNil)
+	assertRecords(c, st, a, b)
+
+	// Appending a record with an existing key replaces
+	// the record, and moves it to the end.
+	a.Data = []byte("A2")
+	c.Assert(st.Append(a), jc.ErrorIsNil)
+	assertRecords(c, st, b, a)
+
+	c.Assert(st.Remove("b"), jc.ErrorIsNil)
+	c.Assert(st.Remove("z"), jc.ErrorIsNil)
+	assertRecords(c, st, a)
+
+	x := store.Record{Key: "x", Data: []byte("X")}
+	y := store.Record{Key: "y", Due: t0}
+	c.Assert(st.Snapshot([]store.Record{x, y}), jc.ErrorIsNil)
+	assertRecords(c, st, x, y)
+	c.Assert(st.Append(a), jc.ErrorIsNil)
+	assertRecords(c, st, x, y, a)
+
+	// Replay stops at the first error.
+	var n int
+	err := st.Replay(func(store.Record) error {
+		n++
+		return errors.New("boom")
+	})
+	c.Assert(err, gc.ErrorMatches, "boom")
+	c.Assert(n, gc.Equals, 1)
+
+	c.Assert(st.Close(), jc.ErrorIsNil)
+}
+
+func assertRecords(c *gc.C, st store.Store, expect ...store.Record) {
+	var records []store.Record
+	err := st.Replay(func(r store.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(records, jc.DeepEquals, expect)
+}
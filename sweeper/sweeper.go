@@ -0,0 +1,248 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package sweeper provides a Sweeper, which periodically evicts the
+// entries of a collection, such as a cache, that have not been used
+// within a time-to-live, so that each such collection need not run a
+// janitor goroutine of its own.
+package sweeper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/logging"
+	"github.com/axw/juju-time/schedule"
+	"github.com/juju/errors"
+)
+
+// Entries is the interface to a collection swept by a Sweeper.
+type Entries[K comparable] interface {
+	// Range calls f with the key of each entry in the collection,
+	// and the time at which the entry was last used, until f
+	// returns false.
+	Range(f func(key K, lastUsed time.Time) bool)
+
+	// Evict removes the entries with the specified keys, and
+	// returns the number removed. An entry may have been used
+	// since it was enumerated by Range; Evict must not remove
+	// entries used after the cutoff time.
+	Evict(keys []K, cutoff time.Time) int
+}
+
+// Config holds the configuration for a Sweeper.
+type Config[K comparable] struct {
+	// Clock is used to schedule sweeps, and to determine
+	// which entries have expired.
+	Clock clock.Clock
+
+	// Entries is the collection to sweep.
+	Entries Entries[K]
+
+	// TTL is how long an entry may go unused before
+	// it is evicted.
+	TTL time.Duration
+
+	// Interval is the time between the end of one sweep and the
+	// start of the next. If Interval is zero, TTL is used.
+	Interval time.Duration
+
+	// BatchSize, if positive, is the maximum number of entries
+	// passed to each call to Entries.Evict during a sweep.
+	BatchSize int
+
+	// BatchInterval is the time to wait between consecutive
+	// batches of a sweep, so that a large sweep does not hold up
+	// other users of the collection.
+	BatchInterval time.Duration
+
+	// Logger, if non-nil, is used to log the results of sweeps
+	// at debug level.
+	Logger logging.Logger
+}
+
+// Validate checks that the config is valid.
+func (config Config[K]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Entries == nil {
+		return errors.NotValidf("nil Entries")
+	}
+	if config.TTL <= 0 {
+		return errors.NotValidf("non-positive TTL")
+	}
+	if config.Interval < 0 {
+		return errors.NotValidf("negative Interval")
+	}
+	if config.BatchSize < 0 {
+		return errors.NotValidf("negative BatchSize")
+	}
+	if config.BatchInterval < 0 {
+		return errors.NotValidf("negative BatchInterval")
+	}
+	return nil
+}
+
+// Stats holds the statistics of a Sweeper.
+type Stats struct {
+	// Sweeps is the number of sweeps completed.
+	Sweeps int
+
+	// Evicted is the total number of entries evicted.
+	Evicted int
+
+	// LastSweep is the time at which the last
+	// completed sweep started.
+	LastSweep time.Time
+}
+
+// Sweeper periodically evicts the entries of a collection that have not
+// been used within the TTL. Sweeps are executed by a schedule.Runner,
+// each starting Interval after the previous one ended. The entries
+// expired at the start of a sweep are evicted in batches, paced by the
+// configured BatchInterval.
+//
+// Sweeper's methods are safe for concurrent use.
+type Sweeper[K comparable] struct {
+	config Config[K]
+	logger logging.Logger
+	runner *schedule.Runner[string, *sweep[K]]
+
+	// sweeping is held while sweeping, so
+	// that sweeps do not run concurrently.
+	sweeping sync.Mutex
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// New constructs and starts a new Sweeper with the given configuration.
+// The first sweep starts Interval after the Sweeper is constructed. The
+// Sweeper will continue to sweep until it is killed.
+func New[K comparable](config Config[K]) (*Sweeper[K], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating sweeper config")
+	}
+	if config.Interval == 0 {
+		config.Interval = config.TTL
+	}
+	s, err := schedule.New(schedule.Config[string, *sweep[K]]{Clock: config.Clock})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	runner, err := schedule.NewRunner(schedule.RunnerConfig[string, *sweep[K]]{
+		Schedule: s,
+		Logger:   config.Logger,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	sw := &Sweeper[K]{
+		config: config,
+		logger: logging.OrNop(config.Logger),
+		runner: runner,
+	}
+	runner.Add(&sweep[K]{sweeper: sw})
+	return sw, nil
+}
+
+// Kill stops the Sweeper, interrupting any sweep in progress between
+// batches. Kill does not wait for the Sweeper to stop; use Wait for
+// that.
+func (s *Sweeper[K]) Kill() {
+	s.runner.Kill()
+}
+
+// Wait waits for the Sweeper to stop.
+func (s *Sweeper[K]) Wait() error {
+	return s.runner.Wait()
+}
+
+// Stats returns the Sweeper's statistics.
+func (s *Sweeper[K]) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Sweep sweeps the collection immediately, waiting for any sweep in
+// progress to finish first, and returns the number of entries evicted.
+// If the context is cancelled between batches, Sweep returns the number
+// evicted so far, and the context's error. Sweep does not affect when
+// the next periodic sweep starts.
+func (s *Sweeper[K]) Sweep(ctx context.Context) (int, error) {
+	s.sweeping.Lock()
+	defer s.sweeping.Unlock()
+	start := s.config.Clock.Now()
+	cutoff := start.Add(-s.config.TTL)
+	var expired []K
+	s.config.Entries.Range(func(key K, lastUsed time.Time) bool {
+		if !lastUsed.After(cutoff) {
+			expired = append(expired, key)
+		}
+		return true
+	})
+
+	evicted := 0
+	for len(expired) > 0 {
+		batch := expired
+		if s.config.BatchSize > 0 && len(batch) > s.config.BatchSize {
+			batch = batch[:s.config.BatchSize]
+		}
+		expired = expired[len(batch):]
+		evicted += s.config.Entries.Evict(batch, cutoff)
+		if len(expired) == 0 || s.config.BatchInterval == 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			s.record(start, evicted, false)
+			return evicted, ctx.Err()
+		case <-s.config.Clock.After(s.config.BatchInterval):
+		}
+	}
+	s.record(start, evicted, true)
+	s.logger.Debugf("evicted %d entries unused since %v", evicted, cutoff)
+	return evicted, nil
+}
+
+// record records the results of a sweep that started at the specified
+// time, and evicted the specified number of entries.
+func (s *Sweeper[K]) record(start time.Time, evicted int, completed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Evicted += evicted
+	if completed {
+		s.stats.Sweeps++
+		s.stats.LastSweep = start
+	}
+}
+
+// sweep is the operation that periodically sweeps the collection.
+type sweep[K comparable] struct {
+	sweeper *Sweeper[K]
+}
+
+// Key is part of the schedule.Operation interface.
+func (op *sweep[K]) Key() string {
+	return "sweep"
+}
+
+// Delay is part of the schedule.Operation interface.
+func (op *sweep[K]) Delay() time.Duration {
+	return op.sweeper.config.Interval
+}
+
+// Do is part of the schedule.RunnableOperation interface. Following
+// a completed sweep, the next is scheduled; if the sweep is interrupted,
+// the Runner reschedules it.
+func (op *sweep[K]) Do(ctx context.Context) error {
+	if _, err := op.sweeper.Sweep(ctx); err != nil {
+		return errors.Annotate(err, "sweeping")
+	}
+	op.sweeper.runner.Add(op)
+	return nil
+}
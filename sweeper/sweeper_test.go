@@ -0,0 +1,253 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package sweeper_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/sweeper"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type sweeperSuite struct {
+	coretesting.BaseSuite
+	clock   *clocktesting.Clock
+	harness *clocktesting.Harness
+	entries *entries
+}
+
+var _ = gc.Suite(&sweeperSuite{})
+
+func (s *sweeperSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = clocktesting.NewClock(time.Time{})
+	s.harness = clocktesting.NewHarness(s.clock)
+	s.entries = &entries{used: make(map[string]time.Time)}
+}
+
+func (s *sweeperSuite) newSweeper(c *gc.C, config sweeper.Config[string]) *sweeper.Sweeper[string] {
+	config.Clock = s.clock
+	config.Entries = s.entries
+	if config.TTL == 0 {
+		config.TTL = time.Minute
+	}
+	sw, err := sweeper.New(config)
+	c.Assert(err, jc.ErrorIsNil)
+	s.harness.Settle(c)
+	return sw
+}
+
+// stop kills the sweeper, and waits for it to stop.
+func (s *sweeperSuite) stop(c *gc.C, sw *sweeper.Sweeper[string]) {
+	sw.Kill()
+	c.Check(sw.Wait(), jc.ErrorIsNil)
+	s.harness.AssertNoLeaks(c)
+}
+
+func (s *sweeperSuite) TestValidate(c *gc.C) {
+	for _, test := range []struct {
+		config sweeper.Config[string]
+		err    string
+	}{
+		{sweeper.Config[string]{}, "nil Clock not valid"},
+		{sweeper.Config[string]{Clock: s.clock}, "nil Entries not valid"},
+		{sweeper.Config[string]{Clock: s.clock, Entries: s.entries}, "non-positive TTL not valid"},
+		{sweeper.Config[string]{Clock: s.clock, Entries: s.entries, TTL: 1, Interval: -1}, "negative Interval not valid"},
+		{sweeper.Config[string]{Clock: s.clock, Entries: s.entries, TTL: 1, BatchSize: -1}, "negative BatchSize not valid"},
+		{sweeper.Config[string]{Clock: s.clock, Entries: s.entries, TTL: 1, BatchInterval: -1}, "negative BatchInterval not valid"},
+	} {
+		_, err := sweeper.New(test.config)
+		c.Check(err, gc.ErrorMatches, "validating sweeper config: "+test.err)
+	}
+}
+
+func (s *sweeperSuite) TestPeriodicSweep(c *gc.C) {
+	s.entries.use("a", s.clock.Now())
+	s.entries.use("b", s.clock.Now().Add(30*time.Second))
+	sw := s.newSweeper(c, sweeper.Config[string]{})
+	defer s.stop(c, sw)
+
+	// The first sweep starts after the interval,
+	// which defaults to the TTL.
+	s.harness.AdvanceAndSettle(c, 59*time.Second)
+	c.Assert(s.entries.keys(), jc.DeepEquals, []string{"a", "b"})
+	s.harness.AdvanceAndSettle(c, time.Second)
+	c.Assert(s.entries.keys(), jc.DeepEquals, []string{"b"})
+	c.Assert(sw.Stats(), jc.DeepEquals, sweeper.Stats{
+		Sweeps:    1,
+		Evicted:   1,
+		LastSweep: s.clock.Now(),
+	})
+
+	s.entries.use("b", s.clock.Now())
+	s.harness.AdvanceAndSettle(c, time.Minute)
+	c.Assert(s.entries.keys(), jc.DeepEquals, []string{})
+	c.Assert(sw.Stats().Sweeps, gc.Equals, 2)
+	c.Assert(sw.Stats().Evicted, gc.Equals, 2)
+}
+
+func (s *sweeperSuite) TestBatches(c *gc.C) {
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		s.entries.use(key, s.clock.Now())
+	}
+	sw := s.newSweeper(c, sweeper.Config[string]{
+		Interval:      time.Hour,
+		BatchSize:     2,
+		BatchInterval: time.Second,
+	})
+	defer s.stop(c, sw)
+
+	s.harness.AdvanceAndSettle(c, time.Hour)
+	c.Assert(s.entries.batches(), jc.DeepEquals, []int{2})
+	s.harness.AdvanceAndSettle(c, time.Second)
+	c.Assert(s.entries.batches(), jc.DeepEquals, []int{2, 2})
+	c.Assert(sw.Stats().Sweeps, gc.Equals, 0)
+	s.harness.AdvanceAndSettle(c, time.Second)
+	c.Assert(s.entries.batches(), jc.DeepEquals, []int{2, 2, 1})
+	c.Assert(sw.Stats().Sweeps, gc.Equals, 1)
+	c.Assert(sw.Stats().Evicted, gc.Equals, 5)
+
+	// The next sweep starts an interval after the last one ended.
+	clocktesting.ExpectTimer(c, s.clock, time.Hour)
+}
+
+func (s *sweeperSuite) TestEvictRespectsCutoff(c *gc.C) {
+	s.entries.use("a", s.clock.Now())
+	s.entries.use("b", s.clock.Now())
+	sw := s.newSweeper(c, sweeper.Config[string]{
+		Interval:      time.Hour,
+		BatchSize:     1,
+		BatchInterval: time.Second,
+	})
+	defer s.stop(c, sw)
+
+	s.harness.AdvanceAndSettle(c, time.Hour)
+	remaining := s.entries.keys()
+	c.Assert(remaining, gc.HasLen, 1)
+
+	// An entry used since the sweep started is not evicted.
+	s.entries.use(remaining[0], s.clock.Now())
+	s.harness.AdvanceAndSettle(c, time.Second)
+	c.Assert(s.entries.keys(), jc.DeepEquals, remaining)
+	c.Assert(sw.Stats().Evicted, gc.Equals, 1)
+}
+
+func (s *sweeperSuite) TestSweep(c *gc.C) {
+	s.entries.use("a", s.clock.Now())
+	sw := s.newSweeper(c, sweeper.Config[string]{Interval: time.Hour})
+	defer s.stop(c, sw)
+
+	n, err := sw.Sweep(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(n, gc.Equals, 0)
+	s.clock.Advance(time.Minute)
+	n, err = sw.Sweep(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(n, gc.Equals, 1)
+	c.Assert(sw.Stats().Sweeps, gc.Equals, 2)
+
+	// The periodic sweep is unaffected.
+	clocktesting.ExpectTimer(c, s.clock, 59*time.Minute)
+}
+
+func (s *sweeperSuite) TestSweepContextDone(c *gc.C) {
+	for _, key := range []string{"a", "b"} {
+		s.entries.use(key, s.clock.Now())
+	}
+	sw := s.newSweeper(c, sweeper.Config[string]{
+		Interval:      time.Hour,
+		BatchSize:     1,
+		BatchInterval: time.Second,
+	})
+	defer s.stop(c, sw)
+
+	s.clock.Advance(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := sw.Sweep(ctx)
+		done <- result{n, err}
+	}()
+	s.harness.Settle(c)
+	cancel()
+	r := receive(c, done)
+	c.Assert(r.n, gc.Equals, 1)
+	c.Assert(r.err, gc.Equals, context.Canceled)
+	c.Assert(sw.Stats(), jc.DeepEquals, sweeper.Stats{Evicted: 1})
+}
+
+// entries is a sweeper.Entries that records the
+// size of each batch of evicted entries.
+type entries struct {
+	mu      sync.Mutex
+	used    map[string]time.Time
+	evicted []int
+}
+
+func (e *entries) use(key string, t time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.used[key] = t
+}
+
+func (e *entries) keys() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	keys := make([]string, 0, len(e.used))
+	for key := range e.used {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *entries) batches() []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]int(nil), e.evicted...)
+}
+
+func (e *entries) Range(f func(key string, lastUsed time.Time) bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, t := range e.used {
+		if !f(key, t) {
+			return
+		}
+	}
+}
+
+func (e *entries) Evict(keys []string, cutoff time.Time) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := 0
+	for _, key := range keys {
+		if t, ok := e.used[key]; ok && !t.After(cutoff) {
+			delete(e.used, key)
+			n++
+		}
+	}
+	e.evicted = append(e.evicted, len(keys))
+	return n
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
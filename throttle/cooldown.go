@@ -0,0 +1,125 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/ttlcache"
+	"github.com/juju/errors"
+)
+
+// CooldownConfig holds the configuration for a Cooldown or KeyedCooldown.
+type CooldownConfig struct {
+	// Clock is used to measure the period.
+	Clock clock.Clock
+
+	// Period is the time after an allowed action during
+	// which further actions are not allowed.
+	Period time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config CooldownConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Period <= 0 {
+		return errors.NotValidf("non-positive Period")
+	}
+	return nil
+}
+
+// Cooldown allows an action at most once per period, such as to
+// suppress repeated alerts. Unlike a Throttler, a Cooldown does not
+// defer actions that are not allowed; they are simply refused.
+//
+// Cooldown's methods are safe for concurrent use.
+type Cooldown struct {
+	config CooldownConfig
+
+	mu sync.Mutex
+	// until is the end of the current cooldown period.
+	until time.Time
+}
+
+// NewCooldown returns a new Cooldown with the given configuration,
+// which allows the first action.
+func NewCooldown(config CooldownConfig) (*Cooldown, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating cooldown config")
+	}
+	return &Cooldown{config: config}, nil
+}
+
+// Allow reports whether an action is allowed now: that is, whether the
+// period has elapsed since an action was last allowed. If the action is
+// allowed, a new period starts.
+func (c *Cooldown) Allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.config.Clock.Now()
+	if now.Before(c.until) {
+		return false
+	}
+	c.until = now.Add(c.config.Period)
+	return true
+}
+
+// Reset ends the current period, so that the next action is allowed.
+func (c *Cooldown) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.until = time.Time{}
+}
+
+// KeyedCooldown is like Cooldown, but with an independent period for
+// each key. Keys whose periods have elapsed are forgotten, so that the
+// memory used is proportional to the number of keys in their periods.
+//
+// KeyedCooldown's methods are safe for concurrent use.
+type KeyedCooldown[K comparable] struct {
+	config CooldownConfig
+
+	mu   sync.Mutex
+	keys *ttlcache.Set[K]
+}
+
+// NewKeyedCooldown returns a new KeyedCooldown with the given
+// configuration, which allows the first action for each key.
+func NewKeyedCooldown[K comparable](config CooldownConfig) (*KeyedCooldown[K], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating cooldown config")
+	}
+	keys, err := ttlcache.NewSet[K](ttlcache.SetConfig{Clock: config.Clock})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &KeyedCooldown[K]{config: config, keys: keys}, nil
+}
+
+// Allow reports whether an action for the key is allowed now, as
+// Cooldown.Allow does.
+func (c *KeyedCooldown[K]) Allow(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys.Contains(key) {
+		return false
+	}
+	c.keys.Add(key, c.config.Period)
+	return true
+}
+
+// Reset ends the current period for the key, so that the next action
+// for the key is allowed.
+func (c *KeyedCooldown[K]) Reset(key K) {
+	c.keys.Remove(key)
+}
+
+// Len returns the number of keys in their periods.
+func (c *KeyedCooldown[K]) Len() int {
+	return c.keys.Len()
+}
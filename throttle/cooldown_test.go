@@ -0,0 +1,73 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package throttle_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/throttle"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type cooldownSuite struct {
+	coretesting.BaseSuite
+	clock  *coretesting.Clock
+	config throttle.CooldownConfig
+}
+
+var _ = gc.Suite(&cooldownSuite{})
+
+func (s *cooldownSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.config = throttle.CooldownConfig{Clock: s.clock, Period: time.Minute}
+}
+
+func (s *cooldownSuite) TestValidate(c *gc.C) {
+	_, err := throttle.NewCooldown(throttle.CooldownConfig{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating cooldown config: non-positive Period not valid")
+	_, err = throttle.NewKeyedCooldown[string](throttle.CooldownConfig{Period: time.Minute})
+	c.Assert(err, gc.ErrorMatches, "validating cooldown config: nil Clock not valid")
+}
+
+func (s *cooldownSuite) TestAllow(c *gc.C) {
+	cooldown, err := throttle.NewCooldown(s.config)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cooldown.Allow(), jc.IsTrue)
+	c.Assert(cooldown.Allow(), jc.IsFalse)
+
+	// Refused actions do not extend the period.
+	s.clock.Advance(59 * time.Second)
+	c.Assert(cooldown.Allow(), jc.IsFalse)
+	s.clock.Advance(time.Second)
+	c.Assert(cooldown.Allow(), jc.IsTrue)
+	c.Assert(cooldown.Allow(), jc.IsFalse)
+
+	cooldown.Reset()
+	c.Assert(cooldown.Allow(), jc.IsTrue)
+}
+
+func (s *cooldownSuite) TestKeyed(c *gc.C) {
+	cooldown, err := throttle.NewKeyedCooldown[string](s.config)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cooldown.Allow("a"), jc.IsTrue)
+	c.Assert(cooldown.Allow("a"), jc.IsFalse)
+	s.clock.Advance(30 * time.Second)
+	c.Assert(cooldown.Allow("b"), jc.IsTrue)
+	c.Assert(cooldown.Allow("a"), jc.IsFalse)
+	c.Assert(cooldown.Len(), gc.Equals, 2)
+
+	s.clock.Advance(30 * time.Second)
+	c.Assert(cooldown.Allow("a"), jc.IsTrue)
+	c.Assert(cooldown.Allow("b"), jc.IsFalse)
+
+	cooldown.Reset("b")
+	c.Assert(cooldown.Allow("b"), jc.IsTrue)
+
+	// Keys are forgotten once their periods elapse.
+	s.clock.Advance(time.Minute)
+	c.Assert(cooldown.Len(), gc.Equals, 0)
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// SamplerConfig holds the configuration for a Sampler or KeyedSampler.
+type SamplerConfig struct {
+	// Clock is used to measure the interval.
+	Clock clock.Clock
+
+	// Interval is the minimum time between samples.
+	Interval time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config SamplerConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Interval <= 0 {
+		return errors.NotValidf("non-positive Interval")
+	}
+	return nil
+}
+
+func (config SamplerConfig) cooldownConfig() CooldownConfig {
+	return CooldownConfig{Clock: config.Clock, Period: config.Interval}
+}
+
+// Sampler selects at most one event per interval, such as for logging
+// a sample of frequent events:
+//
+//	if ok, skipped := sampler.Sample(); ok {
+//		logger.Debugf("dispatched %v (%d similar skipped)", key, skipped)
+//	}
+//
+// Sampler's methods are safe for concurrent use.
+type Sampler struct {
+	cooldown *Cooldown
+
+	mu      sync.Mutex
+	skipped int
+}
+
+// NewSampler returns a new Sampler with the given configuration,
+// which selects the first event.
+func NewSampler(config SamplerConfig) (*Sampler, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating sampler config")
+	}
+	cooldown, err := NewCooldown(config.cooldownConfig())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Sampler{cooldown: cooldown}, nil
+}
+
+// Should reports whether an event occurring now should be sampled: that
+// is, whether the interval has elapsed since an event was last sampled.
+func (s *Sampler) Should() bool {
+	ok, _ := s.Sample()
+	return ok
+}
+
+// Sample is like Should, but additionally returns the number of events
+// that were not sampled since the last one that was, if this one is.
+func (s *Sampler) Sample() (ok bool, skipped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.cooldown.Allow() {
+		s.skipped++
+		return false, 0
+	}
+	skipped, s.skipped = s.skipped, 0
+	return true, skipped
+}
+
+// KeyedSampler is like Sampler, but with an independent interval for
+// each key. Keys whose intervals have elapsed are forgotten, so that the
+// memory used is proportional to the number of keys sampled within the
+// last interval.
+//
+// KeyedSampler's methods are safe for concurrent use.
+type KeyedSampler[K comparable] struct {
+	cooldown *KeyedCooldown[K]
+}
+
+// NewKeyedSampler returns a new KeyedSampler with the given
+// configuration, which selects the first event for each key.
+func NewKeyedSampler[K comparable](config SamplerConfig) (*KeyedSampler[K], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating sampler config")
+	}
+	cooldown, err := NewKeyedCooldown[K](config.cooldownConfig())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &KeyedSampler[K]{cooldown: cooldown}, nil
+}
+
+// Should reports whether an event for the key occurring now should be
+// sampled, as Sampler.Should does.
+func (s *KeyedSampler[K]) Should(key K) bool {
+	return s.cooldown.Allow(key)
+}
+
+// Len returns the number of keys sampled within the last interval.
+func (s *KeyedSampler[K]) Len() int {
+	return s.cooldown.Len()
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package throttle_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/throttle"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type samplerSuite struct {
+	coretesting.BaseSuite
+	clock  *coretesting.Clock
+	config throttle.SamplerConfig
+}
+
+var _ = gc.Suite(&samplerSuite{})
+
+func (s *samplerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.config = throttle.SamplerConfig{Clock: s.clock, Interval: time.Minute}
+}
+
+func (s *samplerSuite) TestValidate(c *gc.C) {
+	_, err := throttle.NewSampler(throttle.SamplerConfig{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating sampler config: non-positive Interval not valid")
+	_, err = throttle.NewKeyedSampler[string](throttle.SamplerConfig{Interval: time.Minute})
+	c.Assert(err, gc.ErrorMatches, "validating sampler config: nil Clock not valid")
+}
+
+func (s *samplerSuite) TestSample(c *gc.C) {
+	sampler, err := throttle.NewSampler(s.config)
+	c.Assert(err, jc.ErrorIsNil)
+	ok, skipped := sampler.Sample()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(skipped, gc.Equals, 0)
+	c.Assert(sampler.Should(), jc.IsFalse)
+
+	s.clock.Advance(59 * time.Second)
+	ok, skipped = sampler.Sample()
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(skipped, gc.Equals, 0)
+
+	// Skipped events are counted until the next sample.
+	s.clock.Advance(time.Second)
+	ok, skipped = sampler.Sample()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(skipped, gc.Equals, 2)
+	s.clock.Advance(time.Minute)
+	ok, skipped = sampler.Sample()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(skipped, gc.Equals, 0)
+}
+
+func (s *samplerSuite) TestKeyed(c *gc.C) {
+	sampler, err := throttle.NewKeyedSampler[string](s.config)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sampler.Should("a"), jc.IsTrue)
+	c.Assert(sampler.Should("a"), jc.IsFalse)
+	s.clock.Advance(30 * time.Second)
+	c.Assert(sampler.Should("b"), jc.IsTrue)
+	c.Assert(sampler.Should("a"), jc.IsFalse)
+	c.Assert(sampler.Len(), gc.Equals, 2)
+
+	s.clock.Advance(30 * time.Second)
+	c.Assert(sampler.Should("a"), jc.IsTrue)
+	c.Assert(sampler.Should("b"), jc.IsFalse)
+
+	s.clock.Advance(time.Minute)
+	c.Assert(sampler.Len(), gc.Equals, 0)
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package throttle provides a Throttler, which limits the rate
+// at which a function is called in response to triggers, a
+// Cooldown, which refuses actions repeated within a period, and a
+// Sampler, which selects at most one event per interval.
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Throttler.
+type Config struct {
+	// Clock is used to measure the interval.
+	Clock clock.Clock
+
+	// Interval is the minimum time between calls to Func.
+	Interval time.Duration
+
+	// Leading, if true, causes a trigger received while the
+	// Throttler is idle to call Func immediately.
+	Leading bool
+
+	// Trailing, if true, causes triggers received during an
+	// interval to call Func at the end of the interval.
+	Trailing bool
+
+	// Func is the function to call.
+	Func func()
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Interval <= 0 {
+		return errors.NotValidf("non-positive Interval")
+	}
+	if !config.Leading && !config.Trailing {
+		return errors.NotValidf("neither Leading nor Trailing")
+	}
+	if config.Func == nil {
+		return errors.NotValidf("nil Func")
+	}
+	return nil
+}
+
+// Throttler calls a function in response to triggers, at most once per
+// interval. With the leading edge enabled, the first trigger after a
+// period of inactivity calls the function immediately; with the trailing
+// edge enabled, triggers received during an interval cause a single call
+// at the end of the interval, so the most recent trigger is never lost.
+//
+// The function is called in the Throttler's own goroutine, and never
+// concurrently with itself. Throttler's methods are safe for concurrent
+// use.
+type Throttler struct {
+	config Config
+
+	// The following fields are accessed only by the loop goroutine.
+	//
+	// throttling records whether the Throttler is within an
+	// interval, which ends at until; pending records whether a
+	// trailing call is due at the end of the interval.
+	throttling bool
+	until      time.Time
+	pending    bool
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewThrottler returns a new Throttler with the given configuration.
+// The Throttler runs until it is stopped.
+func NewThrottler(config Config) (*Throttler, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating throttler config")
+	}
+	t := &Throttler{
+		config: config,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.loop()
+	return t, nil
+}
+
+// Trigger triggers the Throttler. Trigger does not block.
+func (t *Throttler) Trigger() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops the Throttler, discarding any pending trailing call, and
+// waits for any call in progress to complete. Once stopped, triggers
+// are ignored.
+func (t *Throttler) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+}
+
+func (t *Throttler) loop() {
+	defer close(t.done)
+	for {
+		var end <-chan time.Time
+		if t.throttling {
+			end = clock.Alarm(t.config.Clock, t.until)
+		}
+		select {
+		case <-t.stop:
+			return
+		case <-t.wake:
+			t.triggered()
+		case <-end:
+			t.intervalEnded()
+		}
+	}
+}
+
+func (t *Throttler) triggered() {
+	if t.throttling {
+		t.pending = t.config.Trailing
+		return
+	}
+	t.start()
+	if t.config.Leading {
+		t.config.Func()
+	} else {
+		t.pending = true
+	}
+}
+
+func (t *Throttler) intervalEnded() {
+	if !t.pending {
+		t.throttling = false
+		return
+	}
+	t.pending = false
+	t.start()
+	t.config.Func()
+}
+
+// start starts a new interval.
+func (t *Throttler) start() {
+	t.throttling = true
+	t.until = t.config.Clock.Now().Add(t.config.Interval)
+}
@@ -0,0 +1,138 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package throttle_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/throttle"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type throttleSuite struct {
+	coretesting.BaseSuite
+	clock  *coretesting.Clock
+	called chan time.Time
+}
+
+var _ = gc.Suite(&throttleSuite{})
+
+func (s *throttleSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.called = make(chan time.Time, 10)
+}
+
+func (s *throttleSuite) newThrottler(c *gc.C, leading, trailing bool) *throttle.Throttler {
+	t, err := throttle.NewThrottler(throttle.Config{
+		Clock:    s.clock,
+		Interval: time.Second,
+		Leading:  leading,
+		Trailing: trailing,
+		Func: func() {
+			s.called <- s.clock.Now()
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return t
+}
+
+// trigger triggers the throttler, and waits long enough for the
+// throttler to observe the trigger.
+func (s *throttleSuite) trigger(t *throttle.Throttler) {
+	t.Trigger()
+	time.Sleep(coretesting.ShortWait)
+}
+
+func (s *throttleSuite) TestValidate(c *gc.C) {
+	_, err := throttle.NewThrottler(throttle.Config{Clock: s.clock, Interval: time.Second})
+	c.Assert(err, gc.ErrorMatches, "validating throttler config: neither Leading nor Trailing not valid")
+}
+
+func (s *throttleSuite) TestLeading(c *gc.C) {
+	t := s.newThrottler(c, true, false)
+	defer t.Stop()
+
+	t0 := s.clock.Now()
+	s.trigger(t)
+	c.Assert(receive(c, s.called), gc.Equals, t0)
+	s.trigger(t)
+	s.clock.Advance(time.Second)
+	assertNotCalled(c, s.called)
+
+	s.trigger(t)
+	c.Assert(receive(c, s.called), gc.Equals, t0.Add(time.Second))
+}
+
+func (s *throttleSuite) TestTrailing(c *gc.C) {
+	t := s.newThrottler(c, false, true)
+	defer t.Stop()
+
+	t0 := s.clock.Now()
+	s.trigger(t)
+	assertNotCalled(c, s.called)
+	s.clock.Advance(500 * time.Millisecond)
+	s.trigger(t)
+	assertNotCalled(c, s.called)
+	s.clock.Advance(500 * time.Millisecond)
+	c.Assert(receive(c, s.called), gc.Equals, t0.Add(time.Second))
+
+	// No further triggers, no further calls.
+	s.clock.Advance(time.Minute)
+	assertNotCalled(c, s.called)
+}
+
+func (s *throttleSuite) TestLeadingAndTrailing(c *gc.C) {
+	t := s.newThrottler(c, true, true)
+	defer t.Stop()
+
+	t0 := s.clock.Now()
+	s.trigger(t)
+	c.Assert(receive(c, s.called), gc.Equals, t0)
+	s.trigger(t)
+	s.trigger(t)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.called), gc.Equals, t0.Add(time.Second))
+
+	// The trailing call starts a new interval.
+	s.trigger(t)
+	s.clock.Advance(500 * time.Millisecond)
+	assertNotCalled(c, s.called)
+	s.clock.Advance(500 * time.Millisecond)
+	c.Assert(receive(c, s.called), gc.Equals, t0.Add(2*time.Second))
+}
+
+func (s *throttleSuite) TestConcurrentStop(c *gc.C) {
+	t := s.newThrottler(c, true, true)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotCalled[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected call at %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
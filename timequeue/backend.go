@@ -0,0 +1,319 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// Backend identifies the structure with which a Queue orders its items
+// by time. The backend affects only the cost of the queue's operations,
+// not their results.
+type Backend int
+
+const (
+	// BackendHeap orders items in a binary heap. Adding, removing
+	// and popping items takes O(log(n)) time, regardless of how the
+	// items' times are distributed. It is the default.
+	BackendHeap Backend = iota
+
+	// BackendWheel orders items in a timing wheel: a ring of
+	// Config.WheelSlots slots, each covering Config.WheelTick. Adding
+	// and removing items whose times fall within the wheel's horizon,
+	// WheelSlots ticks from the earliest item, takes constant time;
+	// items beyond the horizon, and those in the earliest item's
+	// tick, are held in heaps. Moving on to the next tick takes time
+	// proportional to the number of empty slots skipped, and the
+	// number of items in the slot reached.
+	//
+	// A wheel suits large queues with high churn, whose items mostly
+	// fall within the horizon, such as timeouts that are usually
+	// cancelled before they expire.
+	BackendWheel
+
+	// BackendAdaptive selects between BackendHeap and BackendWheel
+	// automatically, based on the queue's size and the distribution
+	// of its items' times, migrating the items when it changes
+	// backend; see Queue.SetBackend. The selection is re-evaluated
+	// after every adaptWindow modifications of the queue, so a queue
+	// that is not modified is never migrated. An adaptive queue uses
+	// the wheel while it holds at least Config.AdaptiveThreshold
+	// items, most of which fall within the wheel's horizon, and the
+	// heap otherwise.
+	BackendAdaptive
+)
+
+// String returns the name of the backend.
+func (b Backend) String() string {
+	switch b {
+	case BackendHeap:
+		return "heap"
+	case BackendWheel:
+		return "wheel"
+	case BackendAdaptive:
+		return "adaptive"
+	}
+	return "unknown"
+}
+
+const (
+	// DefaultWheelTick is the default length of each
+	// slot of a queue's timing wheel.
+	DefaultWheelTick = time.Second
+
+	// DefaultWheelSlots is the default number of
+	// slots in a queue's timing wheel.
+	DefaultWheelSlots = 4096
+
+	// DefaultAdaptiveThreshold is the default number of items
+	// at which an adaptive queue considers using a timing wheel.
+	DefaultAdaptiveThreshold = 4096
+
+	// adaptWindow is the number of modifications of an
+	// adaptive queue between evaluations of its backend.
+	adaptWindow = 1024
+
+	// horizonSamples is the number of items sampled to estimate
+	// the fraction of a heap-ordered queue's items that would
+	// fall within a timing wheel's horizon.
+	horizonSamples = 64
+)
+
+// Config holds the configuration for a Queue.
+type Config struct {
+	// Clock is used for the queue's Next method.
+	Clock clock.Clock
+
+	// Backend is the backend with which the queue orders its
+	// items. If Backend is zero, BackendHeap is used.
+	Backend Backend
+
+	// WheelTick is the length of each slot of the queue's timing
+	// wheel, if it uses one. Items whose times fall within the
+	// same tick share a slot. If WheelTick is zero,
+	// DefaultWheelTick is used.
+	WheelTick time.Duration
+
+	// WheelSlots is the number of slots in the queue's timing
+	// wheel, if it uses one. If WheelSlots is zero,
+	// DefaultWheelSlots is used.
+	WheelSlots int
+
+	// AdaptiveThreshold is the number of items at which an adaptive
+	// queue considers using a timing wheel. If AdaptiveThreshold is
+	// zero, DefaultAdaptiveThreshold is used.
+	AdaptiveThreshold int
+
+	// SizeHint, if positive, is the number of items that an adaptive
+	// queue is expected to hold, with which its initial backend is
+	// selected.
+	SizeHint int
+
+	// WakeupWindow, if positive, coalesces the queue's wakeups: the
+	// channel returned by Next sends not at the time of the next item,
+	// but at the latest time of the items queued within WakeupWindow
+	// of it, so that Ready then returns them together, rather than each
+	// arming a timer of its own. Items waited for with Next may thus be
+	// delivered up to WakeupWindow later than their times, but never
+	// earlier; Ready itself is unaffected. See NextWakeTime.
+	WakeupWindow time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	switch config.Backend {
+	case BackendHeap, BackendWheel, BackendAdaptive:
+	default:
+		return errors.NotValidf("Backend %d", config.Backend)
+	}
+	if config.WheelTick < 0 {
+		return errors.NotValidf("negative WheelTick")
+	}
+	if config.WheelSlots < 0 {
+		return errors.NotValidf("negative WheelSlots")
+	}
+	if config.AdaptiveThreshold < 0 {
+		return errors.NotValidf("negative AdaptiveThreshold")
+	}
+	if config.SizeHint < 0 {
+		return errors.NotValidf("negative SizeHint")
+	}
+	if config.WakeupWindow < 0 {
+		return errors.NotValidf("negative WakeupWindow")
+	}
+	return nil
+}
+
+// NewWithConfig constructs a new queue with the given configuration.
+func NewWithConfig[K comparable, V any](config Config) (*Queue[K, V], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating queue config")
+	}
+	if config.WheelTick == 0 {
+		config.WheelTick = DefaultWheelTick
+	}
+	if config.WheelSlots == 0 {
+		config.WheelSlots = DefaultWheelSlots
+	}
+	if config.AdaptiveThreshold == 0 {
+		config.AdaptiveThreshold = DefaultAdaptiveThreshold
+	}
+	s := &Queue[K, V]{
+		time:   config.Clock,
+		config: config,
+		m:      make(map[K]*queueItem[K, V]),
+	}
+	backend := config.Backend
+	if backend == BackendAdaptive {
+		s.adapt = &adaptState{}
+		backend = BackendHeap
+		if config.SizeHint >= config.AdaptiveThreshold {
+			backend = BackendWheel
+		}
+	}
+	s.order = s.newOrder(backend)
+	return s, nil
+}
+
+// Backend returns the backend with which the queue currently orders its
+// items: for an adaptive queue, the backend that it has selected.
+func (s *Queue[K, V]) Backend() Backend {
+	return s.order.backend()
+}
+
+// SetBackend changes the backend with which the queue orders its items,
+// migrating the items to it. Setting BackendAdaptive makes the queue
+// adaptive, selecting its backend automatically from then on; setting
+// either of the other backends fixes the queue's backend.
+//
+// Migration takes time proportional to the number of items, and happens
+// within the call to SetBackend, or, for an adaptive queue, within the
+// call that modifies the queue and prompts the migration. Migrated items
+// keep their keys, values, times, repetition and eviction order, so the
+// queue's contents and the results of its methods are unaffected; a
+// channel returned by Next before the migration remains valid. SetBackend
+// will panic if the backend is unknown.
+func (s *Queue[K, V]) SetBackend(backend Backend) {
+	switch backend {
+	case BackendHeap, BackendWheel:
+		s.adapt = nil
+	case BackendAdaptive:
+		if s.adapt == nil {
+			s.adapt = &adaptState{}
+		}
+		s.adaptBackend()
+		return
+	default:
+		panic(errors.NotValidf("Backend %d", backend))
+	}
+	s.migrate(backend)
+}
+
+// newOrder returns a new, empty, order of the specified backend.
+func (s *Queue[K, V]) newOrder(backend Backend) order[K, V] {
+	if backend == BackendWheel {
+		tick, slots := s.config.WheelTick, s.config.WheelSlots
+		if tick == 0 {
+			// The queue was constructed with New, and
+			// has since been set to use a wheel.
+			tick, slots = DefaultWheelTick, DefaultWheelSlots
+		}
+		return newWheelOrder[K, V](tick, slots)
+	}
+	return &heapOrder[K, V]{}
+}
+
+// migrate moves the queue's items to a new order
+// of the specified backend, if it is not already
+// using that backend.
+func (s *Queue[K, V]) migrate(backend Backend) {
+	if s.order.backend() == backend {
+		return
+	}
+	items := make([]*queueItem[K, V], 0, s.order.len())
+	s.order.each(func(item *queueItem[K, V]) {
+		items = append(items, item)
+	})
+	s.order = s.newOrder(backend)
+	s.order.pushAll(items)
+}
+
+// adaptState holds the state of an adaptive queue's backend selection.
+type adaptState struct {
+	// modified is the number of modifications of the
+	// queue since the backend was last evaluated.
+	modified int
+}
+
+// observe records a modification of the queue.
+func (s *Queue[K, V]) observe() {
+	s.observeN(1)
+}
+
+// observeN records n modifications of the queue, re-evaluating an
+// adaptive queue's backend after every adaptWindow modifications.
+func (s *Queue[K, V]) observeN(n int) {
+	if s.adapt == nil {
+		return
+	}
+	s.adapt.modified += n
+	if s.adapt.modified >= adaptWindow {
+		s.adaptBackend()
+	}
+}
+
+// adaptBackend selects an adaptive queue's backend, migrating its items
+// if the selection changes. The thresholds for switching to and from
+// the wheel differ, so that a queue near them does not switch back and
+// forth.
+func (s *Queue[K, V]) adaptBackend() {
+	s.adapt.modified = 0
+	threshold := s.config.AdaptiveThreshold
+	if threshold == 0 {
+		threshold = DefaultAdaptiveThreshold
+	}
+	n := s.order.len()
+	switch order := s.order.(type) {
+	case *heapOrder[K, V]:
+		if n >= threshold && s.withinHorizon(order) >= 0.75 {
+			s.migrate(BackendWheel)
+		}
+	case *wheelOrder[K, V]:
+		if n < threshold/2 || order.overflowFraction() > 0.5 {
+			s.migrate(BackendHeap)
+		}
+	}
+}
+
+// withinHorizon estimates, by sampling, the fraction of the heap's items
+// that would fall within a timing wheel's horizon from the earliest.
+func (s *Queue[K, V]) withinHorizon(h *heapOrder[K, V]) float64 {
+	first := h.first()
+	if first == nil {
+		return 0
+	}
+	tick, slots := s.config.WheelTick, s.config.WheelSlots
+	if tick == 0 {
+		tick, slots = DefaultWheelTick, DefaultWheelSlots
+	}
+	horizon := first.t.Add(time.Duration(slots) * tick)
+	samples := horizonSamples
+	if samples > len(h.items) {
+		samples = len(h.items)
+	}
+	stride := len(h.items) / samples
+	var within int
+	for i := 0; i < samples; i++ {
+		if h.items[i*stride].t.Before(horizon) {
+			within++
+		}
+	}
+	return float64(within) / float64(samples)
+}
@@ -0,0 +1,369 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue_test
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/timequeue"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	coretesting "github.com/juju/juju/testing"
+)
+
+type backendSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&backendSuite{})
+
+func (*backendSuite) TestValidate(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	for _, test := range []struct {
+		config timequeue.Config
+		err    string
+	}{{
+		config: timequeue.Config{},
+		err:    "nil Clock not valid",
+	}, {
+		config: timequeue.Config{Clock: clock, Backend: 3},
+		err:    "Backend 3 not valid",
+	}, {
+		config: timequeue.Config{Clock: clock, WheelTick: -1},
+		err:    "negative WheelTick not valid",
+	}, {
+		config: timequeue.Config{Clock: clock, WheelSlots: -1},
+		err:    "negative WheelSlots not valid",
+	}, {
+		config: timequeue.Config{Clock: clock, AdaptiveThreshold: -1},
+		err:    "negative AdaptiveThreshold not valid",
+	}, {
+		config: timequeue.Config{Clock: clock, SizeHint: -1},
+		err:    "negative SizeHint not valid",
+	}, {
+		config: timequeue.Config{Clock: clock, WakeupWindow: -1},
+		err:    "negative WakeupWindow not valid",
+	}} {
+		_, err := timequeue.NewWithConfig[string, string](test.config)
+		c.Check(err, gc.ErrorMatches, "validating queue config: "+test.err)
+	}
+}
+
+func (*backendSuite) TestBackend(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	s := timequeue.New[string, string](clock)
+	c.Assert(s.Backend(), gc.Equals, timequeue.BackendHeap)
+
+	for _, test := range []struct {
+		config timequeue.Config
+		expect timequeue.Backend
+	}{{
+		config: timequeue.Config{Clock: clock},
+		expect: timequeue.BackendHeap,
+	}, {
+		config: timequeue.Config{Clock: clock, Backend: timequeue.BackendWheel},
+		expect: timequeue.BackendWheel,
+	}, {
+		config: timequeue.Config{Clock: clock, Backend: timequeue.BackendAdaptive},
+		expect: timequeue.BackendHeap,
+	}, {
+		config: timequeue.Config{
+			Clock:    clock,
+			Backend:  timequeue.BackendAdaptive,
+			SizeHint: timequeue.DefaultAdaptiveThreshold,
+		},
+		expect: timequeue.BackendWheel,
+	}} {
+		s, err := timequeue.NewWithConfig[string, string](test.config)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(s.Backend(), gc.Equals, test.expect)
+	}
+}
+
+func (*backendSuite) TestBackendString(c *gc.C) {
+	c.Assert(timequeue.BackendHeap.String(), gc.Equals, "heap")
+	c.Assert(timequeue.BackendWheel.String(), gc.Equals, "wheel")
+	c.Assert(timequeue.BackendAdaptive.String(), gc.Equals, "adaptive")
+	c.Assert(timequeue.Backend(3).String(), gc.Equals, "unknown")
+}
+
+func (*backendSuite) TestWheel(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s, err := timequeue.NewWithConfig[string, string](timequeue.Config{
+		Clock:      clock,
+		Backend:    timequeue.BackendWheel,
+		WheelTick:  time.Second,
+		WheelSlots: 4,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Items beyond the horizon, before the first item, and
+	// sharing a tick, are all returned in order.
+	s.Add("k0", "v0", now.Add(2*time.Second))
+	s.Add("k1", "v1", now.Add(time.Hour))
+	s.Add("k2", "v2", now.Add(-time.Minute))
+	s.Add("k3", "v3", now.Add(2500*time.Millisecond))
+	s.Add("k4", "v4", now.Add(2100*time.Millisecond))
+	s.Add("k5", "v5", now.Add(10*time.Second))
+
+	t, ok := s.NextTime()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(t, gc.Equals, now.Add(-time.Minute))
+	assertReady(c, s, clock, "v2")
+
+	clock.Advance(3 * time.Second)
+	assertReady(c, s, clock, "v0", "v4", "v3")
+
+	clock.Advance(10 * time.Second)
+	clocktesting.ExpectSignalled(c, s.Next())
+	assertReady(c, s, clock, "v5")
+
+	s.Add("k6", "v6", now)
+	assertReady(c, s, clock, "v6")
+	clock.Advance(time.Hour)
+	assertReady(c, s, clock, "v1")
+	c.Assert(s.Len(), gc.Equals, 0)
+}
+
+func (*backendSuite) TestSetBackend(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+	s.SetEvictionOrder(func(a, b timequeue.Item[string, string]) bool {
+		return a.Time.After(b.Time)
+	})
+	s.Add("k0", "v0", now.Add(3500*time.Millisecond))
+	s.AddRepeating("k1", "v1", now.Add(time.Second), 2*time.Second)
+	s.Add("k2", "v2", now.Add(2*time.Hour))
+
+	// Migration preserves the items' times, repetition
+	// and eviction order, and the Next channel.
+	next := s.Next()
+	s.SetBackend(timequeue.BackendWheel)
+	c.Assert(s.Backend(), gc.Equals, timequeue.BackendWheel)
+	c.Assert(s.Len(), gc.Equals, 3)
+	_, t, ok := s.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(t, gc.Equals, now.Add(3500*time.Millisecond))
+	item, ok := s.PeekEvict()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(item.Key, gc.Equals, "k2")
+
+	clock.Advance(time.Second)
+	clocktesting.ExpectSignalled(c, next)
+	assertReady(c, s, clock, "v1")
+
+	s.SetBackend(timequeue.BackendHeap)
+	c.Assert(s.Backend(), gc.Equals, timequeue.BackendHeap)
+	clock.Advance(2500 * time.Millisecond)
+	assertReady(c, s, clock, "v1", "v0")
+	_, t, _ = s.Get("k1")
+	c.Assert(t, gc.Equals, now.Add(5*time.Second))
+
+	c.Assert(func() {
+		s.SetBackend(3)
+	}, gc.PanicMatches, "Backend 3 not valid")
+}
+
+func (*backendSuite) TestAdaptive(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s, err := timequeue.NewWithConfig[int, int](timequeue.Config{
+		Clock:             clock,
+		Backend:           timequeue.BackendAdaptive,
+		WheelTick:         time.Second,
+		WheelSlots:        1000,
+		AdaptiveThreshold: 100,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Many items within the wheel's horizon: the queue
+	// switches to the wheel as they are added.
+	for i := 0; i < 2000; i++ {
+		s.Add(i, i, now.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	c.Assert(s.Backend(), gc.Equals, timequeue.BackendWheel)
+
+	// Too few items: the queue switches back to the heap
+	// when the selection is next evaluated.
+	for i := 0; i < 1990; i++ {
+		s.Remove(i)
+	}
+	c.Assert(s.Backend(), gc.Equals, timequeue.BackendWheel)
+	s.SetBackend(timequeue.BackendAdaptive)
+	c.Assert(s.Backend(), gc.Equals, timequeue.BackendHeap)
+	c.Assert(s.Len(), gc.Equals, 10)
+
+	// Many items, mostly beyond the wheel's horizon:
+	// the queue remains on the heap.
+	for i := 0; i < 2000; i++ {
+		s.Add(2000+i, i, now.Add(time.Duration(i)*time.Hour))
+	}
+	c.Assert(s.Backend(), gc.Equals, timequeue.BackendHeap)
+
+	// Fixing the backend stops the queue adapting.
+	s.SetBackend(timequeue.BackendWheel)
+	for i := 0; i < 2000; i++ {
+		s.Remove(2000 + i)
+	}
+	c.Assert(s.Backend(), gc.Equals, timequeue.BackendWheel)
+	clock.Advance(time.Hour)
+	c.Assert(s.Ready(clock.Now()), jc.DeepEquals, []int{1990, 1991, 1992, 1993, 1994, 1995, 1996, 1997, 1998, 1999})
+}
+
+// TestBackendsEquivalent applies the same random operations to queues
+// of each backend, and checks that their results are identical.
+func (*backendSuite) TestBackendsEquivalent(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	newQueue := func(backend timequeue.Backend) *timequeue.Queue[int, int] {
+		s, err := timequeue.NewWithConfig[int, int](timequeue.Config{
+			Clock:             clock,
+			Backend:           backend,
+			WheelTick:         time.Second,
+			WheelSlots:        16,
+			AdaptiveThreshold: 32,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		s.SetEvictionOrder(func(a, b timequeue.Item[int, int]) bool {
+			return a.Key < b.Key
+		})
+		return s
+	}
+	queues := []*timequeue.Queue[int, int]{
+		newQueue(timequeue.BackendHeap),
+		newQueue(timequeue.BackendWheel),
+		newQueue(timequeue.BackendAdaptive),
+	}
+
+	rnd := rand.New(rand.NewSource(0))
+	randomTime := func() time.Time {
+		// Mostly within the wheels' horizon, sometimes beyond
+		// it, and sometimes in the past.
+		spread := 20 * time.Second
+		if rnd.Intn(10) == 0 {
+			spread = 10 * time.Minute
+		}
+		return now.Add(time.Duration(rnd.Int63n(int64(spread))) - 2*time.Second)
+	}
+	// apply calls f with each queue, recording the results.
+	var results [][]string
+	apply := func(f func(s *timequeue.Queue[int, int]) string) {
+		for i, s := range queues {
+			results[i] = append(results[i], f(s))
+		}
+	}
+	backends := make(map[timequeue.Backend]bool)
+	for op := 0; op < 20000; op++ {
+		key := rnd.Intn(200)
+		t := randomTime()
+		results = make([][]string, len(queues))
+		switch n := rnd.Intn(100); {
+		case n < 30:
+			apply(func(s *timequeue.Queue[int, int]) string {
+				if _, _, ok := s.Get(key); !ok {
+					s.Add(key, op, t)
+				}
+				return ""
+			})
+		case n < 35:
+			interval := time.Duration(rnd.Int63n(int64(5*time.Second))) + 1
+			apply(func(s *timequeue.Queue[int, int]) string {
+				if _, _, ok := s.Get(key); !ok {
+					s.AddRepeating(key, op, t, interval)
+				}
+				return ""
+			})
+		case n < 50:
+			apply(func(s *timequeue.Queue[int, int]) string {
+				return fmt.Sprint(s.Update(key, op, t))
+			})
+		case n < 65:
+			apply(func(s *timequeue.Queue[int, int]) string {
+				return fmt.Sprint(s.Remove(key))
+			})
+		case n < 67:
+			keys := rnd.Perm(200)[:20]
+			apply(func(s *timequeue.Queue[int, int]) string {
+				s.RemoveAll(keys)
+				return ""
+			})
+		case n < 77:
+			apply(func(s *timequeue.Queue[int, int]) string {
+				return fmt.Sprint(s.PopReady(clock.Now()))
+			})
+		case n < 82:
+			limit := rnd.Intn(5)
+			apply(func(s *timequeue.Queue[int, int]) string {
+				return fmt.Sprint(s.ReadyN(clock.Now(), limit))
+			})
+		case n < 87:
+			apply(func(s *timequeue.Queue[int, int]) string {
+				return fmt.Sprint(s.Due(t))
+			})
+		case n < 88:
+			apply(func(s *timequeue.Queue[int, int]) string {
+				return fmt.Sprint(s.Evict())
+			})
+		case n < 89:
+			// Migrate the adaptive queue back and forth.
+			queues[2].SetBackend(timequeue.Backend(rnd.Intn(2)))
+			queues[2].SetBackend(timequeue.BackendAdaptive)
+		default:
+			clock.Advance(time.Duration(rnd.Int63n(int64(time.Second))))
+		}
+		apply(func(s *timequeue.Queue[int, int]) string {
+			t, ok := s.NextTime()
+			return fmt.Sprint(s.Len(), t, ok)
+		})
+		for i := 1; i < len(queues); i++ {
+			c.Assert(results[i], jc.DeepEquals, results[0], gc.Commentf("operation %d, queue %d", op, i))
+		}
+		backends[queues[2].Backend()] = true
+	}
+	c.Assert(backends, jc.DeepEquals, map[timequeue.Backend]bool{
+		timequeue.BackendHeap:  true,
+		timequeue.BackendWheel: true,
+	})
+}
+
+func (*backendSuite) TestWakeupWindow(c *gc.C) {
+	for _, backend := range []timequeue.Backend{timequeue.BackendHeap, timequeue.BackendWheel} {
+		c.Logf("backend %v", backend)
+		clock := clocktesting.NewClock(time.Time{})
+		s, err := timequeue.NewWithConfig[string, string](timequeue.Config{
+			Clock:        clock,
+			Backend:      backend,
+			WakeupWindow: 100 * time.Millisecond,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		t0 := clock.Now()
+		s.Add("a", "a", t0.Add(time.Second))
+		s.Add("b", "b", t0.Add(time.Second+50*time.Millisecond))
+		s.Add("c", "c", t0.Add(time.Second+100*time.Millisecond))
+		s.Add("d", "d", t0.Add(time.Second+150*time.Millisecond))
+
+		// Items within the window of the next are delivered on
+		// one wakeup, at the latest of their times.
+		wake, ok := s.NextWakeTime()
+		c.Assert(ok, jc.IsTrue)
+		c.Assert(wake, gc.Equals, t0.Add(time.Second+100*time.Millisecond))
+		next, _ := s.NextTime()
+		c.Assert(next, gc.Equals, t0.Add(time.Second))
+		ch := s.Next()
+		clocktesting.ExpectTimer(c, clock, time.Second+100*time.Millisecond)
+		clock.Advance(time.Second + 100*time.Millisecond)
+		clocktesting.ExpectSignalled(c, ch)
+		c.Assert(s.Ready(clock.Now()), jc.SameContents, []string{"a", "b", "c"})
+
+		// An item is never delivered early.
+		wake, _ = s.NextWakeTime()
+		c.Assert(wake, gc.Equals, t0.Add(time.Second+150*time.Millisecond))
+	}
+}
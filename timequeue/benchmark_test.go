@@ -0,0 +1,297 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue_test
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	stdtesting "testing"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+)
+
+// The benchmarks in this file measure the queue's operations across
+// queue sizes and access patterns, and report allocations. Compare runs
+// before and after a change with benchstat:
+//
+//	go test -run NONE -bench . -count 10 ./timequeue > old.txt
+//	go test -run NONE -bench . -count 10 ./timequeue > new.txt
+//	benchstat old.txt new.txt
+//
+// Each benchmark is run against every entry in queueImplementations,
+// so that the queue's backends may be compared.
+
+// benchQueue is the subset of the queue's methods that are benchmarked.
+type benchQueue interface {
+	Add(key int, value int, t time.Time)
+	Remove(key int) (int, bool)
+	Update(key int, value int, t time.Time) bool
+	Get(key int) (int, time.Time, bool)
+	Ready(now time.Time) []int
+	Next() <-chan time.Time
+	NextTime() (time.Time, bool)
+	Len() int
+}
+
+var queueImplementations = []struct {
+	name string
+	new  func(clock.Clock) benchQueue
+}{{
+	name: "heap",
+	new: func(clock clock.Clock) benchQueue {
+		return timequeue.New[int, int](clock)
+	},
+}, {
+	name: "wheel",
+	new: func(clock clock.Clock) benchQueue {
+		return newBenchQueue(clock, timequeue.BackendWheel)
+	},
+}, {
+	name: "adaptive",
+	new: func(clock clock.Clock) benchQueue {
+		return newBenchQueue(clock, timequeue.BackendAdaptive)
+	},
+}}
+
+// newBenchQueue returns a new queue with the specified backend, and a
+// timing wheel whose horizon covers benchSpread.
+func newBenchQueue(clock clock.Clock, backend timequeue.Backend) benchQueue {
+	q, err := timequeue.NewWithConfig[int, int](timequeue.Config{
+		Clock:      clock,
+		Backend:    backend,
+		WheelTick:  time.Second,
+		WheelSlots: int(time.Duration(benchSpread)/time.Second) + 1,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+var benchSizes = []int{10, 1000, 100000, 1000000}
+
+// benchEpoch is the time relative to which items are queued. Items
+// are queued within benchSpread of it, well in the future, so that
+// Next's timer never fires during a benchmark.
+var (
+	benchEpoch  = time.Now().Add(24 * time.Hour)
+	benchSpread = int64(time.Hour)
+)
+
+// runBenchmarks calls f, as a sub-benchmark, for each combination
+// of queue implementation and size.
+func runBenchmarks(b *stdtesting.B, f func(b *stdtesting.B, newQueue func() benchQueue, n int)) {
+	for _, impl := range queueImplementations {
+		for _, n := range benchSizes {
+			newQueue := func() benchQueue {
+				return impl.new(clock.WallClock)
+			}
+			b.Run(fmt.Sprintf("%s/%d", impl.name, n), func(b *stdtesting.B) {
+				f(b, newQueue, n)
+			})
+		}
+	}
+}
+
+// randomTimes returns n times, randomly distributed within
+// benchSpread of benchEpoch, from a fixed seed.
+func randomTimes(n int) []time.Time {
+	rnd := rand.New(rand.NewSource(int64(n)))
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = benchEpoch.Add(time.Duration(rnd.Int63n(benchSpread)))
+	}
+	return times
+}
+
+// filledQueue returns a new queue holding the keys [0, n), with
+// the corresponding times.
+func filledQueue(newQueue func() benchQueue, times []time.Time) benchQueue {
+	q := newQueue()
+	for i, t := range times {
+		q.Add(i, i, t)
+	}
+	return q
+}
+
+// BenchmarkAdd measures adding items to a queue, until it holds n
+// items; the queue is then replaced by an empty one.
+func BenchmarkAdd(b *stdtesting.B) {
+	runBenchmarks(b, func(b *stdtesting.B, newQueue func() benchQueue, n int) {
+		times := randomTimes(n)
+		q := newQueue()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			k := i % n
+			if k == 0 && i > 0 {
+				b.StopTimer()
+				q = newQueue()
+				b.StartTimer()
+			}
+			q.Add(k, k, times[k])
+		}
+	})
+}
+
+// BenchmarkRemove measures removing random items from a queue of n
+// items, until it is empty; the queue is then refilled.
+func BenchmarkRemove(b *stdtesting.B) {
+	runBenchmarks(b, func(b *stdtesting.B, newQueue func() benchQueue, n int) {
+		times := randomTimes(n)
+		order := rand.New(rand.NewSource(int64(n))).Perm(n)
+		q := filledQueue(newQueue, times)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			j := i % n
+			if j == 0 && i > 0 {
+				b.StopTimer()
+				q = filledQueue(newQueue, times)
+				b.StartTimer()
+			}
+			q.Remove(order[j])
+		}
+	})
+}
+
+// BenchmarkReady measures removing the earliest item from a queue
+// of n items with Ready, and adding it again at a later time, so
+// that the queue remains the same size.
+func BenchmarkReady(b *stdtesting.B) {
+	runBenchmarks(b, func(b *stdtesting.B, newQueue func() benchQueue, n int) {
+		q := newQueue()
+		for i := 0; i < n; i++ {
+			q.Add(i, i, benchEpoch.Add(time.Duration(i)))
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ready := q.Ready(benchEpoch.Add(time.Duration(i)))
+			for _, k := range ready {
+				q.Add(k, k, benchEpoch.Add(time.Duration(i+n)))
+			}
+		}
+	})
+}
+
+// BenchmarkNext measures waiting on a queue of n items, whose
+// earliest item is repeatedly moved to the back of the queue, so that
+// each call to Next must reset the queue's timer.
+func BenchmarkNext(b *stdtesting.B) {
+	runBenchmarks(b, func(b *stdtesting.B, newQueue func() benchQueue, n int) {
+		q := newQueue()
+		for i := 0; i < n; i++ {
+			q.Add(i, i, benchEpoch.Add(time.Duration(i)))
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			k := i % n
+			q.Update(k, k, benchEpoch.Add(time.Duration(i+n)))
+			q.Next()
+		}
+	})
+}
+
+// BenchmarkChurn measures a churn-heavy pattern on a queue of n
+// items: random items are rescheduled, or removed and added again,
+// and the next item's time is inspected after each change.
+func BenchmarkChurn(b *stdtesting.B) {
+	runBenchmarks(b, func(b *stdtesting.B, newQueue func() benchQueue, n int) {
+		times := randomTimes(n)
+		q := filledQueue(newQueue, times)
+		rnd := rand.New(rand.NewSource(int64(n)))
+		keys := rnd.Perm(n)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			k := keys[i%n]
+			t := times[(i+k)%n]
+			if i%2 == 0 {
+				q.Update(k, k, t)
+			} else {
+				q.Remove(k)
+				q.Add(k, k, t)
+			}
+			q.NextTime()
+		}
+	})
+}
+
+// BenchmarkReadHeavy measures a read-heavy pattern on a queue of n
+// items: nine in ten operations look up an item or the next item's
+// time, and the remainder reschedule a random item.
+func BenchmarkReadHeavy(b *stdtesting.B) {
+	runBenchmarks(b, func(b *stdtesting.B, newQueue func() benchQueue, n int) {
+		times := randomTimes(n)
+		q := filledQueue(newQueue, times)
+		keys := rand.New(rand.NewSource(int64(n))).Perm(n)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			k := keys[i%n]
+			switch i % 10 {
+			case 0:
+				q.Update(k, k, times[(i+k)%n])
+			case 1, 2, 3:
+				q.NextTime()
+			default:
+				q.Get(k)
+			}
+		}
+	})
+}
+
+// BenchmarkMemory measures filling a queue with n items, and reports
+// the heap memory retained by the queue, per item, as the "B/item"
+// metric.
+func BenchmarkMemory(b *stdtesting.B) {
+	runBenchmarks(b, func(b *stdtesting.B, newQueue func() benchQueue, n int) {
+		times := randomTimes(n)
+		var retained int64
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			before := heapAlloc()
+			b.StartTimer()
+			q := filledQueue(newQueue, times)
+			b.StopTimer()
+			retained += heapAlloc() - before
+			runtime.KeepAlive(q)
+			b.StartTimer()
+		}
+		b.ReportMetric(float64(retained)/float64(b.N)/float64(n), "B/item")
+	})
+}
+
+// heapAlloc returns the number of bytes allocated to live heap
+// objects, after a garbage collection.
+func heapAlloc() int64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
+
+// BenchmarkDelayQueueOffer measures DelayQueue.Offer from GOMAXPROCS
+// concurrent producers, with the values taken by the queue's goroutine
+// meanwhile. Run with -cpu to vary the number of producers.
+func BenchmarkDelayQueueOffer(b *stdtesting.B) {
+	q := timequeue.NewDelayQueue[int](clock.WallClock)
+	defer q.Wait()
+	defer q.Kill()
+	far := time.Now().Add(time.Hour)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *stdtesting.PB) {
+		for i := 0; pb.Next(); i++ {
+			q.Offer(i, far)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// DelayQueue is a queue of values that become available at specified
+// times. Values are offered to the queue with the time at which they
+// are ready, and are sent on the queue's channel, in order of time,
+// as their times are reached. Values ready at the same time are sent
+// in no defined order.
+//
+// DelayQueue holds its values in a Queue, owned by its own goroutine,
+// which sends each value when it is ready, waiting for it to be received
+// before sending the next. Offered values are pushed onto a lock-free
+// intake list, from which the goroutine moves them into the Queue, so
+// that many producers may offer values concurrently without contending
+// on a lock. DelayQueue's methods are safe for concurrent use.
+type DelayQueue[V any] struct {
+	clock clock.Clock
+
+	// queue and seq are accessed only by the loop goroutine.
+	queue *Queue[uint64, V]
+	seq   uint64
+
+	// intake holds the values offered since the loop last took them,
+	// most recent first; len is the number of values offered and not
+	// yet sent, and killed records that the queue has been killed.
+	intake atomic.Pointer[intakeNode[V]]
+	len    atomic.Int64
+	killed atomic.Bool
+
+	out    chan V
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// intakeNode holds an offered value in a DelayQueue's intake list.
+type intakeNode[V any] struct {
+	value   V
+	readyAt time.Time
+	next    *intakeNode[V]
+}
+
+// NewDelayQueue constructs and starts a new DelayQueue, using the given
+// Clock to determine when values are ready. The DelayQueue will send
+// values until it is killed.
+func NewDelayQueue[V any](clock clock.Clock) *DelayQueue[V] {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &DelayQueue[V]{
+		clock:  clock,
+		queue:  New[uint64, V](clock),
+		out:    make(chan V),
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go q.loop()
+	return q
+}
+
+// Offer adds the value to the queue, to be sent on the queue's channel
+// at or after the specified time. A value whose time has already been
+// reached is sent as soon as the values ready before it are received.
+// Once the queue has been killed, Offer does nothing.
+//
+// Offer does not take any locks, and wakes the queue's goroutine only
+// if it has taken all of the values offered previously.
+func (q *DelayQueue[V]) Offer(value V, readyAt time.Time) {
+	if q.killed.Load() {
+		return
+	}
+	q.len.Add(1)
+	n := &intakeNode[V]{value: value, readyAt: readyAt}
+	var prev *intakeNode[V]
+	for {
+		prev = q.intake.Load()
+		n.next = prev
+		if q.intake.CompareAndSwap(prev, n) {
+			break
+		}
+	}
+	if prev != nil {
+		// The loop has yet to take the previous value,
+		// whose offer woke it.
+		return
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Chan returns the channel on which values are sent when they are
+// ready. The channel is closed when the queue has stopped, after
+// being killed.
+func (q *DelayQueue[V]) Chan() <-chan V {
+	return q.out
+}
+
+// Len returns the number of values waiting in the queue, not including
+// a ready value that is waiting to be received. Once the queue has been
+// killed, Len returns zero.
+func (q *DelayQueue[V]) Len() int {
+	if q.killed.Load() {
+		return 0
+	}
+	return int(q.len.Load())
+}
+
+// Kill stops the queue, discarding values that have not yet been
+// sent. Kill does not wait for the queue to stop; use Wait for that.
+func (q *DelayQueue[V]) Kill() {
+	q.killed.Store(true)
+	q.cancel()
+}
+
+// Wait waits for the queue to stop.
+func (q *DelayQueue[V]) Wait() error {
+	<-q.done
+	return nil
+}
+
+func (q *DelayQueue[V]) loop() {
+	defer close(q.done)
+	defer close(q.out)
+	defer func() {
+		q.intake.Store(nil)
+		q.queue.Clear(nil)
+	}()
+	for {
+		q.takeIntake()
+		item, ready := q.queue.PopReady(q.clock.Now())
+		if ready {
+			q.len.Add(-1)
+			select {
+			case <-q.ctx.Done():
+				return
+			case q.out <- item.Value:
+			}
+			continue
+		}
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-q.wake:
+		case <-q.queue.Next():
+		}
+	}
+}
+
+// takeIntake moves the values offered since it was last called from the
+// intake list into the queue, in the order they were offered.
+func (q *DelayQueue[V]) takeIntake() {
+	var reversed *intakeNode[V]
+	for n := q.intake.Swap(nil); n != nil; {
+		next := n.next
+		n.next = reversed
+		reversed, n = n, next
+	}
+	for n := reversed; n != nil; n = n.next {
+		q.seq++
+		q.queue.Add(q.seq, n.value, n.readyAt)
+	}
+}
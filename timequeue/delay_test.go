@@ -0,0 +1,135 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	coretesting "github.com/juju/juju/testing"
+)
+
+type delayQueueSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&delayQueueSuite{})
+
+func (*delayQueueSuite) TestOffer(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	now := clock.Now()
+	q := timequeue.NewDelayQueue[string](clock)
+	defer stopDelayQueue(c, q)
+
+	q.Offer("v0", now.Add(3*time.Second))
+	q.Offer("v1", now.Add(time.Second))
+	q.Offer("v2", now.Add(2*time.Second))
+	assertNotDelivered(c, q)
+
+	clock.Advance(time.Second)
+	c.Assert(receiveValue(c, q), gc.Equals, "v1")
+	assertNotDelivered(c, q)
+	clock.Advance(2 * time.Second)
+	c.Assert(receiveValue(c, q), gc.Equals, "v2")
+	c.Assert(receiveValue(c, q), gc.Equals, "v0")
+	c.Assert(q.Len(), gc.Equals, 0)
+}
+
+func (*delayQueueSuite) TestOfferEarlier(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	now := clock.Now()
+	q := timequeue.NewDelayQueue[string](clock)
+	defer stopDelayQueue(c, q)
+
+	q.Offer("later", now.Add(time.Minute))
+	q.Offer("now", now)
+	c.Assert(receiveValue(c, q), gc.Equals, "now")
+	q.Offer("sooner", now.Add(time.Second))
+	clock.Advance(time.Second)
+	c.Assert(receiveValue(c, q), gc.Equals, "sooner")
+	c.Assert(q.Len(), gc.Equals, 1)
+}
+
+func (*delayQueueSuite) TestDuplicateValues(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	q := timequeue.NewDelayQueue[int](clock)
+	defer stopDelayQueue(c, q)
+
+	for i := 0; i < 3; i++ {
+		q.Offer(1, clock.Now())
+	}
+	for i := 0; i < 3; i++ {
+		c.Assert(receiveValue(c, q), gc.Equals, 1)
+	}
+}
+
+func (*delayQueueSuite) TestConcurrentOffer(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	q := timequeue.NewDelayQueue[int](clock)
+	defer stopDelayQueue(c, q)
+
+	// Values offered concurrently by many producers
+	// are all sent, in order of time.
+	const producers, values = 8, 100
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < values; i++ {
+				v := p*values + i
+				q.Offer(v, clock.Now().Add(time.Duration(v+1)*time.Millisecond))
+			}
+		}(p)
+	}
+	wg.Wait()
+	c.Assert(q.Len(), gc.Equals, producers*values)
+	clock.Advance(time.Duration(producers*values) * time.Millisecond)
+	for v := 0; v < producers*values; v++ {
+		c.Assert(receiveValue(c, q), gc.Equals, v)
+	}
+	c.Assert(q.Len(), gc.Equals, 0)
+}
+
+func (*delayQueueSuite) TestKill(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	q := timequeue.NewDelayQueue[string](clock)
+	q.Offer("ready", clock.Now())
+	q.Offer("pending", clock.Now().Add(time.Second))
+	q.Kill()
+	c.Assert(q.Wait(), jc.ErrorIsNil)
+
+	// The channel is closed, and values are discarded.
+	_, ok := <-q.Chan()
+	c.Assert(ok, jc.IsFalse)
+	q.Offer("late", clock.Now())
+	c.Assert(q.Len(), gc.Equals, 0)
+}
+
+func stopDelayQueue[V any](c *gc.C, q *timequeue.DelayQueue[V]) {
+	q.Kill()
+	c.Assert(q.Wait(), jc.ErrorIsNil)
+}
+
+func receiveValue[V any](c *gc.C, q *timequeue.DelayQueue[V]) V {
+	select {
+	case v := <-q.Chan():
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotDelivered[V any](c *gc.C, q *timequeue.DelayQueue[V]) {
+	select {
+	case v := <-q.Chan():
+		c.Fatalf("unexpected value %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
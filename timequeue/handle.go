@@ -0,0 +1,78 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue
+
+import "time"
+
+// Handle refers to an item added to a queue, so that the item may be
+// cancelled, or awaited, without affecting any other item later added
+// with the same key. A Handle remains valid after its item leaves the
+// queue. See Queue.AddHandle and Queue.Handle.
+//
+// Cancel and Pending must not be called concurrently with the queue's
+// methods; Done and Key may be called at any time.
+type Handle[K comparable, V any] struct {
+	queue *Queue[K, V]
+	item  *queueItem[K, V]
+	done  <-chan struct{}
+}
+
+// Key returns the key of the handle's item.
+func (h *Handle[K, V]) Key() K {
+	return h.item.key
+}
+
+// Pending reports whether the handle's item is still in the queue.
+func (h *Handle[K, V]) Pending() bool {
+	return h.queue.m[h.item.key] == h.item
+}
+
+// Cancel removes the handle's item from the queue, if it is still in
+// the queue, and reports whether or not it was removed.
+func (h *Handle[K, V]) Cancel() bool {
+	if !h.Pending() {
+		return false
+	}
+	h.queue.remove(h.item)
+	return true
+}
+
+// Done returns a channel that is closed when the handle's item leaves
+// the queue: when it is returned by Ready, ReadyN or PopReady, unless
+// it repeats, or when it is removed, evicted or cleared.
+func (h *Handle[K, V]) Done() <-chan struct{} {
+	return h.done
+}
+
+// AddHandle is like Add, but returns a Handle for the added item.
+func (s *Queue[K, V]) AddHandle(key K, value V, t time.Time) *Handle[K, V] {
+	s.Add(key, value, t)
+	h, _ := s.Handle(key)
+	return h
+}
+
+// Handle returns a Handle for the item with the specified key, and a
+// boolean indicating whether or not the item exists. The Handle refers
+// to the item as it is now: if the item is later removed, and another
+// added with the same key, the Handle does not refer to the new item.
+// Updating the item does not affect the Handle.
+func (s *Queue[K, V]) Handle(key K) (*Handle[K, V], bool) {
+	item, ok := s.m[key]
+	if !ok {
+		return nil, false
+	}
+	if item.done == nil {
+		item.done = make(chan struct{})
+	}
+	return &Handle[K, V]{queue: s, item: item, done: item.done}, true
+}
+
+// release closes the channel returned by the Done methods of the
+// item's handles, if any, once the item has left the queue.
+func (item *queueItem[K, V]) release() {
+	if item.done != nil {
+		close(item.done)
+		item.done = nil
+	}
+}
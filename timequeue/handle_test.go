@@ -0,0 +1,88 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue_test
+
+import (
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/timequeue"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+// assertDone asserts whether or not the handle's channel is closed.
+func assertDone[K comparable, V any](c *gc.C, h *timequeue.Handle[K, V], done bool) {
+	select {
+	case <-h.Done():
+		c.Assert(done, jc.IsTrue, gc.Commentf("handle for %v done", h.Key()))
+	default:
+		c.Assert(done, jc.IsFalse, gc.Commentf("handle for %v not done", h.Key()))
+	}
+}
+
+func (*queueSuite) TestHandleCancel(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	h0 := s.AddHandle("k0", "v0", now.Add(time.Second))
+	c.Assert(h0.Key(), gc.Equals, "k0")
+	c.Assert(h0.Pending(), jc.IsTrue)
+	assertDone(c, h0, false)
+
+	// Updating the item does not affect the handle.
+	s.Update("k0", "v1", now.Add(2*time.Second))
+	c.Assert(h0.Pending(), jc.IsTrue)
+
+	c.Assert(h0.Cancel(), jc.IsTrue)
+	c.Assert(h0.Pending(), jc.IsFalse)
+	assertDone(c, h0, true)
+	c.Assert(h0.Cancel(), jc.IsFalse)
+	c.Assert(s.Len(), gc.Equals, 0)
+
+	// A handle does not refer to a later item with the same key.
+	h1 := s.AddHandle("k0", "v2", now.Add(time.Second))
+	c.Assert(h0.Cancel(), jc.IsFalse)
+	c.Assert(s.Len(), gc.Equals, 1)
+	h2, ok := s.Handle("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(h2.Cancel(), jc.IsTrue)
+	assertDone(c, h1, true)
+	_, ok = s.Handle("k0")
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (*queueSuite) TestHandleDone(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	ready := s.AddHandle("k0", "v0", now.Add(time.Second))
+	removed := s.AddHandle("k1", "v1", now.Add(time.Second))
+	removedAll := s.AddHandle("k2", "v2", now.Add(time.Second))
+	cleared := s.AddHandle("k3", "v3", now.Add(2*time.Second))
+	s.AddRepeating("k4", "v4", now.Add(1500*time.Millisecond), time.Second)
+	repeating, _ := s.Handle("k4")
+
+	s.Remove("k1")
+	assertDone(c, removed, true)
+	s.RemoveAll([]string{"k2"})
+	assertDone(c, removedAll, true)
+
+	clock.Advance(1500 * time.Millisecond)
+	assertReady(c, s, clock, "v0", "v4")
+	assertDone(c, ready, true)
+	assertDone(c, repeating, false)
+	assertDone(c, cleared, false)
+
+	// A clone's items are independent of the handles.
+	clone := s.Clone()
+	clone.Clear(nil)
+	assertDone(c, cleared, false)
+
+	s.Clear(nil)
+	assertDone(c, cleared, true)
+	assertDone(c, repeating, true)
+}
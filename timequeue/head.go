@@ -0,0 +1,96 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue
+
+import "time"
+
+// headState records the queue's head, the earliest item, so that
+// consumers waiting on a channel returned by Next can learn when it
+// has become stale.
+type headState[K comparable, V any] struct {
+	// tracking records whether the head is tracked. Tracking starts
+	// with the first call to Next, Generation or HeadChanged, so that
+	// queues that are never waited on do not pay for it.
+	tracking bool
+
+	// item and t are the head item, or nil,
+	// and its time when it became the head.
+	item *queueItem[K, V]
+	t    time.Time
+
+	// generation is incremented each time the head changes.
+	generation uint64
+
+	// changed, if non-nil, is closed when the head next changes.
+	changed chan struct{}
+}
+
+// Generation returns the queue's head generation: a counter that is
+// incremented whenever the head of the queue changes, that is whenever
+// a different item becomes the earliest, the earliest item's time
+// changes, or the queue becomes empty or non-empty. Items added,
+// updated or removed behind the head do not change the generation.
+//
+// A channel returned by Next is valid only for the generation in which
+// it was returned: once the generation changes, the channel may send
+// even though no item is ready, or not send until after an item that
+// has since become earlier is ready. A consumer that records the
+// generation along with the channel may compare it on waking, and call
+// Next again if it has changed; see also HeadChanged.
+func (s *Queue[K, V]) Generation() uint64 {
+	s.trackHead()
+	return s.head.generation
+}
+
+// HeadChanged returns a channel that is closed when the head of the
+// queue next changes, as described for Generation. A consumer waiting
+// on a channel returned by Next should also wait on HeadChanged, and
+// call Next again when it is closed, so that it does not sleep past an
+// item that has become earlier than the one it was waiting for.
+//
+// The channel is closed by the call that modifies the queue, so a
+// consumer that modifies the queue from another goroutine must
+// synchronise with the consumer waiting on it, as for any use of the
+// queue.
+func (s *Queue[K, V]) HeadChanged() <-chan struct{} {
+	s.trackHead()
+	if s.head.changed == nil {
+		s.head.changed = make(chan struct{})
+	}
+	return s.head.changed
+}
+
+// trackHead starts tracking the head of the queue, if it is not
+// already tracked.
+func (s *Queue[K, V]) trackHead() {
+	if s.head.tracking {
+		return
+	}
+	s.head.tracking = true
+	if first := s.order.first(); first != nil {
+		s.head.item, s.head.t = first, first.t
+	}
+}
+
+// checkHead records a change of the head of the queue, if it is
+// tracked, after the queue has been modified.
+func (s *Queue[K, V]) checkHead() {
+	if !s.head.tracking {
+		return
+	}
+	first := s.order.first()
+	var t time.Time
+	if first != nil {
+		t = first.t
+	}
+	if first == s.head.item && t.Equal(s.head.t) {
+		return
+	}
+	s.head.item, s.head.t = first, t
+	s.head.generation++
+	if s.head.changed != nil {
+		close(s.head.changed)
+		s.head.changed = nil
+	}
+}
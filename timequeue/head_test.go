@@ -0,0 +1,142 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue_test
+
+import (
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/timequeue"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	coretesting "github.com/juju/juju/testing"
+)
+
+type headSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&headSuite{})
+
+func (*headSuite) TestGeneration(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	gen := s.Generation()
+	assertGeneration := func(changed bool) {
+		next := s.Generation()
+		if changed {
+			c.Assert(next, gc.Not(gc.Equals), gen)
+		} else {
+			c.Assert(next, gc.Equals, gen)
+		}
+		gen = next
+	}
+
+	s.Add("k0", "v0", now.Add(3*time.Second))
+	assertGeneration(true)
+	s.Add("k1", "v1", now.Add(4*time.Second)) // behind the head
+	assertGeneration(false)
+	s.Add("k2", "v2", now.Add(time.Second)) // earlier than the head
+	assertGeneration(true)
+	s.Update("k2", "v2", now.Add(2*time.Second)) // head's time changed
+	assertGeneration(true)
+	s.Remove("k1") // behind the head
+	assertGeneration(false)
+	s.Remove("k2") // the head
+	assertGeneration(true)
+	s.RemoveAll([]string{"k3"})
+	assertGeneration(false)
+
+	clock.Advance(3 * time.Second)
+	c.Assert(s.Ready(clock.Now()), jc.DeepEquals, []string{"v0"})
+	assertGeneration(true)
+
+	s.AddAll([]timequeue.Item[string, string]{
+		{Key: "k0", Value: "v0", Time: now},
+		{Key: "k1", Value: "v1", Time: now.Add(time.Second)},
+	})
+	assertGeneration(true)
+	s.Clear(nil)
+	assertGeneration(true)
+	s.Clear(nil)
+	assertGeneration(false)
+}
+
+func (*headSuite) TestHeadChanged(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(3*time.Second))
+	changed := s.HeadChanged()
+	c.Assert(s.HeadChanged(), gc.Equals, changed)
+	next := s.Next()
+	clocktesting.ExpectTimer(c, clock, 3*time.Second)
+
+	// Adding an item behind the head does not
+	// invalidate the channel returned by Next.
+	s.Add("k1", "v1", now.Add(4*time.Second))
+	assertNotClosed(c, changed)
+
+	// A consumer waiting on the channel returned by Next
+	// learns that an earlier item has been added, rather
+	// than sleeping past it.
+	s.Add("k2", "v2", now.Add(time.Second))
+	assertClosed(c, changed)
+
+	changed = s.HeadChanged()
+	next = s.Next()
+	clocktesting.ExpectTimer(c, clock, time.Second)
+	clock.Advance(time.Second)
+	clocktesting.ExpectSignalled(c, next)
+	c.Assert(s.Ready(clock.Now()), jc.DeepEquals, []string{"v2"})
+	assertClosed(c, changed)
+
+	// Removing the head likewise closes the channel, so that a
+	// consumer need not wake at its time to process nothing.
+	changed = s.HeadChanged()
+	s.Remove("k0")
+	assertClosed(c, changed)
+}
+
+func (*headSuite) TestWheelBackend(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s, err := timequeue.NewWithConfig[string, string](timequeue.Config{
+		Clock:   clock,
+		Backend: timequeue.BackendWheel,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.Add("k0", "v0", now.Add(10*time.Second))
+	changed := s.HeadChanged()
+	s.Add("k1", "v1", now.Add(20*time.Second))
+	assertNotClosed(c, changed)
+	s.Add("k2", "v2", now.Add(5*time.Second))
+	assertClosed(c, changed)
+
+	// Switching backends does not change the head.
+	changed = s.HeadChanged()
+	s.SetBackend(timequeue.BackendHeap)
+	assertNotClosed(c, changed)
+}
+
+func assertClosed(c *gc.C, ch <-chan struct{}) {
+	select {
+	case <-ch:
+	default:
+		c.Fatalf("channel not closed")
+	}
+}
+
+func assertNotClosed(c *gc.C, ch <-chan struct{}) {
+	select {
+	case <-ch:
+		c.Fatalf("channel closed")
+	default:
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue
+
+import "unsafe"
+
+// Sizer may be implemented by queued values to report the approximate
+// number of bytes that they reference, beyond the value itself; for
+// example, a pointer's Size method would report the size of the value
+// pointed to, and anything it references in turn.
+type Sizer interface {
+	Size() int
+}
+
+// MemoryUsage describes the approximate memory used by a queue.
+type MemoryUsage struct {
+	// Items is the number of queued items.
+	Items int
+
+	// Sized is the number of queued values that implement Sizer.
+	Sized int
+
+	// Bytes is the approximate number of bytes used by the queue's
+	// items: the queue's own bookkeeping for them, their keys and
+	// values, and the sizes reported by values implementing Sizer.
+	// Memory referenced by values not implementing Sizer is not
+	// included.
+	Bytes int64
+}
+
+// Add returns the sum of two usages; it may be used to total the usage
+// of several queues.
+func (u MemoryUsage) Add(other MemoryUsage) MemoryUsage {
+	return MemoryUsage{
+		Items: u.Items + other.Items,
+		Sized: u.Sized + other.Sized,
+		Bytes: u.Bytes + other.Bytes,
+	}
+}
+
+// MemoryUsage returns an estimate of the memory used by the queue's
+// items. If V implements Sizer, or is an interface type, MemoryUsage
+// takes time proportional to the number of items, as each value is
+// examined; otherwise it takes constant time.
+func (s *Queue[K, V]) MemoryUsage() MemoryUsage {
+	n := s.order.len()
+	usage := MemoryUsage{
+		Items: n,
+		Bytes: int64(n) * s.itemOverhead(),
+	}
+	var zero V
+	if _, ok := any(zero).(Sizer); !ok && !isInterface[V]() {
+		return usage
+	}
+	s.order.each(func(item *queueItem[K, V]) {
+		if sizer, ok := any(item.value).(Sizer); ok {
+			usage.Sized++
+			usage.Bytes += int64(sizer.Size())
+		}
+	})
+	return usage
+}
+
+// mapEntryOverhead approximates the bytes used by the map for each
+// entry, beyond the key and value: control bytes, and the free slots
+// kept by the map's load factor.
+const mapEntryOverhead = 8
+
+// itemOverhead returns the approximate number of bytes used for each
+// item, including its key and value, but not memory they reference.
+func (s *Queue[K, V]) itemOverhead() int64 {
+	var item queueItem[K, V]
+	var ptr *queueItem[K, V]
+	// The item itself; its pointer in the map, alongside its key;
+	// and its pointers in the heaps, or the timing wheel.
+	size := unsafe.Sizeof(item)
+	size += unsafe.Sizeof(item.key) + unsafe.Sizeof(ptr) + mapEntryOverhead
+	size += unsafe.Sizeof(ptr)
+	if s.evict != nil {
+		size += unsafe.Sizeof(ptr)
+	}
+	return int64(size)
+}
+
+// isInterface reports whether V is an interface type, whose
+// values' dynamic types may implement Sizer.
+func isInterface[V any]() bool {
+	var zero V
+	// Only interface types have a nil zero value that is
+	// also nil when converted to any.
+	return any(zero) == nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/axw/juju-time/timequeue"
+	coretesting "github.com/juju/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type memorySuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&memorySuite{})
+
+type sized struct {
+	data []byte
+}
+
+func (s *sized) Size() int {
+	return len(s.data)
+}
+
+func (*memorySuite) TestMemoryUsage(c *gc.C) {
+	q := timequeue.New[int, int](coretesting.NewClock(time.Time{}))
+	c.Assert(q.MemoryUsage(), gc.Equals, timequeue.MemoryUsage{})
+	for i := 0; i < 10; i++ {
+		q.Add(i, i, time.Time{})
+	}
+	usage := q.MemoryUsage()
+	c.Assert(usage.Items, gc.Equals, 10)
+	c.Assert(usage.Sized, gc.Equals, 0)
+	// Each item needs at least its key, value and time.
+	c.Assert(usage.Bytes >= 10*(8+8+24), gc.Equals, true, gc.Commentf("%d", usage.Bytes))
+
+	// Eviction ordering adds to the overhead.
+	q.SetEvictionOrder(func(a, b timequeue.Item[int, int]) bool {
+		return a.Key < b.Key
+	})
+	c.Assert(q.MemoryUsage().Bytes > usage.Bytes, gc.Equals, true)
+
+	q.Remove(0)
+	c.Assert(q.MemoryUsage().Items, gc.Equals, 9)
+	q.Clear(nil)
+	c.Assert(q.MemoryUsage(), gc.Equals, timequeue.MemoryUsage{})
+}
+
+func (*memorySuite) TestMemoryUsageSizer(c *gc.C) {
+	q := timequeue.New[string, *sized](coretesting.NewClock(time.Time{}))
+	for i := 0; i < 4; i++ {
+		q.Add(fmt.Sprint(i), &sized{make([]byte, 1000)}, time.Time{})
+	}
+	usage := q.MemoryUsage()
+	c.Assert(usage.Items, gc.Equals, 4)
+	c.Assert(usage.Sized, gc.Equals, 4)
+	c.Assert(usage.Bytes > 4000, gc.Equals, true)
+
+	// The dynamic types of interface values are examined.
+	iq := timequeue.New[string, interface{}](coretesting.NewClock(time.Time{}))
+	iq.Add("sized", &sized{make([]byte, 1000)}, time.Time{})
+	iq.Add("unsized", 123, time.Time{})
+	usage = iq.MemoryUsage()
+	c.Assert(usage.Items, gc.Equals, 2)
+	c.Assert(usage.Sized, gc.Equals, 1)
+	c.Assert(usage.Bytes > 1000, gc.Equals, true)
+
+	total := usage.Add(timequeue.MemoryUsage{Items: 1, Sized: 1, Bytes: 10})
+	c.Assert(total, gc.Equals, timequeue.MemoryUsage{Items: 3, Sized: 2, Bytes: usage.Bytes + 10})
+}
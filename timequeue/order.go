@@ -0,0 +1,111 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue
+
+import (
+	"container/heap"
+	"time"
+)
+
+// order orders a queue's items by time. The queue's map of items by
+// key, and its eviction order, are maintained by the queue itself.
+type order[K comparable, V any] interface {
+	// backend returns the backend implemented by the order.
+	backend() Backend
+
+	// len returns the number of items.
+	len() int
+
+	// first returns the earliest item, or nil if there are none.
+	first() *queueItem[K, V]
+
+	// push adds an item.
+	push(item *queueItem[K, V])
+
+	// pushAll adds all of the items, as cheaply as possible.
+	pushAll(items []*queueItem[K, V])
+
+	// remove removes an item.
+	remove(item *queueItem[K, V])
+
+	// fix reorders an item after its time has changed.
+	fix(item *queueItem[K, V])
+
+	// due calls f with each item at or before t, in no
+	// particular order.
+	due(t time.Time, f func(item *queueItem[K, V]))
+
+	// each calls f with each item, in no particular order.
+	each(f func(item *queueItem[K, V]))
+}
+
+// heapOrder orders items in a binary heap.
+type heapOrder[K comparable, V any] struct {
+	items queueItems[K, V]
+}
+
+func (h *heapOrder[K, V]) backend() Backend {
+	return BackendHeap
+}
+
+func (h *heapOrder[K, V]) len() int {
+	return len(h.items)
+}
+
+func (h *heapOrder[K, V]) first() *queueItem[K, V] {
+	if len(h.items) == 0 {
+		return nil
+	}
+	return h.items[0]
+}
+
+func (h *heapOrder[K, V]) push(item *queueItem[K, V]) {
+	heap.Push(&h.items, item)
+}
+
+func (h *heapOrder[K, V]) pushAll(items []*queueItem[K, V]) {
+	if len(items) < len(h.items)/4 {
+		// Relatively few items: pushing each costs O(log(n)),
+		// which is cheaper than rebuilding the entire heap.
+		for _, item := range items {
+			h.push(item)
+		}
+		return
+	}
+	h.items = append(h.items, items...)
+	for i, item := range h.items {
+		item.i = i
+	}
+	heap.Init(&h.items)
+}
+
+func (h *heapOrder[K, V]) remove(item *queueItem[K, V]) {
+	heap.Remove(&h.items, item.i)
+}
+
+func (h *heapOrder[K, V]) fix(item *queueItem[K, V]) {
+	heap.Fix(&h.items, item.i)
+}
+
+func (h *heapOrder[K, V]) due(t time.Time, f func(item *queueItem[K, V])) {
+	h.items.due(0, t, f)
+}
+
+func (h *heapOrder[K, V]) each(f func(item *queueItem[K, V])) {
+	for _, item := range h.items {
+		f(item)
+	}
+}
+
+// due calls f with each item at or before t, in the subtree
+// of the heap rooted at index i.
+func (s queueItems[K, V]) due(i int, t time.Time, f func(item *queueItem[K, V])) {
+	if i >= len(s) || s[i].t.After(t) {
+		// No descendants of a later item can be due.
+		return
+	}
+	f(s[i])
+	s.due(2*i+1, t, f)
+	s.due(2*i+2, t, f)
+}
@@ -5,6 +5,7 @@ package timequeue
 
 import (
 	"container/heap"
+	"sort"
 	"time"
 
 	"github.com/axw/juju-time/clock"
@@ -17,97 +18,570 @@ import (
 //  - fast to add and remove items by key: O(log(n)); n is the total number of items
 //  - fast to identify the next queued item: O(log(n))
 //  - fast to remove arbitrary items: O(log(n))
-type Queue struct {
-	time  clock.Clock
-	items queueItems
-	m     map[interface{}]*queueItem
+//  - items may repeat at a fixed interval; see AddRepeating
+//  - items may be scheduled relative to others; see AddAfterKey
+//
+// The costs above are those of the default heap backend; see Backend
+// for the alternatives.
+//
+// Queue is parameterised over the key type K and the value type V.
+type Queue[K comparable, V any] struct {
+	time   clock.Clock
+	config Config
+	order  order[K, V]
+	m      map[K]*queueItem[K, V]
+
+	// adapt holds the state of an adaptive queue's
+	// backend selection, or nil.
+	adapt *adaptState
+
+	// timer is reused by Next, so waiting on the queue does not
+	// allocate a new timer each time.
+	timer clock.Timer
+
+	// evict, if non-nil, orders the items for eviction.
+	evict *evictionItems[K, V]
+
+	// head tracks the earliest item, for Generation and
+	// HeadChanged.
+	head headState[K, V]
+
+	// deps, if non-nil, records the items that follow
+	// others; see AddAfterKey.
+	deps *dependencies[K]
 }
 
 // New constructs a new queue, using the given Clock for the Next
 // method.
-func New(clock clock.Clock) *Queue {
-	return &Queue{
-		time: clock,
-		m:    make(map[interface{}]*queueItem),
+func New[K comparable, V any](clock clock.Clock) *Queue[K, V] {
+	return &Queue[K, V]{
+		time:  clock,
+		order: &heapOrder[K, V]{},
+		m:     make(map[K]*queueItem[K, V]),
 	}
 }
 
 // Next returns a channel which will send after the next queued item's time
 // has been reached. If there are no queued items, nil is returned.
-func (s *Queue) Next() <-chan time.Time {
-	if len(s.items) > 0 {
-		return s.time.After(s.items[0].t.Sub(s.time.Now()))
+//
+// The queue reuses a single timer for Next, so a channel returned by an
+// earlier call to Next should not be waited on after calling Next again.
+// The channel is not updated when the head of the queue changes; see
+// Generation and HeadChanged.
+//
+// If the queue coalesces wakeups, the channel may send later than the
+// next queued item's time; see Config.WakeupWindow.
+func (s *Queue[K, V]) Next() <-chan time.Time {
+	s.trackHead()
+	first := s.order.first()
+	if first == nil {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		return nil
+	}
+	d := s.wakeTime(first).Sub(s.time.Now())
+	if s.timer == nil {
+		s.timer = clock.NewTimer(s.time, d)
+	} else {
+		s.timer.Reset(d)
+	}
+	return s.timer.Chan()
+}
+
+// NextTime returns the time of the next queued item, and a boolean
+// indicating whether or not there are any queued items.
+func (s *Queue[K, V]) NextTime() (time.Time, bool) {
+	if first := s.order.first(); first != nil {
+		return first.t, true
 	}
-	return nil
+	return time.Time{}, false
+}
+
+// NextWakeTime returns the time at which the channel returned by Next
+// would send, and a boolean indicating whether or not there are any
+// queued items. This is the time of the next queued item, unless the
+// queue coalesces wakeups; see Config.WakeupWindow.
+func (s *Queue[K, V]) NextWakeTime() (time.Time, bool) {
+	if first := s.order.first(); first != nil {
+		return s.wakeTime(first), true
+	}
+	return time.Time{}, false
+}
+
+// wakeTime returns the time at which the queue should wake for the
+// first item: the latest time of the items queued within WakeupWindow
+// of it. wakeTime takes time proportional to the number of those items.
+func (s *Queue[K, V]) wakeTime(first *queueItem[K, V]) time.Time {
+	wake := first.t
+	if s.config.WakeupWindow > 0 {
+		s.order.due(first.t.Add(s.config.WakeupWindow), func(item *queueItem[K, V]) {
+			if item.t.After(wake) {
+				wake = item.t
+			}
+		})
+	}
+	return wake
 }
 
 // Ready returns the parameters for items that are queued at or before
 // "now", and removes them from the queue. The resulting slices are in
 // order of time; items queued for the same time have no defined relative
 // order.
-func (s *Queue) Ready(now time.Time) []interface{} {
-	var ready []interface{}
-	for len(s.items) > 0 && !s.items[0].t.After(now) {
-		item := heap.Pop(&s.items).(*queueItem)
-		delete(s.m, item.key)
+//
+// Repeating items are not removed, but requeued for their next time
+// after "now"; see AddRepeating.
+func (s *Queue[K, V]) Ready(now time.Time) []V {
+	return s.ReadyN(now, -1)
+}
+
+// ReadyN is like Ready, but returns at most n items, leaving any other
+// ready items in the queue. If n is negative, there is no limit.
+func (s *Queue[K, V]) ReadyN(now time.Time, n int) []V {
+	var ready []V
+	for len(ready) != n {
+		item := s.order.first()
+		if item == nil || item.t.After(now) {
+			break
+		}
+		s.pop(item, now)
 		ready = append(ready, item.value)
 	}
 	return ready
 }
 
+// PopReady removes and returns the next queued item, if it is queued
+// at or before "now". The boolean result reports whether or not an
+// item was returned. As with Ready, a repeating item is requeued rather
+// than removed; the returned item holds the time for which it was
+// queued.
+func (s *Queue[K, V]) PopReady(now time.Time) (Item[K, V], bool) {
+	item := s.order.first()
+	if item == nil || item.t.After(now) {
+		return Item[K, V]{}, false
+	}
+	popped := item.item()
+	s.pop(item, now)
+	return popped, true
+}
+
+// Due returns the items that are queued at or before t, in order of
+// time, without removing them from the queue. Due takes time proportional
+// to the number of items returned, plus sorting them.
+func (s *Queue[K, V]) Due(t time.Time) []Item[K, V] {
+	var due []Item[K, V]
+	s.order.due(t, func(item *queueItem[K, V]) {
+		due = append(due, item.item())
+	})
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].Time.Before(due[j].Time)
+	})
+	return due
+}
+
 // Add adds an item with the specified value, with the corresponding key
 // and time to the queue. Add will panic if there already exists an item
 // with the same key.
-func (s *Queue) Add(key, value interface{}, t time.Time) {
+func (s *Queue[K, V]) Add(key K, value V, t time.Time) {
 	if _, ok := s.m[key]; ok {
 		panic(errors.Errorf("duplicate key %v", key))
 	}
-	item := &queueItem{key: key, value: value, t: t}
-	s.m[key] = item
-	heap.Push(&s.items, item)
+	s.push(&queueItem[K, V]{key: key, value: value, t: t})
+}
+
+// AddRepeating is like Add, but the item repeats: when it is returned
+// by Ready, ReadyN or PopReady, it is requeued for the earliest time
+// t + n*interval that is after "now", rather than being removed.
+// Times are computed from t, rather than from when the item was ready,
+// so that the repetitions do not drift; occurrences missed entirely,
+// such as while the consumer was not calling Ready, are skipped.
+// Removing the item cancels its repetition. AddRepeating will panic if
+// interval is not positive, or if there already exists an item with
+// the same key.
+func (s *Queue[K, V]) AddRepeating(key K, value V, t time.Time, interval time.Duration) {
+	if interval <= 0 {
+		panic(errors.NotValidf("non-positive interval %v", interval))
+	}
+	if _, ok := s.m[key]; ok {
+		panic(errors.Errorf("duplicate key %v", key))
+	}
+	s.push(&queueItem[K, V]{key: key, value: value, t: t, interval: interval})
+}
+
+// Len returns the number of items in the queue.
+func (s *Queue[K, V]) Len() int {
+	return s.order.len()
+}
+
+// Get returns the value and time of the item with the specified key,
+// and a boolean indicating whether or not the item exists.
+func (s *Queue[K, V]) Get(key K) (V, time.Time, bool) {
+	item, ok := s.m[key]
+	if !ok {
+		var zero V
+		return zero, time.Time{}, false
+	}
+	return item.value, item.t, true
+}
+
+// Update replaces the value and time of the item with the specified
+// key, and reports whether or not the item exists. If no item with
+// the specified key exists, this is a no-op. A repeating item keeps
+// its interval, and repeats from the new time. An item added with
+// AddAfterKey stops following the other item; any items following
+// the updated item are moved with it.
+func (s *Queue[K, V]) Update(key K, value V, t time.Time) bool {
+	item, ok := s.m[key]
+	if !ok {
+		return false
+	}
+	s.detach(key, false)
+	item.value = value
+	item.t = t
+	s.fix(item)
+	s.observe()
+	return true
+}
+
+// Item describes an item to add to a queue with AddAll.
+type Item[K comparable, V any] struct {
+	Key   K
+	Value V
+	Time  time.Time
+}
+
+// AddAll adds all of the specified items to the queue. AddAll is
+// equivalent to calling Add for each item, but is cheaper for large
+// numbers of items, as the queue is reordered at most once. AddAll
+// will panic if any item's key is already in the queue, or if the
+// same key appears more than once in items; in that case the queue
+// is left unmodified.
+func (s *Queue[K, V]) AddAll(items []Item[K, V]) {
+	seen := make(map[K]bool, len(items))
+	for _, item := range items {
+		if _, ok := s.m[item.Key]; ok || seen[item.Key] {
+			panic(errors.Errorf("duplicate key %v", item.Key))
+		}
+		seen[item.Key] = true
+	}
+	qitems := make([]*queueItem[K, V], len(items))
+	for i, item := range items {
+		qitem := &queueItem[K, V]{key: item.Key, value: item.Value, t: item.Time}
+		s.m[item.Key] = qitem
+		qitems[i] = qitem
+	}
+	s.order.pushAll(qitems)
+	if s.evict != nil {
+		s.evict.pushAll(qitems)
+	}
+	s.observeN(len(items))
+	s.checkHead()
 }
 
 // Remove removes the item corresponding to the specified key from the
-// queue. If no item with the specified key exists, this is a no-op.
-func (s *Queue) Remove(key interface{}) {
-	if item, ok := s.m[key]; ok {
-		heap.Remove(&s.items, item.i)
-		delete(s.m, key)
+// queue, and returns its value and a boolean indicating whether or not
+// it existed. If no item with the specified key exists, this is a no-op.
+func (s *Queue[K, V]) Remove(key K) (V, bool) {
+	item, ok := s.m[key]
+	if !ok {
+		var zero V
+		return zero, false
 	}
+	s.remove(item)
+	return item.value, true
 }
 
-type queueItems []*queueItem
+// Clone returns an independent copy of the queue, using the same
+// Clock and eviction order. Values are copied as if by assignment.
+func (s *Queue[K, V]) Clone() *Queue[K, V] {
+	clone := &Queue[K, V]{
+		time:   s.time,
+		config: s.config,
+		order:  s.newOrder(s.order.backend()),
+		m:      make(map[K]*queueItem[K, V], len(s.m)),
+	}
+	if s.adapt != nil {
+		adapt := *s.adapt
+		clone.adapt = &adapt
+	}
+	clone.deps = s.deps.clone()
+	items := make([]*queueItem[K, V], 0, len(s.m))
+	s.order.each(func(item *queueItem[K, V]) {
+		itemCopy := *item
+		itemCopy.done = nil
+		items = append(items, &itemCopy)
+		clone.m[item.key] = &itemCopy
+	})
+	clone.order.pushAll(items)
+	if s.evict != nil {
+		clone.evict = &evictionItems[K, V]{
+			items: make([]*queueItem[K, V], len(s.evict.items)),
+			less:  s.evict.less,
+		}
+		for j, item := range s.evict.items {
+			clone.evict.items[j] = clone.m[item.key]
+		}
+	}
+	return clone
+}
 
-type queueItem struct {
-	i     int
-	key   interface{}
-	value interface{}
-	t     time.Time
+// SetClock sets the clock that the queue uses for Next, such as for a
+// clone that should measure time independently of the original queue.
+// A channel returned by Next before SetClock is no longer valid.
+func (s *Queue[K, V]) SetClock(clock clock.Clock) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.time = clock
+}
+
+// Clear removes all items from the queue. If f is non-nil, it is called
+// with the key and value of each removed item, in no particular order,
+// after the queue has been emptied.
+func (s *Queue[K, V]) Clear(f func(key K, value V)) {
+	items := s.order
+	s.order = s.newOrder(items.backend())
+	s.m = make(map[K]*queueItem[K, V])
+	s.deps = nil
+	if s.evict != nil {
+		s.evict.items = nil
+	}
+	s.checkHead()
+	items.each(func(item *queueItem[K, V]) {
+		item.release()
+		if f != nil {
+			f(item.key, item.value)
+		}
+	})
 }
 
-func (s queueItems) Len() int {
+// RemoveAll removes the items corresponding to the specified keys from
+// the queue. Keys that do not correspond to an item are ignored. Like
+// AddAll, RemoveAll reorders the queue at most once.
+func (s *Queue[K, V]) RemoveAll(keys []K) {
+	var removed int
+	for _, key := range keys {
+		if item, ok := s.m[key]; ok {
+			delete(s.m, key)
+			s.detach(key, true)
+			item.release()
+			removed++
+		}
+	}
+	if removed == 0 {
+		return
+	}
+	s.rebuild(s.order.backend())
+	s.observeN(removed)
+	s.checkHead()
+}
+
+// SetEvictionOrder sets the order in which items will be returned by
+// Evict: the first item in eviction order is one for which less(item,
+// other) is true for all other items. The eviction order is independent
+// of the items' time order, and is maintained by the queue as items
+// are added and removed, at an additional cost of O(log(n)) for each
+// operation.
+//
+// If less is nil, the eviction order is cleared, and Evict will no
+// longer return items.
+func (s *Queue[K, V]) SetEvictionOrder(less func(a, b Item[K, V]) bool) {
+	if less == nil {
+		s.evict = nil
+		return
+	}
+	s.evict = &evictionItems[K, V]{less: less}
+	s.order.each(func(item *queueItem[K, V]) {
+		s.evict.items = append(s.evict.items, item)
+	})
+	s.evict.init()
+}
+
+// PeekEvict returns the first item in eviction order without removing
+// it from the queue. The boolean result reports whether or not such an
+// item exists; PeekEvict returns false if the queue is empty, or if no
+// eviction order has been set.
+func (s *Queue[K, V]) PeekEvict() (Item[K, V], bool) {
+	if s.evict == nil || len(s.evict.items) == 0 {
+		return Item[K, V]{}, false
+	}
+	return s.evict.items[0].item(), true
+}
+
+// Evict removes and returns the first item in eviction order. The
+// boolean result reports whether or not an item was removed.
+func (s *Queue[K, V]) Evict() (Item[K, V], bool) {
+	if s.evict == nil || len(s.evict.items) == 0 {
+		return Item[K, V]{}, false
+	}
+	item := s.evict.items[0]
+	s.remove(item)
+	return item.item(), true
+}
+
+// push adds the item to the queue.
+func (s *Queue[K, V]) push(item *queueItem[K, V]) {
+	s.m[item.key] = item
+	s.order.push(item)
+	if s.evict != nil {
+		heap.Push(s.evict, item)
+	}
+	s.observe()
+	s.checkHead()
+}
+
+// pop removes the item, which is ready at "now", from the queue; or,
+// if the item repeats, requeues it for its next time after "now".
+func (s *Queue[K, V]) pop(item *queueItem[K, V], now time.Time) {
+	if item.interval <= 0 {
+		s.remove(item)
+		return
+	}
+	n := now.Sub(item.t)/item.interval + 1
+	item.t = item.t.Add(n * item.interval)
+	s.fix(item)
+	s.observe()
+}
+
+// fix reorders the item after its time has changed,
+// moving any items that follow it.
+func (s *Queue[K, V]) fix(item *queueItem[K, V]) {
+	s.order.fix(item)
+	if s.evict != nil {
+		heap.Fix(s.evict, item.j)
+	}
+	s.moveDependents(item)
+	s.checkHead()
+}
+
+// remove removes the item from the queue.
+func (s *Queue[K, V]) remove(item *queueItem[K, V]) {
+	s.order.remove(item)
+	if s.evict != nil {
+		heap.Remove(s.evict, item.j)
+	}
+	delete(s.m, item.key)
+	s.detach(item.key, true)
+	s.observe()
+	s.checkHead()
+	item.release()
+}
+
+// rebuild reorders the items in the queue's map with a new order of
+// the specified backend, discarding the current order, and rebuilds
+// the eviction order.
+func (s *Queue[K, V]) rebuild(backend Backend) {
+	items := make([]*queueItem[K, V], 0, len(s.m))
+	for _, item := range s.m {
+		items = append(items, item)
+	}
+	s.order = s.newOrder(backend)
+	s.order.pushAll(items)
+	if s.evict != nil {
+		clear(s.evict.items)
+		s.evict.items = append(s.evict.items[:0], items...)
+		s.evict.init()
+	}
+}
+
+type queueItems[K comparable, V any] []*queueItem[K, V]
+
+type queueItem[K comparable, V any] struct {
+	i        int // index in the queue's order
+	j        int // index in Queue.evict
+	slot     int // slot in a timing wheel; see wheelOrder
+	key      K
+	value    V
+	t        time.Time
+	interval time.Duration
+
+	// done, if non-nil, is closed when the item leaves
+	// the queue; see Handle.
+	done chan struct{}
+}
+
+func (item *queueItem[K, V]) item() Item[K, V] {
+	return Item[K, V]{Key: item.key, Value: item.value, Time: item.t}
+}
+
+func (s queueItems[K, V]) Len() int {
 	return len(s)
 }
 
-func (s queueItems) Less(i, j int) bool {
+func (s queueItems[K, V]) Less(i, j int) bool {
 	return s[i].t.Before(s[j].t)
 }
 
-func (s queueItems) Swap(i, j int) {
+func (s queueItems[K, V]) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 	s[i].i = i
 	s[j].i = j
 }
 
-func (s *queueItems) Push(x interface{}) {
-	item := x.(*queueItem)
+func (s *queueItems[K, V]) Push(x interface{}) {
+	item := x.(*queueItem[K, V])
 	item.i = len(*s)
 	*s = append(*s, item)
 }
 
-func (s *queueItems) Pop() interface{} {
+func (s *queueItems[K, V]) Pop() interface{} {
 	n := len(*s) - 1
 	x := (*s)[n]
 	*s = (*s)[:n]
 	return x
 }
+
+// evictionItems is a heap of queue items in eviction order.
+type evictionItems[K comparable, V any] struct {
+	items []*queueItem[K, V]
+	less  func(a, b Item[K, V]) bool
+}
+
+func (s *evictionItems[K, V]) Len() int {
+	return len(s.items)
+}
+
+func (s *evictionItems[K, V]) Less(i, j int) bool {
+	return s.less(s.items[i].item(), s.items[j].item())
+}
+
+func (s *evictionItems[K, V]) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.items[i].j = i
+	s.items[j].j = j
+}
+
+func (s *evictionItems[K, V]) Push(x interface{}) {
+	item := x.(*queueItem[K, V])
+	item.j = len(s.items)
+	s.items = append(s.items, item)
+}
+
+// pushAll adds all of the items, as cheaply as possible.
+func (s *evictionItems[K, V]) pushAll(items []*queueItem[K, V]) {
+	if len(items) < len(s.items)/4 {
+		for _, item := range items {
+			heap.Push(s, item)
+		}
+		return
+	}
+	s.items = append(s.items, items...)
+	s.init()
+}
+
+// init orders the items after arbitrary modification.
+func (s *evictionItems[K, V]) init() {
+	for j, item := range s.items {
+		item.j = j
+	}
+	heap.Init(s)
+}
+
+func (s *evictionItems[K, V]) Pop() interface{} {
+	n := len(s.items) - 1
+	x := s.items[n]
+	s.items[n] = nil
+	s.items = s.items[:n]
+	return x
+}
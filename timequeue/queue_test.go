@@ -4,8 +4,10 @@
 package timequeue_test
 
 import (
+	"fmt"
 	"time"
 
+	clocktesting "github.com/axw/juju-time/clock/testing"
 	"github.com/axw/juju-time/timequeue"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -20,46 +22,47 @@ type queueSuite struct {
 var _ = gc.Suite(&queueSuite{})
 
 func (*queueSuite) TestNextNoEvents(c *gc.C) {
-	s := timequeue.New(coretesting.NewClock(time.Time{}))
+	s := timequeue.New[string, string](clocktesting.NewClock(time.Time{}))
 	next := s.Next()
 	c.Assert(next, gc.IsNil)
 }
 
 func (*queueSuite) TestNext(c *gc.C) {
-	clock := coretesting.NewClock(time.Time{})
+	clock := clocktesting.NewClock(time.Time{})
 	now := clock.Now()
-	s := timequeue.New(clock)
+	s := timequeue.New[string, string](clock)
 
 	s.Add("k0", "v0", now.Add(3*time.Second))
 	s.Add("k1", "v1", now.Add(1500*time.Millisecond))
 	s.Add("k2", "v2", now.Add(2*time.Second))
 	s.Add("k3", "v3", now.Add(2500*time.Millisecond))
 
-	assertNextOp(c, s, clock, 1500*time.Millisecond)
+	c.Assert(s.Next(), gc.NotNil)
+	clocktesting.ExpectTimer(c, clock, 1500*time.Millisecond)
 	clock.Advance(1500 * time.Millisecond)
 	assertReady(c, s, clock, "v1")
 
 	clock.Advance(500 * time.Millisecond)
-	assertNextOp(c, s, clock, 0)
+	clocktesting.ExpectSignalled(c, s.Next())
 	assertReady(c, s, clock, "v2")
 
 	s.Remove("k3")
 
 	clock.Advance(2 * time.Second) // T+4
-	assertNextOp(c, s, clock, 0)
+	clocktesting.ExpectSignalled(c, s.Next())
 	assertReady(c, s, clock, "v0")
 }
 
 func (*queueSuite) TestReadyNoEvents(c *gc.C) {
-	s := timequeue.New(coretesting.NewClock(time.Time{}))
+	s := timequeue.New[string, string](clocktesting.NewClock(time.Time{}))
 	ready := s.Ready(time.Now())
 	c.Assert(ready, gc.HasLen, 0)
 }
 
 func (*queueSuite) TestAdd(c *gc.C) {
-	clock := coretesting.NewClock(time.Time{})
+	clock := clocktesting.NewClock(time.Time{})
 	now := clock.Now()
-	s := timequeue.New(clock)
+	s := timequeue.New[string, string](clock)
 
 	s.Add("k0", "v0", now.Add(3*time.Second))
 	s.Add("k1", "v1", now.Add(1500*time.Millisecond))
@@ -80,49 +83,395 @@ func (*queueSuite) TestAdd(c *gc.C) {
 }
 
 func (*queueSuite) TestRemove(c *gc.C) {
-	clock := coretesting.NewClock(time.Time{})
+	clock := clocktesting.NewClock(time.Time{})
 	now := clock.Now()
-	s := timequeue.New(clock)
+	s := timequeue.New[string, string](clock)
 
 	s.Add("k0", "v0", now.Add(3*time.Second))
 	s.Add("k1", "v1", now.Add(2*time.Second))
-	s.Remove("k0")
+	v, ok := s.Remove("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(v, gc.Equals, "v0")
 	assertReady(c, s, clock /* nothing */)
 
 	clock.Advance(3 * time.Second)
 	assertReady(c, s, clock, "v1")
 }
 
-func (*queueSuite) TestRemoveKeyNotFound(c *gc.C) {
-	s := timequeue.New(coretesting.NewClock(time.Time{}))
-	s.Remove("0") // does not explode
+func (*queueSuite) TestClear(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(1*time.Second))
+	s.Add("k1", "v1", now.Add(2*time.Second))
+	cleared := make(map[string]string)
+	s.Clear(func(key, value string) {
+		// The queue has been emptied before f is called.
+		c.Check(s.Len(), gc.Equals, 0)
+		cleared[key] = value
+	})
+	c.Assert(cleared, jc.DeepEquals, map[string]string{"k0": "v0", "k1": "v1"})
+
+	clock.Advance(2 * time.Second)
+	assertReady(c, s, clock /* nothing */)
+
+	// The keys may be reused.
+	s.Add("k0", "v0", now)
+	s.Clear(nil)
+	c.Assert(s.Len(), gc.Equals, 0)
+}
+
+func (*queueSuite) TestClone(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+	s.SetEvictionOrder(func(a, b timequeue.Item[string, string]) bool {
+		return a.Time.After(b.Time)
+	})
+
+	s.Add("k0", "v0", now.Add(1*time.Second))
+	s.Add("k1", "v1", now.Add(2*time.Second))
+	s.Add("k2", "v2", now.Add(3*time.Second))
+
+	clone := s.Clone()
+	clone.Remove("k1")
+	clone.Add("k3", "v3", now)
+	s.Update("k0", "v0'", now.Add(4*time.Second))
+
+	item, _ := clone.Evict()
+	c.Assert(item.Key, gc.Equals, "k2")
+
+	clock.Advance(4 * time.Second)
+	assertReady(c, s, clock, "v1", "v2", "v0'")
+	assertReady(c, clone, clock, "v3", "v0")
 }
 
-func assertNextOp(c *gc.C, s *timequeue.Queue, clock *coretesting.Clock, d time.Duration) {
+func (*queueSuite) TestSetClock(c *gc.C) {
+	clock0 := clocktesting.NewClock(time.Time{})
+	clock1 := clocktesting.NewClock(time.Time{})
+	s := timequeue.New[string, string](clock0)
+	s.Add("k0", "v0", clock0.Now().Add(time.Second))
+	s.Next()
+	c.Assert(clock0.Alarms(), gc.Equals, 1)
+
+	// The queue's timer is stopped, and Next
+	// waits on the new clock.
+	s.SetClock(clock1)
+	c.Assert(clock0.Alarms(), gc.Equals, 0)
 	next := s.Next()
-	c.Assert(next, gc.NotNil)
-	if d > 0 {
-		select {
-		case <-next:
-			c.Fatal("Next channel signalled too soon")
-		default:
-		}
+	c.Assert(clock1.Alarms(), gc.Equals, 1)
+	clock1.Advance(time.Second)
+	clocktesting.ExpectSignalled(c, next)
+}
+
+func (*queueSuite) TestRemoveKeyNotFound(c *gc.C) {
+	s := timequeue.New[string, string](clocktesting.NewClock(time.Time{}))
+	_, ok := s.Remove("0") // does not explode
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (*queueSuite) TestAddAll(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(3*time.Second))
+	s.AddAll([]timequeue.Item[string, string]{
+		{"k1", "v1", now.Add(1500 * time.Millisecond)},
+		{"k2", "v2", now.Add(2 * time.Second)},
+	})
+
+	clock.Advance(time.Second) // T+1
+	assertReady(c, s, clock /* nothing */)
+
+	clock.Advance(time.Second) // T+2
+	assertReady(c, s, clock, "v1", "v2")
+
+	clock.Advance(time.Second) // T+3
+	assertReady(c, s, clock, "v0")
+}
+
+func (*queueSuite) TestAddAllFewItems(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	for i := 0; i < 10; i++ {
+		s.Add(fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i), now.Add(time.Duration(i+2)*time.Second))
+	}
+	s.AddAll([]timequeue.Item[string, string]{{"k", "v", now.Add(time.Second)}})
+
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, "v")
+}
+
+func (*queueSuite) TestAddAllDuplicateKey(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now)
+	c.Assert(func() {
+		s.AddAll([]timequeue.Item[string, string]{{"k1", "v1", now}, {"k0", "v0", now}})
+	}, gc.PanicMatches, "duplicate key k0")
+	c.Assert(func() {
+		s.AddAll([]timequeue.Item[string, string]{{"k1", "v1", now}, {"k1", "v1", now}})
+	}, gc.PanicMatches, "duplicate key k1")
+
+	// The queue is unmodified by a failed AddAll.
+	assertReady(c, s, clock, "v0")
+}
+
+func (*queueSuite) TestRemoveAll(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(3*time.Second))
+	s.Add("k1", "v1", now.Add(2*time.Second))
+	s.Add("k2", "v2", now.Add(1*time.Second))
+	s.Add("k3", "v3", now.Add(4*time.Second))
+	s.RemoveAll([]string{"k0", "k2", "k4"})
+
+	clock.Advance(4 * time.Second)
+	assertReady(c, s, clock, "v1", "v3")
+}
+
+func (*queueSuite) TestReadyN(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(3*time.Second))
+	s.Add("k1", "v1", now.Add(1*time.Second))
+	s.Add("k2", "v2", now.Add(2*time.Second))
+
+	clock.Advance(3 * time.Second)
+	c.Assert(s.ReadyN(clock.Now(), 0), gc.HasLen, 0)
+	c.Assert(s.ReadyN(clock.Now(), 2), jc.DeepEquals, []string{"v1", "v2"})
+	c.Assert(s.ReadyN(clock.Now(), 2), jc.DeepEquals, []string{"v0"})
+}
+
+func (*queueSuite) TestPopReady(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(2*time.Second))
+	s.Add("k1", "v1", now.Add(1*time.Second))
+
+	_, ok := s.PopReady(now)
+	c.Assert(ok, jc.IsFalse)
+
+	item, ok := s.PopReady(now.Add(2 * time.Second))
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(item, jc.DeepEquals, timequeue.Item[string, string]{
+		Key: "k1", Value: "v1", Time: now.Add(time.Second),
+	})
+	assertReady(c, s, clock /* nothing */)
+	clock.Advance(2 * time.Second)
+	assertReady(c, s, clock, "v0")
+}
+
+func (*queueSuite) TestNextTime(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	_, ok := s.NextTime()
+	c.Assert(ok, jc.IsFalse)
+
+	s.Add("k0", "v0", now.Add(3*time.Second))
+	s.Add("k1", "v1", now.Add(1*time.Second))
+	t, ok := s.NextTime()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(t, gc.Equals, now.Add(time.Second))
+}
+
+func (*queueSuite) TestDue(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+	for i := 9; i >= 0; i-- {
+		s.Add(fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i), now.Add(time.Duration(i)*time.Second))
+	}
+	c.Assert(s.Due(now.Add(-time.Second)), gc.HasLen, 0)
+
+	due := s.Due(now.Add(3 * time.Second))
+	keys := make([]string, len(due))
+	for i, item := range due {
+		keys[i] = item.Key
 	}
+	c.Assert(keys, jc.DeepEquals, []string{"k0", "k1", "k2", "k3"})
+	c.Assert(due[3], jc.DeepEquals, timequeue.Item[string, string]{
+		Key: "k3", Value: "v3", Time: now.Add(3 * time.Second),
+	})
+	c.Assert(s.Len(), gc.Equals, 10)
+}
+
+func (*queueSuite) TestGet(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(time.Second))
+	v, t, ok := s.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(v, gc.Equals, "v0")
+	c.Assert(t, gc.Equals, now.Add(time.Second))
+
+	_, _, ok = s.Get("k1")
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (*queueSuite) TestUpdate(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(time.Second))
+	s.Add("k1", "v1", now.Add(2*time.Second))
+	c.Assert(s.Update("k1", "v1'", now), jc.IsTrue)
+	c.Assert(s.Update("k2", "v2", now), jc.IsFalse)
+
+	assertReady(c, s, clock, "v1'")
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, "v0")
+}
+
+func (*queueSuite) TestEvict(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	_, ok := s.Evict()
+	c.Assert(ok, jc.IsFalse)
+
+	s.Add("k0", "v0", now.Add(3*time.Second))
+	s.Add("k1", "v1", now.Add(1*time.Second))
+	s.Add("k2", "v2", now.Add(2*time.Second))
+	s.Add("k3", "v3", now.Add(4*time.Second))
+
+	// No eviction order yet.
+	_, ok = s.PeekEvict()
+	c.Assert(ok, jc.IsFalse)
+
+	// Evict the latest items first.
+	s.SetEvictionOrder(func(a, b timequeue.Item[string, string]) bool {
+		return a.Time.After(b.Time)
+	})
+	item, ok := s.PeekEvict()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(item.Key, gc.Equals, "k3")
 
-	// temporarily move time forward
-	clock.Advance(d)
-	defer clock.Advance(-d)
+	s.Remove("k3")
+	s.Update("k1", "v1", now.Add(5*time.Second))
+	s.AddAll([]timequeue.Item[string, string]{
+		{"k4", "v4", now.Add(500 * time.Millisecond)},
+		{"k5", "v5", now.Add(6 * time.Second)},
+	})
+	s.RemoveAll([]string{"k5"})
 
-	select {
-	case _, ok := <-next:
-		c.Assert(ok, jc.IsTrue)
-		// the time value is unimportant to us
-	default:
-		c.Fatal("Next channel not signalled")
+	var evicted []string
+	for {
+		item, ok := s.Evict()
+		if !ok {
+			break
+		}
+		evicted = append(evicted, item.Key)
 	}
+	c.Assert(evicted, jc.DeepEquals, []string{"k1", "k0", "k2", "k4"})
+	c.Assert(s.Len(), gc.Equals, 0)
+	assertReady(c, s, clock /* nothing */)
+}
+
+func (*queueSuite) TestEvictReady(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+	s.SetEvictionOrder(func(a, b timequeue.Item[string, string]) bool {
+		return a.Value > b.Value
+	})
+
+	s.Add("k0", "v0", now.Add(1*time.Second))
+	s.Add("k1", "v1", now.Add(2*time.Second))
+	s.Add("k2", "v2", now.Add(3*time.Second))
+
+	clock.Advance(2 * time.Second)
+	assertReady(c, s, clock, "v0", "v1")
+	item, ok := s.Evict()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(item.Key, gc.Equals, "k2")
+	_, ok = s.Evict()
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (*queueSuite) TestAddRepeating(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+	s.AddRepeating("k0", "v0", now.Add(time.Second), time.Second)
+	s.Add("k1", "v1", now.Add(1500*time.Millisecond))
+
+	clock.Advance(time.Second)
+	assertReady(c, s, clock, "v0")
+	c.Assert(s.Len(), gc.Equals, 2)
+	_, t, ok := s.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(t, gc.Equals, now.Add(2*time.Second))
+
+	// Repetitions are computed from the item's time, and
+	// so do not drift when Ready is called late.
+	clock.Advance(1200 * time.Millisecond)
+	assertReady(c, s, clock, "v1", "v0")
+	_, t, _ = s.Get("k0")
+	c.Assert(t, gc.Equals, now.Add(3*time.Second))
+
+	// Missed occurrences are skipped.
+	clock.Advance(5 * time.Second)
+	item, ok := s.PopReady(clock.Now())
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(item, jc.DeepEquals, timequeue.Item[string, string]{
+		Key: "k0", Value: "v0", Time: now.Add(3 * time.Second),
+	})
+	_, t, _ = s.Get("k0")
+	c.Assert(t, gc.Equals, now.Add(8*time.Second))
+	assertReady(c, s, clock /* nothing */)
+
+	// Removing the item cancels its repetition.
+	_, ok = s.Remove("k0")
+	c.Assert(ok, jc.IsTrue)
+	clock.Advance(time.Minute)
+	assertReady(c, s, clock /* nothing */)
+	c.Assert(s.Len(), gc.Equals, 0)
+}
+
+func (*queueSuite) TestAddRepeatingUpdate(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+	s.AddRepeating("k0", "v0", now.Add(time.Second), 2*time.Second)
+	c.Assert(s.Update("k0", "v1", now.Add(1500*time.Millisecond)), jc.IsTrue)
+
+	clock.Advance(1500 * time.Millisecond)
+	assertReady(c, s, clock, "v1")
+	_, t, _ := s.Get("k0")
+	c.Assert(t, gc.Equals, now.Add(3500*time.Millisecond))
+}
+
+func (*queueSuite) TestAddRepeatingInvalid(c *gc.C) {
+	s := timequeue.New[string, string](clocktesting.NewClock(time.Time{}))
+	c.Assert(func() {
+		s.AddRepeating("k0", "v0", time.Time{}, 0)
+	}, gc.PanicMatches, "non-positive interval 0s not valid")
+	s.Add("k0", "v0", time.Time{})
+	c.Assert(func() {
+		s.AddRepeating("k0", "v0", time.Time{}, time.Second)
+	}, gc.PanicMatches, "duplicate key k0")
 }
 
-func assertReady(c *gc.C, s *timequeue.Queue, clock *coretesting.Clock, expect ...interface{}) {
+func assertReady(c *gc.C, s *timequeue.Queue[string, string], clock *clocktesting.Clock, expect ...string) {
 	ready := s.Ready(clock.Now())
 	c.Assert(ready, jc.DeepEquals, expect)
 }
@@ -0,0 +1,123 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// dependencies records the items that are scheduled relative to
+// others, with AddAfterKey.
+type dependencies[K comparable] struct {
+	// anchors holds, for each dependent item's key, the key of
+	// the item that it follows, and the gap between them.
+	anchors map[K]anchor[K]
+
+	// dependents holds, for each item followed by others, the
+	// keys of the items that follow it.
+	dependents map[K][]K
+}
+
+// anchor records the item that a dependent item follows.
+type anchor[K comparable] struct {
+	key K
+	gap time.Duration
+}
+
+// AddAfterKey is like Add, but schedules the item for gap after the
+// time of the item with the key otherKey, and keeps it there: whenever
+// the other item's time changes, by Update or by repeating, the item
+// is moved to follow it. Items may follow items that themselves follow
+// others, and so on, in which case moving the first moves them all.
+//
+// The item stops following the other item if either is removed, by any
+// means including being returned by Ready, or if the item's own time is
+// changed with Update; it then keeps its time at that point. AddAfterKey
+// reports whether or not the other item exists; if it does not, the
+// item is not added. AddAfterKey will panic if there already exists an
+// item with the same key.
+func (s *Queue[K, V]) AddAfterKey(key K, value V, otherKey K, gap time.Duration) bool {
+	if _, ok := s.m[key]; ok {
+		panic(errors.Errorf("duplicate key %v", key))
+	}
+	other, ok := s.m[otherKey]
+	if !ok {
+		return false
+	}
+	if s.deps == nil {
+		s.deps = &dependencies[K]{
+			anchors:    make(map[K]anchor[K]),
+			dependents: make(map[K][]K),
+		}
+	}
+	s.deps.anchors[key] = anchor[K]{key: otherKey, gap: gap}
+	s.deps.dependents[otherKey] = append(s.deps.dependents[otherKey], key)
+	s.push(&queueItem[K, V]{key: key, value: value, t: other.t.Add(gap)})
+	return true
+}
+
+// moveDependents moves the items that follow the item,
+// after its time has changed.
+func (s *Queue[K, V]) moveDependents(item *queueItem[K, V]) {
+	if s.deps == nil {
+		return
+	}
+	for _, key := range s.deps.dependents[item.key] {
+		dependent := s.m[key]
+		dependent.t = item.t.Add(s.deps.anchors[key].gap)
+		s.fix(dependent)
+	}
+}
+
+// detach stops the item with the specified key following another, and
+// if it is being removed, releases the items that follow it.
+func (s *Queue[K, V]) detach(key K, removed bool) {
+	if s.deps == nil {
+		return
+	}
+	if a, ok := s.deps.anchors[key]; ok {
+		delete(s.deps.anchors, key)
+		keys := s.deps.dependents[a.key]
+		for i, k := range keys {
+			if k == key {
+				keys = append(keys[:i], keys[i+1:]...)
+				break
+			}
+		}
+		if len(keys) == 0 {
+			delete(s.deps.dependents, a.key)
+		} else {
+			s.deps.dependents[a.key] = keys
+		}
+	}
+	if removed {
+		for _, k := range s.deps.dependents[key] {
+			delete(s.deps.anchors, k)
+		}
+		delete(s.deps.dependents, key)
+	}
+	if len(s.deps.anchors) == 0 {
+		s.deps = nil
+	}
+}
+
+// clone returns an independent copy of the dependencies.
+func (d *dependencies[K]) clone() *dependencies[K] {
+	if d == nil {
+		return nil
+	}
+	clone := &dependencies[K]{
+		anchors:    make(map[K]anchor[K], len(d.anchors)),
+		dependents: make(map[K][]K, len(d.dependents)),
+	}
+	for k, a := range d.anchors {
+		clone.anchors[k] = a
+	}
+	for k, keys := range d.dependents {
+		clone.dependents[k] = append([]K(nil), keys...)
+	}
+	return clone
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue_test
+
+import (
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/timequeue"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	coretesting "github.com/juju/juju/testing"
+)
+
+type relativeSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&relativeSuite{})
+
+func (*relativeSuite) TestAddAfterKey(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	c.Assert(s.AddAfterKey("k1", "v1", "k0", time.Second), jc.IsFalse)
+	c.Assert(s.Len(), gc.Equals, 0)
+
+	s.Add("k0", "v0", now.Add(time.Minute))
+	c.Assert(s.AddAfterKey("k1", "v1", "k0", time.Second), jc.IsTrue)
+	c.Assert(s.AddAfterKey("k2", "v2", "k1", 2*time.Second), jc.IsTrue)
+	assertTime(c, s, "k1", now.Add(time.Minute+time.Second))
+	assertTime(c, s, "k2", now.Add(time.Minute+3*time.Second))
+
+	// Moving the first item moves those that follow it.
+	s.Update("k0", "v0", now.Add(time.Hour))
+	assertTime(c, s, "k1", now.Add(time.Hour+time.Second))
+	assertTime(c, s, "k2", now.Add(time.Hour+3*time.Second))
+	s.Update("k0", "v0", now.Add(3*time.Second))
+	t, ok := s.NextTime()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(t, gc.Equals, now.Add(3*time.Second))
+
+	// Updating a following item stops it following,
+	// but it is still followed.
+	s.Update("k1", "v1", now.Add(10*time.Second))
+	assertTime(c, s, "k2", now.Add(12*time.Second))
+	s.Update("k0", "v0", now.Add(time.Second))
+	assertTime(c, s, "k1", now.Add(10*time.Second))
+
+	// Once an item is removed, those that
+	// followed it keep their times.
+	clock.Advance(time.Second)
+	c.Assert(s.Ready(clock.Now()), jc.DeepEquals, []string{"v0"})
+	s.Remove("k1")
+	assertTime(c, s, "k2", now.Add(12*time.Second))
+	s.Add("k1", "v1", now.Add(time.Minute))
+	s.Update("k1", "v1", now.Add(2*time.Minute))
+	assertTime(c, s, "k2", now.Add(12*time.Second))
+
+	c.Assert(func() { s.AddAfterKey("k2", "v2", "k1", 0) }, gc.PanicMatches, "duplicate key k2")
+}
+
+func (*relativeSuite) TestAddAfterRepeating(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.AddRepeating("k0", "v0", now.Add(time.Minute), time.Minute)
+	s.AddAfterKey("k1", "v1", "k0", 30*time.Second)
+
+	// The following item moves with each repetition.
+	clock.Advance(time.Minute)
+	c.Assert(s.Ready(clock.Now()), jc.DeepEquals, []string{"v0"})
+	assertTime(c, s, "k1", now.Add(2*time.Minute+30*time.Second))
+}
+
+func (*relativeSuite) TestRemoveAllAndClone(c *gc.C) {
+	clock := clocktesting.NewClock(time.Time{})
+	now := clock.Now()
+	s := timequeue.New[string, string](clock)
+
+	s.Add("k0", "v0", now.Add(time.Minute))
+	s.AddAfterKey("k1", "v1", "k0", time.Second)
+	s.AddAfterKey("k2", "v2", "k0", 2*time.Second)
+
+	// The clone's items follow independently of the original's.
+	clone := s.Clone()
+	s.RemoveAll([]string{"k0", "k1"})
+	s.Add("k0", "v0", now)
+	s.Update("k0", "v0", now.Add(time.Hour))
+	assertTime(c, s, "k2", now.Add(time.Minute+2*time.Second))
+
+	clone.Update("k0", "v0", now.Add(time.Hour))
+	assertTime(c, clone, "k1", now.Add(time.Hour+time.Second))
+	assertTime(c, clone, "k2", now.Add(time.Hour+2*time.Second))
+
+	clone.Clear(nil)
+	clone.Add("k0", "v0", now)
+	clone.Add("k1", "v1", now)
+	clone.Update("k0", "v0", now.Add(time.Hour))
+	assertTime(c, clone, "k1", now)
+}
+
+func assertTime(c *gc.C, s *timequeue.Queue[string, string], key string, expect time.Time) {
+	_, t, ok := s.Get(key)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(t, gc.Equals, expect)
+}
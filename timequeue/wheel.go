@@ -0,0 +1,245 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timequeue
+
+import (
+	"container/heap"
+	"math"
+	"time"
+)
+
+// wheelOrder orders items in a timing wheel: a ring of slots, each
+// holding the unordered items whose times fall within one tick. The
+// wheel covers the ticks from its cursor up to its horizon, slots ticks
+// later. The items in the cursor's tick are held in a heap, so that
+// many items sharing a tick cost no more than they would in a heap
+// order; items beyond the horizon are held in an overflow heap, and
+// moved into the wheel as the cursor advances. Adding and removing
+// items after the cursor's tick, and within the horizon, takes constant
+// time; advancing the cursor takes time proportional to the number of
+// empty slots skipped, and the number of items in the slot reached.
+type wheelOrder[K comparable, V any] struct {
+	tick  time.Duration
+	slots [][]*queueItem[K, V]
+
+	// base is the time of tick zero, set when the first
+	// item is added; ticks are counted relative to it, so
+	// that any time may be represented.
+	base    time.Time
+	started bool
+
+	// cursor is the earliest tick covered by the wheel.
+	cursor int64
+
+	// current holds the items in the cursor's tick, and those
+	// in earlier ticks added while the wheel held other items.
+	current queueItems[K, V]
+
+	// n is the number of items in the slots.
+	n int
+
+	// overflow holds the items beyond the wheel's horizon.
+	overflow queueItems[K, V]
+}
+
+const (
+	// overflowSlot is the slot of an item in a wheel's overflow heap.
+	overflowSlot = -1
+
+	// currentSlot is the slot of an item in a wheel's current heap.
+	currentSlot = -2
+)
+
+func newWheelOrder[K comparable, V any](tick time.Duration, slots int) *wheelOrder[K, V] {
+	return &wheelOrder[K, V]{
+		tick:  tick,
+		slots: make([][]*queueItem[K, V], slots),
+	}
+}
+
+func (w *wheelOrder[K, V]) backend() Backend {
+	return BackendWheel
+}
+
+func (w *wheelOrder[K, V]) len() int {
+	return len(w.current) + w.n + len(w.overflow)
+}
+
+// tickOf returns the tick in which t falls.
+func (w *wheelOrder[K, V]) tickOf(t time.Time) int64 {
+	// Sub saturates, so times more than 292 years from the base
+	// share the outermost ticks; items are ordered by their
+	// actual times within the heaps.
+	d := t.Sub(w.base)
+	k := d / w.tick
+	if d%w.tick < 0 {
+		k--
+	}
+	return int64(k)
+}
+
+// horizon returns the first tick beyond the wheel.
+func (w *wheelOrder[K, V]) horizon() int64 {
+	if w.cursor > math.MaxInt64-int64(len(w.slots)) {
+		return math.MaxInt64
+	}
+	return w.cursor + int64(len(w.slots))
+}
+
+// slot returns the index of the slot holding the specified tick.
+func (w *wheelOrder[K, V]) slot(k int64) int {
+	n := int64(len(w.slots))
+	return int((k%n + n) % n)
+}
+
+func (w *wheelOrder[K, V]) first() *queueItem[K, V] {
+	if len(w.current) == 0 && w.n == 0 && len(w.overflow) > 0 {
+		// Jump to the earliest overflowing item,
+		// bringing it into the wheel.
+		w.advance(w.tickOf(w.overflow[0].t))
+	}
+	for i := int64(1); len(w.current) == 0 && w.n > 0; i++ {
+		k := w.cursor + i
+		items := w.slots[w.slot(k)]
+		if len(items) == 0 {
+			continue
+		}
+		// All of the slots before this one are empty, and so
+		// the cursor may advance to it. The overflowing items
+		// brought into the wheel fall after it, or in the same
+		// tick, in which case they join the current heap.
+		w.advance(k)
+		w.slots[w.slot(k)] = nil
+		w.n -= len(items)
+		for _, item := range items {
+			item.slot = currentSlot
+		}
+		w.current = append(w.current, items...)
+		for i, item := range w.current {
+			item.i = i
+		}
+		heap.Init(&w.current)
+	}
+	if len(w.current) == 0 {
+		return nil
+	}
+	return w.current[0]
+}
+
+// advance advances the cursor to the specified tick, which must not be
+// after the earliest item's, and moves the overflowing items that fall
+// within the new horizon into the wheel.
+func (w *wheelOrder[K, V]) advance(k int64) {
+	if k <= w.cursor {
+		return
+	}
+	w.cursor = k
+	horizon := w.horizon()
+	for len(w.overflow) > 0 && w.tickOf(w.overflow[0].t) < horizon {
+		item := heap.Pop(&w.overflow).(*queueItem[K, V])
+		w.place(item)
+	}
+}
+
+// place adds the item to the current heap, its slot, or the overflow
+// heap, according to its tick.
+func (w *wheelOrder[K, V]) place(item *queueItem[K, V]) {
+	k := w.tickOf(item.t)
+	if k < w.cursor && len(w.current) == 0 && w.n == 0 {
+		// The overflowing items remain beyond
+		// the nearer horizon.
+		w.cursor = k
+	}
+	switch {
+	case k <= w.cursor:
+		item.slot = currentSlot
+		heap.Push(&w.current, item)
+	case k >= w.horizon():
+		item.slot = overflowSlot
+		heap.Push(&w.overflow, item)
+	default:
+		item.slot = w.slot(k)
+		item.i = len(w.slots[item.slot])
+		w.slots[item.slot] = append(w.slots[item.slot], item)
+		w.n++
+	}
+}
+
+func (w *wheelOrder[K, V]) push(item *queueItem[K, V]) {
+	if !w.started {
+		w.started = true
+		w.base = item.t
+	}
+	w.place(item)
+}
+
+func (w *wheelOrder[K, V]) pushAll(items []*queueItem[K, V]) {
+	for _, item := range items {
+		w.push(item)
+	}
+}
+
+func (w *wheelOrder[K, V]) remove(item *queueItem[K, V]) {
+	switch item.slot {
+	case currentSlot:
+		heap.Remove(&w.current, item.i)
+	case overflowSlot:
+		heap.Remove(&w.overflow, item.i)
+	default:
+		items := w.slots[item.slot]
+		last := len(items) - 1
+		items[item.i] = items[last]
+		items[item.i].i = item.i
+		items[last] = nil
+		w.slots[item.slot] = items[:last]
+		w.n--
+	}
+}
+
+func (w *wheelOrder[K, V]) fix(item *queueItem[K, V]) {
+	if item.slot == currentSlot && w.tickOf(item.t) <= w.cursor {
+		heap.Fix(&w.current, item.i)
+		return
+	}
+	w.remove(item)
+	w.place(item)
+}
+
+func (w *wheelOrder[K, V]) due(t time.Time, f func(item *queueItem[K, V])) {
+	w.current.due(0, t, f)
+	if w.n > 0 {
+		k := w.tickOf(t)
+		for i := int64(1); i < int64(len(w.slots)) && w.cursor+i <= k; i++ {
+			for _, item := range w.slots[w.slot(w.cursor+i)] {
+				if !item.t.After(t) {
+					f(item)
+				}
+			}
+		}
+	}
+	w.overflow.due(0, t, f)
+}
+
+func (w *wheelOrder[K, V]) each(f func(item *queueItem[K, V])) {
+	for _, item := range w.current {
+		f(item)
+	}
+	for _, items := range w.slots {
+		for _, item := range items {
+			f(item)
+		}
+	}
+	for _, item := range w.overflow {
+		f(item)
+	}
+}
+
+// overflowFraction returns the fraction of the items
+// that are beyond the wheel's horizon.
+func (w *wheelOrder[K, V]) overflowFraction() float64 {
+	if w.len() == 0 {
+		return 0
+	}
+	return float64(len(w.overflow)) / float64(w.len())
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timing
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// EstimatorConfig holds the configuration for an Estimator.
+type EstimatorConfig struct {
+	// Clock is used to measure the time between events,
+	// and by Since to measure latencies.
+	Clock clock.Clock
+
+	// HalfLife is the time after which the weight of an event
+	// in the estimates has halved.
+	HalfLife time.Duration
+}
+
+// Validate checks that the config is valid.
+func (config EstimatorConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.HalfLife <= 0 {
+		return errors.NotValidf("non-positive HalfLife")
+	}
+	return nil
+}
+
+// Estimator maintains exponentially weighted moving averages of the
+// rate of events, and of their latencies. The weights decay with time,
+// as measured by a Clock, rather than with the number of events, so
+// the rate decays towards zero when events stop, and bursts of events
+// do not swamp the latency estimate's history.
+//
+// The rate estimate starts at zero, and so underestimates the rate for
+// the first few half-lives.
+//
+// Estimator's methods are safe for concurrent use.
+type Estimator struct {
+	config EstimatorConfig
+	// alpha is the decay constant, per nanosecond.
+	alpha float64
+
+	mu sync.Mutex
+	// last is the time of the last event, at which the rate
+	// was rate events per second.
+	last time.Time
+	rate float64
+	// latency and weight are the decayed sums of the latencies,
+	// in nanoseconds, and of their weights.
+	latency float64
+	weight  float64
+}
+
+// NewEstimator returns a new Estimator with the given configuration,
+// with no events observed.
+func NewEstimator(config EstimatorConfig) (*Estimator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating estimator config")
+	}
+	return &Estimator{
+		config: config,
+		alpha:  math.Ln2 / float64(config.HalfLife),
+	}, nil
+}
+
+// Observe records an event with the specified latency. Negative
+// latencies are recorded as zero.
+func (e *Estimator) Observe(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.config.Clock.Now()
+	decay := e.decay(now)
+	// Each event contributes alpha to the rate, so that events
+	// at a constant rate yield that rate.
+	e.rate = e.rate*decay + e.alpha*float64(time.Second)
+	e.latency = e.latency*decay + float64(latency)
+	e.weight = e.weight*decay + 1
+	e.last = now
+}
+
+// Since records an event whose latency is the time elapsed since start,
+// as measured by the estimator's Clock, and returns the latency.
+func (e *Estimator) Since(start time.Time) time.Duration {
+	d := e.config.Clock.Now().Sub(start)
+	e.Observe(d)
+	return d
+}
+
+// Rate returns the estimated rate of events, per second.
+func (e *Estimator) Rate() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.rate * e.decay(e.config.Clock.Now())
+}
+
+// Latency returns the estimated latency of events, or zero if no
+// events have been observed.
+func (e *Estimator) Latency() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.weight == 0 {
+		return 0
+	}
+	return time.Duration(e.latency / e.weight)
+}
+
+// Reset discards the observed events.
+func (e *Estimator) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.last = time.Time{}
+	e.rate = 0
+	e.latency = 0
+	e.weight = 0
+}
+
+// decay returns the factor by which the weights of events have decayed
+// since the last event. decay must be called with e.mu held.
+func (e *Estimator) decay(now time.Time) float64 {
+	if e.weight == 0 {
+		return 0
+	}
+	elapsed := now.Sub(e.last)
+	if elapsed <= 0 {
+		return 1
+	}
+	return math.Exp(-e.alpha * float64(elapsed))
+}
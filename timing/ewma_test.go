@@ -0,0 +1,88 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timing_test
+
+import (
+	"math"
+	"time"
+
+	"github.com/axw/juju-time/timing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type estimatorSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&estimatorSuite{})
+
+func (s *estimatorSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *estimatorSuite) newEstimator(c *gc.C) *timing.Estimator {
+	e, err := timing.NewEstimator(timing.EstimatorConfig{Clock: s.clock, HalfLife: time.Minute})
+	c.Assert(err, jc.ErrorIsNil)
+	return e
+}
+
+func (s *estimatorSuite) TestValidate(c *gc.C) {
+	_, err := timing.NewEstimator(timing.EstimatorConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating estimator config: nil Clock not valid")
+	_, err = timing.NewEstimator(timing.EstimatorConfig{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating estimator config: non-positive HalfLife not valid")
+}
+
+func (s *estimatorSuite) TestEmpty(c *gc.C) {
+	e := s.newEstimator(c)
+	s.clock.Advance(time.Hour)
+	c.Assert(e.Rate(), gc.Equals, 0.0)
+	c.Assert(e.Latency(), gc.Equals, time.Duration(0))
+}
+
+func (s *estimatorSuite) TestSteadyRate(c *gc.C) {
+	e := s.newEstimator(c)
+	// Ten events per second, for many half-lives.
+	for i := 0; i < 10*60*20; i++ {
+		s.clock.Advance(100 * time.Millisecond)
+		e.Observe(50 * time.Millisecond)
+	}
+	assertNear(c, e.Rate(), 10, 0.5)
+	c.Assert(e.Latency(), gc.Equals, 50*time.Millisecond)
+}
+
+func (s *estimatorSuite) TestDecay(c *gc.C) {
+	e := s.newEstimator(c)
+	e.Observe(time.Second)
+	rate := e.Rate()
+	c.Assert(rate > 0, jc.IsTrue)
+
+	// Without events, the rate halves each half-life,
+	// but the latency is unchanged.
+	s.clock.Advance(time.Minute)
+	assertNear(c, e.Rate(), rate/2, 1e-9)
+	s.clock.Advance(time.Minute)
+	assertNear(c, e.Rate(), rate/4, 1e-9)
+	c.Assert(e.Latency(), gc.Equals, time.Second)
+
+	// Older latencies carry less weight: by the third event,
+	// the first has decayed for three half-lives, and the
+	// second for one.
+	e.Observe(4 * time.Second)
+	s.clock.Advance(time.Minute)
+	e.Since(s.clock.Now().Add(-time.Second))
+	assertNear(c, e.Latency().Seconds(), (0.125*1+0.5*4+1*1)/(0.125+0.5+1), 1e-6)
+
+	e.Reset()
+	c.Assert(e.Rate(), gc.Equals, 0.0)
+	c.Assert(e.Latency(), gc.Equals, time.Duration(0))
+}
+
+func assertNear(c *gc.C, obtained, expected, tolerance float64) {
+	c.Assert(math.Abs(obtained-expected) <= tolerance, jc.IsTrue, gc.Commentf("obtained %v, expected %v±%v", obtained, expected, tolerance))
+}
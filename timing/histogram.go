@@ -0,0 +1,207 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timing
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// DefaultPrecision is the Precision used by a Histogram
+// if none is specified.
+const DefaultPrecision = 5
+
+// maxPrecision is the largest valid Precision.
+const maxPrecision = 10
+
+// HistogramConfig holds the configuration for a Histogram.
+type HistogramConfig struct {
+	// Clock is used by Since to measure durations.
+	Clock clock.Clock
+
+	// Precision is the number of significant bits with which durations
+	// are recorded: recorded durations have a relative error of at most
+	// 2^-Precision. Precision must not exceed 10; if it is zero,
+	// DefaultPrecision is used.
+	Precision int
+}
+
+// Validate checks that the config is valid.
+func (config HistogramConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Precision < 0 || config.Precision > maxPrecision {
+		return errors.NotValidf("Precision %d", config.Precision)
+	}
+	return nil
+}
+
+// Histogram records the distribution of durations, such as latencies,
+// in log-linear buckets, so that its size depends only on the range of
+// recorded durations and not on their number. Histogram can estimate
+// percentiles of the recorded durations.
+//
+// Histogram's methods are safe for concurrent use.
+type Histogram struct {
+	clock     clock.Clock
+	precision uint
+
+	mu       sync.Mutex
+	counts   []uint64
+	count    uint64
+	sum      time.Duration
+	min, max time.Duration
+}
+
+// NewHistogram returns a new, empty Histogram with the given configuration.
+func NewHistogram(config HistogramConfig) (*Histogram, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating histogram config")
+	}
+	precision := config.Precision
+	if precision == 0 {
+		precision = DefaultPrecision
+	}
+	return &Histogram{clock: config.Clock, precision: uint(precision)}, nil
+}
+
+// Record records a duration. Negative durations are recorded as zero.
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := h.index(d)
+	if i >= len(h.counts) {
+		counts := make([]uint64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// Since records and returns the time elapsed since start, as measured
+// by the histogram's Clock.
+func (h *Histogram) Since(start time.Time) time.Duration {
+	d := h.clock.Now().Sub(start)
+	h.Record(d)
+	return d
+}
+
+// Count returns the number of recorded durations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Min returns the shortest recorded duration, or zero if none
+// have been recorded.
+func (h *Histogram) Min() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.min
+}
+
+// Max returns the longest recorded duration, or zero if none
+// have been recorded.
+func (h *Histogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+// Mean returns the mean of the recorded durations, or zero if none
+// have been recorded.
+func (h *Histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Percentile returns an estimate of the duration below or at which the
+// specified percentage of recorded durations fall; for example,
+// Percentile(99) estimates the 99th percentile. The estimate is within
+// the histogram's precision, and within the recorded minimum and maximum.
+// If no durations have been recorded, Percentile returns zero.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.min
+	}
+	if p >= 100 {
+		return h.max
+	}
+	rank := uint64(math.Ceil(p * float64(h.count) / 100))
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			d := h.value(i)
+			if d < h.min {
+				d = h.min
+			}
+			if d > h.max {
+				d = h.max
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+// Reset discards all recorded durations.
+func (h *Histogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts = nil
+	h.count = 0
+	h.sum = 0
+	h.min = 0
+	h.max = 0
+}
+
+// index returns the index of the bucket for the non-negative duration.
+// Durations below 2^precision nanoseconds have their own buckets; above
+// that, each power of two is divided into 2^precision buckets.
+func (h *Histogram) index(d time.Duration) int {
+	v := uint64(d)
+	if v < 1<<h.precision {
+		return int(v)
+	}
+	shift := uint(bits.Len64(v)) - 1 - h.precision
+	return int(uint64(shift+1)<<h.precision + v>>shift - 1<<h.precision)
+}
+
+// value returns the midpoint of the bucket with the given index.
+func (h *Histogram) value(i int) time.Duration {
+	if i < 1<<h.precision {
+		return time.Duration(i)
+	}
+	shift := uint(i>>h.precision) - 1
+	lower := (uint64(i)&(1<<h.precision-1) + 1<<h.precision) << shift
+	return time.Duration(lower + (1<<shift-1)/2)
+}
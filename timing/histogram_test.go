@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timing_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/timing"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type histogramSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&histogramSuite{})
+
+func (s *histogramSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *histogramSuite) newHistogram(c *gc.C, precision int) *timing.Histogram {
+	h, err := timing.NewHistogram(timing.HistogramConfig{Clock: s.clock, Precision: precision})
+	c.Assert(err, jc.ErrorIsNil)
+	return h
+}
+
+func (s *histogramSuite) TestValidate(c *gc.C) {
+	_, err := timing.NewHistogram(timing.HistogramConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating histogram config: nil Clock not valid")
+	_, err = timing.NewHistogram(timing.HistogramConfig{Clock: s.clock, Precision: 11})
+	c.Assert(err, gc.ErrorMatches, "validating histogram config: Precision 11 not valid")
+	_, err = timing.NewHistogram(timing.HistogramConfig{Clock: s.clock, Precision: -1})
+	c.Assert(err, gc.ErrorMatches, "validating histogram config: Precision -1 not valid")
+}
+
+func (s *histogramSuite) TestEmpty(c *gc.C) {
+	h := s.newHistogram(c, 0)
+	c.Assert(h.Count(), gc.Equals, uint64(0))
+	c.Assert(h.Min(), gc.Equals, time.Duration(0))
+	c.Assert(h.Max(), gc.Equals, time.Duration(0))
+	c.Assert(h.Mean(), gc.Equals, time.Duration(0))
+	c.Assert(h.Percentile(50), gc.Equals, time.Duration(0))
+}
+
+func (s *histogramSuite) TestSummary(c *gc.C) {
+	h := s.newHistogram(c, 0)
+	for _, d := range []time.Duration{3 * time.Millisecond, time.Millisecond, 2 * time.Millisecond, -time.Second} {
+		h.Record(d)
+	}
+	c.Assert(h.Count(), gc.Equals, uint64(4))
+	c.Assert(h.Min(), gc.Equals, time.Duration(0))
+	c.Assert(h.Max(), gc.Equals, 3*time.Millisecond)
+	c.Assert(h.Mean(), gc.Equals, 1500*time.Microsecond)
+	c.Assert(h.Percentile(0), gc.Equals, time.Duration(0))
+	c.Assert(h.Percentile(100), gc.Equals, 3*time.Millisecond)
+
+	h.Reset()
+	c.Assert(h.Count(), gc.Equals, uint64(0))
+	c.Assert(h.Max(), gc.Equals, time.Duration(0))
+}
+
+func (s *histogramSuite) TestPercentile(c *gc.C) {
+	for _, precision := range []int{1, 5, 10} {
+		c.Logf("precision %d", precision)
+		h := s.newHistogram(c, precision)
+		for i := 1; i <= 1000; i++ {
+			h.Record(time.Duration(i) * time.Millisecond)
+		}
+		tolerance := 1 / float64(int(1)<<uint(precision))
+		for _, p := range []float64{1, 25, 50, 90, 99, 99.9} {
+			expected := time.Duration(p*10) * time.Millisecond
+			actual := h.Percentile(p)
+			c.Check(float64(actual) >= float64(expected)*(1-tolerance), jc.IsTrue, gc.Commentf("p%v: %v", p, actual))
+			c.Check(float64(actual) <= float64(expected)*(1+tolerance), jc.IsTrue, gc.Commentf("p%v: %v", p, actual))
+		}
+	}
+}
+
+func (s *histogramSuite) TestSmallDurationsExact(c *gc.C) {
+	h := s.newHistogram(c, 0)
+	for i := 0; i < 32; i++ {
+		h.Record(time.Duration(i))
+	}
+	c.Assert(h.Percentile(50), gc.Equals, time.Duration(15))
+}
+
+func (s *histogramSuite) TestSince(c *gc.C) {
+	h := s.newHistogram(c, 0)
+	start := s.clock.Now()
+	s.clock.Advance(time.Second)
+	c.Assert(h.Since(start), gc.Equals, time.Second)
+	c.Assert(h.Count(), gc.Equals, uint64(1))
+	c.Assert(h.Max(), gc.Equals, time.Second)
+}
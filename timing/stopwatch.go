@@ -0,0 +1,192 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package timing provides a Stopwatch for measuring elapsed time, a
+// Histogram for summarising the distribution of measured latencies, and
+// an Estimator of the recent rate and latency of events.
+package timing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+)
+
+// Stopwatch measures elapsed time with a Clock, optionally split into
+// laps, which may be named to mark checkpoints in an operation. The
+// time is accumulated across successive calls to Start and Stop. With
+// clock.WallClock, elapsed time is measured with the monotonic clock,
+// and so is unaffected by changes to the wall clock.
+//
+// Stopwatch's methods are safe for concurrent use.
+type Stopwatch struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	running bool
+	// start is the time at which the stopwatch was last started,
+	// or the time of the last lap if that was later.
+	start time.Time
+	// elapsed is the time accumulated up to start.
+	elapsed time.Duration
+	// lap is the time accumulated in the current lap up to start.
+	lap  time.Duration
+	laps []Segment
+}
+
+// Segment is a lap of a Stopwatch.
+type Segment struct {
+	// Name is the name of the checkpoint that ended the lap,
+	// or empty if the lap was ended by Lap.
+	Name string
+
+	// Duration is the time elapsed in the lap.
+	Duration time.Duration
+}
+
+// NewStopwatch returns a new, stopped Stopwatch using the given Clock.
+func NewStopwatch(clock clock.Clock) *Stopwatch {
+	return &Stopwatch{clock: clock}
+}
+
+// StartStopwatch returns a new Stopwatch using the given Clock,
+// which has been started.
+func StartStopwatch(clock clock.Clock) *Stopwatch {
+	s := NewStopwatch(clock)
+	s.Start()
+	return s
+}
+
+// Start starts the stopwatch. If it is already running, Start does nothing.
+func (s *Stopwatch) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		s.running = true
+		s.start = s.clock.Now()
+	}
+}
+
+// Stop stops the stopwatch, and returns the total elapsed time. If it is
+// already stopped, Stop just returns the elapsed time.
+func (s *Stopwatch) Stop() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		s.advance(s.clock.Now())
+		s.running = false
+	}
+	return s.elapsed
+}
+
+// Lap ends the current lap and starts a new one, returning the time
+// elapsed in the ended lap. Time elapses in a lap only while the
+// stopwatch is running.
+func (s *Stopwatch) Lap() time.Duration {
+	return s.Checkpoint("")
+}
+
+// Checkpoint is like Lap, but names the ended lap; e.g. Checkpoint("dial")
+// after dialling, and Checkpoint("handshake") after the handshake, records
+// the time taken by each step.
+func (s *Stopwatch) Checkpoint(name string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		s.advance(s.clock.Now())
+	}
+	lap := s.lap
+	s.lap = 0
+	s.laps = append(s.laps, Segment{Name: name, Duration: lap})
+	return lap
+}
+
+// Elapsed returns the total elapsed time.
+func (s *Stopwatch) Elapsed() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return s.elapsed + s.clock.Now().Sub(s.start)
+	}
+	return s.elapsed
+}
+
+// Laps returns the times of the ended laps, in order.
+func (s *Stopwatch) Laps() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var laps []time.Duration
+	for _, lap := range s.laps {
+		laps = append(laps, lap.Duration)
+	}
+	return laps
+}
+
+// Report returns a report of the ended laps, and the total elapsed time.
+func (s *Stopwatch) Report() Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := s.elapsed
+	if s.running {
+		total += s.clock.Now().Sub(s.start)
+	}
+	return Report{
+		Segments: append([]Segment(nil), s.laps...),
+		Total:    total,
+	}
+}
+
+// Running reports whether the stopwatch is running.
+func (s *Stopwatch) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Reset stops the stopwatch, and discards the elapsed time and laps.
+func (s *Stopwatch) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	s.elapsed = 0
+	s.lap = 0
+	s.laps = nil
+}
+
+// advance accumulates the time elapsed since start. advance must be
+// called with s.mu held, while the stopwatch is running.
+func (s *Stopwatch) advance(now time.Time) {
+	d := now.Sub(s.start)
+	s.elapsed += d
+	s.lap += d
+	s.start = now
+}
+
+// Report describes the laps of a Stopwatch.
+type Report struct {
+	// Segments holds the ended laps, in order.
+	Segments []Segment
+
+	// Total is the total elapsed time, including any time
+	// elapsed in the current lap.
+	Total time.Duration
+}
+
+// String returns the report in a form suitable for logging, such as
+// "dial=1.5s handshake=200ms total=1.8s". Unnamed laps are named by
+// their position, starting with "#1".
+func (r Report) String() string {
+	var b strings.Builder
+	for i, segment := range r.Segments {
+		name := segment.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		fmt.Fprintf(&b, "%s=%v ", name, segment.Duration)
+	}
+	fmt.Fprintf(&b, "total=%v", r.Total)
+	return b.String()
+}
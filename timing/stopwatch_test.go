@@ -0,0 +1,92 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package timing_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/timing"
+	coretesting "github.com/juju/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type stopwatchSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&stopwatchSuite{})
+
+func (s *stopwatchSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *stopwatchSuite) TestStartStop(c *gc.C) {
+	w := timing.NewStopwatch(s.clock)
+	c.Assert(w.Running(), gc.Equals, false)
+	s.clock.Advance(time.Second)
+	c.Assert(w.Elapsed(), gc.Equals, time.Duration(0))
+
+	w.Start()
+	c.Assert(w.Running(), gc.Equals, true)
+	s.clock.Advance(time.Second)
+	c.Assert(w.Elapsed(), gc.Equals, time.Second)
+	w.Start()
+	s.clock.Advance(time.Second)
+	c.Assert(w.Stop(), gc.Equals, 2*time.Second)
+	c.Assert(w.Running(), gc.Equals, false)
+
+	// Time accumulates across runs.
+	s.clock.Advance(time.Minute)
+	c.Assert(w.Stop(), gc.Equals, 2*time.Second)
+	w.Start()
+	s.clock.Advance(time.Second)
+	c.Assert(w.Stop(), gc.Equals, 3*time.Second)
+}
+
+func (s *stopwatchSuite) TestLaps(c *gc.C) {
+	w := timing.StartStopwatch(s.clock)
+	s.clock.Advance(time.Second)
+	c.Assert(w.Lap(), gc.Equals, time.Second)
+	s.clock.Advance(2 * time.Second)
+	w.Stop()
+	s.clock.Advance(time.Minute)
+	w.Start()
+	s.clock.Advance(time.Second)
+	c.Assert(w.Lap(), gc.Equals, 3*time.Second)
+	s.clock.Advance(time.Second)
+	c.Assert(w.Laps(), gc.DeepEquals, []time.Duration{time.Second, 3 * time.Second})
+	c.Assert(w.Elapsed(), gc.Equals, 5*time.Second)
+
+	w.Reset()
+	c.Assert(w.Running(), gc.Equals, false)
+	c.Assert(w.Elapsed(), gc.Equals, time.Duration(0))
+	c.Assert(w.Laps(), gc.HasLen, 0)
+}
+
+func (s *stopwatchSuite) TestCheckpoints(c *gc.C) {
+	w := timing.StartStopwatch(s.clock)
+	s.clock.Advance(1500 * time.Millisecond)
+	c.Assert(w.Checkpoint("dial"), gc.Equals, 1500*time.Millisecond)
+	s.clock.Advance(200 * time.Millisecond)
+	w.Lap()
+	s.clock.Advance(100 * time.Millisecond)
+	c.Assert(w.Checkpoint("handshake"), gc.Equals, 100*time.Millisecond)
+	s.clock.Advance(time.Second)
+
+	report := w.Report()
+	c.Assert(report, gc.DeepEquals, timing.Report{
+		Segments: []timing.Segment{
+			{Name: "dial", Duration: 1500 * time.Millisecond},
+			{Duration: 200 * time.Millisecond},
+			{Name: "handshake", Duration: 100 * time.Millisecond},
+		},
+		Total: 2800 * time.Millisecond,
+	})
+	c.Assert(report.String(), gc.Equals, "dial=1.5s #2=200ms handshake=100ms total=2.8s")
+	c.Assert(w.Laps(), gc.DeepEquals, []time.Duration{
+		1500 * time.Millisecond, 200 * time.Millisecond, 100 * time.Millisecond,
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package ttlcache provides a cache whose entries expire after a
+// time-to-live, measured with a clock.Clock, a set whose keys expire
+// likewise, and a cache that serves stale values while refreshing them.
+package ttlcache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Cache.
+type Config struct {
+	// Clock is used to measure entries' time-to-live.
+	Clock clock.Clock
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	return nil
+}
+
+// Cache is a map of keys of type K to values of type V, whose entries
+// expire after a time-to-live. Expiries for all entries are held in a
+// single queue, serviced by the Cache's goroutine, which calls the
+// entries' expiry callbacks.
+//
+// Cache's methods are safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	config Config
+
+	mu      sync.Mutex
+	entries *timequeue.Queue[K, *entry[K, V]]
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type entry[K comparable, V any] struct {
+	key      K
+	value    V
+	onExpire func(K, V)
+}
+
+// New constructs and starts a new Cache with the given configuration.
+// The Cache will continue to expire entries until it is killed.
+func New[K comparable, V any](config Config) (*Cache[K, V], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating cache config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cache[K, V]{
+		config:  config,
+		entries: timequeue.New[K, *entry[K, V]](config.Clock),
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go c.loop()
+	return c, nil
+}
+
+// Kill stops the Cache from expiring entries, and calling expiry
+// callbacks. Expired entries are still not returned by Get. Kill
+// does not wait for the Cache to stop; use Wait for that.
+func (c *Cache[K, V]) Kill() {
+	c.cancel()
+}
+
+// Wait waits for the Cache to stop.
+func (c *Cache[K, V]) Wait() error {
+	<-c.done
+	return nil
+}
+
+// Set sets the value for the key, which will expire after the
+// specified time-to-live, replacing any existing entry for the key.
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.SetFunc(key, value, ttl, nil)
+}
+
+// SetFunc is like Set, but additionally arranges for onExpire, if
+// non-nil, to be called with the key and value when the entry expires.
+// onExpire is not called if the entry is replaced or deleted before it
+// expires. onExpire is called from the Cache's goroutine, without any
+// locks held, and so may call the Cache's methods.
+func (c *Cache[K, V]) SetFunc(key K, value V, ttl time.Duration, onExpire func(key K, value V)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &entry[K, V]{key: key, value: value, onExpire: onExpire}
+	expires := c.config.Clock.Now().Add(ttl)
+	if !c.entries.Update(key, e, expires) {
+		c.entries.Add(key, e, expires)
+	}
+	c.notify()
+}
+
+// Get returns the value for the key, and a boolean indicating whether
+// or not an unexpired entry for the key exists.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, expires, ok := c.entries.Get(key)
+	if !ok || !expires.After(c.config.Clock.Now()) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Delete deletes the entry for the key, without calling its expiry
+// callback. If no entry exists for the key, this is a no-op.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries.Remove(key)
+	c.notify()
+}
+
+// Len returns the number of entries in the cache, including any that
+// have expired but have not yet been removed.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
+
+// notify wakes the loop so it will re-evaluate the next expiry.
+func (c *Cache[K, V]) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Cache[K, V]) loop() {
+	defer close(c.done)
+	for {
+		c.mu.Lock()
+		next := c.entries.Next()
+		c.mu.Unlock()
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.wake:
+		case <-next:
+			c.mu.Lock()
+			expired := c.entries.Ready(c.config.Clock.Now())
+			c.mu.Unlock()
+			for _, e := range expired {
+				if e.onExpire != nil {
+					e.onExpire(e.key, e.value)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ttlcache_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/ttlcache"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type cacheSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&cacheSuite{})
+
+func (s *cacheSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *cacheSuite) newCache(c *gc.C) *ttlcache.Cache[string, string] {
+	cache, err := ttlcache.New[string, string](ttlcache.Config{Clock: s.clock})
+	c.Assert(err, jc.ErrorIsNil)
+	return cache
+}
+
+func (s *cacheSuite) TestValidate(c *gc.C) {
+	_, err := ttlcache.New[string, string](ttlcache.Config{})
+	c.Assert(err, gc.ErrorMatches, "validating cache config: nil Clock not valid")
+}
+
+func (s *cacheSuite) TestGet(c *gc.C) {
+	cache := s.newCache(c)
+	defer stop(c, cache)
+
+	cache.Set("k0", "v0", time.Second)
+	cache.Set("k1", "v1", 2*time.Second)
+	assertGet(c, cache, "k0", "v0")
+	assertGet(c, cache, "k1", "v1")
+	_, ok := cache.Get("k2")
+	c.Assert(ok, jc.IsFalse)
+
+	// Expired entries are never returned.
+	s.clock.Advance(time.Second)
+	_, ok = cache.Get("k0")
+	c.Assert(ok, jc.IsFalse)
+	assertGet(c, cache, "k1", "v1")
+
+	// Setting an existing key replaces its value and expiry.
+	cache.Set("k1", "v1.1", 2*time.Second)
+	s.clock.Advance(time.Second)
+	assertGet(c, cache, "k1", "v1.1")
+}
+
+func (s *cacheSuite) TestExpiry(c *gc.C) {
+	cache := s.newCache(c)
+	defer stop(c, cache)
+
+	type expiry struct {
+		key, value string
+		at         time.Time
+	}
+	expired := make(chan expiry, 10)
+	onExpire := func(key, value string) {
+		expired <- expiry{key, value, s.clock.Now()}
+	}
+	t0 := s.clock.Now()
+	cache.SetFunc("k0", "v0", time.Second, onExpire)
+	cache.SetFunc("k1", "v1", 2*time.Second, onExpire)
+	cache.SetFunc("k2", "v2", 3*time.Second, onExpire)
+	cache.Delete("k1")
+
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, expired), gc.Equals, expiry{"k0", "v0", t0.Add(time.Second)})
+	s.clock.Advance(time.Second)
+	assertNotReceived(c, expired)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, expired), gc.Equals, expiry{"k2", "v2", t0.Add(3 * time.Second)})
+	waitUntil(c, func() bool { return cache.Len() == 0 })
+}
+
+func assertGet(c *gc.C, cache *ttlcache.Cache[string, string], key, expect string) {
+	value, ok := cache.Get(key)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(value, gc.Equals, expect)
+}
+
+// stop kills the cache, and waits for it to stop.
+func stop(c *gc.C, cache *ttlcache.Cache[string, string]) {
+	cache.Kill()
+	c.Check(cache.Wait(), jc.ErrorIsNil)
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotReceived[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected value: %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+// waitUntil waits for cond to return true, polling it periodically.
+func waitUntil(c *gc.C, cond func() bool) {
+	timeout := time.After(coretesting.LongWait)
+	for !cond() {
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for condition")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
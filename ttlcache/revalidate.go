@@ -0,0 +1,282 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ttlcache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/logging"
+	"github.com/axw/juju-time/schedule"
+	"github.com/juju/errors"
+)
+
+// RefreshFunc returns a fresh value for the key.
+type RefreshFunc[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// RevalidatingConfig holds the configuration for a RevalidatingCache.
+type RevalidatingConfig[K comparable, V any] struct {
+	// Clock is used to measure entries' freshness, and
+	// to schedule refreshes.
+	Clock clock.Clock
+
+	// TTL is how long a value is fresh after it is set
+	// or refreshed.
+	TTL time.Duration
+
+	// Grace is how long a stale value continues to be served, while
+	// it is refreshed. An entry that has not been refreshed by the
+	// end of its grace period is removed.
+	Grace time.Duration
+
+	// Refresh is called to obtain a fresh value for a stale entry.
+	Refresh RefreshFunc[K, V]
+
+	// Backoff determines the delays between attempts to refresh an
+	// entry, after a failed attempt. The first attempt is made
+	// after Backoff.Initial, which is usually zero. Backoff's Clock
+	// is ignored; the configured Clock is used instead.
+	Backoff schedule.ExponentialBackoff
+
+	// MaxConcurrent, if positive, is the maximum number of
+	// refreshes that will be executed concurrently.
+	MaxConcurrent int
+
+	// Logger, if non-nil, is used to log failed refreshes.
+	Logger logging.Logger
+}
+
+// Validate checks that the config is valid.
+func (config RevalidatingConfig[K, V]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.TTL <= 0 {
+		return errors.NotValidf("non-positive TTL")
+	}
+	if config.Grace < 0 {
+		return errors.NotValidf("negative Grace")
+	}
+	if config.Refresh == nil {
+		return errors.NotValidf("nil Refresh")
+	}
+	if config.MaxConcurrent < 0 {
+		return errors.NotValidf("negative MaxConcurrent")
+	}
+	return nil
+}
+
+// RevalidatingCache is a cache of values of type V, keyed by K, with a
+// stale-while-revalidate policy: once a value has been cached for the
+// TTL, it becomes stale, and the next Get of the key schedules a
+// refresh. Until the refresh succeeds, the stale value continues to be
+// served, for up to the grace period. Failed refreshes are retried with
+// backoff. Refreshes are executed by a schedule.Runner, so that at most
+// one refresh of each key is pending at once.
+//
+// RevalidatingCache's methods are safe for concurrent use.
+type RevalidatingCache[K comparable, V any] struct {
+	config RevalidatingConfig[K, V]
+	cache  *Cache[K, revalidatingEntry[V]]
+	runner *schedule.Runner[K, *refresh[K, V]]
+
+	mu sync.Mutex
+	// refreshing holds the pending refresh of each key
+	// whose value is being refreshed.
+	refreshing map[K]*refresh[K, V]
+}
+
+type revalidatingEntry[V any] struct {
+	value V
+	stale time.Time
+}
+
+// NewRevalidating constructs and starts a new RevalidatingCache with
+// the given configuration. The cache will continue to refresh and
+// expire entries until it is killed.
+func NewRevalidating[K comparable, V any](config RevalidatingConfig[K, V]) (*RevalidatingCache[K, V], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating revalidating cache config")
+	}
+	config.Backoff.Clock = config.Clock
+	s, err := schedule.New(schedule.Config[K, *refresh[K, V]]{
+		Clock:    config.Clock,
+		Coalesce: schedule.CoalesceKeepEarliest,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	runner, err := schedule.NewRunner(schedule.RunnerConfig[K, *refresh[K, V]]{
+		Schedule:      s,
+		MaxConcurrent: config.MaxConcurrent,
+		Logger:        config.Logger,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cache, err := New[K, revalidatingEntry[V]](Config{Clock: config.Clock})
+	if err != nil {
+		runner.Kill()
+		return nil, errors.Trace(err)
+	}
+	return &RevalidatingCache[K, V]{
+		config:     config,
+		cache:      cache,
+		runner:     runner,
+		refreshing: make(map[K]*refresh[K, V]),
+	}, nil
+}
+
+// Kill stops the cache from refreshing and expiring entries,
+// interrupting any refreshes in progress. Kill does not wait
+// for the cache to stop; use Wait for that.
+func (c *RevalidatingCache[K, V]) Kill() {
+	c.runner.Kill()
+	c.cache.Kill()
+}
+
+// Wait waits for the cache to stop, including waiting for
+// any refreshes in progress to return.
+func (c *RevalidatingCache[K, V]) Wait() error {
+	if err := c.runner.Wait(); err != nil {
+		return errors.Trace(err)
+	}
+	return c.cache.Wait()
+}
+
+// Set sets the value for the key, which will be fresh for the TTL,
+// replacing any existing entry for the key, and cancelling any pending
+// refresh of it.
+func (c *RevalidatingCache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancelRefresh(key)
+	c.set(key, value)
+}
+
+// set caches the value, fresh from now, to be
+// removed at the end of its grace period.
+func (c *RevalidatingCache[K, V]) set(key K, value V) {
+	stale := c.config.Clock.Now().Add(c.config.TTL)
+	c.cache.Set(key, revalidatingEntry[V]{value: value, stale: stale}, c.config.TTL+c.config.Grace)
+}
+
+// Get returns the value for the key, and a boolean indicating whether
+// or not an entry for the key exists, whether fresh or stale. If the
+// value is stale, Get schedules a refresh of it, unless one is already
+// pending.
+func (c *RevalidatingCache[K, V]) Get(key K) (V, bool) {
+	value, stale, ok := c.Lookup(key)
+	if stale {
+		c.revalidate(key)
+	}
+	return value, ok
+}
+
+// Lookup is like Get, but does not schedule a refresh; instead, it
+// additionally returns whether or not the value is stale.
+func (c *RevalidatingCache[K, V]) Lookup(key K) (value V, stale, ok bool) {
+	e, ok := c.cache.Get(key)
+	if !ok {
+		return value, false, false
+	}
+	return e.value, !e.stale.After(c.config.Clock.Now()), true
+}
+
+// Delete deletes the entry for the key, cancelling any pending refresh
+// of it. If no entry exists for the key, this is a no-op.
+func (c *RevalidatingCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancelRefresh(key)
+	c.cache.Delete(key)
+}
+
+// Len returns the number of entries in the cache, including stale
+// entries, and any that have expired but have not yet been removed.
+func (c *RevalidatingCache[K, V]) Len() int {
+	return c.cache.Len()
+}
+
+// revalidate schedules a refresh of the key, unless one is pending.
+func (c *RevalidatingCache[K, V]) revalidate(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.refreshing[key]; ok {
+		return
+	}
+	op := &refresh[K, V]{
+		ExponentialBackoff: c.config.Backoff,
+		cache:              c,
+		key:                key,
+	}
+	c.refreshing[key] = op
+	c.runner.Add(op)
+}
+
+// cancelRefresh cancels any pending refresh of the key. A refresh in
+// progress is allowed to complete, but its result is discarded.
+// cancelRefresh must be called with c.mu held.
+func (c *RevalidatingCache[K, V]) cancelRefresh(key K) {
+	if _, ok := c.refreshing[key]; ok {
+		delete(c.refreshing, key)
+		c.runner.Remove(key)
+	}
+}
+
+// refresh is the operation that refreshes the value of a key.
+type refresh[K comparable, V any] struct {
+	schedule.ExponentialBackoff
+	cache *RevalidatingCache[K, V]
+	key   K
+}
+
+// Key is part of the schedule.Operation interface.
+func (op *refresh[K, V]) Key() K {
+	return op.key
+}
+
+// Do is part of the schedule.RunnableOperation interface. If the refresh
+// fails, the Runner retries it with backoff, until it succeeds, or the
+// entry is removed.
+func (op *refresh[K, V]) Do(ctx context.Context) error {
+	c := op.cache
+	if !op.current() {
+		return nil
+	}
+	if _, ok := c.cache.Get(op.key); !ok {
+		// The grace period has passed.
+		op.finish()
+		return nil
+	}
+	value, err := c.config.Refresh(ctx, op.key)
+	if err != nil {
+		return errors.Annotatef(err, "refreshing %v", op.key)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[op.key] == op {
+		delete(c.refreshing, op.key)
+		c.set(op.key, value)
+	}
+	return nil
+}
+
+// current reports whether the refresh has not been cancelled.
+func (op *refresh[K, V]) current() bool {
+	op.cache.mu.Lock()
+	defer op.cache.mu.Unlock()
+	return op.cache.refreshing[op.key] == op
+}
+
+// finish records that the refresh is no longer pending.
+func (op *refresh[K, V]) finish() {
+	op.cache.mu.Lock()
+	defer op.cache.mu.Unlock()
+	if op.cache.refreshing[op.key] == op {
+		delete(op.cache.refreshing, op.key)
+	}
+}
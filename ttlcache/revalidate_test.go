@@ -0,0 +1,226 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ttlcache_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	clocktesting "github.com/axw/juju-time/clock/testing"
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/ttlcache"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type revalidateSuite struct {
+	coretesting.BaseSuite
+	clock   *clocktesting.Clock
+	harness *clocktesting.Harness
+	refresh *refresher
+}
+
+var _ = gc.Suite(&revalidateSuite{})
+
+func (s *revalidateSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = clocktesting.NewClock(time.Time{})
+	s.harness = clocktesting.NewHarness(s.clock)
+	s.refresh = &refresher{values: make(map[string]string)}
+}
+
+func (s *revalidateSuite) newCache(c *gc.C) *ttlcache.RevalidatingCache[string, string] {
+	cache, err := ttlcache.NewRevalidating(ttlcache.RevalidatingConfig[string, string]{
+		Clock:   s.clock,
+		TTL:     time.Minute,
+		Grace:   10 * time.Minute,
+		Refresh: s.refresh.refresh,
+		Backoff: schedule.ExponentialBackoff{Min: time.Minute},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.harness.Settle(c)
+	return cache
+}
+
+// stop kills the cache, and waits for it to stop.
+func (s *revalidateSuite) stop(c *gc.C, cache *ttlcache.RevalidatingCache[string, string]) {
+	cache.Kill()
+	c.Check(cache.Wait(), jc.ErrorIsNil)
+	s.harness.AssertNoLeaks(c)
+}
+
+func (s *revalidateSuite) TestValidate(c *gc.C) {
+	refresh := s.refresh.refresh
+	for _, test := range []struct {
+		config ttlcache.RevalidatingConfig[string, string]
+		err    string
+	}{
+		{ttlcache.RevalidatingConfig[string, string]{}, "nil Clock not valid"},
+		{ttlcache.RevalidatingConfig[string, string]{Clock: s.clock}, "non-positive TTL not valid"},
+		{ttlcache.RevalidatingConfig[string, string]{Clock: s.clock, TTL: 1, Grace: -1}, "negative Grace not valid"},
+		{ttlcache.RevalidatingConfig[string, string]{Clock: s.clock, TTL: 1}, "nil Refresh not valid"},
+		{ttlcache.RevalidatingConfig[string, string]{Clock: s.clock, TTL: 1, Refresh: refresh, MaxConcurrent: -1}, "negative MaxConcurrent not valid"},
+	} {
+		_, err := ttlcache.NewRevalidating(test.config)
+		c.Check(err, gc.ErrorMatches, "validating revalidating cache config: "+test.err)
+	}
+}
+
+func (s *revalidateSuite) TestStaleWhileRevalidate(c *gc.C) {
+	cache := s.newCache(c)
+	defer s.stop(c, cache)
+
+	cache.Set("k0", "v0")
+	s.refresh.set("k0", "v1")
+	assertLookup(c, cache, "k0", "v0", false)
+
+	// Fresh values are served without refreshing them.
+	s.harness.AdvanceAndSettle(c, 59*time.Second)
+	value, ok := cache.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(value, gc.Equals, "v0")
+	s.harness.Settle(c)
+	c.Assert(s.refresh.calls(), gc.Equals, 0)
+
+	// A stale value is served, and refreshed.
+	s.harness.AdvanceAndSettle(c, time.Second)
+	assertLookup(c, cache, "k0", "v0", true)
+	value, ok = cache.Get("k0")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(value, gc.Equals, "v0")
+	s.harness.Settle(c)
+	c.Assert(s.refresh.calls(), gc.Equals, 1)
+	assertLookup(c, cache, "k0", "v1", false)
+
+	// Unknown keys are not refreshed.
+	_, ok = cache.Get("k1")
+	c.Assert(ok, jc.IsFalse)
+	s.harness.Settle(c)
+	c.Assert(s.refresh.calls(), gc.Equals, 1)
+}
+
+func (s *revalidateSuite) TestRefreshBackoff(c *gc.C) {
+	cache := s.newCache(c)
+	defer s.stop(c, cache)
+
+	cache.Set("k0", "v0")
+	s.harness.AdvanceAndSettle(c, time.Minute)
+
+	// The refresh fails, and is retried after the backoff;
+	// meanwhile, the stale value is served, and further Gets
+	// do not schedule more refreshes.
+	cache.Get("k0")
+	s.harness.Settle(c)
+	c.Assert(s.refresh.calls(), gc.Equals, 1)
+	cache.Get("k0")
+	s.harness.AdvanceAndSettle(c, 59*time.Second)
+	c.Assert(s.refresh.calls(), gc.Equals, 1)
+	assertLookup(c, cache, "k0", "v0", true)
+
+	s.refresh.set("k0", "v1")
+	s.harness.AdvanceAndSettle(c, time.Second)
+	c.Assert(s.refresh.calls(), gc.Equals, 2)
+	assertLookup(c, cache, "k0", "v1", false)
+}
+
+func (s *revalidateSuite) TestGracePeriod(c *gc.C) {
+	cache := s.newCache(c)
+	defer s.stop(c, cache)
+
+	cache.Set("k0", "v0")
+	s.harness.AdvanceAndSettle(c, time.Minute)
+	cache.Get("k0")
+	s.harness.Settle(c)
+	c.Assert(s.refresh.calls(), gc.Equals, 1)
+
+	// Once the grace period has passed without a successful
+	// refresh, the entry is removed, and no longer refreshed.
+	s.harness.AdvanceAndSettle(c, 10*time.Minute)
+	_, ok := cache.Get("k0")
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(cache.Len(), gc.Equals, 0)
+	calls := s.refresh.calls()
+	s.harness.AdvanceAndSettle(c, time.Hour)
+	c.Assert(s.refresh.calls(), gc.Equals, calls)
+}
+
+func (s *revalidateSuite) TestSetCancelsRefresh(c *gc.C) {
+	cache := s.newCache(c)
+	defer s.stop(c, cache)
+
+	cache.Set("k0", "v0")
+	s.harness.AdvanceAndSettle(c, time.Minute)
+	cache.Get("k0")
+	s.harness.Settle(c)
+	c.Assert(s.refresh.calls(), gc.Equals, 1)
+
+	// Setting the value cancels the pending retry.
+	cache.Set("k0", "v2")
+	s.refresh.set("k0", "v1")
+	s.harness.AdvanceAndSettle(c, time.Minute)
+	c.Assert(s.refresh.calls(), gc.Equals, 1)
+	assertLookup(c, cache, "k0", "v2", true)
+
+	// Deleting the entry does likewise.
+	cache.Get("k0")
+	s.harness.Settle(c)
+	c.Assert(s.refresh.calls(), gc.Equals, 2)
+	s.harness.AdvanceAndSettle(c, time.Minute)
+	assertLookup(c, cache, "k0", "v1", true)
+	s.refresh.clear("k0")
+	cache.Get("k0")
+	s.harness.Settle(c)
+	c.Assert(s.refresh.calls(), gc.Equals, 3)
+	cache.Delete("k0")
+	s.harness.AdvanceAndSettle(c, time.Hour)
+	c.Assert(s.refresh.calls(), gc.Equals, 3)
+	c.Assert(cache.Len(), gc.Equals, 0)
+}
+
+func assertLookup(c *gc.C, cache *ttlcache.RevalidatingCache[string, string], key, expect string, expectStale bool) {
+	value, stale, ok := cache.Lookup(key)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(value, gc.Equals, expect)
+	c.Assert(stale, gc.Equals, expectStale)
+}
+
+// refresher is a refresh function returning the values it holds,
+// and failing for other keys.
+type refresher struct {
+	mu     sync.Mutex
+	values map[string]string
+	n      int
+}
+
+func (r *refresher) refresh(ctx context.Context, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.n++
+	value, ok := r.values[key]
+	if !ok {
+		return "", errors.NotFoundf("%s", key)
+	}
+	return value, nil
+}
+
+func (r *refresher) set(key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[key] = value
+}
+
+func (r *refresher) clear(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, key)
+}
+
+func (r *refresher) calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.n
+}
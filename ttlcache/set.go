@@ -0,0 +1,131 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ttlcache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// SetConfig holds the configuration for a Set.
+type SetConfig struct {
+	// Clock is used to measure keys' time-to-live.
+	Clock clock.Clock
+
+	// Sliding, if true, causes Contains to extend the expiry of
+	// the keys it finds, as Touch does, so that keys expire only
+	// once they have not been seen for their time-to-live.
+	Sliding bool
+}
+
+// Validate checks that the config is valid.
+func (config SetConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	return nil
+}
+
+// Set is a set of keys of type K that expire after a time-to-live, such
+// as is used to deduplicate recently seen events. Expiries are held in a
+// queue, and expired keys are removed by the Set's methods as they are
+// called, so a Set needs no goroutine of its own.
+//
+// Set's methods are safe for concurrent use.
+type Set[K comparable] struct {
+	config SetConfig
+
+	mu sync.Mutex
+	// keys holds each key's time-to-live,
+	// queued for the time it expires.
+	keys *timequeue.Queue[K, time.Duration]
+}
+
+// NewSet returns a new, empty Set with the given configuration.
+func NewSet[K comparable](config SetConfig) (*Set[K], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating set config")
+	}
+	return &Set[K]{
+		config: config,
+		keys:   timequeue.New[K, time.Duration](config.Clock),
+	}, nil
+}
+
+// Add adds the key to the set, to expire after the specified
+// time-to-live, replacing the expiry of the key if it is already in
+// the set. Add reports whether the key was added, rather than already
+// being in the set.
+func (s *Set[K]) Add(key K, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.expire()
+	if s.keys.Update(key, ttl, now.Add(ttl)) {
+		return false
+	}
+	s.keys.Add(key, ttl, now.Add(ttl))
+	return true
+}
+
+// Contains reports whether the key is in the set, and has not expired.
+// If the set is sliding, Contains extends the expiry of the key.
+func (s *Set[K]) Contains(key K) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.expire()
+	if s.config.Sliding {
+		return s.touch(key, now)
+	}
+	_, _, ok := s.keys.Get(key)
+	return ok
+}
+
+// Touch extends the expiry of the key to its time-to-live from now, and
+// reports whether the key is in the set.
+func (s *Set[K]) Touch(key K) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.touch(key, s.expire())
+}
+
+// Remove removes the key from the set. If the key is not in the set,
+// this is a no-op.
+func (s *Set[K]) Remove(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys.Remove(key)
+}
+
+// Len returns the number of unexpired keys in the set.
+func (s *Set[K]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	return s.keys.Len()
+}
+
+// expire removes the expired keys, and returns the current time.
+// expire must be called with s.mu held.
+func (s *Set[K]) expire() time.Time {
+	now := s.config.Clock.Now()
+	for {
+		if _, ok := s.keys.PopReady(now); !ok {
+			return now
+		}
+	}
+}
+
+// touch extends the expiry of the key, if it is in the set.
+// touch must be called with s.mu held.
+func (s *Set[K]) touch(key K, now time.Time) bool {
+	ttl, _, ok := s.keys.Get(key)
+	if ok {
+		s.keys.Update(key, ttl, now.Add(ttl))
+	}
+	return ok
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ttlcache_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/ttlcache"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type setSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&setSuite{})
+
+func (s *setSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *setSuite) newSet(c *gc.C, sliding bool) *ttlcache.Set[string] {
+	set, err := ttlcache.NewSet[string](ttlcache.SetConfig{
+		Clock:   s.clock,
+		Sliding: sliding,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return set
+}
+
+func (s *setSuite) TestValidate(c *gc.C) {
+	_, err := ttlcache.NewSet[string](ttlcache.SetConfig{})
+	c.Assert(err, gc.ErrorMatches, "validating set config: nil Clock not valid")
+}
+
+func (s *setSuite) TestAdd(c *gc.C) {
+	set := s.newSet(c, false)
+	c.Assert(set.Add("a", time.Second), jc.IsTrue)
+	c.Assert(set.Add("b", 2*time.Second), jc.IsTrue)
+	c.Assert(set.Add("a", time.Second), jc.IsFalse)
+	c.Assert(set.Contains("a"), jc.IsTrue)
+	c.Assert(set.Contains("c"), jc.IsFalse)
+	c.Assert(set.Len(), gc.Equals, 2)
+
+	// Keys expire after their time-to-live, and
+	// may then be added again.
+	s.clock.Advance(time.Second)
+	c.Assert(set.Contains("a"), jc.IsFalse)
+	c.Assert(set.Contains("b"), jc.IsTrue)
+	c.Assert(set.Len(), gc.Equals, 1)
+	c.Assert(set.Add("a", time.Second), jc.IsTrue)
+
+	set.Remove("b")
+	c.Assert(set.Contains("b"), jc.IsFalse)
+	c.Assert(set.Len(), gc.Equals, 1)
+}
+
+func (s *setSuite) TestAddReplacesExpiry(c *gc.C) {
+	set := s.newSet(c, false)
+	set.Add("a", time.Minute)
+	set.Add("a", time.Second)
+	s.clock.Advance(time.Second)
+	c.Assert(set.Contains("a"), jc.IsFalse)
+}
+
+func (s *setSuite) TestTouch(c *gc.C) {
+	set := s.newSet(c, false)
+	set.Add("a", time.Second)
+	s.clock.Advance(500 * time.Millisecond)
+	c.Assert(set.Touch("a"), jc.IsTrue)
+	c.Assert(set.Touch("b"), jc.IsFalse)
+
+	// Contains does not extend the expiry
+	// of a set that is not sliding.
+	s.clock.Advance(900 * time.Millisecond)
+	c.Assert(set.Contains("a"), jc.IsTrue)
+	s.clock.Advance(100 * time.Millisecond)
+	c.Assert(set.Contains("a"), jc.IsFalse)
+	c.Assert(set.Touch("a"), jc.IsFalse)
+}
+
+func (s *setSuite) TestSliding(c *gc.C) {
+	set := s.newSet(c, true)
+	set.Add("a", time.Second)
+	for i := 0; i < 5; i++ {
+		s.clock.Advance(900 * time.Millisecond)
+		c.Assert(set.Contains("a"), jc.IsTrue)
+	}
+	s.clock.Advance(time.Second)
+	c.Assert(set.Contains("a"), jc.IsFalse)
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package watchdog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// DeadManSwitchConfig holds the configuration for a DeadManSwitch.
+type DeadManSwitchConfig struct {
+	// Clock is used to measure the timeout.
+	Clock clock.Clock
+
+	// Timeout is the time within which the switch must be kicked,
+	// following its creation or the previous kick.
+	Timeout time.Duration
+
+	// Action is called, once, if the switch is not kicked in time.
+	Action func()
+}
+
+// Validate checks that the config is valid.
+func (config DeadManSwitchConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Timeout <= 0 {
+		return errors.NotValidf("non-positive Timeout")
+	}
+	if config.Action == nil {
+		return errors.NotValidf("nil Action")
+	}
+	return nil
+}
+
+// DeadManSwitch calls an action if it is not kicked within a timeout.
+// Once the action has been called, or the switch has been disarmed, the
+// switch can no longer be kicked.
+//
+// DeadManSwitch's methods are safe for concurrent use.
+type DeadManSwitch struct {
+	config DeadManSwitchConfig
+
+	mu       sync.Mutex
+	deadline time.Time
+	fired    bool
+	disarmed bool
+
+	disarm chan struct{}
+	done   chan struct{}
+}
+
+// NewDeadManSwitch returns a new, armed, DeadManSwitch with the given
+// configuration. The switch must be kicked within the timeout from now.
+func NewDeadManSwitch(config DeadManSwitchConfig) (*DeadManSwitch, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating dead man's switch config")
+	}
+	s := &DeadManSwitch{
+		config:   config,
+		deadline: config.Clock.Now().Add(config.Timeout),
+		disarm:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Kick extends the deadline to the timeout from now. Kick reports
+// whether the switch was still armed; if it has fired or been
+// disarmed, Kick has no effect.
+func (s *DeadManSwitch) Kick() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fired || s.disarmed {
+		return false
+	}
+	s.deadline = s.config.Clock.Now().Add(s.config.Timeout)
+	return true
+}
+
+// Disarm disarms the switch, so that it will never fire, and reports
+// whether the switch was still armed. If the switch has already fired,
+// Disarm waits for the action to complete.
+func (s *DeadManSwitch) Disarm() bool {
+	s.mu.Lock()
+	armed := !s.fired && !s.disarmed
+	if armed {
+		s.disarmed = true
+		close(s.disarm)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return armed
+}
+
+// Fired reports whether the switch has fired.
+func (s *DeadManSwitch) Fired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fired
+}
+
+func (s *DeadManSwitch) loop() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		deadline := s.deadline
+		s.mu.Unlock()
+
+		select {
+		case <-s.disarm:
+			return
+		case <-clock.Alarm(s.config.Clock, deadline):
+		}
+
+		s.mu.Lock()
+		fire := !s.disarmed && !s.config.Clock.Now().Before(s.deadline)
+		if fire {
+			s.fired = true
+		}
+		s.mu.Unlock()
+		if fire {
+			s.config.Action()
+			return
+		}
+	}
+}
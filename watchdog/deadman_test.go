@@ -0,0 +1,83 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package watchdog_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/watchdog"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type deadManSwitchSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+	fired chan time.Time
+}
+
+var _ = gc.Suite(&deadManSwitchSuite{})
+
+func (s *deadManSwitchSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.fired = make(chan time.Time, 10)
+}
+
+func (s *deadManSwitchSuite) newSwitch(c *gc.C) *watchdog.DeadManSwitch {
+	sw, err := watchdog.NewDeadManSwitch(watchdog.DeadManSwitchConfig{
+		Clock:   s.clock,
+		Timeout: time.Second,
+		Action: func() {
+			s.fired <- s.clock.Now()
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return sw
+}
+
+func (s *deadManSwitchSuite) TestValidate(c *gc.C) {
+	_, err := watchdog.NewDeadManSwitch(watchdog.DeadManSwitchConfig{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating dead man's switch config: non-positive Timeout not valid")
+}
+
+func (s *deadManSwitchSuite) TestKick(c *gc.C) {
+	sw := s.newSwitch(c)
+	t0 := s.clock.Now()
+	for i := 0; i < 3; i++ {
+		s.clock.Advance(900 * time.Millisecond)
+		c.Assert(sw.Kick(), jc.IsTrue)
+	}
+	assertNotFired(c, s.fired)
+	c.Assert(sw.Fired(), jc.IsFalse)
+
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.fired), gc.Equals, t0.Add(3700*time.Millisecond))
+
+	// Firing is irreversible.
+	c.Assert(sw.Kick(), jc.IsFalse)
+	c.Assert(sw.Fired(), jc.IsTrue)
+	c.Assert(sw.Disarm(), jc.IsFalse)
+	s.clock.Advance(time.Minute)
+	assertNotFired(c, s.fired)
+}
+
+func (s *deadManSwitchSuite) TestDisarm(c *gc.C) {
+	sw := s.newSwitch(c)
+	c.Assert(sw.Disarm(), jc.IsTrue)
+	c.Assert(sw.Disarm(), jc.IsFalse)
+	c.Assert(sw.Kick(), jc.IsFalse)
+	s.clock.Advance(time.Minute)
+	assertNotFired(c, s.fired)
+	c.Assert(sw.Fired(), jc.IsFalse)
+}
+
+func assertNotFired(c *gc.C, ch <-chan time.Time) {
+	select {
+	case t := <-ch:
+		c.Fatalf("unexpected firing at %v", t)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package watchdog
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/juju/errors"
+)
+
+// IdleTimerConfig holds the configuration for an IdleTimer.
+type IdleTimerConfig struct {
+	// Clock is used to measure inactivity.
+	Clock clock.Clock
+
+	// Timeout is the period of inactivity after which
+	// the timer fires.
+	Timeout time.Duration
+
+	// OnIdle is called each time the timer fires. It is called from
+	// the timer's goroutine, and so may call Touch, but not Stop.
+	OnIdle func()
+}
+
+// Validate checks that the config is valid.
+func (config IdleTimerConfig) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Timeout <= 0 {
+		return errors.NotValidf("non-positive Timeout")
+	}
+	if config.OnIdle == nil {
+		return errors.NotValidf("nil OnIdle")
+	}
+	return nil
+}
+
+// IdleTimer fires after a period of inactivity, as reported by Touch.
+// Once it has fired, it fires again only after a further Touch and
+// period of inactivity.
+//
+// Touch only records the time of the activity; rather than resetting
+// a timer on every Touch, the timer's goroutine wakes at most once per
+// timeout, and checks whether there has been activity in the meantime.
+// Touch is therefore cheap enough to call on every read or write.
+//
+// IdleTimer's methods are safe for concurrent use.
+type IdleTimer struct {
+	config IdleTimerConfig
+
+	// start is the time at which the timer was created, and
+	// last is the time of the last activity as an offset from
+	// start, so that it may be updated atomically.
+	start time.Time
+	last  atomic.Int64
+	// idle records whether the timer has fired since
+	// the last activity.
+	idle atomic.Bool
+
+	timer    clock.Timer
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewIdleTimer returns a new IdleTimer with the given configuration,
+// which will fire if it is not touched within the timeout from now.
+func NewIdleTimer(config IdleTimerConfig) (*IdleTimer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating idle timer config")
+	}
+	t := &IdleTimer{
+		config: config,
+		start:  config.Clock.Now(),
+		timer:  clock.NewTimer(config.Clock, config.Timeout),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.loop()
+	return t, nil
+}
+
+// Touch records activity, postponing the timer until
+// the timeout has elapsed from now.
+func (t *IdleTimer) Touch() {
+	t.last.Store(int64(t.config.Clock.Now().Sub(t.start)))
+	if t.idle.Load() && t.idle.CompareAndSwap(true, false) {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Idle reports whether the timer has fired since the last activity.
+func (t *IdleTimer) Idle() bool {
+	return t.idle.Load()
+}
+
+// Stop stops the timer, so that it will not fire again, and waits
+// for any call to OnIdle to complete.
+func (t *IdleTimer) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+}
+
+// deadline returns the time at which the timer
+// will fire, if it is not touched.
+func (t *IdleTimer) deadline() time.Time {
+	return t.start.Add(time.Duration(t.last.Load()) + t.config.Timeout)
+}
+
+func (t *IdleTimer) loop() {
+	defer close(t.done)
+	timer := t.timer
+	defer timer.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-t.wake:
+			timer.Reset(t.deadline().Sub(t.config.Clock.Now()))
+			continue
+		case <-timer.Chan():
+		}
+
+		// Mark the timer idle before checking for activity, so that
+		// a concurrent Touch either is seen here, or sees the timer
+		// idle and wakes the loop.
+		t.idle.Store(true)
+		if d := t.deadline().Sub(t.config.Clock.Now()); d > 0 {
+			t.idle.CompareAndSwap(true, false)
+			timer.Reset(d)
+			continue
+		}
+		t.config.OnIdle()
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package watchdog_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/watchdog"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type idleTimerSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+	fired chan time.Time
+}
+
+var _ = gc.Suite(&idleTimerSuite{})
+
+func (s *idleTimerSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.fired = make(chan time.Time, 10)
+}
+
+func (s *idleTimerSuite) newIdleTimer(c *gc.C) *watchdog.IdleTimer {
+	t, err := watchdog.NewIdleTimer(watchdog.IdleTimerConfig{
+		Clock:   s.clock,
+		Timeout: time.Second,
+		OnIdle: func() {
+			s.fired <- s.clock.Now()
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return t
+}
+
+func (s *idleTimerSuite) TestValidate(c *gc.C) {
+	_, err := watchdog.NewIdleTimer(watchdog.IdleTimerConfig{Clock: s.clock, Timeout: time.Second})
+	c.Assert(err, gc.ErrorMatches, "validating idle timer config: nil OnIdle not valid")
+}
+
+func (s *idleTimerSuite) TestTouch(c *gc.C) {
+	t := s.newIdleTimer(c)
+	defer t.Stop()
+	t0 := s.clock.Now()
+	for i := 0; i < 3; i++ {
+		s.clock.Advance(900 * time.Millisecond)
+		t.Touch()
+	}
+	assertNotFired(c, s.fired)
+	c.Assert(t.Idle(), jc.IsFalse)
+
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.fired), gc.Equals, t0.Add(3700*time.Millisecond))
+	c.Assert(t.Idle(), jc.IsTrue)
+
+	// The timer does not fire again until it
+	// has been touched and become idle again.
+	s.clock.Advance(time.Hour)
+	assertNotFired(c, s.fired)
+	t.Touch()
+	c.Assert(t.Idle(), jc.IsFalse)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.fired), gc.Equals, t0.Add(time.Hour+4700*time.Millisecond))
+}
+
+func (s *idleTimerSuite) TestStop(c *gc.C) {
+	t := s.newIdleTimer(c)
+	t.Stop()
+	t.Stop()
+	s.clock.Advance(time.Second)
+	assertNotFired(c, s.fired)
+}
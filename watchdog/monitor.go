@@ -0,0 +1,199 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package watchdog provides a Monitor for named heartbeats, which
+// reports heartbeats that are not received within their expected
+// intervals.
+package watchdog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// Missed describes a missed heartbeat.
+type Missed struct {
+	// Name is the name of the heartbeat.
+	Name string
+
+	// LastBeat is the time of the most recent beat, or of the
+	// heartbeat's registration if it has never beaten.
+	LastBeat time.Time
+
+	// Deadline is the time by which the heartbeat was expected.
+	Deadline time.Time
+}
+
+// Config holds the configuration for a Monitor.
+type Config struct {
+	// Clock is used to measure heartbeat intervals.
+	Clock clock.Clock
+
+	// OnMissed is called for each missed heartbeat. It is called
+	// once each time a heartbeat is missed; the heartbeat is not
+	// reported again until it has beaten, and then been missed
+	// again. OnMissed is called without any locks held, and so may
+	// call the Monitor's methods.
+	OnMissed func(Missed)
+}
+
+// Validate checks that the config is valid.
+func (config Config) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.OnMissed == nil {
+		return errors.NotValidf("nil OnMissed")
+	}
+	return nil
+}
+
+// Monitor monitors named heartbeats, each of which is expected to beat
+// within its interval of the previous beat. Deadlines for all heartbeats
+// are held in a single queue, serviced by the Monitor's goroutine.
+//
+// Monitor's methods are safe for concurrent use.
+type Monitor struct {
+	config Config
+
+	mu         sync.Mutex
+	heartbeats map[string]*heartbeat
+	// deadlines holds the deadlines of heartbeats that have not
+	// been missed.
+	deadlines *timequeue.Queue[string, *heartbeat]
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type heartbeat struct {
+	name     string
+	interval time.Duration
+	last     time.Time
+}
+
+// NewMonitor constructs and starts a new Monitor with the given
+// configuration. The Monitor will continue to run until it is killed.
+func NewMonitor(config Config) (*Monitor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating monitor config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Monitor{
+		config:     config,
+		heartbeats: make(map[string]*heartbeat),
+		deadlines:  timequeue.New[string, *heartbeat](config.Clock),
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go m.loop()
+	return m, nil
+}
+
+// Kill stops the Monitor. Kill does not wait for the Monitor to stop;
+// use Wait for that.
+func (m *Monitor) Kill() {
+	m.cancel()
+}
+
+// Wait waits for the Monitor to stop.
+func (m *Monitor) Wait() error {
+	<-m.done
+	return nil
+}
+
+// Register registers a heartbeat with the specified name, which is
+// expected to beat within each interval, starting from now. Register
+// returns an error satisfying errors.IsAlreadyExists if a heartbeat
+// with the same name is already registered.
+func (m *Monitor) Register(name string, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.NotValidf("non-positive interval")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.heartbeats[name]; ok {
+		return errors.AlreadyExistsf("heartbeat %q", name)
+	}
+	hb := &heartbeat{name: name, interval: interval, last: m.config.Clock.Now()}
+	m.heartbeats[name] = hb
+	m.deadlines.Add(name, hb, hb.last.Add(interval))
+	m.notify()
+	return nil
+}
+
+// Unregister unregisters the heartbeat with the specified name. If no
+// such heartbeat is registered, this is a no-op.
+func (m *Monitor) Unregister(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.heartbeats, name)
+	m.deadlines.Remove(name)
+	m.notify()
+}
+
+// Beat records a beat of the heartbeat with the specified name, which
+// is next expected within its interval. Beat returns an error satisfying
+// errors.IsNotFound if no such heartbeat is registered.
+func (m *Monitor) Beat(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hb, ok := m.heartbeats[name]
+	if !ok {
+		return errors.NotFoundf("heartbeat %q", name)
+	}
+	hb.last = m.config.Clock.Now()
+	deadline := hb.last.Add(hb.interval)
+	if !m.deadlines.Update(name, hb, deadline) {
+		// The heartbeat was missed; rearm it.
+		m.deadlines.Add(name, hb, deadline)
+	}
+	m.notify()
+	return nil
+}
+
+// notify wakes the loop so it will re-evaluate the deadlines.
+func (m *Monitor) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Monitor) loop() {
+	defer close(m.done)
+	for {
+		m.mu.Lock()
+		next := m.deadlines.Next()
+		m.mu.Unlock()
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.wake:
+		case <-next:
+			m.mu.Lock()
+			var missed []Missed
+			for _, hb := range m.deadlines.Ready(m.config.Clock.Now()) {
+				missed = append(missed, Missed{
+					Name:     hb.name,
+					LastBeat: hb.last,
+					Deadline: hb.last.Add(hb.interval),
+				})
+			}
+			m.mu.Unlock()
+			for _, missed := range missed {
+				m.config.OnMissed(missed)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package watchdog_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/watchdog"
+	"github.com/juju/errors"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type monitorSuite struct {
+	coretesting.BaseSuite
+	clock  *coretesting.Clock
+	missed chan watchdog.Missed
+}
+
+var _ = gc.Suite(&monitorSuite{})
+
+func (s *monitorSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+	s.missed = make(chan watchdog.Missed, 10)
+}
+
+func (s *monitorSuite) newMonitor(c *gc.C) *watchdog.Monitor {
+	m, err := watchdog.NewMonitor(watchdog.Config{
+		Clock: s.clock,
+		OnMissed: func(missed watchdog.Missed) {
+			s.missed <- missed
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return m
+}
+
+func (s *monitorSuite) TestValidate(c *gc.C) {
+	_, err := watchdog.NewMonitor(watchdog.Config{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating monitor config: nil OnMissed not valid")
+}
+
+func (s *monitorSuite) TestRegister(c *gc.C) {
+	m := s.newMonitor(c)
+	defer stop(c, m)
+
+	c.Assert(m.Register("loop", time.Second), jc.ErrorIsNil)
+	err := m.Register("loop", time.Second)
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	err = m.Beat("other")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	err = m.Register("other", 0)
+	c.Assert(err, gc.ErrorMatches, "non-positive interval not valid")
+}
+
+func (s *monitorSuite) TestMissed(c *gc.C) {
+	m := s.newMonitor(c)
+	defer stop(c, m)
+
+	t0 := s.clock.Now()
+	c.Assert(m.Register("loop", time.Second), jc.ErrorIsNil)
+	s.clock.Advance(500 * time.Millisecond)
+	c.Assert(m.Beat("loop"), jc.ErrorIsNil)
+	s.clock.Advance(500 * time.Millisecond)
+	assertNotMissed(c, s.missed)
+
+	s.clock.Advance(500 * time.Millisecond)
+	c.Assert(receive(c, s.missed), jc.DeepEquals, watchdog.Missed{
+		Name:     "loop",
+		LastBeat: t0.Add(500 * time.Millisecond),
+		Deadline: t0.Add(1500 * time.Millisecond),
+	})
+
+	// A missed heartbeat is reported once, until it beats again.
+	s.clock.Advance(time.Minute)
+	assertNotMissed(c, s.missed)
+	c.Assert(m.Beat("loop"), jc.ErrorIsNil)
+	s.clock.Advance(time.Second)
+	c.Assert(receive(c, s.missed).Name, gc.Equals, "loop")
+}
+
+func (s *monitorSuite) TestUnregister(c *gc.C) {
+	m := s.newMonitor(c)
+	defer stop(c, m)
+
+	c.Assert(m.Register("loop", time.Second), jc.ErrorIsNil)
+	m.Unregister("loop")
+	s.clock.Advance(time.Minute)
+	assertNotMissed(c, s.missed)
+	c.Assert(m.Register("loop", time.Second), jc.ErrorIsNil)
+}
+
+// stop kills the monitor, and waits for it to stop.
+func stop(c *gc.C, m *watchdog.Monitor) {
+	m.Kill()
+	c.Check(m.Wait(), jc.ErrorIsNil)
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotMissed(c *gc.C, ch <-chan watchdog.Missed) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected missed heartbeat: %+v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
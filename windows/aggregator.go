@@ -0,0 +1,244 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package windows provides an Aggregator, which reduces timestamped
+// events into tumbling or sliding windows of time, and emits each
+// window once it is complete.
+package windows
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// Number is the constraint for values that may be summed with Sum.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// Count is a reducer that counts events.
+func Count[E any](acc int, _ E) int {
+	return acc + 1
+}
+
+// Sum is a reducer that sums events.
+func Sum[N Number](acc, e N) N {
+	return acc + e
+}
+
+// Window is a completed window of events.
+type Window[A any] struct {
+	// Start and End are the bounds of the window: it contains
+	// events at or after Start, and before End.
+	Start, End time.Time
+
+	// Count is the number of events in the window.
+	Count int
+
+	// Value is the result of reducing the window's events.
+	Value A
+}
+
+// Config holds the configuration for an Aggregator.
+type Config[E, A any] struct {
+	// Clock is used to determine when windows are complete.
+	Clock clock.Clock
+
+	// Size is the duration of each window.
+	Size time.Duration
+
+	// Slide, if non-zero, is the interval between the starts of
+	// successive windows, which then overlap, so that each event is
+	// reduced into Size/Slide windows. Slide must divide Size. If
+	// Slide is zero, or equal to Size, windows are tumbling: they do
+	// not overlap.
+	Slide time.Duration
+
+	// Lateness is how long after a window's end, as measured by the
+	// Clock, events are still accepted into it. The watermark, before
+	// which events are late and are rejected, trails the Clock by
+	// Lateness.
+	Lateness time.Duration
+
+	// Reduce is called to reduce each event into each window it falls
+	// within, starting with Initial; for example, Count or Sum.
+	Reduce func(acc A, event E) A
+
+	// Initial is the value with which each window's reduction starts.
+	Initial A
+
+	// Buffer is the capacity of the channel returned by
+	// Aggregator.Windows.
+	Buffer int
+}
+
+// Validate checks that the config is valid.
+func (config Config[E, A]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Size <= 0 {
+		return errors.NotValidf("non-positive Size")
+	}
+	if config.Slide < 0 {
+		return errors.NotValidf("negative Slide")
+	}
+	if config.Slide > 0 && config.Size%config.Slide != 0 {
+		return errors.NotValidf("Slide %v not dividing Size %v", config.Slide, config.Size)
+	}
+	if config.Lateness < 0 {
+		return errors.NotValidf("negative Lateness")
+	}
+	if config.Reduce == nil {
+		return errors.NotValidf("nil Reduce")
+	}
+	if config.Buffer < 0 {
+		return errors.NotValidf("negative Buffer")
+	}
+	return nil
+}
+
+// Aggregator reduces events of type E into windows with values of type A.
+// Windows are aligned to multiples of the slide, or size for tumbling
+// windows, since the zero time. Each window that contains any events is
+// sent on the Windows channel, in order of start time, when the watermark
+// passes its end. Open windows are held in a single queue, serviced by
+// the Aggregator's goroutine.
+//
+// Aggregator's methods are safe for concurrent use.
+type Aggregator[E, A any] struct {
+	config Config[E, A]
+	slide  time.Duration
+
+	mu   sync.Mutex
+	open *timequeue.Queue[time.Time, *Window[A]]
+
+	windows chan Window[A]
+	wake    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// New constructs and starts a new Aggregator with the given
+// configuration. The Aggregator will continue to emit windows
+// until it is killed.
+func New[E, A any](config Config[E, A]) (*Aggregator[E, A], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating aggregator config")
+	}
+	slide := config.Slide
+	if slide == 0 {
+		slide = config.Size
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Aggregator[E, A]{
+		config:  config,
+		slide:   slide,
+		open:    timequeue.New[time.Time, *Window[A]](config.Clock),
+		windows: make(chan Window[A], config.Buffer),
+		wake:    make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go a.loop()
+	return a, nil
+}
+
+// Kill stops the Aggregator, discarding any open windows, and closes
+// the Windows channel. Kill does not wait for the Aggregator to stop;
+// use Wait for that.
+func (a *Aggregator[E, A]) Kill() {
+	a.cancel()
+}
+
+// Wait waits for the Aggregator to stop.
+func (a *Aggregator[E, A]) Wait() error {
+	<-a.done
+	return nil
+}
+
+// Windows returns the channel on which completed windows are sent.
+// The channel is closed when the Aggregator stops.
+func (a *Aggregator[E, A]) Windows() <-chan Window[A] {
+	return a.windows
+}
+
+// Watermark returns the current watermark: events before
+// it are late for any window that ends at or before it.
+func (a *Aggregator[E, A]) Watermark() time.Time {
+	return a.config.Clock.Now().Add(-a.config.Lateness)
+}
+
+// Add reduces an event that occurred at time t into each of the windows
+// it falls within, and reports whether it did so. Add returns false if
+// the event is late for all of those windows.
+func (a *Aggregator[E, A]) Add(t time.Time, event E) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	watermark := a.Watermark()
+	added := false
+	last := t.Truncate(a.slide).UTC()
+	for start := last; start.After(t.Add(-a.config.Size)); start = start.Add(-a.slide) {
+		end := start.Add(a.config.Size)
+		if !end.After(watermark) {
+			// This window, and any earlier ones, are complete.
+			break
+		}
+		w, _, ok := a.open.Get(start)
+		if !ok {
+			w = &Window[A]{Start: start, End: end, Value: a.config.Initial}
+			a.open.Add(start, w, end.Add(a.config.Lateness))
+		}
+		w.Count++
+		w.Value = a.config.Reduce(w.Value, event)
+		added = true
+	}
+	if added {
+		a.notify()
+	}
+	return added
+}
+
+// notify wakes the loop so it will re-evaluate the open windows.
+func (a *Aggregator[E, A]) notify() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (a *Aggregator[E, A]) loop() {
+	defer close(a.done)
+	defer close(a.windows)
+	for {
+		a.mu.Lock()
+		next := a.open.Next()
+		a.mu.Unlock()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-a.wake:
+		case <-next:
+			a.mu.Lock()
+			complete := a.open.Ready(a.config.Clock.Now())
+			a.mu.Unlock()
+			for _, w := range complete {
+				select {
+				case <-a.ctx.Done():
+					return
+				case a.windows <- *w:
+				}
+			}
+		}
+	}
+}
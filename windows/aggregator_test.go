@@ -0,0 +1,161 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package windows_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/windows"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type aggregatorSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+	t0    time.Time
+}
+
+var _ = gc.Suite(&aggregatorSuite{})
+
+func (s *aggregatorSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.t0 = time.Date(2015, 7, 15, 10, 0, 0, 0, time.UTC)
+	s.clock = coretesting.NewClock(s.t0)
+}
+
+func (s *aggregatorSuite) TestValidate(c *gc.C) {
+	valid := windows.Config[int, int]{
+		Clock:  s.clock,
+		Size:   time.Minute,
+		Reduce: windows.Sum[int],
+	}
+	for _, test := range []struct {
+		mutate func(*windows.Config[int, int])
+		err    string
+	}{
+		{func(config *windows.Config[int, int]) { config.Clock = nil }, "nil Clock"},
+		{func(config *windows.Config[int, int]) { config.Size = 0 }, "non-positive Size"},
+		{func(config *windows.Config[int, int]) { config.Slide = -1 }, "negative Slide"},
+		{func(config *windows.Config[int, int]) { config.Slide = 7 * time.Second }, "Slide 7s not dividing Size 1m0s"},
+		{func(config *windows.Config[int, int]) { config.Lateness = -1 }, "negative Lateness"},
+		{func(config *windows.Config[int, int]) { config.Reduce = nil }, "nil Reduce"},
+		{func(config *windows.Config[int, int]) { config.Buffer = -1 }, "negative Buffer"},
+	} {
+		config := valid
+		test.mutate(&config)
+		_, err := windows.New(config)
+		c.Check(err, gc.ErrorMatches, "validating aggregator config: "+test.err+" not valid")
+	}
+}
+
+func (s *aggregatorSuite) TestTumbling(c *gc.C) {
+	a, err := windows.New(windows.Config[string, int]{
+		Clock:  s.clock,
+		Size:   time.Minute,
+		Reduce: windows.Count[string],
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer stop(c, a)
+
+	c.Assert(a.Add(s.t0, "a"), jc.IsTrue)
+	c.Assert(a.Add(s.t0.Add(59*time.Second), "b"), jc.IsTrue)
+	c.Assert(a.Add(s.t0.Add(time.Minute), "c"), jc.IsTrue)
+	c.Assert(a.Add(s.t0.Add(3*time.Minute), "d"), jc.IsTrue)
+
+	s.clock.Advance(time.Minute)
+	c.Assert(receive(c, a.Windows()), jc.DeepEquals, windows.Window[int]{
+		Start: s.t0, End: s.t0.Add(time.Minute), Count: 2, Value: 2,
+	})
+	assertNoWindow(c, a.Windows())
+
+	// Empty windows are not emitted.
+	s.clock.Advance(3 * time.Minute)
+	c.Assert(receive(c, a.Windows()).Start, gc.Equals, s.t0.Add(time.Minute))
+	c.Assert(receive(c, a.Windows()).Start, gc.Equals, s.t0.Add(3*time.Minute))
+}
+
+func (s *aggregatorSuite) TestSliding(c *gc.C) {
+	a, err := windows.New(windows.Config[int, int]{
+		Clock:  s.clock,
+		Size:   time.Minute,
+		Slide:  30 * time.Second,
+		Reduce: windows.Sum[int],
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer stop(c, a)
+
+	a.Add(s.t0.Add(10*time.Second), 1)
+	a.Add(s.t0.Add(40*time.Second), 2)
+	s.clock.Advance(90 * time.Second)
+	for _, expected := range []windows.Window[int]{
+		{Start: s.t0.Add(-30 * time.Second), End: s.t0.Add(30 * time.Second), Count: 1, Value: 1},
+		{Start: s.t0, End: s.t0.Add(time.Minute), Count: 2, Value: 3},
+		{Start: s.t0.Add(30 * time.Second), End: s.t0.Add(90 * time.Second), Count: 1, Value: 2},
+	} {
+		c.Assert(receive(c, a.Windows()), jc.DeepEquals, expected)
+	}
+}
+
+func (s *aggregatorSuite) TestLateness(c *gc.C) {
+	a, err := windows.New(windows.Config[int, int]{
+		Clock:    s.clock,
+		Size:     time.Minute,
+		Lateness: 10 * time.Second,
+		Reduce:   windows.Sum[int],
+		Initial:  100,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer stop(c, a)
+
+	a.Add(s.t0, 1)
+	s.clock.Advance(65 * time.Second)
+	c.Assert(a.Watermark(), gc.Equals, s.t0.Add(55*time.Second))
+	// The window is still open to late events.
+	c.Assert(a.Add(s.t0.Add(30*time.Second), 2), jc.IsTrue)
+	assertNoWindow(c, a.Windows())
+
+	s.clock.Advance(5 * time.Second)
+	c.Assert(receive(c, a.Windows()), jc.DeepEquals, windows.Window[int]{
+		Start: s.t0, End: s.t0.Add(time.Minute), Count: 2, Value: 103,
+	})
+	c.Assert(a.Add(s.t0.Add(30*time.Second), 4), jc.IsFalse)
+}
+
+func (s *aggregatorSuite) TestKillClosesWindows(c *gc.C) {
+	a, err := windows.New(windows.Config[int, int]{
+		Clock:  s.clock,
+		Size:   time.Minute,
+		Reduce: windows.Sum[int],
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	a.Add(s.t0, 1)
+	stop(c, a)
+	_, ok := <-a.Windows()
+	c.Assert(ok, jc.IsFalse)
+}
+
+func stop[E, A any](c *gc.C, a *windows.Aggregator[E, A]) {
+	a.Kill()
+	c.Check(a.Wait(), jc.ErrorIsNil)
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNoWindow[A any](c *gc.C, ch <-chan windows.Window[A]) {
+	select {
+	case w := <-ch:
+		c.Fatalf("unexpected window: %+v", w)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package workqueue provides a work queue for controllers, modelled on
+// the Kubernetes client's workqueue: items may be added immediately,
+// after a delay, or after a delay determined by a RateLimiter, and each
+// item is processed by at most one worker at a time. Time is measured
+// with a clock.Clock.
+package workqueue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/timequeue"
+	"github.com/juju/errors"
+)
+
+// Config holds the configuration for a Queue.
+type Config[T comparable] struct {
+	// Clock is used to measure delays.
+	Clock clock.Clock
+
+	// RateLimiter determines the delays for AddRateLimited.
+	RateLimiter RateLimiter[T]
+}
+
+// Validate checks that the config is valid.
+func (config Config[T]) Validate() error {
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.RateLimiter == nil {
+		return errors.NotValidf("nil RateLimiter")
+	}
+	return nil
+}
+
+// Queue is a work queue of items of type T.
+//
+// An item is queued at most once, however many times it is added before
+// it is taken with Get. An item that is added while it is being processed,
+// between Get and Done, is queued again when Done is called, so no item is
+// processed by more than one worker at a time.
+//
+// Delayed items are held in a timequeue, serviced by the Queue's goroutine.
+// Queue's methods are safe for concurrent use.
+type Queue[T comparable] struct {
+	config Config[T]
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	queue        []T
+	dirty        map[T]bool
+	processing   map[T]bool
+	waiting      *timequeue.Queue[T, T]
+	shuttingDown bool
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New constructs and starts a new Queue with the given configuration.
+// The Queue will continue to add delayed items until it is shut down.
+func New[T comparable](config Config[T]) (*Queue[T], error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating work queue config")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue[T]{
+		config:     config,
+		dirty:      make(map[T]bool),
+		processing: make(map[T]bool),
+		waiting:    timequeue.New[T, T](config.Clock),
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.loop()
+	return q, nil
+}
+
+// Add queues the item, if it is not already queued.
+// After the Queue is shut down, Add does nothing.
+func (q *Queue[T]) Add(item T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.shuttingDown {
+		q.add(item)
+	}
+}
+
+// AddAfter queues the item after the specified delay. If the item is
+// already waiting to be queued, it is queued at the earlier of the two
+// times. After the Queue is shut down, AddAfter does nothing.
+func (q *Queue[T]) AddAfter(item T, delay time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	if delay <= 0 {
+		q.add(item)
+		return
+	}
+	t := q.config.Clock.Now().Add(delay)
+	if _, existing, ok := q.waiting.Get(item); ok {
+		if !t.Before(existing) {
+			return
+		}
+		q.waiting.Update(item, item, t)
+	} else {
+		q.waiting.Add(item, item, t)
+	}
+	q.notify()
+}
+
+// AddRateLimited queues the item after the delay determined
+// by the Queue's RateLimiter.
+func (q *Queue[T]) AddRateLimited(item T) {
+	q.AddAfter(item, q.config.RateLimiter.When(item))
+}
+
+// Forget tells the Queue's RateLimiter to stop tracking the item, typically
+// because it was processed successfully. It does not remove the item from
+// the Queue.
+func (q *Queue[T]) Forget(item T) {
+	q.config.RateLimiter.Forget(item)
+}
+
+// NumRequeues returns the number of times the item has been
+// rate limited since it was last forgotten.
+func (q *Queue[T]) NumRequeues(item T) int {
+	return q.config.RateLimiter.NumRequeues(item)
+}
+
+// Get blocks until an item is queued, and returns it. The caller must call
+// Done with the item when it has finished processing it. Once the Queue is
+// shut down and no items remain queued, Get returns with shutdown true.
+func (q *Queue[T]) Get() (item T, shutdown bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.queue) == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if len(q.queue) == 0 {
+		return item, true
+	}
+	item = q.queue[0]
+	var zero T
+	q.queue[0] = zero
+	q.queue = q.queue[1:]
+	q.processing[item] = true
+	delete(q.dirty, item)
+	return item, false
+}
+
+// Done marks the item as processed. If the item was added again while it
+// was being processed, it is queued again.
+func (q *Queue[T]) Done(item T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.processing, item)
+	if q.dirty[item] {
+		q.queue = append(q.queue, item)
+		q.cond.Signal()
+	}
+}
+
+// Len returns the number of queued items, excluding those
+// that are waiting for a delay to elapse.
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queue)
+}
+
+// ShutDown shuts down the Queue: items are no longer added, and items
+// waiting for a delay to elapse are discarded. Calls to Get continue to
+// return queued items until none remain. ShutDown waits for the Queue's
+// goroutine to stop.
+func (q *Queue[T]) ShutDown() {
+	q.mu.Lock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.cancel()
+	<-q.done
+}
+
+// ShuttingDown reports whether the Queue has been shut down.
+func (q *Queue[T]) ShuttingDown() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.shuttingDown
+}
+
+// add queues the item, unless it is already queued. add must be
+// called with q.mu held.
+func (q *Queue[T]) add(item T) {
+	if q.dirty[item] {
+		return
+	}
+	q.dirty[item] = true
+	if q.processing[item] {
+		// The item will be queued again when it is done.
+		return
+	}
+	q.queue = append(q.queue, item)
+	q.cond.Signal()
+}
+
+// notify wakes the loop so it will re-evaluate the next delayed item.
+func (q *Queue[T]) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue[T]) loop() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		next := q.waiting.Next()
+		q.mu.Unlock()
+
+		select {
+		case <-q.ctx.Done():
+			q.mu.Lock()
+			q.waiting.Clear(nil)
+			q.mu.Unlock()
+			return
+		case <-q.wake:
+		case <-next:
+			q.mu.Lock()
+			for _, item := range q.waiting.Ready(q.config.Clock.Now()) {
+				q.add(item)
+			}
+			q.mu.Unlock()
+		}
+	}
+}
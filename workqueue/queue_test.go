@@ -0,0 +1,188 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package workqueue_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/workqueue"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type queueSuite struct {
+	coretesting.BaseSuite
+	clock *coretesting.Clock
+}
+
+var _ = gc.Suite(&queueSuite{})
+
+func (s *queueSuite) SetUpTest(c *gc.C) {
+	s.BaseSuite.SetUpTest(c)
+	s.clock = coretesting.NewClock(time.Time{})
+}
+
+func (s *queueSuite) newQueue(c *gc.C) *workqueue.Queue[string] {
+	q, err := workqueue.New(workqueue.Config[string]{
+		Clock: s.clock,
+		RateLimiter: workqueue.NewBackoffRateLimiter[string](schedule.ExponentialBackoff{
+			Initial: time.Second,
+			Min:     time.Second,
+			Max:     4 * time.Second,
+		}),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return q
+}
+
+func (s *queueSuite) TestValidate(c *gc.C) {
+	_, err := workqueue.New(workqueue.Config[string]{})
+	c.Assert(err, gc.ErrorMatches, "validating work queue config: nil Clock not valid")
+	_, err = workqueue.New(workqueue.Config[string]{Clock: s.clock})
+	c.Assert(err, gc.ErrorMatches, "validating work queue config: nil RateLimiter not valid")
+}
+
+func (s *queueSuite) TestAddGetDone(c *gc.C) {
+	q := s.newQueue(c)
+	defer q.ShutDown()
+
+	q.Add("a")
+	q.Add("b")
+	q.Add("a")
+	c.Assert(q.Len(), gc.Equals, 2)
+	assertGet(c, q, "a")
+	assertGet(c, q, "b")
+	c.Assert(q.Len(), gc.Equals, 0)
+
+	// Adding an item while it is processed queues it again when done.
+	q.Add("a")
+	c.Assert(q.Len(), gc.Equals, 0)
+	q.Done("a")
+	c.Assert(q.Len(), gc.Equals, 1)
+	assertGet(c, q, "a")
+	q.Done("a")
+	q.Done("b")
+	c.Assert(q.Len(), gc.Equals, 0)
+}
+
+func (s *queueSuite) TestGetBlocks(c *gc.C) {
+	q := s.newQueue(c)
+	defer q.ShutDown()
+
+	got := make(chan string, 1)
+	go func() {
+		item, _ := q.Get()
+		got <- item
+	}()
+	assertNotReceived(c, got)
+	q.Add("a")
+	c.Assert(receive(c, got), gc.Equals, "a")
+}
+
+func (s *queueSuite) TestAddAfter(c *gc.C) {
+	q := s.newQueue(c)
+	defer q.ShutDown()
+
+	q.AddAfter("a", 2*time.Second)
+	q.AddAfter("b", time.Second)
+	q.AddAfter("a", 3*time.Second) // later; ignored
+	q.AddAfter("c", 0)
+	c.Assert(q.Len(), gc.Equals, 1)
+	assertGet(c, q, "c")
+
+	s.clock.Advance(time.Second)
+	waitUntil(c, func() bool { return q.Len() == 1 })
+	assertGet(c, q, "b")
+	s.clock.Advance(time.Second)
+	waitUntil(c, func() bool { return q.Len() == 1 })
+	assertGet(c, q, "a")
+}
+
+func (s *queueSuite) TestAddRateLimited(c *gc.C) {
+	q := s.newQueue(c)
+	defer q.ShutDown()
+
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		q.AddRateLimited("a")
+		s.clock.Advance(delay - time.Nanosecond)
+		assertNotReady(c, q)
+		s.clock.Advance(time.Nanosecond)
+		waitUntil(c, func() bool { return q.Len() == 1 })
+		assertGet(c, q, "a")
+		q.Done("a")
+	}
+	c.Assert(q.NumRequeues("a"), gc.Equals, 4)
+	q.Forget("a")
+	c.Assert(q.NumRequeues("a"), gc.Equals, 0)
+}
+
+func (s *queueSuite) TestShutDown(c *gc.C) {
+	q := s.newQueue(c)
+	q.Add("a")
+	q.AddAfter("b", time.Second)
+
+	got := make(chan bool, 1)
+	go func() {
+		_, shutdown := q.Get()
+		got <- shutdown
+		_, shutdown = q.Get()
+		got <- shutdown
+	}()
+	c.Assert(receive(c, got), gc.Equals, false)
+	q.ShutDown()
+	c.Assert(q.ShuttingDown(), jc.IsTrue)
+	c.Assert(receive(c, got), gc.Equals, true)
+
+	q.Add("c")
+	c.Assert(q.Len(), gc.Equals, 0)
+	s.clock.Advance(time.Second)
+	c.Assert(q.Len(), gc.Equals, 0)
+}
+
+func assertGet(c *gc.C, q *workqueue.Queue[string], expected string) {
+	item, shutdown := q.Get()
+	c.Assert(shutdown, jc.IsFalse)
+	c.Assert(item, gc.Equals, expected)
+}
+
+// assertNotReady asserts that no item is queued for a short while.
+func assertNotReady(c *gc.C, q *workqueue.Queue[string]) {
+	deadline := time.Now().Add(coretesting.ShortWait)
+	for time.Now().Before(deadline) {
+		c.Assert(q.Len(), gc.Equals, 0)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func receive[T any](c *gc.C, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("timed out waiting for value")
+	}
+	panic("unreachable")
+}
+
+func assertNotReceived[T any](c *gc.C, ch <-chan T) {
+	select {
+	case v := <-ch:
+		c.Fatalf("unexpected value: %v", v)
+	case <-time.After(coretesting.ShortWait):
+	}
+}
+
+// waitUntil waits for cond to return true, polling it periodically.
+func waitUntil(c *gc.C, cond func() bool) {
+	timeout := time.After(coretesting.LongWait)
+	for !cond() {
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for condition")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package workqueue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axw/juju-time/clock"
+	"github.com/axw/juju-time/ratelimit"
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/ttlcache"
+	"github.com/juju/errors"
+)
+
+// RateLimiter determines how long items should be delayed when they are
+// added with Queue.AddRateLimited.
+type RateLimiter[T comparable] interface {
+	// When returns how long the item should wait before it is
+	// queued, and records that it has been rate limited.
+	When(item T) time.Duration
+
+	// Forget stops tracking the item, resetting its delay.
+	Forget(item T)
+
+	// NumRequeues returns the number of times the item has been
+	// rate limited since it was last forgotten.
+	NumRequeues(item T) int
+}
+
+// BackoffRateLimiter delays each item with its own exponential backoff,
+// so that items that repeatedly fail are retried less and less often.
+type BackoffRateLimiter[T comparable] struct {
+	backoff schedule.ExponentialBackoff
+
+	mu    sync.Mutex
+	items map[T]*schedule.ExponentialBackoff
+}
+
+// NewBackoffRateLimiter returns a new BackoffRateLimiter, which delays
+// each item with a copy of the given backoff. The zero value backoff
+// does not delay an item the first time, and then delays it for 30
+// seconds, doubling up to 30 minutes.
+func NewBackoffRateLimiter[T comparable](backoff schedule.ExponentialBackoff) *BackoffRateLimiter[T] {
+	backoff.Reset()
+	return &BackoffRateLimiter[T]{
+		backoff: backoff,
+		items:   make(map[T]*schedule.ExponentialBackoff),
+	}
+}
+
+// When is part of the RateLimiter interface.
+func (r *BackoffRateLimiter[T]) When(item T) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.items[item]
+	if !ok {
+		backoff := r.backoff
+		b = &backoff
+		r.items[item] = b
+	}
+	return b.Delay()
+}
+
+// Forget is part of the RateLimiter interface.
+func (r *BackoffRateLimiter[T]) Forget(item T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.items, item)
+}
+
+// NumRequeues is part of the RateLimiter interface.
+func (r *BackoffRateLimiter[T]) NumRequeues(item T) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.items[item]; ok {
+		return b.Attempts()
+	}
+	return 0
+}
+
+// BucketRateLimiter paces all items through a single leaky bucket,
+// limiting the overall rate at which items are queued.
+type BucketRateLimiter[T comparable] struct {
+	bucket *ratelimit.LeakyBucket
+}
+
+// NewBucketRateLimiter returns a new BucketRateLimiter that queues
+// items no less than interval apart, as measured by the clock.
+func NewBucketRateLimiter[T comparable](clock clock.Clock, interval time.Duration) (*BucketRateLimiter[T], error) {
+	bucket, err := ratelimit.NewLeakyBucket(ratelimit.LeakyBucketConfig{
+		Clock:    clock,
+		Interval: interval,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &BucketRateLimiter[T]{bucket: bucket}, nil
+}
+
+// When is part of the RateLimiter interface.
+func (r *BucketRateLimiter[T]) When(item T) time.Duration {
+	// The bucket has no capacity limit, so the
+	// reservation always succeeds.
+	wait, _ := r.bucket.Reserve()
+	return wait
+}
+
+// Forget is part of the RateLimiter interface.
+func (r *BucketRateLimiter[T]) Forget(item T) {}
+
+// NumRequeues is part of the RateLimiter interface.
+func (r *BucketRateLimiter[T]) NumRequeues(item T) int {
+	return 0
+}
+
+// KeyedBucketRateLimiter paces each item through its own leaky bucket,
+// limiting the rate at which each item is queued, so that one item being
+// requeued repeatedly is delayed without delaying the others. Combine it
+// with a BucketRateLimiter, using MaxOf, to limit the overall rate too.
+//
+// An item's bucket is held in a ttlcache.Cache, and expires once it has
+// drained, so memory is bounded by the number of items queued in the
+// last Interval rather than by the number ever queued. The expiring
+// buckets are serviced by the cache's goroutine, which runs until the
+// KeyedBucketRateLimiter is killed.
+type KeyedBucketRateLimiter[T comparable] struct {
+	config ratelimit.LeakyBucketConfig
+
+	mu      sync.Mutex
+	buckets *ttlcache.Cache[T, *ratelimit.LeakyBucket]
+}
+
+// NewKeyedBucketRateLimiter returns a new KeyedBucketRateLimiter that
+// queues each item no less than interval after it was last queued, as
+// measured by the clock.
+func NewKeyedBucketRateLimiter[T comparable](clock clock.Clock, interval time.Duration) (*KeyedBucketRateLimiter[T], error) {
+	config := ratelimit.LeakyBucketConfig{
+		Clock:    clock,
+		Interval: interval,
+	}
+	if err := config.Validate(); err != nil {
+		return nil, errors.Annotate(err, "validating leaky bucket config")
+	}
+	buckets, err := ttlcache.New[T, *ratelimit.LeakyBucket](ttlcache.Config{Clock: clock})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &KeyedBucketRateLimiter[T]{config: config, buckets: buckets}, nil
+}
+
+// Kill stops the KeyedBucketRateLimiter from expiring buckets. Kill
+// does not wait for it to stop; use Wait for that.
+func (r *KeyedBucketRateLimiter[T]) Kill() {
+	r.buckets.Kill()
+}
+
+// Wait waits for the KeyedBucketRateLimiter to stop.
+func (r *KeyedBucketRateLimiter[T]) Wait() error {
+	return r.buckets.Wait()
+}
+
+// When is part of the RateLimiter interface.
+func (r *KeyedBucketRateLimiter[T]) When(item T) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bucket, ok := r.buckets.Get(item)
+	if !ok {
+		// The config has been validated, so this cannot fail.
+		bucket, _ = ratelimit.NewLeakyBucket(r.config)
+	}
+	// The bucket has no capacity limit, so the
+	// reservation always succeeds.
+	wait, _ := bucket.Reserve()
+	// Once the reservation has been released and a further interval
+	// has passed, the bucket is indistinguishable from a new one.
+	r.buckets.Set(item, bucket, wait+r.config.Interval)
+	return wait
+}
+
+// Forget is part of the RateLimiter interface.
+func (r *KeyedBucketRateLimiter[T]) Forget(item T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buckets.Delete(item)
+}
+
+// NumRequeues is part of the RateLimiter interface.
+func (r *KeyedBucketRateLimiter[T]) NumRequeues(item T) int {
+	return 0
+}
+
+// Len returns the number of items whose buckets are held, including
+// any that have drained but have not yet been removed.
+func (r *KeyedBucketRateLimiter[T]) Len() int {
+	return r.buckets.Len()
+}
+
+// MaxOf returns a RateLimiter that delays items by the longest delay
+// of the given RateLimiters; for example, a BackoffRateLimiter for
+// per-item backoff combined with a BucketRateLimiter for an overall
+// limit.
+func MaxOf[T comparable](limiters ...RateLimiter[T]) RateLimiter[T] {
+	return maxOf[T](limiters)
+}
+
+type maxOf[T comparable] []RateLimiter[T]
+
+// When is part of the RateLimiter interface.
+func (m maxOf[T]) When(item T) time.Duration {
+	var max time.Duration
+	for _, r := range m {
+		if d := r.When(item); d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// Forget is part of the RateLimiter interface.
+func (m maxOf[T]) Forget(item T) {
+	for _, r := range m {
+		r.Forget(item)
+	}
+}
+
+// NumRequeues is part of the RateLimiter interface.
+func (m maxOf[T]) NumRequeues(item T) int {
+	var max int
+	for _, r := range m {
+		if n := r.NumRequeues(item); n > max {
+			max = n
+		}
+	}
+	return max
+}
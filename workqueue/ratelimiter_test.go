@@ -0,0 +1,107 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package workqueue_test
+
+import (
+	"time"
+
+	"github.com/axw/juju-time/schedule"
+	"github.com/axw/juju-time/workqueue"
+	coretesting "github.com/juju/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type rateLimiterSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(&rateLimiterSuite{})
+
+func (s *rateLimiterSuite) TestBackoff(c *gc.C) {
+	r := workqueue.NewBackoffRateLimiter[string](schedule.ExponentialBackoff{
+		Min: time.Second,
+		Max: 3 * time.Second,
+	})
+	c.Assert(r.When("a"), gc.Equals, time.Duration(0))
+	c.Assert(r.When("a"), gc.Equals, time.Second)
+	c.Assert(r.When("b"), gc.Equals, time.Duration(0))
+	c.Assert(r.When("a"), gc.Equals, 2*time.Second)
+	c.Assert(r.When("a"), gc.Equals, 3*time.Second)
+	c.Assert(r.NumRequeues("a"), gc.Equals, 4)
+	c.Assert(r.NumRequeues("b"), gc.Equals, 1)
+	r.Forget("a")
+	c.Assert(r.NumRequeues("a"), gc.Equals, 0)
+	c.Assert(r.When("a"), gc.Equals, time.Duration(0))
+}
+
+func (s *rateLimiterSuite) TestBucket(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r, err := workqueue.NewBucketRateLimiter[string](clock, time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(r.When("a"), gc.Equals, time.Duration(0))
+	c.Assert(r.When("b"), gc.Equals, time.Second)
+	c.Assert(r.When("a"), gc.Equals, 2*time.Second)
+	c.Assert(r.NumRequeues("a"), gc.Equals, 0)
+
+	_, err = workqueue.NewBucketRateLimiter[string](clock, 0)
+	c.Assert(err, gc.ErrorMatches, ".*non-positive Interval not valid")
+}
+
+func (s *rateLimiterSuite) TestMaxOf(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	bucket, err := workqueue.NewBucketRateLimiter[string](clock, time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	backoff := workqueue.NewBackoffRateLimiter[string](schedule.ExponentialBackoff{
+		Min: 5 * time.Second,
+	})
+	r := workqueue.MaxOf[string](bucket, backoff)
+	c.Assert(r.When("a"), gc.Equals, time.Duration(0))
+	c.Assert(r.When("b"), gc.Equals, time.Second)
+	c.Assert(r.When("a"), gc.Equals, 5*time.Second)
+	c.Assert(r.NumRequeues("a"), gc.Equals, 2)
+	r.Forget("a")
+	c.Assert(r.NumRequeues("a"), gc.Equals, 0)
+}
+
+func (s *rateLimiterSuite) TestKeyedBucket(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	r, err := workqueue.NewKeyedBucketRateLimiter[string](clock, time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Wait()
+	defer r.Kill()
+
+	// Each item is paced by its own bucket, so a hot
+	// item does not delay the others.
+	c.Assert(r.When("a"), gc.Equals, time.Duration(0))
+	c.Assert(r.When("a"), gc.Equals, time.Second)
+	c.Assert(r.When("a"), gc.Equals, 2*time.Second)
+	c.Assert(r.When("b"), gc.Equals, time.Duration(0))
+	c.Assert(r.Len(), gc.Equals, 2)
+
+	r.Forget("b")
+	c.Assert(r.Len(), gc.Equals, 1)
+
+	// Drained buckets expire, bounding memory.
+	clock.Advance(3 * time.Second)
+	waitUntil(c, func() bool { return r.Len() == 0 })
+	c.Assert(r.When("a"), gc.Equals, time.Duration(0))
+
+	_, err = workqueue.NewKeyedBucketRateLimiter[string](clock, 0)
+	c.Assert(err, gc.ErrorMatches, "validating leaky bucket config: non-positive Interval not valid")
+}
+
+func (s *rateLimiterSuite) TestKeyedBucketWithGlobal(c *gc.C) {
+	clock := coretesting.NewClock(time.Time{})
+	keyed, err := workqueue.NewKeyedBucketRateLimiter[string](clock, 10*time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	defer keyed.Wait()
+	defer keyed.Kill()
+	global, err := workqueue.NewBucketRateLimiter[string](clock, time.Second)
+	c.Assert(err, jc.ErrorIsNil)
+	r := workqueue.MaxOf[string](keyed, global)
+	c.Assert(r.When("a"), gc.Equals, time.Duration(0))
+	c.Assert(r.When("a"), gc.Equals, 10*time.Second)
+	c.Assert(r.When("b"), gc.Equals, 2*time.Second)
+}